@@ -0,0 +1,466 @@
+// Package autocert obtains and renews TLS certificates with the ACME protocol.
+package autocert
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+const (
+	// certificates are renewed when they expire within this period.
+	renewBefore = 30 * 24 * time.Hour
+
+	obtainTimeout   = 5 * time.Minute
+	retryMinPeriod  = 1 * time.Minute
+	retryMaxPeriod  = 1 * time.Hour
+	maxCheckPeriod  = 12 * time.Hour
+	accountKeyFile  = "account.key"
+	certificateFile = "certificate.pem"
+)
+
+// ALPNProto is the ALPN protocol used by TLS-ALPN-01 challenges.
+// It must be added to the NextProtos of TLS listeners.
+const ALPNProto = acme.ALPNProto
+
+// Parent is implemented by acmeManager.
+type Parent interface {
+	Log(logger.Level, string, ...interface{})
+}
+
+// Manager obtains a certificate for a list of domains, keeps it renewed and
+// answers to HTTP-01 and TLS-ALPN-01 challenges.
+type Manager struct {
+	domains  []string
+	email    string
+	cacheDir string
+	parent   Parent
+
+	client    *acme.Client
+	ctx       context.Context
+	ctxCancel func()
+	wg        sync.WaitGroup
+
+	mutex      sync.RWMutex
+	cert       *tls.Certificate
+	httpTokens map[string]string
+	alpnCerts  map[string]*tls.Certificate
+}
+
+// New allocates a Manager. The account key and the certificate are stored in cacheDir.
+func New(
+	domains []string,
+	email string,
+	directory string,
+	cacheDir string,
+	parent Parent,
+) (*Manager, error) {
+	err := os.MkdirAll(cacheDir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+
+	accountKey, err := loadOrCreateKey(filepath.Join(cacheDir, accountKeyFile))
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the ACME account key: %s", err)
+	}
+
+	ctx, ctxCancel := context.WithCancel(context.Background())
+
+	m := &Manager{
+		domains:  domains,
+		email:    email,
+		cacheDir: cacheDir,
+		parent:   parent,
+		client: &acme.Client{
+			Key:          accountKey,
+			DirectoryURL: directory,
+		},
+		ctx:        ctx,
+		ctxCancel:  ctxCancel,
+		httpTokens: make(map[string]string),
+		alpnCerts:  make(map[string]*tls.Certificate),
+	}
+
+	// a cached certificate is used even if it doesn't cover all domains,
+	// until it's replaced by a new one.
+	cert, err := loadCertificate(filepath.Join(cacheDir, certificateFile))
+	if err == nil {
+		m.cert = cert
+	}
+
+	m.wg.Add(1)
+	go m.run()
+
+	return m, nil
+}
+
+// Close closes a Manager.
+func (m *Manager) Close() {
+	m.ctxCancel()
+	m.wg.Wait()
+}
+
+// HTTPHandler returns a handler that answers to HTTP-01 challenges.
+func (m *Manager) HTTPHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mutex.RLock()
+		res, ok := m.httpTokens[r.URL.Path]
+		m.mutex.RUnlock()
+
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(res))
+	})
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if !m.isAllowed(hello.ServerName) {
+		return nil, fmt.Errorf("domain '%s' is not allowed", hello.ServerName)
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, proto := range hello.SupportedProtos {
+		if proto == ALPNProto {
+			cert, ok := m.alpnCerts[strings.ToLower(hello.ServerName)]
+			if !ok {
+				return nil, fmt.Errorf("no TLS-ALPN-01 challenge for '%s'", hello.ServerName)
+			}
+			return cert, nil
+		}
+	}
+
+	if m.cert == nil {
+		return nil, fmt.Errorf("certificate is not available yet")
+	}
+
+	return m.cert, nil
+}
+
+func (m *Manager) isAllowed(serverName string) bool {
+	serverName = strings.ToLower(strings.TrimSuffix(serverName, "."))
+	for _, d := range m.domains {
+		if d == serverName {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manager) log(level logger.Level, format string, args ...interface{}) {
+	m.parent.Log(level, format, args...)
+}
+
+func (m *Manager) run() {
+	defer m.wg.Done()
+
+	retryPeriod := retryMinPeriod
+
+	for {
+		var wait time.Duration
+
+		if m.needsRenewal() {
+			err := m.obtain()
+			if err != nil {
+				if m.ctx.Err() != nil {
+					return
+				}
+
+				m.log(logger.Warn, "unable to obtain a certificate: %s (retrying in %v)", err, retryPeriod)
+				wait = retryPeriod
+				retryPeriod *= 2
+				if retryPeriod > retryMaxPeriod {
+					retryPeriod = retryMaxPeriod
+				}
+			} else {
+				m.log(logger.Info, "certificate obtained for %v", m.domains)
+				retryPeriod = retryMinPeriod
+				wait = maxCheckPeriod
+			}
+		} else {
+			wait = maxCheckPeriod
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-m.ctx.Done():
+			t.Stop()
+			return
+		}
+	}
+}
+
+func (m *Manager) needsRenewal() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if m.cert == nil {
+		return true
+	}
+
+	if time.Until(m.cert.Leaf.NotAfter) < renewBefore {
+		return true
+	}
+
+	for _, d := range m.domains {
+		if m.cert.Leaf.VerifyHostname(d) != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *Manager) obtain() error {
+	ctx, ctxCancel := context.WithTimeout(m.ctx, obtainTimeout)
+	defer ctxCancel()
+
+	defer func() {
+		m.mutex.Lock()
+		m.httpTokens = make(map[string]string)
+		m.alpnCerts = make(map[string]*tls.Certificate)
+		m.mutex.Unlock()
+	}()
+
+	acct := &acme.Account{}
+	if m.email != "" {
+		acct.Contact = []string{"mailto:" + m.email}
+	}
+
+	_, err := m.client.Register(ctx, acct, acme.AcceptTOS)
+	if err != nil && err != acme.ErrAccountAlreadyExists {
+		return fmt.Errorf("unable to register the account: %s", err)
+	}
+
+	order, err := m.client.AuthorizeOrder(ctx, acme.DomainIDs(m.domains...))
+	if err != nil {
+		return err
+	}
+
+	for _, zurl := range order.AuthzURLs {
+		err := m.authorize(ctx, zurl)
+		if err != nil {
+			return err
+		}
+	}
+
+	order, err = m.client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		DNSNames: m.domains,
+	}, key)
+	if err != nil {
+		return err
+	}
+
+	der, _, err := m.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return err
+	}
+
+	cert, err := newCertificate(der, key)
+	if err != nil {
+		return err
+	}
+
+	err = saveCertificate(filepath.Join(m.cacheDir, certificateFile), cert)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	m.cert = cert
+	m.mutex.Unlock()
+
+	return nil
+}
+
+// authorize solves the challenge of an authorization.
+// Both HTTP-01 and TLS-ALPN-01 are prepared; HTTP-01 is preferred.
+func (m *Manager) authorize(ctx context.Context, zurl string) error {
+	z, err := m.client.GetAuthorization(ctx, zurl)
+	if err != nil {
+		return err
+	}
+
+	if z.Status == acme.StatusValid {
+		return nil
+	}
+
+	var chal *acme.Challenge
+
+	for _, c := range z.Challenges {
+		switch c.Type {
+		case "http-01":
+			res, err := m.client.HTTP01ChallengeResponse(c.Token)
+			if err != nil {
+				return err
+			}
+
+			m.mutex.Lock()
+			m.httpTokens[m.client.HTTP01ChallengePath(c.Token)] = res
+			m.mutex.Unlock()
+
+			chal = c
+
+		case "tls-alpn-01":
+			cert, err := m.client.TLSALPN01ChallengeCert(c.Token, z.Identifier.Value)
+			if err != nil {
+				return err
+			}
+
+			m.mutex.Lock()
+			m.alpnCerts[strings.ToLower(z.Identifier.Value)] = &cert
+			m.mutex.Unlock()
+
+			if chal == nil {
+				chal = c
+			}
+		}
+	}
+
+	if chal == nil {
+		return fmt.Errorf("no supported challenge for '%s'", z.Identifier.Value)
+	}
+
+	_, err = m.client.Accept(ctx, chal)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.client.WaitAuthorization(ctx, z.URI)
+	return err
+}
+
+func loadOrCreateKey(fpath string) (crypto.Signer, error) {
+	byts, err := ioutil.ReadFile(fpath)
+	if err == nil {
+		block, _ := pem.Decode(byts)
+		if block == nil {
+			return nil, fmt.Errorf("invalid key")
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ioutil.WriteFile(fpath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func newCertificate(der [][]byte, key crypto.Signer) (*tls.Certificate, error) {
+	if len(der) == 0 {
+		return nil, fmt.Errorf("empty certificate chain")
+	}
+
+	leaf, err := x509.ParseCertificate(der[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: der,
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// the certificate is stored in a single file that contains the key and the chain.
+func loadCertificate(fpath string) (*tls.Certificate, error) {
+	byts, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	var key crypto.Signer
+	var der [][]byte
+
+	for {
+		var block *pem.Block
+		block, byts = pem.Decode(byts)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+
+		case "CERTIFICATE":
+			der = append(der, block.Bytes)
+		}
+	}
+
+	if key == nil {
+		return nil, fmt.Errorf("key not found")
+	}
+
+	return newCertificate(der, key)
+}
+
+func saveCertificate(fpath string, cert *tls.Certificate) error {
+	keyDer, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		return err
+	}
+
+	var buf []byte
+	buf = append(buf, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})...)
+	for _, der := range cert.Certificate {
+		buf = append(buf, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+
+	return ioutil.WriteFile(fpath, buf, 0o600)
+}
@@ -0,0 +1,107 @@
+package autocert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+type nilParent struct{}
+
+func (nilParent) Log(logger.Level, string, ...interface{}) {}
+
+func newTestCertificate(t *testing.T, domain string) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domain},
+	}, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := newCertificate([][]byte{der}, key)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestManager(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtsp-autocert")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = saveCertificate(filepath.Join(dir, certificateFile), newTestCertificate(t, "stream.example.com"))
+	require.NoError(t, err)
+
+	// the directory is not reachable, certificates can only be loaded from the cache
+	m, err := New([]string{"stream.example.com"}, "", "http://127.0.0.1:8090/directory", dir, nilParent{})
+	require.NoError(t, err)
+	defer m.Close()
+
+	_, err = os.Stat(filepath.Join(dir, accountKeyFile))
+	require.NoError(t, err)
+
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "stream.example.com"})
+	require.NoError(t, err)
+	require.Equal(t, "stream.example.com", cert.Leaf.Subject.CommonName)
+
+	_, err = m.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.example.com"})
+	require.EqualError(t, err, "domain 'other.example.com' is not allowed")
+
+	_, err = m.GetCertificate(&tls.ClientHelloInfo{
+		ServerName:      "stream.example.com",
+		SupportedProtos: []string{ALPNProto},
+	})
+	require.EqualError(t, err, "no TLS-ALPN-01 challenge for 'stream.example.com'")
+
+	m.mutex.Lock()
+	m.httpTokens["/.well-known/acme-challenge/mytoken"] = "mytoken.thumbprint"
+	m.mutex.Unlock()
+
+	for _, ca := range []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/.well-known/acme-challenge/mytoken", http.StatusOK, "mytoken.thumbprint"},
+		{"/.well-known/acme-challenge/other", http.StatusNotFound, ""},
+		{"/", http.StatusNotFound, ""},
+	} {
+		w := httptest.NewRecorder()
+		m.HTTPHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, ca.path, nil))
+		require.Equal(t, ca.status, w.Code)
+		require.Equal(t, ca.body, w.Body.String())
+	}
+}
+
+func TestManagerNeedsRenewal(t *testing.T) {
+	m := &Manager{domains: []string{"stream.example.com"}}
+	require.Equal(t, true, m.needsRenewal())
+
+	m.cert = newTestCertificate(t, "stream.example.com")
+	require.Equal(t, false, m.needsRenewal())
+
+	m.domains = append(m.domains, "other.example.com")
+	require.Equal(t, true, m.needsRenewal())
+}
@@ -0,0 +1,230 @@
+// Package bench contains the bench subcommand, that measures the capacity
+// of a server instance by connecting synthetic readers and publishers.
+package bench
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// config is the configuration of a benchmark.
+type config struct {
+	// URL of the stream that is read, with RTSP (rtsp://, rtsps://) or HLS (http://, https://).
+	url string
+
+	// URL where publishers publish to. It defaults to url.
+	publishURL string
+
+	readers    int
+	publishers int
+	duration   time.Duration
+
+	// RTSP transport; nil means automatic.
+	transport *gortsplib.Transport
+}
+
+// report contains the results of a benchmark.
+type report struct {
+	duration   time.Duration
+	readers    *clientsReport
+	publishers *clientsReport
+}
+
+// Main handles the "bench" subcommand and returns the exit code.
+func Main(args []string) int {
+	k := kingpin.New("rtsp-simple-server bench",
+		"Connect synthetic readers and publishers to a server and report setup latency, packet loss and throughput.")
+
+	argURL := k.Arg("url", "URL of the stream to read, with RTSP (rtsp://host:8554/path) or HLS (http://host:8888/path).").
+		Required().String()
+	argReaders := k.Flag("readers", "number of readers.").
+		Default("10").Int()
+	argPublishers := k.Flag("publishers", "number of publishers of a synthetic stream. When greater than zero, "+
+		"publisher N publishes to <url>_N and readers are spread among the published streams.").
+		Default("0").Int()
+	argPublishURL := k.Flag("publish-url", "URL where publishers publish to, if different from the read URL "+
+		"(for instance when readers use HLS).").
+		String()
+	argDuration := k.Flag("duration", "duration of the benchmark.").
+		Default("30s").Duration()
+	argTransport := k.Flag("transport", "RTSP transport.").
+		Default("automatic").Enum("automatic", "udp", "tcp")
+
+	kingpin.MustParse(k.Parse(args))
+
+	cnf := config{
+		url:        *argURL,
+		publishURL: *argPublishURL,
+		readers:    *argReaders,
+		publishers: *argPublishers,
+		duration:   *argDuration,
+	}
+
+	switch *argTransport {
+	case "udp":
+		v := gortsplib.TransportUDP
+		cnf.transport = &v
+
+	case "tcp":
+		v := gortsplib.TransportTCP
+		cnf.transport = &v
+	}
+
+	rep, err := run(context.Background(), cnf)
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return 1
+	}
+
+	rep.print(os.Stdout)
+
+	if rep.readers.failed != 0 || rep.publishers.failed != 0 {
+		return 1
+	}
+
+	return 0
+}
+
+func isHLSURL(ur string) bool {
+	return strings.HasPrefix(ur, "http://") || strings.HasPrefix(ur, "https://")
+}
+
+// streamURL returns the URL of the n-th published stream,
+// or the URL itself if n is zero.
+func streamURL(ur string, n int) string {
+	if n == 0 {
+		return ur
+	}
+
+	u, err := url.Parse(ur)
+	if err != nil {
+		return ur
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/") + "_" + strconv.FormatInt(int64(n), 10)
+	return u.String()
+}
+
+// run runs a benchmark.
+func run(ctx context.Context, cnf config) (*report, error) {
+	if cnf.publishURL == "" {
+		cnf.publishURL = cnf.url
+	}
+
+	if cnf.readers < 0 || cnf.publishers < 0 {
+		return nil, fmt.Errorf("the number of readers and publishers can't be negative")
+	}
+
+	if cnf.publishers > 0 && isHLSURL(cnf.publishURL) {
+		return nil, fmt.Errorf("publishers require a RTSP URL; use --publish-url")
+	}
+
+	ctx, ctxCancel := context.WithTimeout(ctx, cnf.duration)
+	defer ctxCancel()
+
+	var wg sync.WaitGroup
+	start := time.Now()
+
+	publishers := make([]*clientStats, cnf.publishers)
+	for i := range publishers {
+		publishers[i] = newClientStats()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			runPublisher(ctx, streamURL(cnf.publishURL, i+1), cnf.transport, publishers[i])
+		}(i)
+	}
+
+	// wait for publishers before starting readers
+	if cnf.publishers > 0 {
+		select {
+		case <-time.After(1 * time.Second):
+		case <-ctx.Done():
+		}
+	}
+
+	readers := make([]*clientStats, cnf.readers)
+	for i := range readers {
+		n := 0
+		if cnf.publishers > 0 {
+			n = (i % cnf.publishers) + 1
+		}
+		ur := streamURL(cnf.url, n)
+
+		readers[i] = newClientStats()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if isHLSURL(ur) {
+				runHLSReader(ctx, strings.TrimSuffix(ur, "/")+"/index.m3u8", readers[i])
+			} else {
+				runRTSPReader(ctx, ur, cnf.transport, readers[i])
+			}
+		}(i)
+	}
+
+	<-ctx.Done()
+	wg.Wait()
+
+	return &report{
+		duration:   time.Since(start),
+		readers:    newClientsReport(readers),
+		publishers: newClientsReport(publishers),
+	}, nil
+}
+
+// print prints the report in human-readable format.
+func (r *report) print(w io.Writer) {
+	fmt.Fprintf(w, "duration: %v\n", r.duration.Round(time.Millisecond))
+
+	for _, g := range []struct {
+		name string
+		rep  *clientsReport
+	}{
+		{"publishers", r.publishers},
+		{"readers", r.readers},
+	} {
+		if g.rep.count == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "%s: %d, ready: %d, failed: %d\n", g.name, g.rep.count, g.rep.ready, g.rep.failed)
+
+		if g.rep.ready != 0 {
+			fmt.Fprintf(w, "  setup latency: min %v, avg %v, max %v\n",
+				g.rep.latencyMin.Round(time.Millisecond),
+				g.rep.latencyAvg.Round(time.Millisecond),
+				g.rep.latencyMax.Round(time.Millisecond))
+		}
+
+		fmt.Fprintf(w, "  packets: %d, lost: %d (%.2f%%)\n", g.rep.packets, g.rep.lost, g.rep.lossRate())
+
+		secs := r.duration.Seconds()
+		if secs > 0 {
+			fmt.Fprintf(w, "  throughput: %.2f Mbit/s total, %.2f Mbit/s per client\n",
+				float64(g.rep.bytes)*8/secs/1000000,
+				float64(g.rep.bytes)*8/secs/1000000/float64(g.rep.count))
+		}
+
+		errs := make([]string, 0, len(g.rep.errors))
+		for e := range g.rep.errors {
+			errs = append(errs, e)
+		}
+		sort.Strings(errs)
+
+		for _, e := range errs {
+			fmt.Fprintf(w, "  error (%d clients): %s\n", g.rep.errors[e], e)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/aler9/gortsplib/pkg/base"
+	"github.com/stretchr/testify/require"
+)
+
+func rtpPacket(seq uint16) []byte {
+	return []byte{0x80, 96, byte(seq >> 8), byte(seq), 0, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3, 4}
+}
+
+func TestClientStats(t *testing.T) {
+	s := newClientStats()
+
+	for _, seq := range []uint16{65533, 65534, 1, 2, 2, 1, 5} {
+		s.onPacket(0, rtpPacket(seq))
+	}
+	s.onPacket(1, rtpPacket(100))
+	s.onPacket(1, rtpPacket(101))
+
+	require.Equal(t, true, s.ready)
+	require.Equal(t, uint64(9), s.packets)
+	require.Equal(t, uint64(9*16), s.bytes)
+	require.Equal(t, uint64(4), s.lost)
+
+	s.setError(errors.New("first"))
+	s.setError(errors.New("second"))
+
+	rep := newClientsReport([]*clientStats{s, newClientStats()})
+	require.Equal(t, 2, rep.count)
+	require.Equal(t, 1, rep.ready)
+	require.Equal(t, 1, rep.failed)
+	require.Equal(t, map[string]int{"first": 1}, rep.errors)
+	require.InDelta(t, 30.77, rep.lossRate(), 0.01)
+}
+
+func TestStreamURL(t *testing.T) {
+	require.Equal(t, "rtsp://localhost:8554/mystream", streamURL("rtsp://localhost:8554/mystream", 0))
+	require.Equal(t, "rtsp://localhost:8554/mystream_3", streamURL("rtsp://localhost:8554/mystream", 3))
+	require.Equal(t, "rtsp://localhost:8554/mystream_3?key=val", streamURL("rtsp://localhost:8554/mystream?key=val", 3))
+	require.Equal(t, "http://localhost:8888/mystream_1", streamURL("http://localhost:8888/mystream/", 1))
+}
+
+type testServerHandler struct {
+	mutex      sync.Mutex
+	streams    map[string]*gortsplib.ServerStream
+	publishers map[*gortsplib.ServerSession]*gortsplib.ServerStream
+}
+
+func (sh *testServerHandler) OnDescribe(ctx *gortsplib.ServerHandlerOnDescribeCtx) (*base.Response, *gortsplib.ServerStream, error) {
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	st, ok := sh.streams[ctx.Path]
+	if !ok {
+		return &base.Response{StatusCode: base.StatusNotFound}, nil, nil
+	}
+	return &base.Response{StatusCode: base.StatusOK}, st, nil
+}
+
+func (sh *testServerHandler) OnAnnounce(ctx *gortsplib.ServerHandlerOnAnnounceCtx) (*base.Response, error) {
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	st := gortsplib.NewServerStream(ctx.Tracks)
+	sh.streams[ctx.Path] = st
+	sh.publishers[ctx.Session] = st
+	return &base.Response{StatusCode: base.StatusOK}, nil
+}
+
+func (sh *testServerHandler) OnSetup(ctx *gortsplib.ServerHandlerOnSetupCtx) (*base.Response, *gortsplib.ServerStream, error) {
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	if st, ok := sh.publishers[ctx.Session]; ok {
+		return &base.Response{StatusCode: base.StatusOK}, st, nil
+	}
+
+	st, ok := sh.streams[ctx.Path]
+	if !ok {
+		return &base.Response{StatusCode: base.StatusNotFound}, nil, nil
+	}
+	return &base.Response{StatusCode: base.StatusOK}, st, nil
+}
+
+func (sh *testServerHandler) OnPlay(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+	return &base.Response{StatusCode: base.StatusOK}, nil
+}
+
+func (sh *testServerHandler) OnRecord(ctx *gortsplib.ServerHandlerOnRecordCtx) (*base.Response, error) {
+	return &base.Response{StatusCode: base.StatusOK}, nil
+}
+
+func (sh *testServerHandler) OnPacketRTP(ctx *gortsplib.ServerHandlerOnPacketRTPCtx) {
+	sh.mutex.Lock()
+	st := sh.publishers[ctx.Session]
+	sh.mutex.Unlock()
+
+	if st != nil {
+		st.WritePacketRTP(ctx.TrackID, ctx.Payload)
+	}
+}
+
+func TestRun(t *testing.T) {
+	s := &gortsplib.Server{
+		Handler: &testServerHandler{
+			streams:    make(map[string]*gortsplib.ServerStream),
+			publishers: make(map[*gortsplib.ServerSession]*gortsplib.ServerStream),
+		},
+		RTSPAddress: "127.0.0.1:8654",
+	}
+	err := s.Start()
+	require.NoError(t, err)
+	defer s.Close()
+
+	tcp := gortsplib.TransportTCP
+
+	rep, err := run(context.Background(), config{
+		url:        "rtsp://127.0.0.1:8654/bench",
+		readers:    4,
+		publishers: 2,
+		duration:   3 * time.Second,
+		transport:  &tcp,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, 2, rep.publishers.count)
+	require.Equal(t, 2, rep.publishers.ready)
+	require.Equal(t, 0, rep.publishers.failed)
+	require.Equal(t, 4, rep.readers.count)
+	require.Equal(t, 4, rep.readers.ready)
+	require.Equal(t, 0, rep.readers.failed)
+	require.NotZero(t, rep.readers.packets)
+
+	var buf bytes.Buffer
+	rep.print(&buf)
+	require.Contains(t, buf.String(), "publishers: 2, ready: 2, failed: 0\n")
+	require.Contains(t, buf.String(), "readers: 4, ready: 4, failed: 0\n")
+}
+
+func TestRunErrors(t *testing.T) {
+	_, err := run(context.Background(), config{
+		url:        "http://127.0.0.1:8888/bench",
+		publishers: 1,
+		duration:   time.Second,
+	})
+	require.EqualError(t, err, "publishers require a RTSP URL; use --publish-url")
+
+	rep, err := run(context.Background(), config{
+		url:      "rtsp://127.0.0.1:8655/bench",
+		readers:  2,
+		duration: time.Second,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, rep.readers.failed)
+	require.Equal(t, 0, rep.readers.ready)
+}
@@ -0,0 +1,143 @@
+package bench
+
+import (
+	"context"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/aler9/gortsplib/pkg/rtph264"
+
+	"github.com/aler9/rtsp-simple-server/internal/hls"
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+	"github.com/aler9/rtsp-simple-server/internal/testsrc"
+)
+
+const (
+	publisherWidth  = 640
+	publisherHeight = 360
+	publisherFPS    = 25
+)
+
+// runRTSPReader reads a stream with RTSP until the context is canceled.
+func runRTSPReader(ctx context.Context, ur string, transport *gortsplib.Transport, stats *clientStats) {
+	c := &gortsplib.Client{
+		Transport:   transport,
+		OnPacketRTP: stats.onPacket,
+	}
+
+	err := c.StartReading(ur)
+	if err != nil {
+		stats.setError(err)
+		return
+	}
+	defer c.Close()
+
+	waitErr := make(chan error)
+	go func() { waitErr <- c.Wait() }()
+
+	select {
+	case err := <-waitErr:
+		stats.setError(err)
+
+	case <-ctx.Done():
+		c.Close()
+		<-waitErr
+	}
+}
+
+type hlsReaderParent struct{}
+
+func (hlsReaderParent) Log(logger.Level, string, ...interface{}) {}
+
+// runHLSReader reads a stream with HLS until the context is canceled.
+func runHLSReader(ctx context.Context, ur string, stats *clientStats) {
+	c, err := hls.NewClient(
+		ur,
+		"",
+		func(*gortsplib.Track, *gortsplib.Track) error {
+			return nil
+		},
+		func(isVideo bool, pkt []byte) {
+			trackID := 0
+			if !isVideo {
+				trackID = 1
+			}
+			stats.onPacket(trackID, pkt)
+		},
+		hlsReaderParent{})
+	if err != nil {
+		stats.setError(err)
+		return
+	}
+	defer c.Close()
+
+	select {
+	case err := <-c.Wait():
+		stats.setError(err)
+
+	case <-ctx.Done():
+	}
+}
+
+// runPublisher publishes a synthetic H264 stream with RTSP until the context is canceled.
+func runPublisher(ctx context.Context, ur string, transport *gortsplib.Transport, stats *clientStats) {
+	pattern := testsrc.NewPattern(publisherWidth, publisherHeight, publisherFPS)
+	encoder := testsrc.NewEncoder(publisherWidth, publisherHeight, publisherFPS, publisherFPS)
+
+	track, err := gortsplib.NewTrackH264(96, &gortsplib.TrackConfigH264{
+		SPS: encoder.SPS(),
+		PPS: encoder.PPS(),
+	})
+	if err != nil {
+		stats.setError(err)
+		return
+	}
+
+	c := &gortsplib.Client{
+		Transport: transport,
+	}
+
+	err = c.StartPublishing(ur, gortsplib.Tracks{track})
+	if err != nil {
+		stats.setError(err)
+		return
+	}
+	defer c.Close()
+
+	rtpEncoder := rtph264.NewEncoder(96, nil, nil, nil)
+
+	ticker := time.NewTicker(time.Second / publisherFPS)
+	defer ticker.Stop()
+
+	for n := 0; ; n++ {
+		nalu, _ := encoder.Encode(pattern.Draw(n))
+
+		pkts, err := rtpEncoder.Encode([][]byte{nalu}, time.Duration(n)*time.Second/publisherFPS)
+		if err != nil {
+			stats.setError(err)
+			return
+		}
+
+		for _, pkt := range pkts {
+			byts, err := pkt.Marshal()
+			if err != nil {
+				stats.setError(err)
+				return
+			}
+
+			err = c.WritePacketRTP(0, byts)
+			if err != nil {
+				stats.setError(err)
+				return
+			}
+
+			stats.onPacket(0, byts)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
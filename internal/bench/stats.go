@@ -0,0 +1,138 @@
+package bench
+
+import (
+	"sync"
+	"time"
+)
+
+// clientStats contains the statistics of a synthetic reader or publisher.
+type clientStats struct {
+	start time.Time
+
+	mutex        sync.Mutex
+	ready        bool
+	setupLatency time.Duration
+	err          error
+	packets      uint64
+	bytes        uint64
+	lost         uint64
+	lastSeq      map[int]uint16
+}
+
+func newClientStats() *clientStats {
+	return &clientStats{
+		start:   time.Now(),
+		lastSeq: make(map[int]uint16),
+	}
+}
+
+func (s *clientStats) setError(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// setReady is called when the first packet is received or sent.
+func (s *clientStats) setReady() {
+	if !s.ready {
+		s.ready = true
+		s.setupLatency = time.Since(s.start)
+	}
+}
+
+// onPacket is called for every RTP packet. Lost packets are counted
+// by looking for gaps in sequence numbers.
+func (s *clientStats) onPacket(trackID int, pkt []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.setReady()
+	s.packets++
+	s.bytes += uint64(len(pkt))
+
+	if len(pkt) < 12 {
+		return
+	}
+
+	seq := uint16(pkt[2])<<8 | uint16(pkt[3])
+
+	if last, ok := s.lastSeq[trackID]; ok {
+		diff := seq - last
+
+		// ignore duplicated and reordered packets
+		if diff == 0 || diff >= 0x8000 {
+			return
+		}
+
+		s.lost += uint64(diff - 1)
+	}
+
+	s.lastSeq[trackID] = seq
+}
+
+// clientsReport contains the aggregated statistics of a group of clients.
+type clientsReport struct {
+	count      int
+	ready      int
+	failed     int
+	latencyMin time.Duration
+	latencyAvg time.Duration
+	latencyMax time.Duration
+	packets    uint64
+	bytes      uint64
+	lost       uint64
+	errors     map[string]int
+}
+
+func newClientsReport(clients []*clientStats) *clientsReport {
+	r := &clientsReport{
+		count:  len(clients),
+		errors: make(map[string]int),
+	}
+
+	var latencySum time.Duration
+
+	for _, s := range clients {
+		s.mutex.Lock()
+
+		if s.ready {
+			r.ready++
+			latencySum += s.setupLatency
+
+			if r.latencyMin == 0 || s.setupLatency < r.latencyMin {
+				r.latencyMin = s.setupLatency
+			}
+			if s.setupLatency > r.latencyMax {
+				r.latencyMax = s.setupLatency
+			}
+		}
+
+		if s.err != nil {
+			r.failed++
+			r.errors[s.err.Error()]++
+		}
+
+		r.packets += s.packets
+		r.bytes += s.bytes
+		r.lost += s.lost
+
+		s.mutex.Unlock()
+	}
+
+	if r.ready != 0 {
+		r.latencyAvg = latencySum / time.Duration(r.ready)
+	}
+
+	return r
+}
+
+// lossRate returns the percentage of lost packets.
+func (r *clientsReport) lossRate() float64 {
+	if r.packets+r.lost == 0 {
+		return 0
+	}
+	return float64(r.lost) * 100 / float64(r.packets+r.lost)
+}
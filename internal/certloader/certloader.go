@@ -0,0 +1,159 @@
+// Package certloader contains a TLS certificate loader that reloads certificates when they change.
+package certloader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aler9/rtsp-simple-server/internal/confwatcher"
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+const (
+	// certificate and key are usually replaced with two separate writes;
+	// when the first write is detected, the pair may be inconsistent.
+	retryPeriod = 1 * time.Second
+	maxRetries  = 5
+)
+
+// Pair is a certificate and key pair.
+type Pair struct {
+	CertPath string
+	KeyPath  string
+}
+
+// Parent is implemented by Core.
+type Parent interface {
+	Log(logger.Level, string, ...interface{})
+}
+
+// CertLoader loads a list of certificate and key pairs and reloads them
+// when their files change.
+// The first pair is the default one; the others are selected through SNI.
+type CertLoader struct {
+	pairs  []Pair
+	parent Parent
+
+	watcher *confwatcher.ConfWatcher
+	mutex   sync.RWMutex
+	certs   []*tls.Certificate
+
+	done chan struct{}
+}
+
+// New allocates a CertLoader.
+func New(pairs []Pair, parent Parent) (*CertLoader, error) {
+	certs, err := load(pairs)
+	if err != nil {
+		return nil, err
+	}
+
+	var otherPaths []string
+	otherPaths = append(otherPaths, pairs[0].KeyPath)
+	for _, pair := range pairs[1:] {
+		otherPaths = append(otherPaths, pair.CertPath, pair.KeyPath)
+	}
+
+	watcher, err := confwatcher.New(pairs[0].CertPath, otherPaths...)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &CertLoader{
+		pairs:   pairs,
+		parent:  parent,
+		watcher: watcher,
+		certs:   certs,
+		done:    make(chan struct{}),
+	}
+
+	go l.run()
+
+	return l, nil
+}
+
+// Close closes a CertLoader.
+func (l *CertLoader) Close() {
+	l.watcher.Close()
+	<-l.done
+}
+
+func (l *CertLoader) run() {
+	defer close(l.done)
+
+	retries := 0
+	retryTimer := time.NewTimer(0)
+	<-retryTimer.C
+	defer retryTimer.Stop()
+
+	for {
+		select {
+		case _, ok := <-l.watcher.Watch():
+			if !ok {
+				return
+			}
+			retries = 0
+
+		case <-retryTimer.C:
+		}
+
+		certs, err := load(l.pairs)
+		if err != nil {
+			retries++
+			if retries <= maxRetries {
+				retryTimer.Reset(retryPeriod)
+			} else {
+				l.parent.Log(logger.Warn, "unable to reload certificates: %s; using the previous ones", err)
+			}
+			continue
+		}
+
+		l.mutex.Lock()
+		l.certs = certs
+		l.mutex.Unlock()
+
+		l.parent.Log(logger.Info, "certificates reloaded")
+	}
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (l *CertLoader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	if hello.ServerName != "" {
+		serverName := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+		for _, cert := range l.certs {
+			if cert.Leaf.VerifyHostname(serverName) == nil {
+				return cert, nil
+			}
+		}
+	}
+
+	return l.certs[0], nil
+}
+
+func load(pairs []Pair) ([]*tls.Certificate, error) {
+	certs := make([]*tls.Certificate, len(pairs))
+
+	for i, pair := range pairs {
+		cert, err := tls.LoadX509KeyPair(pair.CertPath, pair.KeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load the certificate (%s) and key (%s): %s",
+				pair.CertPath, pair.KeyPath, err)
+		}
+
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, err
+		}
+
+		certs[i] = &cert
+	}
+
+	return certs, nil
+}
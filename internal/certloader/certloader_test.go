@@ -0,0 +1,98 @@
+package certloader
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+type nilParent struct{}
+
+func (nilParent) Log(logger.Level, string, ...interface{}) {}
+
+func writeCertificate(t *testing.T, dir string, name string, domain string) Pair {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	pair := Pair{
+		CertPath: filepath.Join(dir, name+".crt"),
+		KeyPath:  filepath.Join(dir, name+".key"),
+	}
+
+	err = ioutil.WriteFile(pair.KeyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600)
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(pair.CertPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644)
+	require.NoError(t, err)
+
+	return pair
+}
+
+func TestCertLoader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtsp-certloader")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	l, err := New([]Pair{
+		writeCertificate(t, dir, "default", "default.example.com"),
+		writeCertificate(t, dir, "other", "other.example.com"),
+	}, nilParent{})
+	require.NoError(t, err)
+	defer l.Close()
+
+	for _, ca := range []struct {
+		serverName string
+		cn         string
+	}{
+		{"", "default.example.com"},
+		{"default.example.com", "default.example.com"},
+		{"OTHER.example.com", "other.example.com"},
+		{"unknown.example.com", "default.example.com"},
+	} {
+		cert, err := l.GetCertificate(&tls.ClientHelloInfo{ServerName: ca.serverName})
+		require.NoError(t, err)
+		require.Equal(t, ca.cn, cert.Leaf.Subject.CommonName)
+	}
+
+	// certificates are reloaded when files change
+	writeCertificate(t, dir, "other", "renewed.example.com")
+
+	require.Eventually(t, func() bool {
+		cert, err := l.GetCertificate(&tls.ClientHelloInfo{ServerName: "renewed.example.com"})
+		return err == nil && cert.Leaf.Subject.CommonName == "renewed.example.com"
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestCertLoaderError(t *testing.T) {
+	_, err := New([]Pair{{CertPath: "/nonexisting.crt", KeyPath: "/nonexisting.key"}}, nilParent{})
+	require.EqualError(t, err, "unable to load the certificate (/nonexisting.crt) and key (/nonexisting.key): "+
+		"open /nonexisting.crt: no such file or directory")
+}
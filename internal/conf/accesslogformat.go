@@ -0,0 +1,51 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+// AccessLogFormat is the accessLogFormat parameter.
+type AccessLogFormat logger.AccessFormat
+
+// MarshalJSON marshals an AccessLogFormat into JSON.
+func (d AccessLogFormat) MarshalJSON() ([]byte, error) {
+	var out string
+
+	switch d {
+	case AccessLogFormat(logger.AccessFormatJSON):
+		out = "json"
+
+	default:
+		out = "clf"
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON unmarshals an AccessLogFormat from JSON.
+func (d *AccessLogFormat) UnmarshalJSON(b []byte) error {
+	var in string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	switch in {
+	case "clf":
+		*d = AccessLogFormat(logger.AccessFormatCLF)
+
+	case "json":
+		*d = AccessLogFormat(logger.AccessFormatJSON)
+
+	default:
+		return fmt.Errorf("invalid access log format: %s", in)
+	}
+
+	return nil
+}
+
+func (d *AccessLogFormat) unmarshalEnv(s string) error {
+	return d.UnmarshalJSON([]byte(`"` + s + `"`))
+}
@@ -0,0 +1,16 @@
+package conf
+
+import (
+	"strings"
+)
+
+const unixSocketPrefix = "unix:"
+
+// UnixSocketPath returns the path of the Unix socket contained into
+// a listener address in the format unix:/path.
+func UnixSocketPath(address string) (string, bool) {
+	if !strings.HasPrefix(address, unixSocketPrefix) {
+		return "", false
+	}
+	return address[len(unixSocketPrefix):], true
+}
@@ -1,19 +1,26 @@
 package conf
 
 import (
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math"
+	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/aler9/gortsplib"
+	"github.com/aler9/gortsplib/pkg/base"
 	"github.com/aler9/gortsplib/pkg/headers"
 	"golang.org/x/crypto/nacl/secretbox"
 	"gopkg.in/yaml.v2"
 
+	"github.com/aler9/rtsp-simple-server/internal/externalcmd"
 	"github.com/aler9/rtsp-simple-server/internal/logger"
 )
 
@@ -36,107 +43,122 @@ func decrypt(key string, byts []byte) ([]byte, error) {
 	return decrypted, nil
 }
 
-func loadFromFile(fpath string, conf *Conf) (bool, error) {
-	// rtsp-simple-server.yml is optional
-	// other configuration files are not
-	if fpath == "rtsp-simple-server.yml" {
-		if _, err := os.Stat(fpath); err != nil {
-			return false, nil
+// convertYAMLKeys converts interface{} keys into string keys to avoid JSON errors.
+func convertYAMLKeys(i interface{}) interface{} {
+	switch x := i.(type) {
+	case map[interface{}]interface{}:
+		m2 := map[string]interface{}{}
+		for k, v := range x {
+			m2[k.(string)] = convertYAMLKeys(v)
 		}
+		return m2
+
+	case []interface{}:
+		a2 := make([]interface{}, len(x))
+		for i, v := range x {
+			a2[i] = convertYAMLKeys(v)
+		}
+		return a2
 	}
 
+	return i
+}
+
+// readYAML reads a configuration file into a generic map.
+func readYAML(fpath string) (interface{}, error) {
 	byts, err := ioutil.ReadFile(fpath)
 	if err != nil {
-		return true, err
+		return nil, err
 	}
 
 	if key, ok := os.LookupEnv("RTSP_CONFKEY"); ok {
 		byts, err = decrypt(key, byts)
 		if err != nil {
-			return true, err
+			return nil, err
 		}
 	}
 
-	// load YAML config into a generic map
 	var temp interface{}
 	err = yaml.Unmarshal(byts, &temp)
 	if err != nil {
-		return true, err
+		return nil, err
 	}
 
-	// convert interface{} keys into string keys to avoid JSON errors
-	var convert func(i interface{}) interface{}
-	convert = func(i interface{}) interface{} {
-		switch x := i.(type) {
-		case map[interface{}]interface{}:
-			m2 := map[string]interface{}{}
-			for k, v := range x {
-				m2[k.(string)] = convert(v)
-			}
-			return m2
+	return convertYAMLKeys(temp), nil
+}
 
-		case []interface{}:
-			a2 := make([]interface{}, len(x))
-			for i, v := range x {
-				a2[i] = convert(v)
-			}
-			return a2
-		}
+// checkNonExistentFields checks that a generic map doesn't contain parameters
+// that are not present in the reference struct.
+func checkNonExistentFields(what interface{}, ref interface{}) error {
+	if what == nil {
+		return nil
+	}
 
-		return i
+	ma, ok := what.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("not a map")
 	}
-	temp = convert(temp)
 
-	// check for non-existent parameters
-	var checkNonExistentFields func(what interface{}, ref interface{}) error
-	checkNonExistentFields = func(what interface{}, ref interface{}) error {
-		if what == nil {
+	for k, v := range ma {
+		fi := func() reflect.Type {
+			rr := reflect.TypeOf(ref)
+			for i := 0; i < rr.NumField(); i++ {
+				f := rr.Field(i)
+				if f.Tag.Get("json") == k {
+					return f.Type
+				}
+			}
 			return nil
+		}()
+		if fi == nil {
+			return fmt.Errorf("non-existent parameter: '%s'", k)
 		}
 
-		ma, ok := what.(map[string]interface{})
-		if !ok {
-			return fmt.Errorf("not a map")
-		}
-
-		for k, v := range ma {
-			fi := func() reflect.Type {
-				rr := reflect.TypeOf(ref)
-				for i := 0; i < rr.NumField(); i++ {
-					f := rr.Field(i)
-					if f.Tag.Get("json") == k {
-						return f.Type
-					}
-				}
-				return nil
-			}()
-			if fi == nil {
-				return fmt.Errorf("non-existent parameter: '%s'", k)
+		if fi == reflect.TypeOf(map[string]*PathConf{}) && v != nil {
+			ma2, ok := v.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("parameter %s is not a map", k)
 			}
 
-			if fi == reflect.TypeOf(map[string]*PathConf{}) && v != nil {
-				ma2, ok := v.(map[string]interface{})
-				if !ok {
-					return fmt.Errorf("parameter %s is not a map", k)
-				}
-
-				for k2, v2 := range ma2 {
-					err := checkNonExistentFields(v2, reflect.Zero(fi.Elem().Elem()).Interface())
-					if err != nil {
-						return fmt.Errorf("parameter %s, key %s: %s", k, k2, err)
-					}
+			for k2, v2 := range ma2 {
+				err := checkNonExistentFields(v2, reflect.Zero(fi.Elem().Elem()).Interface())
+				if err != nil {
+					return fmt.Errorf("parameter %s, key %s: %s", k, k2, err)
 				}
 			}
 		}
-		return nil
 	}
+	return nil
+}
+
+func loadFromFile(fpath string, conf *Conf) (bool, error) {
+	// rtsp-simple-server.yml is optional
+	// other configuration files are not
+	if fpath == "rtsp-simple-server.yml" {
+		if _, err := os.Stat(fpath); err != nil {
+			return false, nil
+		}
+	}
+
+	// load YAML config into a generic map
+	temp, err := readYAML(fpath)
+	if err != nil {
+		return true, err
+	}
+
+	// merge included files
+	temp, watchedPaths, err := loadIncludes(filepath.Dir(fpath), temp)
+	if err != nil {
+		return true, err
+	}
+
 	err = checkNonExistentFields(temp, Conf{})
 	if err != nil {
 		return true, err
 	}
 
 	// convert the generic map into JSON
-	byts, err = json.Marshal(temp)
+	byts, err := json.Marshal(temp)
 	if err != nil {
 		return true, err
 	}
@@ -147,57 +169,125 @@ func loadFromFile(fpath string, conf *Conf) (bool, error) {
 		return true, err
 	}
 
+	conf.watchedPaths = watchedPaths
+
 	return true, nil
 }
 
 // Conf is a configuration.
 type Conf struct {
 	// general
-	LogLevel            LogLevel        `json:"logLevel"`
-	LogDestinations     LogDestinations `json:"logDestinations"`
-	LogFile             string          `json:"logFile"`
-	ReadTimeout         StringDuration  `json:"readTimeout"`
-	WriteTimeout        StringDuration  `json:"writeTimeout"`
-	ReadBufferCount     int             `json:"readBufferCount"`
-	API                 bool            `json:"api"`
-	APIAddress          string          `json:"apiAddress"`
-	Metrics             bool            `json:"metrics"`
-	MetricsAddress      string          `json:"metricsAddress"`
-	PPROF               bool            `json:"pprof"`
-	PPROFAddress        string          `json:"pprofAddress"`
-	RunOnConnect        string          `json:"runOnConnect"`
-	RunOnConnectRestart bool            `json:"runOnConnectRestart"`
+	LogLevel                    LogLevel        `json:"logLevel"`
+	LogLevels                   LogLevels       `json:"logLevels"`
+	LogFormat                   LogFormat       `json:"logFormat"`
+	LogDestinations             LogDestinations `json:"logDestinations"`
+	LogFile                     string          `json:"logFile"`
+	LogFileMaxSize              int             `json:"logFileMaxSize"`
+	LogFileMaxAge               StringDuration  `json:"logFileMaxAge"`
+	LogFileMaxBackups           int             `json:"logFileMaxBackups"`
+	LogFileCompress             bool            `json:"logFileCompress"`
+	LogSyslogAddress            string          `json:"logSyslogAddress"`
+	AccessLog                   bool            `json:"accessLog"`
+	AccessLogFormat             AccessLogFormat `json:"accessLogFormat"`
+	AccessLogFile               string          `json:"accessLogFile"`
+	AuditLog                    bool            `json:"auditLog"`
+	AuditLogFile                string          `json:"auditLogFile"`
+	ReadTimeout                 StringDuration  `json:"readTimeout"`
+	WriteTimeout                StringDuration  `json:"writeTimeout"`
+	ReadBufferCount             int             `json:"readBufferCount"`
+	API                         bool            `json:"api"`
+	APIAddress                  string          `json:"apiAddress"`
+	APIDashboard                bool            `json:"apiDashboard"`
+	Metrics                     bool            `json:"metrics"`
+	MetricsAddress              string          `json:"metricsAddress"`
+	StatsD                      bool            `json:"statsd"`
+	StatsDAddress               string          `json:"statsdAddress"`
+	StatsDPrefix                string          `json:"statsdPrefix"`
+	StatsDTags                  StatsDTags      `json:"statsdTags"`
+	StatsDInterval              StringDuration  `json:"statsdInterval"`
+	PPROF                       bool            `json:"pprof"`
+	PPROFAddress                string          `json:"pprofAddress"`
+	DebugImpairment             bool            `json:"debugImpairment"`
+	UnixSocketPermissions       FileMode        `json:"unixSocketPermissions"`
+	RunOnConnect                string          `json:"runOnConnect" redact:"true"`
+	RunOnConnectRestart         bool            `json:"runOnConnectRestart"`
+	HookStdinJSON               bool            `json:"hookStdinJSON"`
+	DrainTimeout                StringDuration  `json:"drainTimeout"`
+	MaxConnections              int             `json:"maxConnections"`
+	MaxSessions                 int             `json:"maxSessions"`
+	ConnectionRate              float64         `json:"connectionRate"`
+	ConnectionBurst             int             `json:"connectionBurst"`
+	EgressAccountingFile        string          `json:"egressAccountingFile"`
+	EgressAccountingPeriod      StringDuration  `json:"egressAccountingPeriod"`
+	ReaderSheddingMemory        int             `json:"readerSheddingMemory"`
+	Registry                    string          `json:"registry" redact:"true"`
+	RegistryInstanceURL         string          `json:"registryInstanceURL" redact:"true"`
+	RegistryTTL                 StringDuration  `json:"registryTTL"`
+	IPv6Disable                 bool            `json:"ipv6Disable"`
+	ListenReusePort             bool            `json:"listenReusePort"`
+	ProxyProtocol               bool            `json:"proxyProtocol"`
+	ProxyProtocolTrustedProxies IPsOrNets       `json:"proxyProtocolTrustedProxies"`
+	GeoIPDatabase               string          `json:"geoIPDatabase"`
+	ReadCountries               Countries       `json:"readCountries"`
+	PublishCountries            Countries       `json:"publishCountries"`
 
 	// RTSP
-	RTSPDisable       bool        `json:"rtspDisable"`
-	Protocols         Protocols   `json:"protocols"`
-	Encryption        Encryption  `json:"encryption"`
-	RTSPAddress       string      `json:"rtspAddress"`
-	RTSPSAddress      string      `json:"rtspsAddress"`
-	RTPAddress        string      `json:"rtpAddress"`
-	RTCPAddress       string      `json:"rtcpAddress"`
-	MulticastIPRange  string      `json:"multicastIPRange"`
-	MulticastRTPPort  int         `json:"multicastRTPPort"`
-	MulticastRTCPPort int         `json:"multicastRTCPPort"`
-	ServerKey         string      `json:"serverKey"`
-	ServerCert        string      `json:"serverCert"`
-	AuthMethods       AuthMethods `json:"authMethods"`
-	ReadBufferSize    int         `json:"readBufferSize"`
+	RTSPDisable        bool               `json:"rtspDisable"`
+	Protocols          Protocols          `json:"protocols"`
+	Encryption         Encryption         `json:"encryption"`
+	RTSPAddress        string             `json:"rtspAddress"`
+	RTSPSAddress       string             `json:"rtspsAddress"`
+	RTPAddress         string             `json:"rtpAddress"`
+	RTCPAddress        string             `json:"rtcpAddress"`
+	MulticastIPRange   string             `json:"multicastIPRange"`
+	MulticastRTPPort   int                `json:"multicastRTPPort"`
+	MulticastRTCPPort  int                `json:"multicastRTCPPort"`
+	ServerKey          string             `json:"serverKey"`
+	ServerCert         string             `json:"serverCert"`
+	ServerCertificates ServerCertificates `json:"serverCertificates"`
+	TLSMinVersion      TLSVersion         `json:"tlsMinVersion"`
+	TLSCipherSuites    TLSCipherSuites    `json:"tlsCipherSuites"`
+	TLSCurves          TLSCurves          `json:"tlsCurves"`
+	AuthMethods        AuthMethods        `json:"authMethods"`
+	ReadBufferSize     int                `json:"readBufferSize"`
+	ACME               bool               `json:"acme"`
+	ACMEDomains        Hostnames          `json:"acmeDomains"`
+	ACMEEmail          string             `json:"acmeEmail"`
+	ACMEDirectory      string             `json:"acmeDirectory"`
+	ACMEHTTPAddress    string             `json:"acmeHTTPAddress"`
+	ACMECacheDir       string             `json:"acmeCacheDir"`
 
 	// RTMP
 	RTMPDisable bool   `json:"rtmpDisable"`
 	RTMPAddress string `json:"rtmpAddress"`
 
 	// HLS
-	HLSDisable         bool           `json:"hlsDisable"`
-	HLSAddress         string         `json:"hlsAddress"`
-	HLSAlwaysRemux     bool           `json:"hlsAlwaysRemux"`
-	HLSSegmentCount    int            `json:"hlsSegmentCount"`
-	HLSSegmentDuration StringDuration `json:"hlsSegmentDuration"`
-	HLSAllowOrigin     string         `json:"hlsAllowOrigin"`
+	HLSDisable               bool           `json:"hlsDisable"`
+	HLSAddress               string         `json:"hlsAddress"`
+	HLSAlwaysRemux           bool           `json:"hlsAlwaysRemux"`
+	HLSAlwaysRemuxCloseAfter StringDuration `json:"hlsAlwaysRemuxCloseAfter"`
+	HLSSegmentCount          int            `json:"hlsSegmentCount"`
+	HLSSegmentDuration       StringDuration `json:"hlsSegmentDuration"`
+	HLSAllowOrigin           string         `json:"hlsAllowOrigin"`
+	HLSEncryption            bool           `json:"hlsEncryption"`
+	HLSEncryptionKeyRotation StringDuration `json:"hlsEncryptionKeyRotation"`
+	HLSDirectory             string         `json:"hlsDirectory"`
+	HLSPushURL               string         `json:"hlsPushURL" redact:"true"`
+
+	// DLNA
+	DLNA             bool   `json:"dlna"`
+	DLNAAddress      string `json:"dlnaAddress"`
+	DLNAFriendlyName string `json:"dlnaFriendlyName"`
 
 	// paths
-	Paths map[string]*PathConf `json:"paths"`
+	PathsDir string               `json:"pathsDir"`
+	Paths    map[string]*PathConf `json:"paths"`
+
+	// tenants
+	Tenants map[string]*TenantConf `json:"tenants"`
+
+	// included files and directories, filled by Load.
+	watchedPaths []string `json:"-"`
 }
 
 // Load loads a Conf.
@@ -214,6 +304,11 @@ func Load(fpath string) (*Conf, bool, error) {
 		return nil, false, err
 	}
 
+	err = conf.loadPathsDir(filepath.Dir(fpath))
+	if err != nil {
+		return nil, false, err
+	}
+
 	err = conf.CheckAndFillMissing()
 	if err != nil {
 		return nil, false, err
@@ -222,12 +317,23 @@ func Load(fpath string) (*Conf, bool, error) {
 	return conf, found, nil
 }
 
+// WatchedPaths returns the files and directories that contain
+// parts of the configuration, besides the main file.
+func (conf *Conf) WatchedPaths() []string {
+	return conf.watchedPaths
+}
+
 // CheckAndFillMissing checks the configuration for errors and fills missing parameters.
 func (conf *Conf) CheckAndFillMissing() error {
 	if conf.LogLevel == 0 {
 		conf.LogLevel = LogLevel(logger.Info)
 	}
 
+	err := conf.LogLevels.Check()
+	if err != nil {
+		return err
+	}
+
 	if len(conf.LogDestinations) == 0 {
 		conf.LogDestinations = LogDestinations{logger.DestinationStdout: {}}
 	}
@@ -236,6 +342,30 @@ func (conf *Conf) CheckAndFillMissing() error {
 		conf.LogFile = "rtsp-simple-server.log"
 	}
 
+	if conf.LogFileMaxSize < 0 {
+		conf.LogFileMaxSize = 0
+	}
+
+	if conf.LogFileMaxBackups < 0 {
+		conf.LogFileMaxBackups = 0
+	}
+
+	if conf.LogSyslogAddress != "" {
+		u, err := url.Parse(conf.LogSyslogAddress)
+		if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Port() == "" {
+			return fmt.Errorf("'%s' is not a valid syslog address; use udp://host:port or tcp://host:port",
+				conf.LogSyslogAddress)
+		}
+	}
+
+	if conf.AccessLogFile == "" {
+		conf.AccessLogFile = "rtsp-simple-server-access.log"
+	}
+
+	if conf.AuditLogFile == "" {
+		conf.AuditLogFile = "rtsp-simple-server-audit.log"
+	}
+
 	if conf.ReadTimeout == 0 {
 		conf.ReadTimeout = 10 * StringDuration(time.Second)
 	}
@@ -256,10 +386,91 @@ func (conf *Conf) CheckAndFillMissing() error {
 		conf.MetricsAddress = "127.0.0.1:9998"
 	}
 
+	if conf.StatsDAddress == "" {
+		conf.StatsDAddress = "127.0.0.1:8125"
+	}
+
+	if conf.StatsDPrefix == "" {
+		conf.StatsDPrefix = "rtsp_simple_server"
+	}
+
+	err = externalcmd.CheckTemplate(conf.RunOnConnect)
+	if err != nil {
+		return fmt.Errorf("invalid 'runOnConnect': %s", err)
+	}
+
+	err = conf.StatsDTags.check()
+	if err != nil {
+		return err
+	}
+
+	if conf.StatsDInterval == 0 {
+		conf.StatsDInterval = 10 * StringDuration(time.Second)
+	}
+
 	if conf.PPROFAddress == "" {
 		conf.PPROFAddress = "127.0.0.1:9999"
 	}
 
+	if conf.UnixSocketPermissions == 0 {
+		conf.UnixSocketPermissions = 0o660
+	}
+
+	if conf.Registry != "" {
+		u, err := url.Parse(conf.Registry)
+		if err != nil || u.Scheme != "redis" || u.Host == "" {
+			return fmt.Errorf("'%s' is not a valid registry address; use redis://host:port", conf.Registry)
+		}
+
+		if conf.RegistryInstanceURL == "" {
+			return fmt.Errorf("'registryInstanceURL' must be filled when 'registry' is used")
+		}
+
+		_, err = base.ParseURL(conf.RegistryInstanceURL)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a valid RTSP URL", conf.RegistryInstanceURL)
+		}
+		conf.RegistryInstanceURL = strings.TrimSuffix(conf.RegistryInstanceURL, "/")
+	}
+
+	if conf.RegistryTTL == 0 {
+		conf.RegistryTTL = 30 * StringDuration(time.Second)
+	}
+	if conf.RegistryTTL < StringDuration(time.Second) {
+		return fmt.Errorf("'registryTTL' must be at least 1s")
+	}
+
+	if conf.MaxConnections < 0 {
+		return fmt.Errorf("'maxConnections' can't be negative")
+	}
+
+	if conf.MaxSessions < 0 {
+		return fmt.Errorf("'maxSessions' can't be negative")
+	}
+
+	if conf.ConnectionRate < 0 {
+		return fmt.Errorf("'connectionRate' can't be negative")
+	}
+
+	if conf.ConnectionBurst < 0 {
+		return fmt.Errorf("'connectionBurst' can't be negative")
+	}
+
+	if conf.ConnectionRate != 0 && conf.ConnectionBurst == 0 {
+		conf.ConnectionBurst = int(math.Max(1, math.Ceil(conf.ConnectionRate)))
+	}
+
+	if conf.EgressAccountingPeriod == 0 {
+		conf.EgressAccountingPeriod = 60 * StringDuration(time.Second)
+	}
+	if conf.EgressAccountingPeriod < StringDuration(time.Second) {
+		return fmt.Errorf("'egressAccountingPeriod' must be at least 1s")
+	}
+
+	if conf.ReaderSheddingMemory < 0 {
+		return fmt.Errorf("'readerSheddingMemory' can't be negative")
+	}
+
 	if len(conf.Protocols) == 0 {
 		conf.Protocols = Protocols{
 			Protocol(gortsplib.TransportUDP):          {},
@@ -278,6 +489,18 @@ func (conf *Conf) CheckAndFillMissing() error {
 		}
 	}
 
+	// UDP sockets can't be shared, since packets would be delivered
+	// to an instance that doesn't know their session.
+	if conf.ListenReusePort {
+		if _, ok := conf.Protocols[Protocol(gortsplib.TransportUDP)]; ok {
+			return fmt.Errorf("'listenReusePort' can't be used with the UDP transport protocol")
+		}
+
+		if _, ok := conf.Protocols[Protocol(gortsplib.TransportUDPMulticast)]; ok {
+			return fmt.Errorf("'listenReusePort' can't be used with the UDP-multicast transport protocol")
+		}
+	}
+
 	if conf.RTSPAddress == "" {
 		conf.RTSPAddress = ":8554"
 	}
@@ -310,10 +533,43 @@ func (conf *Conf) CheckAndFillMissing() error {
 		conf.ServerKey = "server.key"
 	}
 
+	if conf.TLSMinVersion == 0 {
+		conf.TLSMinVersion = TLSVersion(tls.VersionTLS12)
+	}
+
+	if conf.TLSMinVersion == TLSVersion(tls.VersionTLS13) && len(conf.TLSCipherSuites) != 0 {
+		return fmt.Errorf("'tlsCipherSuites' is useless when 'tlsMinVersion' is 1.3, " +
+			"since cipher suites of TLS 1.3 are not configurable")
+	}
+
 	if conf.ServerCert == "" {
 		conf.ServerCert = "server.crt"
 	}
 
+	if conf.ACME {
+		if len(conf.ACMEDomains) == 0 {
+			return fmt.Errorf("'acmeDomains' must be filled when 'acme' is enabled")
+		}
+
+		for _, d := range conf.ACMEDomains {
+			if strings.HasPrefix(d, "*.") {
+				return fmt.Errorf("wildcard domains can't be used with ACME: '%s'", d)
+			}
+		}
+	}
+
+	if conf.ACMEDirectory == "" {
+		conf.ACMEDirectory = "https://acme-v02.api.letsencrypt.org/directory"
+	}
+
+	if conf.ACMEHTTPAddress == "" {
+		conf.ACMEHTTPAddress = ":80"
+	}
+
+	if conf.ACMECacheDir == "" {
+		conf.ACMECacheDir = "acme"
+	}
+
 	if len(conf.AuthMethods) == 0 {
 		conf.AuthMethods = AuthMethods{headers.AuthBasic, headers.AuthDigest}
 	}
@@ -326,6 +582,10 @@ func (conf *Conf) CheckAndFillMissing() error {
 		conf.HLSAddress = ":8888"
 	}
 
+	if conf.HLSAlwaysRemuxCloseAfter < 0 {
+		return fmt.Errorf("'hlsAlwaysRemuxCloseAfter' can't be negative")
+	}
+
 	if conf.HLSSegmentCount == 0 {
 		conf.HLSSegmentCount = 3
 	}
@@ -338,6 +598,33 @@ func (conf *Conf) CheckAndFillMissing() error {
 		conf.HLSAllowOrigin = "*"
 	}
 
+	if conf.HLSEncryptionKeyRotation == 0 {
+		conf.HLSEncryptionKeyRotation = 60 * StringDuration(time.Second)
+	}
+
+	if conf.HLSDirectory != "" && !strings.Contains(conf.HLSDirectory, PathNamePlaceholder) {
+		return fmt.Errorf("'hlsDirectory' must contain %s", PathNamePlaceholder)
+	}
+
+	if conf.HLSPushURL != "" {
+		if !strings.Contains(conf.HLSPushURL, PathNamePlaceholder) {
+			return fmt.Errorf("'hlsPushURL' must contain %s", PathNamePlaceholder)
+		}
+
+		u, err := url.Parse(conf.HLSPushURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("'%s' is not a valid HTTP URL", conf.HLSPushURL)
+		}
+	}
+
+	if conf.DLNAAddress == "" {
+		conf.DLNAAddress = ":8890"
+	}
+
+	if conf.DLNAFriendlyName == "" {
+		conf.DLNAFriendlyName = "rtsp-simple-server"
+	}
+
 	// do not add automatically "all", since user may want to
 	// initialize all paths through API or hot reloading.
 	if conf.Paths == nil {
@@ -358,7 +645,104 @@ func (conf *Conf) CheckAndFillMissing() error {
 
 		err := pconf.checkAndFillMissing(name)
 		if err != nil {
-			return err
+			return fmt.Errorf("path '%s': %s", name, err)
+		}
+	}
+
+	hosts := make(map[string]string)
+	for name, tconf := range conf.Tenants {
+		if tconf == nil {
+			conf.Tenants[name] = &TenantConf{}
+			tconf = conf.Tenants[name]
+		}
+
+		err := tconf.checkAndFillMissing(name)
+		if err != nil {
+			return fmt.Errorf("tenant '%s': %s", name, err)
+		}
+
+		for _, host := range tconf.Hosts {
+			if other, ok := hosts[host]; ok {
+				return fmt.Errorf("tenants '%s' and '%s' have the same host '%s'", other, name, host)
+			}
+			hosts[host] = name
+		}
+	}
+
+	// country restrictions require a GeoIP database
+	if conf.GeoIPDatabase == "" {
+		if len(conf.ReadCountries) != 0 || len(conf.PublishCountries) != 0 {
+			return fmt.Errorf("'readCountries' and 'publishCountries' require 'geoIPDatabase'")
+		}
+
+		for name, pconf := range conf.AllPaths() {
+			if len(pconf.ReadCountries) != 0 || len(pconf.PublishCountries) != 0 {
+				return fmt.Errorf("path '%s': 'readCountries' and 'publishCountries' require 'geoIPDatabase'", name)
+			}
+		}
+	}
+
+	// the namespace of a tenant can be configured only by the tenant itself
+	for name, pconf := range conf.Paths {
+		if pconf.Regexp == nil {
+			if tenant := TenantOfPath(conf.Tenants, name); tenant != "" {
+				return fmt.Errorf("path '%s' belongs to tenant '%s' and must be configured inside it", name, tenant)
+			}
+		}
+	}
+
+	// stream keys are used to find paths, therefore they must be unique
+	streamKeys := make(map[Credential]string)
+	for name, pconf := range conf.AllPaths() {
+		key := pconf.Resolved().PublishStreamKey
+		if key == "" {
+			continue
+		}
+
+		if other, ok := streamKeys[key]; ok {
+			return fmt.Errorf("paths '%s' and '%s' have the same 'publishStreamKey'", other, name)
+		}
+		streamKeys[key] = name
+	}
+
+	if _, ok := conf.Protocols[Protocol(gortsplib.TransportUDPMulticast)]; !ok {
+		for name, pconf := range conf.AllPaths() {
+			if pconf.SAPAnnounce {
+				return fmt.Errorf("path '%s': 'sapAnnounce' requires the UDP-multicast transport protocol", name)
+			}
+			if pconf.MulticastEncryption {
+				return fmt.Errorf("path '%s': 'multicastEncryption' requires the UDP-multicast transport protocol", name)
+			}
+		}
+	}
+
+	// network impairment is a testing tool and must not be enabled by mistake
+	if !conf.DebugImpairment {
+		for name, pconf := range conf.AllPaths() {
+			if pconf.HasImpairment() {
+				return fmt.Errorf("path '%s': network impairment requires 'debugImpairment'", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// CheckFiles checks that the files required by the configuration exist and are valid.
+// CheckAndFillMissing must be called before.
+func (conf *Conf) CheckFiles() error {
+	// certificates are obtained at runtime when ACME is enabled
+	if !conf.RTSPDisable && !conf.ACME &&
+		(conf.Encryption == EncryptionStrict || conf.Encryption == EncryptionOptional) {
+		pairs := append(ServerCertificates{{Cert: conf.ServerCert, Key: conf.ServerKey}},
+			conf.ServerCertificates...)
+
+		for _, pair := range pairs {
+			_, err := tls.LoadX509KeyPair(pair.Cert, pair.Key)
+			if err != nil {
+				return fmt.Errorf("unable to load the server certificate (%s) and key (%s): %s",
+					pair.Cert, pair.Key, err)
+			}
 		}
 	}
 
@@ -0,0 +1,66 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CountryUnknown is the country of IPs that are not in the GeoIP database,
+// like the ones of private networks.
+const CountryUnknown = "unknown"
+
+var reCountry = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// Countries is a parameter that accepts a list of ISO 3166-1 country codes.
+type Countries []string
+
+// MarshalJSON marshals a Countries into JSON.
+func (d Countries) MarshalJSON() ([]byte, error) {
+	out := d
+	if out == nil {
+		out = Countries{}
+	}
+	return json.Marshal([]string(out))
+}
+
+// UnmarshalJSON unmarshals a Countries from JSON.
+func (d *Countries) UnmarshalJSON(b []byte) error {
+	var in []string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	*d = nil
+
+	for _, v := range in {
+		if strings.ToLower(v) == CountryUnknown {
+			*d = append(*d, CountryUnknown)
+			continue
+		}
+
+		v = strings.ToUpper(v)
+		if !reCountry.MatchString(v) {
+			return fmt.Errorf("invalid country code: '%s'", v)
+		}
+		*d = append(*d, v)
+	}
+
+	return nil
+}
+
+func (d *Countries) unmarshalEnv(s string) error {
+	byts, _ := json.Marshal(strings.Split(s, ","))
+	return d.UnmarshalJSON(byts)
+}
+
+// Contains checks whether a country is in the list.
+func (d Countries) Contains(country string) bool {
+	for _, c := range d {
+		if c == country {
+			return true
+		}
+	}
+	return false
+}
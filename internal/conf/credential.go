@@ -12,6 +12,7 @@ var reCredential = regexp.MustCompile(`^[a-zA-Z0-9!\$\(\)\*\+\.;<=>\[\]\^_\-\{\}
 const credentialSupportedChars = "A-Z,0-9,!,$,(,),*,+,.,;,<,=,>,[,],^,_,-,{,}"
 
 // Credential is a parameter that is used as username or password.
+// It can contain a reference to a secret, in the format file:///path or env:NAME.
 type Credential string
 
 // MarshalJSON marshals a Credential into JSON.
@@ -26,16 +27,43 @@ func (d *Credential) UnmarshalJSON(b []byte) error {
 		return err
 	}
 
-	if in != "" &&
-		!strings.HasPrefix(in, "sha256:") &&
-		!reCredential.MatchString(in) {
-		return fmt.Errorf("contains unsupported characters (supported are %s)", credentialSupportedChars)
+	// references to secrets are checked after being resolved
+	if !isSecretRef(in) {
+		err := Credential(in).check()
+		if err != nil {
+			return err
+		}
 	}
 
 	*d = Credential(in)
 	return nil
 }
 
+func (d Credential) check() error {
+	if d != "" &&
+		!strings.HasPrefix(string(d), "sha256:") &&
+		!reCredential.MatchString(string(d)) {
+		return fmt.Errorf("contains unsupported characters (supported are %s)", credentialSupportedChars)
+	}
+	return nil
+}
+
+// resolve returns the value of a Credential that contains a reference to a secret.
+func (d Credential) resolve() (Credential, error) {
+	v, err := resolveSecret(string(d))
+	if err != nil {
+		return "", err
+	}
+
+	ret := Credential(v)
+	err = ret.check()
+	if err != nil {
+		return "", err
+	}
+
+	return ret, nil
+}
+
 func (d *Credential) unmarshalEnv(s string) error {
 	return d.UnmarshalJSON([]byte(`"` + s + `"`))
 }
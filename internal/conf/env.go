@@ -52,6 +52,16 @@ func loadEnvInternal(env map[string]string, prefix string, rv reflect.Value) err
 		}
 		return nil
 
+	case reflect.TypeOf(float64(0)):
+		if ev, ok := env[prefix]; ok {
+			fv, err := strconv.ParseFloat(ev, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %s", prefix, err)
+			}
+			rv.SetFloat(fv)
+		}
+		return nil
+
 	case reflect.TypeOf(bool(false)):
 		if ev, ok := env[prefix]; ok {
 			switch strings.ToLower(ev) {
@@ -90,12 +100,12 @@ func loadEnvInternal(env map[string]string, prefix string, rv reflect.Value) err
 				rv.Set(reflect.MakeMap(rt))
 			}
 
-			mapKeyLower := strings.ToLower(mapKey)
-			nv := rv.MapIndex(reflect.ValueOf(mapKeyLower))
+			name := envMapKeyName(env, prefix+"_"+mapKey, rv)
+			nv := rv.MapIndex(reflect.ValueOf(name))
 			zero := reflect.Value{}
 			if nv == zero {
 				nv = reflect.New(rt.Elem().Elem())
-				rv.SetMapIndex(reflect.ValueOf(mapKeyLower), nv)
+				rv.SetMapIndex(reflect.ValueOf(name), nv)
 			}
 
 			err := loadEnvInternal(env, prefix+"_"+mapKey, nv.Elem())
@@ -126,6 +136,27 @@ func loadEnvInternal(env map[string]string, prefix string, rv reflect.Value) err
 	return fmt.Errorf("unsupported type: %v", rt)
 }
 
+// envMapKeyName returns the name of the map entry that is edited by the variables
+// that start with prefix.
+// The name can be set explicitly with the prefix_NAME variable, in order to use
+// characters that are not allowed in variable names (like dashes, slashes or uppercase letters);
+// otherwise it is the lowercase key, or an existing key that differs only by case.
+func envMapKeyName(env map[string]string, prefix string, rv reflect.Value) string {
+	if ev, ok := env[prefix+"_NAME"]; ok && ev != "" {
+		return ev
+	}
+
+	mapKey := prefix[strings.LastIndex(prefix, "_")+1:]
+
+	for _, k := range rv.MapKeys() {
+		if strings.EqualFold(k.String(), mapKey) {
+			return k.String()
+		}
+	}
+
+	return strings.ToLower(mapKey)
+}
+
 func loadFromEnvironment(prefix string, v interface{}) error {
 	env := make(map[string]string)
 	for _, kv := range os.Environ() {
@@ -0,0 +1,56 @@
+package conf
+
+import (
+	"encoding/json"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Export returns a copy of the configuration that can be stored and loaded
+// again with Import or used as configuration file.
+// Secrets are redacted, while references to secrets are left unchanged.
+func (conf *Conf) Export() *Conf {
+	ret := conf.Redacted()
+
+	// paths of pathsDir are already part of the configuration
+	ret.PathsDir = ""
+
+	return ret
+}
+
+// Import loads a configuration in JSON or YAML format, like the ones
+// produced by Export. Secrets that were redacted are taken from the
+// current configuration, by matching paths by name.
+func Import(byts []byte, current *Conf) (*Conf, error) {
+	var temp interface{}
+	err := yaml.Unmarshal(byts, &temp)
+	if err != nil {
+		return nil, err
+	}
+	temp = convertYAMLKeys(temp)
+
+	err = checkNonExistentFields(temp, Conf{})
+	if err != nil {
+		return nil, err
+	}
+
+	byts, err = json.Marshal(temp)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := &Conf{}
+	err = json.Unmarshal(byts, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	conf.unredact(current)
+
+	err = conf.CheckAndFillMissing()
+	if err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
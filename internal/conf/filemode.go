@@ -0,0 +1,54 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// FileMode is a parameter that contains file permissions.
+// It is unmarshaled from an octal string (like "0660") or from a number;
+// YAML parses unquoted numbers that start with 0 as octal.
+type FileMode os.FileMode
+
+// MarshalJSON marshals a FileMode into JSON.
+func (d FileMode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("%04o", uint32(d)))
+}
+
+// UnmarshalJSON unmarshals a FileMode from JSON.
+func (d *FileMode) UnmarshalJSON(b []byte) error {
+	var in interface{}
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	var v uint64
+
+	switch tin := in.(type) {
+	case string:
+		var err error
+		v, err = strconv.ParseUint(tin, 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid file mode: '%s'", tin)
+		}
+
+	case float64:
+		v = uint64(tin)
+
+	default:
+		return fmt.Errorf("invalid file mode: %s", string(b))
+	}
+
+	if v > 0o777 {
+		return fmt.Errorf("invalid file mode: %04o", v)
+	}
+
+	*d = FileMode(v)
+	return nil
+}
+
+func (d *FileMode) unmarshalEnv(s string) error {
+	return d.UnmarshalJSON([]byte(`"` + s + `"`))
+}
@@ -0,0 +1,46 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var reHostname = regexp.MustCompile(`^(\*\.)?([a-zA-Z0-9]([a-zA-Z0-9\-]*[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9\-]*[a-zA-Z0-9])?$`)
+
+// Hostnames is a parameter that accepts a list of hostnames.
+type Hostnames []string
+
+// MarshalJSON marshals a Hostnames into JSON.
+func (d Hostnames) MarshalJSON() ([]byte, error) {
+	out := d
+	if out == nil {
+		out = Hostnames{}
+	}
+	return json.Marshal([]string(out))
+}
+
+// UnmarshalJSON unmarshals a Hostnames from JSON.
+func (d *Hostnames) UnmarshalJSON(b []byte) error {
+	var in []string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	*d = nil
+
+	for _, v := range in {
+		if !reHostname.MatchString(v) {
+			return fmt.Errorf("invalid hostname: '%s'", v)
+		}
+		*d = append(*d, strings.ToLower(v))
+	}
+
+	return nil
+}
+
+func (d *Hostnames) unmarshalEnv(s string) error {
+	byts, _ := json.Marshal(strings.Split(s, ","))
+	return d.UnmarshalJSON(byts)
+}
@@ -0,0 +1,38 @@
+package conf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// HTTPHeaders is a set of HTTP headers that are added to responses.
+type HTTPHeaders map[string]string
+
+func (d HTTPHeaders) check() error {
+	for k, v := range d {
+		if k == "" || strings.ContainsAny(k, " \t\r\n:") {
+			return fmt.Errorf("invalid header name: '%s'", k)
+		}
+
+		// prevent header injection
+		if strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("invalid value of header '%s'", k)
+		}
+	}
+	return nil
+}
+
+func (d *HTTPHeaders) unmarshalEnv(s string) error {
+	*d = make(HTTPHeaders)
+
+	for _, kv := range strings.Split(s, ",") {
+		tmp := strings.SplitN(kv, ":", 2)
+		if len(tmp) != 2 {
+			return fmt.Errorf("invalid value '%s', use name:value", kv)
+		}
+
+		(*d)[strings.TrimSpace(tmp[0])] = strings.TrimSpace(tmp[1])
+	}
+
+	return nil
+}
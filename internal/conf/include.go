@@ -0,0 +1,212 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func includePatterns(v interface{}) ([]string, error) {
+	switch x := v.(type) {
+	case nil:
+		return nil, nil
+
+	case string:
+		return []string{x}, nil
+
+	case []interface{}:
+		ret := make([]string, len(x))
+		for i, e := range x {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("parameter include must be a list of files")
+			}
+			ret[i] = s
+		}
+		return ret, nil
+	}
+
+	return nil, fmt.Errorf("parameter include must be a list of files")
+}
+
+// mergeYAML merges an included file into the main configuration.
+// Parameters and paths can't be defined twice.
+func mergeYAML(dest map[string]interface{}, src map[string]interface{}) error {
+	for k, v := range src {
+		if k != "paths" {
+			if _, ok := dest[k]; ok {
+				return fmt.Errorf("parameter '%s' is already defined", k)
+			}
+			dest[k] = v
+			continue
+		}
+
+		if v == nil {
+			continue
+		}
+
+		srcPaths, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("parameter paths is not a map")
+		}
+
+		destPaths, _ := dest["paths"].(map[string]interface{})
+		if destPaths == nil {
+			destPaths = make(map[string]interface{})
+			dest["paths"] = destPaths
+		}
+
+		for name, pconf := range srcPaths {
+			if _, ok := destPaths[name]; ok {
+				return fmt.Errorf("path '%s' is already defined", name)
+			}
+			destPaths[name] = pconf
+		}
+	}
+
+	return nil
+}
+
+// loadIncludes merges the files listed in the include parameter into the main configuration.
+// It returns the files and directories that have to be watched in order to detect changes.
+func loadIncludes(dir string, temp interface{}) (interface{}, []string, error) {
+	ma, ok := temp.(map[string]interface{})
+	if !ok {
+		return temp, nil, nil
+	}
+
+	v, ok := ma["include"]
+	if !ok {
+		return temp, nil, nil
+	}
+	delete(ma, "include")
+
+	patterns, err := includePatterns(v)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var watchedPaths []string
+
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid include '%s': %s", pattern, err)
+		}
+
+		if strings.ContainsAny(pattern, "*?[") {
+			// watch the directory in order to detect new files
+			abs, _ := filepath.Abs(filepath.Dir(pattern))
+			watchedPaths = append(watchedPaths, abs)
+		} else if len(files) == 0 {
+			_, err := os.Stat(pattern)
+			return nil, nil, err
+		}
+
+		for _, fpath := range files {
+			inc, err := readYAML(fpath)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %s", fpath, err)
+			}
+
+			if inc == nil {
+				continue
+			}
+
+			incMap, ok := inc.(map[string]interface{})
+			if !ok {
+				return nil, nil, fmt.Errorf("%s: not a map", fpath)
+			}
+
+			if _, ok := incMap["include"]; ok {
+				return nil, nil, fmt.Errorf("%s: nested includes are not supported", fpath)
+			}
+
+			err = mergeYAML(ma, incMap)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %s", fpath, err)
+			}
+
+			abs, _ := filepath.Abs(fpath)
+			watchedPaths = append(watchedPaths, abs)
+		}
+	}
+
+	return ma, watchedPaths, nil
+}
+
+// loadPathsDir loads the paths defined in the files inside pathsDir.
+// Each file contains one or more paths, in the same format of the paths parameter.
+func (conf *Conf) loadPathsDir(confDir string) error {
+	if conf.PathsDir == "" {
+		return nil
+	}
+
+	dir := conf.PathsDir
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(confDir, dir)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if !e.IsDir() && (ext == ".yml" || ext == ".yaml") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fpath := filepath.Join(dir, name)
+
+		temp, err := readYAML(fpath)
+		if err != nil {
+			return fmt.Errorf("%s: %s", fpath, err)
+		}
+
+		err = checkNonExistentFields(map[string]interface{}{"paths": temp}, Conf{})
+		if err != nil {
+			return fmt.Errorf("%s: %s", fpath, err)
+		}
+
+		byts, err := json.Marshal(temp)
+		if err != nil {
+			return err
+		}
+
+		var paths map[string]*PathConf
+		err = json.Unmarshal(byts, &paths)
+		if err != nil {
+			return fmt.Errorf("%s: %s", fpath, err)
+		}
+
+		for pathName, pconf := range paths {
+			if _, ok := conf.Paths[pathName]; ok {
+				return fmt.Errorf("%s: path '%s' is already defined", fpath, pathName)
+			}
+
+			if conf.Paths == nil {
+				conf.Paths = make(map[string]*PathConf)
+			}
+			conf.Paths[pathName] = pconf
+		}
+	}
+
+	abs, _ := filepath.Abs(dir)
+	conf.watchedPaths = append(conf.watchedPaths, abs)
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+// LogFormat is the logFormat parameter.
+type LogFormat logger.Format
+
+// MarshalJSON marshals a LogFormat into JSON.
+func (d LogFormat) MarshalJSON() ([]byte, error) {
+	var out string
+
+	switch d {
+	case LogFormat(logger.FormatJSON):
+		out = "json"
+
+	default:
+		out = "plain"
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON unmarshals a LogFormat from JSON.
+func (d *LogFormat) UnmarshalJSON(b []byte) error {
+	var in string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	switch in {
+	case "plain":
+		*d = LogFormat(logger.FormatPlain)
+
+	case "json":
+		*d = LogFormat(logger.FormatJSON)
+
+	default:
+		return fmt.Errorf("invalid log format: %s", in)
+	}
+
+	return nil
+}
+
+func (d *LogFormat) unmarshalEnv(s string) error {
+	return d.UnmarshalJSON([]byte(`"` + s + `"`))
+}
@@ -0,0 +1,57 @@
+package conf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// components whose log level can be overridden.
+var logLevelComponents = map[string]struct{}{
+	"rtsp":    {},
+	"rtsps":   {},
+	"rtmp":    {},
+	"hls":     {},
+	"api":     {},
+	"metrics": {},
+	"pprof":   {},
+	"hikka":   {},
+	"dlna":    {},
+}
+
+// LogLevels is the logLevels parameter.
+type LogLevels map[string]LogLevel
+
+// Check checks that components exist and that their levels are not empty.
+func (d LogLevels) Check() error {
+	for k, v := range d {
+		if _, ok := logLevelComponents[k]; !ok {
+			return fmt.Errorf("invalid component in logLevels: %s", k)
+		}
+
+		if v == 0 {
+			return fmt.Errorf("log level of component '%s' can not be empty", k)
+		}
+	}
+	return nil
+}
+
+func (d *LogLevels) unmarshalEnv(s string) error {
+	*d = make(LogLevels)
+
+	for _, kv := range strings.Split(s, ",") {
+		tmp := strings.SplitN(kv, ":", 2)
+		if len(tmp) != 2 {
+			return fmt.Errorf("invalid value '%s', use component:level", kv)
+		}
+
+		var l LogLevel
+		err := l.unmarshalEnv(tmp[1])
+		if err != nil {
+			return err
+		}
+
+		(*d)[tmp[0]] = l
+	}
+
+	return nil
+}
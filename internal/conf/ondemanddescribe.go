@@ -0,0 +1,68 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// OnDemandDescribe is the behavior of DESCRIBE requests
+// received when the source of an on-demand path is not ready yet.
+type OnDemandDescribe int
+
+// behaviors.
+const (
+	// requests are blocked until the source is ready.
+	OnDemandDescribeWait OnDemandDescribe = iota
+
+	// requests are rejected with 503 Service Unavailable and a Retry-After header.
+	OnDemandDescribeUnavailable
+
+	// requests are redirected to the fallback path.
+	OnDemandDescribeFallback
+)
+
+// String implements fmt.Stringer.
+func (d OnDemandDescribe) String() string {
+	switch d {
+	case OnDemandDescribeUnavailable:
+		return "unavailable"
+
+	case OnDemandDescribeFallback:
+		return "fallback"
+	}
+
+	return "wait"
+}
+
+// MarshalJSON marshals an OnDemandDescribe into JSON.
+func (d OnDemandDescribe) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON unmarshals an OnDemandDescribe from JSON.
+func (d *OnDemandDescribe) UnmarshalJSON(b []byte) error {
+	var in string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	switch in {
+	case "wait", "":
+		*d = OnDemandDescribeWait
+
+	case "unavailable":
+		*d = OnDemandDescribeUnavailable
+
+	case "fallback":
+		*d = OnDemandDescribeFallback
+
+	default:
+		return fmt.Errorf("invalid on-demand describe behavior: '%s' (supported values are wait, unavailable, fallback)", in)
+	}
+
+	return nil
+}
+
+func (d *OnDemandDescribe) unmarshalEnv(s string) error {
+	return d.UnmarshalJSON([]byte(`"` + s + `"`))
+}
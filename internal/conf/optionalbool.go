@@ -0,0 +1,83 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// OptionalBool is a boolean parameter that can be left empty,
+// in order to use the value of a global parameter.
+type OptionalBool int
+
+// values.
+const (
+	OptionalBoolUnset OptionalBool = iota
+	OptionalBoolFalse
+	OptionalBoolTrue
+)
+
+// MarshalJSON marshals an OptionalBool into JSON.
+func (d OptionalBool) MarshalJSON() ([]byte, error) {
+	switch d {
+	case OptionalBoolFalse:
+		return json.Marshal(false)
+
+	case OptionalBoolTrue:
+		return json.Marshal(true)
+	}
+
+	return []byte("null"), nil
+}
+
+// UnmarshalJSON unmarshals an OptionalBool from JSON.
+func (d *OptionalBool) UnmarshalJSON(b []byte) error {
+	var in *bool
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	switch {
+	case in == nil:
+		*d = OptionalBoolUnset
+
+	case *in:
+		*d = OptionalBoolTrue
+
+	default:
+		*d = OptionalBoolFalse
+	}
+
+	return nil
+}
+
+func (d *OptionalBool) unmarshalEnv(s string) error {
+	switch strings.ToLower(s) {
+	case "":
+		*d = OptionalBoolUnset
+
+	case "yes", "true":
+		*d = OptionalBoolTrue
+
+	case "no", "false":
+		*d = OptionalBoolFalse
+
+	default:
+		return fmt.Errorf("invalid value '%s'", s)
+	}
+
+	return nil
+}
+
+// Resolve returns the value of the parameter, or def if the parameter is empty.
+func (d OptionalBool) Resolve(def bool) bool {
+	switch d {
+	case OptionalBoolFalse:
+		return false
+
+	case OptionalBoolTrue:
+		return true
+	}
+
+	return def
+}
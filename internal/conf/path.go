@@ -4,11 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
 
 	"github.com/aler9/gortsplib/pkg/base"
+
+	"github.com/aler9/rtsp-simple-server/internal/cron"
+	"github.com/aler9/rtsp-simple-server/internal/externalcmd"
+	"github.com/aler9/rtsp-simple-server/internal/srt"
 )
 
 var rePathName = regexp.MustCompile(`^[0-9a-zA-Z_\-/\.~]+$`)
@@ -34,41 +39,204 @@ func IsValidPathName(name string) error {
 	return nil
 }
 
+// PathNamePlaceholder is replaced with the name of the path inside the source URL.
+const PathNamePlaceholder = "$RTSP_PATH"
+
+// QueryParamPlaceholderPrefix, followed by the name of a query parameter, is replaced
+// with the value of the parameter provided by the reader inside the source URL.
+const QueryParamPlaceholderPrefix = "$RTSP_QUERY_"
+
+// PathResolved contains the parameters of a path that can contain
+// references to secrets, with references replaced by their values.
+type PathResolved struct {
+	Source           string
+	PublishUser      Credential
+	PublishPass      Credential
+	PublishStreamKey Credential
+	ReadUser         Credential
+	ReadPass         Credential
+	PushStreamKey    Credential
+
+	// URL where the stream is pushed to, with the stream key of the preset.
+	Push string
+
+	// preset used by the push, if any.
+	PushPreset *PushPreset
+
+	// URL of the SRT output.
+	SRTOutput string
+}
+
 // PathConf is a path configuration.
 type PathConf struct {
 	Regexp *regexp.Regexp `json:"-"`
+	Tenant string         `json:"-"`
 
 	// source
-	Source                     string         `json:"source"`
-	SourceProtocol             SourceProtocol `json:"sourceProtocol"`
-	SourceAnyPortEnable        bool           `json:"sourceAnyPortEnable"`
-	SourceFingerprint          string         `json:"sourceFingerprint"`
-	SourceOnDemand             bool           `json:"sourceOnDemand"`
-	SourceOnDemandStartTimeout StringDuration `json:"sourceOnDemandStartTimeout"`
-	SourceOnDemandCloseAfter   StringDuration `json:"sourceOnDemandCloseAfter"`
-	SourceRedirect             string         `json:"sourceRedirect"`
-	DisablePublisherOverride   bool           `json:"disablePublisherOverride"`
-	Fallback                   string         `json:"fallback"`
+	Source                     string           `json:"source" redact:"true"`
+	SourceProtocol             SourceProtocol   `json:"sourceProtocol"`
+	SourceAnyPortEnable        bool             `json:"sourceAnyPortEnable"`
+	SourceFingerprint          string           `json:"sourceFingerprint"`
+	SourceParameterPassthrough bool             `json:"sourceParameterPassthrough"`
+	SourceBackchannel          bool             `json:"sourceBackchannel"`
+	SourceQueryParams          QueryParamNames  `json:"sourceQueryParams"`
+	SourceQuirks               Quirks           `json:"sourceQuirks"`
+	SourceOnDemand             bool             `json:"sourceOnDemand"`
+	SourceOnDemandStartTimeout StringDuration   `json:"sourceOnDemandStartTimeout"`
+	SourceOnDemandCloseAfter   StringDuration   `json:"sourceOnDemandCloseAfter"`
+	SourceRetryPause           StringDuration   `json:"sourceRetryPause"`
+	SourceRetryMaxPause        StringDuration   `json:"sourceRetryMaxPause"`
+	SourceRetryJitter          int              `json:"sourceRetryJitter"`
+	SourceRetryMaxCount        int              `json:"sourceRetryMaxCount"`
+	SourceInactivityTimeout    StringDuration   `json:"sourceInactivityTimeout"`
+	SourceOutageHold           StringDuration   `json:"sourceOutageHold"`
+	SourceRedirect             string           `json:"sourceRedirect" redact:"true"`
+	DisablePublisherOverride   bool             `json:"disablePublisherOverride"`
+	Fallback                   string           `json:"fallback" redact:"true"`
+	OnDemandDescribe           OnDemandDescribe `json:"onDemandDescribe"`
+	OnDemandDescribeTimeout    StringDuration   `json:"onDemandDescribeTimeout"`
+	InjectSilentAudio          bool             `json:"injectSilentAudio"`
+	InsertTimecodeSEI          bool             `json:"insertTimecodeSEI"`
+	ClockDriftCompensation     bool             `json:"clockDriftCompensation"`
+	FlexFEC                    bool             `json:"flexFEC"`
+	FlexFECGroupSize           int              `json:"flexFECGroupSize"`
+	StripRTPHeaderExtensions   bool             `json:"stripRTPHeaderExtensions"`
+	StripRTPPadding            bool             `json:"stripRTPPadding"`
+	SanitizeReaderSDP          bool             `json:"sanitizeReaderSDP"`
+	SAPAnnounce                bool             `json:"sapAnnounce"`
+	MulticastEncryption        bool             `json:"multicastEncryption"`
+	MulticastKeyRotation       StringDuration   `json:"multicastKeyRotation"`
+	MotionDetection            bool             `json:"motionDetection"`
+	MotionDetectionThreshold   int              `json:"motionDetectionThreshold"`
+	InferenceURL               string           `json:"inferenceURL" redact:"true"`
+	InferenceInterval          StringDuration   `json:"inferenceInterval"`
+	ImpairmentLoss             int              `json:"impairmentLoss"`
+	ImpairmentReorder          int              `json:"impairmentReorder"`
+	ImpairmentLatency          StringDuration   `json:"impairmentLatency"`
+	V4L2Width                  int              `json:"v4l2Width"`
+	V4L2Height                 int              `json:"v4l2Height"`
+	V4L2FPS                    int              `json:"v4l2FPS"`
+	RPICameraWidth             int              `json:"rpiCameraWidth"`
+	RPICameraHeight            int              `json:"rpiCameraHeight"`
+	RPICameraFPS               int              `json:"rpiCameraFPS"`
+	RPICameraBitrate           int              `json:"rpiCameraBitrate"`
+	RPICameraRotation          int              `json:"rpiCameraRotation"`
+	TestsrcWidth               int              `json:"testsrcWidth"`
+	TestsrcHeight              int              `json:"testsrcHeight"`
+	TestsrcFPS                 int              `json:"testsrcFPS"`
 
 	// authentication
-	PublishUser Credential `json:"publishUser"`
-	PublishPass Credential `json:"publishPass"`
-	PublishIPs  IPsOrNets  `json:"publishIPs"`
-	ReadUser    Credential `json:"readUser"`
-	ReadPass    Credential `json:"readPass"`
-	ReadIPs     IPsOrNets  `json:"readIPs"`
+	PublishUser      Credential `json:"publishUser"`
+	PublishPass      Credential `json:"publishPass" redact:"true"`
+	PublishStreamKey Credential `json:"publishStreamKey" redact:"true"`
+	PublishIPs       IPsOrNets  `json:"publishIPs"`
+	PublishCountries Countries  `json:"publishCountries"`
+	ReadUser         Credential `json:"readUser"`
+	ReadPass         Credential `json:"readPass" redact:"true"`
+	ReadIPs          IPsOrNets  `json:"readIPs"`
+	ReadCountries    Countries  `json:"readCountries"`
 
 	// custom commands
-	RunOnInit               string         `json:"runOnInit"`
+	RunOnInit               string         `json:"runOnInit" redact:"true"`
 	RunOnInitRestart        bool           `json:"runOnInitRestart"`
-	RunOnDemand             string         `json:"runOnDemand"`
+	RunOnDemand             string         `json:"runOnDemand" redact:"true"`
 	RunOnDemandRestart      bool           `json:"runOnDemandRestart"`
 	RunOnDemandStartTimeout StringDuration `json:"runOnDemandStartTimeout"`
 	RunOnDemandCloseAfter   StringDuration `json:"runOnDemandCloseAfter"`
-	RunOnPublish            string         `json:"runOnPublish"`
+	RunOnPublish            string         `json:"runOnPublish" redact:"true"`
 	RunOnPublishRestart     bool           `json:"runOnPublishRestart"`
-	RunOnRead               string         `json:"runOnRead"`
+	RunOnRead               string         `json:"runOnRead" redact:"true"`
 	RunOnReadRestart        bool           `json:"runOnReadRestart"`
+	RunOnSourceInactive     string         `json:"runOnSourceInactive" redact:"true"`
+	RunOnMotion             string         `json:"runOnMotion" redact:"true"`
+	RunOnRecord             string         `json:"runOnRecord" redact:"true"`
+	RunOnRecordRestart      bool           `json:"runOnRecordRestart"`
+	RecordSchedule          string         `json:"recordSchedule"`
+
+	// timeouts and buffers
+	ReadTimeout     StringDuration `json:"readTimeout"`
+	WriteTimeout    StringDuration `json:"writeTimeout"`
+	ReadBufferCount int            `json:"readBufferCount"`
+
+	// congestion
+	ReaderPriorities ReaderPriorityRules `json:"readerPriorities"`
+	MaxReaders       int                 `json:"maxReaders"`
+	MaxEgressBitrate int                 `json:"maxEgressBitrate"`
+
+	// HLS
+	HLSDisable            bool         `json:"hlsDisable"`
+	HLSAlwaysRemux        OptionalBool `json:"hlsAlwaysRemux"`
+	HLSAllowOrigin        string       `json:"hlsAllowOrigin"`
+	HLSHeaders            HTTPHeaders  `json:"hlsHeaders"`
+	HLSAudioOnlyRendition bool         `json:"hlsAudioOnlyRendition"`
+
+	// push
+	Push          string     `json:"push" redact:"true"`
+	PushStreamKey Credential `json:"pushStreamKey" redact:"true"`
+	SRTOutput     string     `json:"srtOutput" redact:"true"`
+
+	// log
+	LogLevel LogLevel `json:"logLevel"`
+
+	// filled by checkAndFillMissing.
+	resolved PathResolved `json:"-"`
+}
+
+// Resolved returns the parameters that can contain references to secrets,
+// with references replaced by their values.
+// Values are not exposed in JSON, in order to keep them out of the API.
+func (pconf *PathConf) Resolved() PathResolved {
+	return pconf.resolved
+}
+
+func (pconf *PathConf) resolveSecrets() error {
+	var err error
+
+	pconf.resolved.Source, err = resolveSecretsInURL(pconf.Source)
+	if err != nil {
+		return fmt.Errorf("source: %s", err)
+	}
+
+	for _, e := range []struct {
+		name string
+		in   Credential
+		out  *Credential
+	}{
+		{"publishUser", pconf.PublishUser, &pconf.resolved.PublishUser},
+		{"publishPass", pconf.PublishPass, &pconf.resolved.PublishPass},
+		{"publishStreamKey", pconf.PublishStreamKey, &pconf.resolved.PublishStreamKey},
+		{"readUser", pconf.ReadUser, &pconf.resolved.ReadUser},
+		{"readPass", pconf.ReadPass, &pconf.resolved.ReadPass},
+		{"pushStreamKey", pconf.PushStreamKey, &pconf.resolved.PushStreamKey},
+	} {
+		*e.out, err = e.in.resolve()
+		if err != nil {
+			return fmt.Errorf("%s: %s", e.name, err)
+		}
+	}
+
+	return nil
+}
+
+// checkRegexpSource checks whether a static source can be used by a path with a regular expression.
+// The source is shared by all the paths that match the expression, therefore it must contain the
+// path name placeholder, and must be started on demand, in order to pull only the requested paths.
+func (pconf *PathConf) checkRegexpSource() error {
+	if pconf.Regexp == nil {
+		return nil
+	}
+
+	if !strings.Contains(pconf.Source, PathNamePlaceholder) {
+		return fmt.Errorf("a path with a regular expression (or path 'all') can have a static source "+
+			"only if the source contains %s; use another path", PathNamePlaceholder)
+	}
+
+	if !pconf.SourceOnDemand {
+		return fmt.Errorf("a path with a regular expression (or path 'all') can have a static source " +
+			"only if 'sourceOnDemand' is enabled")
+	}
+
+	return nil
 }
 
 func (pconf *PathConf) checkAndFillMissing(name string) error {
@@ -96,26 +264,33 @@ func (pconf *PathConf) checkAndFillMissing(name string) error {
 		pconf.Source = "publisher"
 	}
 
+	err := pconf.resolveSecrets()
+	if err != nil {
+		return err
+	}
+
 	switch {
 	case pconf.Source == "publisher":
 
 	case strings.HasPrefix(pconf.Source, "rtsp://") ||
 		strings.HasPrefix(pconf.Source, "rtsps://"):
-		if pconf.Regexp != nil {
-			return fmt.Errorf("a path with a regular expression (or path 'all') cannot have a RTSP source; use another path")
+		err := pconf.checkRegexpSource()
+		if err != nil {
+			return err
 		}
 
-		_, err := base.ParseURL(pconf.Source)
+		_, err = base.ParseURL(pconf.resolved.Source)
 		if err != nil {
 			return fmt.Errorf("'%s' is not a valid RTSP URL", pconf.Source)
 		}
 
 	case strings.HasPrefix(pconf.Source, "rtmp://"):
-		if pconf.Regexp != nil {
-			return fmt.Errorf("a path with a regular expression (or path 'all') cannot have a RTMP source; use another path")
+		err := pconf.checkRegexpSource()
+		if err != nil {
+			return err
 		}
 
-		u, err := url.Parse(pconf.Source)
+		u, err := url.Parse(pconf.resolved.Source)
 		if err != nil {
 			return fmt.Errorf("'%s' is not a valid RTMP URL", pconf.Source)
 		}
@@ -134,11 +309,12 @@ func (pconf *PathConf) checkAndFillMissing(name string) error {
 
 	case strings.HasPrefix(pconf.Source, "http://") ||
 		strings.HasPrefix(pconf.Source, "https://"):
-		if pconf.Regexp != nil {
-			return fmt.Errorf("a path with a regular expression (or path 'all') cannot have a HLS source; use another path")
+		err := pconf.checkRegexpSource()
+		if err != nil {
+			return err
 		}
 
-		u, err := url.Parse(pconf.Source)
+		u, err := url.Parse(pconf.resolved.Source)
 		if err != nil {
 			return fmt.Errorf("'%s' is not a valid HLS URL", pconf.Source)
 		}
@@ -155,6 +331,98 @@ func (pconf *PathConf) checkAndFillMissing(name string) error {
 			}
 		}
 
+	case strings.HasPrefix(pconf.Source, "v4l2:"):
+		if pconf.Regexp != nil {
+			return fmt.Errorf("a path with a regular expression (or path 'all') cannot have a V4L2 device as source; use another path")
+		}
+
+		if !strings.HasPrefix(pconf.Source[len("v4l2:"):], "/") {
+			return fmt.Errorf("'%s' is not a valid V4L2 device; use v4l2:/dev/videoN", pconf.Source)
+		}
+
+		if pconf.V4L2Width == 0 {
+			pconf.V4L2Width = 1280
+		}
+		if pconf.V4L2Height == 0 {
+			pconf.V4L2Height = 720
+		}
+		if pconf.V4L2FPS == 0 {
+			pconf.V4L2FPS = 30
+		}
+
+		if pconf.V4L2Width < 0 || pconf.V4L2Height < 0 || pconf.V4L2FPS < 0 {
+			return fmt.Errorf("'v4l2Width', 'v4l2Height' and 'v4l2FPS' can't be negative")
+		}
+
+	case pconf.Source == "rpiCamera":
+		if pconf.Regexp != nil {
+			return fmt.Errorf("a path with a regular expression (or path 'all') cannot have a Raspberry Pi Camera as source; use another path")
+		}
+
+		if pconf.RPICameraWidth == 0 {
+			pconf.RPICameraWidth = 1920
+		}
+		if pconf.RPICameraHeight == 0 {
+			pconf.RPICameraHeight = 1080
+		}
+		if pconf.RPICameraFPS == 0 {
+			pconf.RPICameraFPS = 30
+		}
+		if pconf.RPICameraBitrate == 0 {
+			pconf.RPICameraBitrate = 1000000
+		}
+
+		if pconf.RPICameraWidth < 0 || pconf.RPICameraHeight < 0 || pconf.RPICameraFPS < 0 ||
+			pconf.RPICameraBitrate < 0 {
+			return fmt.Errorf("'rpiCameraWidth', 'rpiCameraHeight', 'rpiCameraFPS' and 'rpiCameraBitrate' can't be negative")
+		}
+
+		switch pconf.RPICameraRotation {
+		case 0, 90, 180, 270:
+		default:
+			return fmt.Errorf("invalid 'rpiCameraRotation': %d (supported values are 0, 90, 180, 270)",
+				pconf.RPICameraRotation)
+		}
+
+	case pconf.Source == "testsrc":
+		if pconf.TestsrcWidth == 0 {
+			pconf.TestsrcWidth = 640
+		}
+		if pconf.TestsrcHeight == 0 {
+			pconf.TestsrcHeight = 480
+		}
+		if pconf.TestsrcFPS == 0 {
+			pconf.TestsrcFPS = 30
+		}
+
+		if pconf.TestsrcWidth < 16 || pconf.TestsrcWidth > 4096 || (pconf.TestsrcWidth%2) != 0 ||
+			pconf.TestsrcHeight < 16 || pconf.TestsrcHeight > 2304 || (pconf.TestsrcHeight%2) != 0 {
+			return fmt.Errorf("invalid test pattern size: %dx%d (width and height must be even, "+
+				"and the maximum size is 4096x2304)", pconf.TestsrcWidth, pconf.TestsrcHeight)
+		}
+
+		if pconf.TestsrcFPS < 1 || pconf.TestsrcFPS > 60 {
+			return fmt.Errorf("invalid 'testsrcFPS': %d (supported values are between 1 and 60)", pconf.TestsrcFPS)
+		}
+
+	case strings.HasPrefix(pconf.Source, "file://"):
+		if pconf.Regexp != nil {
+			return fmt.Errorf("a path with a regular expression (or path 'all') cannot have a file as source; use another path")
+		}
+
+		if !strings.HasPrefix(pconf.Source[len("file://"):], "/") {
+			return fmt.Errorf("'%s' is not a valid file URL; use file:///path/to/file.mp4", pconf.Source)
+		}
+
+	case strings.HasSuffix(pconf.Source, ".sdp"):
+		if pconf.Regexp != nil {
+			return fmt.Errorf("a path with a regular expression (or path 'all') cannot have a SDP file as source; use another path")
+		}
+
+		if !filepath.IsAbs(pconf.Source) {
+			return fmt.Errorf("'%s' is not an absolute path", pconf.Source)
+		}
+
 	case pconf.Source == "redirect":
 		if pconf.SourceRedirect == "" {
 			return fmt.Errorf("source redirect must be filled")
@@ -175,6 +443,139 @@ func (pconf *PathConf) checkAndFillMissing(name string) error {
 		}
 	}
 
+	if pconf.SourceParameterPassthrough {
+		if !strings.HasPrefix(pconf.Source, "rtsp://") &&
+			!strings.HasPrefix(pconf.Source, "rtsps://") {
+			return fmt.Errorf("'sourceParameterPassthrough' can be used only when source is a RTSP URL")
+		}
+	}
+
+	if pconf.SourceBackchannel {
+		if !strings.HasPrefix(pconf.Source, "rtsp://") &&
+			!strings.HasPrefix(pconf.Source, "rtsps://") {
+			return fmt.Errorf("'sourceBackchannel' can be used only when source is a RTSP URL")
+		}
+	}
+
+	if len(pconf.SourceQueryParams) != 0 {
+		if pconf.Source == "publisher" || pconf.Source == "redirect" {
+			return fmt.Errorf("'sourceQueryParams' can be used only when source is an URL")
+		}
+
+		// the source is shared between readers, therefore it must be started
+		// by the first reader, with its query parameters.
+		if !pconf.SourceOnDemand {
+			return fmt.Errorf("'sourceQueryParams' can be used only if 'sourceOnDemand' is enabled")
+		}
+	}
+
+	if pconf.SourceInactivityTimeout < 0 {
+		return fmt.Errorf("'sourceInactivityTimeout' can't be negative")
+	}
+
+	if pconf.SourceOutageHold < 0 {
+		return fmt.Errorf("'sourceOutageHold' can't be negative")
+	}
+
+	if pconf.SourceOutageHold != 0 {
+		if pconf.Source == "redirect" {
+			return fmt.Errorf("'sourceOutageHold' is useless when source is 'redirect'")
+		}
+
+		// on-demand sources are closed on purpose when there are no readers.
+		if pconf.SourceOnDemand || pconf.RunOnDemand != "" {
+			return fmt.Errorf("'sourceOutageHold' can't be used with on-demand sources")
+		}
+	}
+
+	if pconf.FlexFEC {
+		if pconf.FlexFECGroupSize == 0 {
+			pconf.FlexFECGroupSize = 10
+		}
+
+		// the group size is limited by the first mask of the FlexFEC header.
+		if pconf.FlexFECGroupSize < 1 || pconf.FlexFECGroupSize > 15 {
+			return fmt.Errorf("invalid 'flexFECGroupSize': %d (supported values are between 1 and 15)",
+				pconf.FlexFECGroupSize)
+		}
+	}
+
+	if pconf.MotionDetection {
+		if pconf.MotionDetectionThreshold == 0 {
+			pconf.MotionDetectionThreshold = 300
+		}
+
+		if pconf.MotionDetectionThreshold <= 100 {
+			return fmt.Errorf("invalid 'motionDetectionThreshold': %d (it must be greater than 100)",
+				pconf.MotionDetectionThreshold)
+		}
+	}
+
+	if pconf.InferenceURL != "" {
+		if !strings.HasPrefix(pconf.InferenceURL, "http://") &&
+			!strings.HasPrefix(pconf.InferenceURL, "https://") {
+			return fmt.Errorf("'inferenceURL' must be a HTTP URL")
+		}
+
+		_, err := url.Parse(pconf.InferenceURL)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a valid URL", pconf.InferenceURL)
+		}
+
+		if pconf.InferenceInterval == 0 {
+			pconf.InferenceInterval = StringDuration(time.Second)
+		}
+	}
+
+	if pconf.ImpairmentLoss < 0 || pconf.ImpairmentLoss > 100 {
+		return fmt.Errorf("invalid 'impairmentLoss': %d (it must be a percentage between 0 and 100)",
+			pconf.ImpairmentLoss)
+	}
+
+	if pconf.ImpairmentReorder < 0 || pconf.ImpairmentReorder > 100 {
+		return fmt.Errorf("invalid 'impairmentReorder': %d (it must be a percentage between 0 and 100)",
+			pconf.ImpairmentReorder)
+	}
+
+	if pconf.ImpairmentLatency < 0 {
+		return fmt.Errorf("'impairmentLatency' can't be negative")
+	}
+
+	if pconf.ReadTimeout < 0 {
+		return fmt.Errorf("'readTimeout' can't be negative")
+	}
+
+	if pconf.WriteTimeout < 0 {
+		return fmt.Errorf("'writeTimeout' can't be negative")
+	}
+
+	if pconf.ReadBufferCount < 0 {
+		return fmt.Errorf("'readBufferCount' can't be negative")
+	}
+
+	if pconf.MaxReaders < 0 {
+		return fmt.Errorf("'maxReaders' can't be negative")
+	}
+
+	if pconf.MaxEgressBitrate < 0 {
+		return fmt.Errorf("'maxEgressBitrate' can't be negative")
+	}
+
+	err = pconf.HLSHeaders.check()
+	if err != nil {
+		return err
+	}
+
+	err = pconf.checkPush()
+	if err != nil {
+		return err
+	}
+
+	err = pconf.checkSRTOutput()
+	if err != nil {
+		return err
+	}
+
 	if pconf.SourceOnDemandStartTimeout == 0 {
 		pconf.SourceOnDemandStartTimeout = 10 * StringDuration(time.Second)
 	}
@@ -183,6 +584,29 @@ func (pconf *PathConf) checkAndFillMissing(name string) error {
 		pconf.SourceOnDemandCloseAfter = 10 * StringDuration(time.Second)
 	}
 
+	if pconf.SourceRetryPause == 0 {
+		pconf.SourceRetryPause = 5 * StringDuration(time.Second)
+	}
+
+	if pconf.SourceRetryMaxPause == 0 {
+		pconf.SourceRetryMaxPause = 2 * StringDuration(time.Minute)
+		if pconf.SourceRetryMaxPause < pconf.SourceRetryPause {
+			pconf.SourceRetryMaxPause = pconf.SourceRetryPause
+		}
+	}
+
+	if pconf.SourceRetryMaxPause < pconf.SourceRetryPause {
+		return fmt.Errorf("'sourceRetryMaxPause' can't be lower than 'sourceRetryPause'")
+	}
+
+	if pconf.SourceRetryJitter < 0 || pconf.SourceRetryJitter > 100 {
+		return fmt.Errorf("'sourceRetryJitter' must be between 0 and 100")
+	}
+
+	if pconf.SourceRetryMaxCount < 0 {
+		return fmt.Errorf("'sourceRetryMaxCount' can't be negative")
+	}
+
 	if pconf.Fallback != "" {
 		if strings.HasPrefix(pconf.Fallback, "/") {
 			err := IsValidPathName(pconf.Fallback[1:])
@@ -197,11 +621,42 @@ func (pconf *PathConf) checkAndFillMissing(name string) error {
 		}
 	}
 
+	if pconf.OnDemandDescribe == OnDemandDescribeFallback && pconf.Fallback == "" {
+		return fmt.Errorf("'onDemandDescribe' is 'fallback' but 'fallback' is empty")
+	}
+
+	if pconf.OnDemandDescribeTimeout < 0 {
+		return fmt.Errorf("'onDemandDescribeTimeout' can't be negative")
+	}
+
+	// SAP announces the stream to anyone, without authentication
+	if pconf.SAPAnnounce && (pconf.ReadUser != "" || len(pconf.ReadIPs) != 0 || pconf.MulticastEncryption) {
+		return fmt.Errorf("'sapAnnounce' can't be used with 'readUser', 'readIPs' or 'multicastEncryption'")
+	}
+
+	if pconf.MulticastKeyRotation < 0 {
+		return fmt.Errorf("'multicastKeyRotation' can't be negative")
+	}
+
 	if (pconf.PublishUser != "" && pconf.PublishPass == "") ||
 		(pconf.PublishUser == "" && pconf.PublishPass != "") {
 		return fmt.Errorf("read username and password must be both filled")
 	}
 
+	if pconf.PublishStreamKey != "" {
+		if pconf.Regexp != nil {
+			return fmt.Errorf("a path with a regular expression (or path 'all') can't have a 'publishStreamKey'")
+		}
+
+		if pconf.Source != "publisher" {
+			return fmt.Errorf("'publishStreamKey' is useless when source is not 'publisher'")
+		}
+
+		if strings.HasPrefix(string(pconf.PublishStreamKey), "sha256:") {
+			return fmt.Errorf("'publishStreamKey' can't be hashed")
+		}
+	}
+
 	if pconf.PublishUser != "" && pconf.Source != "publisher" {
 		return fmt.Errorf("'publishUser' is useless when source is not 'publisher', since " +
 			"the stream is not provided by a publisher, but by a fixed source")
@@ -212,6 +667,11 @@ func (pconf *PathConf) checkAndFillMissing(name string) error {
 			"the stream is not provided by a publisher, but by a fixed source")
 	}
 
+	if len(pconf.PublishCountries) > 0 && pconf.Source != "publisher" {
+		return fmt.Errorf("'publishCountries' is useless when source is not 'publisher', since " +
+			"the stream is not provided by a publisher, but by a fixed source")
+	}
+
 	if (pconf.ReadUser != "" && pconf.ReadPass == "") ||
 		(pconf.ReadUser == "" && pconf.ReadPass != "") {
 		return fmt.Errorf("read username and password must be both filled")
@@ -230,6 +690,35 @@ func (pconf *PathConf) checkAndFillMissing(name string) error {
 		return fmt.Errorf("'runOnDemand' can be used only when source is 'publisher'")
 	}
 
+	for _, v := range []struct {
+		name   string
+		cmdstr string
+	}{
+		{"runOnInit", pconf.RunOnInit},
+		{"runOnDemand", pconf.RunOnDemand},
+		{"runOnPublish", pconf.RunOnPublish},
+		{"runOnRead", pconf.RunOnRead},
+		{"runOnSourceInactive", pconf.RunOnSourceInactive},
+		{"runOnMotion", pconf.RunOnMotion},
+		{"runOnRecord", pconf.RunOnRecord},
+	} {
+		err := externalcmd.CheckTemplate(v.cmdstr)
+		if err != nil {
+			return fmt.Errorf("invalid '%s': %s", v.name, err)
+		}
+	}
+
+	if pconf.RecordSchedule != "" {
+		if pconf.RunOnRecord == "" {
+			return fmt.Errorf("'recordSchedule' can be used only when 'runOnRecord' is set")
+		}
+
+		_, err := cron.Parse(pconf.RecordSchedule)
+		if err != nil {
+			return fmt.Errorf("invalid 'recordSchedule': %s", err)
+		}
+	}
+
 	if pconf.RunOnDemandStartTimeout == 0 {
 		pconf.RunOnDemandStartTimeout = 10 * StringDuration(time.Second)
 	}
@@ -241,9 +730,104 @@ func (pconf *PathConf) checkAndFillMissing(name string) error {
 	return nil
 }
 
+// HasImpairment checks whether the path simulates a lossy network.
+func (pconf *PathConf) HasImpairment() bool {
+	return pconf.ImpairmentLoss != 0 || pconf.ImpairmentReorder != 0 || pconf.ImpairmentLatency != 0
+}
+
 // Equal checks whether two PathConfs are equal.
 func (pconf *PathConf) Equal(other *PathConf) bool {
 	a, _ := json.Marshal(pconf)
 	b, _ := json.Marshal(other)
-	return string(a) == string(b)
+	return string(a) == string(b) &&
+		pconf.resolved == other.resolved
+}
+
+// checkPush checks the push destination, and fills the URL where the stream is pushed to.
+func (pconf *PathConf) checkPush() error {
+	if pconf.Push == "" {
+		if pconf.PushStreamKey != "" {
+			return fmt.Errorf("'pushStreamKey' can be used only when 'push' is a preset")
+		}
+		return nil
+	}
+
+	if preset, ok := pushPresets[pconf.Push]; ok {
+		// the stream key identifies a single stream, therefore it can't be shared between paths
+		if pconf.Regexp != nil {
+			return fmt.Errorf("a path with a regular expression (or path 'all') cannot be pushed to %s; use another path",
+				preset.Name)
+		}
+
+		key := string(pconf.resolved.PushStreamKey)
+		if key == "" {
+			return fmt.Errorf("'pushStreamKey' is required by preset '%s'", pconf.Push)
+		}
+		if strings.ContainsAny(key, "/?# ") {
+			return fmt.Errorf("'pushStreamKey' contains invalid characters")
+		}
+
+		pconf.resolved.Push = preset.URL + key
+		pconf.resolved.PushPreset = &preset
+		return nil
+	}
+
+	if pconf.PushStreamKey != "" {
+		return fmt.Errorf("'pushStreamKey' can be used only when 'push' is a preset (%s)", pushPresetNames())
+	}
+
+	if !strings.HasPrefix(pconf.Push, "rtmp://") && !strings.HasPrefix(pconf.Push, "rtmps://") {
+		return fmt.Errorf("'%s' is not a valid RTMP URL or push preset (available presets are %s)",
+			pconf.Push, pushPresetNames())
+	}
+
+	if pconf.Regexp != nil && !strings.Contains(pconf.Push, PathNamePlaceholder) {
+		return fmt.Errorf("a path with a regular expression (or path 'all') can be pushed "+
+			"only if the URL contains %s", PathNamePlaceholder)
+	}
+
+	ur, err := resolveSecretsInURL(pconf.Push)
+	if err != nil {
+		return fmt.Errorf("push: %s", err)
+	}
+
+	u, err := url.Parse(ur)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("'%s' is not a valid RTMP URL", pconf.Push)
+	}
+
+	pconf.resolved.Push = ur
+	return nil
+}
+
+// checkSRTOutput checks the SRT output, and fills its URL.
+func (pconf *PathConf) checkSRTOutput() error {
+	if pconf.SRTOutput == "" {
+		return nil
+	}
+
+	ur, err := resolveSecretsInURL(pconf.SRTOutput)
+	if err != nil {
+		return fmt.Errorf("srtOutput: %s", err)
+	}
+
+	u, err := srt.ParseURL(ur)
+	if err != nil {
+		return fmt.Errorf("invalid 'srtOutput': %s", err)
+	}
+
+	if pconf.Regexp != nil {
+		// the port can't be shared between paths
+		if u.Mode == srt.ModeListener {
+			return fmt.Errorf("a path with a regular expression (or path 'all') can't use a SRT output in listener mode")
+		}
+
+		if !strings.Contains(pconf.SRTOutput, PathNamePlaceholder) {
+			return fmt.Errorf("a path with a regular expression (or path 'all') can use a SRT output "+
+				"only if the URL contains %s", PathNamePlaceholder)
+		}
+	}
+
+	pconf.resolved.SRTOutput = ur
+	return nil
 }
@@ -0,0 +1,49 @@
+package conf
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// PushPreset contains the ingest parameters of a streaming platform.
+type PushPreset struct {
+	// name of the platform, used in messages.
+	Name string
+
+	// ingest URL. The stream key is appended to it.
+	URL string
+
+	// maximum interval between keyframes accepted by the platform.
+	MaxKeyframeInterval time.Duration
+}
+
+// pushPresets are the platforms that can be used with 'push'.
+// Platforms accept H264 video and AAC audio only.
+var pushPresets = map[string]PushPreset{
+	"youtube": {
+		Name:                "YouTube",
+		URL:                 "rtmp://a.rtmp.youtube.com/live2/",
+		MaxKeyframeInterval: 4 * time.Second,
+	},
+	"twitch": {
+		Name:                "Twitch",
+		URL:                 "rtmp://live.twitch.tv/app/",
+		MaxKeyframeInterval: 2 * time.Second,
+	},
+	"facebook": {
+		Name:                "Facebook",
+		URL:                 "rtmps://live-api-s.facebook.com:443/rtmp/",
+		MaxKeyframeInterval: 2 * time.Second,
+	},
+}
+
+// pushPresetNames returns the names of the available presets, in a format suitable for messages.
+func pushPresetNames() string {
+	var names []string
+	for name := range pushPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
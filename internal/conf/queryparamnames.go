@@ -0,0 +1,46 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var reQueryParamName = regexp.MustCompile(`^[0-9a-zA-Z_\-\.]+$`)
+
+// QueryParamNames is a parameter that accepts a list of names of query parameters.
+type QueryParamNames []string
+
+// MarshalJSON marshals a QueryParamNames into JSON.
+func (d QueryParamNames) MarshalJSON() ([]byte, error) {
+	out := d
+	if out == nil {
+		out = QueryParamNames{}
+	}
+	return json.Marshal([]string(out))
+}
+
+// UnmarshalJSON unmarshals a QueryParamNames from JSON.
+func (d *QueryParamNames) UnmarshalJSON(b []byte) error {
+	var in []string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	*d = nil
+
+	for _, v := range in {
+		if !reQueryParamName.MatchString(v) {
+			return fmt.Errorf("invalid query parameter name: '%s'", v)
+		}
+		*d = append(*d, v)
+	}
+
+	return nil
+}
+
+func (d *QueryParamNames) unmarshalEnv(s string) error {
+	byts, _ := json.Marshal(strings.Split(s, ","))
+	return d.UnmarshalJSON(byts)
+}
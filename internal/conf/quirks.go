@@ -0,0 +1,75 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Quirk is a compatibility toggle for sources that don't comply with standards.
+type Quirk string
+
+// supported quirks.
+const (
+	// repair session descriptions that can't be parsed.
+	QuirkBrokenSDP Quirk = "brokenSDP"
+
+	// accept packets from ports different than the ones announced by the source.
+	QuirkAnyPort Quirk = "anyPort"
+
+	// keep the SSRC of tracks constant when the source changes it.
+	QuirkSSRCChange Quirk = "ssrcChange"
+
+	// discard RTCP packets sent by the source.
+	QuirkIgnoreRTCP Quirk = "ignoreRTCP"
+)
+
+// Quirks is the quirks parameter.
+type Quirks map[Quirk]struct{}
+
+// MarshalJSON marshals a Quirks into JSON.
+func (d Quirks) MarshalJSON() ([]byte, error) {
+	out := make([]string, 0, len(d))
+
+	for q := range d {
+		out = append(out, string(q))
+	}
+
+	sort.Strings(out)
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON unmarshals a Quirks from JSON.
+func (d *Quirks) UnmarshalJSON(b []byte) error {
+	var in []string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	*d = make(Quirks)
+
+	for _, v := range in {
+		switch Quirk(v) {
+		case QuirkBrokenSDP, QuirkAnyPort, QuirkSSRCChange, QuirkIgnoreRTCP:
+			(*d)[Quirk(v)] = struct{}{}
+
+		default:
+			return fmt.Errorf("invalid quirk: %s", v)
+		}
+	}
+
+	return nil
+}
+
+func (d *Quirks) unmarshalEnv(s string) error {
+	byts, _ := json.Marshal(strings.Split(s, ","))
+	return d.UnmarshalJSON(byts)
+}
+
+// Has checks whether a quirk is enabled.
+func (d Quirks) Has(q Quirk) bool {
+	_, ok := d[q]
+	return ok
+}
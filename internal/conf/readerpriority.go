@@ -0,0 +1,120 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ReaderPriority is the priority class of a reader.
+// When a path is congested, readers with the lowest class are closed first.
+type ReaderPriority int
+
+// priority classes.
+const (
+	ReaderPriorityLow      ReaderPriority = -1
+	ReaderPriorityNormal   ReaderPriority = 0
+	ReaderPriorityHigh     ReaderPriority = 1
+	ReaderPriorityCritical ReaderPriority = 2
+)
+
+// String implements fmt.Stringer.
+func (d ReaderPriority) String() string {
+	switch d {
+	case ReaderPriorityLow:
+		return "low"
+
+	case ReaderPriorityHigh:
+		return "high"
+
+	case ReaderPriorityCritical:
+		return "critical"
+	}
+
+	return "normal"
+}
+
+// MarshalJSON marshals a ReaderPriority into JSON.
+func (d ReaderPriority) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON unmarshals a ReaderPriority from JSON.
+func (d *ReaderPriority) UnmarshalJSON(b []byte) error {
+	var in string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	switch in {
+	case "low":
+		*d = ReaderPriorityLow
+
+	case "normal", "":
+		*d = ReaderPriorityNormal
+
+	case "high":
+		*d = ReaderPriorityHigh
+
+	case "critical":
+		*d = ReaderPriorityCritical
+
+	default:
+		return fmt.Errorf("invalid priority: '%s' (supported values are low, normal, high, critical)", in)
+	}
+
+	return nil
+}
+
+// ReaderPriorityRule assigns a priority class to the readers that match
+// all the conditions of the rule.
+type ReaderPriorityRule struct {
+	Priority ReaderPriority `json:"priority"`
+	Users    []string       `json:"users"`
+	IPs      IPsOrNets      `json:"ips"`
+	Query    string         `json:"query"`
+}
+
+// QueryParam returns the name and the value of the query parameter
+// required by the rule. An empty value means that any value is accepted.
+func (r ReaderPriorityRule) QueryParam() (string, string) {
+	tmp := strings.SplitN(r.Query, "=", 2)
+	if len(tmp) == 1 {
+		return tmp[0], ""
+	}
+	return tmp[0], tmp[1]
+}
+
+// ReaderPriorityRules is the readerPriorities parameter.
+// The priority of a reader is the one of the first rule it matches.
+type ReaderPriorityRules []ReaderPriorityRule
+
+// UnmarshalJSON unmarshals a ReaderPriorityRules from JSON.
+func (d *ReaderPriorityRules) UnmarshalJSON(b []byte) error {
+	// prevent typos in rules from being silently ignored
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+
+	var in []ReaderPriorityRule
+	if err := dec.Decode(&in); err != nil {
+		return err
+	}
+
+	for i, r := range in {
+		if len(r.Users) == 0 && len(r.IPs) == 0 && r.Query == "" {
+			return fmt.Errorf("reader priority rule %d has no conditions; fill 'users', 'ips' or 'query'", i+1)
+		}
+
+		if name, _ := r.QueryParam(); r.Query != "" && name == "" {
+			return fmt.Errorf("invalid query of reader priority rule %d: '%s', use name or name=value", i+1, r.Query)
+		}
+	}
+
+	*d = in
+	return nil
+}
+
+func (d *ReaderPriorityRules) unmarshalEnv(s string) error {
+	return d.UnmarshalJSON([]byte(s))
+}
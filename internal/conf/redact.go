@@ -0,0 +1,144 @@
+package conf
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/aler9/rtsp-simple-server/internal/redact"
+)
+
+// redacted returns the Credential with its value replaced by a placeholder.
+// References to secrets are left unchanged, since they don't contain the secret itself.
+func (d Credential) redacted() Credential {
+	if isSecretRef(string(d)) {
+		return d
+	}
+	return Credential(redact.Value(string(d)))
+}
+
+// redactFields replaces the value of the fields of a struct that are tagged with `redact:"true"`.
+func redactFields(rv reflect.Value) {
+	for i := 0; i < rv.NumField(); i++ {
+		if rv.Type().Field(i).Tag.Get("redact") != "true" {
+			continue
+		}
+
+		f := rv.Field(i)
+		switch cur := f.Interface().(type) {
+		case string:
+			f.SetString(redact.Text(cur))
+
+		case Credential:
+			f.Set(reflect.ValueOf(cur.redacted()))
+
+		default:
+			panic(fmt.Sprintf("unable to redact field of type %T", cur))
+		}
+	}
+}
+
+// Redacted returns a copy of the path configuration in which passwords,
+// stream keys and credentials embedded into URLs and commands are replaced by a placeholder.
+func (pconf *PathConf) Redacted() *PathConf {
+	ret := *pconf
+	redactFields(reflect.ValueOf(&ret).Elem())
+	return &ret
+}
+
+// Redacted returns a copy of the configuration in which secrets are replaced by a placeholder.
+func (conf *Conf) Redacted() *Conf {
+	ret := *conf
+	redactFields(reflect.ValueOf(&ret).Elem())
+
+	ret.Paths = redactedPaths(conf.Paths)
+
+	if conf.Tenants != nil {
+		ret.Tenants = make(map[string]*TenantConf, len(conf.Tenants))
+		for name, tconf := range conf.Tenants {
+			tret := *tconf
+			tret.Paths = redactedPaths(tconf.Paths)
+			ret.Tenants[name] = &tret
+		}
+	}
+
+	return &ret
+}
+
+func redactedPaths(paths map[string]*PathConf) map[string]*PathConf {
+	if paths == nil {
+		return nil
+	}
+
+	ret := make(map[string]*PathConf, len(paths))
+	for name, pconf := range paths {
+		ret[name] = pconf.Redacted()
+	}
+	return ret
+}
+
+// unredactText returns the previous value of a parameter if the current one
+// is the redacted version of it.
+func unredactText(cur string, prev string) string {
+	if cur != prev && cur == redact.Text(prev) {
+		return prev
+	}
+	return cur
+}
+
+func (d Credential) unredacted(prev Credential) Credential {
+	if d != prev && d == prev.redacted() {
+		return prev
+	}
+	return d
+}
+
+// unredactFields replaces the placeholders produced by redactFields with the values of a previous struct.
+func unredactFields(rv reflect.Value, prev reflect.Value) {
+	for i := 0; i < rv.NumField(); i++ {
+		if rv.Type().Field(i).Tag.Get("redact") != "true" {
+			continue
+		}
+
+		f := rv.Field(i)
+		switch cur := f.Interface().(type) {
+		case string:
+			f.SetString(unredactText(cur, prev.Field(i).String()))
+
+		case Credential:
+			f.Set(reflect.ValueOf(cur.unredacted(prev.Field(i).Interface().(Credential))))
+
+		default:
+			panic(fmt.Sprintf("unable to unredact field of type %T", cur))
+		}
+	}
+}
+
+// unredact replaces the placeholders produced by Redacted with the values of a previous configuration.
+func (pconf *PathConf) unredact(prev *PathConf) {
+	unredactFields(reflect.ValueOf(pconf).Elem(), reflect.ValueOf(prev).Elem())
+}
+
+func unredactPaths(paths map[string]*PathConf, prev map[string]*PathConf) {
+	for name, pconf := range paths {
+		if pconf == nil {
+			continue
+		}
+		if prevConf, ok := prev[name]; ok {
+			pconf.unredact(prevConf)
+		}
+	}
+}
+
+// unredact replaces the placeholders produced by Redacted with the values of a previous configuration.
+// Paths are matched by name.
+func (conf *Conf) unredact(prev *Conf) {
+	unredactFields(reflect.ValueOf(conf).Elem(), reflect.ValueOf(prev).Elem())
+
+	unredactPaths(conf.Paths, prev.Paths)
+
+	for name, tconf := range conf.Tenants {
+		if prevConf, ok := prev.Tenants[name]; ok && tconf != nil {
+			unredactPaths(tconf.Paths, prevConf.Paths)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package conf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// secret references embedded into URLs, in the format ${file:///path} or ${env:NAME}.
+var reSecretInURL = regexp.MustCompile(`\$\{((file://|env:)[^}]+)\}`)
+
+// isSecretRef checks whether a value is a reference to a secret,
+// in the format file:///path or env:NAME.
+func isSecretRef(s string) bool {
+	return strings.HasPrefix(s, "file://") || strings.HasPrefix(s, "env:")
+}
+
+// resolveSecret returns the value of a secret reference.
+// Values that are not references are returned unchanged.
+func resolveSecret(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, "file://"):
+		fpath := s[len("file://"):]
+		byts, err := ioutil.ReadFile(fpath)
+		if err != nil {
+			return "", fmt.Errorf("unable to read secret: %s", err)
+		}
+
+		// files written with editors or echo usually end with a newline
+		return strings.TrimRight(string(byts), "\r\n"), nil
+
+	case strings.HasPrefix(s, "env:"):
+		name := s[len("env:"):]
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("unable to read secret: environment variable '%s' is not set", name)
+		}
+		return v, nil
+	}
+
+	return s, nil
+}
+
+// resolveSecretsInURL replaces the secret references embedded into a URL with their values.
+func resolveSecretsInURL(s string) (string, error) {
+	var err error
+	ret := reSecretInURL.ReplaceAllStringFunc(s, func(m string) string {
+		v, err2 := resolveSecret(m[2 : len(m)-1])
+		if err2 != nil {
+			err = err2
+			return ""
+		}
+
+		// secrets are usually passwords, that must be escaped
+		// in order not to break the URL.
+		return escapeUserInfo(v)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return ret, nil
+}
+
+func escapeUserInfo(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,63 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ServerCertificate is a certificate and key pair.
+type ServerCertificate struct {
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+}
+
+// ServerCertificates is a parameter that accepts a list of certificate and key pairs.
+type ServerCertificates []ServerCertificate
+
+// MarshalJSON marshals a ServerCertificates into JSON.
+func (d ServerCertificates) MarshalJSON() ([]byte, error) {
+	out := d
+	if out == nil {
+		out = ServerCertificates{}
+	}
+	return json.Marshal([]ServerCertificate(out))
+}
+
+// UnmarshalJSON unmarshals a ServerCertificates from JSON.
+func (d *ServerCertificates) UnmarshalJSON(b []byte) error {
+	var in []ServerCertificate
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	for _, c := range in {
+		if c.Cert == "" || c.Key == "" {
+			return fmt.Errorf("both 'cert' and 'key' must be filled")
+		}
+	}
+
+	*d = nil
+	if len(in) != 0 {
+		*d = in
+	}
+
+	return nil
+}
+
+// unmarshalEnv accepts a list of pairs in the format cert:key,cert:key.
+func (d *ServerCertificates) unmarshalEnv(s string) error {
+	var in []ServerCertificate
+
+	for _, v := range strings.Split(s, ",") {
+		i := strings.LastIndex(v, ":")
+		if i < 0 {
+			return fmt.Errorf("invalid certificate and key pair: '%s'", v)
+		}
+
+		in = append(in, ServerCertificate{Cert: v[:i], Key: v[i+1:]})
+	}
+
+	byts, _ := json.Marshal(in)
+	return d.UnmarshalJSON(byts)
+}
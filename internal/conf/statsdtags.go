@@ -0,0 +1,37 @@
+package conf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StatsDTags is a set of tags that are added to every StatsD metric.
+type StatsDTags map[string]string
+
+func (d StatsDTags) check() error {
+	for k, v := range d {
+		if k == "" || strings.ContainsAny(k, ":,|#@ \t\r\n") {
+			return fmt.Errorf("invalid tag name: '%s'", k)
+		}
+
+		if strings.ContainsAny(v, ",|#@\r\n") {
+			return fmt.Errorf("invalid value of tag '%s'", k)
+		}
+	}
+	return nil
+}
+
+func (d *StatsDTags) unmarshalEnv(s string) error {
+	*d = make(StatsDTags)
+
+	for _, kv := range strings.Split(s, ",") {
+		tmp := strings.SplitN(kv, ":", 2)
+		if len(tmp) != 2 {
+			return fmt.Errorf("invalid value '%s', use name:value", kv)
+		}
+
+		(*d)[strings.TrimSpace(tmp[0])] = strings.TrimSpace(tmp[1])
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package conf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TenantConf is a tenant configuration.
+// A tenant owns the paths whose name begins with the name of the tenant,
+// followed by a slash, and configures them through its own paths section.
+type TenantConf struct {
+	Hosts            Hostnames            `json:"hosts"`
+	MaxPaths         int                  `json:"maxPaths"`
+	MaxPublishers    int                  `json:"maxPublishers"`
+	MaxReaders       int                  `json:"maxReaders"`
+	MaxIngestBitrate int                  `json:"maxIngestBitrate"`
+	MaxEgressBitrate int                  `json:"maxEgressBitrate"`
+	Paths            map[string]*PathConf `json:"paths"`
+}
+
+func (tconf *TenantConf) checkAndFillMissing(name string) error {
+	err := IsValidPathName(name)
+	if err != nil {
+		return fmt.Errorf("invalid tenant name: %s (%s)", err, name)
+	}
+
+	if strings.Contains(name, "/") {
+		return fmt.Errorf("invalid tenant name: can't contain a slash (%s)", name)
+	}
+
+	if tconf.MaxPaths < 0 {
+		return fmt.Errorf("'maxPaths' can't be negative")
+	}
+
+	if tconf.MaxPublishers < 0 {
+		return fmt.Errorf("'maxPublishers' can't be negative")
+	}
+
+	if tconf.MaxReaders < 0 {
+		return fmt.Errorf("'maxReaders' can't be negative")
+	}
+
+	if tconf.MaxIngestBitrate < 0 {
+		return fmt.Errorf("'maxIngestBitrate' can't be negative")
+	}
+
+	if tconf.MaxEgressBitrate < 0 {
+		return fmt.Errorf("'maxEgressBitrate' can't be negative")
+	}
+
+	if tconf.Paths == nil {
+		tconf.Paths = make(map[string]*PathConf)
+	}
+
+	// "all" is an alias for "~^.*$"
+	if _, ok := tconf.Paths["all"]; ok {
+		tconf.Paths["~^.*$"] = tconf.Paths["all"]
+		delete(tconf.Paths, "all")
+	}
+
+	for pathName, pconf := range tconf.Paths {
+		if pconf == nil {
+			tconf.Paths[pathName] = &PathConf{}
+			pconf = tconf.Paths[pathName]
+		}
+
+		// regular expressions are matched against the path name without the tenant prefix
+		err := pconf.checkAndFillMissing(pathName)
+		if err != nil {
+			return fmt.Errorf("path '%s': %s", pathName, err)
+		}
+
+		pconf.Tenant = name
+	}
+
+	return nil
+}
+
+// TenantOfPath returns the name of the tenant that owns a path, or an empty string.
+func TenantOfPath(tenants map[string]*TenantConf, pathName string) string {
+	i := strings.IndexByte(pathName, '/')
+	if i <= 0 {
+		return ""
+	}
+
+	if _, ok := tenants[pathName[:i]]; !ok {
+		return ""
+	}
+
+	return pathName[:i]
+}
+
+// TenantPathName returns the name of the path requested by a client
+// that connected to the given host. When the host belongs to a tenant,
+// the requested path is placed inside the namespace of the tenant.
+func TenantPathName(tenants map[string]*TenantConf, host string, pathName string) string {
+	if len(tenants) == 0 || host == "" {
+		return pathName
+	}
+
+	// remove port
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.HasSuffix(host, "]") {
+		host = host[:i]
+	}
+	host = strings.ToLower(host)
+
+	for name, tconf := range tenants {
+		for _, h := range tconf.Hosts {
+			if h == host {
+				return name + "/" + pathName
+			}
+		}
+	}
+
+	return pathName
+}
+
+// AllPaths returns the configurations of all paths, including the ones
+// of tenants, whose names are prefixed with the name of the tenant.
+func (conf *Conf) AllPaths() map[string]*PathConf {
+	if len(conf.Tenants) == 0 {
+		return conf.Paths
+	}
+
+	ret := make(map[string]*PathConf)
+
+	for name, pconf := range conf.Paths {
+		ret[name] = pconf
+	}
+
+	for tenantName, tconf := range conf.Tenants {
+		for name, pconf := range tconf.Paths {
+			ret[tenantName+"/"+name] = pconf
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,146 @@
+package conf
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var tlsCurves = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
+// TLSVersion is a TLS version.
+type TLSVersion uint16
+
+// MarshalJSON marshals a TLSVersion into JSON.
+func (d TLSVersion) MarshalJSON() ([]byte, error) {
+	for k, v := range tlsVersions {
+		if v == uint16(d) {
+			return json.Marshal(k)
+		}
+	}
+	return json.Marshal("")
+}
+
+// UnmarshalJSON unmarshals a TLSVersion from JSON.
+func (d *TLSVersion) UnmarshalJSON(b []byte) error {
+	var in string
+	if err := json.Unmarshal(b, &in); err != nil {
+		// allow unquoted versions, that are decoded as numbers
+		var f float64
+		if err := json.Unmarshal(b, &f); err != nil {
+			return err
+		}
+		in = strconv.FormatFloat(f, 'f', 1, 64)
+	}
+
+	v, ok := tlsVersions[in]
+	if !ok {
+		return fmt.Errorf("invalid TLS version: '%s'", in)
+	}
+
+	*d = TLSVersion(v)
+	return nil
+}
+
+func (d *TLSVersion) unmarshalEnv(s string) error {
+	return d.UnmarshalJSON([]byte(`"` + s + `"`))
+}
+
+// TLSCipherSuites is a list of TLS cipher suites.
+type TLSCipherSuites []uint16
+
+// MarshalJSON marshals a TLSCipherSuites into JSON.
+func (d TLSCipherSuites) MarshalJSON() ([]byte, error) {
+	out := make([]string, len(d))
+	for i, v := range d {
+		out[i] = tls.CipherSuiteName(v)
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON unmarshals a TLSCipherSuites from JSON.
+func (d *TLSCipherSuites) UnmarshalJSON(b []byte) error {
+	var in []string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	*d = nil
+
+	// insecure cipher suites are not allowed
+	available := make(map[string]uint16)
+	for _, cs := range tls.CipherSuites() {
+		available[cs.Name] = cs.ID
+	}
+
+	for _, name := range in {
+		id, ok := available[name]
+		if !ok {
+			return fmt.Errorf("unsupported cipher suite: '%s'", name)
+		}
+		*d = append(*d, id)
+	}
+
+	return nil
+}
+
+func (d *TLSCipherSuites) unmarshalEnv(s string) error {
+	byts, _ := json.Marshal(strings.Split(s, ","))
+	return d.UnmarshalJSON(byts)
+}
+
+// TLSCurves is a list of elliptic curves used in TLS key exchanges.
+type TLSCurves []tls.CurveID
+
+// MarshalJSON marshals a TLSCurves into JSON.
+func (d TLSCurves) MarshalJSON() ([]byte, error) {
+	out := make([]string, len(d))
+	for i, v := range d {
+		for k, c := range tlsCurves {
+			if c == v {
+				out[i] = k
+				break
+			}
+		}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON unmarshals a TLSCurves from JSON.
+func (d *TLSCurves) UnmarshalJSON(b []byte) error {
+	var in []string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	*d = nil
+
+	for _, name := range in {
+		c, ok := tlsCurves[name]
+		if !ok {
+			return fmt.Errorf("unsupported curve: '%s'", name)
+		}
+		*d = append(*d, c)
+	}
+
+	return nil
+}
+
+func (d *TLSCurves) unmarshalEnv(s string) error {
+	byts, _ := json.Marshal(strings.Split(s, ","))
+	return d.UnmarshalJSON(byts)
+}
@@ -0,0 +1,290 @@
+// Package confremote contains functions to fetch the configuration from a remote backend.
+package confremote
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+const (
+	fetchTimeout = 10 * time.Second
+)
+
+// IsRemote checks whether a configuration path points to a remote backend.
+func IsRemote(confPath string) bool {
+	for _, prefix := range []string{"http://", "https://", "consul://", "etcd://"} {
+		if strings.HasPrefix(confPath, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Source is a remote configuration backend.
+type Source struct {
+	u          *url.URL
+	httpClient *http.Client
+}
+
+// NewSource allocates a Source. The URL can be in one of the following formats:
+// http://host/path or https://host/path, to perform a GET request;
+// consul://host:port/key, to read a key from the Consul KV store;
+// etcd://host:port/key, to read a key from etcd through its v3 HTTP gateway.
+func NewSource(ur string) (*Source, error) {
+	u, err := url.Parse(ur)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+
+	case "consul", "etcd":
+		if strings.TrimPrefix(u.Path, "/") == "" {
+			return nil, fmt.Errorf("key is missing in '%s'", ur)
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported configuration backend: '%s'", u.Scheme)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("host is missing in '%s'", ur)
+	}
+
+	return &Source{
+		u:          u,
+		httpClient: &http.Client{Timeout: fetchTimeout},
+	}, nil
+}
+
+// String implements fmt.Stringer. Credentials are not printed.
+func (s *Source) String() string {
+	u := *s.u
+	u.User = nil
+	return u.String()
+}
+
+// Fetch downloads the configuration.
+func (s *Source) Fetch(ctx context.Context) ([]byte, error) {
+	switch s.u.Scheme {
+	case "consul":
+		return s.fetchConsul(ctx)
+
+	case "etcd":
+		return s.fetchEtcd(ctx)
+	}
+
+	return s.fetchHTTP(ctx)
+}
+
+func (s *Source) do(req *http.Request) ([]byte, error) {
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status code: %d", res.StatusCode)
+	}
+
+	return ioutil.ReadAll(res.Body)
+}
+
+func (s *Source) fetchHTTP(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.do(req)
+}
+
+func (s *Source) fetchConsul(ctx context.Context) ([]byte, error) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   s.u.Host,
+		Path:   "/v1/kv/" + strings.TrimPrefix(s.u.Path, "/"),
+	}
+	q := u.Query()
+	q.Set("raw", "")
+	if dc := s.u.Query().Get("dc"); dc != "" {
+		q.Set("dc", dc)
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if token, ok := os.LookupEnv("CONSUL_HTTP_TOKEN"); ok {
+		req.Header.Set("X-Consul-Token", token)
+	}
+
+	return s.do(req)
+}
+
+func (s *Source) fetchEtcd(ctx context.Context) ([]byte, error) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   s.u.Host,
+		Path:   "/v3/kv/range",
+	}
+
+	reqBody, _ := json.Marshal(struct {
+		Key string `json:"key"`
+	}{
+		Key: base64.StdEncoding.EncodeToString([]byte(s.u.Path)),
+	})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	byts, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Kvs []struct {
+			Value string `json:"value"`
+		} `json:"kvs"`
+	}
+	err = json.Unmarshal(byts, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res.Kvs) == 0 {
+		return nil, fmt.Errorf("key '%s' not found", s.u.Path)
+	}
+
+	return base64.StdEncoding.DecodeString(res.Kvs[0].Value)
+}
+
+// Sync downloads the configuration and writes it into the cache file,
+// if it differs from the current content of the file.
+// It returns whether the file has been written.
+func Sync(ctx context.Context, src *Source, cachePath string) (bool, error) {
+	byts, err := src.Fetch(ctx)
+	if err != nil {
+		return false, fmt.Errorf("unable to fetch configuration from %s: %s", src, err)
+	}
+
+	cur, err := ioutil.ReadFile(cachePath)
+	if err == nil && bytes.Equal(cur, byts) {
+		return false, nil
+	}
+
+	// write a temporary file and rename it in order to
+	// prevent the configuration from being read while it's incomplete.
+	tmpPath := cachePath + ".tmp"
+	err = ioutil.WriteFile(tmpPath, byts, 0o600)
+	if err != nil {
+		return false, err
+	}
+
+	err = os.Rename(tmpPath, cachePath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// PollerParent is implemented by Core.
+type PollerParent interface {
+	Log(logger.Level, string, ...interface{})
+}
+
+// Poller periodically synchronizes a remote configuration with its cache file.
+// Changes to the cache file are then detected by the configuration watcher.
+type Poller struct {
+	src       *Source
+	cachePath string
+	interval  time.Duration
+	parent    PollerParent
+
+	ctx       context.Context
+	ctxCancel func()
+	wg        sync.WaitGroup
+}
+
+// NewPoller allocates a Poller.
+func NewPoller(src *Source, cachePath string, interval time.Duration, parent PollerParent) *Poller {
+	ctx, ctxCancel := context.WithCancel(context.Background())
+
+	p := &Poller{
+		src:       src,
+		cachePath: cachePath,
+		interval:  interval,
+		parent:    parent,
+		ctx:       ctx,
+		ctxCancel: ctxCancel,
+	}
+
+	p.wg.Add(1)
+	go p.run()
+
+	return p
+}
+
+// Close closes a Poller.
+func (p *Poller) Close() {
+	p.ctxCancel()
+	p.wg.Wait()
+}
+
+func (p *Poller) run() {
+	defer p.wg.Done()
+
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+
+	// log only the first of consecutive errors
+	failing := false
+
+	for {
+		select {
+		case <-t.C:
+			_, err := Sync(p.ctx, p.src, p.cachePath)
+			if err != nil {
+				if p.ctx.Err() != nil {
+					return
+				}
+
+				if !failing {
+					p.parent.Log(logger.Warn, "%s; using the cached configuration", err)
+					failing = true
+				}
+				continue
+			}
+
+			if failing {
+				p.parent.Log(logger.Info, "configuration backend is reachable again")
+				failing = false
+			}
+
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
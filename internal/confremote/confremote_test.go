@@ -0,0 +1,188 @@
+package confremote
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+type nilParent struct{}
+
+func (nilParent) Log(logger.Level, string, ...interface{}) {}
+
+func TestIsRemote(t *testing.T) {
+	require.Equal(t, true, IsRemote("http://localhost/conf.yml"))
+	require.Equal(t, true, IsRemote("https://localhost/conf.yml"))
+	require.Equal(t, true, IsRemote("consul://localhost:8500/rtsp/conf"))
+	require.Equal(t, true, IsRemote("etcd://localhost:2379/rtsp/conf"))
+	require.Equal(t, false, IsRemote("rtsp-simple-server.yml"))
+	require.Equal(t, false, IsRemote("/etc/rtsp-simple-server.yml"))
+}
+
+func TestNewSourceErrors(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		url  string
+		err  string
+	}{
+		{
+			"unsupported",
+			"ftp://localhost/conf.yml",
+			"unsupported configuration backend: 'ftp'",
+		},
+		{
+			"missing key",
+			"consul://localhost:8500",
+			"key is missing in 'consul://localhost:8500'",
+		},
+		{
+			"missing host",
+			"etcd:///rtsp/conf",
+			"host is missing in 'etcd:///rtsp/conf'",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			_, err := NewSource(ca.url)
+			require.EqualError(t, err, ca.err)
+		})
+	}
+}
+
+func TestSourceFetch(t *testing.T) {
+	content := []byte("paths:\n  cam1:\n")
+
+	for _, ca := range []string{
+		"http",
+		"consul",
+		"etcd",
+	} {
+		t.Run(ca, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch ca {
+				case "http":
+					require.Equal(t, "/conf.yml", r.URL.Path)
+					w.Write(content)
+
+				case "consul":
+					require.Equal(t, "/v1/kv/rtsp/conf", r.URL.Path)
+					_, ok := r.URL.Query()["raw"]
+					require.Equal(t, true, ok)
+					require.Equal(t, "mytoken", r.Header.Get("X-Consul-Token"))
+					w.Write(content)
+
+				case "etcd":
+					require.Equal(t, "/v3/kv/range", r.URL.Path)
+					var req struct {
+						Key string `json:"key"`
+					}
+					err := json.NewDecoder(r.Body).Decode(&req)
+					require.NoError(t, err)
+					require.Equal(t, base64.StdEncoding.EncodeToString([]byte("/rtsp/conf")), req.Key)
+					json.NewEncoder(w).Encode(map[string]interface{}{
+						"kvs": []map[string]interface{}{{
+							"value": base64.StdEncoding.EncodeToString(content),
+						}},
+					})
+				}
+			}))
+			defer srv.Close()
+
+			host := strings.TrimPrefix(srv.URL, "http://")
+
+			var ur string
+			switch ca {
+			case "http":
+				ur = srv.URL + "/conf.yml"
+
+			case "consul":
+				os.Setenv("CONSUL_HTTP_TOKEN", "mytoken")
+				defer os.Unsetenv("CONSUL_HTTP_TOKEN")
+				ur = "consul://" + host + "/rtsp/conf"
+
+			case "etcd":
+				ur = "etcd://" + host + "/rtsp/conf"
+			}
+
+			src, err := NewSource(ur)
+			require.NoError(t, err)
+
+			byts, err := src.Fetch(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, content, byts)
+		})
+	}
+}
+
+func TestSync(t *testing.T) {
+	var mutex sync.Mutex
+	content := []byte("paths:\n  cam1:\n")
+	fail := false
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "rtsp-confremote")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cachePath := filepath.Join(dir, "cache.yml")
+
+	src, err := NewSource(srv.URL + "/conf.yml")
+	require.NoError(t, err)
+
+	written, err := Sync(context.Background(), src, cachePath)
+	require.NoError(t, err)
+	require.Equal(t, true, written)
+
+	// unchanged content is not written again
+	written, err = Sync(context.Background(), src, cachePath)
+	require.NoError(t, err)
+	require.Equal(t, false, written)
+
+	// the cache is preserved when the backend fails
+	mutex.Lock()
+	fail = true
+	mutex.Unlock()
+
+	_, err = Sync(context.Background(), src, cachePath)
+	require.EqualError(t, err, "unable to fetch configuration from "+srv.URL+"/conf.yml: bad status code: 500")
+
+	byts, err := ioutil.ReadFile(cachePath)
+	require.NoError(t, err)
+	require.Equal(t, content, byts)
+
+	// the poller updates the cache when the remote configuration changes
+	mutex.Lock()
+	fail = false
+	content = []byte("paths:\n  cam2:\n")
+	mutex.Unlock()
+
+	p := NewPoller(src, cachePath, 50*time.Millisecond, nilParent{})
+	defer p.Close()
+
+	require.Eventually(t, func() bool {
+		byts, err := ioutil.ReadFile(cachePath)
+		return err == nil && string(byts) == "paths:\n  cam2:\n"
+	}, 2*time.Second, 50*time.Millisecond)
+}
@@ -17,6 +17,8 @@ const (
 type ConfWatcher struct {
 	inner       *fsnotify.Watcher
 	watchedPath string
+	otherFiles  map[string]struct{}
+	otherDirs   map[string]struct{}
 
 	// out
 	signal chan struct{}
@@ -24,7 +26,9 @@ type ConfWatcher struct {
 }
 
 // New allocates a ConfWatcher.
-func New(confPath string) (*ConfWatcher, error) {
+// otherPaths are additional files and directories that contain parts of the configuration;
+// a change to any file inside a directory is reported.
+func New(confPath string, otherPaths ...string) (*ConfWatcher, error) {
 	if _, err := os.Stat(confPath); err != nil {
 		return nil, err
 	}
@@ -47,10 +51,34 @@ func New(confPath string) (*ConfWatcher, error) {
 	w := &ConfWatcher{
 		inner:       inner,
 		watchedPath: absolutePath,
+		otherFiles:  make(map[string]struct{}),
+		otherDirs:   make(map[string]struct{}),
 		signal:      make(chan struct{}),
 		done:        make(chan struct{}),
 	}
 
+	for _, pa := range otherPaths {
+		pa, _ = filepath.Abs(pa)
+
+		fi, err := os.Stat(pa)
+		if err != nil {
+			inner.Close()
+			return nil, err
+		}
+
+		if fi.IsDir() {
+			w.otherDirs[pa] = struct{}{}
+			err = inner.Add(pa)
+		} else {
+			w.otherFiles[pa] = struct{}{}
+			err = inner.Add(filepath.Dir(pa))
+		}
+		if err != nil {
+			inner.Close()
+			return nil, err
+		}
+	}
+
 	go w.run()
 
 	return w, nil
@@ -94,6 +122,11 @@ outer:
 				time.Sleep(additionalWait)
 				previousWatchedPath = currentWatchedPath
 
+				lastCalled = time.Now()
+				w.signal <- struct{}{}
+			} else if w.isOtherPath(eventPath) {
+				time.Sleep(additionalWait)
+
 				lastCalled = time.Now()
 				w.signal <- struct{}{}
 			}
@@ -106,6 +139,15 @@ outer:
 	close(w.signal)
 }
 
+func (w *ConfWatcher) isOtherPath(pa string) bool {
+	if _, ok := w.otherFiles[pa]; ok {
+		return true
+	}
+
+	_, ok := w.otherDirs[filepath.Dir(pa)]
+	return ok
+}
+
 // Watch returns a channel that is called after the configuration file has changed.
 func (w *ConfWatcher) Watch() chan struct{} {
 	return w.signal
@@ -3,6 +3,7 @@ package confwatcher
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -154,3 +155,53 @@ func TestSymlinkDeleteCreate(t *testing.T) {
 		return
 	}
 }
+
+func TestOtherPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "confwatcher-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "main.yml")
+	err = ioutil.WriteFile(fpath, []byte("{}"), 0o644)
+	require.NoError(t, err)
+
+	incpath := filepath.Join(dir, "include.yml")
+	err = ioutil.WriteFile(incpath, []byte("{}"), 0o644)
+	require.NoError(t, err)
+
+	pathsDir := filepath.Join(dir, "paths.d")
+	err = os.Mkdir(pathsDir, 0o755)
+	require.NoError(t, err)
+
+	w, err := New(fpath, incpath, pathsDir)
+	require.NoError(t, err)
+	defer w.Close()
+
+	for _, pa := range []string{
+		incpath,
+		filepath.Join(pathsDir, "cam1.yml"),
+	} {
+		err = ioutil.WriteFile(pa, []byte("{}"), 0o644)
+		require.NoError(t, err)
+
+		select {
+		case <-w.Watch():
+		case <-time.After(500 * time.Millisecond):
+			t.Errorf("timed out")
+			return
+		}
+
+		// wait for the minimum interval between signals
+		time.Sleep(minInterval)
+	}
+
+	// files that are not watched are ignored
+	err = ioutil.WriteFile(filepath.Join(dir, "other.yml"), []byte("{}"), 0o644)
+	require.NoError(t, err)
+
+	select {
+	case <-time.After(500 * time.Millisecond):
+	case <-w.Watch():
+		t.Errorf("should not happen")
+	}
+}
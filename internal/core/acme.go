@@ -0,0 +1,99 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/aler9/rtsp-simple-server/internal/autocert"
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+type acmeManagerParent interface {
+	Log(logger.Level, string, ...interface{})
+}
+
+// acmeManager obtains and renews certificates with the ACME protocol.
+// Challenges are solved with HTTP-01, through a dedicated HTTP listener,
+// and with TLS-ALPN-01, through the TLS listeners.
+type acmeManager struct {
+	parent acmeManagerParent
+
+	m      *autocert.Manager
+	ln     net.Listener
+	server *http.Server
+}
+
+func newACMEManager(
+	domains []string,
+	email string,
+	directory string,
+	httpAddress string,
+	cacheDir string,
+	parent acmeManagerParent,
+) (*acmeManager, error) {
+	ln, err := net.Listen("tcp", httpAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	am := &acmeManager{
+		parent: parent,
+		ln:     ln,
+	}
+
+	am.m, err = autocert.New(domains, email, directory, cacheDir, am)
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	// requests that are not challenges are answered with 404,
+	// since there's no HTTPS server to redirect them to.
+	am.server = &http.Server{
+		Handler: am.m.HTTPHandler(),
+	}
+
+	am.log(logger.Info, "listener opened on "+httpAddress+", certificates will be obtained for %v", domains)
+
+	go am.run()
+
+	return am, nil
+}
+
+func (am *acmeManager) close() {
+	am.m.Close()
+	am.server.Shutdown(context.Background())
+	am.log(logger.Info, "listener closed")
+}
+
+// Log is the main logging function.
+func (am *acmeManager) Log(level logger.Level, format string, args ...interface{}) {
+	am.log(level, format, args...)
+}
+
+func (am *acmeManager) log(level logger.Level, format string, args ...interface{}) {
+	am.parent.Log(level, "[ACME] "+format, args...)
+}
+
+func (am *acmeManager) run() {
+	err := am.server.Serve(am.ln)
+	if err != http.ErrServerClosed {
+		panic(err)
+	}
+}
+
+// tlsConfig returns a TLS configuration that uses the obtained certificates.
+func (am *acmeManager) tlsConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, err := am.m.GetCertificate(hello)
+			if err != nil {
+				am.log(logger.Warn, "unable to get a certificate for '%s': %s", hello.ServerName, err)
+			}
+			return cert, err
+		},
+		NextProtos: []string{autocert.ALPNProto},
+	}
+}
@@ -3,15 +3,18 @@ package core
 import (
 	"context"
 	"encoding/json"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"reflect"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/aler9/rtsp-simple-server/internal/conf"
+	"github.com/aler9/rtsp-simple-server/internal/cron"
 	"github.com/aler9/rtsp-simple-server/internal/logger"
 )
 
@@ -41,52 +44,117 @@ func cloneStruct(dest interface{}, source interface{}) {
 	_ = json.Unmarshal(enc, dest)
 }
 
+// apiConfData contains the general parameters that can be set with the API.
+type apiConfData struct {
+	// general
+	LogLevel                    *conf.LogLevel        `json:"logLevel"`
+	LogLevels                   *conf.LogLevels       `json:"logLevels"`
+	LogFormat                   *conf.LogFormat       `json:"logFormat"`
+	LogDestinations             *conf.LogDestinations `json:"logDestinations"`
+	LogFile                     *string               `json:"logFile"`
+	LogFileMaxSize              *int                  `json:"logFileMaxSize"`
+	LogFileMaxAge               *conf.StringDuration  `json:"logFileMaxAge"`
+	LogFileMaxBackups           *int                  `json:"logFileMaxBackups"`
+	LogFileCompress             *bool                 `json:"logFileCompress"`
+	LogSyslogAddress            *string               `json:"logSyslogAddress"`
+	AccessLog                   *bool                 `json:"accessLog"`
+	AccessLogFormat             *conf.AccessLogFormat `json:"accessLogFormat"`
+	AccessLogFile               *string               `json:"accessLogFile"`
+	AuditLog                    *bool                 `json:"auditLog"`
+	AuditLogFile                *string               `json:"auditLogFile"`
+	ReadTimeout                 *conf.StringDuration  `json:"readTimeout"`
+	WriteTimeout                *conf.StringDuration  `json:"writeTimeout"`
+	ReadBufferCount             *int                  `json:"readBufferCount"`
+	API                         *bool                 `json:"api"`
+	APIAddress                  *string               `json:"apiAddress"`
+	APIDashboard                *bool                 `json:"apiDashboard"`
+	Metrics                     *bool                 `json:"metrics"`
+	MetricsAddress              *string               `json:"metricsAddress"`
+	StatsD                      *bool                 `json:"statsd"`
+	StatsDAddress               *string               `json:"statsdAddress"`
+	StatsDPrefix                *string               `json:"statsdPrefix"`
+	StatsDTags                  *conf.StatsDTags      `json:"statsdTags"`
+	StatsDInterval              *conf.StringDuration  `json:"statsdInterval"`
+	PPROF                       *bool                 `json:"pprof"`
+	PPROFAddress                *string               `json:"pprofAddress"`
+	DebugImpairment             *bool                 `json:"debugImpairment"`
+	UnixSocketPermissions       *conf.FileMode        `json:"unixSocketPermissions"`
+	RunOnConnect                *string               `json:"runOnConnect"`
+	RunOnConnectRestart         *bool                 `json:"runOnConnectRestart"`
+	HookStdinJSON               *bool                 `json:"hookStdinJSON"`
+	DrainTimeout                *conf.StringDuration  `json:"drainTimeout"`
+	MaxConnections              *int                  `json:"maxConnections"`
+	MaxSessions                 *int                  `json:"maxSessions"`
+	ConnectionRate              *float64              `json:"connectionRate"`
+	ConnectionBurst             *int                  `json:"connectionBurst"`
+	EgressAccountingFile        *string               `json:"egressAccountingFile"`
+	EgressAccountingPeriod      *conf.StringDuration  `json:"egressAccountingPeriod"`
+	ReaderSheddingMemory        *int                  `json:"readerSheddingMemory"`
+	Registry                    *string               `json:"registry"`
+	RegistryInstanceURL         *string               `json:"registryInstanceURL"`
+	RegistryTTL                 *conf.StringDuration  `json:"registryTTL"`
+	IPv6Disable                 *bool                 `json:"ipv6Disable"`
+	ListenReusePort             *bool                 `json:"listenReusePort"`
+	ProxyProtocol               *bool                 `json:"proxyProtocol"`
+	ProxyProtocolTrustedProxies *conf.IPsOrNets       `json:"proxyProtocolTrustedProxies"`
+	GeoIPDatabase               *string               `json:"geoIPDatabase"`
+	ReadCountries               *conf.Countries       `json:"readCountries"`
+	PublishCountries            *conf.Countries       `json:"publishCountries"`
+
+	// RTSP
+	RTSPDisable        *bool                    `json:"rtspDisable"`
+	Protocols          *conf.Protocols          `json:"protocols"`
+	Encryption         *conf.Encryption         `json:"encryption"`
+	RTSPAddress        *string                  `json:"rtspAddress"`
+	RTSPSAddress       *string                  `json:"rtspsAddress"`
+	RTPAddress         *string                  `json:"rtpAddress"`
+	RTCPAddress        *string                  `json:"rtcpAddress"`
+	MulticastIPRange   *string                  `json:"multicastIPRange"`
+	MulticastRTPPort   *int                     `json:"multicastRTPPort"`
+	MulticastRTCPPort  *int                     `json:"multicastRTCPPort"`
+	ServerKey          *string                  `json:"serverKey"`
+	ServerCert         *string                  `json:"serverCert"`
+	ServerCertificates *conf.ServerCertificates `json:"serverCertificates"`
+	TLSMinVersion      *conf.TLSVersion         `json:"tlsMinVersion"`
+	TLSCipherSuites    *conf.TLSCipherSuites    `json:"tlsCipherSuites"`
+	TLSCurves          *conf.TLSCurves          `json:"tlsCurves"`
+	AuthMethods        *conf.AuthMethods        `json:"authMethods"`
+	ReadBufferSize     *int                     `json:"readBufferSize"`
+	ACME               *bool                    `json:"acme"`
+	ACMEDomains        *conf.Hostnames          `json:"acmeDomains"`
+	ACMEEmail          *string                  `json:"acmeEmail"`
+	ACMEDirectory      *string                  `json:"acmeDirectory"`
+	ACMEHTTPAddress    *string                  `json:"acmeHTTPAddress"`
+	ACMECacheDir       *string                  `json:"acmeCacheDir"`
+
+	// RTMP
+	RTMPDisable *bool   `json:"rtmpDisable"`
+	RTMPAddress *string `json:"rtmpAddress"`
+
+	// HLS
+	HLSDisable               *bool                `json:"hlsDisable"`
+	HLSAddress               *string              `json:"hlsAddress"`
+	HLSAlwaysRemux           *bool                `json:"hlsAlwaysRemux"`
+	HLSAlwaysRemuxCloseAfter *conf.StringDuration `json:"hlsAlwaysRemuxCloseAfter"`
+	HLSSegmentCount          *int                 `json:"hlsSegmentCount"`
+	HLSSegmentDuration       *conf.StringDuration `json:"hlsSegmentDuration"`
+	HLSAllowOrigin           *string              `json:"hlsAllowOrigin"`
+	HLSEncryption            *bool                `json:"hlsEncryption"`
+	HLSEncryptionKeyRotation *conf.StringDuration `json:"hlsEncryptionKeyRotation"`
+	HLSDirectory             *string              `json:"hlsDirectory"`
+	HLSPushURL               *string              `json:"hlsPushURL"`
+
+	// DLNA
+	DLNA             *bool   `json:"dlna"`
+	DLNAAddress      *string `json:"dlnaAddress"`
+	DLNAFriendlyName *string `json:"dlnaFriendlyName"`
+
+	// paths
+	PathsDir *string `json:"pathsDir"`
+}
+
 func loadConfData(ctx *gin.Context) (interface{}, error) {
-	var in struct {
-		// general
-		LogLevel            *conf.LogLevel        `json:"logLevel"`
-		LogDestinations     *conf.LogDestinations `json:"logDestinations"`
-		LogFile             *string               `json:"logFile"`
-		ReadTimeout         *conf.StringDuration  `json:"readTimeout"`
-		WriteTimeout        *conf.StringDuration  `json:"writeTimeout"`
-		ReadBufferCount     *int                  `json:"readBufferCount"`
-		API                 *bool                 `json:"api"`
-		APIAddress          *string               `json:"apiAddress"`
-		Metrics             *bool                 `json:"metrics"`
-		MetricsAddress      *string               `json:"metricsAddress"`
-		PPROF               *bool                 `json:"pprof"`
-		PPROFAddress        *string               `json:"pprofAddress"`
-		RunOnConnect        *string               `json:"runOnConnect"`
-		RunOnConnectRestart *bool                 `json:"runOnConnectRestart"`
-
-		// RTSP
-		RTSPDisable       *bool             `json:"rtspDisable"`
-		Protocols         *conf.Protocols   `json:"protocols"`
-		Encryption        *conf.Encryption  `json:"encryption"`
-		RTSPAddress       *string           `json:"rtspAddress"`
-		RTSPSAddress      *string           `json:"rtspsAddress"`
-		RTPAddress        *string           `json:"rtpAddress"`
-		RTCPAddress       *string           `json:"rtcpAddress"`
-		MulticastIPRange  *string           `json:"multicastIPRange"`
-		MulticastRTPPort  *int              `json:"multicastRTPPort"`
-		MulticastRTCPPort *int              `json:"multicastRTCPPort"`
-		ServerKey         *string           `json:"serverKey"`
-		ServerCert        *string           `json:"serverCert"`
-		AuthMethods       *conf.AuthMethods `json:"authMethods"`
-		ReadBufferSize    *int              `json:"readBufferSize"`
-
-		// RTMP
-		RTMPDisable *bool   `json:"rtmpDisable"`
-		RTMPAddress *string `json:"rtmpAddress"`
-
-		// HLS
-		HLSDisable         *bool                `json:"hlsDisable"`
-		HLSAddress         *string              `json:"hlsAddress"`
-		HLSAlwaysRemux     *bool                `json:"hlsAlwaysRemux"`
-		HLSSegmentCount    *int                 `json:"hlsSegmentCount"`
-		HLSSegmentDuration *conf.StringDuration `json:"hlsSegmentDuration"`
-		HLSAllowOrigin     *string              `json:"hlsAllowOrigin"`
-	}
+	var in apiConfData
 	err := json.NewDecoder(ctx.Request.Body).Decode(&in)
 	if err != nil {
 		return nil, err
@@ -95,40 +163,117 @@ func loadConfData(ctx *gin.Context) (interface{}, error) {
 	return in, err
 }
 
+// apiConfPathData contains the path parameters that can be set with the API.
+type apiConfPathData struct {
+	// source
+	Source                     *string                `json:"source"`
+	SourceProtocol             *conf.SourceProtocol   `json:"sourceProtocol"`
+	SourceAnyPortEnable        *bool                  `json:"sourceAnyPortEnable"`
+	SourceFingerprint          *string                `json:"sourceFingerprint"`
+	SourceParameterPassthrough *bool                  `json:"sourceParameterPassthrough"`
+	SourceBackchannel          *bool                  `json:"sourceBackchannel"`
+	SourceQueryParams          *conf.QueryParamNames  `json:"sourceQueryParams"`
+	SourceQuirks               *conf.Quirks           `json:"sourceQuirks"`
+	SourceOnDemand             *bool                  `json:"sourceOnDemand"`
+	SourceOnDemandStartTimeout *conf.StringDuration   `json:"sourceOnDemandStartTimeout"`
+	SourceOnDemandCloseAfter   *conf.StringDuration   `json:"sourceOnDemandCloseAfter"`
+	SourceRetryPause           *conf.StringDuration   `json:"sourceRetryPause"`
+	SourceRetryMaxPause        *conf.StringDuration   `json:"sourceRetryMaxPause"`
+	SourceRetryJitter          *int                   `json:"sourceRetryJitter"`
+	SourceRetryMaxCount        *int                   `json:"sourceRetryMaxCount"`
+	SourceInactivityTimeout    *conf.StringDuration   `json:"sourceInactivityTimeout"`
+	SourceOutageHold           *conf.StringDuration   `json:"sourceOutageHold"`
+	SourceRedirect             *string                `json:"sourceRedirect"`
+	DisablePublisherOverride   *bool                  `json:"disablePublisherOverride"`
+	Fallback                   *string                `json:"fallback"`
+	OnDemandDescribe           *conf.OnDemandDescribe `json:"onDemandDescribe"`
+	OnDemandDescribeTimeout    *conf.StringDuration   `json:"onDemandDescribeTimeout"`
+	InjectSilentAudio          *bool                  `json:"injectSilentAudio"`
+	InsertTimecodeSEI          *bool                  `json:"insertTimecodeSEI"`
+	ClockDriftCompensation     *bool                  `json:"clockDriftCompensation"`
+	FlexFEC                    *bool                  `json:"flexFEC"`
+	FlexFECGroupSize           *int                   `json:"flexFECGroupSize"`
+	StripRTPHeaderExtensions   *bool                  `json:"stripRTPHeaderExtensions"`
+	StripRTPPadding            *bool                  `json:"stripRTPPadding"`
+	SanitizeReaderSDP          *bool                  `json:"sanitizeReaderSDP"`
+	SAPAnnounce                *bool                  `json:"sapAnnounce"`
+	MulticastEncryption        *bool                  `json:"multicastEncryption"`
+	MulticastKeyRotation       *conf.StringDuration   `json:"multicastKeyRotation"`
+	MotionDetection            *bool                  `json:"motionDetection"`
+	MotionDetectionThreshold   *int                   `json:"motionDetectionThreshold"`
+	InferenceURL               *string                `json:"inferenceURL"`
+	InferenceInterval          *conf.StringDuration   `json:"inferenceInterval"`
+	ImpairmentLoss             *int                   `json:"impairmentLoss"`
+	ImpairmentReorder          *int                   `json:"impairmentReorder"`
+	ImpairmentLatency          *conf.StringDuration   `json:"impairmentLatency"`
+	V4L2Width                  *int                   `json:"v4l2Width"`
+	V4L2Height                 *int                   `json:"v4l2Height"`
+	V4L2FPS                    *int                   `json:"v4l2FPS"`
+	RPICameraWidth             *int                   `json:"rpiCameraWidth"`
+	RPICameraHeight            *int                   `json:"rpiCameraHeight"`
+	RPICameraFPS               *int                   `json:"rpiCameraFPS"`
+	RPICameraBitrate           *int                   `json:"rpiCameraBitrate"`
+	RPICameraRotation          *int                   `json:"rpiCameraRotation"`
+	TestsrcWidth               *int                   `json:"testsrcWidth"`
+	TestsrcHeight              *int                   `json:"testsrcHeight"`
+	TestsrcFPS                 *int                   `json:"testsrcFPS"`
+
+	// authentication
+	PublishUser      *conf.Credential `json:"publishUser"`
+	PublishPass      *conf.Credential `json:"publishPass"`
+	PublishStreamKey *conf.Credential `json:"publishStreamKey"`
+	PublishIPs       *conf.IPsOrNets  `json:"publishIPs"`
+	PublishCountries *conf.Countries  `json:"publishCountries"`
+	ReadUser         *conf.Credential `json:"readUser"`
+	ReadPass         *conf.Credential `json:"readPass"`
+	ReadIPs          *conf.IPsOrNets  `json:"readIPs"`
+	ReadCountries    *conf.Countries  `json:"readCountries"`
+
+	// custom commands
+	RunOnInit               *string              `json:"runOnInit"`
+	RunOnInitRestart        *bool                `json:"runOnInitRestart"`
+	RunOnDemand             *string              `json:"runOnDemand"`
+	RunOnDemandRestart      *bool                `json:"runOnDemandRestart"`
+	RunOnDemandStartTimeout *conf.StringDuration `json:"runOnDemandStartTimeout"`
+	RunOnDemandCloseAfter   *conf.StringDuration `json:"runOnDemandCloseAfter"`
+	RunOnPublish            *string              `json:"runOnPublish"`
+	RunOnPublishRestart     *bool                `json:"runOnPublishRestart"`
+	RunOnRead               *string              `json:"runOnRead"`
+	RunOnReadRestart        *bool                `json:"runOnReadRestart"`
+	RunOnSourceInactive     *string              `json:"runOnSourceInactive"`
+	RunOnMotion             *string              `json:"runOnMotion"`
+	RunOnRecord             *string              `json:"runOnRecord"`
+	RunOnRecordRestart      *bool                `json:"runOnRecordRestart"`
+	RecordSchedule          *string              `json:"recordSchedule"`
+
+	// timeouts and buffers
+	ReadTimeout     *conf.StringDuration `json:"readTimeout"`
+	WriteTimeout    *conf.StringDuration `json:"writeTimeout"`
+	ReadBufferCount *int                 `json:"readBufferCount"`
+
+	// congestion
+	ReaderPriorities *conf.ReaderPriorityRules `json:"readerPriorities"`
+	MaxReaders       *int                      `json:"maxReaders"`
+	MaxEgressBitrate *int                      `json:"maxEgressBitrate"`
+
+	// HLS
+	HLSDisable            *bool              `json:"hlsDisable"`
+	HLSAlwaysRemux        *conf.OptionalBool `json:"hlsAlwaysRemux"`
+	HLSAllowOrigin        *string            `json:"hlsAllowOrigin"`
+	HLSHeaders            *conf.HTTPHeaders  `json:"hlsHeaders"`
+	HLSAudioOnlyRendition *bool              `json:"hlsAudioOnlyRendition"`
+
+	// push
+	Push          *string          `json:"push"`
+	PushStreamKey *conf.Credential `json:"pushStreamKey"`
+	SRTOutput     *string          `json:"srtOutput"`
+
+	// log
+	LogLevel *conf.LogLevel `json:"logLevel"`
+}
+
 func loadConfPathData(ctx *gin.Context) (interface{}, error) {
-	var in struct {
-		// source
-		Source                     *string              `json:"source"`
-		SourceProtocol             *conf.SourceProtocol `json:"sourceProtocol"`
-		SourceAnyPortEnable        *bool                `json:"sourceAnyPortEnable"`
-		SourceFingerprint          *string              `json:"sourceFingerprint"`
-		SourceOnDemand             *bool                `json:"sourceOnDemand"`
-		SourceOnDemandStartTimeout *conf.StringDuration `json:"sourceOnDemandStartTimeout"`
-		SourceOnDemandCloseAfter   *conf.StringDuration `json:"sourceOnDemandCloseAfter"`
-		SourceRedirect             *string              `json:"sourceRedirect"`
-		DisablePublisherOverride   *bool                `json:"disablePublisherOverride"`
-		Fallback                   *string              `json:"fallback"`
-
-		// authentication
-		PublishUser *conf.Credential `json:"publishUser"`
-		PublishPass *conf.Credential `json:"publishPass"`
-		PublishIPs  *conf.IPsOrNets  `json:"publishIPs"`
-		ReadUser    *conf.Credential `json:"readUser"`
-		ReadPass    *conf.Credential `json:"readPass"`
-		ReadIPs     *conf.IPsOrNets  `json:"readIPs"`
-
-		// custom commands
-		RunOnInit               *string              `json:"runOnInit"`
-		RunOnInitRestart        *bool                `json:"runOnInitRestart"`
-		RunOnDemand             *string              `json:"runOnDemand"`
-		RunOnDemandRestart      *bool                `json:"runOnDemandRestart"`
-		RunOnDemandStartTimeout *conf.StringDuration `json:"runOnDemandStartTimeout"`
-		RunOnDemandCloseAfter   *conf.StringDuration `json:"runOnDemandCloseAfter"`
-		RunOnPublish            *string              `json:"runOnPublish"`
-		RunOnPublishRestart     *bool                `json:"runOnPublishRestart"`
-		RunOnRead               *string              `json:"runOnRead"`
-		RunOnReadRestart        *bool                `json:"runOnReadRestart"`
-	}
+	var in apiConfPathData
 	err := json.NewDecoder(ctx.Request.Body).Decode(&in)
 	if err != nil {
 		return nil, err
@@ -137,8 +282,37 @@ func loadConfPathData(ctx *gin.Context) (interface{}, error) {
 	return in, err
 }
 
+type apiPathsScheduleData struct {
+	RecordSchedule string `json:"recordSchedule"`
+}
+
+type apiLogLevelData struct {
+	Level      conf.LogLevel  `json:"level"`
+	Components conf.LogLevels `json:"components"`
+}
+
+type apiBansAddData struct {
+	IP       string              `json:"ip"`
+	ID       string              `json:"id"`
+	Duration conf.StringDuration `json:"duration"`
+}
+
+// apiRoute is a route of the API. Types of request and response bodies
+// are used to generate the schema of the API.
+type apiRoute struct {
+	method  string
+	path    string
+	handler gin.HandlerFunc
+	in      interface{}
+	out     interface{}
+}
+
 type apiPathManager interface {
 	onAPIPathsList(req pathAPIPathsListReq) pathAPIPathsListRes
+	onAPIPathsInfo(req pathAPIPathsInfoReq) pathAPIPathsInfoRes
+	onAPIPathsReaders(req pathAPIPathsReadersReq) pathAPIPathsReadersRes
+	onAPIPathsEnable(req pathAPIPathsEnableReq) pathAPIPathsEnableRes
+	onAPIPathsDisabledList() *pathAPIPathsDisabledListData
 }
 
 type apiRTSPServer interface {
@@ -157,7 +331,11 @@ type apiHLSServer interface {
 
 type apiParent interface {
 	Log(logger.Level, string, ...interface{})
+	LogAccess(logger.AccessEntry)
 	onAPIConfigSet(conf *conf.Conf)
+	onAPIDrain()
+	onAPILogLevelGet() apiLogLevelData
+	onAPILogLevelSet(data apiLogLevelData)
 }
 
 type api struct {
@@ -167,23 +345,33 @@ type api struct {
 	rtspsServer apiRTSPServer
 	rtmpServer  apiRTMPServer
 	hlsServer   apiHLSServer
+	bans        *banList
+	schedules   *recordSchedules
+	egress      *egressAccounting
 	parent      apiParent
 
-	mutex sync.Mutex
-	s     *http.Server
+	mutex  sync.Mutex
+	s      *http.Server
+	schema []byte
 }
 
 func newAPI(
 	address string,
+	ipv6Disable bool,
+	listenReusePort bool,
+	unixSocketPermissions conf.FileMode,
 	conf *conf.Conf,
 	pathManager apiPathManager,
 	rtspServer apiRTSPServer,
 	rtspsServer apiRTSPServer,
 	rtmpServer apiRTMPServer,
 	hlsServer apiHLSServer,
+	bans *banList,
+	schedules *recordSchedules,
+	egress *egressAccounting,
 	parent apiParent,
 ) (*api, error) {
-	ln, err := net.Listen("tcp", address)
+	ln, err := listen(address, ipv6Disable, listenReusePort, unixSocketPermissions)
 	if err != nil {
 		return nil, err
 	}
@@ -195,40 +383,85 @@ func newAPI(
 		rtspsServer: rtspsServer,
 		rtmpServer:  rtmpServer,
 		hlsServer:   hlsServer,
+		bans:        bans,
+		schedules:   schedules,
+		egress:      egress,
 		parent:      parent,
 	}
 
 	router := gin.New()
+	router.Use(httpAccessLog("API", parent))
 	router.NoRoute(a.mwLog)
 	group := router.Group("/", a.mwLog)
 
-	group.GET("/v1/config/get", a.onConfigGet)
-	group.POST("/v1/config/set", a.onConfigSet)
-	group.POST("/v1/config/paths/add/*name", a.onConfigPathsAdd)
-	group.POST("/v1/config/paths/edit/*name", a.onConfigPathsEdit)
-	group.POST("/v1/config/paths/remove/*name", a.onConfigPathsDelete)
+	if conf.APIDashboard {
+		group.GET("/dashboard", a.onDashboard)
+	}
+
+	routes := []apiRoute{
+		{http.MethodGet, "/v1/schema", a.onSchema, nil, nil},
 
-	group.GET("/v1/paths/list", a.onPathsList)
+		{http.MethodGet, "/v1/config/get", a.onConfigGet, nil, conf},
+		{http.MethodPost, "/v1/config/set", a.onConfigSet, apiConfData{}, nil},
+		{http.MethodGet, "/v1/config/export", a.onConfigExport, nil, conf},
+		{http.MethodPost, "/v1/config/import", a.onConfigImport, conf, nil},
+		{http.MethodPost, "/v1/config/paths/add/*name", a.onConfigPathsAdd, apiConfPathData{}, nil},
+		{http.MethodPost, "/v1/config/paths/edit/*name", a.onConfigPathsEdit, apiConfPathData{}, nil},
+		{http.MethodPost, "/v1/config/paths/remove/*name", a.onConfigPathsDelete, nil, nil},
+
+		{http.MethodPost, "/v1/drain", a.onDrain, nil, nil},
+
+		{http.MethodGet, "/v1/loglevel", a.onLogLevelGet, nil, apiLogLevelData{}},
+		{http.MethodPut, "/v1/loglevel", a.onLogLevelSet, apiLogLevelData{}, nil},
+
+		{http.MethodGet, "/v1/paths/list", a.onPathsList, nil, pathAPIPathsListData{}},
+		{http.MethodGet, "/v1/paths/info/*name", a.onPathsInfo, nil, pathAPIPathsInfoData{}},
+		{http.MethodGet, "/v1/paths/readers/*name", a.onPathsReaders, nil, pathAPIPathsReadersData{}},
+		{http.MethodPost, "/v1/paths/disable/*name", a.onPathsDisable, nil, nil},
+		{http.MethodPost, "/v1/paths/enable/*name", a.onPathsEnable, nil, nil},
+		{http.MethodGet, "/v1/paths/disabled/list", a.onPathsDisabledList, nil, pathAPIPathsDisabledListData{}},
+		{http.MethodPost, "/v1/paths/schedule/set/*name", a.onPathsScheduleSet, apiPathsScheduleData{}, nil},
+		{http.MethodPost, "/v1/paths/schedule/reset/*name", a.onPathsScheduleReset, nil, nil},
+
+		{http.MethodDelete, "/v1/sessions/:id", a.onSessionsKick, nil, nil},
+
+		{http.MethodGet, "/v1/bans/list", a.onBansList, nil, banListAPIData{}},
+		{http.MethodPost, "/v1/bans", a.onBansAdd, apiBansAddData{}, nil},
+		{http.MethodDelete, "/v1/bans/:ip", a.onBansRemove, nil, nil},
+
+		{http.MethodGet, "/v1/egress/list", a.onEgressList, nil, egressAccountingAPIData{}},
+		{http.MethodPost, "/v1/egress/reset/:user", a.onEgressReset, nil, nil},
+	}
 
 	if !interfaceIsEmpty(a.rtspServer) {
-		group.GET("/v1/rtspsessions/list", a.onRTSPSessionsList)
-		group.POST("/v1/rtspsessions/kick/:id", a.onRTSPSessionsKick)
+		routes = append(routes,
+			apiRoute{http.MethodGet, "/v1/rtspsessions/list", a.onRTSPSessionsList, nil, rtspServerAPISessionsListData{}},
+			apiRoute{http.MethodPost, "/v1/rtspsessions/kick/:id", a.onRTSPSessionsKick, nil, nil})
 	}
 
 	if !interfaceIsEmpty(a.rtspsServer) {
-		group.GET("/v1/rtspssessions/list", a.onRTSPSSessionsList)
-		group.POST("/v1/rtspssessions/kick/:id", a.onRTSPSSessionsKick)
+		routes = append(routes,
+			apiRoute{http.MethodGet, "/v1/rtspssessions/list", a.onRTSPSSessionsList, nil, rtspServerAPISessionsListData{}},
+			apiRoute{http.MethodPost, "/v1/rtspssessions/kick/:id", a.onRTSPSSessionsKick, nil, nil})
 	}
 
 	if !interfaceIsEmpty(a.rtmpServer) {
-		group.GET("/v1/rtmpconns/list", a.onRTMPConnsList)
-		group.POST("/v1/rtmpconns/kick/:id", a.onRTMPConnsKick)
+		routes = append(routes,
+			apiRoute{http.MethodGet, "/v1/rtmpconns/list", a.onRTMPConnsList, nil, rtmpServerAPIConnsListData{}},
+			apiRoute{http.MethodPost, "/v1/rtmpconns/kick/:id", a.onRTMPConnsKick, nil, nil})
 	}
 
 	if !interfaceIsEmpty(a.hlsServer) {
-		group.GET("/v1/hlsmuxers/list", a.onHLSMuxersList)
+		routes = append(routes,
+			apiRoute{http.MethodGet, "/v1/hlsmuxers/list", a.onHLSMuxersList, nil, hlsServerAPIMuxersListData{}})
+	}
+
+	for _, r := range routes {
+		group.Handle(r.method, r.path, r.handler)
 	}
 
+	a.schema = apiSchema(routes)
+
 	a.s = &http.Server{Handler: router}
 
 	go a.s.Serve(ln)
@@ -263,12 +496,16 @@ func (a *api) mwLog(ctx *gin.Context) {
 	a.log(logger.Debug, "[conn %v] [s->c] %s", ctx.Request.RemoteAddr, logw.dump())
 }
 
+func (a *api) onSchema(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "application/json", a.schema)
+}
+
 func (a *api) onConfigGet(ctx *gin.Context) {
 	a.mutex.Lock()
 	c := a.conf
 	a.mutex.Unlock()
 
-	ctx.JSON(http.StatusOK, c)
+	ctx.JSON(http.StatusOK, c.Redacted())
 }
 
 func (a *api) onConfigSet(ctx *gin.Context) {
@@ -300,6 +537,78 @@ func (a *api) onConfigSet(ctx *gin.Context) {
 	ctx.Status(http.StatusOK)
 }
 
+func (a *api) onConfigExport(ctx *gin.Context) {
+	a.mutex.Lock()
+	c := a.conf
+	a.mutex.Unlock()
+
+	ctx.Header("Content-Disposition", `attachment; filename="rtsp-simple-server.json"`)
+	ctx.JSON(http.StatusOK, c.Export())
+}
+
+func (a *api) onConfigImport(ctx *gin.Context) {
+	byts, err := ioutil.ReadAll(ctx.Request.Body)
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	newConf, err := conf.Import(byts, a.conf)
+	if err != nil {
+		a.log(logger.Warn, "unable to import the configuration: %s", err)
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	a.conf = newConf
+
+	// since reloading the configuration can cause the shutdown of the API,
+	// call it in a goroutine
+	go a.parent.onAPIConfigSet(newConf)
+
+	ctx.Status(http.StatusOK)
+}
+
+func (a *api) onDrain(ctx *gin.Context) {
+	go a.parent.onAPIDrain()
+
+	ctx.Status(http.StatusOK)
+}
+
+func (a *api) onLogLevelGet(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, a.parent.onAPILogLevelGet())
+}
+
+func (a *api) onLogLevelSet(ctx *gin.Context) {
+	var in apiLogLevelData
+	err := json.NewDecoder(ctx.Request.Body).Decode(&in)
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	if in.Level == 0 {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	err = in.Components.Check()
+	if err != nil {
+		a.log(logger.Warn, "%s", err)
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	// levels are applied to the running logger without reloading the configuration.
+	a.parent.onAPILogLevelSet(in)
+	a.log(logger.Info, "log levels changed")
+
+	ctx.Status(http.StatusOK)
+}
+
 func (a *api) onConfigPathsAdd(ctx *gin.Context) {
 	name := ctx.Param("name")
 	if len(name) < 2 || name[0] != '/' {
@@ -434,6 +743,126 @@ func (a *api) onPathsList(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, res.Data)
 }
 
+func (a *api) onPathsInfo(ctx *gin.Context) {
+	name := ctx.Param("name")
+	if len(name) < 2 || name[0] != '/' {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	name = name[1:]
+
+	res := a.pathManager.onAPIPathsInfo(pathAPIPathsInfoReq{Name: name})
+	if res.Err != nil {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, res.Data)
+}
+
+func (a *api) onPathsReaders(ctx *gin.Context) {
+	name := ctx.Param("name")
+	if len(name) < 2 || name[0] != '/' {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	name = name[1:]
+
+	res := a.pathManager.onAPIPathsReaders(pathAPIPathsReadersReq{Name: name})
+	if res.Err != nil {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, res.Data)
+}
+
+func (a *api) onPathsDisable(ctx *gin.Context) {
+	name := ctx.Param("name")
+	if len(name) < 2 || name[0] != '/' {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	name = name[1:]
+
+	res := a.pathManager.onAPIPathsEnable(pathAPIPathsEnableReq{Name: name, Disable: true})
+	if res.Err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (a *api) onPathsEnable(ctx *gin.Context) {
+	name := ctx.Param("name")
+	if len(name) < 2 || name[0] != '/' {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	name = name[1:]
+
+	res := a.pathManager.onAPIPathsEnable(pathAPIPathsEnableReq{Name: name})
+	if res.Err != nil {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (a *api) onPathsDisabledList(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, a.pathManager.onAPIPathsDisabledList())
+}
+
+func (a *api) onPathsScheduleSet(ctx *gin.Context) {
+	name := ctx.Param("name")
+	if len(name) < 2 || name[0] != '/' {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	name = name[1:]
+
+	var in apiPathsScheduleData
+	err := json.NewDecoder(ctx.Request.Body).Decode(&in)
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	if in.RecordSchedule != "" {
+		_, err := cron.Parse(in.RecordSchedule)
+		if err != nil {
+			a.log(logger.Warn, "invalid record schedule of path '%s': %s", name, err)
+			ctx.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+	}
+
+	a.schedules.set(name, in.RecordSchedule)
+	a.log(logger.Info, "record schedule of path '%s' set to '%s'", name, in.RecordSchedule)
+
+	ctx.Status(http.StatusOK)
+}
+
+func (a *api) onPathsScheduleReset(ctx *gin.Context) {
+	name := ctx.Param("name")
+	if len(name) < 2 || name[0] != '/' {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	name = name[1:]
+
+	if !a.schedules.reset(name) {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	a.log(logger.Info, "record schedule of path '%s' reset to the configuration", name)
+
+	ctx.Status(http.StatusOK)
+}
+
 func (a *api) onRTSPSessionsList(ctx *gin.Context) {
 	res := a.rtspServer.onAPISessionsList(rtspServerAPISessionsListReq{})
 	if res.Err != nil {
@@ -500,6 +929,144 @@ func (a *api) onRTMPConnsKick(ctx *gin.Context) {
 	ctx.Status(http.StatusOK)
 }
 
+// sessionsRemoteAddrs returns the remote addresses of RTSP sessions, RTSPS sessions
+// and RTMP connections, indexed by ID.
+func (a *api) sessionsRemoteAddrs() map[string]string {
+	ret := make(map[string]string)
+
+	for _, srv := range []apiRTSPServer{a.rtspServer, a.rtspsServer} {
+		if !interfaceIsEmpty(srv) {
+			res := srv.onAPISessionsList(rtspServerAPISessionsListReq{})
+			if res.Err == nil {
+				for id, item := range res.Data.Items {
+					ret[id] = item.RemoteAddr
+				}
+			}
+		}
+	}
+
+	if !interfaceIsEmpty(a.rtmpServer) {
+		res := a.rtmpServer.onAPIConnsList(rtmpServerAPIConnsListReq{})
+		if res.Err == nil {
+			for id, item := range res.Data.Items {
+				ret[id] = item.RemoteAddr
+			}
+		}
+	}
+
+	return ret
+}
+
+// kickSession closes a RTSP session, a RTSPS session or a RTMP connection.
+func (a *api) kickSession(id string) bool {
+	for _, srv := range []apiRTSPServer{a.rtspServer, a.rtspsServer} {
+		if !interfaceIsEmpty(srv) {
+			res := srv.onAPISessionsKick(rtspServerAPISessionsKickReq{ID: id})
+			if res.Err == nil {
+				return true
+			}
+		}
+	}
+
+	if !interfaceIsEmpty(a.rtmpServer) {
+		res := a.rtmpServer.onAPIConnsKick(rtmpServerAPIConnsKickReq{ID: id})
+		if res.Err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *api) onSessionsKick(ctx *gin.Context) {
+	if !a.kickSession(ctx.Param("id")) {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (a *api) onBansList(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, a.bans.apiList())
+}
+
+func (a *api) onBansAdd(ctx *gin.Context) {
+	var in apiBansAddData
+	err := json.NewDecoder(ctx.Request.Body).Decode(&in)
+	if err != nil || in.Duration <= 0 || (in.IP == "") == (in.ID == "") {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	sessions := a.sessionsRemoteAddrs()
+
+	var ip net.IP
+	if in.ID != "" {
+		addr, ok := sessions[in.ID]
+		if !ok {
+			ctx.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		tmp, _, _ := net.SplitHostPort(addr)
+		ip = net.ParseIP(tmp)
+	} else {
+		ip = net.ParseIP(in.IP)
+	}
+
+	if ip == nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	a.bans.ban(ip, time.Duration(in.Duration))
+	a.log(logger.Info, "IP %v banned for %v", ip, time.Duration(in.Duration))
+
+	// close the sessions that have already been opened by the IP
+	for id, addr := range sessions {
+		tmp, _, _ := net.SplitHostPort(addr)
+		if net.ParseIP(tmp).Equal(ip) {
+			a.kickSession(id)
+		}
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (a *api) onBansRemove(ctx *gin.Context) {
+	ip := net.ParseIP(ctx.Param("ip"))
+	if ip == nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	if !a.bans.unban(ip) {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	a.log(logger.Info, "ban of IP %v lifted", ip)
+
+	ctx.Status(http.StatusOK)
+}
+
+func (a *api) onEgressList(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, a.egress.apiList())
+}
+
+func (a *api) onEgressReset(ctx *gin.Context) {
+	user := ctx.Param("user")
+
+	if !a.egress.reset(user) {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	a.log(logger.Info, "egress counter of user '%s' reset", user)
+
+	ctx.Status(http.StatusOK)
+}
+
 func (a *api) onHLSMuxersList(ctx *gin.Context) {
 	res := a.hlsServer.onAPIHLSMuxersList(hlsServerAPIMuxersListReq{})
 	if res.Err != nil {
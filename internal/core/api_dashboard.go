@@ -0,0 +1,246 @@
+package core
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the dashboard is a static page that polls the API, therefore
+// it shows only informations that are available to API clients too.
+const apiDashboardPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>rtsp-simple-server</title>
+<style>
+body {
+	margin: 20px;
+	font: 14px sans-serif;
+	color: #222;
+	background: #f4f4f4;
+}
+h1 {
+	font-size: 20px;
+}
+table {
+	width: 100%;
+	border-collapse: collapse;
+	background: white;
+}
+th, td {
+	padding: 6px 8px;
+	border: 1px solid #ddd;
+	text-align: left;
+	vertical-align: top;
+}
+th {
+	background: #eee;
+}
+.ready {
+	color: #080;
+}
+.notready {
+	color: #a00;
+}
+.reader {
+	white-space: nowrap;
+}
+button {
+	margin-left: 6px;
+	font-size: 12px;
+}
+#error {
+	color: #a00;
+}
+</style>
+</head>
+<body>
+
+<h1>Paths</h1>
+<p id="error"></p>
+<table>
+	<thead>
+		<tr><th>Path</th><th>Source</th><th>Tracks</th><th>Readers</th></tr>
+	</thead>
+	<tbody id="paths"></tbody>
+</table>
+
+<script>
+
+const refreshPeriod = 2000;
+
+// sessions that can be kicked, with the API endpoints used to list and kick them.
+const kickable = {
+	rtspSession: 'rtspsessions',
+	rtspsSession: 'rtspssessions',
+	rtmpConn: 'rtmpconns',
+};
+
+const getJSON = (url) => fetch(url)
+	.then((res) => (res.status === 200) ? res.json() : { items: {} });
+
+const formatBitrate = (v) => (v / 1000).toFixed(0) + ' kbit/s';
+
+const describeTrack = (t) => {
+	let ret = t.codec;
+	if (t.width) {
+		ret += ' ' + t.width + 'x' + t.height;
+	}
+	if (t.fps) {
+		ret += ' ' + t.fps.toFixed(0) + 'fps';
+	}
+	if (t.sampleRate) {
+		ret += ' ' + t.sampleRate + 'Hz';
+	}
+	return ret + ', ' + formatBitrate(t.bitrate);
+};
+
+const kick = (type, id) => {
+	if (!confirm('Kick ' + type + ' ' + id + '?')) {
+		return;
+	}
+	fetch('/v1/' + kickable[type] + '/kick/' + id, { method: 'POST' })
+		.then(() => refresh());
+};
+
+const ban = (type, id) => {
+	const duration = prompt('Ban the IP of ' + type + ' ' + id + ' for:', '1h');
+	if (duration === null) {
+		return;
+	}
+	fetch('/v1/bans', {
+		method: 'POST',
+		headers: { 'Content-Type': 'application/json' },
+		body: JSON.stringify({ id: id, duration: duration }),
+	})
+		.then((res) => {
+			if (res.status !== 200) {
+				alert('unable to ban: status code ' + res.status);
+			}
+			refresh();
+		});
+};
+
+const cell = (row, content) => {
+	const td = document.createElement('td');
+	if (content !== undefined) {
+		td.textContent = content;
+	}
+	row.appendChild(td);
+	return td;
+};
+
+// appends a session to a cell, with its remote address and buttons to kick and ban it.
+const appendSession = (td, desc, sessions) => {
+	const div = document.createElement('div');
+	div.className = 'reader';
+
+	let text = desc.type;
+	if (desc.id !== undefined) {
+		text += ' ' + desc.id;
+		const s = sessions[desc.id];
+		if (s !== undefined) {
+			text += ' (' + s.remoteAddr + ')';
+		}
+	}
+	div.appendChild(document.createTextNode(text));
+
+	if (kickable[desc.type] !== undefined && desc.id !== undefined) {
+		const b = document.createElement('button');
+		b.textContent = 'kick';
+		b.onclick = () => kick(desc.type, desc.id);
+		div.appendChild(b);
+
+		const b2 = document.createElement('button');
+		b2.textContent = 'ban';
+		b2.onclick = () => ban(desc.type, desc.id);
+		div.appendChild(b2);
+	}
+
+	td.appendChild(div);
+};
+
+const render = (paths, infos, sessions) => {
+	const tbody = document.getElementById('paths');
+	tbody.innerHTML = '';
+
+	for (const name of Object.keys(paths).sort()) {
+		const p = paths[name];
+		const row = document.createElement('tr');
+
+		cell(row, name);
+
+		const source = cell(row);
+		if (p.source !== null) {
+			appendSession(source, p.source, sessions);
+		}
+		const state = document.createElement('div');
+		state.className = p.sourceReady ? 'ready' : 'notready';
+		state.textContent = p.sourceReady ? 'ready' : 'not ready';
+		if (p.sourceFailures > 0) {
+			state.textContent += ', ' + p.sourceFailures + ' failures';
+		}
+		source.appendChild(state);
+
+		const tracks = cell(row);
+		const info = infos[name];
+		if (info !== undefined) {
+			for (const t of info.tracks) {
+				const div = document.createElement('div');
+				div.textContent = describeTrack(t);
+				tracks.appendChild(div);
+			}
+		}
+
+		const readers = cell(row);
+		for (const r of p.readers) {
+			appendSession(readers, r, sessions);
+		}
+
+		tbody.appendChild(row);
+	}
+};
+
+const refresh = () => {
+	Promise.all([
+		getJSON('/v1/paths/list'),
+		getJSON('/v1/rtspsessions/list'),
+		getJSON('/v1/rtspssessions/list'),
+		getJSON('/v1/rtmpconns/list'),
+	])
+		.then(([paths, rtsp, rtsps, rtmp]) => {
+			const sessions = Object.assign({}, rtsp.items, rtsps.items, rtmp.items);
+
+			const ready = Object.keys(paths.items).filter((name) => paths.items[name].sourceReady);
+			return Promise.all(ready.map((name) => getJSON('/v1/paths/info/' + name)))
+				.then((res) => {
+					const infos = {};
+					ready.forEach((name, i) => {
+						if (res[i].tracks !== undefined) {
+							infos[name] = res[i];
+						}
+					});
+					render(paths.items, infos, sessions);
+					document.getElementById('error').textContent = '';
+				});
+		})
+		.catch((err) => {
+			document.getElementById('error').textContent = 'unable to contact the API: ' + err;
+		});
+};
+
+refresh();
+setInterval(refresh, refreshPeriod);
+
+</script>
+
+</body>
+</html>
+`
+
+func (a *api) onDashboard(ctx *gin.Context) {
+	ctx.Writer.Header().Set("Content-Type", "text/html")
+	ctx.Writer.WriteHeader(http.StatusOK)
+	ctx.Writer.Write([]byte(apiDashboardPage))
+}
@@ -0,0 +1,192 @@
+package core
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+var apiSchemaParamRegexp = regexp.MustCompile(`[:*]([a-z]+)`)
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// apiSchemaOfMarshaler returns the schema of a type that implements json.Marshaler,
+// by marshaling its zero value.
+func apiSchemaOfMarshaler(t reflect.Type) map[string]interface{} {
+	byts, err := json.Marshal(reflect.Zero(t).Interface())
+	if err != nil || len(byts) == 0 {
+		return map[string]interface{}{}
+	}
+
+	switch byts[0] {
+	case '"':
+		return map[string]interface{}{"type": "string"}
+
+	case '[':
+		return map[string]interface{}{"type": "array", "items": map[string]interface{}{}}
+
+	case '{':
+		return map[string]interface{}{"type": "object"}
+
+	case 't', 'f':
+		return map[string]interface{}{"type": "boolean"}
+
+	case 'n':
+		return map[string]interface{}{}
+	}
+
+	return map[string]interface{}{"type": "number"}
+}
+
+// apiSchemaOf returns the JSON schema of a Go type, as it is encoded by encoding/json.
+func apiSchemaOf(t reflect.Type, visiting map[reflect.Type]struct{}) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Implements(jsonMarshalerType) {
+		return apiSchemaOfMarshaler(t)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+
+	case reflect.Slice, reflect.Array:
+		// byte slices are encoded in base64
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string"}
+		}
+		return map[string]interface{}{"type": "array", "items": apiSchemaOf(t.Elem(), visiting)}
+
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": apiSchemaOf(t.Elem(), visiting)}
+
+	case reflect.Struct:
+		// recursive types are not expanded
+		if _, ok := visiting[t]; ok {
+			return map[string]interface{}{"type": "object"}
+		}
+		visiting[t] = struct{}{}
+		defer delete(visiting, t)
+
+		props := make(map[string]interface{})
+		apiSchemaAddFields(t, props, visiting)
+		return map[string]interface{}{"type": "object", "properties": props}
+	}
+
+	return map[string]interface{}{}
+}
+
+func apiSchemaAddFields(t reflect.Type, props map[string]interface{}, visiting map[reflect.Type]struct{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		// fields of embedded structs are promoted
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				apiSchemaAddFields(ft, props, visiting)
+				continue
+			}
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		props[name] = apiSchemaOf(f.Type, visiting)
+	}
+}
+
+// apiSchema generates the OpenAPI schema of the API from its routes.
+func apiSchema(routes []apiRoute) []byte {
+	paths := make(map[string]interface{})
+
+	for _, r := range routes {
+		path := apiSchemaParamRegexp.ReplaceAllString(r.path, "{$1}")
+
+		op := make(map[string]interface{})
+
+		var params []interface{}
+		for _, m := range apiSchemaParamRegexp.FindAllStringSubmatch(r.path, -1) {
+			params = append(params, map[string]interface{}{
+				"name":     m[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+
+		if r.in != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": apiSchemaOf(reflect.TypeOf(r.in), make(map[reflect.Type]struct{})),
+					},
+				},
+			}
+		}
+
+		res := map[string]interface{}{
+			"description": "the request was successful.",
+		}
+		if r.out != nil {
+			res["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": apiSchemaOf(reflect.TypeOf(r.out), make(map[reflect.Type]struct{})),
+				},
+			}
+		}
+		op["responses"] = map[string]interface{}{
+			"200": res,
+			"400": map[string]interface{}{"description": "invalid request."},
+			"404": map[string]interface{}{"description": "the requested entity was not found."},
+		}
+
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[path] = item
+		}
+		item[strings.ToLower(r.method)] = op
+	}
+
+	byts, _ := json.Marshal(map[string]interface{}{
+		"openapi": "3.0.0",
+		"info": map[string]interface{}{
+			"title":   "rtsp-simple-server API",
+			"version": version,
+		},
+		"paths": paths,
+	})
+	return byts
+}
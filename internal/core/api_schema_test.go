@@ -0,0 +1,88 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+)
+
+func TestAPISchemaOf(t *testing.T) {
+	type embedded struct {
+		Embedded string `json:"embedded"`
+	}
+
+	type node struct {
+		embedded
+		Name     string              `json:"name"`
+		Count    *int                `json:"count"`
+		Ratio    float64             `json:"ratio"`
+		Duration conf.StringDuration `json:"duration"`
+		Created  time.Time           `json:"created"`
+		Items    []string            `json:"items"`
+		Data     []byte              `json:"data"`
+		Attrs    map[string]bool     `json:"attrs"`
+		Children []*node             `json:"children"`
+		Ignored  string              `json:"-"`
+		NoTag    bool
+	}
+
+	s := apiSchemaOf(reflect.TypeOf(node{}), make(map[reflect.Type]struct{}))
+	require.Equal(t, map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"embedded": map[string]interface{}{"type": "string"},
+			"name":     map[string]interface{}{"type": "string"},
+			"count":    map[string]interface{}{"type": "integer"},
+			"ratio":    map[string]interface{}{"type": "number"},
+			"duration": map[string]interface{}{"type": "string"},
+			"created":  map[string]interface{}{"type": "string"},
+			"items": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string"},
+			},
+			"data": map[string]interface{}{"type": "string"},
+			"attrs": map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": map[string]interface{}{"type": "boolean"},
+			},
+			"children": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "object"},
+			},
+			"NoTag": map[string]interface{}{"type": "boolean"},
+		},
+	}, s)
+}
+
+func TestAPISchemaPaths(t *testing.T) {
+	byts := apiSchema([]apiRoute{
+		{http.MethodGet, "/v1/paths/info/*name", nil, nil, pathAPIPathsInfoData{}},
+		{http.MethodDelete, "/v1/bans/:ip", nil, nil, nil},
+		{http.MethodPost, "/v1/bans", nil, apiBansAddData{}, nil},
+	})
+
+	var out struct {
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				Name string `json:"name"`
+				In   string `json:"in"`
+			} `json:"parameters"`
+			RequestBody *struct{} `json:"requestBody"`
+		} `json:"paths"`
+	}
+	err := json.Unmarshal(byts, &out)
+	require.NoError(t, err)
+
+	require.Len(t, out.Paths, 3)
+	require.Equal(t, "name", out.Paths["/v1/paths/info/{name}"]["get"].Parameters[0].Name)
+	require.Equal(t, "path", out.Paths["/v1/paths/info/{name}"]["get"].Parameters[0].In)
+	require.Equal(t, "ip", out.Paths["/v1/bans/{ip}"]["delete"].Parameters[0].Name)
+	require.NotNil(t, out.Paths["/v1/bans"]["post"].RequestBody)
+	require.Nil(t, out.Paths["/v1/bans"]["post"].Parameters)
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+// auditor receives authentication and authorization decisions,
+// counts them by outcome and writes them into the audit log, if it is enabled.
+// It survives configuration reloads, in order to preserve counters.
+type auditor struct {
+	mutex     sync.Mutex
+	log       *logger.AuditLog
+	successes int64
+	failures  int64
+}
+
+func newAuditor() *auditor {
+	return &auditor{}
+}
+
+// setLog sets the audit log. nil disables it.
+func (a *auditor) setLog(l *logger.AuditLog) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.log = l
+}
+
+func (a *auditor) audit(e logger.AuditEntry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if e.Outcome == logger.AuditSuccess {
+		a.successes++
+	} else {
+		a.failures++
+	}
+
+	if a.log != nil {
+		a.log.Log(e)
+	}
+}
+
+// outcomes returns the number of successful and failed decisions.
+func (a *auditor) outcomes() (int64, int64) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.successes, a.failures
+}
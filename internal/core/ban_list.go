@@ -0,0 +1,87 @@
+package core
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+type banListAPIItem struct {
+	Expires time.Time `json:"expires"`
+}
+
+type banListAPIData struct {
+	Items map[string]banListAPIItem `json:"items"`
+}
+
+// banList contains the IPs that have been banned through the API.
+// It is shared by all servers and survives configuration reloads,
+// in order not to lift bans when servers are restarted.
+type banList struct {
+	mutex sync.Mutex
+	bans  map[string]time.Time
+}
+
+func newBanList() *banList {
+	return &banList{
+		bans: make(map[string]time.Time),
+	}
+}
+
+// ban bans an IP for the given duration.
+func (b *banList) ban(ip net.IP, duration time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.bans[ip.String()] = time.Now().Add(duration)
+}
+
+// unban lifts the ban of an IP. It returns false if the IP is not banned.
+func (b *banList) unban(ip net.IP) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.removeExpired()
+
+	key := ip.String()
+	if _, ok := b.bans[key]; !ok {
+		return false
+	}
+
+	delete(b.bans, key)
+	return true
+}
+
+// isBanned checks whether an IP is banned.
+func (b *banList) isBanned(ip net.IP) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.removeExpired()
+
+	_, ok := b.bans[ip.String()]
+	return ok
+}
+
+// apiList returns the bans that have not expired yet.
+func (b *banList) apiList() *banListAPIData {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.removeExpired()
+
+	data := &banListAPIData{
+		Items: make(map[string]banListAPIItem),
+	}
+
+	for ip, expires := range b.bans {
+		data.Items[ip] = banListAPIItem{Expires: expires}
+	}
+
+	return data
+}
+
+func (b *banList) removeExpired() {
+	now := time.Now()
+	for ip, expires := range b.bans {
+		if !now.Before(expires) {
+			delete(b.bans, ip)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package core
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBanList(t *testing.T) {
+	b := newBanList()
+
+	ip1 := net.ParseIP("192.168.0.1")
+	ip2 := net.ParseIP("192.168.0.2")
+
+	b.ban(ip1, 1*time.Hour)
+	b.ban(ip2, 100*time.Millisecond)
+	require.Equal(t, true, b.isBanned(ip1))
+	require.Equal(t, true, b.isBanned(ip2))
+	require.Equal(t, false, b.isBanned(net.ParseIP("192.168.0.3")))
+	require.Equal(t, 2, len(b.apiList().Items))
+
+	// an IPv4 address can be written in the IPv6 form too
+	require.Equal(t, true, b.isBanned(net.ParseIP("::ffff:192.168.0.1")))
+
+	time.Sleep(200 * time.Millisecond)
+	require.Equal(t, false, b.isBanned(ip2))
+	require.Equal(t, 1, len(b.apiList().Items))
+
+	require.Equal(t, true, b.unban(ip1))
+	require.Equal(t, false, b.unban(ip1))
+	require.Equal(t, false, b.isBanned(ip1))
+}
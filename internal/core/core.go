@@ -2,23 +2,35 @@ package core
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"os"
 	"os/signal"
 	"reflect"
+	"sort"
+	"syscall"
+	"time"
 
 	"github.com/aler9/gortsplib"
 	"github.com/gin-gonic/gin"
 	"gopkg.in/alecthomas/kingpin.v2"
 
+	"github.com/aler9/rtsp-simple-server/internal/certloader"
 	"github.com/aler9/rtsp-simple-server/internal/conf"
+	"github.com/aler9/rtsp-simple-server/internal/confremote"
 	"github.com/aler9/rtsp-simple-server/internal/confwatcher"
 	"github.com/aler9/rtsp-simple-server/internal/logger"
+	"github.com/aler9/rtsp-simple-server/internal/registry"
 	"github.com/aler9/rtsp-simple-server/internal/rlimit"
+	"github.com/aler9/rtsp-simple-server/internal/sdnotify"
 )
 
 var version = "v0.0.0"
 
+const (
+	drainCheckPeriod = 500 * time.Millisecond
+)
+
 // Core is an instance of rtsp-simple-server.
 type Core struct {
 	ctx         context.Context
@@ -27,19 +39,38 @@ type Core struct {
 	conf        *conf.Conf
 	confFound   bool
 	logger      *logger.Logger
+	accessLog   *logger.AccessLog
+	auditLog    *logger.AuditLog
+	auditor     *auditor
 	metrics     *metrics
+	statsd      *statsd
 	pprof       *pprof
+	registry    *registry.Registry
+	limiter     *limiter
+	bans        *banList
+	disabled    *disabledPaths
+	schedules   *recordSchedules
+	quotas      *quotas
+	geoIP       *geoIPPolicy
+	egress      *egressAccounting
+	shedding    *readerShedding
+	acmeManager *acmeManager
+	certLoader  *certloader.CertLoader
 	pathManager *pathManager
 	rtspServer  *rtspServer
 	rtspsServer *rtspServer
 	rtmpServer  *rtmpServer
 	hlsServer   *hlsServer
 	hikkaServer *hikkaServer
+	dlnaServer  *dlnaServer
 	api         *api
 	confWatcher *confwatcher.ConfWatcher
+	confPoller  *confremote.Poller
+	draining    bool
 
 	// in
 	apiConfigSet chan *conf.Conf
+	apiDrain     chan struct{}
 
 	// out
 	done chan struct{}
@@ -51,8 +82,14 @@ func New(args []string) (*Core, bool) {
 		"rtsp-simple-server "+version+"\n\nRTSP server.")
 
 	argVersion := k.Flag("version", "print version").Bool()
-	argConfPath := k.Arg("confpath", "path to a config file. The default is rtsp-simple-server.yml.").
+	argCheckConfig := k.Flag("check-config", "check the configuration for errors and exit.").Bool()
+	argConfPath := k.Arg("confpath", "path to a config file. The default is rtsp-simple-server.yml. "+
+		"It can also be the URL of a remote configuration (http://, https://, consul://, etcd://).").
 		Default("rtsp-simple-server.yml").String()
+	argConfCache := k.Flag("confcache", "local copy of a remote configuration, used when the backend is unreachable.").
+		Default("rtsp-simple-server-remote.yml").String()
+	argConfPoll := k.Flag("confpoll", "how often a remote configuration is checked for changes.").
+		Default("10s").Duration()
 
 	kingpin.MustParse(k.Parse(args))
 
@@ -75,9 +112,39 @@ func New(args []string) (*Core, bool) {
 		ctxCancel:    ctxCancel,
 		confPath:     *argConfPath,
 		apiConfigSet: make(chan *conf.Conf),
+		apiDrain:     make(chan struct{}),
 		done:         make(chan struct{}),
 	}
 
+	// a remote configuration is downloaded into a local file,
+	// that is then loaded and watched like a regular configuration file.
+	var confRemote *confremote.Source
+	var confRemoteErr error
+	if confremote.IsRemote(p.confPath) {
+		if *argConfPoll <= 0 {
+			fmt.Printf("ERR: invalid confpoll: %s\n", *argConfPoll)
+			return nil, false
+		}
+
+		var err error
+		confRemote, err = confremote.NewSource(p.confPath)
+		if err != nil {
+			fmt.Printf("ERR: %s\n", err)
+			return nil, false
+		}
+
+		_, confRemoteErr = confremote.Sync(ctx, confRemote, *argConfCache)
+		if confRemoteErr != nil {
+			// the cached configuration is not the one to be checked
+			if _, err := os.Stat(*argConfCache); err != nil || *argCheckConfig {
+				fmt.Printf("ERR: %s\n", confRemoteErr)
+				return nil, false
+			}
+		}
+
+		p.confPath = *argConfCache
+	}
+
 	var err error
 	p.conf, p.confFound, err = conf.Load(p.confPath)
 	if err != nil {
@@ -85,6 +152,21 @@ func New(args []string) (*Core, bool) {
 		return nil, false
 	}
 
+	if *argCheckConfig {
+		err = p.conf.CheckFiles()
+		if err != nil {
+			fmt.Printf("ERR: %s\n", err)
+			return nil, false
+		}
+
+		if !p.confFound {
+			fmt.Println("configuration file not found, the default configuration is valid")
+		} else {
+			fmt.Println("configuration is valid")
+		}
+		os.Exit(0)
+	}
+
 	err = p.createResources(true)
 	if err != nil {
 		if p.logger != nil {
@@ -96,8 +178,15 @@ func New(args []string) (*Core, bool) {
 		return nil, false
 	}
 
+	if confRemote != nil {
+		if confRemoteErr != nil {
+			p.Log(logger.Warn, "%s; using the cached configuration", confRemoteErr)
+		}
+		p.Log(logger.Info, "configuration loaded from %s", confRemote)
+	}
+
 	if p.confFound {
-		p.confWatcher, err = confwatcher.New(p.confPath)
+		p.confWatcher, err = confwatcher.New(p.confPath, p.conf.WatchedPaths()...)
 		if err != nil {
 			p.Log(logger.Error, "%s", err)
 			p.closeResources(nil, false)
@@ -105,6 +194,10 @@ func New(args []string) (*Core, bool) {
 		}
 	}
 
+	if confRemote != nil {
+		p.confPoller = confremote.NewPoller(confRemote, p.confPath, *argConfPoll, p)
+	}
+
 	go p.run()
 
 	return p, true
@@ -115,6 +208,11 @@ func (p *Core) close() {
 	<-p.done
 }
 
+// Close closes the Core and waits for it to exit.
+func (p *Core) Close() {
+	p.close()
+}
+
 // Wait waits for the Core to exit.
 func (p *Core) Wait() {
 	<-p.done
@@ -125,6 +223,18 @@ func (p *Core) Log(level logger.Level, format string, args ...interface{}) {
 	p.logger.Log(level, format, args...)
 }
 
+// LogAccess writes an entry into the access log, if it is enabled.
+func (p *Core) LogAccess(e logger.AccessEntry) {
+	if p.accessLog != nil {
+		p.accessLog.Log(e)
+	}
+}
+
+// LogAudit records an authentication or authorization decision.
+func (p *Core) LogAudit(e logger.AuditEntry) {
+	p.auditor.audit(e)
+}
+
 func (p *Core) run() {
 	defer close(p.done)
 
@@ -138,11 +248,43 @@ func (p *Core) run() {
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
 
+	terminate := make(chan os.Signal, 1)
+	signal.Notify(terminate, syscall.SIGTERM)
+
+	// the watchdog is notified by this loop, in order to let the
+	// service manager restart the server when the loop hangs.
+	var watchdog <-chan time.Time
+	if interval := sdnotify.WatchdogInterval(); interval > 0 {
+		t := time.NewTicker(interval / 2)
+		defer t.Stop()
+		watchdog = t.C
+	}
+
+	sdnotify.Notify(sdnotify.Ready)
+
+	// channels are nil, and therefore never selected, until draining starts
+	var drainTicker *time.Ticker
+	var drainCheck <-chan time.Time
+	var drainDeadline <-chan time.Time
+
+	startDrain := func(reason string) {
+		p.Log(logger.Info, "draining (%s); waiting up to %v for sessions to end",
+			reason, time.Duration(p.conf.DrainTimeout))
+
+		p.draining = true
+		p.applyDrain()
+
+		drainTicker = time.NewTicker(drainCheckPeriod)
+		drainCheck = drainTicker.C
+		drainDeadline = time.After(time.Duration(p.conf.DrainTimeout))
+	}
+
 outer:
 	for {
 		select {
 		case <-confChanged:
 			p.Log(logger.Info, "reloading configuration (file changed)")
+			sdnotify.Notify(sdnotify.Reloading)
 
 			newConf, _, err := conf.Load(p.confPath)
 			if err != nil {
@@ -150,14 +292,32 @@ outer:
 				break outer
 			}
 
+			watchedPathsChanged := !reflect.DeepEqual(newConf.WatchedPaths(), p.conf.WatchedPaths())
+
 			err = p.reloadConf(newConf, false)
 			if err != nil {
 				p.Log(logger.Error, "%s", err)
 				break outer
 			}
 
+			// included files have been added or removed
+			if watchedPathsChanged {
+				p.confWatcher.Close()
+
+				p.confWatcher, err = confwatcher.New(p.confPath, p.conf.WatchedPaths()...)
+				if err != nil {
+					p.Log(logger.Error, "%s", err)
+					break outer
+				}
+
+				confChanged = p.confWatcher.Watch()
+			}
+
+			sdnotify.Notify(sdnotify.Ready)
+
 		case newConf := <-p.apiConfigSet:
 			p.Log(logger.Info, "reloading configuration (API request)")
+			sdnotify.Notify(sdnotify.Reloading)
 
 			err := p.reloadConf(newConf, true)
 			if err != nil {
@@ -165,17 +325,54 @@ outer:
 				break outer
 			}
 
+			sdnotify.Notify(sdnotify.Ready)
+
 		case <-interrupt:
 			p.Log(logger.Info, "shutting down gracefully")
 			break outer
 
+		case <-terminate:
+			if p.draining {
+				p.Log(logger.Info, "shutting down without waiting for sessions to end")
+				break outer
+			}
+			startDrain("SIGTERM received")
+
+		case <-p.apiDrain:
+			if !p.draining {
+				startDrain("API request")
+			}
+
+		case <-drainCheck:
+			if p.activeSessions() == 0 {
+				p.Log(logger.Info, "all sessions ended, shutting down")
+				break outer
+			}
+
+		case <-drainDeadline:
+			p.Log(logger.Info, "drain timeout reached, shutting down")
+			break outer
+
+		case <-watchdog:
+			sdnotify.Notify(sdnotify.Watchdog)
+
 		case <-p.ctx.Done():
 			break outer
 		}
 	}
 
+	sdnotify.Notify(sdnotify.Stopping)
+
 	p.ctxCancel()
 
+	if drainTicker != nil {
+		drainTicker.Stop()
+	}
+
+	if p.confPoller != nil {
+		p.confPoller.Close()
+	}
+
 	p.closeResources(nil, false)
 
 	if p.confWatcher != nil {
@@ -183,19 +380,93 @@ outer:
 	}
 }
 
+// logLevelOverrides returns the log levels of the components and paths
+// that don't use the global one.
+func logLevelOverrides(cnf *conf.Conf) logger.LevelOverrides {
+	var ret logger.LevelOverrides
+
+	if len(cnf.LogLevels) != 0 {
+		ret.Components = make(map[string]logger.Level)
+		for name, level := range cnf.LogLevels {
+			ret.Components[name] = logger.Level(level)
+		}
+	}
+
+	// sort paths in order to make the result comparable
+	var names []string
+	for name, pconf := range cnf.Paths {
+		if pconf.LogLevel != 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		pconf := cnf.Paths[name]
+		ret.Paths = append(ret.Paths, logger.PathLevel{
+			Name:   name,
+			Regexp: pconf.Regexp,
+			Level:  logger.Level(pconf.LogLevel),
+		})
+	}
+
+	return ret
+}
+
 func (p *Core) createResources(initial bool) error {
 	var err error
 
 	if p.logger == nil {
 		p.logger, err = logger.New(
 			logger.Level(p.conf.LogLevel),
+			logLevelOverrides(p.conf),
+			logger.Format(p.conf.LogFormat),
 			p.conf.LogDestinations,
-			p.conf.LogFile)
+			p.conf.LogFile,
+			logger.FileRotation{
+				MaxSize:    int64(p.conf.LogFileMaxSize) * 1024 * 1024,
+				MaxAge:     time.Duration(p.conf.LogFileMaxAge),
+				MaxBackups: p.conf.LogFileMaxBackups,
+				Compress:   p.conf.LogFileCompress,
+			},
+			p.conf.LogSyslogAddress)
 		if err != nil {
 			return err
 		}
 	}
 
+	if p.conf.AccessLog {
+		if p.accessLog == nil {
+			p.accessLog, err = logger.NewAccessLog(
+				logger.AccessFormat(p.conf.AccessLogFormat),
+				p.conf.AccessLogFile,
+				logger.FileRotation{
+					MaxSize:    int64(p.conf.LogFileMaxSize) * 1024 * 1024,
+					MaxAge:     time.Duration(p.conf.LogFileMaxAge),
+					MaxBackups: p.conf.LogFileMaxBackups,
+					Compress:   p.conf.LogFileCompress,
+				})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// the auditor is never recreated, in order to preserve counters
+	if p.auditor == nil {
+		p.auditor = newAuditor()
+	}
+
+	if p.conf.AuditLog {
+		if p.auditLog == nil {
+			p.auditLog, err = logger.NewAuditLog(p.conf.AuditLogFile)
+			if err != nil {
+				return err
+			}
+			p.auditor.setLog(p.auditLog)
+		}
+	}
+
 	if initial {
 		p.Log(logger.Info, "rtsp-simple-server %s", version)
 		if !p.confFound {
@@ -207,6 +478,23 @@ func (p *Core) createResources(initial bool) error {
 		if p.metrics == nil {
 			p.metrics, err = newMetrics(
 				p.conf.MetricsAddress,
+				p.conf.IPv6Disable,
+				p.conf.ListenReusePort,
+				p.conf.UnixSocketPermissions,
+				p)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if p.conf.StatsD {
+		if p.statsd == nil {
+			p.statsd, err = newStatsD(
+				p.conf.StatsDAddress,
+				p.conf.StatsDPrefix,
+				p.conf.StatsDTags,
+				p.conf.StatsDInterval,
 				p)
 			if err != nil {
 				return err
@@ -218,6 +506,9 @@ func (p *Core) createResources(initial bool) error {
 		if p.pprof == nil {
 			p.pprof, err = newPPROF(
 				p.conf.PPROFAddress,
+				p.conf.IPv6Disable,
+				p.conf.ListenReusePort,
+				p.conf.UnixSocketPermissions,
 				p)
 			if err != nil {
 				return err
@@ -225,6 +516,75 @@ func (p *Core) createResources(initial bool) error {
 		}
 	}
 
+	if p.conf.Registry != "" {
+		if p.registry == nil {
+			p.registry, err = registry.New(
+				p.conf.Registry,
+				p.conf.RegistryInstanceURL,
+				time.Duration(p.conf.RegistryTTL),
+				p)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// the limiter is never recreated, in order to preserve counters
+	if p.limiter == nil {
+		p.limiter = newLimiter()
+	}
+	p.limiter.setLimits(p.conf.MaxConnections, p.conf.MaxSessions)
+	p.limiter.setConnectionRate(p.conf.ConnectionRate, p.conf.ConnectionBurst)
+
+	// the ban list is never recreated, in order to preserve bans
+	if p.bans == nil {
+		p.bans = newBanList()
+	}
+
+	// disabled paths are never recreated, in order to keep paths disabled
+	if p.disabled == nil {
+		p.disabled = newDisabledPaths()
+	}
+
+	// record schedules are never recreated, in order to keep schedules set through the API
+	if p.schedules == nil {
+		p.schedules = newRecordSchedules()
+	}
+
+	// quotas are never recreated, in order to preserve counters
+	if p.quotas == nil {
+		p.quotas = newQuotas()
+	}
+	p.quotas.setTenants(p.conf.Tenants)
+
+	// the GeoIP policy is never recreated, in order to preserve counters
+	if p.geoIP == nil {
+		p.geoIP = newGeoIPPolicy()
+	}
+	err = p.geoIP.setDatabase(p.conf.GeoIPDatabase)
+	if err != nil {
+		return err
+	}
+	p.geoIP.setCountries(p.conf.ReadCountries, p.conf.PublishCountries)
+
+	// egress accounting is never recreated, in order to preserve counters
+	if p.egress == nil {
+		p.egress = newEgressAccounting(p)
+	}
+	if p.conf.EgressAccountingFile != "" {
+		err = p.egress.startPersistence(p.conf.EgressAccountingFile, time.Duration(p.conf.EgressAccountingPeriod))
+		if err != nil {
+			return err
+		}
+	}
+
+	// reader shedding is never recreated, since it is shared by paths
+	// that survive configuration reloads
+	if p.shedding == nil {
+		p.shedding = newReaderShedding()
+	}
+	p.shedding.setMemoryLimit(p.conf.ReaderSheddingMemory)
+
 	if p.pathManager == nil {
 		p.pathManager = newPathManager(
 			p.ctx,
@@ -233,8 +593,16 @@ func (p *Core) createResources(initial bool) error {
 			p.conf.WriteTimeout,
 			p.conf.ReadBufferCount,
 			p.conf.ReadBufferSize,
-			p.conf.Paths,
-			p.metrics,
+			p.conf.HookStdinJSON,
+			p.conf.AllPaths(),
+			p.conf.Tenants,
+			p.disabled,
+			p.schedules,
+			p.quotas,
+			p.geoIP,
+			p.egress,
+			p.shedding,
+			p.registry,
 			p)
 	}
 
@@ -247,6 +615,10 @@ func (p *Core) createResources(initial bool) error {
 			p.rtspServer, err = newRTSPServer(
 				p.ctx,
 				p.conf.RTSPAddress,
+				p.conf.IPv6Disable,
+				p.conf.ListenReusePort,
+				p.conf.ProxyProtocol,
+				p.conf.ProxyProtocolTrustedProxies,
 				p.conf.AuthMethods,
 				p.conf.ReadTimeout,
 				p.conf.WriteTimeout,
@@ -260,13 +632,14 @@ func (p *Core) createResources(initial bool) error {
 				p.conf.MulticastRTPPort,
 				p.conf.MulticastRTCPPort,
 				false,
-				"",
-				"",
+				nil,
 				p.conf.RTSPAddress,
 				p.conf.Protocols,
 				p.conf.RunOnConnect,
 				p.conf.RunOnConnectRestart,
-				p.metrics,
+				p.conf.HookStdinJSON,
+				p.limiter,
+				p.bans,
 				p.pathManager,
 				p)
 			if err != nil {
@@ -278,10 +651,56 @@ func (p *Core) createResources(initial bool) error {
 	if !p.conf.RTSPDisable &&
 		(p.conf.Encryption == conf.EncryptionStrict ||
 			p.conf.Encryption == conf.EncryptionOptional) {
+		if p.conf.ACME && p.acmeManager == nil {
+			p.acmeManager, err = newACMEManager(
+				p.conf.ACMEDomains,
+				p.conf.ACMEEmail,
+				p.conf.ACMEDirectory,
+				p.conf.ACMEHTTPAddress,
+				p.conf.ACMECacheDir,
+				p)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !p.conf.ACME && p.certLoader == nil {
+			pairs := []certloader.Pair{{
+				CertPath: p.conf.ServerCert,
+				KeyPath:  p.conf.ServerKey,
+			}}
+			for _, pair := range p.conf.ServerCertificates {
+				pairs = append(pairs, certloader.Pair{
+					CertPath: pair.Cert,
+					KeyPath:  pair.Key,
+				})
+			}
+
+			p.certLoader, err = certloader.New(pairs, p)
+			if err != nil {
+				return err
+			}
+		}
+
 		if p.rtspsServer == nil {
+			var tlsConfig *tls.Config
+			if p.acmeManager != nil {
+				tlsConfig = p.acmeManager.tlsConfig()
+			} else {
+				tlsConfig = &tls.Config{GetCertificate: p.certLoader.GetCertificate}
+			}
+
+			tlsConfig.MinVersion = uint16(p.conf.TLSMinVersion)
+			tlsConfig.CipherSuites = p.conf.TLSCipherSuites
+			tlsConfig.CurvePreferences = p.conf.TLSCurves
+
 			p.rtspsServer, err = newRTSPServer(
 				p.ctx,
 				p.conf.RTSPSAddress,
+				p.conf.IPv6Disable,
+				p.conf.ListenReusePort,
+				p.conf.ProxyProtocol,
+				p.conf.ProxyProtocolTrustedProxies,
 				p.conf.AuthMethods,
 				p.conf.ReadTimeout,
 				p.conf.WriteTimeout,
@@ -295,13 +714,14 @@ func (p *Core) createResources(initial bool) error {
 				0,
 				0,
 				true,
-				p.conf.ServerCert,
-				p.conf.ServerKey,
+				tlsConfig,
 				p.conf.RTSPAddress,
 				p.conf.Protocols,
 				p.conf.RunOnConnect,
 				p.conf.RunOnConnectRestart,
-				p.metrics,
+				p.conf.HookStdinJSON,
+				p.limiter,
+				p.bans,
 				p.pathManager,
 				p)
 			if err != nil {
@@ -315,13 +735,19 @@ func (p *Core) createResources(initial bool) error {
 			p.rtmpServer, err = newRTMPServer(
 				p.ctx,
 				p.conf.RTMPAddress,
+				p.conf.IPv6Disable,
+				p.conf.ListenReusePort,
+				p.conf.ProxyProtocol,
+				p.conf.ProxyProtocolTrustedProxies,
 				p.conf.ReadTimeout,
 				p.conf.WriteTimeout,
 				p.conf.ReadBufferCount,
 				p.conf.RTSPAddress,
 				p.conf.RunOnConnect,
 				p.conf.RunOnConnectRestart,
-				p.metrics,
+				p.conf.HookStdinJSON,
+				p.limiter,
+				p.bans,
 				p.pathManager,
 				p)
 			if err != nil {
@@ -332,7 +758,6 @@ func (p *Core) createResources(initial bool) error {
 
 	if !p.conf.HLSDisable {
 		if p.hlsServer == nil {
-
 			p.hikkaServer, err = newHikkaServer(
 				p.ctx,
 				":9999",
@@ -342,19 +767,47 @@ func (p *Core) createResources(initial bool) error {
 				p.conf.HLSAllowOrigin,
 				p.conf.ReadBufferCount,
 				p.pathManager,
-				p.metrics,
 				p)
+			if err != nil {
+				return err
+			}
 
 			p.hlsServer, err = newHLSServer(
 				p.ctx,
 				p.conf.HLSAddress,
+				p.conf.IPv6Disable,
+				p.conf.ListenReusePort,
+				p.conf.UnixSocketPermissions,
+				p.conf.ProxyProtocol,
+				p.conf.ProxyProtocolTrustedProxies,
 				p.conf.HLSAlwaysRemux,
+				p.conf.HLSAlwaysRemuxCloseAfter,
 				p.conf.HLSSegmentCount,
 				p.conf.HLSSegmentDuration,
 				p.conf.HLSAllowOrigin,
-				p.conf.ReadBufferCount,
+				p.conf.HLSEncryption,
+				p.conf.HLSEncryptionKeyRotation,
+				p.conf.HLSDirectory,
+				p.conf.HLSPushURL,
+				p.limiter,
+				p.bans,
+				p.geoIP,
+				p.egress,
+				p.pathManager,
+				p)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if p.conf.DLNA {
+		if p.dlnaServer == nil {
+			p.dlnaServer, err = newDLNAServer(
+				p.ctx,
+				p.conf.DLNAAddress,
+				p.conf.DLNAFriendlyName,
 				p.pathManager,
-				p.metrics,
 				p)
 			if err != nil {
 				return err
@@ -366,12 +819,18 @@ func (p *Core) createResources(initial bool) error {
 		if p.api == nil {
 			p.api, err = newAPI(
 				p.conf.APIAddress,
+				p.conf.IPv6Disable,
+				p.conf.ListenReusePort,
+				p.conf.UnixSocketPermissions,
 				p.conf,
 				p.pathManager,
 				p.rtspServer,
 				p.rtspsServer,
 				p.rtmpServer,
 				p.hlsServer,
+				p.bans,
+				p.schedules,
+				p.egress,
 				p)
 			if err != nil {
 				return err
@@ -379,31 +838,123 @@ func (p *Core) createResources(initial bool) error {
 		}
 	}
 
+	p.setMetricsSources()
+
+	// components recreated by a reload must not accept new sessions too
+	if p.draining {
+		p.applyDrain()
+	}
+
 	return nil
 }
 
+// setMetricsSources links metrics exporters to the current components.
+// Components are linked here instead of inside their constructors,
+// in order to allow metrics and components to be restarted independently.
+func (p *Core) setMetricsSources() {
+	var exporters []*metricsSources
+	if p.metrics != nil {
+		exporters = append(exporters, &p.metrics.metricsSources)
+	}
+	if p.statsd != nil {
+		exporters = append(exporters, &p.statsd.metricsSources)
+	}
+
+	// nil pointers are detected by metrics through interfaceIsEmpty()
+	for _, e := range exporters {
+		e.onPathManagerSet(p.pathManager)
+		e.onRTSPServerSet(p.rtspServer)
+		e.onRTSPSServerSet(p.rtspsServer)
+		e.onRTMPServerSet(p.rtmpServer)
+		e.onHLSServerSet(p.hlsServer)
+		e.onLimiterSet(p.limiter)
+		e.onAuditorSet(p.auditor)
+		e.onQuotasSet(p.quotas)
+		e.onGeoIPSet(p.geoIP)
+		e.onEgressSet(p.egress)
+	}
+}
+
 func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 	closeLogger := false
 	if newConf == nil ||
+		newConf.LogLevel != p.conf.LogLevel ||
+		!reflect.DeepEqual(logLevelOverrides(newConf), logLevelOverrides(p.conf)) ||
+		newConf.LogFormat != p.conf.LogFormat ||
 		!reflect.DeepEqual(newConf.LogDestinations, p.conf.LogDestinations) ||
-		newConf.LogFile != p.conf.LogFile {
+		newConf.LogFile != p.conf.LogFile ||
+		newConf.LogFileMaxSize != p.conf.LogFileMaxSize ||
+		newConf.LogFileMaxAge != p.conf.LogFileMaxAge ||
+		newConf.LogFileMaxBackups != p.conf.LogFileMaxBackups ||
+		newConf.LogFileCompress != p.conf.LogFileCompress ||
+		newConf.LogSyslogAddress != p.conf.LogSyslogAddress {
 		closeLogger = true
 	}
 
+	closeAccessLog := false
+	if newConf == nil ||
+		newConf.AccessLog != p.conf.AccessLog ||
+		newConf.AccessLogFormat != p.conf.AccessLogFormat ||
+		newConf.AccessLogFile != p.conf.AccessLogFile ||
+		newConf.LogFileMaxSize != p.conf.LogFileMaxSize ||
+		newConf.LogFileMaxAge != p.conf.LogFileMaxAge ||
+		newConf.LogFileMaxBackups != p.conf.LogFileMaxBackups ||
+		newConf.LogFileCompress != p.conf.LogFileCompress {
+		closeAccessLog = true
+	}
+
+	closeAuditLog := false
+	if newConf == nil ||
+		newConf.AuditLog != p.conf.AuditLog ||
+		newConf.AuditLogFile != p.conf.AuditLogFile {
+		closeAuditLog = true
+	}
+
 	closeMetrics := false
 	if newConf == nil ||
 		newConf.Metrics != p.conf.Metrics ||
-		newConf.MetricsAddress != p.conf.MetricsAddress {
+		newConf.IPv6Disable != p.conf.IPv6Disable ||
+		newConf.ListenReusePort != p.conf.ListenReusePort ||
+		newConf.MetricsAddress != p.conf.MetricsAddress ||
+		newConf.UnixSocketPermissions != p.conf.UnixSocketPermissions {
 		closeMetrics = true
 	}
 
+	closeStatsD := false
+	if newConf == nil ||
+		newConf.StatsD != p.conf.StatsD ||
+		newConf.StatsDAddress != p.conf.StatsDAddress ||
+		newConf.StatsDPrefix != p.conf.StatsDPrefix ||
+		!reflect.DeepEqual(newConf.StatsDTags, p.conf.StatsDTags) ||
+		newConf.StatsDInterval != p.conf.StatsDInterval {
+		closeStatsD = true
+	}
+
 	closePPROF := false
 	if newConf == nil ||
 		newConf.PPROF != p.conf.PPROF ||
-		newConf.PPROFAddress != p.conf.PPROFAddress {
+		newConf.IPv6Disable != p.conf.IPv6Disable ||
+		newConf.ListenReusePort != p.conf.ListenReusePort ||
+		newConf.PPROFAddress != p.conf.PPROFAddress ||
+		newConf.UnixSocketPermissions != p.conf.UnixSocketPermissions {
 		closePPROF = true
 	}
 
+	closeRegistry := false
+	if newConf == nil ||
+		newConf.Registry != p.conf.Registry ||
+		newConf.RegistryInstanceURL != p.conf.RegistryInstanceURL ||
+		newConf.RegistryTTL != p.conf.RegistryTTL {
+		closeRegistry = true
+	}
+
+	closeEgressPersistence := false
+	if newConf == nil ||
+		newConf.EgressAccountingFile != p.conf.EgressAccountingFile ||
+		newConf.EgressAccountingPeriod != p.conf.EgressAccountingPeriod {
+		closeEgressPersistence = true
+	}
+
 	closePathManager := false
 	if newConf == nil ||
 		newConf.RTSPAddress != p.conf.RTSPAddress ||
@@ -411,10 +962,12 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.WriteTimeout != p.conf.WriteTimeout ||
 		newConf.ReadBufferCount != p.conf.ReadBufferCount ||
 		newConf.ReadBufferSize != p.conf.ReadBufferSize ||
-		closeMetrics {
+		newConf.HookStdinJSON != p.conf.HookStdinJSON ||
+		closeRegistry {
 		closePathManager = true
-	} else if !reflect.DeepEqual(newConf.Paths, p.conf.Paths) {
-		p.pathManager.onConfReload(newConf.Paths)
+	} else if !reflect.DeepEqual(newConf.Paths, p.conf.Paths) ||
+		!reflect.DeepEqual(newConf.Tenants, p.conf.Tenants) {
+		p.pathManager.onConfReload(newConf.AllPaths(), newConf.Tenants)
 	}
 
 	closeRTSPServer := false
@@ -422,6 +975,10 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.RTSPDisable != p.conf.RTSPDisable ||
 		newConf.Encryption != p.conf.Encryption ||
 		newConf.RTSPAddress != p.conf.RTSPAddress ||
+		newConf.IPv6Disable != p.conf.IPv6Disable ||
+		newConf.ListenReusePort != p.conf.ListenReusePort ||
+		newConf.ProxyProtocol != p.conf.ProxyProtocol ||
+		!reflect.DeepEqual(newConf.ProxyProtocolTrustedProxies, p.conf.ProxyProtocolTrustedProxies) ||
 		!reflect.DeepEqual(newConf.AuthMethods, p.conf.AuthMethods) ||
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
 		newConf.WriteTimeout != p.conf.WriteTimeout ||
@@ -436,42 +993,77 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		!reflect.DeepEqual(newConf.Protocols, p.conf.Protocols) ||
 		newConf.RunOnConnect != p.conf.RunOnConnect ||
 		newConf.RunOnConnectRestart != p.conf.RunOnConnectRestart ||
-		closeMetrics ||
+		newConf.HookStdinJSON != p.conf.HookStdinJSON ||
 		closePathManager {
 		closeRTSPServer = true
 	}
 
+	closeACMEManager := false
+	if newConf == nil ||
+		newConf.RTSPDisable != p.conf.RTSPDisable ||
+		newConf.Encryption != p.conf.Encryption ||
+		newConf.ACME != p.conf.ACME ||
+		!reflect.DeepEqual(newConf.ACMEDomains, p.conf.ACMEDomains) ||
+		newConf.ACMEEmail != p.conf.ACMEEmail ||
+		newConf.ACMEDirectory != p.conf.ACMEDirectory ||
+		newConf.ACMEHTTPAddress != p.conf.ACMEHTTPAddress ||
+		newConf.ACMECacheDir != p.conf.ACMECacheDir {
+		closeACMEManager = true
+	}
+
+	closeCertLoader := false
+	if newConf == nil ||
+		newConf.RTSPDisable != p.conf.RTSPDisable ||
+		newConf.Encryption != p.conf.Encryption ||
+		newConf.ACME != p.conf.ACME ||
+		newConf.ServerCert != p.conf.ServerCert ||
+		newConf.ServerKey != p.conf.ServerKey ||
+		!reflect.DeepEqual(newConf.ServerCertificates, p.conf.ServerCertificates) {
+		closeCertLoader = true
+	}
+
 	closeRTSPSServer := false
 	if newConf == nil ||
 		newConf.RTSPDisable != p.conf.RTSPDisable ||
 		newConf.Encryption != p.conf.Encryption ||
+		newConf.IPv6Disable != p.conf.IPv6Disable ||
+		newConf.ListenReusePort != p.conf.ListenReusePort ||
 		newConf.RTSPSAddress != p.conf.RTSPSAddress ||
+		newConf.TLSMinVersion != p.conf.TLSMinVersion ||
+		!reflect.DeepEqual(newConf.TLSCipherSuites, p.conf.TLSCipherSuites) ||
+		!reflect.DeepEqual(newConf.TLSCurves, p.conf.TLSCurves) ||
+		newConf.ProxyProtocol != p.conf.ProxyProtocol ||
+		!reflect.DeepEqual(newConf.ProxyProtocolTrustedProxies, p.conf.ProxyProtocolTrustedProxies) ||
 		!reflect.DeepEqual(newConf.AuthMethods, p.conf.AuthMethods) ||
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
 		newConf.WriteTimeout != p.conf.WriteTimeout ||
 		newConf.ReadBufferCount != p.conf.ReadBufferCount ||
-		newConf.ServerCert != p.conf.ServerCert ||
-		newConf.ServerKey != p.conf.ServerKey ||
 		newConf.RTSPAddress != p.conf.RTSPAddress ||
 		!reflect.DeepEqual(newConf.Protocols, p.conf.Protocols) ||
 		newConf.RunOnConnect != p.conf.RunOnConnect ||
 		newConf.RunOnConnectRestart != p.conf.RunOnConnectRestart ||
-		closeMetrics ||
-		closePathManager {
+		newConf.HookStdinJSON != p.conf.HookStdinJSON ||
+		closePathManager ||
+		closeACMEManager ||
+		closeCertLoader {
 		closeRTSPSServer = true
 	}
 
 	closeRTMPServer := false
 	if newConf == nil ||
 		newConf.RTMPDisable != p.conf.RTMPDisable ||
+		newConf.IPv6Disable != p.conf.IPv6Disable ||
+		newConf.ListenReusePort != p.conf.ListenReusePort ||
 		newConf.RTMPAddress != p.conf.RTMPAddress ||
+		newConf.ProxyProtocol != p.conf.ProxyProtocol ||
+		!reflect.DeepEqual(newConf.ProxyProtocolTrustedProxies, p.conf.ProxyProtocolTrustedProxies) ||
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
 		newConf.WriteTimeout != p.conf.WriteTimeout ||
 		newConf.ReadBufferCount != p.conf.ReadBufferCount ||
 		newConf.RTSPAddress != p.conf.RTSPAddress ||
 		newConf.RunOnConnect != p.conf.RunOnConnect ||
 		newConf.RunOnConnectRestart != p.conf.RunOnConnectRestart ||
-		closeMetrics ||
+		newConf.HookStdinJSON != p.conf.HookStdinJSON ||
 		closePathManager {
 		closeRTMPServer = true
 	}
@@ -479,21 +1071,42 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 	closeHLSServer := false
 	if newConf == nil ||
 		newConf.HLSDisable != p.conf.HLSDisable ||
+		newConf.IPv6Disable != p.conf.IPv6Disable ||
+		newConf.ListenReusePort != p.conf.ListenReusePort ||
 		newConf.HLSAddress != p.conf.HLSAddress ||
+		newConf.UnixSocketPermissions != p.conf.UnixSocketPermissions ||
+		newConf.ProxyProtocol != p.conf.ProxyProtocol ||
+		!reflect.DeepEqual(newConf.ProxyProtocolTrustedProxies, p.conf.ProxyProtocolTrustedProxies) ||
 		newConf.HLSAlwaysRemux != p.conf.HLSAlwaysRemux ||
+		newConf.HLSAlwaysRemuxCloseAfter != p.conf.HLSAlwaysRemuxCloseAfter ||
 		newConf.HLSSegmentCount != p.conf.HLSSegmentCount ||
 		newConf.HLSSegmentDuration != p.conf.HLSSegmentDuration ||
 		newConf.HLSAllowOrigin != p.conf.HLSAllowOrigin ||
-		newConf.ReadBufferCount != p.conf.ReadBufferCount ||
-		closePathManager ||
-		closeMetrics {
+		newConf.HLSEncryption != p.conf.HLSEncryption ||
+		newConf.HLSEncryptionKeyRotation != p.conf.HLSEncryptionKeyRotation ||
+		newConf.HLSDirectory != p.conf.HLSDirectory ||
+		newConf.HLSPushURL != p.conf.HLSPushURL ||
+		closePathManager {
 		closeHLSServer = true
 	}
 
+	closeDLNAServer := false
+	if newConf == nil ||
+		newConf.DLNA != p.conf.DLNA ||
+		newConf.DLNAAddress != p.conf.DLNAAddress ||
+		newConf.DLNAFriendlyName != p.conf.DLNAFriendlyName ||
+		closePathManager {
+		closeDLNAServer = true
+	}
+
 	closeAPI := false
 	if newConf == nil ||
 		newConf.API != p.conf.API ||
+		newConf.IPv6Disable != p.conf.IPv6Disable ||
+		newConf.ListenReusePort != p.conf.ListenReusePort ||
 		newConf.APIAddress != p.conf.APIAddress ||
+		newConf.APIDashboard != p.conf.APIDashboard ||
+		newConf.UnixSocketPermissions != p.conf.UnixSocketPermissions ||
 		closePathManager ||
 		closeRTSPServer ||
 		closeRTSPSServer ||
@@ -516,6 +1129,21 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		p.rtspsServer = nil
 	}
 
+	if closeACMEManager && p.acmeManager != nil {
+		p.acmeManager.close()
+		p.acmeManager = nil
+	}
+
+	if closeCertLoader && p.certLoader != nil {
+		p.certLoader.Close()
+		p.certLoader = nil
+	}
+
+	if closeDLNAServer && p.dlnaServer != nil {
+		p.dlnaServer.close()
+		p.dlnaServer = nil
+	}
+
 	if closeRTSPServer && p.rtspServer != nil {
 		p.rtspServer.close()
 		p.rtspServer = nil
@@ -526,11 +1154,21 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		p.pathManager = nil
 	}
 
+	if closeRegistry && p.registry != nil {
+		p.registry.Close()
+		p.registry = nil
+	}
+
 	if closeHLSServer && p.hlsServer != nil {
 		p.hlsServer.close()
 		p.hlsServer = nil
 	}
 
+	if closeHLSServer && p.hikkaServer != nil {
+		p.hikkaServer.close()
+		p.hikkaServer = nil
+	}
+
 	if closeRTMPServer && p.rtmpServer != nil {
 		p.rtmpServer.close()
 		p.rtmpServer = nil
@@ -546,6 +1184,30 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		p.metrics = nil
 	}
 
+	if closeStatsD && p.statsd != nil {
+		p.statsd.close()
+		p.statsd = nil
+	}
+
+	// unlink metrics from closed components
+	p.setMetricsSources()
+
+	// counters are saved after closing servers, in order to include the last bytes sent
+	if closeEgressPersistence && p.egress != nil {
+		p.egress.stopPersistence()
+	}
+
+	if closeAuditLog && p.auditLog != nil {
+		p.auditor.setLog(nil)
+		p.auditLog.Close()
+		p.auditLog = nil
+	}
+
+	if closeAccessLog && p.accessLog != nil {
+		p.accessLog.Close()
+		p.accessLog = nil
+	}
+
 	if closeLogger && p.logger != nil {
 		p.logger.Close()
 		p.logger = nil
@@ -559,6 +1221,102 @@ func (p *Core) reloadConf(newConf *conf.Conf, calledByAPI bool) error {
 	return p.createResources(false)
 }
 
+// applyDrain prevents components from accepting new sessions.
+func (p *Core) applyDrain() {
+	if p.pathManager != nil {
+		p.pathManager.onDrain()
+	}
+
+	if p.hlsServer != nil {
+		p.hlsServer.onDrain()
+	}
+
+	// listeners shared with other instances stop accepting connections,
+	// in order to hand over new connections to the instance that replaces this one.
+	for _, s := range []*rtspServer{p.rtspServer, p.rtspsServer} {
+		if s != nil {
+			s.onDrain()
+		}
+	}
+
+	if p.rtmpServer != nil {
+		p.rtmpServer.onDrain()
+	}
+}
+
+// activeSessions returns the number of sessions that are reading or publishing.
+func (p *Core) activeSessions() int {
+	n := 0
+
+	for _, s := range []*rtspServer{p.rtspServer, p.rtspsServer} {
+		if s == nil {
+			continue
+		}
+
+		res := s.onAPISessionsList(rtspServerAPISessionsListReq{})
+		if res.Err == nil {
+			for _, i := range res.Data.Items {
+				if i.State != "idle" {
+					n++
+				}
+			}
+		}
+	}
+
+	if p.rtmpServer != nil {
+		res := p.rtmpServer.onAPIConnsList(rtmpServerAPIConnsListReq{})
+		if res.Err == nil {
+			for _, i := range res.Data.Items {
+				if i.State != "idle" {
+					n++
+				}
+			}
+		}
+	}
+
+	return n
+}
+
+// onAPIDrain is called by api.
+func (p *Core) onAPIDrain() {
+	select {
+	case p.apiDrain <- struct{}{}:
+	case <-p.ctx.Done():
+	}
+}
+
+// onAPILogLevelGet is called by api.
+func (p *Core) onAPILogLevelGet() apiLogLevelData {
+	level, overrides := p.logger.Levels()
+
+	data := apiLogLevelData{
+		Level:      conf.LogLevel(level),
+		Components: make(conf.LogLevels),
+	}
+	for name, l := range overrides.Components {
+		data.Components[name] = conf.LogLevel(l)
+	}
+
+	return data
+}
+
+// onAPILogLevelSet is called by api.
+// Levels of paths are preserved. Levels are replaced by the ones
+// of the configuration when the logger is recreated.
+func (p *Core) onAPILogLevelSet(data apiLogLevelData) {
+	_, overrides := p.logger.Levels()
+
+	overrides.Components = nil
+	if len(data.Components) != 0 {
+		overrides.Components = make(map[string]logger.Level)
+		for name, l := range data.Components {
+			overrides.Components[name] = logger.Level(l)
+		}
+	}
+
+	p.logger.SetLevels(logger.Level(data.Level), overrides)
+}
+
 // onAPIConfigSet is called by api.
 func (p *Core) onAPIConfigSet(conf *conf.Conf) {
 	select {
@@ -1,12 +1,24 @@
 package core
 
 import (
+	"bufio"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -309,6 +321,62 @@ func main() {
 	}
 }
 
+func TestCorePathOnDemandDescribe(t *testing.T) {
+	for _, ca := range []string{"wait", "unavailable", "fallback"} {
+		t.Run(ca, func(t *testing.T) {
+			// the command never publishes
+			p, ok := newInstance("rtmpDisable: yes\n" +
+				"hlsDisable: yes\n" +
+				"paths:\n" +
+				"  ondemand:\n" +
+				"    runOnDemand: sleep 10\n" +
+				"    runOnDemandStartTimeout: 5s\n" +
+				"    onDemandDescribe: " + ca + "\n" +
+				"    onDemandDescribeTimeout: 500ms\n" +
+				"    fallback: /other\n")
+			require.Equal(t, true, ok)
+			defer p.close()
+
+			conn, err := net.Dial("tcp", "localhost:8554")
+			require.NoError(t, err)
+			defer conn.Close()
+			br := bufio.NewReader(conn)
+			bw := bufio.NewWriter(conn)
+
+			start := time.Now()
+
+			err = base.Request{
+				Method: base.Describe,
+				URL:    mustParseURL("rtsp://localhost:8554/ondemand"),
+				Header: base.Header{
+					"CSeq": base.HeaderValue{"1"},
+				},
+			}.Write(bw)
+			require.NoError(t, err)
+
+			var res base.Response
+			err = res.Read(br)
+			require.NoError(t, err)
+
+			switch ca {
+			case "wait":
+				require.Equal(t, base.StatusServiceUnavailable, res.StatusCode)
+				require.Equal(t, base.HeaderValue{"5"}, res.Header["Retry-After"])
+				require.GreaterOrEqual(t, time.Since(start), 500*time.Millisecond)
+
+			case "unavailable":
+				require.Equal(t, base.StatusServiceUnavailable, res.StatusCode)
+				require.Equal(t, base.HeaderValue{"5"}, res.Header["Retry-After"])
+				require.Less(t, time.Since(start), 500*time.Millisecond)
+
+			case "fallback":
+				require.Equal(t, base.StatusMovedPermanently, res.StatusCode)
+				require.Equal(t, base.HeaderValue{"rtsp://localhost:8554/other"}, res.Header["Location"])
+			}
+		})
+	}
+}
+
 func TestCoreHotReloading(t *testing.T) {
 	confPath := filepath.Join(os.TempDir(), "rtsp-conf")
 
@@ -358,3 +426,218 @@ func TestCoreHotReloading(t *testing.T) {
 		defer conn.Close()
 	}()
 }
+
+func TestCoreHotReloadingPreservesSessions(t *testing.T) {
+	confPath := filepath.Join(os.TempDir(), "rtsp-conf")
+
+	err := ioutil.WriteFile(confPath, []byte("metrics: no\n"+
+		"hlsSegmentCount: 3\n"+
+		"paths:\n"+
+		"  test1:\n"+
+		"  test2:\n"),
+		0o644)
+	require.NoError(t, err)
+	defer os.Remove(confPath)
+
+	p, ok := New([]string{confPath})
+	require.Equal(t, true, ok)
+	defer p.close()
+
+	track, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x01, 0x02, 0x03, 0x04}, PPS: []byte{0x01, 0x02, 0x03, 0x04}})
+	require.NoError(t, err)
+
+	source := gortsplib.Client{}
+
+	err = source.StartPublishing("rtsp://localhost:8554/test1",
+		gortsplib.Tracks{track})
+	require.NoError(t, err)
+	defer source.Close()
+
+	frameRecv := make(chan struct{}, 1)
+
+	reader := gortsplib.Client{
+		OnPacketRTP: func(trackID int, payload []byte) {
+			select {
+			case frameRecv <- struct{}{}:
+			default:
+			}
+		},
+	}
+
+	err = reader.StartReading("rtsp://localhost:8554/test1")
+	require.NoError(t, err)
+	defer reader.Close()
+
+	// change metrics, a global HLS setting and an unrelated path
+	err = ioutil.WriteFile(confPath, []byte("metrics: yes\n"+
+		"hlsSegmentCount: 5\n"+
+		"paths:\n"+
+		"  test1:\n"+
+		"  test2:\n"+
+		"    publishUser: myuser\n"+
+		"    publishPass: mypass\n"),
+		0o644)
+	require.NoError(t, err)
+
+	time.Sleep(1 * time.Second)
+
+	err = source.WritePacketRTP(0, []byte{
+		0x80, 0x60, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x01, 0x05,
+	})
+	require.NoError(t, err)
+
+	select {
+	case <-frameRecv:
+	case <-time.After(2 * time.Second):
+		t.Errorf("reader has been disconnected by the reload")
+	}
+}
+
+func TestCoreRemoteConf(t *testing.T) {
+	var mutex sync.Mutex
+	content := "paths:\n" +
+		"  test1:\n" +
+		"    publishUser: myuser\n" +
+		"    publishPass: mypass\n"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+
+	cachePath := filepath.Join(os.TempDir(), "rtsp-conf-remote")
+	defer os.Remove(cachePath)
+
+	p, ok := New([]string{"--confcache", cachePath, "--confpoll", "100ms", srv.URL + "/conf.yml"})
+	require.Equal(t, true, ok)
+	defer p.close()
+
+	track, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x01, 0x02, 0x03, 0x04}, PPS: []byte{0x01, 0x02, 0x03, 0x04}})
+	require.NoError(t, err)
+
+	func() {
+		c := gortsplib.Client{}
+		err := c.StartPublishing("rtsp://localhost:8554/test1",
+			gortsplib.Tracks{track})
+		require.EqualError(t, err, "bad status code: 401 (Unauthorized)")
+	}()
+
+	mutex.Lock()
+	content = "paths:\n" +
+		"  test1:\n"
+	mutex.Unlock()
+
+	time.Sleep(1500 * time.Millisecond)
+
+	func() {
+		c := gortsplib.Client{}
+		err := c.StartPublishing("rtsp://localhost:8554/test1",
+			gortsplib.Tracks{track})
+		require.NoError(t, err)
+		defer c.Close()
+	}()
+}
+
+func TestCoreACME(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtsp-acme")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p, ok := newInstance("encryption: optional\n" +
+		"acme: yes\n" +
+		"acmeDomains: [stream.example.com]\n" +
+		"acmeDirectory: http://127.0.0.1:8090/directory\n" +
+		"acmeHTTPAddress: 127.0.0.1:8089\n" +
+		"acmeCacheDir: " + dir + "\n")
+	require.Equal(t, true, ok)
+	defer p.close()
+
+	// unknown challenges are refused
+	res, err := http.Get("http://127.0.0.1:8089/.well-known/acme-challenge/mytoken")
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	// certificates are not requested for domains that are not allowed
+	_, err = tls.Dial("tcp", "127.0.0.1:8555", &tls.Config{ServerName: "other.example.com"})
+	require.Error(t, err)
+}
+
+// newCertificate returns a certificate for domain signed with serverKey.
+func newCertificate(t *testing.T, domain string) []byte {
+	pair, err := tls.X509KeyPair(serverCert, serverKey)
+	require.NoError(t, err)
+	key := pair.PrivateKey.(crypto.Signer)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestCoreServerCertificates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtsp-certs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	keyPath := filepath.Join(dir, "server.key")
+	err = ioutil.WriteFile(keyPath, serverKey, 0o600)
+	require.NoError(t, err)
+
+	certPath := filepath.Join(dir, "server.crt")
+	err = ioutil.WriteFile(certPath, newCertificate(t, "default.example.com"), 0o644)
+	require.NoError(t, err)
+
+	otherCertPath := filepath.Join(dir, "other.crt")
+	err = ioutil.WriteFile(otherCertPath, newCertificate(t, "other.example.com"), 0o644)
+	require.NoError(t, err)
+
+	p, ok := newInstance("encryption: optional\n" +
+		"serverKey: " + keyPath + "\n" +
+		"serverCert: " + certPath + "\n" +
+		"serverCertificates:\n" +
+		"  - cert: " + otherCertPath + "\n" +
+		"    key: " + keyPath + "\n")
+	require.Equal(t, true, ok)
+	defer p.close()
+
+	peerName := func(serverName string) string {
+		conn, err := tls.Dial("tcp", "127.0.0.1:8555", &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: true,
+		})
+		if err != nil {
+			return ""
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+
+	require.Equal(t, "default.example.com", peerName("default.example.com"))
+	require.Equal(t, "other.example.com", peerName("other.example.com"))
+	require.Equal(t, "default.example.com", peerName("unknown.example.com"))
+
+	// the certificate is reloaded without restarting the listener
+	rtspsServer := p.rtspsServer
+
+	err = ioutil.WriteFile(certPath, newCertificate(t, "renewed.example.com"), 0o644)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return peerName("renewed.example.com") == "renewed.example.com"
+	}, 5*time.Second, 100*time.Millisecond)
+	require.Same(t, rtspsServer, p.rtspsServer)
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"sort"
+	"sync"
+)
+
+// disabledPaths contains the paths that have been disabled through the API.
+// It is shared with the path manager and survives configuration reloads,
+// in order not to enable paths when the path manager is restarted.
+type disabledPaths struct {
+	mutex sync.Mutex
+	names map[string]struct{}
+}
+
+func newDisabledPaths() *disabledPaths {
+	return &disabledPaths{
+		names: make(map[string]struct{}),
+	}
+}
+
+// disable disables a path. It returns false if the path is already disabled.
+func (d *disabledPaths) disable(name string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.names[name]; ok {
+		return false
+	}
+
+	d.names[name] = struct{}{}
+	return true
+}
+
+// enable enables a path. It returns false if the path is not disabled.
+func (d *disabledPaths) enable(name string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.names[name]; !ok {
+		return false
+	}
+
+	delete(d.names, name)
+	return true
+}
+
+// isDisabled checks whether a path is disabled.
+func (d *disabledPaths) isDisabled(name string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	_, ok := d.names[name]
+	return ok
+}
+
+// list returns the names of the disabled paths, sorted.
+func (d *disabledPaths) list() []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	ret := make([]string, 0, len(d.names))
+	for name := range d.names {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
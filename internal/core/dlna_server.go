@@ -0,0 +1,599 @@
+package core
+
+import (
+	"context"
+	"crypto/md5" //nolint:gosec
+	"encoding/xml"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+const (
+	// DLNA media profile of H264 and AAC inside MPEG-TS, without timestamps.
+	// Streams can't be seeked, since they are live.
+	dlnaContentFeatures = "DLNA.ORG_PN=AVC_TS_MP_HD_AAC_MULT5_ISO;DLNA.ORG_OP=00;DLNA.ORG_CI=0;" +
+		"DLNA.ORG_FLAGS=01700000000000000000000000000000"
+
+	dlnaProtocolInfo = "http-get:*:video/mpeg:" + dlnaContentFeatures
+)
+
+func dlnaServerHeader() string {
+	return runtime.GOOS + "/1.0 UPnP/1.0 DLNADOC/1.50 rtsp-simple-server/" + version
+}
+
+// dlnaUDN returns the unique device name, that must not change between restarts,
+// since clients use it to recognize the device.
+func dlnaUDN(address string) string {
+	hostname, _ := os.Hostname()
+	h := md5.Sum([]byte(hostname + address)) //nolint:gosec
+	return fmt.Sprintf("uuid:%x-%x-%x-%x-%x", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
+
+func dlnaEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+type dlnaItem struct {
+	id  string
+	url string
+}
+
+// dlnaDIDL returns the DIDL-Lite description of a list of items (ContentDirectory:1, section 2.8.10).
+func dlnaDIDL(items []dlnaItem) string {
+	var b strings.Builder
+	b.WriteString(`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/"` +
+		` xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/">`)
+
+	for _, it := range items {
+		b.WriteString(`<item id="` + dlnaEscape(it.id) + `" parentID="0" restricted="1">` +
+			`<dc:title>` + dlnaEscape(it.id) + `</dc:title>` +
+			`<upnp:class>object.item.videoItem</upnp:class>` +
+			`<res protocolInfo="` + dlnaProtocolInfo + `">` + dlnaEscape(it.url) + `</res>` +
+			`</item>`)
+	}
+
+	b.WriteString(`</DIDL-Lite>`)
+	return b.String()
+}
+
+func dlnaDIDLRoot(childCount int) string {
+	return `<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/"` +
+		` xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/">` +
+		`<container id="0" parentID="-1" restricted="1" childCount="` + strconv.FormatInt(int64(childCount), 10) + `">` +
+		`<dc:title>root</dc:title><upnp:class>object.container.storageFolder</upnp:class>` +
+		`</container></DIDL-Lite>`
+}
+
+// dlnaSOAPResponse returns the body of the response to a SOAP action.
+// Arguments must be already escaped.
+func dlnaSOAPResponse(service string, action string, args [][2]string) []byte {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"` +
+		` s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>` +
+		`<u:` + action + `Response xmlns:u="` + service + `">`)
+
+	for _, a := range args {
+		b.WriteString("<" + a[0] + ">" + a[1] + "</" + a[0] + ">")
+	}
+
+	b.WriteString(`</u:` + action + `Response></s:Body></s:Envelope>`)
+	return []byte(b.String())
+}
+
+// dlnaSOAPFault returns the body of a UPnP error (UPnP Device Architecture 1.0, section 3.2.2).
+func dlnaSOAPFault(code int, description string) []byte {
+	return []byte(`<?xml version="1.0" encoding="utf-8"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"` +
+		` s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>` +
+		`<s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail>` +
+		`<UPnPError xmlns="urn:schemas-upnp-org:control-1-0">` +
+		`<errorCode>` + strconv.FormatInt(int64(code), 10) + `</errorCode>` +
+		`<errorDescription>` + description + `</errorDescription>` +
+		`</UPnPError></detail></s:Fault></s:Body></s:Envelope>`)
+}
+
+type dlnaBrowseArgs struct {
+	ObjectID       string `xml:"ObjectID"`
+	BrowseFlag     string `xml:"BrowseFlag"`
+	StartingIndex  int    `xml:"StartingIndex"`
+	RequestedCount int    `xml:"RequestedCount"`
+}
+
+type dlnaServerPathManager interface {
+	onAPIPathsList(req pathAPIPathsListReq) pathAPIPathsListRes
+	onReaderSetupPlay(req pathReaderSetupPlayReq) pathReaderSetupPlayRes
+}
+
+type dlnaServerParent interface {
+	Log(logger.Level, string, ...interface{})
+	LogAccess(logger.AccessEntry)
+}
+
+// dlnaServer is a DLNA media server, that allows smart TVs and other renderers
+// to discover paths and to read them as MPEG-TS streams.
+type dlnaServer struct {
+	friendlyName string
+	pathManager  dlnaServerPathManager
+	parent       dlnaServerParent
+
+	ctx       context.Context
+	ctxCancel func()
+	wg        sync.WaitGroup
+	ln        net.Listener
+	hs        *http.Server
+	udn       string
+	ssdp      *dlnaSSDP
+}
+
+func newDLNAServer(
+	parentCtx context.Context,
+	address string,
+	friendlyName string,
+	pathManager dlnaServerPathManager,
+	parent dlnaServerParent,
+) (*dlnaServer, error) {
+	// SSDP supports IPv4 only
+	ln, err := net.Listen("tcp4", address)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, ctxCancel := context.WithCancel(parentCtx)
+
+	s := &dlnaServer{
+		friendlyName: friendlyName,
+		pathManager:  pathManager,
+		parent:       parent,
+		ctx:          ctx,
+		ctxCancel:    ctxCancel,
+		ln:           ln,
+		udn:          dlnaUDN(address),
+	}
+
+	s.ssdp, err = newDLNASSDP(s.udn, ln.Addr().(*net.TCPAddr).Port, s.log)
+	if err != nil {
+		ln.Close()
+		ctxCancel()
+		return nil, err
+	}
+
+	router := gin.New()
+	router.Use(httpAccessLog("DLNA", s.parent))
+	router.NoRoute(s.onRequest)
+
+	s.hs = &http.Server{
+		Handler: router,
+		BaseContext: func(net.Listener) context.Context {
+			return s.ctx
+		},
+	}
+
+	s.log(logger.Info, "listener opened on "+address)
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s, nil
+}
+
+func (s *dlnaServer) log(level logger.Level, format string, args ...interface{}) {
+	s.parent.Log(level, "[DLNA] "+format, append([]interface{}{}, args...)...)
+}
+
+func (s *dlnaServer) close() {
+	s.ssdp.close()
+	s.ctxCancel()
+	s.wg.Wait()
+	s.log(logger.Info, "listener closed")
+}
+
+func (s *dlnaServer) run() {
+	defer s.wg.Done()
+
+	go s.hs.Serve(s.ln)
+
+	<-s.ctx.Done()
+
+	// streams are closed by the cancellation of the context
+	s.hs.Shutdown(context.Background())
+}
+
+func (s *dlnaServer) onRequest(ctx *gin.Context) {
+	s.log(logger.Debug, "[conn %v] %s %s", ctx.Request.RemoteAddr, ctx.Request.Method, ctx.Request.URL.Path)
+
+	ctx.Writer.Header().Set("Server", dlnaServerHeader())
+
+	switch {
+	case ctx.Request.Method == http.MethodGet && ctx.Request.URL.Path == "/rootDesc.xml":
+		s.writeXML(ctx, []byte(s.rootDesc()))
+
+	case ctx.Request.Method == http.MethodGet && ctx.Request.URL.Path == "/ContentDirectory.xml":
+		s.writeXML(ctx, []byte(dlnaContentDirectorySCPD))
+
+	case ctx.Request.Method == http.MethodGet && ctx.Request.URL.Path == "/ConnectionManager.xml":
+		s.writeXML(ctx, []byte(dlnaConnectionManagerSCPD))
+
+	case ctx.Request.Method == http.MethodPost && ctx.Request.URL.Path == "/ctl/ContentDirectory":
+		s.onContentDirectory(ctx)
+
+	case ctx.Request.Method == http.MethodPost && ctx.Request.URL.Path == "/ctl/ConnectionManager":
+		s.onConnectionManager(ctx)
+
+	// events are not supported, but subscriptions are accepted,
+	// since some clients refuse to use devices that reject them.
+	case ctx.Request.Method == "SUBSCRIBE" && strings.HasPrefix(ctx.Request.URL.Path, "/evt/"):
+		ctx.Writer.Header().Set("SID", s.udn+"-"+strings.TrimPrefix(ctx.Request.URL.Path, "/evt/"))
+		ctx.Writer.Header().Set("TIMEOUT", "Second-"+strconv.FormatInt(ssdpMaxAge, 10))
+		ctx.Writer.WriteHeader(http.StatusOK)
+
+	case ctx.Request.Method == "UNSUBSCRIBE" && strings.HasPrefix(ctx.Request.URL.Path, "/evt/"):
+		ctx.Writer.WriteHeader(http.StatusOK)
+
+	case (ctx.Request.Method == http.MethodGet || ctx.Request.Method == http.MethodHead) &&
+		strings.HasPrefix(ctx.Request.URL.Path, "/stream/") &&
+		strings.HasSuffix(ctx.Request.URL.Path, ".ts"):
+		pathName := strings.TrimSuffix(strings.TrimPrefix(ctx.Request.URL.Path, "/stream/"), ".ts")
+		s.onStream(ctx, pathName)
+
+	default:
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *dlnaServer) writeXML(ctx *gin.Context, byts []byte) {
+	ctx.Writer.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	ctx.Writer.WriteHeader(http.StatusOK)
+	ctx.Writer.Write(byts)
+}
+
+func (s *dlnaServer) rootDesc() string {
+	service := func(typ string, name string) string {
+		return `<service><serviceType>` + typ + `</serviceType>` +
+			`<serviceId>urn:upnp-org:serviceId:` + name + `</serviceId>` +
+			`<SCPDURL>/` + name + `.xml</SCPDURL>` +
+			`<controlURL>/ctl/` + name + `</controlURL>` +
+			`<eventSubURL>/evt/` + name + `</eventSubURL></service>`
+	}
+
+	return `<?xml version="1.0" encoding="utf-8"?>` +
+		`<root xmlns="urn:schemas-upnp-org:device-1-0" xmlns:dlna="urn:schemas-dlna-org:device-1-0">` +
+		`<specVersion><major>1</major><minor>0</minor></specVersion>` +
+		`<device>` +
+		`<deviceType>` + dlnaDeviceType + `</deviceType>` +
+		`<dlna:X_DLNADOC>DMS-1.50</dlna:X_DLNADOC>` +
+		`<friendlyName>` + dlnaEscape(s.friendlyName) + `</friendlyName>` +
+		`<manufacturer>rtsp-simple-server</manufacturer>` +
+		`<manufacturerURL>https://github.com/aler9/rtsp-simple-server</manufacturerURL>` +
+		`<modelName>rtsp-simple-server</modelName>` +
+		`<modelNumber>` + dlnaEscape(version) + `</modelNumber>` +
+		`<UDN>` + s.udn + `</UDN>` +
+		`<serviceList>` +
+		service(dlnaContentDirectory, "ContentDirectory") +
+		service(dlnaConnectionManager, "ConnectionManager") +
+		`</serviceList>` +
+		`</device></root>`
+}
+
+// items returns the paths that can be read by DLNA clients, sorted by name.
+// Paths that require credentials or that are restricted to some IPs are not listed,
+// since clients can't provide credentials.
+func (s *dlnaServer) items(host string) ([]dlnaItem, error) {
+	res := s.pathManager.onAPIPathsList(pathAPIPathsListReq{})
+	if res.Err != nil {
+		return nil, res.Err
+	}
+
+	var ret []dlnaItem
+
+	for name, pa := range res.Data.Items {
+		if !pa.SourceReady || pa.Conf.ReadUser != "" || pa.Conf.ReadIPs != nil {
+			continue
+		}
+
+		ret = append(ret, dlnaItem{
+			id:  name,
+			url: "http://" + host + "/stream/" + (&url.URL{Path: name}).EscapedPath() + ".ts",
+		})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].id < ret[j].id
+	})
+
+	return ret, nil
+}
+
+// systemUpdateID changes when the list of items changes, in order to allow
+// clients to detect when the content of the server changes.
+func dlnaSystemUpdateID(items []dlnaItem) uint32 {
+	h := fnv.New32a()
+	for _, it := range items {
+		h.Write([]byte(it.id))
+		h.Write([]byte{0})
+	}
+	return h.Sum32()
+}
+
+// soapAction returns the name of the action contained in the SOAPACTION header.
+func soapAction(ctx *gin.Context, service string) string {
+	h := strings.Trim(ctx.Request.Header.Get("SOAPACTION"), `"`)
+	if !strings.HasPrefix(h, service+"#") {
+		return ""
+	}
+	return strings.TrimPrefix(h, service+"#")
+}
+
+func (s *dlnaServer) onContentDirectory(ctx *gin.Context) {
+	action := soapAction(ctx, dlnaContentDirectory)
+
+	items, err := s.items(ctx.Request.Host)
+	if err != nil {
+		ctx.Writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	updateID := strconv.FormatUint(uint64(dlnaSystemUpdateID(items)), 10)
+
+	switch action {
+	case "GetSearchCapabilities":
+		s.writeXML(ctx, dlnaSOAPResponse(dlnaContentDirectory, action, [][2]string{{"SearchCaps", ""}}))
+
+	case "GetSortCapabilities":
+		s.writeXML(ctx, dlnaSOAPResponse(dlnaContentDirectory, action, [][2]string{{"SortCaps", ""}}))
+
+	case "GetSystemUpdateID":
+		s.writeXML(ctx, dlnaSOAPResponse(dlnaContentDirectory, action, [][2]string{{"Id", updateID}}))
+
+	case "Browse":
+		var env struct {
+			Body struct {
+				Browse dlnaBrowseArgs `xml:"Browse"`
+			} `xml:"Body"`
+		}
+		err := xml.NewDecoder(ctx.Request.Body).Decode(&env)
+		if err != nil {
+			s.writeSOAPFault(ctx, 402, "Invalid Args")
+			return
+		}
+		args := env.Body.Browse
+
+		var result string
+		var returned int
+
+		switch {
+		case args.ObjectID == "0" && args.BrowseFlag == "BrowseMetadata":
+			result = dlnaDIDLRoot(len(items))
+			returned = 1
+
+		case args.ObjectID == "0" && args.BrowseFlag == "BrowseDirectChildren":
+			start := args.StartingIndex
+			if start > len(items) {
+				start = len(items)
+			}
+			end := len(items)
+			if args.RequestedCount > 0 && (start+args.RequestedCount) < end {
+				end = start + args.RequestedCount
+			}
+
+			result = dlnaDIDL(items[start:end])
+			returned = end - start
+
+		case args.BrowseFlag == "BrowseMetadata":
+			for _, it := range items {
+				if it.id == args.ObjectID {
+					result = dlnaDIDL([]dlnaItem{it})
+					returned = 1
+					break
+				}
+			}
+			if result == "" {
+				s.writeSOAPFault(ctx, 701, "No such object")
+				return
+			}
+
+		default:
+			s.writeSOAPFault(ctx, 701, "No such object")
+			return
+		}
+
+		total := returned
+		if args.BrowseFlag == "BrowseDirectChildren" {
+			total = len(items)
+		}
+
+		s.writeXML(ctx, dlnaSOAPResponse(dlnaContentDirectory, action, [][2]string{
+			{"Result", dlnaEscape(result)},
+			{"NumberReturned", strconv.FormatInt(int64(returned), 10)},
+			{"TotalMatches", strconv.FormatInt(int64(total), 10)},
+			{"UpdateID", updateID},
+		}))
+
+	default:
+		s.writeSOAPFault(ctx, 401, "Invalid Action")
+	}
+}
+
+func (s *dlnaServer) onConnectionManager(ctx *gin.Context) {
+	action := soapAction(ctx, dlnaConnectionManager)
+
+	switch action {
+	case "GetProtocolInfo":
+		s.writeXML(ctx, dlnaSOAPResponse(dlnaConnectionManager, action, [][2]string{
+			{"Source", dlnaEscape(dlnaProtocolInfo)},
+			{"Sink", ""},
+		}))
+
+	case "GetCurrentConnectionIDs":
+		s.writeXML(ctx, dlnaSOAPResponse(dlnaConnectionManager, action, [][2]string{
+			{"ConnectionIDs", "0"},
+		}))
+
+	case "GetCurrentConnectionInfo":
+		s.writeXML(ctx, dlnaSOAPResponse(dlnaConnectionManager, action, [][2]string{
+			{"RcsID", "-1"},
+			{"AVTransportID", "-1"},
+			{"ProtocolInfo", ""},
+			{"PeerConnectionManager", ""},
+			{"PeerConnectionID", "-1"},
+			{"Direction", "Output"},
+			{"Status", "OK"},
+		}))
+
+	default:
+		s.writeSOAPFault(ctx, 401, "Invalid Action")
+	}
+}
+
+func (s *dlnaServer) writeSOAPFault(ctx *gin.Context, code int, description string) {
+	ctx.Writer.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	ctx.Writer.WriteHeader(http.StatusInternalServerError)
+	ctx.Writer.Write(dlnaSOAPFault(code, description))
+}
+
+func (s *dlnaServer) onStream(ctx *gin.Context, pathName string) {
+	ctx.Writer.Header().Set("Content-Type", "video/mpeg")
+	ctx.Writer.Header().Set("transferMode.dlna.org", "Streaming")
+	ctx.Writer.Header().Set("contentFeatures.dlna.org", dlnaContentFeatures)
+
+	// clients send HEAD requests to check whether the stream is supported
+	if ctx.Request.Method == http.MethodHead {
+		ctx.Writer.WriteHeader(http.StatusOK)
+		return
+	}
+
+	st := newDLNAStream(ctx.Request.Context(), pathName, s.pathManager, s)
+	st.run(ctx)
+}
+
+// onStreamClose is called by dlnaStream.
+func (s *dlnaServer) onStreamClose(st *dlnaStream, err error) {
+	s.log(logger.Info, "[stream %s] [path %s] closed (%v)", st.id, st.pathName, err)
+}
+
+const dlnaContentDirectorySCPD = `<?xml version="1.0" encoding="utf-8"?>
+<scpd xmlns="urn:schemas-upnp-org:service-1-0">
+<specVersion><major>1</major><minor>0</minor></specVersion>
+<actionList>
+<action><name>GetSearchCapabilities</name><argumentList>
+<argument><name>SearchCaps</name><direction>out</direction>
+<relatedStateVariable>SearchCapabilities</relatedStateVariable></argument>
+</argumentList></action>
+<action><name>GetSortCapabilities</name><argumentList>
+<argument><name>SortCaps</name><direction>out</direction>
+<relatedStateVariable>SortCapabilities</relatedStateVariable></argument>
+</argumentList></action>
+<action><name>GetSystemUpdateID</name><argumentList>
+<argument><name>Id</name><direction>out</direction>
+<relatedStateVariable>SystemUpdateID</relatedStateVariable></argument>
+</argumentList></action>
+<action><name>Browse</name><argumentList>
+<argument><name>ObjectID</name><direction>in</direction>
+<relatedStateVariable>A_ARG_TYPE_ObjectID</relatedStateVariable></argument>
+<argument><name>BrowseFlag</name><direction>in</direction>
+<relatedStateVariable>A_ARG_TYPE_BrowseFlag</relatedStateVariable></argument>
+<argument><name>Filter</name><direction>in</direction>
+<relatedStateVariable>A_ARG_TYPE_Filter</relatedStateVariable></argument>
+<argument><name>StartingIndex</name><direction>in</direction>
+<relatedStateVariable>A_ARG_TYPE_Index</relatedStateVariable></argument>
+<argument><name>RequestedCount</name><direction>in</direction>
+<relatedStateVariable>A_ARG_TYPE_Count</relatedStateVariable></argument>
+<argument><name>SortCriteria</name><direction>in</direction>
+<relatedStateVariable>A_ARG_TYPE_SortCriteria</relatedStateVariable></argument>
+<argument><name>Result</name><direction>out</direction>
+<relatedStateVariable>A_ARG_TYPE_Result</relatedStateVariable></argument>
+<argument><name>NumberReturned</name><direction>out</direction>
+<relatedStateVariable>A_ARG_TYPE_Count</relatedStateVariable></argument>
+<argument><name>TotalMatches</name><direction>out</direction>
+<relatedStateVariable>A_ARG_TYPE_Count</relatedStateVariable></argument>
+<argument><name>UpdateID</name><direction>out</direction>
+<relatedStateVariable>A_ARG_TYPE_UpdateID</relatedStateVariable></argument>
+</argumentList></action>
+</actionList>
+<serviceStateTable>
+<stateVariable sendEvents="no"><name>SearchCapabilities</name><dataType>string</dataType></stateVariable>
+<stateVariable sendEvents="no"><name>SortCapabilities</name><dataType>string</dataType></stateVariable>
+<stateVariable sendEvents="yes"><name>SystemUpdateID</name><dataType>ui4</dataType></stateVariable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_ObjectID</name><dataType>string</dataType></stateVariable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_Result</name><dataType>string</dataType></stateVariable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_BrowseFlag</name><dataType>string</dataType>
+<allowedValueList><allowedValue>BrowseMetadata</allowedValue>
+<allowedValue>BrowseDirectChildren</allowedValue></allowedValueList>
+</stateVariable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_Filter</name><dataType>string</dataType></stateVariable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_SortCriteria</name><dataType>string</dataType></stateVariable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_Index</name><dataType>ui4</dataType></stateVariable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_Count</name><dataType>ui4</dataType></stateVariable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_UpdateID</name><dataType>ui4</dataType></stateVariable>
+</serviceStateTable>
+</scpd>
+`
+
+const dlnaConnectionManagerSCPD = `<?xml version="1.0" encoding="utf-8"?>
+<scpd xmlns="urn:schemas-upnp-org:service-1-0">
+<specVersion><major>1</major><minor>0</minor></specVersion>
+<actionList>
+<action><name>GetProtocolInfo</name><argumentList>
+<argument><name>Source</name><direction>out</direction>
+<relatedStateVariable>SourceProtocolInfo</relatedStateVariable></argument>
+<argument><name>Sink</name><direction>out</direction>
+<relatedStateVariable>SinkProtocolInfo</relatedStateVariable></argument>
+</argumentList></action>
+<action><name>GetCurrentConnectionIDs</name><argumentList>
+<argument><name>ConnectionIDs</name><direction>out</direction>
+<relatedStateVariable>CurrentConnectionIDs</relatedStateVariable></argument>
+</argumentList></action>
+<action><name>GetCurrentConnectionInfo</name><argumentList>
+<argument><name>ConnectionID</name><direction>in</direction>
+<relatedStateVariable>A_ARG_TYPE_ConnectionID</relatedStateVariable></argument>
+<argument><name>RcsID</name><direction>out</direction>
+<relatedStateVariable>A_ARG_TYPE_RcsID</relatedStateVariable></argument>
+<argument><name>AVTransportID</name><direction>out</direction>
+<relatedStateVariable>A_ARG_TYPE_AVTransportID</relatedStateVariable></argument>
+<argument><name>ProtocolInfo</name><direction>out</direction>
+<relatedStateVariable>A_ARG_TYPE_ProtocolInfo</relatedStateVariable></argument>
+<argument><name>PeerConnectionManager</name><direction>out</direction>
+<relatedStateVariable>A_ARG_TYPE_ConnectionManager</relatedStateVariable></argument>
+<argument><name>PeerConnectionID</name><direction>out</direction>
+<relatedStateVariable>A_ARG_TYPE_ConnectionID</relatedStateVariable></argument>
+<argument><name>Direction</name><direction>out</direction>
+<relatedStateVariable>A_ARG_TYPE_Direction</relatedStateVariable></argument>
+<argument><name>Status</name><direction>out</direction>
+<relatedStateVariable>A_ARG_TYPE_ConnectionStatus</relatedStateVariable></argument>
+</argumentList></action>
+</actionList>
+<serviceStateTable>
+<stateVariable sendEvents="yes"><name>SourceProtocolInfo</name><dataType>string</dataType></stateVariable>
+<stateVariable sendEvents="yes"><name>SinkProtocolInfo</name><dataType>string</dataType></stateVariable>
+<stateVariable sendEvents="yes"><name>CurrentConnectionIDs</name><dataType>string</dataType></stateVariable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_ConnectionStatus</name><dataType>string</dataType>
+<allowedValueList><allowedValue>OK</allowedValue><allowedValue>ContentFormatMismatch</allowedValue>
+<allowedValue>InsufficientBandwidth</allowedValue><allowedValue>UnreliableChannel</allowedValue>
+<allowedValue>Unknown</allowedValue></allowedValueList>
+</stateVariable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_ConnectionManager</name><dataType>string</dataType></stateVariable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_Direction</name><dataType>string</dataType>
+<allowedValueList><allowedValue>Input</allowedValue><allowedValue>Output</allowedValue></allowedValueList>
+</stateVariable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_ProtocolInfo</name><dataType>string</dataType></stateVariable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_ConnectionID</name><dataType>i4</dataType></stateVariable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_AVTransportID</name><dataType>i4</dataType></stateVariable>
+<stateVariable sendEvents="no"><name>A_ARG_TYPE_RcsID</name><dataType>i4</dataType></stateVariable>
+</serviceStateTable>
+</scpd>
+`
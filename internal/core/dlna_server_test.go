@@ -0,0 +1,182 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSDP(t *testing.T) {
+	udn := "uuid:01234567-89ab-cdef-0123-456789abcdef"
+
+	st := ssdpParseSearch([]byte("M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: urn:schemas-upnp-org:device:MediaServer:1\r\n" +
+		"\r\n"))
+	require.Equal(t, "urn:schemas-upnp-org:device:MediaServer:1", st)
+
+	// notifications of other devices are ignored
+	require.Equal(t, "", ssdpParseSearch(ssdpNotify(udn, "upnp:rootdevice", true, "http://myhost/rootDesc.xml")))
+
+	require.Equal(t, []string{st}, ssdpMatch(udn, st))
+	require.Equal(t, ssdpTargets(udn), ssdpMatch(udn, "ssdp:all"))
+	require.Equal(t, []string(nil), ssdpMatch(udn, "urn:schemas-upnp-org:device:MediaRenderer:1"))
+
+	res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(
+		ssdpSearchResponse(udn, st, "http://192.168.1.10:8890/rootDesc.xml"))), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "http://192.168.1.10:8890/rootDesc.xml", res.Header.Get("LOCATION"))
+	require.Equal(t, udn+"::"+st, res.Header.Get("USN"))
+	require.Equal(t, "max-age=1800", res.Header.Get("CACHE-CONTROL"))
+
+	require.Equal(t, udn, ssdpUSN(udn, udn))
+}
+
+func dlnaBrowse(t *testing.T, objectID string, flag string) (int, string) {
+	body := `<?xml version="1.0" encoding="utf-8"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"` +
+		` s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>` +
+		`<u:Browse xmlns:u="urn:schemas-upnp-org:service:ContentDirectory:1">` +
+		`<ObjectID>` + objectID + `</ObjectID><BrowseFlag>` + flag + `</BrowseFlag>` +
+		`<Filter>*</Filter><StartingIndex>0</StartingIndex><RequestedCount>0</RequestedCount>` +
+		`<SortCriteria></SortCriteria></u:Browse></s:Body></s:Envelope>`
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:8890/ctl/ContentDirectory", strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("SOAPACTION", `"urn:schemas-upnp-org:service:ContentDirectory:1#Browse"`)
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	byts, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	return res.StatusCode, string(byts)
+}
+
+func TestDLNAServer(t *testing.T) {
+	p, ok := newInstance("rtmpDisable: yes\n" +
+		"hlsDisable: yes\n" +
+		"dlna: yes\n" +
+		"dlnaFriendlyName: my & server\n" +
+		"paths:\n" +
+		"  protected:\n" +
+		"    readUser: myuser\n" +
+		"    readPass: mypass\n" +
+		"  all:\n")
+	require.Equal(t, true, ok)
+	defer p.close()
+
+	track, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x07, 0x01, 0x02, 0x03}, PPS: []byte{0x08}})
+	require.NoError(t, err)
+
+	source := gortsplib.Client{}
+	err = source.StartPublishing("rtsp://localhost:8554/teststream", gortsplib.Tracks{track})
+	require.NoError(t, err)
+	defer source.Close()
+
+	source2 := gortsplib.Client{}
+	err = source2.StartPublishing("rtsp://localhost:8554/protected", gortsplib.Tracks{track})
+	require.NoError(t, err)
+	defer source2.Close()
+
+	res, err := http.Get("http://localhost:8890/rootDesc.xml")
+	require.NoError(t, err)
+	byts, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	require.Contains(t, string(byts), "<friendlyName>my &amp; server</friendlyName>")
+	require.Contains(t, string(byts), "<controlURL>/ctl/ContentDirectory</controlURL>")
+
+	code, body := dlnaBrowse(t, "0", "BrowseDirectChildren")
+	require.Equal(t, http.StatusOK, code)
+
+	var env struct {
+		Body struct {
+			BrowseResponse struct {
+				Result         string `xml:"Result"`
+				NumberReturned int    `xml:"NumberReturned"`
+				TotalMatches   int    `xml:"TotalMatches"`
+			} `xml:"BrowseResponse"`
+		} `xml:"Body"`
+	}
+	err = xml.Unmarshal([]byte(body), &env)
+	require.NoError(t, err)
+
+	// paths that require credentials are not listed
+	require.Equal(t, 1, env.Body.BrowseResponse.TotalMatches)
+	require.Equal(t, `<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/"`+
+		` xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/">`+
+		`<item id="teststream" parentID="0" restricted="1">`+
+		`<dc:title>teststream</dc:title>`+
+		`<upnp:class>object.item.videoItem</upnp:class>`+
+		`<res protocolInfo="`+dlnaProtocolInfo+`">http://localhost:8890/stream/teststream.ts</res>`+
+		`</item></DIDL-Lite>`, env.Body.BrowseResponse.Result)
+
+	code, body = dlnaBrowse(t, "protected", "BrowseMetadata")
+	require.Equal(t, http.StatusInternalServerError, code)
+	require.Contains(t, body, "<errorCode>701</errorCode>")
+
+	res, err = http.Get("http://localhost:8890/stream/protected.ts")
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	res, err = http.Get("http://localhost:8890/stream/teststream.ts")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "Streaming", res.Header.Get("transferMode.dlna.org"))
+	require.Equal(t, dlnaContentFeatures, res.Header.Get("contentFeatures.dlna.org"))
+
+	byts = make([]byte, 188)
+	done := make(chan error)
+	go func() {
+		_, err := io.ReadFull(res.Body, byts)
+		done <- err
+	}()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for seq := uint16(0); ; seq++ {
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+			require.Equal(t, byte(0x47), byts[0])
+			return
+
+		case <-ticker.C:
+			pkt, err := (&rtp.Packet{
+				Header: rtp.Header{
+					Version:        2,
+					Marker:         true,
+					PayloadType:    96,
+					SequenceNumber: seq,
+					Timestamp:      uint32(seq) * 9000,
+					SSRC:           0x9dbb7812,
+				},
+				Payload: []byte{0x05, 0x01}, // IDR
+			}).Marshal()
+			require.NoError(t, err)
+
+			err = source.WritePacketRTP(0, pkt)
+			require.NoError(t, err)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+const (
+	// standard SSDP group and port (UPnP Device Architecture 1.0, section 1).
+	ssdpAddress = "239.255.255.250:1900"
+
+	// validity of announcements.
+	ssdpMaxAge = 1800
+
+	// interval between announcements, that must be shorter than the validity.
+	ssdpNotifyInterval = 10 * time.Minute
+
+	dlnaDeviceType        = "urn:schemas-upnp-org:device:MediaServer:1"
+	dlnaContentDirectory  = "urn:schemas-upnp-org:service:ContentDirectory:1"
+	dlnaConnectionManager = "urn:schemas-upnp-org:service:ConnectionManager:1"
+)
+
+// ssdpTargets returns the notification types of the device and its services.
+func ssdpTargets(udn string) []string {
+	return []string{
+		"upnp:rootdevice",
+		udn,
+		dlnaDeviceType,
+		dlnaContentDirectory,
+		dlnaConnectionManager,
+	}
+}
+
+func ssdpUSN(udn string, nt string) string {
+	if nt == udn {
+		return udn
+	}
+	return udn + "::" + nt
+}
+
+// ssdpMatch returns the targets that match the search target of a M-SEARCH request.
+func ssdpMatch(udn string, st string) []string {
+	if st == "ssdp:all" {
+		return ssdpTargets(udn)
+	}
+
+	for _, t := range ssdpTargets(udn) {
+		if t == st {
+			return []string{t}
+		}
+	}
+
+	return nil
+}
+
+func ssdpNotify(udn string, nt string, alive bool, location string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("NOTIFY * HTTP/1.1\r\n")
+	buf.WriteString("HOST: " + ssdpAddress + "\r\n")
+	buf.WriteString("NT: " + nt + "\r\n")
+	buf.WriteString("USN: " + ssdpUSN(udn, nt) + "\r\n")
+
+	if alive {
+		buf.WriteString("NTS: ssdp:alive\r\n")
+		buf.WriteString("CACHE-CONTROL: max-age=" + strconv.FormatInt(ssdpMaxAge, 10) + "\r\n")
+		buf.WriteString("LOCATION: " + location + "\r\n")
+		buf.WriteString("SERVER: " + dlnaServerHeader() + "\r\n")
+	} else {
+		buf.WriteString("NTS: ssdp:byebye\r\n")
+	}
+
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+func ssdpSearchResponse(udn string, st string, location string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("HTTP/1.1 200 OK\r\n")
+	buf.WriteString("CACHE-CONTROL: max-age=" + strconv.FormatInt(ssdpMaxAge, 10) + "\r\n")
+	buf.WriteString("EXT:\r\n")
+	buf.WriteString("LOCATION: " + location + "\r\n")
+	buf.WriteString("SERVER: " + dlnaServerHeader() + "\r\n")
+	buf.WriteString("ST: " + st + "\r\n")
+	buf.WriteString("USN: " + ssdpUSN(udn, st) + "\r\n")
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// ssdpParseSearch returns the search target of a M-SEARCH request,
+// or an empty string if the packet is not a discovery request.
+func ssdpParseSearch(byts []byte) string {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(byts)))
+	if err != nil {
+		return ""
+	}
+
+	if req.Method != "M-SEARCH" || req.Header.Get("MAN") != `"ssdp:discover"` {
+		return ""
+	}
+
+	return req.Header.Get("ST")
+}
+
+// dlnaSSDP announces the media server with SSDP and answers to discovery requests.
+// Announcements are sent through the interface of the default route only.
+type dlnaSSDP struct {
+	udn      string
+	httpPort int
+	log      func(logger.Level, string, ...interface{})
+
+	listenConn *net.UDPConn
+	notifyConn *net.UDPConn
+	wg         sync.WaitGroup
+
+	// in
+	terminate chan struct{}
+}
+
+func newDLNASSDP(udn string, httpPort int, log func(logger.Level, string, ...interface{})) (*dlnaSSDP, error) {
+	addr, err := net.ResolveUDPAddr("udp4", ssdpAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	listenConn, err := net.ListenMulticastUDP("udp4", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	notifyConn, err := net.DialUDP("udp4", nil, addr)
+	if err != nil {
+		listenConn.Close()
+		return nil, err
+	}
+
+	s := &dlnaSSDP{
+		udn:        udn,
+		httpPort:   httpPort,
+		log:        log,
+		listenConn: listenConn,
+		notifyConn: notifyConn,
+		terminate:  make(chan struct{}),
+	}
+
+	s.wg.Add(2)
+	go s.runNotify()
+	go s.runSearch()
+
+	return s, nil
+}
+
+func (s *dlnaSSDP) close() {
+	close(s.terminate)
+	s.listenConn.Close()
+	s.wg.Wait()
+
+	s.notifyAll(false)
+	s.notifyConn.Close()
+}
+
+// location returns the URL of the device description, reachable through the given local IP.
+func (s *dlnaSSDP) location(ip net.IP) string {
+	return "http://" + net.JoinHostPort(ip.String(), strconv.FormatInt(int64(s.httpPort), 10)) + "/rootDesc.xml"
+}
+
+func (s *dlnaSSDP) notifyAll(alive bool) {
+	location := s.location(s.notifyConn.LocalAddr().(*net.UDPAddr).IP)
+
+	for _, nt := range ssdpTargets(s.udn) {
+		s.notifyConn.Write(ssdpNotify(s.udn, nt, alive, location))
+	}
+}
+
+func (s *dlnaSSDP) runNotify() {
+	defer s.wg.Done()
+
+	s.notifyAll(true)
+
+	t := time.NewTicker(ssdpNotifyInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			s.notifyAll(true)
+
+		case <-s.terminate:
+			return
+		}
+	}
+}
+
+func (s *dlnaSSDP) runSearch() {
+	defer s.wg.Done()
+
+	buf := make([]byte, 2048)
+
+	for {
+		n, source, err := s.listenConn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		st := ssdpParseSearch(buf[:n])
+		if st == "" {
+			continue
+		}
+
+		targets := ssdpMatch(s.udn, st)
+		if targets == nil {
+			continue
+		}
+
+		// the local IP is the one used to reach the client
+		conn, err := net.DialUDP("udp4", nil, source)
+		if err != nil {
+			continue
+		}
+		location := s.location(conn.LocalAddr().(*net.UDPAddr).IP)
+		conn.Close()
+
+		s.log(logger.Debug, "[SSDP] search of '%s' from %v", st, source)
+
+		for _, t := range targets {
+			s.listenConn.WriteToUDP(ssdpSearchResponse(s.udn, t, location), source)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/aler9/gortsplib/pkg/ringbuffer"
+	"github.com/aler9/gortsplib/pkg/rtpaac"
+	"github.com/aler9/gortsplib/pkg/rtph264"
+	"github.com/gin-gonic/gin"
+	"github.com/pion/rtp"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+	"github.com/aler9/rtsp-simple-server/internal/mpegts"
+)
+
+type dlnaStreamTrackIDPayloadPair struct {
+	trackID int
+	buf     []byte
+}
+
+type dlnaStreamParent interface {
+	log(logger.Level, string, ...interface{})
+	onStreamClose(*dlnaStream, error)
+}
+
+// dlnaStreamWriter sends the stream to the client, flushing every write
+// in order to minimize the latency.
+type dlnaStreamWriter struct {
+	w         gin.ResponseWriter
+	bytesSent *uint64
+}
+
+func (w *dlnaStreamWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	atomic.AddUint64(w.bytesSent, uint64(n))
+	if err != nil {
+		return n, err
+	}
+	w.w.Flush()
+	return n, nil
+}
+
+// dlnaStream is a reader that sends a path to a DLNA client as a MPEG-TS stream.
+type dlnaStream struct {
+	id          string
+	pathName    string
+	pathManager dlnaServerPathManager
+	parent      dlnaStreamParent
+
+	ctx        context.Context
+	ctxCancel  func()
+	remoteAddr string
+	created    time.Time
+	bytesSent  *uint64
+	ringBuffer *ringbuffer.RingBuffer
+}
+
+func newDLNAStream(
+	parentCtx context.Context,
+	pathName string,
+	pathManager dlnaServerPathManager,
+	parent dlnaStreamParent,
+) *dlnaStream {
+	ctx, ctxCancel := context.WithCancel(parentCtx)
+
+	var b [4]byte
+	rand.Read(b[:])
+
+	return &dlnaStream{
+		id:          strconv.FormatUint(uint64(binary.LittleEndian.Uint32(b[:])%899999999+100000000), 10),
+		pathName:    pathName,
+		pathManager: pathManager,
+		parent:      parent,
+		ctx:         ctx,
+		ctxCancel:   ctxCancel,
+		created:     time.Now(),
+		bytesSent:   new(uint64),
+	}
+}
+
+// ID implements reader.
+func (st *dlnaStream) ID() string {
+	return st.id
+}
+
+// close implements reader.
+func (st *dlnaStream) close() {
+	st.ctxCancel()
+}
+
+func (st *dlnaStream) log(level logger.Level, format string, args ...interface{}) {
+	st.parent.log(level, "[stream %s] [path %s] "+format, append([]interface{}{st.id, st.pathName}, args...)...)
+}
+
+// run sends the stream until the client disconnects or the reader is closed.
+func (st *dlnaStream) run(ctx *gin.Context) {
+	defer st.ctxCancel()
+
+	st.remoteAddr = ctx.Request.RemoteAddr
+
+	err := st.runInner(ctx)
+	st.parent.onStreamClose(st, err)
+}
+
+func (st *dlnaStream) runInner(ctx *gin.Context) error {
+	tmp, _, _ := net.SplitHostPort(ctx.Request.RemoteAddr)
+
+	res := st.pathManager.onReaderSetupPlay(pathReaderSetupPlayReq{
+		Author:   st,
+		PathName: st.pathName,
+		Protocol: "dlna",
+		IP:       net.ParseIP(tmp),
+		ValidateCredentials: func(pathUser conf.Credential, pathPass conf.Credential) error {
+			return pathErrAuthCritical{Message: "DLNA clients can't provide credentials"}
+		},
+	})
+	if res.Err != nil {
+		if _, ok := res.Err.(pathErrAuthCritical); ok {
+			ctx.Writer.WriteHeader(http.StatusUnauthorized)
+		} else {
+			ctx.Writer.WriteHeader(http.StatusNotFound)
+		}
+		return res.Err
+	}
+
+	defer func() {
+		res.Path.onReaderRemove(pathReaderRemoveReq{Author: st})
+	}()
+
+	var videoTrack *gortsplib.Track
+	videoTrackID := -1
+	var h264Decoder *rtph264.Decoder
+	var audioTrack *gortsplib.Track
+	audioTrackID := -1
+	var aacDecoder *rtpaac.Decoder
+
+	for i, t := range res.Stream.tracks() {
+		switch {
+		case t.IsH264() && videoTrack == nil:
+			videoTrack = t
+			videoTrackID = i
+			h264Decoder = rtph264.NewDecoder()
+
+		case t.IsAAC() && audioTrack == nil:
+			conf, err := t.ExtractConfigAAC()
+			if err != nil {
+				return err
+			}
+
+			audioTrack = t
+			audioTrackID = i
+			aacDecoder = rtpaac.NewDecoder(conf.SampleRate)
+		}
+	}
+
+	if videoTrack == nil && audioTrack == nil {
+		ctx.Writer.WriteHeader(http.StatusUnsupportedMediaType)
+		return fmt.Errorf("the stream doesn't contain an H264 track or an AAC track")
+	}
+
+	ctx.Writer.WriteHeader(http.StatusOK)
+	ctx.Writer.Flush()
+
+	w, err := mpegts.NewWriter(&dlnaStreamWriter{w: ctx.Writer, bytesSent: st.bytesSent}, videoTrack, audioTrack)
+	if err != nil {
+		return err
+	}
+
+	st.ringBuffer = ringbuffer.New(uint64(res.Path.readBufferCount))
+
+	res.Path.onReaderPlay(pathReaderPlayReq{Author: st})
+
+	writerDone := make(chan error)
+	go func() {
+		writerDone <- func() error {
+			for {
+				data, ok := st.ringBuffer.Pull()
+				if !ok {
+					return fmt.Errorf("terminated")
+				}
+				pair := data.(dlnaStreamTrackIDPayloadPair)
+
+				var pkt rtp.Packet
+				err := pkt.Unmarshal(pair.buf)
+				if err != nil {
+					st.log(logger.Warn, "unable to decode RTP packet: %v", err)
+					continue
+				}
+
+				switch pair.trackID {
+				case videoTrackID:
+					nalus, pts, err := h264Decoder.DecodeUntilMarker(&pkt)
+					if err != nil {
+						if err != rtph264.ErrMorePacketsNeeded &&
+							err != rtph264.ErrNonStartingPacketAndNoPrevious {
+							st.log(logger.Warn, "unable to decode video track: %v", err)
+						}
+						continue
+					}
+
+					err = w.WriteH264(pts, nalus)
+					if err != nil {
+						return err
+					}
+
+				case audioTrackID:
+					aus, pts, err := aacDecoder.Decode(&pkt)
+					if err != nil {
+						if err != rtpaac.ErrMorePacketsNeeded {
+							st.log(logger.Warn, "unable to decode audio track: %v", err)
+						}
+						continue
+					}
+
+					err = w.WriteAAC(pts, aus)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}()
+	}()
+
+	select {
+	case err := <-writerDone:
+		return err
+
+	// the context is canceled when the client disconnects,
+	// when the server is closed or when the reader is closed by the path.
+	case <-st.ctx.Done():
+		st.ringBuffer.Close()
+		<-writerDone
+		return fmt.Errorf("terminated")
+	}
+}
+
+// onReaderAccepted implements reader.
+func (st *dlnaStream) onReaderAccepted() {
+	st.log(logger.Info, "is reading from path '%s'", st.pathName)
+}
+
+// onReaderPacketRTP implements reader.
+func (st *dlnaStream) onReaderPacketRTP(trackID int, payload []byte) {
+	st.ringBuffer.Push(dlnaStreamTrackIDPayloadPair{trackID, payload})
+}
+
+// onReaderPacketRTCP implements reader.
+func (st *dlnaStream) onReaderPacketRTCP(trackID int, payload []byte) {
+}
+
+// onReaderAPIDescribe implements reader.
+func (st *dlnaStream) onReaderAPIDescribe() interface{} {
+	return struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+	}{"dlnaStream", st.id}
+}
+
+// onReaderAPIReadersItem implements reader.
+func (st *dlnaStream) onReaderAPIReadersItem() pathAPIPathsReadersItem {
+	return pathAPIPathsReadersItem{
+		Type:       "dlnaStream",
+		ID:         st.id,
+		Protocol:   "dlna",
+		RemoteAddr: st.remoteAddr,
+		Created:    st.created,
+		BytesSent:  atomic.LoadUint64(st.bytesSent),
+	}
+}
@@ -0,0 +1,241 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+type egressAccountingAPIItem struct {
+	BytesSent uint64 `json:"bytesSent"`
+}
+
+type egressAccountingAPIData struct {
+	Items map[string]egressAccountingAPIItem `json:"items"`
+}
+
+type egressAccountingParent interface {
+	Log(logger.Level, string, ...interface{})
+}
+
+// egressAccount contains the bytes sent to a user.
+type egressAccount struct {
+	// fields accessed atomically must be placed first
+	// in order to be aligned on 32-bit platforms.
+	bytesSent uint64
+
+	// protected by egressAccounting.mutex.
+	// Readers are mapped to the bytes they sent before being accounted.
+	readers map[reader]uint64
+}
+
+// onBytesSent is called by HLS muxers when a response is sent to a user.
+func (a *egressAccount) onBytesSent(n uint64) {
+	atomic.AddUint64(&a.bytesSent, n)
+}
+
+// egressAccounting tracks the bytes sent to each authenticated user, across all protocols,
+// and optionally saves them into a file.
+// It is shared by all paths and survives configuration reloads,
+// in order to preserve counters.
+type egressAccounting struct {
+	parent egressAccountingParent
+
+	mutex    sync.Mutex
+	accounts map[string]*egressAccount
+
+	// persistence
+	filePath  string
+	ctxCancel func()
+	done      chan struct{}
+}
+
+func newEgressAccounting(parent egressAccountingParent) *egressAccounting {
+	return &egressAccounting{
+		parent:   parent,
+		accounts: make(map[string]*egressAccount),
+	}
+}
+
+func (e *egressAccounting) log(level logger.Level, format string, args ...interface{}) {
+	e.parent.Log(level, "[egress] "+format, args...)
+}
+
+// account returns the account of a user, creating it if it doesn't exist.
+func (e *egressAccounting) account(user string) *egressAccount {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.accountUnlocked(user)
+}
+
+func (e *egressAccounting) accountUnlocked(user string) *egressAccount {
+	a, ok := e.accounts[user]
+	if !ok {
+		a = &egressAccount{readers: make(map[reader]uint64)}
+		e.accounts[user] = a
+	}
+	return a
+}
+
+// readerAdd starts accounting the bytes sent to a reader, that are obtained
+// from the reader itself, until readerRemove is called.
+func (e *egressAccounting) readerAdd(user string, r reader) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.accountUnlocked(user).readers[r] = 0
+}
+
+// readerRemove stops accounting the bytes sent to a reader.
+func (e *egressAccounting) readerRemove(r reader) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for _, a := range e.accounts {
+		if start, ok := a.readers[r]; ok {
+			a.onBytesSent(readerBytesSent(r, start))
+			delete(a.readers, r)
+			return
+		}
+	}
+}
+
+func readerBytesSent(r reader, start uint64) uint64 {
+	n := r.onReaderAPIReadersItem().BytesSent
+	if n < start {
+		return 0
+	}
+	return n - start
+}
+
+func (e *egressAccounting) bytesSentUnlocked(a *egressAccount) uint64 {
+	n := atomic.LoadUint64(&a.bytesSent)
+	for r, start := range a.readers {
+		n += readerBytesSent(r, start)
+	}
+	return n
+}
+
+// reset resets the counter of a user. It returns false if the user doesn't exist.
+func (e *egressAccounting) reset(user string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	a, ok := e.accounts[user]
+	if !ok {
+		return false
+	}
+
+	atomic.StoreUint64(&a.bytesSent, 0)
+	for r := range a.readers {
+		a.readers[r] = r.onReaderAPIReadersItem().BytesSent
+	}
+	return true
+}
+
+// info returns the bytes sent to every user.
+func (e *egressAccounting) info() map[string]uint64 {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	ret := make(map[string]uint64, len(e.accounts))
+	for user, a := range e.accounts {
+		ret[user] = e.bytesSentUnlocked(a)
+	}
+	return ret
+}
+
+func (e *egressAccounting) apiList() *egressAccountingAPIData {
+	data := &egressAccountingAPIData{
+		Items: make(map[string]egressAccountingAPIItem),
+	}
+
+	for user, n := range e.info() {
+		data.Items[user] = egressAccountingAPIItem{BytesSent: n}
+	}
+
+	return data
+}
+
+// startPersistence loads the counters from a file, if it exists,
+// and starts saving them into the file periodically.
+func (e *egressAccounting) startPersistence(fpath string, period time.Duration) error {
+	if e.done != nil {
+		return nil
+	}
+
+	byts, err := ioutil.ReadFile(fpath)
+	if err == nil {
+		var saved map[string]uint64
+		err = json.Unmarshal(byts, &saved)
+		if err != nil {
+			return err
+		}
+
+		e.mutex.Lock()
+		for user, n := range saved {
+			atomic.StoreUint64(&e.accountUnlocked(user).bytesSent, n)
+		}
+		e.mutex.Unlock()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	ctx, ctxCancel := context.WithCancel(context.Background())
+	e.filePath = fpath
+	e.ctxCancel = ctxCancel
+	e.done = make(chan struct{})
+
+	go e.runPersistence(ctx, period)
+
+	return nil
+}
+
+// stopPersistence saves the counters a last time and stops saving them.
+func (e *egressAccounting) stopPersistence() {
+	if e.done == nil {
+		return
+	}
+
+	e.ctxCancel()
+	<-e.done
+	e.done = nil
+}
+
+func (e *egressAccounting) runPersistence(ctx context.Context, period time.Duration) {
+	defer close(e.done)
+
+	t := time.NewTicker(period)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			e.save()
+
+		case <-ctx.Done():
+			e.save()
+			return
+		}
+	}
+}
+
+func (e *egressAccounting) save() {
+	byts, _ := json.Marshal(e.info())
+
+	// write into a temporary file and rename it, in order not to leave
+	// a truncated file if the server is killed.
+	tmpPath := e.filePath + ".tmp"
+	err := ioutil.WriteFile(tmpPath, byts, 0o600)
+	if err == nil {
+		err = os.Rename(tmpPath, e.filePath)
+	}
+	if err != nil {
+		e.log(logger.Warn, "unable to save counters: %s", err)
+	}
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+type testEgressParent struct{}
+
+func (testEgressParent) Log(logger.Level, string, ...interface{}) {}
+
+type testEgressReader struct {
+	bytesSent uint64
+}
+
+func (r *testEgressReader) ID() string                       { return "" }
+func (r *testEgressReader) close()                           {}
+func (r *testEgressReader) onReaderAccepted()                {}
+func (r *testEgressReader) onReaderPacketRTP(int, []byte)    {}
+func (r *testEgressReader) onReaderPacketRTCP(int, []byte)   {}
+func (r *testEgressReader) onReaderAPIDescribe() interface{} { return nil }
+
+func (r *testEgressReader) onReaderAPIReadersItem() pathAPIPathsReadersItem {
+	return pathAPIPathsReadersItem{BytesSent: atomic.LoadUint64(&r.bytesSent)}
+}
+
+func TestEgressAccounting(t *testing.T) {
+	e := newEgressAccounting(testEgressParent{})
+
+	r1 := &testEgressReader{}
+	e.readerAdd("user1", r1)
+
+	r2 := &testEgressReader{}
+	e.readerAdd("user1", r2)
+
+	e.account("user2").onBytesSent(10)
+
+	r1.bytesSent = 100
+	r2.bytesSent = 50
+	require.Equal(t, map[string]uint64{"user1": 150, "user2": 10}, e.info())
+
+	// bytes of removed readers are preserved
+	e.readerRemove(r1)
+	r1.bytesSent = 200
+	require.Equal(t, map[string]uint64{"user1": 150, "user2": 10}, e.info())
+
+	// readers are accounted from the reset onwards
+	require.Equal(t, true, e.reset("user1"))
+	require.Equal(t, map[string]uint64{"user1": 0, "user2": 10}, e.info())
+	r2.bytesSent = 70
+	require.Equal(t, map[string]uint64{"user1": 20, "user2": 10}, e.info())
+
+	require.Equal(t, false, e.reset("user3"))
+}
+
+func TestEgressAccountingPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtsp-egress")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "egress.json")
+
+	e := newEgressAccounting(testEgressParent{})
+	err = e.startPersistence(fpath, 50*time.Millisecond)
+	require.NoError(t, err)
+
+	e.account("user1").onBytesSent(10)
+
+	require.Eventually(t, func() bool {
+		byts, err := ioutil.ReadFile(fpath)
+		return err == nil && string(byts) == `{"user1":10}`
+	}, 2*time.Second, 20*time.Millisecond)
+
+	// counters are saved when persistence is stopped
+	e.account("user1").onBytesSent(5)
+	e.stopPersistence()
+
+	byts, err := ioutil.ReadFile(fpath)
+	require.NoError(t, err)
+	require.Equal(t, `{"user1":15}`, string(byts))
+
+	// counters are loaded when persistence is started
+	e2 := newEgressAccounting(testEgressParent{})
+	err = e2.startPersistence(fpath, time.Minute)
+	require.NoError(t, err)
+	defer e2.stopPersistence()
+
+	require.Equal(t, map[string]uint64{"user1": 15}, e2.info())
+}
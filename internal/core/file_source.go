@@ -0,0 +1,351 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/aler9/gortsplib/pkg/aac"
+	"github.com/aler9/gortsplib/pkg/h264"
+	"github.com/aler9/gortsplib/pkg/rtpaac"
+	"github.com/aler9/gortsplib/pkg/rtph264"
+	"github.com/pion/rtp"
+
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+	"github.com/aler9/rtsp-simple-server/internal/mp4"
+	"github.com/aler9/rtsp-simple-server/internal/rtcpsenderset"
+)
+
+type fileSourceParent interface {
+	log(logger.Level, string, ...interface{})
+	onSourceStaticSetReady(req pathSourceStaticSetReadyReq) pathSourceStaticSetReadyRes
+	OnSourceStaticSetNotReady(req pathSourceStaticSetNotReadyReq)
+}
+
+// fileSourceTrack is a track of the file that is published.
+type fileSourceTrack struct {
+	trackID int
+	track   *mp4.Track
+	next    int
+
+	h264Encoder *rtph264.Encoder
+	aacEncoder  *rtpaac.Encoder
+}
+
+// timestamp returns the decoding timestamp of a sample.
+func (t *fileSourceTrack) timestamp(v uint64) time.Duration {
+	return time.Duration(v) * time.Second / time.Duration(t.track.TimeScale)
+}
+
+func (t *fileSourceTrack) duration() time.Duration {
+	return t.timestamp(t.track.Duration)
+}
+
+// fileSource is a static source that publishes a MP4 file, in real time and in a loop.
+type fileSource struct {
+	filePath string
+	retry    *sourceRetry
+	wg       *sync.WaitGroup
+	parent   fileSourceParent
+
+	ctx       context.Context
+	ctxCancel func()
+}
+
+func newFileSource(
+	parentCtx context.Context,
+	filePath string,
+	retry *sourceRetry,
+	wg *sync.WaitGroup,
+	parent fileSourceParent) *fileSource {
+	ctx, ctxCancel := context.WithCancel(parentCtx)
+
+	s := &fileSource{
+		filePath:  filePath,
+		retry:     retry,
+		wg:        wg,
+		parent:    parent,
+		ctx:       ctx,
+		ctxCancel: ctxCancel,
+	}
+
+	s.log(logger.Info, "started")
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s
+}
+
+func (s *fileSource) close() {
+	s.log(logger.Info, "stopped")
+	s.ctxCancel()
+}
+
+func (s *fileSource) log(level logger.Level, format string, args ...interface{}) {
+	s.parent.log(level, "[file source] "+format, args...)
+}
+
+func (s *fileSource) run() {
+	defer s.wg.Done()
+
+outer:
+	for {
+		err := s.runInner()
+		if err == nil {
+			break outer
+		}
+
+		s.log(logger.Info, "ERR: %s", err)
+
+		pause, ok := s.retry.onFailure()
+		if !ok {
+			s.log(logger.Info, "too many consecutive failures, giving up")
+			break outer
+		}
+
+		select {
+		case <-time.After(pause):
+		case <-s.ctx.Done():
+			break outer
+		}
+	}
+
+	s.ctxCancel()
+}
+
+// runInner publishes the file until the source is closed (and returns nil) or an error occurs.
+func (s *fileSource) runInner() error {
+	s.log(logger.Debug, "opening %s", s.filePath)
+
+	f, err := os.Open(s.filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	rd, err := mp4.NewReader(f, fi.Size())
+	if err != nil {
+		return err
+	}
+
+	var tracks gortsplib.Tracks
+	var fileTracks []*fileSourceTrack
+
+	for _, mt := range rd.Tracks {
+		if len(mt.Samples) == 0 {
+			continue
+		}
+
+		switch mt.Codec {
+		case mp4.CodecH264:
+			if mt.NALULengthSize != 4 {
+				return fmt.Errorf("unsupported NALU length size: %d", mt.NALULengthSize)
+			}
+
+			track, err := gortsplib.NewTrackH264(96, &gortsplib.TrackConfigH264{SPS: mt.SPS, PPS: mt.PPS})
+			if err != nil {
+				return err
+			}
+
+			fileTracks = append(fileTracks, &fileSourceTrack{
+				trackID:     len(tracks),
+				track:       mt,
+				h264Encoder: rtph264.NewEncoder(96, nil, nil, nil),
+			})
+			tracks = append(tracks, track)
+
+		case mp4.CodecAAC:
+			var mpegConf aac.MPEG4AudioConfig
+			err := mpegConf.Decode(mt.AACConfig)
+			if err != nil {
+				return err
+			}
+
+			track, err := gortsplib.NewTrackAAC(97, &gortsplib.TrackConfigAAC{
+				Type:              int(mpegConf.Type),
+				SampleRate:        mpegConf.SampleRate,
+				ChannelCount:      mpegConf.ChannelCount,
+				AOTSpecificConfig: mpegConf.AOTSpecificConfig,
+			})
+			if err != nil {
+				return err
+			}
+
+			fileTracks = append(fileTracks, &fileSourceTrack{
+				trackID:    len(tracks),
+				track:      mt,
+				aacEncoder: rtpaac.NewEncoder(97, mpegConf.SampleRate, nil, nil, nil),
+			})
+			tracks = append(tracks, track)
+		}
+	}
+
+	if len(tracks) == 0 {
+		return fmt.Errorf("the file doesn't contain any sample")
+	}
+
+	// a loop lasts as long as the longest track.
+	var loopDuration time.Duration
+	for _, ft := range fileTracks {
+		if d := ft.duration(); d > loopDuration {
+			loopDuration = d
+		}
+	}
+	if loopDuration <= 0 {
+		return fmt.Errorf("the file has an invalid duration")
+	}
+
+	res := s.parent.onSourceStaticSetReady(pathSourceStaticSetReadyReq{
+		Source: s,
+		Tracks: tracks,
+	})
+	if res.Err != nil {
+		return res.Err
+	}
+
+	s.log(logger.Info, "ready")
+	s.retry.onSuccess()
+
+	defer func() {
+		s.parent.OnSourceStaticSetNotReady(pathSourceStaticSetNotReadyReq{Source: s})
+	}()
+
+	rtcpSenders := rtcpsenderset.New(tracks, res.Stream.onPacketRTCP)
+	defer rtcpSenders.Close()
+
+	start := time.Now()
+	var loopOffset time.Duration
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		// pick the sample with the lowest decoding timestamp among all tracks
+		var cur *fileSourceTrack
+		for _, ft := range fileTracks {
+			if ft.next >= len(ft.track.Samples) {
+				continue
+			}
+			if cur == nil || ft.timestamp(ft.track.Samples[ft.next].DTS) <
+				cur.timestamp(cur.track.Samples[cur.next].DTS) {
+				cur = ft
+			}
+		}
+
+		// end of file: start again from the beginning
+		if cur == nil {
+			s.log(logger.Debug, "end of file reached, looping")
+			loopOffset += loopDuration
+			for _, ft := range fileTracks {
+				ft.next = 0
+			}
+			continue
+		}
+
+		sample := &cur.track.Samples[cur.next]
+		cur.next++
+
+		dts := loopOffset + cur.timestamp(sample.DTS)
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(time.Until(start.Add(dts)))
+
+		select {
+		case <-timer.C:
+		case <-s.ctx.Done():
+			return nil
+		}
+
+		buf, err := rd.ReadSample(sample)
+		if err != nil {
+			return err
+		}
+
+		pkts, err := cur.encode(buf, dts, sample)
+		if err != nil {
+			return err
+		}
+
+		for _, pkt := range pkts {
+			rtcpSenders.OnPacketRTP(cur.trackID, pkt)
+			res.Stream.onPacketRTP(cur.trackID, pkt)
+		}
+	}
+}
+
+// encode encodes a sample into RTP packets.
+func (t *fileSourceTrack) encode(buf []byte, dts time.Duration, sample *mp4.Sample) ([][]byte, error) {
+	if t.h264Encoder != nil {
+		nalus, err := h264.DecodeAVCC(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		var outNALUs [][]byte
+		for _, nalu := range nalus {
+			if len(nalu) == 0 {
+				continue
+			}
+
+			// remove SPS, PPS and AUD, not needed by RTSP / RTMP
+			switch h264.NALUType(nalu[0] & 0x1F) {
+			case h264.NALUTypeSPS, h264.NALUTypePPS, h264.NALUTypeAccessUnitDelimiter:
+				continue
+			}
+			outNALUs = append(outNALUs, nalu)
+		}
+
+		if len(outNALUs) == 0 {
+			return nil, nil
+		}
+
+		pts := dts + time.Duration(sample.PTSOffset)*time.Second/time.Duration(t.track.TimeScale)
+
+		pkts, err := t.h264Encoder.Encode(outNALUs, pts)
+		if err != nil {
+			return nil, fmt.Errorf("error while encoding H264: %v", err)
+		}
+
+		return marshalRTPPackets(pkts)
+	}
+
+	pkts, err := t.aacEncoder.Encode([][]byte{buf}, dts)
+	if err != nil {
+		return nil, fmt.Errorf("error while encoding AAC: %v", err)
+	}
+
+	return marshalRTPPackets(pkts)
+}
+
+func marshalRTPPackets(pkts []*rtp.Packet) ([][]byte, error) {
+	ret := make([][]byte, len(pkts))
+	for i, pkt := range pkts {
+		byts, err := pkt.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = byts
+	}
+	return ret, nil
+}
+
+// onSourceAPIDescribe implements source.
+func (s *fileSource) onSourceAPIDescribe() interface{} {
+	return struct {
+		Type string `json:"type"`
+	}{"fileSource"}
+}
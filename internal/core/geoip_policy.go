@@ -0,0 +1,120 @@
+package core
+
+import (
+	"net"
+	"sync"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+	"github.com/aler9/rtsp-simple-server/internal/geoip"
+)
+
+// geoIPPolicy allows reading and publishing only to clients of some countries.
+// Global countries and countries of paths must both allow a client.
+// It is shared by all servers and survives configuration reloads,
+// in order to preserve counters.
+type geoIPPolicy struct {
+	mutex            sync.Mutex
+	dbPath           string
+	db               *geoip.Database
+	readCountries    conf.Countries
+	publishCountries conf.Countries
+	decisions        map[string][2]int64 // allowed and rejected clients of every country
+}
+
+func newGeoIPPolicy() *geoIPPolicy {
+	return &geoIPPolicy{
+		decisions: make(map[string][2]int64),
+	}
+}
+
+// setDatabase loads the database, if it is different from the current one.
+// An empty path unloads it.
+func (g *geoIPPolicy) setDatabase(fpath string) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if fpath == g.dbPath {
+		return nil
+	}
+
+	var db *geoip.Database
+	if fpath != "" {
+		var err error
+		db, err = geoip.Open(fpath)
+		if err != nil {
+			return err
+		}
+	}
+
+	g.dbPath = fpath
+	g.db = db
+	return nil
+}
+
+// setCountries sets the global countries.
+func (g *geoIPPolicy) setCountries(read conf.Countries, publish conf.Countries) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.readCountries = read
+	g.publishCountries = publish
+}
+
+func (g *geoIPPolicy) globalCountries(action string) conf.Countries {
+	if action == "publish" {
+		return g.publishCountries
+	}
+	return g.readCountries
+}
+
+// enabled checks whether an action ("read" or "publish") is restricted by country.
+func (g *geoIPPolicy) enabled(action string, pathCountries conf.Countries) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.db != nil && (len(g.globalCountries(action)) != 0 || len(pathCountries) != 0)
+}
+
+// check checks whether a client IP is allowed to perform an action on a path.
+// It returns the country of the IP too.
+func (g *geoIPPolicy) check(ip net.IP, action string, pathCountries conf.Countries) (string, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.db == nil {
+		return "", true
+	}
+
+	// IPs that can't be looked up are treated like IPs outside the database
+	country, _ := g.db.Country(ip)
+	if country == "" {
+		country = conf.CountryUnknown
+	}
+
+	allowed := true
+	for _, countries := range []conf.Countries{g.globalCountries(action), pathCountries} {
+		if len(countries) != 0 && !countries.Contains(country) {
+			allowed = false
+		}
+	}
+
+	v := g.decisions[country]
+	if allowed {
+		v[0]++
+	} else {
+		v[1]++
+	}
+	g.decisions[country] = v
+
+	return country, allowed
+}
+
+// counts returns the number of allowed and rejected clients of every country.
+func (g *geoIPPolicy) counts() map[string][2]int64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	ret := make(map[string][2]int64, len(g.decisions))
+	for country, v := range g.decisions {
+		ret[country] = v
+	}
+	return ret
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+)
+
+// writeTestGeoIPDatabase writes a MaxMind DB file with an IPv4 tree,
+// in which the country of 127.0.0.0/8 is IT.
+func writeTestGeoIPDatabase() (string, error) {
+	const nodeCount = 8
+	const network = 127
+
+	var buf []byte
+	for i := 0; i < nodeCount; i++ {
+		bit := (network >> (7 - uint(i))) & 1
+
+		next := i + 1
+		if next == nodeCount {
+			next = nodeCount + 16 // first record of the data section
+		}
+
+		records := [2]int{nodeCount, nodeCount}
+		records[bit] = next
+
+		for _, r := range records {
+			buf = append(buf, byte(r>>16), byte(r>>8), byte(r))
+		}
+	}
+
+	buf = append(buf, make([]byte, 16)...)
+
+	// {"country": {"iso_code": "IT"}}
+	buf = append(buf, 0xE1, 0x47)
+	buf = append(buf, "country"...)
+	buf = append(buf, 0xE1, 0x48)
+	buf = append(buf, "iso_code"...)
+	buf = append(buf, 0x42)
+	buf = append(buf, "IT"...)
+
+	// metadata
+	buf = append(buf, "\xab\xcd\xefMaxMind.com"...)
+	buf = append(buf, 0xE3, 0x4A)
+	buf = append(buf, "node_count"...)
+	buf = append(buf, 0xA1, nodeCount, 0x4B)
+	buf = append(buf, "record_size"...)
+	buf = append(buf, 0xA1, 24, 0x4A)
+	buf = append(buf, "ip_version"...)
+	buf = append(buf, 0xA1, 4)
+
+	return writeTempFile(buf)
+}
+
+func TestGeoIPPolicy(t *testing.T) {
+	dbPath, err := writeTestGeoIPDatabase()
+	require.NoError(t, err)
+	defer os.Remove(dbPath)
+
+	g := newGeoIPPolicy()
+
+	// without a database, nothing is restricted
+	require.Equal(t, false, g.enabled("read", conf.Countries{"FR"}))
+
+	err = g.setDatabase(dbPath)
+	require.NoError(t, err)
+
+	require.Equal(t, false, g.enabled("read", nil))
+
+	g.setCountries(conf.Countries{"IT", conf.CountryUnknown}, nil)
+	require.Equal(t, true, g.enabled("read", nil))
+	require.Equal(t, false, g.enabled("publish", nil))
+
+	for _, ca := range []struct {
+		name    string
+		ip      string
+		action  string
+		path    conf.Countries
+		country string
+		allowed bool
+	}{
+		{"global", "127.0.0.1", "read", nil, "IT", true},
+		{"unknown", "10.0.0.1", "read", nil, conf.CountryUnknown, true},
+		{"path", "127.0.0.1", "read", conf.Countries{"FR"}, "IT", false},
+		{"path unknown", "10.0.0.1", "read", conf.Countries{"IT"}, conf.CountryUnknown, false},
+		{"publish", "127.0.0.1", "publish", conf.Countries{"IT"}, "IT", true},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			country, allowed := g.check(net.ParseIP(ca.ip), ca.action, ca.path)
+			require.Equal(t, ca.country, country)
+			require.Equal(t, ca.allowed, allowed)
+		})
+	}
+
+	require.Equal(t, map[string][2]int64{
+		"IT":                {2, 1},
+		conf.CountryUnknown: {1, 1},
+	}, g.counts())
+
+	err = g.setDatabase("/nonexisting.mmdb")
+	require.Error(t, err)
+}
@@ -31,6 +31,7 @@ type hikkaMuxerResponse struct {
 
 type hikkaServerParent interface {
 	Log(logger.Level, string, ...interface{})
+	LogAccess(logger.AccessEntry)
 }
 
 type hikkaServer struct {
@@ -40,7 +41,6 @@ type hikkaServer struct {
 	hikkaAllowOrigin     string
 	readBufferCount      int
 	pathManager          *pathManager
-	metrics              *metrics
 	parent               hikkaServerParent
 	request              chan hikkaMuxerRequest
 	ctx                  context.Context
@@ -58,7 +58,6 @@ func newHikkaServer(
 	hikkaAllowOrigin string,
 	readBufferCount int,
 	pathManager *pathManager,
-	metrics *metrics,
 	parent hikkaServerParent,
 ) (*hikkaServer, error) {
 	ln, err := net.Listen("tcp", address)
@@ -76,7 +75,6 @@ func newHikkaServer(
 		readBufferCount:      readBufferCount,
 		pathManager:          pathManager,
 		parent:               parent,
-		metrics:              metrics,
 		request:              make(chan hikkaMuxerRequest),
 		ctx:                  ctx,
 		ctxCancel:            ctxCancel,
@@ -106,6 +104,7 @@ func (s *hikkaServer) run() {
 	defer s.wg.Done()
 
 	router := gin.New()
+	router.Use(httpAccessLog("hikka", s.parent))
 	// router.NoRoute(s.onRequest)
 
 	router.GET("/ping", func(c *gin.Context) {
@@ -29,75 +29,14 @@ const (
 	closeAfterInactivity = 60 * time.Second
 )
 
-const index = `<!DOCTYPE html>
-<html>
-<head>
-<meta charset="utf-8">
-<style>
-html, body {
-	margin: 0;
-	padding: 0;
-	height: 100%;
-}
-#video {
-	width: 100%;
-	height: 100%;
-	background: black;
-}
-</style>
-</head>
-<body>
-
-<video id="video" muted controls autoplay></video>
-
-<script src="https://cdn.jsdelivr.net/npm/hls.js@1.0.0"></script>
-
-<script>
-
-const create = () => {
-	const video = document.getElementById('video');
-
-	if (video.canPlayType('application/vnd.apple.mpegurl')) {
-		// since it's not possible to detect timeout errors in iOS,
-		// wait for the playlist to be available before starting the stream
-		fetch('stream.m3u8')
-			.then(() => {
-				video.src = 'index.m3u8';
-				video.play();
-			});
-
-	} else {
-		const hls = new Hls({
-			progressive: false,
-		});
-
-		hls.on(Hls.Events.ERROR, (evt, data) => {
-			if (data.fatal) {
-				hls.destroy();
-
-				setTimeout(create, 2000);
-			}
-		});
-
-		hls.loadSource('index.m3u8');
-		hls.attachMedia(video);
-
-		video.play();
-	}
-};
-
-window.addEventListener('DOMContentLoaded', create);
-
-</script>
-
-</body>
-</html>
-`
-
 type hlsMuxerResponse struct {
 	Status int
 	Header map[string]string
 	Body   io.Reader
+
+	// set when Body is a file that doesn't change,
+	// in order to answer range and conditional requests.
+	ModTime time.Time
 }
 
 type hlsMuxerRequest struct {
@@ -108,8 +47,32 @@ type hlsMuxerRequest struct {
 }
 
 type hlsMuxerTrackIDPayloadPair struct {
-	trackID int
-	buf     []byte
+	trackID  int
+	buf      []byte
+	isRTCP   bool
+	recvTime time.Time
+}
+
+// hlsMuxerCountingReader counts the bytes read from a response body.
+type hlsMuxerCountingReader struct {
+	r       io.Reader
+	count   *uint64
+	account *egressAccount
+}
+
+func (r *hlsMuxerCountingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	atomic.AddUint64(r.count, uint64(n))
+	if r.account != nil {
+		r.account.onBytesSent(uint64(n))
+	}
+	return n, err
+}
+
+// Seek is used to serve ranges of files. It must be called only
+// when the body is an io.Seeker.
+func (r *hlsMuxerCountingReader) Seek(offset int64, whence int) (int64, error) {
+	return r.r.(io.Seeker).Seek(offset, whence)
 }
 
 type hlsMuxerPathManager interface {
@@ -119,62 +82,96 @@ type hlsMuxerPathManager interface {
 type hlsMuxerParent interface {
 	log(logger.Level, string, ...interface{})
 	onMuxerClose(*hlsMuxer)
+	onMuxerSegment(time.Duration)
 }
 
 type hlsMuxer struct {
-	name               string
-	hlsAlwaysRemux     bool
-	hlsSegmentCount    int
-	hlsSegmentDuration conf.StringDuration
-	readBufferCount    int
-	wg                 *sync.WaitGroup
-	pathName           string
-	pathManager        hlsMuxerPathManager
-	parent             hlsMuxerParent
+	id                       string
+	name                     string
+	hlsAlwaysRemux           bool
+	hlsAlwaysRemuxCloseAfter conf.StringDuration
+	hlsSegmentCount          int
+	hlsSegmentDuration       conf.StringDuration
+	hlsEncryption            bool
+	hlsEncryptionKeyRotation conf.StringDuration
+	hlsDirectory             string
+	hlsPushURL               string
+	wg                       *sync.WaitGroup
+	pathName                 string
+	query                    string
+	pathManager              hlsMuxerPathManager
+	geoIP                    *geoIPPolicy
+	egress                   *egressAccounting
+	parent                   hlsMuxerParent
 
 	ctx             context.Context
 	ctxCancel       func()
 	path            *path
 	ringBuffer      *ringbuffer.RingBuffer
+	created         time.Time
 	lastRequestTime *int64
+	lastClientMutex sync.Mutex
+	lastRemoteAddr  string
+	lastUser        string
+	bytesSent       *uint64
 	muxer           *hls.Muxer
 	requests        []hlsMuxerRequest
 
 	// in
 	request                chan hlsMuxerRequest
+	drain                  chan struct{}
 	hlsServerAPIMuxersList chan hlsServerAPIMuxersListSubReq
 }
 
 func newHLSMuxer(
 	parentCtx context.Context,
+	id string,
 	name string,
 	hlsAlwaysRemux bool,
+	hlsAlwaysRemuxCloseAfter conf.StringDuration,
 	hlsSegmentCount int,
 	hlsSegmentDuration conf.StringDuration,
-	readBufferCount int,
+	hlsEncryption bool,
+	hlsEncryptionKeyRotation conf.StringDuration,
+	hlsDirectory string,
+	hlsPushURL string,
 	wg *sync.WaitGroup,
 	pathName string,
+	query string,
 	pathManager hlsMuxerPathManager,
+	geoIP *geoIPPolicy,
+	egress *egressAccounting,
 	parent hlsMuxerParent) *hlsMuxer {
 	ctx, ctxCancel := context.WithCancel(parentCtx)
 
 	m := &hlsMuxer{
-		name:               name,
-		hlsAlwaysRemux:     hlsAlwaysRemux,
-		hlsSegmentCount:    hlsSegmentCount,
-		hlsSegmentDuration: hlsSegmentDuration,
-		readBufferCount:    readBufferCount,
-		wg:                 wg,
-		pathName:           pathName,
-		pathManager:        pathManager,
-		parent:             parent,
-		ctx:                ctx,
-		ctxCancel:          ctxCancel,
+		id:                       id,
+		name:                     name,
+		hlsAlwaysRemux:           hlsAlwaysRemux,
+		hlsAlwaysRemuxCloseAfter: hlsAlwaysRemuxCloseAfter,
+		hlsSegmentCount:          hlsSegmentCount,
+		hlsSegmentDuration:       hlsSegmentDuration,
+		hlsEncryption:            hlsEncryption,
+		hlsEncryptionKeyRotation: hlsEncryptionKeyRotation,
+		hlsDirectory:             hlsDirectory,
+		hlsPushURL:               hlsPushURL,
+		wg:                       wg,
+		pathName:                 pathName,
+		query:                    query,
+		pathManager:              pathManager,
+		geoIP:                    geoIP,
+		egress:                   egress,
+		parent:                   parent,
+		ctx:                      ctx,
+		ctxCancel:                ctxCancel,
+		created:                  time.Now(),
 		lastRequestTime: func() *int64 {
 			v := time.Now().Unix()
 			return &v
 		}(),
+		bytesSent:              new(uint64),
 		request:                make(chan hlsMuxerRequest),
+		drain:                  make(chan struct{}),
 		hlsServerAPIMuxersList: make(chan hlsServerAPIMuxersListSubReq),
 	}
 
@@ -191,7 +188,12 @@ func (m *hlsMuxer) close() {
 }
 
 func (m *hlsMuxer) log(level logger.Level, format string, args ...interface{}) {
-	m.parent.log(level, "[muxer %s] "+format, append([]interface{}{m.pathName}, args...)...)
+	m.parent.log(level, "[muxer %s] [session %s] "+format, append([]interface{}{m.pathName, m.id}, args...)...)
+}
+
+// ID returns the ID of the muxer.
+func (m *hlsMuxer) ID() string {
+	return m.id
 }
 
 // PathName returns the path name.
@@ -210,6 +212,7 @@ func (m *hlsMuxer) run() {
 	}()
 
 	isReady := false
+	draining := false
 
 	err := func() error {
 		for {
@@ -228,12 +231,22 @@ func (m *hlsMuxer) run() {
 
 			case req := <-m.hlsServerAPIMuxersList:
 				req.Data.Items[m.name] = hlsServerAPIMuxersListItem{
+					ID:          m.id,
 					LastRequest: time.Unix(atomic.LoadInt64(m.lastRequestTime), 0).String(),
 				}
 				close(req.Res)
 
+			case <-m.drain:
+				draining = true
+				if isReady {
+					m.end()
+				}
+
 			case <-innerReady:
 				isReady = true
+				if draining {
+					m.end()
+				}
 				for _, req := range m.requests {
 					req.Res <- m.handleRequest(req)
 				}
@@ -261,6 +274,8 @@ func (m *hlsMuxer) runInner(innerCtx context.Context, innerReady chan struct{})
 	res := m.pathManager.onReaderSetupPlay(pathReaderSetupPlayReq{
 		Author:              m,
 		PathName:            m.pathName,
+		Query:               m.query,
+		Protocol:            "hls",
 		IP:                  nil,
 		ValidateCredentials: nil,
 	})
@@ -274,12 +289,21 @@ func (m *hlsMuxer) runInner(innerCtx context.Context, innerReady chan struct{})
 		m.path.onReaderRemove(pathReaderRemoveReq{Author: m})
 	}()
 
+	if m.path.Conf().HLSDisable {
+		return fmt.Errorf("HLS is disabled on this path")
+	}
+
+	// the path can override the server setting
+	m.hlsAlwaysRemux = m.path.Conf().HLSAlwaysRemux.Resolve(m.hlsAlwaysRemux)
+
 	var videoTrack *gortsplib.Track
 	videoTrackID := -1
 	var h264Decoder *rtph264.Decoder
+	var videoNTPEst *ntpEstimator
 	var audioTrack *gortsplib.Track
 	audioTrackID := -1
 	var aacDecoder *rtpaac.Decoder
+	var audioNTPEst *ntpEstimator
 
 	for i, t := range res.Stream.tracks() {
 		if t.IsH264() {
@@ -291,6 +315,7 @@ func (m *hlsMuxer) runInner(innerCtx context.Context, innerReady chan struct{})
 			videoTrackID = i
 
 			h264Decoder = rtph264.NewDecoder()
+			videoNTPEst = newNTPEstimator(90000)
 		} else if t.IsAAC() {
 			if audioTrack != nil {
 				return fmt.Errorf("can't read track %d with HLS: too many tracks", i+1)
@@ -305,6 +330,7 @@ func (m *hlsMuxer) runInner(innerCtx context.Context, innerReady chan struct{})
 			}
 
 			aacDecoder = rtpaac.NewDecoder(conf.SampleRate)
+			audioNTPEst = newNTPEstimator(conf.SampleRate)
 		}
 	}
 
@@ -312,12 +338,41 @@ func (m *hlsMuxer) runInner(innerCtx context.Context, innerReady chan struct{})
 		return fmt.Errorf("the stream doesn't contain an H264 track or an AAC track")
 	}
 
+	dir := ""
+	if m.hlsDirectory != "" {
+		// prevent paths from writing outside of the directory
+		if strings.Contains(m.pathName, "..") {
+			return fmt.Errorf("path name can't be used to build a directory")
+		}
+
+		dir = strings.ReplaceAll(m.hlsDirectory, conf.PathNamePlaceholder, m.pathName)
+	}
+
+	pushURL := ""
+	if m.hlsPushURL != "" {
+		// prevent paths from writing outside of the base URL
+		if strings.Contains(m.pathName, "..") {
+			return fmt.Errorf("path name can't be used to build a URL")
+		}
+
+		pushURL = strings.ReplaceAll(m.hlsPushURL, conf.PathNamePlaceholder, m.pathName)
+	}
+
 	var err error
 	m.muxer, err = hls.NewMuxer(
 		m.hlsSegmentCount,
 		time.Duration(m.hlsSegmentDuration),
+		m.hlsEncryption,
+		time.Duration(m.hlsEncryptionKeyRotation),
+		dir,
+		pushURL,
+		func(err error) {
+			m.log(logger.Warn, "unable to push: %v", err)
+		},
+		m.path.Conf().HLSAudioOnlyRendition,
 		videoTrack,
 		audioTrack,
+		m.parent.onMuxerSegment,
 	)
 	if err != nil {
 		return err
@@ -326,7 +381,7 @@ func (m *hlsMuxer) runInner(innerCtx context.Context, innerReady chan struct{})
 
 	innerReady <- struct{}{}
 
-	m.ringBuffer = ringbuffer.New(uint64(m.readBufferCount))
+	m.ringBuffer = ringbuffer.New(uint64(m.path.readBufferCount))
 
 	m.path.onReaderPlay(pathReaderPlayReq{Author: m})
 
@@ -340,6 +395,15 @@ func (m *hlsMuxer) runInner(innerCtx context.Context, innerReady chan struct{})
 				}
 				pair := data.(hlsMuxerTrackIDPayloadPair)
 
+				if pair.isRTCP {
+					if videoTrack != nil && pair.trackID == videoTrackID {
+						videoNTPEst.processRTCP(pair.buf)
+					} else if audioTrack != nil && pair.trackID == audioTrackID {
+						audioNTPEst.processRTCP(pair.buf)
+					}
+					continue
+				}
+
 				if videoTrack != nil && pair.trackID == videoTrackID {
 					var pkt rtp.Packet
 					err := pkt.Unmarshal(pair.buf)
@@ -357,7 +421,7 @@ func (m *hlsMuxer) runInner(innerCtx context.Context, innerReady chan struct{})
 						continue
 					}
 
-					err = m.muxer.WriteH264(pts, nalus)
+					err = m.muxer.WriteH264(videoNTPEst.estimate(pair.recvTime, pkt.Timestamp), pts, nalus)
 					if err != nil {
 						return err
 					}
@@ -377,7 +441,7 @@ func (m *hlsMuxer) runInner(innerCtx context.Context, innerReady chan struct{})
 						continue
 					}
 
-					err = m.muxer.WriteAAC(pts, aus)
+					err = m.muxer.WriteAAC(audioNTPEst.estimate(pair.recvTime, pkt.Timestamp), pts, aus)
 					if err != nil {
 						return err
 					}
@@ -386,6 +450,13 @@ func (m *hlsMuxer) runInner(innerCtx context.Context, innerReady chan struct{})
 		}()
 	}()
 
+	// muxers that are always remuxed are closed only if explicitly requested,
+	// in order not to waste resources with streams that are never watched.
+	closeAfter := closeAfterInactivity
+	if m.hlsAlwaysRemux {
+		closeAfter = time.Duration(m.hlsAlwaysRemuxCloseAfter)
+	}
+
 	closeCheckTicker := time.NewTicker(closeCheckPeriod)
 	defer closeCheckTicker.Stop()
 
@@ -393,7 +464,7 @@ func (m *hlsMuxer) runInner(innerCtx context.Context, innerReady chan struct{})
 		select {
 		case <-closeCheckTicker.C:
 			t := time.Unix(atomic.LoadInt64(m.lastRequestTime), 0)
-			if !m.hlsAlwaysRemux && time.Since(t) >= closeAfterInactivity {
+			if closeAfter != 0 && time.Since(t) >= closeAfter {
 				m.ringBuffer.Close()
 				<-writerDone
 				return nil
@@ -411,6 +482,46 @@ func (m *hlsMuxer) runInner(innerCtx context.Context, innerReady chan struct{})
 }
 
 func (m *hlsMuxer) handleRequest(req hlsMuxerRequest) hlsMuxerResponse {
+	user, _, _ := req.Req.BasicAuth()
+	m.lastClientMutex.Lock()
+	m.lastRemoteAddr = req.Req.RemoteAddr
+	m.lastUser = user
+	m.lastClientMutex.Unlock()
+
+	res := m.handleRequestInner(req)
+
+	conf := m.path.Conf()
+
+	if res.Body != nil {
+		cr := &hlsMuxerCountingReader{r: res.Body, count: m.bytesSent}
+
+		// users are authenticated only when the path requires credentials
+		if conf.ReadUser != "" && res.Status == http.StatusOK {
+			cr.account = m.egress.account(user)
+		}
+
+		res.Body = cr
+	}
+
+	// headers of the path override the ones of the server
+	if conf.HLSAllowOrigin != "" || len(conf.HLSHeaders) != 0 {
+		if res.Header == nil {
+			res.Header = make(map[string]string)
+		}
+
+		if conf.HLSAllowOrigin != "" {
+			res.Header["Access-Control-Allow-Origin"] = conf.HLSAllowOrigin
+		}
+
+		for k, v := range conf.HLSHeaders {
+			res.Header[k] = v
+		}
+	}
+
+	return res
+}
+
+func (m *hlsMuxer) handleRequestInner(req hlsMuxerRequest) hlsMuxerResponse {
 	atomic.StoreInt64(m.lastRequestTime, time.Now().Unix())
 
 	conf := m.path.Conf()
@@ -424,9 +535,19 @@ func (m *hlsMuxer) handleRequest(req hlsMuxerRequest) hlsMuxerResponse {
 		}
 	}
 
+	if m.geoIP.enabled("read", conf.ReadCountries) {
+		tmp, _, _ := net.SplitHostPort(req.Req.RemoteAddr)
+		if ip := net.ParseIP(tmp); ip != nil {
+			if country, ok := m.geoIP.check(ip, "read", conf.ReadCountries); !ok {
+				m.log(logger.Info, "country '%s' of ip '%s' not allowed", country, ip)
+				return hlsMuxerResponse{Status: http.StatusUnauthorized}
+			}
+		}
+	}
+
 	if conf.ReadUser != "" {
 		user, pass, ok := req.Req.BasicAuth()
-		if !ok || user != string(conf.ReadUser) || pass != string(conf.ReadPass) {
+		if !ok || user != string(conf.Resolved().ReadUser) || pass != string(conf.Resolved().ReadPass) {
 			return hlsMuxerResponse{
 				Status: http.StatusUnauthorized,
 				Header: map[string]string{
@@ -455,6 +576,20 @@ func (m *hlsMuxer) handleRequest(req hlsMuxerRequest) hlsMuxerResponse {
 			Body: m.muxer.StreamPlaylist(),
 		}
 
+	case req.File == "audio.m3u8":
+		r := m.muxer.AudioPlaylist()
+		if r == nil {
+			return hlsMuxerResponse{Status: http.StatusNotFound}
+		}
+
+		return hlsMuxerResponse{
+			Status: http.StatusOK,
+			Header: map[string]string{
+				"Content-Type": `application/x-mpegURL`,
+			},
+			Body: r,
+		}
+
 	case strings.HasSuffix(req.File, ".ts"):
 		r := m.muxer.Segment(req.File)
 		if r == nil {
@@ -465,17 +600,40 @@ func (m *hlsMuxer) handleRequest(req hlsMuxerRequest) hlsMuxerResponse {
 			Status: http.StatusOK,
 			Header: map[string]string{
 				"Content-Type": `video/MP2T`,
+				"ETag":         r.ETag,
+			},
+			Body:    r,
+			ModTime: r.ModTime,
+		}
+
+	case strings.HasSuffix(req.File, ".key"):
+		r := m.muxer.Key(req.File)
+		if r == nil {
+			return hlsMuxerResponse{Status: http.StatusNotFound}
+		}
+
+		return hlsMuxerResponse{
+			Status: http.StatusOK,
+			Header: map[string]string{
+				"Content-Type":  `application/octet-stream`,
+				"Cache-Control": `no-store`,
 			},
 			Body: r,
 		}
 
 	case req.File == "":
+		page, err := hlsPlayerPage(m.pathName, req.Req.URL.Query())
+		if err != nil {
+			m.log(logger.Info, "unable to generate player page: %s", err)
+			return hlsMuxerResponse{Status: http.StatusBadRequest}
+		}
+
 		return hlsMuxerResponse{
 			Status: http.StatusOK,
 			Header: map[string]string{
 				"Content-Type": `text/html`,
 			},
-			Body: bytes.NewReader([]byte(index)),
+			Body: bytes.NewReader(page),
 		}
 
 	default:
@@ -492,6 +650,22 @@ func (m *hlsMuxer) onRequest(req hlsMuxerRequest) {
 	}
 }
 
+// end writes the last segment and ends playlists.
+func (m *hlsMuxer) end() {
+	err := m.muxer.End()
+	if err != nil {
+		m.log(logger.Warn, "unable to write the last segment: %v", err)
+	}
+}
+
+// onDrain is called by hlsServer.
+func (m *hlsMuxer) onDrain() {
+	select {
+	case m.drain <- struct{}{}:
+	case <-m.ctx.Done():
+	}
+}
+
 // onReaderAccepted implements reader.
 func (m *hlsMuxer) onReaderAccepted() {
 	m.log(logger.Info, "is converting into HLS")
@@ -499,18 +673,39 @@ func (m *hlsMuxer) onReaderAccepted() {
 
 // onReaderPacketRTP implements reader.
 func (m *hlsMuxer) onReaderPacketRTP(trackID int, payload []byte) {
-	m.ringBuffer.Push(hlsMuxerTrackIDPayloadPair{trackID, payload})
+	m.ringBuffer.Push(hlsMuxerTrackIDPayloadPair{trackID, payload, false, time.Now()})
 }
 
 // onReaderPacketRTCP implements reader.
 func (m *hlsMuxer) onReaderPacketRTCP(trackID int, payload []byte) {
+	// sender reports are used to fill EXT-X-PROGRAM-DATE-TIME
+	m.ringBuffer.Push(hlsMuxerTrackIDPayloadPair{trackID, payload, true, time.Time{}})
 }
 
 // onReaderAPIDescribe implements reader.
 func (m *hlsMuxer) onReaderAPIDescribe() interface{} {
 	return struct {
 		Type string `json:"type"`
-	}{"hlsMuxer"}
+		ID   string `json:"id"`
+	}{"hlsMuxer", m.id}
+}
+
+// onReaderAPIReadersItem implements reader.
+// A muxer is shared by all the HLS clients of a path, therefore the remote address
+// and the user are the ones of the last client.
+func (m *hlsMuxer) onReaderAPIReadersItem() pathAPIPathsReadersItem {
+	m.lastClientMutex.Lock()
+	defer m.lastClientMutex.Unlock()
+
+	return pathAPIPathsReadersItem{
+		Type:       "hlsMuxer",
+		ID:         m.id,
+		Protocol:   "hls",
+		RemoteAddr: m.lastRemoteAddr,
+		User:       m.lastUser,
+		Created:    m.created,
+		BytesSent:  atomic.LoadUint64(m.bytesSent),
+	}
 }
 
 // onAPIHLSMuxersList is called by api.
@@ -0,0 +1,227 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"math"
+	"net/url"
+	"strings"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+)
+
+// the page is generated server-side, in order to allow users to configure it
+// with query parameters, without hosting it anywhere:
+// - autoplay, muted, controls (default 1): attributes of video elements
+// - lowlatency (default 0): use a small buffer in order to decrease the delay
+// - stats (default 0): show bitrate and dropped frames above every stream
+// - mosaic: comma-separated list of additional paths, shown in a grid.
+var hlsPlayerTemplate = template.Must(template.New("player").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<style>
+html, body {
+	margin: 0;
+	padding: 0;
+	height: 100%;
+	background: black;
+}
+#grid {
+	display: grid;
+	width: 100%;
+	height: 100%;
+	grid-template-columns: repeat({{.Columns}}, 1fr);
+	grid-auto-rows: 1fr;
+}
+.cell {
+	position: relative;
+	min-width: 0;
+	min-height: 0;
+}
+video {
+	width: 100%;
+	height: 100%;
+	background: black;
+}
+.stats {
+	position: absolute;
+	top: 5px;
+	left: 5px;
+	padding: 3px 6px;
+	font: 12px monospace;
+	color: white;
+	background: rgba(0, 0, 0, 0.6);
+	pointer-events: none;
+}
+</style>
+</head>
+<body>
+
+<div id="grid"></div>
+
+<script src="https://cdn.jsdelivr.net/npm/hls.js@1.0.0"></script>
+
+<script>
+
+const conf = {{.Conf}};
+
+const hlsConfig = () => {
+	const ret = {
+		progressive: false,
+	};
+
+	if (conf.lowLatency) {
+		ret.lowLatencyMode = true;
+		ret.liveSyncDurationCount = 1;
+		ret.liveMaxLatencyDurationCount = 3;
+		ret.maxLiveSyncPlaybackRate = 1.5;
+	}
+
+	return ret;
+};
+
+const startStats = (video, stats, state) => {
+	setInterval(() => {
+		let text = 'bitrate: ' + (state.bitrate / 1000).toFixed(0) + ' kbit/s';
+		if (video.getVideoPlaybackQuality) {
+			text += ', dropped frames: ' + video.getVideoPlaybackQuality().droppedVideoFrames;
+		}
+		stats.innerText = text;
+	}, 1000);
+};
+
+const create = (video, state, url) => {
+	if (video.canPlayType('application/vnd.apple.mpegurl')) {
+		// since it's not possible to detect timeout errors in iOS,
+		// wait for the playlist to be available before starting the stream
+		fetch(url.replace(/index\.m3u8$/, 'stream.m3u8'))
+			.then(() => {
+				video.src = url;
+				if (conf.autoplay) {
+					video.play();
+				}
+			});
+
+	} else {
+		const hls = new Hls(hlsConfig());
+
+		hls.on(Hls.Events.ERROR, (evt, data) => {
+			if (data.fatal) {
+				hls.destroy();
+
+				setTimeout(() => create(video, state, url), 2000);
+			}
+		});
+
+		hls.on(Hls.Events.FRAG_LOADED, (evt, data) => {
+			if (data.frag.duration > 0) {
+				state.bitrate = (data.frag.stats.total * 8) / data.frag.duration;
+			}
+		});
+
+		hls.loadSource(url);
+		hls.attachMedia(video);
+
+		if (conf.autoplay) {
+			video.play();
+		}
+	}
+};
+
+window.addEventListener('DOMContentLoaded', () => {
+	const grid = document.getElementById('grid');
+
+	for (const url of conf.urls) {
+		const cell = document.createElement('div');
+		cell.className = 'cell';
+
+		const video = document.createElement('video');
+		video.muted = conf.muted;
+		video.controls = conf.controls;
+		video.autoplay = conf.autoplay;
+		video.playsInline = true;
+		cell.appendChild(video);
+
+		const state = {
+			bitrate: 0,
+		};
+
+		if (conf.stats) {
+			const stats = document.createElement('div');
+			stats.className = 'stats';
+			cell.appendChild(stats);
+			startStats(video, stats, state);
+		}
+
+		grid.appendChild(cell);
+		create(video, state, url);
+	}
+});
+
+</script>
+
+</body>
+</html>
+`))
+
+type hlsPlayerConf struct {
+	URLs       []string `json:"urls"`
+	Autoplay   bool     `json:"autoplay"`
+	Muted      bool     `json:"muted"`
+	Controls   bool     `json:"controls"`
+	LowLatency bool     `json:"lowLatency"`
+	Stats      bool     `json:"stats"`
+}
+
+func hlsPlayerBoolParam(query url.Values, key string, def bool) bool {
+	switch query.Get(key) {
+	case "1", "true", "yes":
+		return true
+
+	case "0", "false", "no":
+		return false
+	}
+	return def
+}
+
+// hlsPlayerPage generates the player page of a path.
+func hlsPlayerPage(pathName string, query url.Values) ([]byte, error) {
+	pconf := hlsPlayerConf{
+		URLs:       []string{"index.m3u8"},
+		Autoplay:   hlsPlayerBoolParam(query, "autoplay", true),
+		Muted:      hlsPlayerBoolParam(query, "muted", true),
+		Controls:   hlsPlayerBoolParam(query, "controls", true),
+		LowLatency: hlsPlayerBoolParam(query, "lowlatency", false),
+		Stats:      hlsPlayerBoolParam(query, "stats", false),
+	}
+
+	if mosaic := query.Get("mosaic"); mosaic != "" {
+		// URLs are relative to the page, in order to support reverse proxies
+		prefix := strings.Repeat("../", strings.Count(pathName, "/")+1)
+
+		for _, name := range strings.Split(mosaic, ",") {
+			err := conf.IsValidPathName(name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path name in mosaic: %s (%s)", name, err)
+			}
+
+			pconf.URLs = append(pconf.URLs, prefix+name+"/index.m3u8")
+		}
+	}
+
+	var buf bytes.Buffer
+	err := hlsPlayerTemplate.Execute(&buf, struct {
+		Columns int
+		Conf    hlsPlayerConf
+	}{
+		Columns: int(math.Ceil(math.Sqrt(float64(len(pconf.URLs))))),
+		Conf:    pconf,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
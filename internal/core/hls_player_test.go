@@ -0,0 +1,25 @@
+package core
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHLSPlayerPage(t *testing.T) {
+	page, err := hlsPlayerPage("cams/cam1", url.Values{
+		"mosaic":     []string{"cams/cam2,cam3"},
+		"lowlatency": []string{"1"},
+		"muted":      []string{"0"},
+	})
+	require.NoError(t, err)
+	require.Contains(t, string(page), `const conf = {"urls":["index.m3u8","../../cams/cam2/index.m3u8","../../cam3/index.m3u8"],`+
+		`"autoplay":true,"muted":false,"controls":true,"lowLatency":true,"stats":false};`)
+	require.Contains(t, string(page), "grid-template-columns: repeat(2, 1fr);")
+
+	_, err = hlsPlayerPage("cam1", url.Values{
+		"mosaic": []string{"cam2,/invalid"},
+	})
+	require.EqualError(t, err, "invalid path name in mosaic: /invalid (can't begin with a slash)")
+}
@@ -2,14 +2,18 @@ package core
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	gopath "path"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -18,6 +22,7 @@ import (
 )
 
 type hlsServerAPIMuxersListItem struct {
+	ID          string `json:"id"`
 	LastRequest string `json:"lastRequest"`
 }
 
@@ -42,77 +47,114 @@ type hlsServerAPIMuxersListSubReq struct {
 
 type hlsServerParent interface {
 	Log(logger.Level, string, ...interface{})
+	LogAccess(logger.AccessEntry)
 }
 
 type hlsServer struct {
-	hlsAlwaysRemux     bool
-	hlsSegmentCount    int
-	hlsSegmentDuration conf.StringDuration
-	hlsAllowOrigin     string
-	readBufferCount    int
-	pathManager        *pathManager
-	metrics            *metrics
-	parent             hlsServerParent
+	hlsAlwaysRemux           bool
+	hlsAlwaysRemuxCloseAfter conf.StringDuration
+	hlsSegmentCount          int
+	hlsSegmentDuration       conf.StringDuration
+	hlsAllowOrigin           string
+	hlsEncryption            bool
+	hlsEncryptionKeyRotation conf.StringDuration
+	hlsDirectory             string
+	hlsPushURL               string
+	limiter                  *limiter
+	bans                     *banList
+	geoIP                    *geoIPPolicy
+	egress                   *egressAccounting
+	pathManager              *pathManager
+	parent                   hlsServerParent
 
 	ctx       context.Context
 	ctxCancel func()
 	wg        sync.WaitGroup
 	ln        net.Listener
 	muxers    map[string]*hlsMuxer
+	draining  bool
+
+	segmentDurations *histogram
+	playlistLatency  *histogram
+	segmentLatency   *histogram
 
 	// in
 	pathSourceReady chan *path
 	request         chan hlsMuxerRequest
 	muxerClose      chan *hlsMuxer
+	drain           chan struct{}
 	apiMuxersList   chan hlsServerAPIMuxersListReq
 }
 
 func newHLSServer(
 	parentCtx context.Context,
 	address string,
+	ipv6Disable bool,
+	listenReusePort bool,
+	unixSocketPermissions conf.FileMode,
+	proxyProtocol bool,
+	proxyProtocolTrustedProxies conf.IPsOrNets,
 	hlsAlwaysRemux bool,
+	hlsAlwaysRemuxCloseAfter conf.StringDuration,
 	hlsSegmentCount int,
 	hlsSegmentDuration conf.StringDuration,
 	hlsAllowOrigin string,
-	readBufferCount int,
+	hlsEncryption bool,
+	hlsEncryptionKeyRotation conf.StringDuration,
+	hlsDirectory string,
+	hlsPushURL string,
+	limiter *limiter,
+	bans *banList,
+	geoIP *geoIPPolicy,
+	egress *egressAccounting,
 	pathManager *pathManager,
-	metrics *metrics,
 	parent hlsServerParent,
 ) (*hlsServer, error) {
-	ln, err := net.Listen("tcp", address)
+	ln, err := listen(address, ipv6Disable, listenReusePort, unixSocketPermissions)
 	if err != nil {
 		return nil, err
 	}
 
+	ln = withProxyProtocol(ln, proxyProtocol, proxyProtocolTrustedProxies)
+
 	ctx, ctxCancel := context.WithCancel(parentCtx)
 
 	s := &hlsServer{
-		hlsAlwaysRemux:     hlsAlwaysRemux,
-		hlsSegmentCount:    hlsSegmentCount,
-		hlsSegmentDuration: hlsSegmentDuration,
-		hlsAllowOrigin:     hlsAllowOrigin,
-		readBufferCount:    readBufferCount,
-		pathManager:        pathManager,
-		parent:             parent,
-		metrics:            metrics,
-		ctx:                ctx,
-		ctxCancel:          ctxCancel,
-		ln:                 ln,
-		muxers:             make(map[string]*hlsMuxer),
-		pathSourceReady:    make(chan *path),
-		request:            make(chan hlsMuxerRequest),
-		muxerClose:         make(chan *hlsMuxer),
-		apiMuxersList:      make(chan hlsServerAPIMuxersListReq),
+		hlsAlwaysRemux:           hlsAlwaysRemux,
+		hlsAlwaysRemuxCloseAfter: hlsAlwaysRemuxCloseAfter,
+		hlsSegmentCount:          hlsSegmentCount,
+		hlsSegmentDuration:       hlsSegmentDuration,
+		hlsAllowOrigin:           hlsAllowOrigin,
+		hlsEncryption:            hlsEncryption,
+		hlsEncryptionKeyRotation: hlsEncryptionKeyRotation,
+		hlsDirectory:             hlsDirectory,
+		hlsPushURL:               hlsPushURL,
+		limiter:                  limiter,
+		bans:                     bans,
+		geoIP:                    geoIP,
+		egress:                   egress,
+		pathManager:              pathManager,
+		parent:                   parent,
+		ctx:                      ctx,
+		ctxCancel:                ctxCancel,
+		ln:                       ln,
+		muxers:                   make(map[string]*hlsMuxer),
+		segmentDurations:         newHistogram(histogramSegmentDurationBuckets),
+		playlistLatency:          newHistogram(histogramLatencyBuckets),
+		segmentLatency:           newHistogram(histogramLatencyBuckets),
+		pathSourceReady:          make(chan *path),
+		request:                  make(chan hlsMuxerRequest),
+		muxerClose:               make(chan *hlsMuxer),
+		drain:                    make(chan struct{}),
+		apiMuxersList:            make(chan hlsServerAPIMuxersListReq),
 	}
 
+	s.ln = withConnectionRate(s.ln, limiter, s.log)
+
 	s.log(logger.Info, "listener opened on "+address)
 
 	s.pathManager.onHLSServerSet(s)
 
-	if s.metrics != nil {
-		s.metrics.onHLSServerSet(s)
-	}
-
 	s.wg.Add(1)
 	go s.run()
 
@@ -134,6 +176,7 @@ func (s *hlsServer) run() {
 	defer s.wg.Done()
 
 	router := gin.New()
+	router.Use(httpAccessLog("HLS", s.parent))
 	router.NoRoute(s.onRequest)
 
 	hs := &http.Server{Handler: router}
@@ -143,19 +186,38 @@ outer:
 	for {
 		select {
 		case pa := <-s.pathSourceReady:
-			if s.hlsAlwaysRemux {
-				s.findOrCreateMuxer(pa.Name())
+			if pa.Conf().HLSAlwaysRemux.Resolve(s.hlsAlwaysRemux) &&
+				!pa.Conf().HLSDisable &&
+				!s.draining {
+				s.findOrCreateMuxer(pa.Name(), "")
 			}
 
 		case req := <-s.request:
-			r := s.findOrCreateMuxer(req.Dir)
+			if _, ok := s.muxers[req.Dir]; !ok && s.draining {
+				req.Res <- hlsMuxerResponse{Status: http.StatusServiceUnavailable}
+				continue
+			}
+
+			r := s.findOrCreateMuxer(req.Dir, req.Req.URL.RawQuery)
+			if r == nil {
+				req.Res <- hlsMuxerResponse{Status: http.StatusServiceUnavailable}
+				continue
+			}
+
 			r.onRequest(req)
 
+		case <-s.drain:
+			s.draining = true
+			for _, m := range s.muxers {
+				m.onDrain()
+			}
+			handOverListener(s.ln)
+
 		case c := <-s.muxerClose:
 			if c2, ok := s.muxers[c.PathName()]; !ok || c2 != c {
 				continue
 			}
-			delete(s.muxers, c.PathName())
+			s.deleteMuxer(c)
 
 		case req := <-s.apiMuxersList:
 			muxers := make(map[string]*hlsMuxer)
@@ -177,14 +239,16 @@ outer:
 
 	hs.Shutdown(context.Background())
 
-	s.pathManager.onHLSServerSet(nil)
-
-	if s.metrics != nil {
-		s.metrics.onHLSServerSet(nil)
+	for _, m := range s.muxers {
+		s.deleteMuxer(m)
 	}
+
+	s.pathManager.onHLSServerSet(nil)
 }
 
 func (s *hlsServer) onRequest(ctx *gin.Context) {
+	start := time.Now()
+
 	s.log(logger.Info, "[conn %v] %s %s", ctx.Request.RemoteAddr, ctx.Request.Method, ctx.Request.URL.Path)
 
 	byts, _ := httputil.DumpRequest(ctx.Request, true)
@@ -211,6 +275,13 @@ func (s *hlsServer) onRequest(ctx *gin.Context) {
 		return
 	}
 
+	tmp, _, _ := net.SplitHostPort(ctx.Request.RemoteAddr)
+	if ip := net.ParseIP(tmp); ip != nil && s.bans.isBanned(ip) {
+		s.log(logger.Warn, "[conn %v] rejected: IP is banned", ctx.Request.RemoteAddr)
+		ctx.Writer.WriteHeader(http.StatusForbidden)
+		return
+	}
+
 	// remove leading prefix
 	pa := ctx.Request.URL.Path[1:]
 
@@ -221,19 +292,24 @@ func (s *hlsServer) onRequest(ctx *gin.Context) {
 	}
 
 	dir, fname := func() (string, string) {
-		if strings.HasSuffix(pa, ".ts") || strings.HasSuffix(pa, ".m3u8") {
+		if strings.HasSuffix(pa, ".ts") || strings.HasSuffix(pa, ".m3u8") || strings.HasSuffix(pa, ".key") {
 			return gopath.Dir(pa), gopath.Base(pa)
 		}
 		return pa, ""
 	}()
 
 	if fname == "" && !strings.HasSuffix(dir, "/") {
-		ctx.Writer.Header().Set("Location", "/"+dir+"/")
+		loc := "/" + dir + "/"
+		if ctx.Request.URL.RawQuery != "" {
+			loc += "?" + ctx.Request.URL.RawQuery
+		}
+		ctx.Writer.Header().Set("Location", loc)
 		ctx.Writer.WriteHeader(http.StatusMovedPermanently)
 		return
 	}
 
 	dir = strings.TrimSuffix(dir, "/")
+	dir = s.pathManager.tenantPathName(ctx.Request.Host, dir)
 
 	cres := make(chan hlsMuxerResponse)
 	hreq := hlsMuxerRequest{
@@ -250,10 +326,27 @@ func (s *hlsServer) onRequest(ctx *gin.Context) {
 		for k, v := range res.Header {
 			ctx.Writer.Header().Set(k, v)
 		}
-		ctx.Writer.WriteHeader(res.Status)
 
-		if res.Body != nil {
-			io.Copy(ctx.Writer, res.Body)
+		if res.Status == http.StatusOK && !res.ModTime.IsZero() {
+			// ServeContent takes care of Range, If-None-Match and If-Modified-Since
+			http.ServeContent(ctx.Writer, ctx.Request, fname, res.ModTime, res.Body.(io.ReadSeeker))
+			res.Status = ctx.Writer.Status()
+		} else {
+			ctx.Writer.WriteHeader(res.Status)
+
+			if res.Body != nil {
+				io.Copy(ctx.Writer, res.Body)
+			}
+		}
+
+		if res.Status == http.StatusOK {
+			switch {
+			case strings.HasSuffix(fname, ".m3u8"):
+				s.playlistLatency.observe(time.Since(start).Seconds())
+
+			case strings.HasSuffix(fname, ".ts"):
+				s.segmentLatency.observe(time.Since(start).Seconds())
+			}
 		}
 
 	case <-s.ctx.Done():
@@ -262,25 +355,87 @@ func (s *hlsServer) onRequest(ctx *gin.Context) {
 	s.log(logger.Debug, "[conn %v] [s->c] %s", ctx.Request.RemoteAddr, logw.dump())
 }
 
-func (s *hlsServer) findOrCreateMuxer(pathName string) *hlsMuxer {
+// findOrCreateMuxer returns nil when a muxer can't be created
+// because the session limit has been reached.
+func (s *hlsServer) findOrCreateMuxer(pathName string, query string) *hlsMuxer {
 	r, ok := s.muxers[pathName]
 	if !ok {
+		if !s.limiter.addSession() {
+			s.log(logger.Warn, "muxer for path '%s' not created: too many sessions", pathName)
+			return nil
+		}
+
+		id, _ := s.newMuxerID()
+
 		r = newHLSMuxer(
 			s.ctx,
+			id,
 			pathName,
 			s.hlsAlwaysRemux,
+			s.hlsAlwaysRemuxCloseAfter,
 			s.hlsSegmentCount,
 			s.hlsSegmentDuration,
-			s.readBufferCount,
+			s.hlsEncryption,
+			s.hlsEncryptionKeyRotation,
+			s.hlsDirectory,
+			s.hlsPushURL,
 			&s.wg,
 			pathName,
+			query,
 			s.pathManager,
+			s.geoIP,
+			s.egress,
 			s)
 		s.muxers[pathName] = r
 	}
 	return r
 }
 
+func (s *hlsServer) deleteMuxer(m *hlsMuxer) {
+	delete(s.muxers, m.PathName())
+	s.limiter.removeSession()
+}
+
+func (s *hlsServer) newMuxerID() (string, error) {
+	for {
+		b := make([]byte, 4)
+		_, err := rand.Read(b)
+		if err != nil {
+			return "", err
+		}
+
+		u := binary.LittleEndian.Uint32(b)
+		u %= 899999999
+		u += 100000000
+
+		id := strconv.FormatUint(uint64(u), 10)
+
+		alreadyPresent := func() bool {
+			for _, m := range s.muxers {
+				if m.ID() == id {
+					return true
+				}
+			}
+			return false
+		}()
+		if !alreadyPresent {
+			return id, nil
+		}
+	}
+}
+
+// onMuxerSegment is called by hlsMuxer.
+func (s *hlsServer) onMuxerSegment(d time.Duration) {
+	s.segmentDurations.observe(d.Seconds())
+}
+
+// onMetricsHistograms is called by metrics.
+func (s *hlsServer) onMetricsHistograms() string {
+	return metricHistogram("hls_segment_duration_seconds", "", s.segmentDurations) +
+		metricHistogram("hls_request_duration_seconds", "type=\"playlist\"", s.playlistLatency) +
+		metricHistogram("hls_request_duration_seconds", "type=\"segment\"", s.segmentLatency)
+}
+
 // onMuxerClose is called by hlsMuxer.
 func (s *hlsServer) onMuxerClose(c *hlsMuxer) {
 	select {
@@ -289,6 +444,14 @@ func (s *hlsServer) onMuxerClose(c *hlsMuxer) {
 	}
 }
 
+// onDrain is called by core.
+func (s *hlsServer) onDrain() {
+	select {
+	case s.drain <- struct{}{}:
+	case <-s.ctx.Done():
+	}
+}
+
 // onPathSourceReady is called by core.
 func (s *hlsServer) onPathSourceReady(pa *path) {
 	select {
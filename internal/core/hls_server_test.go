@@ -1,10 +1,15 @@
 package core
 
 import (
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"regexp"
 	"testing"
 	"time"
 
+	"github.com/aler9/gortsplib"
+	"github.com/pion/rtp"
 	"github.com/stretchr/testify/require"
 )
 
@@ -85,3 +90,195 @@ func TestHLSServerReadAuth(t *testing.T) {
 	defer cnt2.close()
 	require.Equal(t, 0, cnt2.wait())
 }
+
+func TestHLSServerAlwaysRemux(t *testing.T) {
+	p, ok := newInstance("rtmpDisable: yes\n" +
+		"hlsAlwaysRemux: yes\n" +
+		"hlsAlwaysRemuxCloseAfter: 1s\n" +
+		"paths:\n" +
+		"  remuxed:\n" +
+		"  notremuxed:\n" +
+		"    hlsAlwaysRemux: no\n" +
+		"  disabled:\n" +
+		"    hlsDisable: yes\n")
+	require.Equal(t, true, ok)
+	defer p.close()
+
+	track, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x01, 0x02, 0x03, 0x04}, PPS: []byte{0x01, 0x02, 0x03, 0x04}})
+	require.NoError(t, err)
+
+	for _, pathName := range []string{"remuxed", "notremuxed", "disabled"} {
+		source := gortsplib.Client{}
+		err := source.StartPublishing("rtsp://localhost:8554/"+pathName,
+			gortsplib.Tracks{track})
+		require.NoError(t, err)
+		defer source.Close()
+	}
+
+	muxers := func() []string {
+		res := p.hlsServer.onAPIHLSMuxersList(hlsServerAPIMuxersListReq{})
+		require.NoError(t, res.Err)
+		var ret []string
+		for name := range res.Data.Items {
+			ret = append(ret, name)
+		}
+		return ret
+	}
+
+	require.Eventually(t, func() bool {
+		m := muxers()
+		return len(m) == 1 && m[0] == "remuxed"
+	}, 2*time.Second, 50*time.Millisecond)
+
+	// muxers without requests are closed
+	require.Eventually(t, func() bool {
+		return len(muxers()) == 0
+	}, 4*time.Second, 100*time.Millisecond)
+
+	res, err := http.Get("http://localhost:8888/disabled/index.m3u8")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestHLSServerHeaders(t *testing.T) {
+	p, ok := newInstance("rtmpDisable: yes\n" +
+		"hlsAlwaysRemux: yes\n" +
+		"hlsAllowOrigin: http://global.example.com\n" +
+		"paths:\n" +
+		"  cam1:\n" +
+		"    hlsAllowOrigin: http://cam1.example.com\n" +
+		"    hlsHeaders:\n" +
+		"      Cache-Control: max-age=1\n" +
+		"      Timing-Allow-Origin: '*'\n" +
+		"  cam2:\n")
+	require.Equal(t, true, ok)
+	defer p.close()
+
+	track, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x01, 0x02, 0x03, 0x04}, PPS: []byte{0x01, 0x02, 0x03, 0x04}})
+	require.NoError(t, err)
+
+	for _, pathName := range []string{"cam1", "cam2"} {
+		source := gortsplib.Client{}
+		err := source.StartPublishing("rtsp://localhost:8554/"+pathName,
+			gortsplib.Tracks{track})
+		require.NoError(t, err)
+		defer source.Close()
+	}
+
+	res, err := http.Get("http://localhost:8888/cam1/index.m3u8")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "http://cam1.example.com", res.Header.Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "max-age=1", res.Header.Get("Cache-Control"))
+	require.Equal(t, "*", res.Header.Get("Timing-Allow-Origin"))
+
+	res2, err := http.Get("http://localhost:8888/cam2/index.m3u8")
+	require.NoError(t, err)
+	defer res2.Body.Close()
+	require.Equal(t, http.StatusOK, res2.StatusCode)
+	require.Equal(t, "http://global.example.com", res2.Header.Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "", res2.Header.Get("Timing-Allow-Origin"))
+}
+
+func TestHLSServerSegmentRange(t *testing.T) {
+	p, ok := newInstance("rtmpDisable: yes\n" +
+		"hlsAlwaysRemux: yes\n" +
+		"hlsSegmentDuration: 1s\n" +
+		"paths:\n" +
+		"  cam:\n")
+	require.Equal(t, true, ok)
+	defer p.close()
+
+	track, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x01, 0x02, 0x03, 0x04}, PPS: []byte{0x01, 0x02, 0x03, 0x04}})
+	require.NoError(t, err)
+
+	source := gortsplib.Client{}
+	err = source.StartPublishing("rtsp://localhost:8554/cam",
+		gortsplib.Tracks{track})
+	require.NoError(t, err)
+	defer source.Close()
+
+	require.Eventually(t, func() bool {
+		res := p.hlsServer.onAPIHLSMuxersList(hlsServerAPIMuxersListReq{})
+		return res.Err == nil && len(res.Data.Items) == 1
+	}, 2*time.Second, 50*time.Millisecond)
+
+	// a segment is completed when a IDR is received after the segment duration
+	for i := 0; i < 3; i++ {
+		pkt := rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         true,
+				PayloadType:    96,
+				SequenceNumber: uint16(i),
+				Timestamp:      uint32(i) * 2 * 90000,
+				SSRC:           0x38F27A2F,
+			},
+			Payload: []byte{0x05, 0x01, 0x02, 0x03},
+		}
+		byts, err := pkt.Marshal()
+		require.NoError(t, err)
+
+		err = source.WritePacketRTP(0, byts)
+		require.NoError(t, err)
+	}
+
+	// the playlist is returned when the first segment is available
+	hc := &http.Client{Timeout: 2 * time.Second}
+	res, err := hc.Get("http://localhost:8888/cam/stream.m3u8")
+	require.NoError(t, err)
+	byts, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+
+	ma := regexp.MustCompile(`\n([0-9]+\.ts)\n`).FindStringSubmatch(string(byts))
+	require.NotEqual(t, 0, len(ma))
+	segmentName := ma[1]
+
+	res, err = hc.Get("http://localhost:8888/cam/" + segmentName)
+	require.NoError(t, err)
+	full, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "bytes", res.Header.Get("Accept-Ranges"))
+	etag := res.Header.Get("ETag")
+	require.NotEqual(t, "", etag)
+	lastModified := res.Header.Get("Last-Modified")
+	require.NotEqual(t, "", lastModified)
+
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:8888/cam/"+segmentName, nil)
+	require.NoError(t, err)
+	req.Header.Set("Range", "bytes=188-375")
+	res, err = hc.Do(req)
+	require.NoError(t, err)
+	part, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusPartialContent, res.StatusCode)
+	require.Equal(t, fmt.Sprintf("bytes 188-375/%d", len(full)), res.Header.Get("Content-Range"))
+	require.Equal(t, full[188:376], part)
+
+	for _, ca := range []struct {
+		header string
+		value  string
+	}{
+		{"If-None-Match", etag},
+		{"If-Modified-Since", lastModified},
+	} {
+		t.Run(ca.header, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://localhost:8888/cam/"+segmentName, nil)
+			require.NoError(t, err)
+			req.Header.Set(ca.header, ca.value)
+			res, err := hc.Do(req)
+			require.NoError(t, err)
+			res.Body.Close()
+			require.Equal(t, http.StatusNotModified, res.StatusCode)
+		})
+	}
+}
@@ -12,10 +12,6 @@ import (
 	"github.com/aler9/rtsp-simple-server/internal/rtcpsenderset"
 )
 
-const (
-	hlsSourceRetryPause = 5 * time.Second
-)
-
 type hlsSourceParent interface {
 	log(logger.Level, string, ...interface{})
 	onSourceStaticSetReady(req pathSourceStaticSetReadyReq) pathSourceStaticSetReadyRes
@@ -25,6 +21,7 @@ type hlsSourceParent interface {
 type hlsSource struct {
 	ur          string
 	fingerprint string
+	retry       *sourceRetry
 	wg          *sync.WaitGroup
 	parent      hlsSourceParent
 
@@ -36,6 +33,7 @@ func newHLSSource(
 	parentCtx context.Context,
 	ur string,
 	fingerprint string,
+	retry *sourceRetry,
 	wg *sync.WaitGroup,
 	parent hlsSourceParent) *hlsSource {
 	ctx, ctxCancel := context.WithCancel(parentCtx)
@@ -43,6 +41,7 @@ func newHLSSource(
 	s := &hlsSource{
 		ur:          ur,
 		fingerprint: fingerprint,
+		retry:       retry,
 		wg:          wg,
 		parent:      parent,
 		ctx:         ctx,
@@ -76,8 +75,14 @@ outer:
 			break outer
 		}
 
+		pause, ok := s.retry.onFailure()
+		if !ok {
+			s.Log(logger.Info, "too many consecutive failures, giving up")
+			break outer
+		}
+
 		select {
-		case <-time.After(hlsSourceRetryPause):
+		case <-time.After(pause):
 		case <-s.ctx.Done():
 			break outer
 		}
@@ -121,6 +126,7 @@ func (s *hlsSource) runInner() bool {
 		}
 
 		s.Log(logger.Info, "ready")
+		s.retry.onSuccess()
 
 		stream = res.Stream
 		rtcpSenders = rtcpsenderset.New(tracks, stream.onPacketRTCP)
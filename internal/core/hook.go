@@ -0,0 +1,108 @@
+package core
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+	"github.com/aler9/rtsp-simple-server/internal/externalcmd"
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+// hookEvent is the document that is written to the standard input
+// of runOn* commands when hookStdinJSON is enabled.
+type hookEvent struct {
+	Event      string      `json:"event"`
+	Time       time.Time   `json:"time"`
+	Path       string      `json:"path,omitempty"`
+	Captures   []string    `json:"captures,omitempty"`
+	Port       string      `json:"port"`
+	SourceURL  string      `json:"sourceURL,omitempty"`
+	Client     interface{} `json:"client,omitempty"`
+	RemoteAddr string      `json:"remoteAddr,omitempty"`
+}
+
+// hookCaptures returns the capture groups of the regular expression
+// of a path, matched against the name of the path.
+func hookCaptures(pconf *conf.PathConf, name string) []string {
+	if pconf.Regexp == nil {
+		return nil
+	}
+
+	// regular expressions of tenants are matched against the name without prefix.
+	if pconf.Tenant != "" {
+		name = strings.TrimPrefix(name, pconf.Tenant+"/")
+	}
+
+	m := pconf.Regexp.FindStringSubmatch(name)
+	if len(m) < 2 {
+		return nil
+	}
+	return m[1:]
+}
+
+// hookSourceURL returns the URL of the static source of a path, if any.
+func hookSourceURL(pconf *conf.PathConf) string {
+	if pconf.Source == "publisher" || pconf.Source == "redirect" {
+		return ""
+	}
+	return pconf.Source
+}
+
+// hookRemoteAddr returns the remote address of a client, if available.
+func hookRemoteAddr(client interface{}) string {
+	if c, ok := client.(interface{ RemoteAddr() net.Addr }); ok {
+		return c.RemoteAddr().String()
+	}
+	return ""
+}
+
+// hookStdin returns the standard input of a command, or nil if it's disabled.
+func hookStdin(enabled bool, ev hookEvent) []byte {
+	if !enabled {
+		return nil
+	}
+
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	byts, _ := json.Marshal(ev)
+	return append(byts, '\n')
+}
+
+// hookStart starts a runOn* command, after expanding its template with the event.
+// It returns nil when the template expands to an empty string,
+// that allows to run commands only when some conditions are met.
+func hookStart(
+	log func(logger.Level, string, ...interface{}),
+	name string,
+	cmdstr string,
+	restart bool,
+	stdinJSON bool,
+	ev hookEvent,
+) *externalcmd.Cmd {
+	ev.Time = time.Now()
+
+	cmdstr, err := externalcmd.ExpandTemplate(cmdstr, ev)
+	if err != nil {
+		log(logger.Warn, "%s command not started: %s", name, err)
+		return nil
+	}
+
+	if cmdstr == "" {
+		log(logger.Debug, "%s command skipped", name)
+		return nil
+	}
+
+	log(logger.Info, "%s command started", name)
+
+	return externalcmd.New(cmdstr, restart, externalcmd.Environment{
+		Path:     ev.Path,
+		Port:     ev.Port,
+		Captures: ev.Captures,
+		Stdin:    hookStdin(stdinJSON, ev),
+	})
+}
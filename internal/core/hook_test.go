@@ -0,0 +1,148 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/aler9/gortsplib/pkg/base"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+)
+
+func TestHookStdin(t *testing.T) {
+	require.Equal(t, []byte(nil), hookStdin(false, hookEvent{Event: "init"}))
+
+	var ev map[string]interface{}
+	err := json.Unmarshal(hookStdin(true, hookEvent{
+		Event: "read",
+		Path:  "mypath",
+		Port:  "8554",
+		Client: struct {
+			Type string `json:"type"`
+			ID   string `json:"id"`
+		}{"rtspSession", "123"},
+	}), &ev)
+	require.NoError(t, err)
+
+	require.NotEmpty(t, ev["time"])
+	delete(ev, "time")
+
+	require.Equal(t, map[string]interface{}{
+		"event": "read",
+		"path":  "mypath",
+		"port":  "8554",
+		"client": map[string]interface{}{
+			"type": "rtspSession",
+			"id":   "123",
+		},
+	}, ev)
+}
+
+func TestHookCaptures(t *testing.T) {
+	pconf := &conf.PathConf{Regexp: regexp.MustCompile(`^cam_(.+)_([0-9]+)$`)}
+	require.Equal(t, []string{"front", "12"}, hookCaptures(pconf, "cam_front_12"))
+
+	pconf.Tenant = "tenant1"
+	require.Equal(t, []string{"front", "12"}, hookCaptures(pconf, "tenant1/cam_front_12"))
+
+	pconf = &conf.PathConf{Regexp: regexp.MustCompile(`^cam`)}
+	require.Equal(t, []string(nil), hookCaptures(pconf, "cam_front_12"))
+
+	require.Equal(t, []string(nil), hookCaptures(&conf.PathConf{}, "cam_front_12"))
+}
+
+func TestCoreHookStdinJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtsp-hook")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	outFile := filepath.Join(dir, "out.json")
+
+	p, ok := newInstance("rtmpDisable: yes\n" +
+		"hlsDisable: yes\n" +
+		"hookStdinJSON: yes\n" +
+		"paths:\n" +
+		"  mypath:\n" +
+		"    runOnInit: cat > " + outFile + "\n")
+	require.Equal(t, true, ok)
+	defer p.close()
+
+	var byts []byte
+	for i := 0; i < 20; i++ {
+		byts, _ = ioutil.ReadFile(outFile)
+		if len(byts) != 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	var ev hookEvent
+	err = json.Unmarshal(byts, &ev)
+	require.NoError(t, err)
+	require.Equal(t, "init", ev.Event)
+	require.Equal(t, "mypath", ev.Path)
+	require.Equal(t, "8554", ev.Port)
+}
+
+func TestCoreHookTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtsp-hook")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p, ok := newInstance("rtmpDisable: yes\n" +
+		"hlsDisable: yes\n" +
+		"paths:\n" +
+		"  cam1:\n" +
+		"    runOnInit: '{{if match \"^cam\" .Path}}touch " + dir + "/{{.Path}}{{end}}'\n" +
+		"  mic1:\n" +
+		"    runOnInit: '{{if match \"^cam\" .Path}}touch " + dir + "/{{.Path}}{{end}}'\n")
+	require.Equal(t, true, ok)
+	defer p.close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	_, err = os.Stat(filepath.Join(dir, "cam1"))
+	require.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "mic1"))
+	require.Error(t, err)
+}
+
+func TestCoreHookCaptures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtsp-hook")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	outFile := filepath.Join(dir, "out.txt")
+
+	p, ok := newInstance("rtmpDisable: yes\n" +
+		"hlsDisable: yes\n" +
+		"paths:\n" +
+		"  '~^cam_(.+)_([0-9]+)$':\n" +
+		"    runOnDemand: echo $RTSP_PATH $G1 $G2 {{index .Captures 1}} > " + outFile + "\n" +
+		"    runOnDemandStartTimeout: 1s\n")
+	require.Equal(t, true, ok)
+	defer p.close()
+
+	c := gortsplib.Client{}
+	err = c.Start("rtsp", "localhost:8554")
+	require.NoError(t, err)
+	defer c.Close()
+
+	ur, err := base.ParseURL("rtsp://localhost:8554/cam_front_12")
+	require.NoError(t, err)
+
+	// the command doesn't publish, therefore the request fails after the timeout
+	c.Describe(ur)
+
+	byts, err := ioutil.ReadFile(outFile)
+	require.NoError(t, err)
+	require.Equal(t, "cam_front_12 front 12 12\n", string(byts))
+}
@@ -0,0 +1,44 @@
+package core
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+type httpAccessLogParent interface {
+	LogAccess(logger.AccessEntry)
+}
+
+// httpAccessLog returns a middleware that writes every request into the access log.
+func httpAccessLog(component string, parent httpAccessLogParent) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+
+		ctx.Next()
+
+		user, _, _ := ctx.Request.BasicAuth()
+
+		size := ctx.Writer.Size()
+		if size < 0 {
+			size = 0
+		}
+
+		parent.LogAccess(logger.AccessEntry{
+			Time:       start,
+			Component:  component,
+			RemoteAddr: ctx.Request.RemoteAddr,
+			User:       user,
+			Method:     ctx.Request.Method,
+			URI:        ctx.Request.RequestURI,
+			Proto:      ctx.Request.Proto,
+			Status:     ctx.Writer.Status(),
+			Size:       size,
+			Duration:   time.Since(start),
+			Referer:    ctx.Request.Referer(),
+			UserAgent:  ctx.Request.UserAgent(),
+		})
+	}
+}
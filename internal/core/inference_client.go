@@ -0,0 +1,160 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+// maximum size of the responses of the inference service.
+const inferenceClientMaxResponseSize = 1024 * 1024
+
+type inferenceDetection struct {
+	Label      string  `json:"label"`
+	Confidence float64 `json:"confidence"`
+
+	// x, y, width and height, in the [0, 1] range,
+	// with the origin in the top left corner.
+	Box [4]float64 `json:"box"`
+}
+
+type inferenceResult struct {
+	Time       time.Time            `json:"time"`
+	Detections []inferenceDetection `json:"detections"`
+}
+
+type inferenceClientParent interface {
+	log(logger.Level, string, ...interface{})
+}
+
+// inferenceClient sends key frames of a path to an external inference service,
+// at most once every interval, and writes the returned detections into the stream.
+type inferenceClient struct {
+	url        string
+	interval   time.Duration
+	stream     *streamInference
+	httpClient *http.Client
+	parent     inferenceClientParent
+
+	ctx       context.Context
+	ctxCancel func()
+	wg        sync.WaitGroup
+
+	mutex       sync.Mutex
+	busy        bool
+	lastRequest time.Time
+	last        *inferenceResult
+}
+
+func newInferenceClient(
+	parentCtx context.Context,
+	url string,
+	interval time.Duration,
+	timeout time.Duration,
+	stream *streamInference,
+	parent inferenceClientParent,
+) *inferenceClient {
+	ctx, ctxCancel := context.WithCancel(parentCtx)
+
+	c := &inferenceClient{
+		url:        url,
+		interval:   interval,
+		stream:     stream,
+		httpClient: &http.Client{Timeout: timeout},
+		parent:     parent,
+		ctx:        ctx,
+		ctxCancel:  ctxCancel,
+	}
+
+	stream.onKeyFrame = c.onKeyFrame
+
+	return c
+}
+
+func (c *inferenceClient) close() {
+	c.ctxCancel()
+	c.wg.Wait()
+}
+
+func (c *inferenceClient) onKeyFrame(ts uint32, frame []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.busy || c.ctx.Err() != nil || time.Since(c.lastRequest) < c.interval {
+		return
+	}
+
+	c.busy = true
+	c.lastRequest = time.Now()
+
+	c.wg.Add(1)
+	go c.runRequest(ts, frame)
+}
+
+func (c *inferenceClient) runRequest(ts uint32, frame []byte) {
+	defer c.wg.Done()
+
+	res, err := c.do(frame)
+
+	c.mutex.Lock()
+	c.busy = false
+	if err == nil {
+		c.last = res
+	}
+	c.mutex.Unlock()
+
+	if err != nil {
+		if c.ctx.Err() == nil {
+			c.parent.log(logger.Warn, "inference request failed: %v", err)
+		}
+		return
+	}
+
+	c.parent.log(logger.Debug, "inference returned %d detections", len(res.Detections))
+	c.stream.writeDetections(ts, res)
+}
+
+func (c *inferenceClient) do(frame []byte) (*inferenceResult, error) {
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodPost, c.url, bytes.NewReader(frame))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "video/h264")
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status code: %d", res.StatusCode)
+	}
+
+	var ret inferenceResult
+	err = json.NewDecoder(io.LimitReader(res.Body, inferenceClientMaxResponseSize)).Decode(&ret)
+	if err != nil {
+		return nil, err
+	}
+
+	ret.Time = time.Now()
+	if ret.Detections == nil {
+		ret.Detections = []inferenceDetection{}
+	}
+
+	return &ret, nil
+}
+
+// lastResult returns the last detections, or nil if there are none.
+func (c *inferenceClient) lastResult() *inferenceResult {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.last
+}
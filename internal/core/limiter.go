@@ -0,0 +1,178 @@
+package core
+
+import (
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// interval between removals of the buckets of IPs that stopped connecting.
+const limiterBucketsCleanInterval = time.Minute
+
+// limiterBucket is the token bucket of a client IP.
+type limiterBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limiter limits the number of connections and sessions of the whole instance,
+// and the rate of new connections of every client IP.
+// It is shared by all servers and survives configuration reloads,
+// in order to keep counters consistent while servers are restarted.
+type limiter struct {
+	mutex                  sync.Mutex
+	maxConnections         int
+	maxSessions            int
+	connectionRate         float64
+	connectionBurst        int
+	connections            int
+	sessions               int
+	buckets                map[string]*limiterBucket
+	bucketsCleaned         time.Time
+	rejectedConnections    int64
+	rejectedSessions       int64
+	rateLimitedConnections int64
+}
+
+func newLimiter() *limiter {
+	return &limiter{
+		buckets: make(map[string]*limiterBucket),
+	}
+}
+
+// setLimits sets the limits. Zero means unlimited.
+// Connections and sessions that are already open are not affected.
+func (l *limiter) setLimits(maxConnections int, maxSessions int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.maxConnections = maxConnections
+	l.maxSessions = maxSessions
+}
+
+// setConnectionRate sets the maximum rate of new connections of every client IP,
+// in connections per second, and the number of connections that can be opened
+// at once. Zero means unlimited.
+// Buckets are reset only when the limits change, since the function is called
+// at every configuration reload.
+func (l *limiter) setConnectionRate(rate float64, burst int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if rate == l.connectionRate && burst == l.connectionBurst {
+		return
+	}
+
+	l.connectionRate = rate
+	l.connectionBurst = burst
+	l.buckets = make(map[string]*limiterBucket)
+}
+
+// allowConnection checks whether a new connection of a client IP is allowed
+// by the connection rate. It must be called before addConnection.
+func (l *limiter) allowConnection(ip net.IP) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.connectionRate == 0 {
+		return true
+	}
+
+	now := time.Now()
+	l.cleanBuckets(now)
+
+	key := ip.String()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &limiterBucket{
+			tokens: float64(l.connectionBurst),
+			last:   now,
+		}
+		l.buckets[key] = b
+	} else {
+		b.tokens = l.refill(b, now)
+		b.last = now
+	}
+
+	if b.tokens < 1 {
+		l.rateLimitedConnections++
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+func (l *limiter) refill(b *limiterBucket, now time.Time) float64 {
+	return math.Min(float64(l.connectionBurst), b.tokens+now.Sub(b.last).Seconds()*l.connectionRate)
+}
+
+// cleanBuckets removes the buckets that are full, since they are equal to new ones.
+func (l *limiter) cleanBuckets(now time.Time) {
+	if now.Sub(l.bucketsCleaned) < limiterBucketsCleanInterval {
+		return
+	}
+	l.bucketsCleaned = now
+
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= float64(l.connectionBurst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// addConnection reserves a connection. It returns false if the limit has been reached.
+func (l *limiter) addConnection() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.maxConnections != 0 && l.connections >= l.maxConnections {
+		l.rejectedConnections++
+		return false
+	}
+
+	l.connections++
+	return true
+}
+
+// removeConnection releases a connection reserved with addConnection.
+func (l *limiter) removeConnection() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.connections--
+}
+
+// addSession reserves a session. It returns false if the limit has been reached.
+func (l *limiter) addSession() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.maxSessions != 0 && l.sessions >= l.maxSessions {
+		l.rejectedSessions++
+		return false
+	}
+
+	l.sessions++
+	return true
+}
+
+// removeSession releases a session reserved with addSession.
+func (l *limiter) removeSession() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.sessions--
+}
+
+// rejected returns the number of connections and sessions that have been rejected.
+func (l *limiter) rejected() (int64, int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.rejectedConnections, l.rejectedSessions
+}
+
+// rateLimited returns the number of connections that have been rejected by the connection rate.
+func (l *limiter) rateLimited() int64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.rateLimitedConnections
+}
@@ -0,0 +1,45 @@
+package core
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiterConnectionRate(t *testing.T) {
+	l := newLimiter()
+	l.setConnectionRate(10, 2)
+
+	ip1 := net.ParseIP("192.168.1.1")
+	ip2 := net.ParseIP("192.168.1.2")
+
+	require.Equal(t, true, l.allowConnection(ip1))
+	require.Equal(t, true, l.allowConnection(ip1))
+	require.Equal(t, false, l.allowConnection(ip1))
+
+	// IPs have separate buckets
+	require.Equal(t, true, l.allowConnection(ip2))
+
+	// tokens are refilled over time
+	time.Sleep(150 * time.Millisecond)
+	require.Equal(t, true, l.allowConnection(ip1))
+	require.Equal(t, false, l.allowConnection(ip1))
+
+	require.Equal(t, int64(2), l.rateLimited())
+
+	// reloading the configuration with the same limits doesn't reset buckets
+	l.setConnectionRate(10, 2)
+	require.Equal(t, false, l.allowConnection(ip1))
+
+	// changing the limits resets buckets
+	l.setConnectionRate(10, 3)
+	require.Equal(t, true, l.allowConnection(ip1))
+
+	// zero disables the limit
+	l.setConnectionRate(0, 0)
+	for i := 0; i < 10; i++ {
+		require.Equal(t, true, l.allowConnection(ip1))
+	}
+}
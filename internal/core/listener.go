@@ -0,0 +1,280 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+	"github.com/aler9/rtsp-simple-server/internal/proxyproto"
+)
+
+// resolveListenAddress replaces the host part of a listener address with
+// the first address of the network interface with the same name, if any.
+// This allows to bind listeners to interfaces, like eth0:8554,
+// that is useful on hosts with multiple network interfaces.
+func resolveListenAddress(address string, ipv6Disable bool) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || host == "" || net.ParseIP(host) != nil {
+		return address, nil
+	}
+
+	intf, err := net.InterfaceByName(host)
+	if err != nil {
+		// host is a hostname
+		return address, nil
+	}
+
+	addrs, err := intf.Addrs()
+	if err != nil {
+		return "", err
+	}
+
+	var ipv6 net.IP
+
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		if ipnet.IP.To4() != nil {
+			return net.JoinHostPort(ipnet.IP.String(), port), nil
+		}
+
+		// link-local addresses can't be used without a zone
+		if ipv6 == nil && !ipnet.IP.IsLinkLocalUnicast() {
+			ipv6 = ipnet.IP
+		}
+	}
+
+	if ipv6 != nil && !ipv6Disable {
+		return net.JoinHostPort(ipv6.String(), port), nil
+	}
+
+	return "", fmt.Errorf("interface '%s' has no usable address", host)
+}
+
+func ipNetwork(network string, ipv6Disable bool) string {
+	if ipv6Disable {
+		return network + "4"
+	}
+	return network
+}
+
+// handoverListener is a listener whose port is shared with other instances
+// of the server (SO_REUSEPORT). When the instance is drained, the listener
+// stops accepting connections, in order to hand over all new connections to
+// the instance that is replacing it, while existing connections are preserved.
+type handoverListener struct {
+	net.Listener
+
+	handOverOnce sync.Once
+	closeOnce    sync.Once
+	handedOver   chan struct{}
+	closed       chan struct{}
+}
+
+func newHandoverListener(ln net.Listener) *handoverListener {
+	return &handoverListener{
+		Listener:   ln,
+		handedOver: make(chan struct{}),
+		closed:     make(chan struct{}),
+	}
+}
+
+// Accept implements net.Listener.
+func (l *handoverListener) Accept() (net.Conn, error) {
+	nconn, err := l.Listener.Accept()
+	if err != nil {
+		// do not return errors after the handover, since the
+		// server would close existing connections too.
+		select {
+		case <-l.handedOver:
+			<-l.closed
+		default:
+		}
+	}
+	return nconn, err
+}
+
+// Close implements net.Listener.
+func (l *handoverListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+	return l.Listener.Close()
+}
+
+func (l *handoverListener) handOver() {
+	l.handOverOnce.Do(func() {
+		close(l.handedOver)
+		l.Listener.Close()
+	})
+}
+
+// handOverListener stops a listener opened with listenReusePort from accepting connections.
+func handOverListener(ln net.Listener) {
+	if hl, ok := ln.(*handoverListener); ok {
+		hl.handOver()
+	}
+}
+
+// listenNet opens a TCP listener, optionally shared with other instances of the server.
+func listenNet(address string, ipv6Disable bool, listenReusePort bool) (net.Listener, error) {
+	address, err := resolveListenAddress(address, ipv6Disable)
+	if err != nil {
+		return nil, err
+	}
+
+	if !listenReusePort {
+		return net.Listen(ipNetwork("tcp", ipv6Disable), address)
+	}
+
+	lc := net.ListenConfig{Control: reusePortControl}
+	return lc.Listen(context.Background(), ipNetwork("tcp", ipv6Disable), address)
+}
+
+// withHandover wraps a listener shared with other instances of the server,
+// in order to allow handOverListener to find it.
+func withHandover(ln net.Listener, listenReusePort bool) net.Listener {
+	if !listenReusePort {
+		return ln
+	}
+	return newHandoverListener(ln)
+}
+
+// listen opens a listener on a TCP address or,
+// when address is in the format unix:/path, on a Unix socket.
+func listen(
+	address string,
+	ipv6Disable bool,
+	listenReusePort bool,
+	unixSocketPermissions conf.FileMode,
+) (net.Listener, error) {
+	pa, ok := conf.UnixSocketPath(address)
+	if !ok {
+		ln, err := listenNet(address, ipv6Disable, listenReusePort)
+		if err != nil {
+			return nil, err
+		}
+
+		return withHandover(ln, listenReusePort), nil
+	}
+
+	// remove sockets left by instances that were not closed properly
+	if fi, err := os.Stat(pa); err == nil && (fi.Mode()&os.ModeSocket) != 0 {
+		os.Remove(pa)
+	}
+
+	ln, err := net.Listen("unix", pa)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Chmod(pa, os.FileMode(unixSocketPermissions))
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	return ln, nil
+}
+
+// listenTCP opens a TCP listener that optionally reads the PROXY protocol header.
+func listenTCP(
+	address string,
+	ipv6Disable bool,
+	listenReusePort bool,
+	proxyProtocol bool,
+	trustedProxies conf.IPsOrNets,
+) (net.Listener, error) {
+	ln, err := listenNet(address, ipv6Disable, listenReusePort)
+	if err != nil {
+		return nil, err
+	}
+
+	ln = withHandover(ln, listenReusePort)
+
+	return withProxyProtocol(ln, proxyProtocol, trustedProxies), nil
+}
+
+// listenUDP opens a UDP listener.
+func listenUDP(address string, ipv6Disable bool) (net.PacketConn, error) {
+	address, err := resolveListenAddress(address, ipv6Disable)
+	if err != nil {
+		return nil, err
+	}
+
+	return net.ListenPacket(ipNetwork("udp", ipv6Disable), address)
+}
+
+// withProxyProtocol wraps a listener in order to read the PROXY protocol header.
+// When proxyProtocol is enabled, the address of clients is read from the header
+// sent by trustedProxies, or by any host when trustedProxies is empty.
+func withProxyProtocol(ln net.Listener, proxyProtocol bool, trustedProxies conf.IPsOrNets) net.Listener {
+	if !proxyProtocol {
+		return ln
+	}
+
+	var isTrusted func(net.IP) bool
+	if len(trustedProxies) != 0 {
+		isTrusted = func(ip net.IP) bool {
+			return ipEqualOrInRange(ip, trustedProxies)
+		}
+	}
+
+	// the handover listener must remain the outer one, in order to be found by handOverListener.
+	if hl, ok := ln.(*handoverListener); ok {
+		hl.Listener = proxyproto.NewListener(hl.Listener, isTrusted)
+		return hl
+	}
+
+	return proxyproto.NewListener(ln, isTrusted)
+}
+
+// rateLimitedListener is a listener that closes the connections
+// that exceed the connection rate of their IP.
+type rateLimitedListener struct {
+	net.Listener
+	limiter *limiter
+	log     func(logger.Level, string, ...interface{})
+}
+
+// Accept implements net.Listener.
+func (l *rateLimitedListener) Accept() (net.Conn, error) {
+	for {
+		nconn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		host, _, _ := net.SplitHostPort(nconn.RemoteAddr().String())
+		if ip := net.ParseIP(host); ip != nil && !l.limiter.allowConnection(ip) {
+			l.log(logger.Warn, "connection from %v rejected: too many connections from the same IP", nconn.RemoteAddr())
+			nconn.Close()
+			continue
+		}
+
+		return nconn, nil
+	}
+}
+
+// withConnectionRate wraps a listener in order to limit the rate of new connections of every IP.
+// It must be called after withProxyProtocol, in order to use the address of clients.
+func withConnectionRate(
+	ln net.Listener,
+	limiter *limiter,
+	log func(logger.Level, string, ...interface{}),
+) net.Listener {
+	// the handover listener must remain the outer one, in order to be found by handOverListener.
+	if hl, ok := ln.(*handoverListener); ok {
+		hl.Listener = &rateLimitedListener{Listener: hl.Listener, limiter: limiter, log: log}
+		return hl
+	}
+
+	return &rateLimitedListener{Listener: ln, limiter: limiter, log: log}
+}
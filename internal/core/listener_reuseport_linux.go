@@ -0,0 +1,23 @@
+//go:build linux
+// +build linux
+
+package core
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// reusePortControl enables SO_REUSEPORT on a socket, in order to allow
+// multiple instances of the server to listen on the same port.
+func reusePortControl(network string, address string, c syscall.RawConn) error {
+	var err error
+	err2 := c.Control(func(fd uintptr) {
+		err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err2 != nil {
+		return err2
+	}
+	return err
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package core
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func reusePortControl(network string, address string, c syscall.RawConn) error {
+	return fmt.Errorf("'listenReusePort' is supported on Linux only")
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveListenAddress(t *testing.T) {
+	intfs, err := net.Interfaces()
+	require.NoError(t, err)
+
+	var loopback string
+	for _, intf := range intfs {
+		if (intf.Flags & net.FlagLoopback) != 0 {
+			loopback = intf.Name
+			break
+		}
+	}
+	require.NotEqual(t, "", loopback)
+
+	for _, ca := range []struct {
+		address string
+		out     string
+	}{
+		{":8554", ":8554"},
+		{"192.168.0.1:8554", "192.168.0.1:8554"},
+		{"[::1]:8554", "[::1]:8554"},
+		{"localhost:8554", "localhost:8554"},
+		{loopback + ":8554", "127.0.0.1:8554"},
+	} {
+		out, err := resolveListenAddress(ca.address, true)
+		require.NoError(t, err)
+		require.Equal(t, ca.out, out)
+	}
+}
+
+func TestListenIPv6Disable(t *testing.T) {
+	ln, err := listen("127.0.0.1:9997", true, false, 0)
+	require.NoError(t, err)
+	defer ln.Close()
+	require.Equal(t, "127.0.0.1:9997", ln.Addr().String())
+
+	_, err = listen("[::1]:9997", true, false, 0)
+	require.Error(t, err)
+}
+
+func TestListenReusePortHandover(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("SO_REUSEPORT is supported on Linux only")
+	}
+
+	ln1, err := listen("127.0.0.1:9997", true, true, 0)
+	require.NoError(t, err)
+	defer ln1.Close()
+
+	ln2, err := listen("127.0.0.1:9997", true, true, 0)
+	require.NoError(t, err)
+	defer ln2.Close()
+
+	accepted1 := make(chan error)
+	go func() {
+		nconn, err := ln1.Accept()
+		if err == nil {
+			nconn.Close()
+		}
+		accepted1 <- err
+	}()
+
+	handOverListener(ln1)
+
+	// Accept() doesn't return errors after the handover
+	select {
+	case <-accepted1:
+		t.Errorf("should not happen")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// new connections are received by the other listener
+	for i := 0; i < 5; i++ {
+		nconn, err := net.Dial("tcp", "127.0.0.1:9997")
+		require.NoError(t, err)
+		nconn.Close()
+
+		nconn, err = ln2.Accept()
+		require.NoError(t, err)
+		nconn.Close()
+	}
+
+	ln1.Close()
+	require.Error(t, <-accepted1)
+}
@@ -5,11 +5,13 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"sort"
 	"strconv"
 	"sync"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/aler9/rtsp-simple-server/internal/conf"
 	"github.com/aler9/rtsp-simple-server/internal/logger"
 )
 
@@ -17,12 +19,81 @@ func metric(key string, value int64) string {
 	return key + " " + strconv.FormatInt(value, 10) + "\n"
 }
 
+func metricFloat(key string, value float64) string {
+	return key + " " + strconv.FormatFloat(value, 'f', -1, 64) + "\n"
+}
+
+// metricReaderQuality returns the network quality metrics of a reader.
+func metricReaderQuality(prefix string, id string, q *readerQualityInfo) string {
+	if q == nil {
+		return ""
+	}
+
+	out := ""
+	labels := "{id=\"" + id + "\"}"
+
+	if q.PacketsLost != nil {
+		out += metric(prefix+"_packets_lost"+labels, int64(*q.PacketsLost))
+	}
+	if q.FractionLost != nil {
+		out += metricFloat(prefix+"_fraction_lost"+labels, *q.FractionLost)
+	}
+	if q.Jitter != nil {
+		out += metricFloat(prefix+"_jitter_ms"+labels, *q.Jitter)
+	}
+	if q.RTT != nil {
+		out += metricFloat(prefix+"_rtt_ms"+labels, *q.RTT)
+	}
+	if q.SendQueue != nil {
+		out += metric(prefix+"_send_queue_bytes"+labels, int64(*q.SendQueue))
+	}
+
+	return out
+}
+
+// metricPathIngest returns the ingest quality metrics of a path,
+// that are the sum or the worst values among the ones of all tracks.
+func metricPathIngest(name string, in *pathIngestInfo) string {
+	if in == nil {
+		return ""
+	}
+
+	labels := "{name=\"" + name + "\"}"
+
+	var packetsLost uint64
+	var fractionLost float64
+	var jitter *float64
+	var bitrate uint64
+
+	for _, t := range in.Tracks {
+		packetsLost += t.PacketsLost
+		if t.FractionLost > fractionLost {
+			fractionLost = t.FractionLost
+		}
+		if t.Jitter != nil && (jitter == nil || *t.Jitter > *jitter) {
+			jitter = t.Jitter
+		}
+		bitrate += t.Bitrate
+	}
+
+	out := metric("paths_ingest_packets_lost"+labels, int64(packetsLost))
+	out += metricFloat("paths_ingest_fraction_lost"+labels, fractionLost)
+	if jitter != nil {
+		out += metricFloat("paths_ingest_jitter_ms"+labels, *jitter)
+	}
+	out += metric("paths_ingest_bitrate"+labels, int64(bitrate))
+
+	return out
+}
+
 type metricsPathManager interface {
 	onAPIPathsList(req pathAPIPathsListReq) pathAPIPathsListRes
 }
 
 type metricsRTSPServer interface {
 	onAPISessionsList(req rtspServerAPISessionsListReq) rtspServerAPISessionsListRes
+	onMetricsHistograms() string
+	udpDrops() (uint64, bool)
 }
 
 type metricsRTMPServer interface {
@@ -31,30 +102,67 @@ type metricsRTMPServer interface {
 
 type metricsHLSServer interface {
 	onAPIHLSMuxersList(req hlsServerAPIMuxersListReq) hlsServerAPIMuxersListRes
+	onMetricsHistograms() string
+}
+
+type metricsLimiter interface {
+	rejected() (int64, int64)
+	rateLimited() int64
+}
+
+type metricsAuditor interface {
+	outcomes() (int64, int64)
+}
+
+type metricsQuotas interface {
+	info() map[string]quotasTenantInfo
+}
+
+type metricsGeoIP interface {
+	counts() map[string][2]int64
+}
+
+type metricsEgress interface {
+	info() map[string]uint64
 }
 
 type metricsParent interface {
 	Log(logger.Level, string, ...interface{})
+	LogAccess(logger.AccessEntry)
 }
 
-type metrics struct {
-	parent metricsParent
-
-	ln          net.Listener
-	server      *http.Server
+// metricsSources contains the components that are queried by metrics exporters.
+type metricsSources struct {
 	mutex       sync.Mutex
 	pathManager metricsPathManager
 	rtspServer  metricsRTSPServer
 	rtspsServer metricsRTSPServer
 	rtmpServer  metricsRTMPServer
 	hlsServer   metricsHLSServer
+	limiter     metricsLimiter
+	auditor     metricsAuditor
+	quotas      metricsQuotas
+	geoIP       metricsGeoIP
+	egress      metricsEgress
+}
+
+type metrics struct {
+	metricsSources
+
+	parent metricsParent
+
+	ln     net.Listener
+	server *http.Server
 }
 
 func newMetrics(
 	address string,
+	ipv6Disable bool,
+	listenReusePort bool,
+	unixSocketPermissions conf.FileMode,
 	parent metricsParent,
 ) (*metrics, error) {
-	ln, err := net.Listen("tcp", address)
+	ln, err := listen(address, ipv6Disable, listenReusePort, unixSocketPermissions)
 	if err != nil {
 		return nil, err
 	}
@@ -65,6 +173,7 @@ func newMetrics(
 	}
 
 	router := gin.New()
+	router.Use(httpAccessLog("metrics", parent))
 	router.GET("/metrics", m.onMetrics)
 
 	m.server = &http.Server{Handler: router}
@@ -93,15 +202,43 @@ func (m *metrics) run() {
 }
 
 func (m *metrics) onMetrics(ctx *gin.Context) {
+	out := m.collect()
+
+	ctx.Writer.WriteHeader(http.StatusOK)
+	io.WriteString(ctx.Writer, out)
+}
+
+// collect returns the current value of all metrics, in the Prometheus text format.
+func (m *metricsSources) collect() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	out := ""
 
-	res := m.pathManager.onAPIPathsList(pathAPIPathsListReq{})
-	if res.Err == nil {
-		for name, p := range res.Data.Items {
-			if p.SourceReady {
-				out += metric("paths{name=\""+name+"\",state=\"ready\"}", 1)
-			} else {
-				out += metric("paths{name=\""+name+"\",state=\"notReady\"}", 1)
+	if !interfaceIsEmpty(m.pathManager) {
+		res := m.pathManager.onAPIPathsList(pathAPIPathsListReq{})
+		if res.Err == nil {
+			for name, p := range res.Data.Items {
+				if p.SourceReady {
+					out += metric("paths{name=\""+name+"\",state=\"ready\"}", 1)
+				} else {
+					out += metric("paths{name=\""+name+"\",state=\"notReady\"}", 1)
+				}
+
+				if p.Conf.Source != "publisher" && p.Conf.Source != "redirect" {
+					out += metric("paths_source_failures{name=\""+name+"\"}", int64(p.SourceFailures))
+				}
+
+				if p.Conf.SourceInactivityTimeout != 0 {
+					out += metric("paths_source_inactivities{name=\""+name+"\"}", int64(p.SourceInactivities))
+				}
+
+				if p.AudioLevel != nil {
+					out += metricFloat("paths_audio_rms_dbfs{name=\""+name+"\"}", p.AudioLevel.RMS)
+					out += metricFloat("paths_audio_peak_dbfs{name=\""+name+"\"}", p.AudioLevel.Peak)
+				}
+
+				out += metricPathIngest(name, p.Ingest)
 			}
 		}
 	}
@@ -112,8 +249,11 @@ func (m *metrics) onMetrics(ctx *gin.Context) {
 			idleCount := int64(0)
 			readCount := int64(0)
 			publishCount := int64(0)
+			qualityOut := ""
+
+			for id, i := range res.Data.Items {
+				qualityOut += metricReaderQuality("rtsp_session", id, i.Quality)
 
-			for _, i := range res.Data.Items {
 				switch i.State {
 				case "idle":
 					idleCount++
@@ -130,6 +270,13 @@ func (m *metrics) onMetrics(ctx *gin.Context) {
 				readCount)
 			out += metric("rtsp_sessions{state=\"publish\"}",
 				publishCount)
+			out += qualityOut
+		}
+
+		out += m.rtspServer.onMetricsHistograms()
+
+		if v, ok := m.rtspServer.udpDrops(); ok {
+			out += metric("rtsp_udp_drops", int64(v))
 		}
 	}
 
@@ -139,8 +286,11 @@ func (m *metrics) onMetrics(ctx *gin.Context) {
 			idleCount := int64(0)
 			readCount := int64(0)
 			publishCount := int64(0)
+			qualityOut := ""
+
+			for id, i := range res.Data.Items {
+				qualityOut += metricReaderQuality("rtsps_session", id, i.Quality)
 
-			for _, i := range res.Data.Items {
 				switch i.State {
 				case "idle":
 					idleCount++
@@ -157,7 +307,10 @@ func (m *metrics) onMetrics(ctx *gin.Context) {
 				readCount)
 			out += metric("rtsps_sessions{state=\"publish\"}",
 				publishCount)
+			out += qualityOut
 		}
+
+		out += m.rtspsServer.onMetricsHistograms()
 	}
 
 	if !interfaceIsEmpty(m.rtmpServer) {
@@ -166,8 +319,11 @@ func (m *metrics) onMetrics(ctx *gin.Context) {
 			idleCount := int64(0)
 			readCount := int64(0)
 			publishCount := int64(0)
+			qualityOut := ""
+
+			for id, i := range res.Data.Items {
+				qualityOut += metricReaderQuality("rtmp_conn", id, i.Quality)
 
-			for _, i := range res.Data.Items {
 				switch i.State {
 				case "idle":
 					idleCount++
@@ -184,6 +340,7 @@ func (m *metrics) onMetrics(ctx *gin.Context) {
 				readCount)
 			out += metric("rtmp_conns{state=\"publish\"}",
 				publishCount)
+			out += qualityOut
 		}
 	}
 
@@ -194,43 +351,127 @@ func (m *metrics) onMetrics(ctx *gin.Context) {
 				out += metric("hls_muxers{name=\""+name+"\"}", 1)
 			}
 		}
+
+		out += m.hlsServer.onMetricsHistograms()
 	}
 
-	ctx.Writer.WriteHeader(http.StatusOK)
-	io.WriteString(ctx.Writer, out)
+	if !interfaceIsEmpty(m.limiter) {
+		conns, sessions := m.limiter.rejected()
+		out += metric("rejected_connections", conns)
+		out += metric("rejected_sessions", sessions)
+		out += metric("rate_limited_connections", m.limiter.rateLimited())
+	}
+
+	if !interfaceIsEmpty(m.auditor) {
+		successes, failures := m.auditor.outcomes()
+		out += metric("auth_attempts{outcome=\"success\"}", successes)
+		out += metric("auth_attempts{outcome=\"failure\"}", failures)
+	}
+
+	if !interfaceIsEmpty(m.quotas) {
+		for name, t := range m.quotas.info() {
+			labels := "{name=\"" + name + "\"}"
+			out += metric("tenants_publishers"+labels, int64(t.Publishers))
+			out += metric("tenants_readers"+labels, int64(t.Readers))
+			out += metric("tenants_bytes_received"+labels, int64(t.BytesReceived))
+			out += metric("tenants_bytes_sent"+labels, int64(t.BytesSent))
+			out += metric("tenants_ingest_bitrate"+labels, t.IngestBitrate)
+			out += metric("tenants_egress_bitrate"+labels, t.EgressBitrate)
+			out += metric("tenants_quota_rejections"+labels, t.Rejections)
+		}
+	}
+
+	if !interfaceIsEmpty(m.geoIP) {
+		counts := m.geoIP.counts()
+
+		countries := make([]string, 0, len(counts))
+		for country := range counts {
+			countries = append(countries, country)
+		}
+		sort.Strings(countries)
+
+		for _, country := range countries {
+			labels := "{country=\"" + country + "\",outcome=\""
+			out += metric("geoip_decisions"+labels+"allowed\"}", counts[country][0])
+			out += metric("geoip_decisions"+labels+"rejected\"}", counts[country][1])
+		}
+	}
+
+	if !interfaceIsEmpty(m.egress) {
+		for user, n := range m.egress.info() {
+			out += metric("egress_bytes_sent{user=\""+user+"\"}", int64(n))
+		}
+	}
+
+	return out
 }
 
-// onPathManagerSet is called by pathManager.
-func (m *metrics) onPathManagerSet(s metricsPathManager) {
+// onPathManagerSet is called by core.
+func (m *metricsSources) onPathManagerSet(s metricsPathManager) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	m.pathManager = s
 }
 
-// onRTSPServer is called by rtspServer (plain).
-func (m *metrics) onRTSPServerSet(s metricsRTSPServer) {
+// onRTSPServerSet is called by core.
+func (m *metricsSources) onRTSPServerSet(s metricsRTSPServer) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	m.rtspServer = s
 }
 
-// onRTSPServer is called by rtspServer (plain).
-func (m *metrics) onRTSPSServerSet(s metricsRTSPServer) {
+// onRTSPSServerSet is called by core.
+func (m *metricsSources) onRTSPSServerSet(s metricsRTSPServer) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	m.rtspsServer = s
 }
 
-// onRTMPServerSet is called by rtmpServer.
-func (m *metrics) onRTMPServerSet(s metricsRTMPServer) {
+// onRTMPServerSet is called by core.
+func (m *metricsSources) onRTMPServerSet(s metricsRTMPServer) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	m.rtmpServer = s
 }
 
-// onHLSServerSet is called by hlsServer.
-func (m *metrics) onHLSServerSet(s metricsHLSServer) {
+// onHLSServerSet is called by core.
+func (m *metricsSources) onHLSServerSet(s metricsHLSServer) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	m.hlsServer = s
 }
+
+// onLimiterSet is called by core.
+func (m *metricsSources) onLimiterSet(l metricsLimiter) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.limiter = l
+}
+
+// onGeoIPSet is called by core.
+func (m *metricsSources) onGeoIPSet(g metricsGeoIP) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.geoIP = g
+}
+
+// onEgressSet is called by core.
+func (m *metricsSources) onEgressSet(e metricsEgress) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.egress = e
+}
+
+// onQuotasSet is called by core.
+func (m *metricsSources) onQuotasSet(q metricsQuotas) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.quotas = q
+}
+
+// onAuditorSet is called by core.
+func (m *metricsSources) onAuditorSet(a metricsAuditor) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.auditor = a
+}
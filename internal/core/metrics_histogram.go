@@ -0,0 +1,71 @@
+package core
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// default buckets of Prometheus client libraries, in seconds.
+	histogramLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+	histogramSegmentDurationBuckets = []float64{0.5, 1, 2, 4, 6, 8, 10, 15, 20, 30}
+)
+
+// histogram counts observations into cumulative buckets,
+// with the same semantics of Prometheus histograms.
+type histogram struct {
+	buckets []float64
+
+	mutex  sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *histogram) observe(v float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// metricHistogram returns the metrics of a histogram.
+// labels are optional and must not be enclosed in braces.
+func metricHistogram(name string, labels string, h *histogram) string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	prefix := ""
+	suffix := ""
+	if labels != "" {
+		prefix = labels + ","
+		suffix = "{" + labels + "}"
+	}
+
+	var out strings.Builder
+
+	for i, b := range h.buckets {
+		out.WriteString(metric(name+"_bucket{"+prefix+"le=\""+strconv.FormatFloat(b, 'f', -1, 64)+"\"}",
+			int64(h.counts[i])))
+	}
+	out.WriteString(metric(name+"_bucket{"+prefix+"le=\"+Inf\"}", int64(h.count)))
+	out.WriteString(metricFloat(name+"_sum"+suffix, h.sum))
+	out.WriteString(metric(name+"_count"+suffix, int64(h.count)))
+
+	return out.String()
+}
@@ -0,0 +1,28 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricHistogram(t *testing.T) {
+	h := newHistogram([]float64{0.1, 1})
+	h.observe(0.05)
+	h.observe(0.5)
+	h.observe(2)
+
+	require.Equal(t, "test_bucket{le=\"0.1\"} 1\n"+
+		"test_bucket{le=\"1\"} 2\n"+
+		"test_bucket{le=\"+Inf\"} 3\n"+
+		"test_sum 2.55\n"+
+		"test_count 3\n",
+		metricHistogram("test", "", h))
+
+	require.Equal(t, "test_bucket{type=\"a\",le=\"0.1\"} 1\n"+
+		"test_bucket{type=\"a\",le=\"1\"} 2\n"+
+		"test_bucket{type=\"a\",le=\"+Inf\"} 3\n"+
+		"test_sum{type=\"a\"} 2.55\n"+
+		"test_count{type=\"a\"} 3\n",
+		metricHistogram("test", "type=\"a\"", h))
+}
@@ -80,6 +80,8 @@ func TestMetrics(t *testing.T) {
 		"hls_muxers{name=\"rtsp_path\"}":            "1",
 		"paths{name=\"rtsp_path\",state=\"ready\"}": "1",
 		"paths{name=\"rtmp_path\",state=\"ready\"}": "1",
+		"rejected_connections":                      "0",
+		"rejected_sessions":                         "0",
 		"rtmp_conns{state=\"idle\"}":                "0",
 		"rtmp_conns{state=\"publish\"}":             "1",
 		"rtmp_conns{state=\"read\"}":                "0",
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+const (
+	rtcpPayloadTypeSenderReport = 200
+)
+
+// NTP epoch is 1900-01-01, while the Unix epoch is 1970-01-01.
+var ntpEpochOffset = time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC).Sub(
+	time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC))
+
+// ntpEstimator estimates the absolute time of RTP packets
+// by using the RTCP sender reports of a track.
+type ntpEstimator struct {
+	clockRate int
+
+	initialized bool
+	refNTP      time.Time
+	refRTP      uint32
+}
+
+func newNTPEstimator(clockRate int) *ntpEstimator {
+	return &ntpEstimator{
+		clockRate: clockRate,
+	}
+}
+
+// processRTCP reads the sender reports contained in a RTCP (compound) packet.
+func (e *ntpEstimator) processRTCP(payload []byte) {
+	if ntp, rtpTime, ok := rtcpSenderReport(payload); ok {
+		e.processSenderReport(ntp, rtpTime)
+	}
+}
+
+// processSenderReport sets the absolute time of a RTP timestamp.
+func (e *ntpEstimator) processSenderReport(ntp uint64, rtpTime uint32) {
+	e.refNTP = ntpToTime(ntp)
+	e.refRTP = rtpTime
+	e.initialized = true
+}
+
+// estimate returns the absolute time of a RTP timestamp.
+// When no sender report has been received yet, the receive time is used.
+func (e *ntpEstimator) estimate(recvTime time.Time, rtpTime uint32) time.Time {
+	if !e.initialized || e.clockRate == 0 {
+		return recvTime
+	}
+
+	diff := int64(int32(rtpTime - e.refRTP))
+	return e.refNTP.Add(time.Duration(diff) * time.Second / time.Duration(e.clockRate))
+}
+
+// rtcpSenderReport returns the NTP and RTP times of the last
+// sender report contained in a RTCP (compound) packet.
+func rtcpSenderReport(payload []byte) (uint64, uint32, bool) {
+	var ntp uint64
+	var rtpTime uint32
+	found := false
+
+	for len(payload) >= 4 {
+		// length is in 32-bit words, minus one
+		l := (int(binary.BigEndian.Uint16(payload[2:])) + 1) * 4
+		if l > len(payload) {
+			break
+		}
+
+		if payload[1] == rtcpPayloadTypeSenderReport && l >= 20 {
+			ntp = binary.BigEndian.Uint64(payload[8:])
+			rtpTime = binary.BigEndian.Uint32(payload[16:])
+			found = true
+		}
+
+		payload = payload[l:]
+	}
+
+	return ntp, rtpTime, found
+}
+
+func ntpToTime(v uint64) time.Time {
+	secs := int64(v >> 32)
+	nanos := int64((v & 0xFFFFFFFF) * 1000000000 >> 32)
+	return time.Unix(secs, nanos).Add(-ntpEpochOffset)
+}
+
+func timeToNTP(t time.Time) uint64 {
+	d := t.Sub(time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC))
+	secs := uint64(d / time.Second)
+	frac := uint64(d%time.Second) << 32 / 1000000000
+	return secs<<32 | frac
+}
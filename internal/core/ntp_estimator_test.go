@@ -0,0 +1,52 @@
+package core
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNTPEstimator(t *testing.T) {
+	e := newNTPEstimator(90000)
+
+	recvTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, recvTime, e.estimate(recvTime, 1000))
+
+	// compound packet with a receiver report and a sender report
+	e.processRTCP([]byte{
+		0x80, 0xc9, 0x00, 0x01, 0x01, 0x02, 0x03, 0x04,
+		0x80, 0xc8, 0x00, 0x06, 0x01, 0x02, 0x03, 0x04,
+		0xe3, 0x98, 0xe4, 0x80, 0x80, 0x00, 0x00, 0x00, // NTP: 2021-01-01 00:00:00.5 UTC
+		0x00, 0x01, 0x5f, 0x90, // RTP: 90000
+		0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01,
+	})
+
+	require.Equal(t, time.Date(2021, 1, 1, 0, 0, 1, 500000000, time.UTC),
+		e.estimate(recvTime, 180000).UTC())
+	require.Equal(t, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		e.estimate(recvTime, 45000).UTC())
+}
+
+func TestRTCPSenderReport(t *testing.T) {
+	rr := []byte{0x80, 0xc9, 0x00, 0x01, 0x01, 0x02, 0x03, 0x04}
+
+	sr := make([]byte, 28)
+	sr[0] = 0x80
+	sr[1] = 200
+	binary.BigEndian.PutUint16(sr[2:4], 6)
+	binary.BigEndian.PutUint64(sr[8:16], 0x1122334455667788)
+	binary.BigEndian.PutUint32(sr[16:20], 123456)
+
+	ntp, rtpTime, ok := rtcpSenderReport(append(append([]byte(nil), rr...), sr...))
+	require.Equal(t, true, ok)
+	require.Equal(t, uint64(0x1122334455667788), ntp)
+	require.Equal(t, uint32(123456), rtpTime)
+
+	_, _, ok = rtcpSenderReport(rr)
+	require.Equal(t, false, ok)
+
+	_, _, ok = rtcpSenderReport(sr[:20])
+	require.Equal(t, false, ok)
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/url"
+	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -14,6 +17,7 @@ import (
 	"github.com/aler9/rtsp-simple-server/internal/conf"
 	"github.com/aler9/rtsp-simple-server/internal/externalcmd"
 	"github.com/aler9/rtsp-simple-server/internal/logger"
+	"github.com/aler9/rtsp-simple-server/internal/v4l2"
 )
 
 func newEmptyTimer() *time.Timer {
@@ -31,7 +35,36 @@ func (e pathErrNoOnePublishing) Error() string {
 	return fmt.Sprintf("no one is publishing to path '%s'", e.PathName)
 }
 
+type pathErrSourceNotReady struct {
+	PathName   string
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface.
+func (e pathErrSourceNotReady) Error() string {
+	return fmt.Sprintf("source of path '%s' is not ready yet", e.PathName)
+}
+
+type pathErrDisabled struct {
+	PathName string
+}
+
+// Error implements the error interface.
+func (e pathErrDisabled) Error() string {
+	return fmt.Sprintf("path '%s' is disabled", e.PathName)
+}
+
+type pathErrDraining struct{}
+
+// Error implements the error interface.
+func (pathErrDraining) Error() string {
+	return "server is draining and doesn't accept new sessions"
+}
+
 type pathErrAuthNotCritical struct {
+	// filled when the client provided wrong credentials,
+	// empty when the client is being asked for credentials.
+	Message string
 	*base.Response
 }
 
@@ -53,6 +86,7 @@ func (pathErrAuthCritical) Error() string {
 type pathParent interface {
 	log(logger.Level, string, ...interface{})
 	onPathSourceReady(*path)
+	onPathSourceNotReady(*path)
 	onPathClose(*path)
 }
 
@@ -120,12 +154,22 @@ type pathDescribeRes struct {
 
 type pathDescribeReq struct {
 	PathName            string
+	Query               string
 	URL                 *base.URL
+	Protocol            string
+	User                string
 	IP                  net.IP
 	ValidateCredentials func(pathUser conf.Credential, pathPass conf.Credential) error
 	Res                 chan pathDescribeRes
 }
 
+// pathDescribeReqOnHold is a DESCRIBE request that is waiting for an on-demand source.
+type pathDescribeReqOnHold struct {
+	req pathDescribeReq
+	// zero when the request waits until the source start timeout.
+	deadline time.Time
+}
+
 type pathReaderSetupPlayRes struct {
 	Path   *path
 	Stream *stream
@@ -135,19 +179,26 @@ type pathReaderSetupPlayRes struct {
 type pathReaderSetupPlayReq struct {
 	Author              reader
 	PathName            string
+	Query               string
+	Protocol            string
+	User                string
 	IP                  net.IP
 	ValidateCredentials func(pathUser conf.Credential, pathPass conf.Credential) error
 	Res                 chan pathReaderSetupPlayRes
 }
 
 type pathPublisherAnnounceRes struct {
-	Path *path
-	Err  error
+	Path        *path
+	Backchannel *rtspSource
+	Err         error
 }
 
 type pathPublisherAnnounceReq struct {
 	Author              publisher
 	PathName            string
+	StreamKey           string
+	Protocol            string
+	User                string
 	IP                  net.IP
 	ValidateCredentials func(pathUser conf.Credential, pathPass conf.Credential) error
 	Res                 chan pathPublisherAnnounceRes
@@ -174,17 +225,40 @@ type pathReaderPauseReq struct {
 	Res    chan struct{}
 }
 
+type pathReaderSourceParameterRes struct {
+	Source *rtspSource
+	Err    error
+}
+
+type pathReaderSourceParameterReq struct {
+	Author reader
+	Res    chan pathReaderSourceParameterRes
+}
+
 type pathPublisherPauseReq struct {
 	Author publisher
 	Res    chan struct{}
 }
 
 type pathAPIPathsListItem struct {
-	ConfName    string         `json:"confName"`
-	Conf        *conf.PathConf `json:"conf"`
-	Source      interface{}    `json:"source"`
-	SourceReady bool           `json:"sourceReady"`
-	Readers     []interface{}  `json:"readers"`
+	ConfName           string                `json:"confName"`
+	Conf               *conf.PathConf        `json:"conf"`
+	Source             interface{}           `json:"source"`
+	SourceReady        bool                  `json:"sourceReady"`
+	SourceFailures     uint64                `json:"sourceFailures"`
+	SourceInactivities uint64                `json:"sourceInactivities"`
+	AudioLevel         *streamAudioLevelInfo `json:"audioLevel,omitempty"`
+	Ingest             *pathIngestInfo       `json:"ingest,omitempty"`
+	Readers            []interface{}         `json:"readers"`
+}
+
+// pathIngestInfo describes the quality of the packets received from the source,
+// in order to distinguish network issues of the source from overloads of the server.
+type pathIngestInfo struct {
+	Tracks []streamQoSTrackInfo `json:"tracks"`
+	// packets dropped by the UDP sockets of the server, that are shared
+	// by all sources that use UDP. Drops mean that the server is overloaded.
+	UDPDrops *uint64 `json:"udpDrops,omitempty"`
 }
 
 type pathAPIPathsListData struct {
@@ -206,15 +280,83 @@ type pathAPIPathsListSubReq struct {
 	Res  chan struct{}
 }
 
+type pathAPIPathsInfoData struct {
+	ConfName    string            `json:"confName"`
+	Source      interface{}       `json:"source"`
+	SourceReady bool              `json:"sourceReady"`
+	Tracks      []streamInfoTrack `json:"tracks"`
+	Ingest      *pathIngestInfo   `json:"ingest,omitempty"`
+	Detections  *inferenceResult  `json:"detections,omitempty"`
+	Recording   *pathRecorderInfo `json:"recording,omitempty"`
+}
+
+type pathAPIPathsInfoRes struct {
+	Data *pathAPIPathsInfoData
+	Path *path
+	Err  error
+}
+
+type pathAPIPathsInfoReq struct {
+	Name string
+	Res  chan pathAPIPathsInfoRes
+}
+
+type pathAPIPathsDisabledListData struct {
+	Items []string `json:"items"`
+}
+
+type pathAPIPathsEnableRes struct {
+	Err error
+}
+
+type pathAPIPathsEnableReq struct {
+	Name    string
+	Disable bool
+	Res     chan pathAPIPathsEnableRes
+}
+
+type pathAPIPathsReadersItem struct {
+	Type       string    `json:"type"`
+	ID         string    `json:"id,omitempty"`
+	Protocol   string    `json:"protocol"`
+	RemoteAddr string    `json:"remoteAddr"`
+	User       string    `json:"user"`
+	Created    time.Time `json:"created"`
+	Uptime     string    `json:"uptime"`
+	BytesSent  uint64    `json:"bytesSent"`
+	Priority   string    `json:"priority,omitempty"`
+}
+
+type pathAPIPathsReadersData struct {
+	Items []pathAPIPathsReadersItem `json:"items"`
+}
+
+type pathAPIPathsReadersRes struct {
+	Data *pathAPIPathsReadersData
+	Path *path
+	Err  error
+}
+
+type pathAPIPathsReadersReq struct {
+	Name string
+	Res  chan pathAPIPathsReadersRes
+}
+
 type path struct {
 	rtspAddress     string
 	readTimeout     conf.StringDuration
 	writeTimeout    conf.StringDuration
 	readBufferCount int
 	readBufferSize  int
+	hookStdinJSON   bool
 	confName        string
 	conf            *conf.PathConf
 	name            string
+	captures        []string
+	quotas          *quotas
+	egress          *egressAccounting
+	shedding        *readerShedding
+	recordSchedules *recordSchedules
 	wg              *sync.WaitGroup
 	parent          pathParent
 
@@ -223,15 +365,37 @@ type path struct {
 	source             source
 	sourceReady        bool
 	sourceStaticWg     sync.WaitGroup
+	sourceRetry        *sourceRetry
 	readers            map[reader]pathReaderState
-	describeRequests   []pathDescribeReq
+	readerPriorities   map[reader]conf.ReaderPriority
+	describeRequests   []pathDescribeReqOnHold
+	describeTimer      *time.Timer
 	setupPlayRequests  []pathReaderSetupPlayReq
 	stream             *stream
+	pusher             *pusher
+	srtOutput          *srtOutput
+	recorder           *pathRecorder
 	onDemandCmd        *externalcmd.Cmd
 	onPublishCmd       *externalcmd.Cmd
 	onDemandReadyTimer *time.Timer
 	onDemandCloseTimer *time.Timer
 	onDemandState      pathOnDemandState
+	onDemandDeadline   time.Time
+	sourceQuery        url.Values
+
+	sourceInactivityTimer *time.Timer
+	sourceLastBytes       uint64
+	sourceLastActivity    time.Time
+	sourceInactivities    uint64
+	onSourceInactiveCmd   *externalcmd.Cmd
+	onMotionMutex         sync.Mutex
+	onMotionCmd           *externalcmd.Cmd
+	inference             *inferenceClient
+	sourceHoldTimer       *time.Timer
+	sourceHolding         bool
+	publisherReserved     bool
+	sheddingLastBytes     uint64
+	sheddingLastCheck     time.Time
 
 	// in
 	sourceStaticSetReady    chan pathSourceStaticSetReadyReq
@@ -245,7 +409,10 @@ type path struct {
 	readerSetupPlay         chan pathReaderSetupPlayReq
 	readerPlay              chan pathReaderPlayReq
 	readerPause             chan pathReaderPauseReq
+	readerSourceParameter   chan pathReaderSourceParameterReq
 	apiPathsList            chan pathAPIPathsListSubReq
+	apiPathsInfo            chan pathAPIPathsInfoReq
+	apiPathsReaders         chan pathAPIPathsReadersReq
 }
 
 func newPath(
@@ -255,9 +422,14 @@ func newPath(
 	writeTimeout conf.StringDuration,
 	readBufferCount int,
 	readBufferSize int,
+	hookStdinJSON bool,
 	confName string,
 	conf *conf.PathConf,
 	name string,
+	quotas *quotas,
+	egress *egressAccounting,
+	shedding *readerShedding,
+	recordSchedules *recordSchedules,
 	wg *sync.WaitGroup,
 	parent pathParent) *path {
 	ctx, ctxCancel := context.WithCancel(parentCtx)
@@ -268,16 +440,26 @@ func newPath(
 		writeTimeout:            writeTimeout,
 		readBufferCount:         readBufferCount,
 		readBufferSize:          readBufferSize,
+		hookStdinJSON:           hookStdinJSON,
 		confName:                confName,
 		conf:                    conf,
 		name:                    name,
+		captures:                hookCaptures(conf, name),
+		quotas:                  quotas,
+		egress:                  egress,
+		shedding:                shedding,
+		recordSchedules:         recordSchedules,
 		wg:                      wg,
 		parent:                  parent,
 		ctx:                     ctx,
 		ctxCancel:               ctxCancel,
+		sourceRetry:             newSourceRetry(conf),
 		readers:                 make(map[reader]pathReaderState),
+		describeTimer:           newEmptyTimer(),
 		onDemandReadyTimer:      newEmptyTimer(),
 		onDemandCloseTimer:      newEmptyTimer(),
+		sourceInactivityTimer:   newEmptyTimer(),
+		sourceHoldTimer:         newEmptyTimer(),
 		sourceStaticSetReady:    make(chan pathSourceStaticSetReadyReq),
 		sourceStaticSetNotReady: make(chan pathSourceStaticSetNotReadyReq),
 		describe:                make(chan pathDescribeReq),
@@ -289,7 +471,21 @@ func newPath(
 		readerSetupPlay:         make(chan pathReaderSetupPlayReq),
 		readerPlay:              make(chan pathReaderPlayReq),
 		readerPause:             make(chan pathReaderPauseReq),
+		readerSourceParameter:   make(chan pathReaderSourceParameterReq),
 		apiPathsList:            make(chan pathAPIPathsListSubReq),
+		apiPathsInfo:            make(chan pathAPIPathsInfoReq),
+		apiPathsReaders:         make(chan pathAPIPathsReadersReq),
+	}
+
+	// settings of the path override the global ones
+	if conf.ReadTimeout != 0 {
+		pa.readTimeout = conf.ReadTimeout
+	}
+	if conf.WriteTimeout != 0 {
+		pa.writeTimeout = conf.WriteTimeout
+	}
+	if conf.ReadBufferCount != 0 {
+		pa.readBufferCount = conf.ReadBufferCount
 	}
 
 	pa.log(logger.Debug, "opened")
@@ -335,22 +531,36 @@ func (pa *path) run() {
 
 	var onInitCmd *externalcmd.Cmd
 	if pa.conf.RunOnInit != "" {
-		pa.log(logger.Info, "runOnInit command started")
 		_, port, _ := net.SplitHostPort(pa.rtspAddress)
-		onInitCmd = externalcmd.New(pa.conf.RunOnInit, pa.conf.RunOnInitRestart, externalcmd.Environment{
-			Path: pa.name,
-			Port: port,
+		onInitCmd = hookStart(pa.log, "runOnInit", pa.conf.RunOnInit, pa.conf.RunOnInitRestart, pa.hookStdinJSON, hookEvent{
+			Event:     "init",
+			Path:      pa.name,
+			Port:      port,
+			SourceURL: hookSourceURL(pa.conf),
 		})
 	}
 
+	pa.readerPriorities = make(map[reader]conf.ReaderPriority)
+
+	sheddingTicker := time.NewTicker(readerSheddingPeriod)
+	defer sheddingTicker.Stop()
+
+	var multicastKeyRotation <-chan time.Time
+	if pa.conf.MulticastEncryption && pa.conf.MulticastKeyRotation != 0 {
+		t := time.NewTicker(time.Duration(pa.conf.MulticastKeyRotation))
+		defer t.Stop()
+		multicastKeyRotation = t.C
+	}
+
 	err := func() error {
 		for {
 			select {
 			case <-pa.onDemandReadyTimer.C:
-				for _, req := range pa.describeRequests {
-					req.Res <- pathDescribeRes{Err: fmt.Errorf("source of path '%s' has timed out", pa.name)}
+				for _, hr := range pa.describeRequests {
+					hr.req.Res <- pathDescribeRes{Err: fmt.Errorf("source of path '%s' has timed out", pa.name)}
 				}
 				pa.describeRequests = nil
+				pa.describeTimerReset()
 
 				for _, req := range pa.setupPlayRequests {
 					req.Res <- pathReaderSetupPlayRes{Err: fmt.Errorf("source of path '%s' has timed out", pa.name)}
@@ -363,6 +573,13 @@ func (pa *path) run() {
 					return fmt.Errorf("not in use")
 				}
 
+			case <-pa.describeTimer.C:
+				pa.describeRequestsExpire()
+
+				if pa.shouldClose() {
+					return fmt.Errorf("not in use")
+				}
+
 			case <-pa.onDemandCloseTimer.C:
 				pa.onDemandCloseSource()
 
@@ -370,6 +587,27 @@ func (pa *path) run() {
 					return fmt.Errorf("not in use")
 				}
 
+			case <-pa.sourceInactivityTimer.C:
+				pa.sourceInactivityCheck()
+
+				if pa.shouldClose() {
+					return fmt.Errorf("not in use")
+				}
+
+			case <-sheddingTicker.C:
+				pa.readerSheddingCheck()
+
+			case <-multicastKeyRotation:
+				pa.multicastKeyRotate()
+
+			case <-pa.sourceHoldTimer.C:
+				pa.log(logger.Info, "source is still not ready, stopped repeating the last key frame")
+				pa.sourceSetNotReady()
+
+				if pa.shouldClose() {
+					return fmt.Errorf("not in use")
+				}
+
 			case req := <-pa.sourceStaticSetReady:
 				if req.Source == pa.source {
 					pa.sourceSetReady(req.Tracks)
@@ -383,7 +621,7 @@ func (pa *path) run() {
 					if pa.isOnDemand() && pa.onDemandState != pathOnDemandStateInitial {
 						pa.onDemandCloseSource()
 					} else {
-						pa.sourceSetNotReady()
+						pa.sourceHoldOrSetNotReady()
 					}
 				}
 				close(req.Res)
@@ -435,9 +673,18 @@ func (pa *path) run() {
 			case req := <-pa.readerPause:
 				pa.handleReaderPause(req)
 
+			case req := <-pa.readerSourceParameter:
+				pa.handleReaderSourceParameter(req)
+
 			case req := <-pa.apiPathsList:
 				pa.handleAPIPathsList(req)
 
+			case req := <-pa.apiPathsInfo:
+				pa.handleAPIPathsInfo(req)
+
+			case req := <-pa.apiPathsReaders:
+				pa.handleAPIPathsReaders(req)
+
 			case <-pa.ctx.Done():
 				return fmt.Errorf("terminated")
 			}
@@ -446,16 +693,19 @@ func (pa *path) run() {
 
 	pa.ctxCancel()
 
+	pa.describeTimer.Stop()
 	pa.onDemandReadyTimer.Stop()
 	pa.onDemandCloseTimer.Stop()
+	pa.sourceInactivityTimer.Stop()
+	pa.sourceHoldTimer.Stop()
 
 	if onInitCmd != nil {
 		onInitCmd.Close()
 		pa.log(logger.Info, "runOnInit command stopped")
 	}
 
-	for _, req := range pa.describeRequests {
-		req.Res <- pathDescribeRes{Err: fmt.Errorf("terminated")}
+	for _, hr := range pa.describeRequests {
+		hr.req.Res <- pathDescribeRes{Err: fmt.Errorf("terminated")}
 	}
 
 	for _, req := range pa.setupPlayRequests {
@@ -463,10 +713,15 @@ func (pa *path) run() {
 	}
 
 	for rp := range pa.readers {
+		pa.quotas.removeReader(pa.conf.Tenant)
 		rp.close()
 	}
 
 	if pa.stream != nil {
+		pa.recorderClose()
+		pa.pusherClose()
+		pa.srtOutputClose()
+		pa.inferenceClose()
 		pa.stream.close()
 	}
 
@@ -479,6 +734,10 @@ func (pa *path) run() {
 		}
 	}
 
+	if pa.publisherReserved {
+		pa.quotas.removePublisher(pa.conf.Tenant)
+	}
+
 	// close onDemandCmd after the source has been closed.
 	// this avoids a deadlock in which onDemandCmd is a
 	// RTSP publisher that sends a TEARDOWN request and waits
@@ -489,6 +748,19 @@ func (pa *path) run() {
 		pa.log(logger.Info, "runOnDemand command stopped")
 	}
 
+	if pa.onSourceInactiveCmd != nil {
+		pa.onSourceInactiveCmd.Close()
+		pa.log(logger.Info, "runOnSourceInactive command stopped")
+	}
+
+	pa.onMotionMutex.Lock()
+	if pa.onMotionCmd != nil {
+		pa.onMotionCmd.Close()
+		pa.onMotionCmd = nil
+		pa.log(logger.Info, "runOnMotion command stopped")
+	}
+	pa.onMotionMutex.Unlock()
+
 	pa.log(logger.Debug, "closed (%v)", err)
 
 	pa.parent.onPathClose(pa)
@@ -507,7 +779,12 @@ func (pa *path) hasStaticSource() bool {
 		strings.HasPrefix(pa.conf.Source, "rtsps://") ||
 		strings.HasPrefix(pa.conf.Source, "rtmp://") ||
 		strings.HasPrefix(pa.conf.Source, "http://") ||
-		strings.HasPrefix(pa.conf.Source, "https://")
+		strings.HasPrefix(pa.conf.Source, "https://") ||
+		strings.HasPrefix(pa.conf.Source, "v4l2:") ||
+		pa.conf.Source == "rpiCamera" ||
+		strings.HasPrefix(pa.conf.Source, "file://") ||
+		pa.conf.Source == "testsrc" ||
+		strings.HasSuffix(pa.conf.Source, ".sdp")
 }
 
 func (pa *path) isOnDemand() bool {
@@ -519,14 +796,18 @@ func (pa *path) onDemandStartSource() {
 	if pa.hasStaticSource() {
 		pa.staticSourceCreate()
 		pa.onDemandReadyTimer = time.NewTimer(time.Duration(pa.conf.SourceOnDemandStartTimeout))
+		pa.onDemandDeadline = time.Now().Add(time.Duration(pa.conf.SourceOnDemandStartTimeout))
 	} else {
-		pa.log(logger.Info, "runOnDemand command started")
 		_, port, _ := net.SplitHostPort(pa.rtspAddress)
-		pa.onDemandCmd = externalcmd.New(pa.conf.RunOnDemand, pa.conf.RunOnDemandRestart, externalcmd.Environment{
-			Path: pa.name,
-			Port: port,
+		pa.onDemandCmd = hookStart(pa.log, "runOnDemand", pa.conf.RunOnDemand, pa.conf.RunOnDemandRestart, pa.hookStdinJSON, hookEvent{
+			Event:     "demand",
+			Path:      pa.name,
+			Captures:  pa.captures,
+			Port:      port,
+			SourceURL: hookSourceURL(pa.conf),
 		})
 		pa.onDemandReadyTimer = time.NewTimer(time.Duration(pa.conf.RunOnDemandStartTimeout))
+		pa.onDemandDeadline = time.Now().Add(time.Duration(pa.conf.RunOnDemandStartTimeout))
 	}
 
 	pa.onDemandState = pathOnDemandStateWaitingReady
@@ -551,6 +832,7 @@ func (pa *path) onDemandCloseSource() {
 
 	// set state before doPublisherRemove()
 	pa.onDemandState = pathOnDemandStateInitial
+	pa.sourceQuery = nil
 
 	if pa.hasStaticSource() {
 		if pa.sourceReady {
@@ -578,19 +860,104 @@ func (pa *path) onDemandCloseSource() {
 }
 
 func (pa *path) sourceSetReady(tracks gortsplib.Tracks) {
+	if pa.sourceHolding {
+		pa.sourceHoldStop()
+
+		if pa.stream.acceptsSourceTracks(tracks) {
+			pa.log(logger.Info, "source is ready again, stopped repeating the last key frame")
+			pa.sourceInactivityStart()
+			return
+		}
+
+		pa.sourceSetNotReady()
+	}
+
 	pa.sourceReady = true
-	pa.stream = newStream(tracks)
+	pa.stream = newStream(tracks, pa.conf, pa.quotas.tenant(pa.conf.Tenant))
+
+	if pa.stream.silentAudio != nil {
+		pa.log(logger.Info, "source has no audio tracks, injecting a silent audio track")
+	}
+
+	if pa.conf.MotionDetection {
+		// the stream is not yet used by the source, therefore the detector can be set here
+		pa.stream.motion = newStreamMotion(tracks, pa.conf.MotionDetectionThreshold, pa.onMotion)
+		if pa.stream.motion == nil {
+			pa.log(logger.Warn, "motion detection is enabled but the source has no H264 tracks")
+		}
+	}
+
+	if pa.conf.SAPAnnounce {
+		sap, err := newStreamSAP(sapAddress, sapInterval, pa.name, pa.stream.tracks())
+		if err != nil {
+			pa.log(logger.Warn, "unable to announce the stream with SAP: %v", err)
+		} else {
+			pa.stream.sap = sap
+		}
+	}
+
+	if pa.conf.InferenceURL != "" {
+		if pa.stream.inference != nil {
+			pa.inference = newInferenceClient(
+				pa.ctx,
+				strings.ReplaceAll(pa.conf.InferenceURL, conf.PathNamePlaceholder, pa.name),
+				time.Duration(pa.conf.InferenceInterval),
+				time.Duration(pa.readTimeout),
+				pa.stream.inference,
+				pa)
+		} else {
+			pa.log(logger.Warn, "inference is enabled but the source has no H264 tracks")
+		}
+	}
+
+	if ur := pa.conf.Resolved().Push; ur != "" {
+		pa.pusher = newPusher(
+			pa.ctx,
+			strings.ReplaceAll(ur, conf.PathNamePlaceholder, pa.name),
+			pa.conf.Resolved().PushPreset,
+			pa.readTimeout,
+			pa.writeTimeout,
+			pa.readBufferCount,
+			pa.stream,
+			pa)
+		pa.stream.readerAdd(pa.pusher)
+	}
+
+	if ur := pa.conf.Resolved().SRTOutput; ur != "" {
+		pa.srtOutput = newSRTOutput(
+			pa.ctx,
+			strings.ReplaceAll(ur, conf.PathNamePlaceholder, pa.name),
+			pa.readTimeout,
+			pa.readBufferCount,
+			pa.stream,
+			pa)
+		pa.stream.readerAdd(pa.srtOutput)
+	}
+
+	if pa.conf.RunOnRecord != "" {
+		pa.recorder = newPathRecorder(
+			pa.ctx,
+			pa.name,
+			pa.conf,
+			pa.rtspAddress,
+			pa.hookStdinJSON,
+			pa.recordSchedules,
+			pa)
+	}
+
+	pa.sourceInactivityStart()
 
 	if pa.isOnDemand() {
 		pa.onDemandReadyTimer.Stop()
 		pa.onDemandReadyTimer = newEmptyTimer()
 
-		for _, req := range pa.describeRequests {
-			req.Res <- pathDescribeRes{
+		for _, hr := range pa.describeRequests {
+			hr.req.Res <- pathDescribeRes{
 				Stream: pa.stream,
 			}
 		}
 		pa.describeRequests = nil
+		pa.describeTimerReset()
 
 		for _, req := range pa.setupPlayRequests {
 			pa.handleReaderSetupPlayPost(req)
@@ -608,6 +975,10 @@ func (pa *path) sourceSetReady(tracks gortsplib.Tracks) {
 }
 
 func (pa *path) sourceSetNotReady() {
+	if pa.sourceHolding {
+		pa.sourceHoldStop()
+	}
+
 	for r := range pa.readers {
 		pa.doReaderRemove(r)
 		r.close()
@@ -624,9 +995,248 @@ func (pa *path) sourceSetNotReady() {
 		pa.log(logger.Info, "runOnPublish command stopped")
 	}
 
+	pa.recorderClose()
+	pa.pusherClose()
+	pa.srtOutputClose()
+	pa.inferenceClose()
+
+	pa.sourceInactivityTimer.Stop()
+	pa.sourceInactivityTimer = newEmptyTimer()
+
 	pa.sourceReady = false
 	pa.stream.close()
 	pa.stream = nil
+
+	pa.parent.onPathSourceNotReady(pa)
+}
+
+// sourceHoldOrSetNotReady is called when the source drops. If sourceOutageHold
+// is enabled, readers are kept and the last key frame is repeated until
+// a new source is ready or sourceOutageHold has passed.
+func (pa *path) sourceHoldOrSetNotReady() {
+	// the source has already dropped, and a new publisher
+	// has been removed before it started publishing.
+	if pa.sourceHolding {
+		return
+	}
+
+	if pa.conf.SourceOutageHold != 0 && pa.stream.hold.start() {
+		pa.log(logger.Info, "source is not ready, repeating the last key frame for up to %v",
+			time.Duration(pa.conf.SourceOutageHold))
+
+		pa.sourceHolding = true
+		pa.stream.rtcpSender.resetSource()
+		pa.sourceInactivityTimer.Stop()
+		pa.sourceInactivityTimer = newEmptyTimer()
+		pa.sourceHoldTimer = time.NewTimer(time.Duration(pa.conf.SourceOutageHold))
+		return
+	}
+
+	pa.sourceSetNotReady()
+}
+
+func (pa *path) sourceHoldStop() {
+	pa.sourceHoldTimer.Stop()
+	pa.sourceHoldTimer = newEmptyTimer()
+	pa.sourceHolding = false
+	pa.stream.hold.stop()
+}
+
+func (pa *path) sourceInactivityStart() {
+	if pa.conf.SourceInactivityTimeout != 0 {
+		pa.sourceLastBytes = pa.stream.sourceBytes()
+		pa.sourceLastActivity = time.Now()
+		pa.sourceInactivityTimer.Stop()
+		pa.sourceInactivityTimer = time.NewTimer(time.Duration(pa.conf.SourceInactivityTimeout) / 4)
+	}
+}
+
+// sourceInactivityCheck is called periodically while the source is ready,
+// and closes the source when it hasn't sent any data for sourceInactivityTimeout.
+// This detects sources whose connection is still open but that stopped sending frames.
+func (pa *path) sourceInactivityCheck() {
+	timeout := time.Duration(pa.conf.SourceInactivityTimeout)
+
+	if n := pa.stream.sourceBytes(); n != pa.sourceLastBytes {
+		pa.sourceLastBytes = n
+		pa.sourceLastActivity = time.Now()
+	} else if time.Since(pa.sourceLastActivity) >= timeout {
+		pa.sourceSetInactive()
+		return
+	}
+
+	pa.sourceInactivityTimer = time.NewTimer(timeout / 4)
+}
+
+// onMotion is called by the motion detector of the stream.
+func (pa *path) onMotion(active bool) {
+	pa.onMotionMutex.Lock()
+	defer pa.onMotionMutex.Unlock()
+
+	if !active {
+		pa.log(logger.Info, "motion ended")
+
+		if pa.onMotionCmd != nil {
+			pa.onMotionCmd.Close()
+			pa.onMotionCmd = nil
+			pa.log(logger.Info, "runOnMotion command stopped")
+		}
+		return
+	}
+
+	pa.log(logger.Info, "motion detected")
+
+	if pa.conf.RunOnMotion != "" {
+		_, port, _ := net.SplitHostPort(pa.rtspAddress)
+		pa.onMotionCmd = hookStart(pa.log, "runOnMotion", pa.conf.RunOnMotion, false, pa.hookStdinJSON, hookEvent{
+			Event:     "motion",
+			Path:      pa.name,
+			Captures:  pa.captures,
+			Port:      port,
+			SourceURL: hookSourceURL(pa.conf),
+		})
+	}
+}
+
+func (pa *path) sourceSetInactive() {
+	pa.log(logger.Warn, "source is inactive: no data received in the last %v", time.Duration(pa.conf.SourceInactivityTimeout))
+	pa.sourceInactivities++
+
+	if pa.conf.RunOnSourceInactive != "" {
+		if pa.onSourceInactiveCmd != nil {
+			pa.onSourceInactiveCmd.Close()
+		}
+
+		_, port, _ := net.SplitHostPort(pa.rtspAddress)
+		pa.onSourceInactiveCmd = hookStart(pa.log, "runOnSourceInactive", pa.conf.RunOnSourceInactive, false, pa.hookStdinJSON, hookEvent{
+			Event:     "sourceInactive",
+			Path:      pa.name,
+			Captures:  pa.captures,
+			Port:      port,
+			SourceURL: hookSourceURL(pa.conf),
+		})
+	}
+
+	switch {
+	case pa.isOnDemand() && pa.onDemandState != pathOnDemandStateInitial:
+		// the source is started again by the next reader.
+		pa.onDemandCloseSource()
+
+	case pa.hasStaticSource():
+		pa.sourceHoldOrSetNotReady()
+		pa.source.(sourceStatic).close()
+		pa.source = nil
+		pa.staticSourceCreate()
+
+	default:
+		// the publisher is in charge of reconnecting.
+		pa.source.(publisher).close()
+		pa.doPublisherRemove()
+	}
+}
+
+func (pa *path) pusherClose() {
+	if pa.pusher != nil {
+		pa.stream.readerRemove(pa.pusher)
+		pa.pusher.close()
+		pa.pusher = nil
+	}
+}
+
+func (pa *path) srtOutputClose() {
+	if pa.srtOutput != nil {
+		pa.stream.readerRemove(pa.srtOutput)
+		pa.srtOutput.close()
+		pa.srtOutput = nil
+	}
+}
+
+func (pa *path) recorderClose() {
+	if pa.recorder != nil {
+		pa.recorder.close()
+		pa.recorder = nil
+	}
+}
+
+func (pa *path) inferenceClose() {
+	if pa.inference != nil {
+		pa.inference.close()
+		pa.inference = nil
+	}
+}
+
+// staticSourceURL returns the URL of the static source, in which the
+// path name placeholder is replaced with the name of the path, and
+// query parameters of the reader are inserted.
+func (pa *path) staticSourceURL() string {
+	ur := strings.ReplaceAll(pa.conf.Resolved().Source, conf.PathNamePlaceholder, pa.name)
+
+	if len(pa.conf.SourceQueryParams) == 0 {
+		return ur
+	}
+
+	// replace longer names first, in order not to replace
+	// placeholders whose name begins with the name of another parameter.
+	names := append([]string(nil), pa.conf.SourceQueryParams...)
+	sort.Slice(names, func(i, j int) bool {
+		return len(names[i]) > len(names[j])
+	})
+
+	var appended []string
+	for _, name := range names {
+		placeholder := conf.QueryParamPlaceholderPrefix + name
+		if strings.Contains(ur, placeholder) {
+			ur = strings.ReplaceAll(ur, placeholder, url.QueryEscape(pa.sourceQuery.Get(name)))
+		} else if _, ok := pa.sourceQuery[name]; ok {
+			appended = append(appended, name)
+		}
+	}
+
+	if len(appended) == 0 {
+		return ur
+	}
+
+	u, err := url.Parse(ur)
+	if err != nil {
+		return ur
+	}
+
+	q := u.Query()
+	for _, name := range appended {
+		q.Set(name, pa.sourceQuery.Get(name))
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+// checkSourceQuery extracts the query parameters of a reader that are forwarded
+// to the source. When the source is not running, they're saved in order to be
+// used to start the source; otherwise, they must be equal to the ones of the source.
+func (pa *path) checkSourceQuery(rawQuery string) error {
+	if len(pa.conf.SourceQueryParams) == 0 {
+		return nil
+	}
+
+	all, _ := url.ParseQuery(rawQuery)
+
+	query := make(url.Values)
+	for _, name := range pa.conf.SourceQueryParams {
+		if v, ok := all[name]; ok {
+			query[name] = v[:1]
+		}
+	}
+
+	if pa.onDemandState == pathOnDemandStateInitial {
+		pa.sourceQuery = query
+		return nil
+	}
+
+	if !reflect.DeepEqual(query, pa.sourceQuery) {
+		return fmt.Errorf("path '%s' is in use with different query parameters", pa.name)
+	}
+
+	return nil
 }
 
 func (pa *path) staticSourceCreate() {
@@ -635,30 +1245,97 @@ func (pa *path) staticSourceCreate() {
 		strings.HasPrefix(pa.conf.Source, "rtsps://"):
 		pa.source = newRTSPSource(
 			pa.ctx,
-			pa.conf.Source,
+			pa.staticSourceURL(),
 			pa.conf.SourceProtocol,
-			pa.conf.SourceAnyPortEnable,
+			pa.conf.SourceAnyPortEnable || pa.conf.SourceQuirks.Has(conf.QuirkAnyPort),
+			pa.conf.SourceQuirks.Has(conf.QuirkBrokenSDP),
 			pa.conf.SourceFingerprint,
+			pa.conf.SourceBackchannel,
 			pa.readTimeout,
 			pa.writeTimeout,
 			pa.readBufferCount,
 			pa.readBufferSize,
+			pa.sourceRetry,
 			&pa.sourceStaticWg,
 			pa)
 	case strings.HasPrefix(pa.conf.Source, "rtmp://"):
 		pa.source = newRTMPSource(
 			pa.ctx,
-			pa.conf.Source,
+			pa.staticSourceURL(),
 			pa.readTimeout,
 			pa.writeTimeout,
+			pa.sourceRetry,
 			&pa.sourceStaticWg,
 			pa)
 	case strings.HasPrefix(pa.conf.Source, "http://") ||
 		strings.HasPrefix(pa.conf.Source, "https://"):
 		pa.source = newHLSSource(
 			pa.ctx,
-			pa.conf.Source,
+			pa.staticSourceURL(),
 			pa.conf.SourceFingerprint,
+			pa.sourceRetry,
+			&pa.sourceStaticWg,
+			pa)
+	case strings.HasPrefix(pa.conf.Source, "v4l2:"):
+		pa.source = newV4L2Source(
+			pa.ctx,
+			"v4l2",
+			pa.conf.Source[len("v4l2:"):],
+			v4l2.Params{
+				Width:       pa.conf.V4L2Width,
+				Height:      pa.conf.V4L2Height,
+				FPS:         pa.conf.V4L2FPS,
+				PixelFormat: v4l2.PixelFormatH264,
+			},
+			pa.readTimeout,
+			pa.sourceRetry,
+			&pa.sourceStaticWg,
+			pa)
+	case pa.conf.Source == "rpiCamera":
+		pa.source = newV4L2Source(
+			pa.ctx,
+			"rpiCamera",
+			rpiCameraDevice,
+			v4l2.Params{
+				Width:       pa.conf.RPICameraWidth,
+				Height:      pa.conf.RPICameraHeight,
+				FPS:         pa.conf.RPICameraFPS,
+				PixelFormat: v4l2.PixelFormatH264,
+				Controls: map[v4l2.Control]int32{
+					v4l2.ControlBitrate: int32(pa.conf.RPICameraBitrate),
+					v4l2.ControlRotate:  int32(pa.conf.RPICameraRotation),
+					// send SPS and PPS with every IDR, and an IDR every second,
+					// in order to allow readers to start decoding quickly.
+					v4l2.ControlRepeatSequence: 1,
+					v4l2.ControlH264IPeriod:    int32(pa.conf.RPICameraFPS),
+				},
+			},
+			pa.readTimeout,
+			pa.sourceRetry,
+			&pa.sourceStaticWg,
+			pa)
+	case strings.HasPrefix(pa.conf.Source, "file://"):
+		pa.source = newFileSource(
+			pa.ctx,
+			pa.conf.Source[len("file://"):],
+			pa.sourceRetry,
+			&pa.sourceStaticWg,
+			pa)
+	case pa.conf.Source == "testsrc":
+		pa.source = newTestsrcSource(
+			pa.ctx,
+			pa.conf.TestsrcWidth,
+			pa.conf.TestsrcHeight,
+			pa.conf.TestsrcFPS,
+			pa.sourceRetry,
+			&pa.sourceStaticWg,
+			pa)
+	case strings.HasSuffix(pa.conf.Source, ".sdp"):
+		pa.source = newSDPSource(
+			pa.ctx,
+			pa.conf.Source,
+			pa.readTimeout,
+			pa.sourceRetry,
 			&pa.sourceStaticWg,
 			pa)
 	}
@@ -667,19 +1344,118 @@ func (pa *path) staticSourceCreate() {
 func (pa *path) doReaderRemove(r reader) {
 	state := pa.readers[r]
 
+	pa.log(logger.Debug, "[session %s] reader removed", r.ID())
+
 	if state == pathReaderStatePlay {
 		pa.stream.readerRemove(r)
+		pa.egress.readerRemove(r)
 	}
 
 	delete(pa.readers, r)
+	delete(pa.readerPriorities, r)
+	pa.quotas.removeReader(pa.conf.Tenant)
+}
+
+// lowestPriorityReader returns the reader that must be shed first, that is
+// the most recent among the readers with the lowest priority.
+// Critical readers are never returned.
+func (pa *path) lowestPriorityReader() (reader, bool) {
+	var ret reader
+	var retPriority conf.ReaderPriority
+	var retCreated time.Time
+
+	for r := range pa.readers {
+		priority := pa.readerPriorities[r]
+		if priority == conf.ReaderPriorityCritical {
+			continue
+		}
+
+		created := r.onReaderAPIReadersItem().Created
+		if ret == nil || priority < retPriority || (priority == retPriority && created.After(retCreated)) {
+			ret = r
+			retPriority = priority
+			retCreated = created
+		}
+	}
+
+	return ret, ret != nil
+}
+
+func (pa *path) readerShed(r reader, reason string) {
+	pa.log(logger.Warn, "[session %s] reader with priority '%s' closed %s", r.ID(), pa.readerPriorities[r], reason)
+
+	pa.doReaderRemove(r)
+	r.close()
+
+	if pa.isOnDemand() &&
+		len(pa.readers) == 0 &&
+		pa.onDemandState == pathOnDemandStateReady {
+		pa.onDemandScheduleClose()
+	}
+}
+
+// readerSheddingCheck sheds readers when the server is under memory pressure
+// or when the egress bitrate of the path exceeds maxEgressBitrate.
+func (pa *path) readerSheddingCheck() {
+	if level, ok := pa.shedding.memoryLevel(); ok {
+		for r := range pa.readers {
+			if pa.readerPriorities[r] <= level {
+				pa.readerShed(r, "because of memory pressure")
+			}
+		}
+	}
+
+	if pa.conf.MaxEgressBitrate == 0 || pa.stream == nil {
+		return
+	}
+
+	now := time.Now()
+	bytes := pa.stream.egressBytes()
+
+	// the counter restarts when the stream is recreated
+	if !pa.sheddingLastCheck.IsZero() && bytes >= pa.sheddingLastBytes {
+		bitrate := int64(float64(bytes-pa.sheddingLastBytes) * 8 / now.Sub(pa.sheddingLastCheck).Seconds())
+
+		// a reader is shed at every check, in order to measure the effect of shedding
+		if bitrate > int64(pa.conf.MaxEgressBitrate) {
+			if r, ok := pa.lowestPriorityReader(); ok {
+				pa.readerShed(r, fmt.Sprintf("since the egress bitrate (%d bit/s) exceeds 'maxEgressBitrate'", bitrate))
+			}
+		}
+	}
+
+	pa.sheddingLastBytes = bytes
+	pa.sheddingLastCheck = now
+}
+
+// multicastKeyRotate replaces the key used to encrypt packets sent to RTSP readers.
+// Readers are closed, since they can't decrypt packets encrypted with the new key;
+// in order to obtain it, they have to connect and authenticate again.
+func (pa *path) multicastKeyRotate() {
+	if pa.stream == nil || pa.stream.srtp == nil {
+		return
+	}
+
+	pa.stream.srtp.rotate()
+
+	for r := range pa.readers {
+		if _, ok := r.(*rtspSession); ok {
+			pa.doReaderRemove(r)
+			r.close()
+		}
+	}
+
+	pa.log(logger.Info, "multicast key rotated")
 }
 
 func (pa *path) doPublisherRemove() {
+	pa.log(logger.Debug, "[session %s] publisher removed", pa.source.(publisher).ID())
+
 	if pa.sourceReady {
 		if pa.isOnDemand() && pa.onDemandState != pathOnDemandStateInitial {
 			pa.onDemandCloseSource()
 		} else {
-			pa.sourceSetNotReady()
+			pa.sourceHoldOrSetNotReady()
 		}
 	} else {
 		for r := range pa.readers {
@@ -688,10 +1464,23 @@ func (pa *path) doPublisherRemove() {
 		}
 	}
 
+	// the publisher may have been already released by onDemandCloseSource(),
+	// that calls doPublisherRemove() too.
+	if pa.publisherReserved {
+		pa.publisherReserved = false
+		pa.quotas.removePublisher(pa.conf.Tenant)
+	}
+
 	pa.source = nil
 }
 
 func (pa *path) handleDescribe(req pathDescribeReq) {
+	err := pa.checkSourceQuery(req.Query)
+	if err != nil {
+		req.Res <- pathDescribeRes{Err: err}
+		return
+	}
+
 	if _, ok := pa.source.(*sourceRedirect); ok {
 		req.Res <- pathDescribeRes{
 			Redirect: pa.conf.SourceRedirect,
@@ -710,30 +1499,94 @@ func (pa *path) handleDescribe(req pathDescribeReq) {
 		if pa.onDemandState == pathOnDemandStateInitial {
 			pa.onDemandStartSource()
 		}
-		pa.describeRequests = append(pa.describeRequests, req)
+
+		switch pa.conf.OnDemandDescribe {
+		case conf.OnDemandDescribeUnavailable:
+			req.Res <- pathDescribeRes{Err: pa.sourceNotReadyError()}
+
+		case conf.OnDemandDescribeFallback:
+			req.Res <- pathDescribeRes{Redirect: pa.fallbackURL(req.URL)}
+
+		default:
+			hr := pathDescribeReqOnHold{req: req}
+			if pa.conf.OnDemandDescribeTimeout != 0 {
+				hr.deadline = time.Now().Add(time.Duration(pa.conf.OnDemandDescribeTimeout))
+			}
+			pa.describeRequests = append(pa.describeRequests, hr)
+			if len(pa.describeRequests) == 1 {
+				pa.describeTimerReset()
+			}
+		}
 		return
 	}
 
 	if pa.conf.Fallback != "" {
-		fallbackURL := func() string {
-			if strings.HasPrefix(pa.conf.Fallback, "/") {
-				ur := base.URL{
-					Scheme: req.URL.Scheme,
-					User:   req.URL.User,
-					Host:   req.URL.Host,
-					Path:   pa.conf.Fallback,
-				}
-				return ur.String()
-			}
-			return pa.conf.Fallback
-		}()
-		req.Res <- pathDescribeRes{Redirect: fallbackURL}
+		req.Res <- pathDescribeRes{Redirect: pa.fallbackURL(req.URL)}
 		return
 	}
 
 	req.Res <- pathDescribeRes{Err: pathErrNoOnePublishing{PathName: pa.name}}
 }
 
+func (pa *path) fallbackURL(reqURL *base.URL) string {
+	if strings.HasPrefix(pa.conf.Fallback, "/") {
+		ur := base.URL{
+			Scheme: reqURL.Scheme,
+			User:   reqURL.User,
+			Host:   reqURL.Host,
+			Path:   pa.conf.Fallback,
+		}
+		return ur.String()
+	}
+	return pa.conf.Fallback
+}
+
+// sourceNotReadyError returns the error sent to readers when the on-demand source
+// is not ready yet. They are asked to retry when the source should be ready.
+func (pa *path) sourceNotReadyError() pathErrSourceNotReady {
+	retryAfter := time.Until(pa.onDemandDeadline)
+	if retryAfter < time.Second {
+		retryAfter = time.Second
+	}
+
+	return pathErrSourceNotReady{
+		PathName:   pa.name,
+		RetryAfter: retryAfter,
+	}
+}
+
+// describeRequestsExpire replies to the DESCRIBE requests that have been waiting
+// for onDemandDescribeTimeout. Requests are sorted by deadline.
+func (pa *path) describeRequestsExpire() {
+	now := time.Now()
+	n := 0
+
+	for _, hr := range pa.describeRequests {
+		if hr.deadline.IsZero() || hr.deadline.After(now) {
+			break
+		}
+		hr.req.Res <- pathDescribeRes{Err: pa.sourceNotReadyError()}
+		n++
+	}
+
+	pa.describeRequests = pa.describeRequests[n:]
+	if len(pa.describeRequests) == 0 {
+		pa.describeRequests = nil
+	}
+
+	pa.describeTimerReset()
+}
+
+func (pa *path) describeTimerReset() {
+	pa.describeTimer.Stop()
+
+	if len(pa.describeRequests) != 0 && !pa.describeRequests[0].deadline.IsZero() {
+		pa.describeTimer = time.NewTimer(time.Until(pa.describeRequests[0].deadline))
+	} else {
+		pa.describeTimer = newEmptyTimer()
+	}
+}
+
 func (pa *path) handlePublisherRemove(req pathPublisherRemoveReq) {
 	if pa.source == req.Author {
 		pa.doPublisherRemove()
@@ -742,6 +1595,21 @@ func (pa *path) handlePublisherRemove(req pathPublisherRemoveReq) {
 }
 
 func (pa *path) handlePublisherAnnounce(req pathPublisherAnnounceReq) {
+	// publishers send data to the backchannel of the source,
+	// without replacing it.
+	if pa.conf.SourceBackchannel {
+		s, ok := pa.source.(*rtspSource)
+		if !ok {
+			req.Res <- pathPublisherAnnounceRes{Err: fmt.Errorf("source of path '%s' is not running", pa.name)}
+			return
+		}
+
+		pa.log(logger.Debug, "[session %s] backchannel publisher added", req.Author.ID())
+
+		req.Res <- pathPublisherAnnounceRes{Path: pa, Backchannel: s}
+		return
+	}
+
 	if pa.source != nil {
 		if pa.hasStaticSource() {
 			req.Res <- pathPublisherAnnounceRes{Err: fmt.Errorf("path '%s' is assigned to a static source", pa.name)}
@@ -758,7 +1626,16 @@ func (pa *path) handlePublisherAnnounce(req pathPublisherAnnounceReq) {
 		pa.doPublisherRemove()
 	}
 
+	err := pa.quotas.addPublisher(pa.conf.Tenant)
+	if err != nil {
+		req.Res <- pathPublisherAnnounceRes{Err: err}
+		return
+	}
+
+	pa.log(logger.Debug, "[session %s] publisher added", req.Author.ID())
+
 	pa.source = req.Author
+	pa.publisherReserved = true
 
 	req.Res <- pathPublisherAnnounceRes{Path: pa}
 }
@@ -773,12 +1650,17 @@ func (pa *path) handlePublisherRecord(req pathPublisherRecordReq) {
 
 	pa.sourceSetReady(req.Tracks)
 
-	if pa.conf.RunOnPublish != "" {
-		pa.log(logger.Info, "runOnPublish command started")
+	// when the stream has been held, onPublishCmd is still running.
+	if pa.conf.RunOnPublish != "" && pa.onPublishCmd == nil {
 		_, port, _ := net.SplitHostPort(pa.rtspAddress)
-		pa.onPublishCmd = externalcmd.New(pa.conf.RunOnPublish, pa.conf.RunOnPublishRestart, externalcmd.Environment{
-			Path: pa.name,
-			Port: port,
+		pa.onPublishCmd = hookStart(pa.log, "runOnPublish", pa.conf.RunOnPublish, pa.conf.RunOnPublishRestart, pa.hookStdinJSON, hookEvent{
+			Event:      "publish",
+			Path:       pa.name,
+			Captures:   pa.captures,
+			Port:       port,
+			SourceURL:  hookSourceURL(pa.conf),
+			Client:     req.Author.onSourceAPIDescribe(),
+			RemoteAddr: hookRemoteAddr(req.Author),
 		})
 	}
 
@@ -790,7 +1672,7 @@ func (pa *path) handlePublisherPause(req pathPublisherPauseReq) {
 		if pa.isOnDemand() && pa.onDemandState != pathOnDemandStateInitial {
 			pa.onDemandCloseSource()
 		} else {
-			pa.sourceSetNotReady()
+			pa.sourceHoldOrSetNotReady()
 		}
 	}
 	close(req.Res)
@@ -810,6 +1692,12 @@ func (pa *path) handleReaderRemove(req pathReaderRemoveReq) {
 }
 
 func (pa *path) handleReaderSetupPlay(req pathReaderSetupPlayReq) {
+	err := pa.checkSourceQuery(req.Query)
+	if err != nil {
+		req.Res <- pathReaderSetupPlayRes{Err: err}
+		return
+	}
+
 	if pa.sourceReady {
 		pa.handleReaderSetupPlayPost(req)
 		return
@@ -827,7 +1715,34 @@ func (pa *path) handleReaderSetupPlay(req pathReaderSetupPlayReq) {
 }
 
 func (pa *path) handleReaderSetupPlayPost(req pathReaderSetupPlayReq) {
+	err := pa.quotas.addReader(pa.conf.Tenant)
+	if err != nil {
+		req.Res <- pathReaderSetupPlayRes{Err: err}
+		return
+	}
+
+	priority := readerPriority(pa.conf.ReaderPriorities, req.User, req.IP, req.Query)
+
+	if _, ok := pa.readers[req.Author]; !ok &&
+		pa.conf.MaxReaders != 0 && len(pa.readers) >= pa.conf.MaxReaders {
+		// make room by shedding a reader with a lower priority
+		r, ok := pa.lowestPriorityReader()
+		if !ok || pa.readerPriorities[r] >= priority {
+			pa.quotas.removeReader(pa.conf.Tenant)
+			req.Res <- pathReaderSetupPlayRes{Err: pathErrCongested{
+				PathName: pa.name,
+				Reason:   fmt.Sprintf("maximum of %d readers reached", pa.conf.MaxReaders),
+			}}
+			return
+		}
+
+		pa.readerShed(r, "to make room for a reader with a higher priority")
+	}
+
+	pa.log(logger.Debug, "[session %s] reader added", req.Author.ID())
+
 	pa.readers[req.Author] = pathReaderStatePrePlay
+	pa.readerPriorities[req.Author] = priority
 
 	if pa.isOnDemand() && pa.onDemandState == pathOnDemandStateClosing {
 		pa.onDemandState = pathOnDemandStateReady
@@ -845,31 +1760,76 @@ func (pa *path) handleReaderPlay(req pathReaderPlayReq) {
 	pa.readers[req.Author] = pathReaderStatePlay
 
 	pa.stream.readerAdd(req.Author)
+	pa.egressReaderAdd(req.Author)
 
 	req.Author.onReaderAccepted()
 
 	close(req.Res)
 }
 
+// egressReaderAdd accounts the bytes sent to a reader, if it is authenticated.
+func (pa *path) egressReaderAdd(r reader) {
+	if pa.conf.ReadUser == "" {
+		return
+	}
+
+	// HLS muxers are shared by multiple users, that are accounted by the muxers.
+	if _, ok := r.(*hlsMuxer); ok {
+		return
+	}
+
+	pa.egress.readerAdd(r.onReaderAPIReadersItem().User, r)
+}
+
 func (pa *path) handleReaderPause(req pathReaderPauseReq) {
 	if state, ok := pa.readers[req.Author]; ok && state == pathReaderStatePlay {
 		pa.readers[req.Author] = pathReaderStatePrePlay
 		pa.stream.readerRemove(req.Author)
+		pa.egress.readerRemove(req.Author)
 	}
 	close(req.Res)
 }
 
+func (pa *path) handleReaderSourceParameter(req pathReaderSourceParameterReq) {
+	if !pa.conf.SourceParameterPassthrough {
+		req.Res <- pathReaderSourceParameterRes{Err: fmt.Errorf("parameter passthrough is disabled")}
+		return
+	}
+
+	if _, ok := pa.readers[req.Author]; !ok {
+		req.Res <- pathReaderSourceParameterRes{Err: fmt.Errorf("reader not found")}
+		return
+	}
+
+	s, ok := pa.source.(*rtspSource)
+	if !ok || !pa.sourceReady {
+		req.Res <- pathReaderSourceParameterRes{Err: fmt.Errorf("source is not ready")}
+		return
+	}
+
+	req.Res <- pathReaderSourceParameterRes{Source: s}
+}
+
 func (pa *path) handleAPIPathsList(req pathAPIPathsListSubReq) {
 	req.Data.Items[pa.name] = pathAPIPathsListItem{
 		ConfName: pa.confName,
-		Conf:     pa.conf,
+		Conf:     pa.conf.Redacted(),
 		Source: func() interface{} {
 			if pa.source == nil {
 				return nil
 			}
 			return pa.source.onSourceAPIDescribe()
 		}(),
-		SourceReady: pa.sourceReady,
+		SourceReady:        pa.sourceReady,
+		SourceFailures:     pa.sourceRetry.consecutiveFailures(),
+		SourceInactivities: pa.sourceInactivities,
+		AudioLevel: func() *streamAudioLevelInfo {
+			if !pa.sourceReady {
+				return nil
+			}
+			return pa.stream.info.audioLevel()
+		}(),
+		Ingest: pa.ingestInfo(),
 		Readers: func() []interface{} {
 			ret := []interface{}{}
 			for r := range pa.readers {
@@ -881,6 +1841,92 @@ func (pa *path) handleAPIPathsList(req pathAPIPathsListSubReq) {
 	close(req.Res)
 }
 
+func (pa *path) ingestInfo() *pathIngestInfo {
+	if !pa.sourceReady {
+		return nil
+	}
+
+	info := &pathIngestInfo{
+		Tracks: pa.stream.qos.describe(),
+	}
+
+	if pa.stream.clockDrift != nil {
+		for i := range info.Tracks {
+			info.Tracks[i].ClockDriftCorrection = pa.stream.clockDrift.correction(i)
+		}
+	}
+
+	if s, ok := pa.source.(sourceUDPDrops); ok {
+		if v, ok := s.onSourceUDPDrops(); ok {
+			info.UDPDrops = &v
+		}
+	}
+
+	return info
+}
+
+func (pa *path) handleAPIPathsInfo(req pathAPIPathsInfoReq) {
+	data := &pathAPIPathsInfoData{
+		ConfName: pa.confName,
+		Source: func() interface{} {
+			if pa.source == nil {
+				return nil
+			}
+			return pa.source.onSourceAPIDescribe()
+		}(),
+		SourceReady: pa.sourceReady,
+		Tracks:      []streamInfoTrack{},
+	}
+
+	if pa.sourceReady {
+		data.Tracks = pa.stream.info.describe(pa.stream.tracks())
+		data.Ingest = pa.ingestInfo()
+	}
+
+	if pa.inference != nil {
+		data.Detections = pa.inference.lastResult()
+	}
+
+	if pa.recorder != nil {
+		data.Recording = pa.recorder.apiInfo()
+	}
+
+	req.Res <- pathAPIPathsInfoRes{Data: data}
+}
+
+func (pa *path) handleAPIPathsReaders(req pathAPIPathsReadersReq) {
+	data := &pathAPIPathsReadersData{
+		Items: []pathAPIPathsReadersItem{},
+	}
+
+	now := time.Now()
+	for r := range pa.readers {
+		item := r.onReaderAPIReadersItem()
+		item.Uptime = now.Sub(item.Created).Round(time.Second).String()
+		item.Priority = pa.readerPriorities[r].String()
+		data.Items = append(data.Items, item)
+	}
+
+	if pa.pusher != nil {
+		item := pa.pusher.onReaderAPIReadersItem()
+		item.Uptime = now.Sub(item.Created).Round(time.Second).String()
+		data.Items = append(data.Items, item)
+	}
+
+	if pa.srtOutput != nil {
+		item := pa.srtOutput.onReaderAPIReadersItem()
+		item.Uptime = now.Sub(item.Created).Round(time.Second).String()
+		data.Items = append(data.Items, item)
+	}
+
+	// sort readers by creation time, in order to return a stable list
+	sort.Slice(data.Items, func(i, j int) bool {
+		return data.Items[i].Created.Before(data.Items[j].Created)
+	})
+
+	req.Res <- pathAPIPathsReadersRes{Data: data}
+}
+
 // onSourceStaticSetReady is called by a sourceStatic.
 func (pa *path) onSourceStaticSetReady(req pathSourceStaticSetReadyReq) pathSourceStaticSetReadyRes {
 	req.Res = make(chan pathSourceStaticSetReadyRes)
@@ -993,6 +2039,17 @@ func (pa *path) onReaderPause(req pathReaderPauseReq) {
 	}
 }
 
+// onReaderSourceParameter is called by a reader.
+func (pa *path) onReaderSourceParameter(req pathReaderSourceParameterReq) pathReaderSourceParameterRes {
+	req.Res = make(chan pathReaderSourceParameterRes)
+	select {
+	case pa.readerSourceParameter <- req:
+		return <-req.Res
+	case <-pa.ctx.Done():
+		return pathReaderSourceParameterRes{Err: fmt.Errorf("terminated")}
+	}
+}
+
 // onAPIPathsList is called by api.
 func (pa *path) onAPIPathsList(req pathAPIPathsListSubReq) {
 	req.Res = make(chan struct{})
@@ -1003,3 +2060,25 @@ func (pa *path) onAPIPathsList(req pathAPIPathsListSubReq) {
 	case <-pa.ctx.Done():
 	}
 }
+
+// onAPIPathsInfo is called by api through pathManager.
+func (pa *path) onAPIPathsInfo(req pathAPIPathsInfoReq) pathAPIPathsInfoRes {
+	select {
+	case pa.apiPathsInfo <- req:
+		return <-req.Res
+
+	case <-pa.ctx.Done():
+		return pathAPIPathsInfoRes{Err: fmt.Errorf("terminated")}
+	}
+}
+
+// onAPIPathsReaders is called by api through pathManager.
+func (pa *path) onAPIPathsReaders(req pathAPIPathsReadersReq) pathAPIPathsReadersRes {
+	select {
+	case pa.apiPathsReaders <- req:
+		return <-req.Res
+
+	case <-pa.ctx.Done():
+		return pathAPIPathsReadersRes{Err: fmt.Errorf("terminated")}
+	}
+}
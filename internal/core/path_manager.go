@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/aler9/gortsplib/pkg/base"
 
 	"github.com/aler9/rtsp-simple-server/internal/conf"
 	"github.com/aler9/rtsp-simple-server/internal/logger"
+	"github.com/aler9/rtsp-simple-server/internal/registry"
 )
 
 type pathManagerHLSServer interface {
@@ -18,6 +20,7 @@ type pathManagerHLSServer interface {
 
 type pathManagerParent interface {
 	Log(logger.Level, string, ...interface{})
+	LogAudit(logger.AuditEntry)
 }
 
 type pathManager struct {
@@ -26,25 +29,40 @@ type pathManager struct {
 	writeTimeout    conf.StringDuration
 	readBufferCount int
 	readBufferSize  int
+	hookStdinJSON   bool
 	pathConfs       map[string]*conf.PathConf
-	metrics         *metrics
+	tenants         map[string]*conf.TenantConf
+	disabledPaths   *disabledPaths
+	recordSchedules *recordSchedules
+	quotas          *quotas
+	geoIP           *geoIPPolicy
+	egress          *egressAccounting
+	shedding        *readerShedding
+	registry        *registry.Registry
 	parent          pathManagerParent
 
-	ctx       context.Context
-	ctxCancel func()
-	wg        sync.WaitGroup
-	hlsServer pathManagerHLSServer
-	paths     map[string]*path
+	ctx          context.Context
+	ctxCancel    func()
+	wg           sync.WaitGroup
+	hlsServer    pathManagerHLSServer
+	paths        map[string]*path
+	draining     bool
+	tenantsMutex sync.RWMutex
 
 	// in
-	confReload        chan map[string]*conf.PathConf
-	pathClose         chan *path
-	pathSourceReady   chan *path
-	describe          chan pathDescribeReq
-	readerSetupPlay   chan pathReaderSetupPlayReq
-	publisherAnnounce chan pathPublisherAnnounceReq
-	hlsServerSet      chan pathManagerHLSServer
-	apiPathsList      chan pathAPIPathsListReq
+	confReload         chan map[string]*conf.PathConf
+	pathClose          chan *path
+	pathSourceReady    chan *path
+	pathSourceNotReady chan *path
+	describe           chan pathDescribeReq
+	readerSetupPlay    chan pathReaderSetupPlayReq
+	publisherAnnounce  chan pathPublisherAnnounceReq
+	hlsServerSet       chan pathManagerHLSServer
+	drain              chan struct{}
+	apiPathsList       chan pathAPIPathsListReq
+	apiPathsInfo       chan pathAPIPathsInfoReq
+	apiPathsReaders    chan pathAPIPathsReadersReq
+	apiPathsEnable     chan pathAPIPathsEnableReq
 }
 
 func newPathManager(
@@ -54,43 +72,60 @@ func newPathManager(
 	writeTimeout conf.StringDuration,
 	readBufferCount int,
 	readBufferSize int,
+	hookStdinJSON bool,
 	pathConfs map[string]*conf.PathConf,
-	metrics *metrics,
+	tenants map[string]*conf.TenantConf,
+	disabledPaths *disabledPaths,
+	recordSchedules *recordSchedules,
+	quotas *quotas,
+	geoIP *geoIPPolicy,
+	egress *egressAccounting,
+	shedding *readerShedding,
+	registry *registry.Registry,
 	parent pathManagerParent) *pathManager {
 	ctx, ctxCancel := context.WithCancel(parentCtx)
 
 	pm := &pathManager{
-		rtspAddress:       rtspAddress,
-		readTimeout:       readTimeout,
-		writeTimeout:      writeTimeout,
-		readBufferCount:   readBufferCount,
-		readBufferSize:    readBufferSize,
-		pathConfs:         pathConfs,
-		metrics:           metrics,
-		parent:            parent,
-		ctx:               ctx,
-		ctxCancel:         ctxCancel,
-		paths:             make(map[string]*path),
-		confReload:        make(chan map[string]*conf.PathConf),
-		pathClose:         make(chan *path),
-		pathSourceReady:   make(chan *path),
-		describe:          make(chan pathDescribeReq),
-		readerSetupPlay:   make(chan pathReaderSetupPlayReq),
-		publisherAnnounce: make(chan pathPublisherAnnounceReq),
-		hlsServerSet:      make(chan pathManagerHLSServer),
-		apiPathsList:      make(chan pathAPIPathsListReq),
+		rtspAddress:        rtspAddress,
+		readTimeout:        readTimeout,
+		writeTimeout:       writeTimeout,
+		readBufferCount:    readBufferCount,
+		readBufferSize:     readBufferSize,
+		hookStdinJSON:      hookStdinJSON,
+		pathConfs:          pathConfs,
+		tenants:            tenants,
+		disabledPaths:      disabledPaths,
+		recordSchedules:    recordSchedules,
+		quotas:             quotas,
+		geoIP:              geoIP,
+		egress:             egress,
+		shedding:           shedding,
+		registry:           registry,
+		parent:             parent,
+		ctx:                ctx,
+		ctxCancel:          ctxCancel,
+		paths:              make(map[string]*path),
+		confReload:         make(chan map[string]*conf.PathConf),
+		pathClose:          make(chan *path),
+		pathSourceReady:    make(chan *path),
+		pathSourceNotReady: make(chan *path),
+		describe:           make(chan pathDescribeReq),
+		readerSetupPlay:    make(chan pathReaderSetupPlayReq),
+		publisherAnnounce:  make(chan pathPublisherAnnounceReq),
+		hlsServerSet:       make(chan pathManagerHLSServer),
+		drain:              make(chan struct{}),
+		apiPathsList:       make(chan pathAPIPathsListReq),
+		apiPathsInfo:       make(chan pathAPIPathsInfoReq),
+		apiPathsReaders:    make(chan pathAPIPathsReadersReq),
+		apiPathsEnable:     make(chan pathAPIPathsEnableReq),
 	}
 
 	for pathName, pathConf := range pm.pathConfs {
-		if pathConf.Regexp == nil {
+		if pathConf.Regexp == nil && !pm.disabledPaths.isDisabled(pathName) {
 			pm.createPath(pathName, pathConf, pathName)
 		}
 	}
 
-	if pm.metrics != nil {
-		pm.metrics.onPathManagerSet(pm)
-	}
-
 	pm.wg.Add(1)
 	go pm.run()
 
@@ -110,9 +145,15 @@ func (pm *pathManager) log(level logger.Level, format string, args ...interface{
 func (pm *pathManager) run() {
 	defer pm.wg.Done()
 
+	quotasTicker := time.NewTicker(quotasBitratePeriod)
+	defer quotasTicker.Stop()
+
 outer:
 	for {
 		select {
+		case <-quotasTicker.C:
+			pm.quotas.updateBitrates()
+
 		case pathConfs := <-pm.confReload:
 			// remove confs
 			for pathName := range pm.pathConfs {
@@ -141,12 +182,14 @@ outer:
 				if pathConf, ok := pm.pathConfs[pa.ConfName()]; !ok || pathConf != pa.Conf() {
 					delete(pm.paths, pa.Name())
 					pa.close()
+					pm.unpublish(pa)
 				}
 			}
 
 			// add new paths
 			for pathName, pathConf := range pm.pathConfs {
-				if _, ok := pm.paths[pathName]; !ok && pathConf.Regexp == nil {
+				if _, ok := pm.paths[pathName]; !ok && pathConf.Regexp == nil &&
+					!pm.disabledPaths.isDisabled(pathName) {
 					pm.createPath(pathName, pathConf, pathName)
 				}
 			}
@@ -157,13 +200,31 @@ outer:
 			}
 			delete(pm.paths, pa.Name())
 			pa.close()
+			pm.unpublish(pa)
 
 		case pa := <-pm.pathSourceReady:
 			if pm.hlsServer != nil {
 				pm.hlsServer.onPathSourceReady(pa)
 			}
 
+			if pm.registry != nil {
+				pm.registry.Publish(pa.Name())
+			}
+
+		case pa := <-pm.pathSourceNotReady:
+			pm.unpublish(pa)
+
 		case req := <-pm.describe:
+			if pm.draining {
+				req.Res <- pathDescribeRes{Err: pathErrDraining{}}
+				continue
+			}
+
+			if pm.disabledPaths.isDisabled(req.PathName) {
+				req.Res <- pathDescribeRes{Err: pathErrDisabled{PathName: req.PathName}}
+				continue
+			}
+
 			pathName, pathConf, err := pm.findPathConf(req.PathName)
 			if err != nil {
 				req.Res <- pathDescribeRes{Err: err}
@@ -171,12 +232,17 @@ outer:
 			}
 
 			err = pm.authenticate(
+				req.Protocol,
+				"read",
+				req.User,
+				false,
 				req.IP,
 				req.ValidateCredentials,
 				req.PathName,
 				pathConf.ReadIPs,
-				pathConf.ReadUser,
-				pathConf.ReadPass,
+				pathConf.ReadCountries,
+				pathConf.Resolved().ReadUser,
+				pathConf.Resolved().ReadPass,
 			)
 			if err != nil {
 				req.Res <- pathDescribeRes{Err: err}
@@ -185,12 +251,28 @@ outer:
 
 			// create path if it doesn't exist
 			if _, ok := pm.paths[req.PathName]; !ok {
+				err := pm.checkTenantMaxPaths(pathConf)
+				if err != nil {
+					req.Res <- pathDescribeRes{Err: err}
+					continue
+				}
+
 				pm.createPath(pathName, pathConf, req.PathName)
 			}
 
 			req.Res <- pathDescribeRes{Path: pm.paths[req.PathName]}
 
 		case req := <-pm.readerSetupPlay:
+			if pm.draining {
+				req.Res <- pathReaderSetupPlayRes{Err: pathErrDraining{}}
+				continue
+			}
+
+			if pm.disabledPaths.isDisabled(req.PathName) {
+				req.Res <- pathReaderSetupPlayRes{Err: pathErrDisabled{PathName: req.PathName}}
+				continue
+			}
+
 			pathName, pathConf, err := pm.findPathConf(req.PathName)
 			if err != nil {
 				req.Res <- pathReaderSetupPlayRes{Err: err}
@@ -198,12 +280,17 @@ outer:
 			}
 
 			err = pm.authenticate(
+				req.Protocol,
+				"read",
+				req.User,
+				false,
 				req.IP,
 				req.ValidateCredentials,
 				req.PathName,
 				pathConf.ReadIPs,
-				pathConf.ReadUser,
-				pathConf.ReadPass,
+				pathConf.ReadCountries,
+				pathConf.Resolved().ReadUser,
+				pathConf.Resolved().ReadPass,
 			)
 			if err != nil {
 				req.Res <- pathReaderSetupPlayRes{Err: err}
@@ -212,12 +299,37 @@ outer:
 
 			// create path if it doesn't exist
 			if _, ok := pm.paths[req.PathName]; !ok {
+				err := pm.checkTenantMaxPaths(pathConf)
+				if err != nil {
+					req.Res <- pathReaderSetupPlayRes{Err: err}
+					continue
+				}
+
 				pm.createPath(pathName, pathConf, req.PathName)
 			}
 
 			req.Res <- pathReaderSetupPlayRes{Path: pm.paths[req.PathName]}
 
 		case req := <-pm.publisherAnnounce:
+			if pm.draining {
+				req.Res <- pathPublisherAnnounceRes{Err: pathErrDraining{}}
+				continue
+			}
+
+			// a stream key replaces both the path name and the credentials
+			validateCredentials := req.ValidateCredentials
+			byStreamKey := false
+			if pathName, ok := pm.findPathConfByStreamKey(req.StreamKey); ok {
+				req.PathName = pathName
+				validateCredentials = nil
+				byStreamKey = true
+			}
+
+			if pm.disabledPaths.isDisabled(req.PathName) {
+				req.Res <- pathPublisherAnnounceRes{Err: pathErrDisabled{PathName: req.PathName}}
+				continue
+			}
+
 			pathName, pathConf, err := pm.findPathConf(req.PathName)
 			if err != nil {
 				req.Res <- pathPublisherAnnounceRes{Err: err}
@@ -225,12 +337,17 @@ outer:
 			}
 
 			err = pm.authenticate(
+				req.Protocol,
+				"publish",
+				req.User,
+				byStreamKey,
 				req.IP,
-				req.ValidateCredentials,
+				validateCredentials,
 				req.PathName,
 				pathConf.PublishIPs,
-				pathConf.PublishUser,
-				pathConf.PublishPass,
+				pathConf.PublishCountries,
+				pathConf.Resolved().PublishUser,
+				pathConf.Resolved().PublishPass,
 			)
 			if err != nil {
 				req.Res <- pathPublisherAnnounceRes{Err: err}
@@ -239,6 +356,12 @@ outer:
 
 			// create path if it doesn't exist
 			if _, ok := pm.paths[req.PathName]; !ok {
+				err := pm.checkTenantMaxPaths(pathConf)
+				if err != nil {
+					req.Res <- pathPublisherAnnounceRes{Err: err}
+					continue
+				}
+
 				pm.createPath(pathName, pathConf, req.PathName)
 			}
 
@@ -247,6 +370,9 @@ outer:
 		case s := <-pm.hlsServerSet:
 			pm.hlsServer = s
 
+		case <-pm.drain:
+			pm.draining = true
+
 		case req := <-pm.apiPathsList:
 			paths := make(map[string]*path)
 
@@ -258,6 +384,55 @@ outer:
 				Paths: paths,
 			}
 
+		case req := <-pm.apiPathsInfo:
+			pa, ok := pm.paths[req.Name]
+			if !ok {
+				req.Res <- pathAPIPathsInfoRes{Err: fmt.Errorf("path '%s' not found", req.Name)}
+				continue
+			}
+
+			req.Res <- pathAPIPathsInfoRes{Path: pa}
+
+		case req := <-pm.apiPathsEnable:
+			if req.Disable {
+				if !pm.disabledPaths.disable(req.Name) {
+					req.Res <- pathAPIPathsEnableRes{Err: fmt.Errorf("path '%s' is already disabled", req.Name)}
+					continue
+				}
+
+				pm.log(logger.Info, "path '%s' disabled", req.Name)
+
+				// close the path, together with its source and readers
+				if pa, ok := pm.paths[req.Name]; ok {
+					delete(pm.paths, req.Name)
+					pa.close()
+					pm.unpublish(pa)
+				}
+			} else {
+				if !pm.disabledPaths.enable(req.Name) {
+					req.Res <- pathAPIPathsEnableRes{Err: fmt.Errorf("path '%s' is not disabled", req.Name)}
+					continue
+				}
+
+				pm.log(logger.Info, "path '%s' enabled", req.Name)
+
+				// paths with a static configuration are always present
+				if pathConf, ok := pm.pathConfs[req.Name]; ok && pathConf.Regexp == nil {
+					pm.createPath(req.Name, pathConf, req.Name)
+				}
+			}
+
+			req.Res <- pathAPIPathsEnableRes{}
+
+		case req := <-pm.apiPathsReaders:
+			pa, ok := pm.paths[req.Name]
+			if !ok {
+				req.Res <- pathAPIPathsReadersRes{Err: fmt.Errorf("path '%s' not found", req.Name)}
+				continue
+			}
+
+			req.Res <- pathAPIPathsReadersRes{Path: pa}
+
 		case <-pm.ctx.Done():
 			break outer
 		}
@@ -265,8 +440,15 @@ outer:
 
 	pm.ctxCancel()
 
-	if pm.metrics != nil {
-		pm.metrics.onPathManagerSet(nil)
+	for _, pa := range pm.paths {
+		pm.unpublish(pa)
+	}
+}
+
+// unpublish removes a path from the registry, if it's enabled.
+func (pm *pathManager) unpublish(pa *path) {
+	if pm.registry != nil {
+		pm.registry.Unpublish(pa.Name())
 	}
 }
 
@@ -278,9 +460,14 @@ func (pm *pathManager) createPath(confName string, conf *conf.PathConf, name str
 		pm.writeTimeout,
 		pm.readBufferCount,
 		pm.readBufferSize,
+		pm.hookStdinJSON,
 		confName,
 		conf,
 		name,
+		pm.quotas,
+		pm.egress,
+		pm.shedding,
+		pm.recordSchedules,
 		&pm.wg,
 		pm)
 }
@@ -291,14 +478,24 @@ func (pm *pathManager) findPathConf(name string) (string, *conf.PathConf, error)
 		return "", nil, fmt.Errorf("invalid path name: %s (%s)", err, name)
 	}
 
+	// paths inside the namespace of a tenant can be configured only by the tenant,
+	// and regular expressions of the tenant are matched against the name without prefix.
+	pm.tenantsMutex.RLock()
+	tenant := conf.TenantOfPath(pm.tenants, name)
+	pm.tenantsMutex.RUnlock()
+	nameInTenant := name
+	if tenant != "" {
+		nameInTenant = name[len(tenant)+1:]
+	}
+
 	// normal path
-	if pathConf, ok := pm.pathConfs[name]; ok {
+	if pathConf, ok := pm.pathConfs[name]; ok && pathConf.Tenant == tenant {
 		return name, pathConf, nil
 	}
 
 	// regular expression path
 	for pathName, pathConf := range pm.pathConfs {
-		if pathConf.Regexp != nil && pathConf.Regexp.MatchString(name) {
+		if pathConf.Tenant == tenant && pathConf.Regexp != nil && pathConf.Regexp.MatchString(nameInTenant) {
 			return pathName, pathConf, nil
 		}
 	}
@@ -306,39 +503,165 @@ func (pm *pathManager) findPathConf(name string) (string, *conf.PathConf, error)
 	return "", nil, fmt.Errorf("path '%s' is not configured", name)
 }
 
+// checkTenantMaxPaths checks whether a path can be created without exceeding
+// the maximum number of paths of the tenant that owns it.
+func (pm *pathManager) checkTenantMaxPaths(pathConf *conf.PathConf) error {
+	if pathConf.Tenant == "" {
+		return nil
+	}
+
+	pm.tenantsMutex.RLock()
+	tconf, ok := pm.tenants[pathConf.Tenant]
+	pm.tenantsMutex.RUnlock()
+	if !ok || tconf.MaxPaths == 0 {
+		return nil
+	}
+
+	count := 0
+	for _, pa := range pm.paths {
+		if pa.Conf().Tenant == pathConf.Tenant {
+			count++
+		}
+	}
+
+	if count >= tconf.MaxPaths {
+		pm.quotas.rejectPath(pathConf.Tenant)
+		return pathErrQuotaExceeded{
+			Tenant: pathConf.Tenant,
+			Quota:  fmt.Sprintf("%d paths", tconf.MaxPaths),
+		}
+	}
+
+	return nil
+}
+
+// tenantPathName returns the name of the path requested by a client that
+// connected to the given host, that is placed inside the namespace of a tenant
+// when the host belongs to the tenant. It can be called by any goroutine.
+func (pm *pathManager) tenantPathName(host string, name string) string {
+	pm.tenantsMutex.RLock()
+	defer pm.tenantsMutex.RUnlock()
+	return conf.TenantPathName(pm.tenants, host, name)
+}
+
+func (pm *pathManager) findPathConfByStreamKey(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+
+	for pathName, pathConf := range pm.pathConfs {
+		if pathConf.Resolved().PublishStreamKey != "" &&
+			string(pathConf.Resolved().PublishStreamKey) == key {
+			return pathName, true
+		}
+	}
+
+	return "", false
+}
+
 func (pm *pathManager) authenticate(
+	protocol string,
+	action string,
+	user string,
+	byStreamKey bool,
 	ip net.IP,
 	validateCredentials func(pathUser conf.Credential, pathPass conf.Credential) error,
 	pathName string,
 	pathIPs []interface{},
+	pathCountries conf.Countries,
 	pathUser conf.Credential,
 	pathPass conf.Credential,
 ) error {
-	// validate ip
-	if pathIPs != nil && ip != nil {
-		if !ipEqualOrInRange(ip, pathIPs) {
-			return pathErrAuthCritical{
-				Message: fmt.Sprintf("IP '%s' not allowed", ip),
-				Response: &base.Response{
-					StatusCode: base.StatusUnauthorized,
-				},
+	checkIP := pathIPs != nil && ip != nil
+	checkCountry := ip != nil && pm.geoIP.enabled(action, pathCountries)
+	checkUser := pathUser != "" && validateCredentials != nil
+
+	err := func() error {
+		// validate ip
+		if checkIP {
+			if !ipEqualOrInRange(ip, pathIPs) {
+				return pathErrAuthCritical{
+					Message: fmt.Sprintf("IP '%s' not allowed", ip),
+					Response: &base.Response{
+						StatusCode: base.StatusUnauthorized,
+					},
+				}
 			}
 		}
+
+		// validate country
+		if checkCountry {
+			if country, ok := pm.geoIP.check(ip, action, pathCountries); !ok {
+				return pathErrAuthCritical{
+					Message: fmt.Sprintf("country '%s' not allowed", country),
+					Response: &base.Response{
+						StatusCode: base.StatusUnauthorized,
+					},
+				}
+			}
+		}
+
+		// validate user
+		if checkUser {
+			err := validateCredentials(pathUser, pathPass)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}()
+
+	// paths without restrictions are not audited
+	if !checkIP && !checkCountry && !checkUser && !byStreamKey {
+		return err
 	}
 
-	// validate user
-	if pathUser != "" && validateCredentials != nil {
-		err := validateCredentials(pathUser, pathPass)
-		if err != nil {
+	e := logger.AuditEntry{
+		Protocol: protocol,
+		Action:   action,
+		Path:     pathName,
+		User:     user,
+	}
+	if ip != nil {
+		e.IP = ip.String()
+	}
+
+	switch terr := err.(type) {
+	case nil:
+		e.Outcome = logger.AuditSuccess
+		if byStreamKey {
+			e.Reason = "stream key"
+		}
+
+	case pathErrAuthCritical:
+		e.Outcome = logger.AuditFailure
+		e.Reason = terr.Message
+
+	case pathErrAuthNotCritical:
+		// challenges that are sent to clients in order to obtain credentials
+		// are not decisions.
+		if terr.Message == "" {
 			return err
 		}
+		e.Outcome = logger.AuditFailure
+		e.Reason = terr.Message
+
+	default:
+		return err
 	}
 
-	return nil
+	pm.parent.LogAudit(e)
+
+	return err
 }
 
 // onConfReload is called by core.
-func (pm *pathManager) onConfReload(pathConfs map[string]*conf.PathConf) {
+func (pm *pathManager) onConfReload(pathConfs map[string]*conf.PathConf, tenants map[string]*conf.TenantConf) {
+	pm.tenantsMutex.Lock()
+	pm.tenants = tenants
+	pm.tenantsMutex.Unlock()
+
 	select {
 	case pm.confReload <- pathConfs:
 	case <-pm.ctx.Done():
@@ -353,6 +676,15 @@ func (pm *pathManager) onPathSourceReady(pa *path) {
 	}
 }
 
+// onPathSourceNotReady is called by path.
+func (pm *pathManager) onPathSourceNotReady(pa *path) {
+	select {
+	case pm.pathSourceNotReady <- pa:
+	case <-pm.ctx.Done():
+	case <-pa.ctx.Done(): // in case pathManager is closing the path
+	}
+}
+
 // onPathClose is called by path.
 func (pm *pathManager) onPathClose(pa *path) {
 	select {
@@ -371,7 +703,19 @@ func (pm *pathManager) onDescribe(req pathDescribeReq) pathDescribeRes {
 			return res
 		}
 
-		return res.Path.onDescribe(req)
+		res = res.Path.onDescribe(req)
+
+		// the path may be published on another instance
+		if _, ok := res.Err.(pathErrNoOnePublishing); ok && pm.registry != nil {
+			ur, err := pm.registry.Lookup(req.PathName)
+			if err != nil {
+				pm.log(logger.Warn, "[registry] %s", err)
+			} else if ur != "" {
+				return pathDescribeRes{Redirect: ur}
+			}
+		}
+
+		return res
 
 	case <-pm.ctx.Done():
 		return pathDescribeRes{Err: fmt.Errorf("terminated")}
@@ -420,6 +764,14 @@ func (pm *pathManager) onHLSServerSet(s pathManagerHLSServer) {
 	}
 }
 
+// onDrain is called by core.
+func (pm *pathManager) onDrain() {
+	select {
+	case pm.drain <- struct{}{}:
+	case <-pm.ctx.Done():
+	}
+}
+
 // onAPIPathsList is called by api.
 func (pm *pathManager) onAPIPathsList(req pathAPIPathsListReq) pathAPIPathsListRes {
 	req.Res = make(chan pathAPIPathsListRes)
@@ -441,3 +793,54 @@ func (pm *pathManager) onAPIPathsList(req pathAPIPathsListReq) pathAPIPathsListR
 		return pathAPIPathsListRes{Err: fmt.Errorf("terminated")}
 	}
 }
+
+// onAPIPathsInfo is called by api.
+func (pm *pathManager) onAPIPathsInfo(req pathAPIPathsInfoReq) pathAPIPathsInfoRes {
+	req.Res = make(chan pathAPIPathsInfoRes)
+	select {
+	case pm.apiPathsInfo <- req:
+		res := <-req.Res
+		if res.Err != nil {
+			return res
+		}
+
+		return res.Path.onAPIPathsInfo(req)
+
+	case <-pm.ctx.Done():
+		return pathAPIPathsInfoRes{Err: fmt.Errorf("terminated")}
+	}
+}
+
+// onAPIPathsEnable is called by api.
+func (pm *pathManager) onAPIPathsEnable(req pathAPIPathsEnableReq) pathAPIPathsEnableRes {
+	req.Res = make(chan pathAPIPathsEnableRes)
+	select {
+	case pm.apiPathsEnable <- req:
+		return <-req.Res
+
+	case <-pm.ctx.Done():
+		return pathAPIPathsEnableRes{Err: fmt.Errorf("terminated")}
+	}
+}
+
+// onAPIPathsDisabledList is called by api.
+func (pm *pathManager) onAPIPathsDisabledList() *pathAPIPathsDisabledListData {
+	return &pathAPIPathsDisabledListData{Items: pm.disabledPaths.list()}
+}
+
+// onAPIPathsReaders is called by api.
+func (pm *pathManager) onAPIPathsReaders(req pathAPIPathsReadersReq) pathAPIPathsReadersRes {
+	req.Res = make(chan pathAPIPathsReadersRes)
+	select {
+	case pm.apiPathsReaders <- req:
+		res := <-req.Res
+		if res.Err != nil {
+			return res
+		}
+
+		return res.Path.onAPIPathsReaders(req)
+
+	case <-pm.ctx.Done():
+		return pathAPIPathsReadersRes{Err: fmt.Errorf("terminated")}
+	}
+}
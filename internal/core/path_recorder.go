@@ -0,0 +1,153 @@
+package core
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+	"github.com/aler9/rtsp-simple-server/internal/cron"
+	"github.com/aler9/rtsp-simple-server/internal/externalcmd"
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+type pathRecorderInfo struct {
+	Schedule string `json:"schedule"`
+	Active   bool   `json:"active"`
+}
+
+type pathRecorderParent interface {
+	log(logger.Level, string, ...interface{})
+}
+
+// pathRecorder runs the runOnRecord command of a path
+// while the record schedule is active.
+type pathRecorder struct {
+	pathName      string
+	pathConf      *conf.PathConf
+	rtspAddress   string
+	hookStdinJSON bool
+	schedules     *recordSchedules
+	parent        pathRecorderParent
+
+	ctx       context.Context
+	ctxCancel func()
+	mutex     sync.Mutex
+	info      pathRecorderInfo
+
+	// out
+	done chan struct{}
+}
+
+func newPathRecorder(
+	parentCtx context.Context,
+	pathName string,
+	pathConf *conf.PathConf,
+	rtspAddress string,
+	hookStdinJSON bool,
+	schedules *recordSchedules,
+	parent pathRecorderParent,
+) *pathRecorder {
+	ctx, ctxCancel := context.WithCancel(parentCtx)
+
+	r := &pathRecorder{
+		pathName:      pathName,
+		pathConf:      pathConf,
+		rtspAddress:   rtspAddress,
+		hookStdinJSON: hookStdinJSON,
+		schedules:     schedules,
+		parent:        parent,
+		ctx:           ctx,
+		ctxCancel:     ctxCancel,
+		done:          make(chan struct{}),
+	}
+
+	go r.run()
+
+	return r
+}
+
+func (r *pathRecorder) close() {
+	r.ctxCancel()
+	<-r.done
+}
+
+func (r *pathRecorder) apiInfo() *pathRecorderInfo {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	info := r.info
+	return &info
+}
+
+// schedule returns the schedule set through the API or, if it is not set,
+// the one of the configuration.
+func (r *pathRecorder) schedule() string {
+	if expr, ok := r.schedules.get(r.pathName); ok {
+		return expr
+	}
+	return r.pathConf.RecordSchedule
+}
+
+func (r *pathRecorder) run() {
+	defer close(r.done)
+
+	var cmd *externalcmd.Cmd
+	active := false
+
+	for {
+		// obtain the channel before reading the schedule, in order not to lose changes
+		changed := r.schedules.onChange()
+		expr := r.schedule()
+
+		shouldBeActive := true
+		if expr != "" {
+			// schedules are validated before being set
+			sched, err := cron.Parse(expr)
+			shouldBeActive = err == nil && sched.Match(time.Now())
+		}
+
+		if shouldBeActive && !active {
+			r.parent.log(logger.Info, "record schedule is active")
+			_, port, _ := net.SplitHostPort(r.rtspAddress)
+			cmd = hookStart(r.parent.log, "runOnRecord", r.pathConf.RunOnRecord, r.pathConf.RunOnRecordRestart,
+				r.hookStdinJSON, hookEvent{
+					Event:     "record",
+					Path:      r.pathName,
+					Port:      port,
+					SourceURL: hookSourceURL(r.pathConf),
+				})
+		} else if !shouldBeActive && active {
+			r.parent.log(logger.Info, "record schedule is not active")
+			if cmd != nil {
+				cmd.Close()
+				cmd = nil
+				r.parent.log(logger.Info, "runOnRecord command stopped")
+			}
+		}
+		active = shouldBeActive
+
+		r.mutex.Lock()
+		r.info = pathRecorderInfo{Schedule: expr, Active: active}
+		r.mutex.Unlock()
+
+		// schedules have a precision of one minute
+		now := time.Now()
+		t := time.NewTimer(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+
+		select {
+		case <-t.C:
+
+		case <-changed:
+			t.Stop()
+
+		case <-r.ctx.Done():
+			t.Stop()
+			if cmd != nil {
+				cmd.Close()
+				r.parent.log(logger.Info, "runOnRecord command stopped")
+			}
+			return
+		}
+	}
+}
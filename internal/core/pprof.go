@@ -8,6 +8,7 @@ import (
 	// start pprof
 	_ "net/http/pprof"
 
+	"github.com/aler9/rtsp-simple-server/internal/conf"
 	"github.com/aler9/rtsp-simple-server/internal/logger"
 )
 
@@ -24,9 +25,12 @@ type pprof struct {
 
 func newPPROF(
 	address string,
+	ipv6Disable bool,
+	listenReusePort bool,
+	unixSocketPermissions conf.FileMode,
 	parent pprofParent,
 ) (*pprof, error) {
-	ln, err := net.Listen("tcp", address)
+	ln, err := listen(address, ipv6Disable, listenReusePort, unixSocketPermissions)
 	if err != nil {
 		return nil, err
 	}
@@ -3,6 +3,7 @@ package core
 // publisher is an entity that can publish a stream dynamically.
 type publisher interface {
 	source
+	ID() string
 	close()
 	onPublisherAccepted(tracksLen int)
 }
@@ -0,0 +1,458 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/aler9/gortsplib/pkg/h264"
+	"github.com/aler9/gortsplib/pkg/ringbuffer"
+	"github.com/aler9/gortsplib/pkg/rtpaac"
+	"github.com/aler9/gortsplib/pkg/rtph264"
+	"github.com/notedit/rtmp/av"
+	"github.com/pion/rtp"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+	"github.com/aler9/rtsp-simple-server/internal/redact"
+	"github.com/aler9/rtsp-simple-server/internal/rtmp"
+)
+
+const (
+	pusherRetryPause = 5 * time.Second
+)
+
+// pusherErrIncompatible is returned when the stream can't be accepted by the destination.
+// Since the stream doesn't change until the source is replaced, the push is not retried.
+type pusherErrIncompatible struct {
+	msg string
+}
+
+// Error implements the error interface.
+func (e pusherErrIncompatible) Error() string {
+	return e.msg
+}
+
+type pusherTrackIDPayloadPair struct {
+	trackID int
+	buf     []byte
+}
+
+type pusherParent interface {
+	log(logger.Level, string, ...interface{})
+}
+
+// pusher reads the stream of a path and publishes it to a RTMP server.
+type pusher struct {
+	// fields accessed atomically must be placed first
+	// in order to be aligned on 32-bit platforms.
+	bytesSent uint64
+
+	ur              string
+	preset          *conf.PushPreset
+	readTimeout     conf.StringDuration
+	writeTimeout    conf.StringDuration
+	readBufferCount int
+	stream          *stream
+	parent          pusherParent
+
+	created    time.Time
+	ctx        context.Context
+	ctxCancel  func()
+	done       chan struct{}
+	ringBuffer *ringbuffer.RingBuffer
+	mutex      sync.RWMutex
+}
+
+func newPusher(
+	parentCtx context.Context,
+	ur string,
+	preset *conf.PushPreset,
+	readTimeout conf.StringDuration,
+	writeTimeout conf.StringDuration,
+	readBufferCount int,
+	stream *stream,
+	parent pusherParent) *pusher {
+	ctx, ctxCancel := context.WithCancel(parentCtx)
+
+	p := &pusher{
+		ur:              ur,
+		preset:          preset,
+		readTimeout:     readTimeout,
+		writeTimeout:    writeTimeout,
+		readBufferCount: readBufferCount,
+		stream:          stream,
+		parent:          parent,
+		created:         time.Now(),
+		ctx:             ctx,
+		ctxCancel:       ctxCancel,
+		done:            make(chan struct{}),
+	}
+
+	p.log(logger.Info, "started")
+
+	go p.run()
+
+	return p
+}
+
+// close stops the pusher and waits for its routine to exit.
+func (p *pusher) close() {
+	p.log(logger.Info, "stopped")
+	p.ctxCancel()
+	<-p.done
+}
+
+func (p *pusher) log(level logger.Level, format string, args ...interface{}) {
+	p.parent.log(level, "[pusher] "+format, args...)
+}
+
+// destination returns a description of the destination that doesn't contain secrets.
+func (p *pusher) destination() string {
+	if p.preset != nil {
+		return p.preset.Name
+	}
+	return redact.Text(p.ur)
+}
+
+func (p *pusher) run() {
+	defer close(p.done)
+
+	for {
+		err := p.runInner()
+		if err == nil {
+			return
+		}
+
+		if _, ok := err.(pusherErrIncompatible); ok {
+			p.log(logger.Error, "unable to push to %s: %s", p.destination(), err)
+			<-p.ctx.Done()
+			return
+		}
+
+		p.log(logger.Info, "ERR: %s", err)
+
+		select {
+		case <-time.After(pusherRetryPause):
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+// checkTracks returns the tracks that are pushed, or an error if the stream can't be pushed.
+func (p *pusher) checkTracks() (*gortsplib.Track, int, *gortsplib.Track, int, error) {
+	var videoTrack *gortsplib.Track
+	videoTrackID := -1
+	var audioTrack *gortsplib.Track
+	audioTrackID := -1
+
+	for i, t := range p.stream.tracks() {
+		switch {
+		case t.IsH264():
+			if videoTrack != nil {
+				return nil, 0, nil, 0, pusherErrIncompatible{
+					"the stream contains multiple video tracks, while RTMP supports a single one"}
+			}
+			videoTrack = t
+			videoTrackID = i
+
+		case t.IsAAC():
+			if audioTrack != nil {
+				return nil, 0, nil, 0, pusherErrIncompatible{
+					"the stream contains multiple audio tracks, while RTMP supports a single one"}
+			}
+			audioTrack = t
+			audioTrackID = i
+
+		case p.preset != nil:
+			// platforms accept a limited set of codecs, therefore other tracks
+			// are not silently discarded.
+			return nil, 0, nil, 0, pusherErrIncompatible{
+				fmt.Sprintf("track %d uses a codec that is not supported by %s (%s); "+
+					"supported codecs are H264 and AAC", i+1, p.preset.Name, trackCodecName(t))}
+		}
+	}
+
+	if videoTrack == nil {
+		if p.preset != nil {
+			return nil, 0, nil, 0, pusherErrIncompatible{
+				fmt.Sprintf("%s requires an H264 video track, but the stream doesn't contain one", p.preset.Name)}
+		}
+
+		if audioTrack == nil {
+			return nil, 0, nil, 0, pusherErrIncompatible{
+				"the stream doesn't contain an H264 track or an AAC track"}
+		}
+	}
+
+	return videoTrack, videoTrackID, audioTrack, audioTrackID, nil
+}
+
+func (p *pusher) runInner() error {
+	videoTrack, videoTrackID, audioTrack, audioTrackID, err := p.checkTracks()
+	if err != nil {
+		return err
+	}
+
+	p.log(logger.Debug, "connecting to %s", p.destination())
+
+	ctx, cancel := context.WithTimeout(p.ctx, time.Duration(p.readTimeout))
+	defer cancel()
+
+	conn, err := rtmp.DialContext(ctx, p.ur)
+	if err != nil {
+		return err
+	}
+
+	ringBuffer := ringbuffer.New(uint64(p.readBufferCount))
+
+	writeDone := make(chan error)
+	go func() {
+		writeDone <- func() error {
+			conn.NetConn().SetReadDeadline(time.Now().Add(time.Duration(p.readTimeout)))
+			conn.NetConn().SetWriteDeadline(time.Now().Add(time.Duration(p.writeTimeout)))
+			err := conn.ClientHandshakePublish()
+			if err != nil {
+				return err
+			}
+
+			conn.NetConn().SetReadDeadline(time.Time{})
+
+			conn.NetConn().SetWriteDeadline(time.Now().Add(time.Duration(p.writeTimeout)))
+			err = conn.WriteMetadata(videoTrack, audioTrack, rtmpConnMetadata(p.stream, videoTrackID, audioTrackID))
+			if err != nil {
+				return err
+			}
+
+			p.log(logger.Info, "pushing to %s", p.destination())
+
+			p.mutex.Lock()
+			p.ringBuffer = ringBuffer
+			p.mutex.Unlock()
+
+			defer func() {
+				p.mutex.Lock()
+				p.ringBuffer = nil
+				p.mutex.Unlock()
+			}()
+
+			return p.writePackets(conn, ringBuffer, videoTrack, videoTrackID, audioTrack, audioTrackID)
+		}()
+	}()
+
+	select {
+	case err := <-writeDone:
+		conn.NetConn().Close()
+		return err
+
+	case <-p.ctx.Done():
+		ringBuffer.Close()
+		conn.NetConn().Close()
+		<-writeDone
+		return nil
+	}
+}
+
+func (p *pusher) writePackets(
+	conn *rtmp.Conn,
+	ringBuffer *ringbuffer.RingBuffer,
+	videoTrack *gortsplib.Track,
+	videoTrackID int,
+	audioTrack *gortsplib.Track,
+	audioTrackID int,
+) error {
+	var h264Decoder *rtph264.Decoder
+	if videoTrack != nil {
+		h264Decoder = rtph264.NewDecoder()
+	}
+
+	var aacDecoder *rtpaac.Decoder
+	var audioClockRate int
+	if audioTrack != nil {
+		audioClockRate, _ = audioTrack.ClockRate()
+		aacDecoder = rtpaac.NewDecoder(audioClockRate)
+	}
+
+	var videoStartPTS time.Duration
+	var videoDTSEst *h264.DTSEstimator
+	videoFirstIDRFound := false
+	var lastIDRPTS time.Duration
+
+	for {
+		data, ok := ringBuffer.Pull()
+		if !ok {
+			return fmt.Errorf("terminated")
+		}
+		pair := data.(pusherTrackIDPayloadPair)
+
+		if videoTrack != nil && pair.trackID == videoTrackID {
+			var pkt rtp.Packet
+			err := pkt.Unmarshal(pair.buf)
+			if err != nil {
+				p.log(logger.Warn, "unable to decode RTP packet: %v", err)
+				continue
+			}
+
+			nalus, pts, err := h264Decoder.DecodeUntilMarker(&pkt)
+			if err != nil {
+				if err != rtph264.ErrMorePacketsNeeded && err != rtph264.ErrNonStartingPacketAndNoPrevious {
+					p.log(logger.Warn, "unable to decode video track: %v", err)
+				}
+				continue
+			}
+
+			var nalusFiltered [][]byte
+			idrPresent := false
+
+			for _, nalu := range nalus {
+				// remove SPS, PPS and AUD, not needed by RTMP
+				typ := h264.NALUType(nalu[0] & 0x1F)
+				switch typ {
+				case h264.NALUTypeSPS, h264.NALUTypePPS, h264.NALUTypeAccessUnitDelimiter:
+					continue
+
+				case h264.NALUTypeIDR:
+					idrPresent = true
+				}
+
+				nalusFiltered = append(nalusFiltered, nalu)
+			}
+
+			// wait until we receive an IDR
+			if !videoFirstIDRFound {
+				if !idrPresent {
+					continue
+				}
+
+				videoFirstIDRFound = true
+				videoStartPTS = pts
+				videoDTSEst = h264.NewDTSEstimator()
+				lastIDRPTS = pts
+			}
+
+			if idrPresent && p.preset != nil {
+				interval := pts - lastIDRPTS
+				if interval > p.preset.MaxKeyframeInterval {
+					return pusherErrIncompatible{
+						fmt.Sprintf("the keyframe interval of the stream (%v) is greater than the maximum "+
+							"allowed by %s (%v); set the keyframe interval (GOP size) of the encoder to %v or less",
+							interval.Round(time.Millisecond), p.preset.Name, p.preset.MaxKeyframeInterval,
+							p.preset.MaxKeyframeInterval)}
+				}
+				lastIDRPTS = pts
+			}
+
+			data, err := h264.EncodeAVCC(nalusFiltered)
+			if err != nil {
+				return err
+			}
+
+			pts -= videoStartPTS
+			dts := videoDTSEst.Feed(pts)
+
+			conn.NetConn().SetWriteDeadline(time.Now().Add(time.Duration(p.writeTimeout)))
+			err = conn.WritePacket(av.Packet{
+				Type:       av.H264,
+				Data:       data,
+				Time:       dts,
+				CTime:      pts - dts,
+				IsKeyFrame: idrPresent,
+			})
+			if err != nil {
+				return err
+			}
+		} else if audioTrack != nil && pair.trackID == audioTrackID {
+			var pkt rtp.Packet
+			err := pkt.Unmarshal(pair.buf)
+			if err != nil {
+				p.log(logger.Warn, "unable to decode RTP packet: %v", err)
+				continue
+			}
+
+			aus, pts, err := aacDecoder.Decode(&pkt)
+			if err != nil {
+				if err != rtpaac.ErrMorePacketsNeeded {
+					p.log(logger.Warn, "unable to decode audio track: %v", err)
+				}
+				continue
+			}
+
+			if videoTrack != nil && !videoFirstIDRFound {
+				continue
+			}
+
+			pts -= videoStartPTS
+			if pts < 0 {
+				continue
+			}
+
+			for _, au := range aus {
+				conn.NetConn().SetWriteDeadline(time.Now().Add(time.Duration(p.writeTimeout)))
+				err := conn.WritePacket(av.Packet{
+					Type: av.AAC,
+					Data: au,
+					Time: pts,
+				})
+				if err != nil {
+					return err
+				}
+
+				pts += 1000 * time.Second / time.Duration(audioClockRate)
+			}
+		}
+	}
+}
+
+// ID implements reader.
+func (p *pusher) ID() string {
+	return "pusher"
+}
+
+// onReaderAccepted implements reader.
+func (p *pusher) onReaderAccepted() {
+}
+
+// onReaderPacketRTP implements reader.
+func (p *pusher) onReaderPacketRTP(trackID int, payload []byte) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	// packets are discarded while the pusher is not connected
+	if p.ringBuffer != nil {
+		atomic.AddUint64(&p.bytesSent, uint64(len(payload)))
+		p.ringBuffer.Push(pusherTrackIDPayloadPair{trackID, payload})
+	}
+}
+
+// onReaderPacketRTCP implements reader.
+func (p *pusher) onReaderPacketRTCP(trackID int, payload []byte) {
+}
+
+// onReaderAPIDescribe implements reader.
+func (p *pusher) onReaderAPIDescribe() interface{} {
+	return struct {
+		Type string `json:"type"`
+	}{"pusher"}
+}
+
+// onReaderAPIReadersItem implements reader.
+func (p *pusher) onReaderAPIReadersItem() pathAPIPathsReadersItem {
+	// the URL may contain a stream key, therefore only the host is exposed
+	var remoteAddr string
+	if u, err := url.Parse(p.ur); err == nil {
+		remoteAddr = u.Host
+	}
+
+	return pathAPIPathsReadersItem{
+		Type:       "pusher",
+		Protocol:   "rtmp",
+		RemoteAddr: remoteAddr,
+		Created:    p.created,
+		BytesSent:  atomic.LoadUint64(&p.bytesSent),
+	}
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+)
+
+func TestPusher(t *testing.T) {
+	p, ok := newInstance("hlsDisable: yes\n" +
+		"paths:\n" +
+		"  source:\n" +
+		"    source: testsrc\n" +
+		"    testsrcWidth: 160\n" +
+		"    testsrcHeight: 120\n" +
+		"    testsrcFPS: 10\n" +
+		"    push: rtmp://localhost:1935/pushed/stream\n" +
+		"  all:\n")
+	require.Equal(t, true, ok)
+	defer p.close()
+
+	time.Sleep(1 * time.Second)
+
+	var mutex sync.Mutex
+	received := 0
+
+	c := gortsplib.Client{
+		OnPacketRTP: func(trackID int, payload []byte) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			received++
+		},
+	}
+
+	err := c.StartReading("rtsp://localhost:8554/pushed/stream")
+	require.NoError(t, err)
+	defer c.Close()
+
+	// the G711 track is not supported by RTMP and is not pushed
+	tracks := c.Tracks()
+	require.Equal(t, 1, len(tracks))
+	require.Equal(t, true, tracks[0].IsH264())
+
+	time.Sleep(500 * time.Millisecond)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.NotZero(t, received)
+}
+
+func TestPusherIncompatible(t *testing.T) {
+	videoTrack, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x07, 0x01, 0x02, 0x03}, PPS: []byte{0x08}})
+	require.NoError(t, err)
+
+	audioTrack, err := gortsplib.NewTrackAAC(97,
+		&gortsplib.TrackConfigAAC{Type: 2, SampleRate: 44100, ChannelCount: 2})
+	require.NoError(t, err)
+
+	preset := &conf.PushPreset{
+		Name:                "YouTube",
+		MaxKeyframeInterval: 4 * time.Second,
+	}
+
+	for _, ca := range []struct {
+		name   string
+		preset *conf.PushPreset
+		tracks gortsplib.Tracks
+		err    string
+	}{
+		{
+			"unsupported codec",
+			preset,
+			gortsplib.Tracks{videoTrack, newPCMUTrack()},
+			"track 2 uses a codec that is not supported by YouTube (PCMU); " +
+				"supported codecs are H264 and AAC",
+		},
+		{
+			"no video",
+			preset,
+			gortsplib.Tracks{audioTrack},
+			"YouTube requires an H264 video track, but the stream doesn't contain one",
+		},
+		{
+			"no supported tracks",
+			nil,
+			gortsplib.Tracks{newPCMUTrack()},
+			"the stream doesn't contain an H264 track or an AAC track",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			s := newStream(ca.tracks, &conf.PathConf{}, nil)
+			defer s.close()
+
+			pu := &pusher{
+				preset: ca.preset,
+				stream: s,
+			}
+
+			_, _, _, _, err := pu.checkTracks()
+			require.EqualError(t, err, ca.err)
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+)
+
+const (
+	// period between measurements of the bitrates of tenants.
+	quotasBitratePeriod = 1 * time.Second
+)
+
+type pathErrQuotaExceeded struct {
+	Tenant string
+	Quota  string
+}
+
+// Error implements the error interface.
+func (e pathErrQuotaExceeded) Error() string {
+	return fmt.Sprintf("tenant '%s' has exceeded its quota of %s", e.Tenant, e.Quota)
+}
+
+// quotasTenant contains the resources used by a tenant.
+type quotasTenant struct {
+	// fields accessed atomically must be placed first
+	// in order to be aligned on 32-bit platforms.
+	bytesReceived uint64
+	bytesSent     uint64
+
+	// protected by quotas.mutex
+	conf              conf.TenantConf
+	publishers        int
+	readers           int
+	rejections        int64
+	prevBytesReceived uint64
+	prevBytesSent     uint64
+	ingestBitrate     int64
+	egressBitrate     int64
+}
+
+// onBytesReceived is called by stream when a packet is received from the source.
+func (t *quotasTenant) onBytesReceived(n uint64) {
+	atomic.AddUint64(&t.bytesReceived, n)
+}
+
+// onBytesSent is called by stream when a packet is sent to readers.
+func (t *quotasTenant) onBytesSent(n uint64) {
+	atomic.AddUint64(&t.bytesSent, n)
+}
+
+type quotasTenantInfo struct {
+	Publishers    int
+	Readers       int
+	BytesReceived uint64
+	BytesSent     uint64
+	IngestBitrate int64
+	EgressBitrate int64
+	Rejections    int64
+}
+
+// quotas tracks the resources used by each tenant and enforces the quotas of tenants.
+// It is shared by all paths and survives configuration reloads,
+// in order to keep counters consistent while paths are recreated.
+type quotas struct {
+	mutex      sync.Mutex
+	tenants    map[string]*quotasTenant
+	lastUpdate time.Time
+}
+
+func newQuotas() *quotas {
+	return &quotas{
+		tenants:    make(map[string]*quotasTenant),
+		lastUpdate: time.Now(),
+	}
+}
+
+// setTenants sets the quotas of tenants.
+// Resources that are already in use are not affected.
+func (q *quotas) setTenants(tenants map[string]*conf.TenantConf) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for name := range q.tenants {
+		if _, ok := tenants[name]; !ok {
+			delete(q.tenants, name)
+		}
+	}
+
+	for name, tconf := range tenants {
+		t, ok := q.tenants[name]
+		if !ok {
+			t = &quotasTenant{}
+			q.tenants[name] = t
+		}
+		t.conf = *tconf
+	}
+}
+
+// tenant returns the resources used by a tenant, or nil if the tenant doesn't exist.
+func (q *quotas) tenant(name string) *quotasTenant {
+	if name == "" {
+		return nil
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.tenants[name]
+}
+
+// addPublisher reserves a publisher. It returns an error if a quota has been reached.
+func (q *quotas) addPublisher(tenant string) error {
+	if tenant == "" {
+		return nil
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	t, ok := q.tenants[tenant]
+	if !ok {
+		return nil
+	}
+
+	if t.conf.MaxPublishers != 0 && t.publishers >= t.conf.MaxPublishers {
+		t.rejections++
+		return pathErrQuotaExceeded{
+			Tenant: tenant,
+			Quota:  fmt.Sprintf("%d publishers", t.conf.MaxPublishers),
+		}
+	}
+
+	if t.conf.MaxIngestBitrate != 0 && t.ingestBitrate >= int64(t.conf.MaxIngestBitrate) {
+		t.rejections++
+		return pathErrQuotaExceeded{
+			Tenant: tenant,
+			Quota:  fmt.Sprintf("%d bit/s of ingest bitrate", t.conf.MaxIngestBitrate),
+		}
+	}
+
+	t.publishers++
+	return nil
+}
+
+// removePublisher releases a publisher reserved with addPublisher.
+func (q *quotas) removePublisher(tenant string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if t, ok := q.tenants[tenant]; ok && t.publishers > 0 {
+		t.publishers--
+	}
+}
+
+// addReader reserves a reader. It returns an error if a quota has been reached.
+func (q *quotas) addReader(tenant string) error {
+	if tenant == "" {
+		return nil
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	t, ok := q.tenants[tenant]
+	if !ok {
+		return nil
+	}
+
+	if t.conf.MaxReaders != 0 && t.readers >= t.conf.MaxReaders {
+		t.rejections++
+		return pathErrQuotaExceeded{
+			Tenant: tenant,
+			Quota:  fmt.Sprintf("%d readers", t.conf.MaxReaders),
+		}
+	}
+
+	if t.conf.MaxEgressBitrate != 0 && t.egressBitrate >= int64(t.conf.MaxEgressBitrate) {
+		t.rejections++
+		return pathErrQuotaExceeded{
+			Tenant: tenant,
+			Quota:  fmt.Sprintf("%d bit/s of egress bitrate", t.conf.MaxEgressBitrate),
+		}
+	}
+
+	t.readers++
+	return nil
+}
+
+// removeReader releases a reader reserved with addReader.
+func (q *quotas) removeReader(tenant string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if t, ok := q.tenants[tenant]; ok && t.readers > 0 {
+		t.readers--
+	}
+}
+
+// rejectPath is called when a path can't be created since a quota has been reached.
+func (q *quotas) rejectPath(tenant string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if t, ok := q.tenants[tenant]; ok {
+		t.rejections++
+	}
+}
+
+// updateBitrates computes the bitrates of tenants. It is called periodically by pathManager.
+func (q *quotas) updateBitrates() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(q.lastUpdate).Seconds()
+	q.lastUpdate = now
+
+	if elapsed <= 0 {
+		return
+	}
+
+	for _, t := range q.tenants {
+		received := atomic.LoadUint64(&t.bytesReceived)
+		sent := atomic.LoadUint64(&t.bytesSent)
+
+		t.ingestBitrate = int64(float64(received-t.prevBytesReceived) * 8 / elapsed)
+		t.egressBitrate = int64(float64(sent-t.prevBytesSent) * 8 / elapsed)
+
+		t.prevBytesReceived = received
+		t.prevBytesSent = sent
+	}
+}
+
+// info returns the resources used by each tenant.
+func (q *quotas) info() map[string]quotasTenantInfo {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	ret := make(map[string]quotasTenantInfo, len(q.tenants))
+
+	for name, t := range q.tenants {
+		ret[name] = quotasTenantInfo{
+			Publishers:    t.publishers,
+			Readers:       t.readers,
+			BytesReceived: atomic.LoadUint64(&t.bytesReceived),
+			BytesSent:     atomic.LoadUint64(&t.bytesSent),
+			IngestBitrate: t.ingestBitrate,
+			EgressBitrate: t.egressBitrate,
+			Rejections:    t.rejections,
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+)
+
+func TestQuotas(t *testing.T) {
+	q := newQuotas()
+	q.setTenants(map[string]*conf.TenantConf{
+		"customer1": {
+			MaxPublishers:    1,
+			MaxReaders:       2,
+			MaxEgressBitrate: 1000,
+		},
+	})
+
+	// paths that don't belong to a tenant are not limited
+	require.NoError(t, q.addPublisher(""))
+	require.Nil(t, q.tenant(""))
+
+	require.NoError(t, q.addPublisher("customer1"))
+	require.Equal(t, pathErrQuotaExceeded{Tenant: "customer1", Quota: "1 publishers"},
+		q.addPublisher("customer1"))
+	q.removePublisher("customer1")
+	require.NoError(t, q.addPublisher("customer1"))
+
+	require.NoError(t, q.addReader("customer1"))
+	require.NoError(t, q.addReader("customer1"))
+	require.Error(t, q.addReader("customer1"))
+	q.removeReader("customer1")
+
+	// new readers are rejected when the egress bitrate has been reached
+	time.Sleep(100 * time.Millisecond)
+	q.tenant("customer1").onBytesSent(1000)
+	q.updateBitrates()
+	require.Equal(t, pathErrQuotaExceeded{Tenant: "customer1", Quota: "1000 bit/s of egress bitrate"},
+		q.addReader("customer1"))
+
+	info := q.info()["customer1"]
+	require.Equal(t, 1, info.Publishers)
+	require.Equal(t, 1, info.Readers)
+	require.Equal(t, uint64(1000), info.BytesSent)
+	require.Greater(t, info.EgressBitrate, int64(1000))
+	require.Equal(t, int64(3), info.Rejections)
+
+	// counters are preserved when quotas are changed
+	q.setTenants(map[string]*conf.TenantConf{
+		"customer1": {},
+	})
+	require.NoError(t, q.addReader("customer1"))
+	require.Equal(t, 2, q.info()["customer1"].Readers)
+}
@@ -2,9 +2,11 @@ package core
 
 // reader is an entity that can read a stream.
 type reader interface {
+	ID() string
 	close()
 	onReaderAccepted()
 	onReaderPacketRTP(int, []byte)
 	onReaderPacketRTCP(int, []byte)
 	onReaderAPIDescribe() interface{}
+	onReaderAPIReadersItem() pathAPIPathsReadersItem
 }
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+)
+
+const (
+	// period between checks of congestion.
+	readerSheddingPeriod = 1 * time.Second
+
+	// time after which, if memory is still over the limit, readers
+	// of the next priority class are shed too.
+	readerSheddingEscalation = 5 * time.Second
+)
+
+type pathErrCongested struct {
+	PathName string
+	Reason   string
+}
+
+// Error implements the error interface.
+func (e pathErrCongested) Error() string {
+	return fmt.Sprintf("path '%s' is congested (%s)", e.PathName, e.Reason)
+}
+
+// readerPriority returns the priority class of a reader,
+// that is the one of the first rule matched by the reader.
+func readerPriority(rules conf.ReaderPriorityRules, user string, ip net.IP, rawQuery string) conf.ReaderPriority {
+	query, _ := url.ParseQuery(rawQuery)
+
+	for _, r := range rules {
+		if len(r.Users) != 0 && !stringInSlice(user, r.Users) {
+			continue
+		}
+
+		if len(r.IPs) != 0 && (ip == nil || !ipEqualOrInRange(ip, r.IPs)) {
+			continue
+		}
+
+		if r.Query != "" {
+			name, value := r.QueryParam()
+			if vals, ok := query[name]; !ok || (value != "" && !stringInSlice(value, vals)) {
+				continue
+			}
+		}
+
+		return r.Priority
+	}
+
+	return conf.ReaderPriorityNormal
+}
+
+func stringInSlice(v string, list []string) bool {
+	for _, e := range list {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// readerShedding decides whether readers must be shed because the memory
+// used by the server is over readerSheddingMemory.
+// Readers of the lowest priority class are shed first; if memory is still
+// over the limit after readerSheddingEscalation, readers of the next class
+// are shed too. Critical readers are never shed.
+// It is shared by all paths and survives configuration reloads.
+type readerShedding struct {
+	readMemory func() uint64
+
+	mutex     sync.Mutex
+	limit     uint64
+	lastCheck time.Time
+	active    bool
+	level     conf.ReaderPriority
+	escalated time.Time
+}
+
+func newReaderShedding() *readerShedding {
+	return &readerShedding{
+		readMemory: func() uint64 {
+			var ms runtime.MemStats
+			runtime.ReadMemStats(&ms)
+			return ms.HeapInuse
+		},
+	}
+}
+
+// setMemoryLimit sets the memory limit, in megabytes. Zero disables shedding.
+func (s *readerShedding) setMemoryLimit(mb int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.limit = uint64(mb) * 1024 * 1024
+	s.active = false
+}
+
+// memoryLevel returns the highest priority class whose readers must be shed,
+// and whether readers must be shed at all.
+// Memory is measured at most once every readerSheddingPeriod, since
+// this is called periodically by every path.
+func (s *readerShedding) memoryLevel() (conf.ReaderPriority, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.limit == 0 {
+		return 0, false
+	}
+
+	now := time.Now()
+	if now.Sub(s.lastCheck) < readerSheddingPeriod {
+		return s.level, s.active
+	}
+	s.lastCheck = now
+
+	switch {
+	case s.readMemory() <= s.limit:
+		s.active = false
+
+	case !s.active:
+		s.active = true
+		s.level = conf.ReaderPriorityLow
+		s.escalated = now
+
+	case s.level < conf.ReaderPriorityCritical-1 && now.Sub(s.escalated) >= readerSheddingEscalation:
+		s.level++
+		s.escalated = now
+	}
+
+	return s.level, s.active
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+)
+
+func TestReaderPriority(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("10.0.0.0/8")
+
+	rules := conf.ReaderPriorityRules{
+		{Priority: conf.ReaderPriorityCritical, Users: []string{"recorder"}},
+		{Priority: conf.ReaderPriorityHigh, IPs: conf.IPsOrNets{ipnet}, Query: "console=1"},
+		{Priority: conf.ReaderPriorityLow, Query: "preview"},
+	}
+
+	for _, ca := range []struct {
+		name     string
+		user     string
+		ip       string
+		query    string
+		priority conf.ReaderPriority
+	}{
+		{"user", "recorder", "192.168.1.1", "", conf.ReaderPriorityCritical},
+		{"ip and query", "", "10.1.1.1", "console=1", conf.ReaderPriorityHigh},
+		{"ip without query", "", "10.1.1.1", "", conf.ReaderPriorityNormal},
+		{"query with another value", "", "10.1.1.1", "console=2", conf.ReaderPriorityNormal},
+		{"query without value", "", "192.168.1.1", "a=b&preview", conf.ReaderPriorityLow},
+		{"none", "user", "192.168.1.1", "", conf.ReaderPriorityNormal},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			require.Equal(t, ca.priority, readerPriority(rules, ca.user, net.ParseIP(ca.ip), ca.query))
+		})
+	}
+
+	// HLS muxers have no IP
+	require.Equal(t, conf.ReaderPriorityNormal, readerPriority(rules, "", nil, "console=1"))
+}
+
+func TestReaderSheddingMemory(t *testing.T) {
+	used := uint64(0)
+
+	s := newReaderShedding()
+	s.readMemory = func() uint64 {
+		return used
+	}
+
+	_, ok := s.memoryLevel()
+	require.Equal(t, false, ok)
+
+	s.setMemoryLimit(100)
+
+	check := func() (conf.ReaderPriority, bool) {
+		// skip the period between checks
+		s.lastCheck = time.Time{}
+		return s.memoryLevel()
+	}
+
+	used = 50 * 1024 * 1024
+	_, ok = check()
+	require.Equal(t, false, ok)
+
+	used = 150 * 1024 * 1024
+	level, ok := check()
+	require.Equal(t, true, ok)
+	require.Equal(t, conf.ReaderPriorityLow, level)
+
+	// the level is kept until readerSheddingEscalation has passed
+	level, _ = check()
+	require.Equal(t, conf.ReaderPriorityLow, level)
+
+	for _, exp := range []conf.ReaderPriority{
+		conf.ReaderPriorityNormal,
+		conf.ReaderPriorityHigh,
+		conf.ReaderPriorityHigh, // critical readers are never shed
+	} {
+		s.escalated = s.escalated.Add(-readerSheddingEscalation)
+		level, _ = check()
+		require.Equal(t, exp, level)
+	}
+
+	used = 50 * 1024 * 1024
+	_, ok = check()
+	require.Equal(t, false, ok)
+}
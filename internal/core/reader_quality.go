@@ -0,0 +1,152 @@
+package core
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	rtcpPayloadTypeReceiverReport = 201
+)
+
+// readerQualityInfo describes the network quality of a reader.
+// Fields are nil when they are not available.
+type readerQualityInfo struct {
+	// packets lost since the beginning of the session
+	PacketsLost *uint64 `json:"packetsLost,omitempty"`
+	// percentage of packets lost since the previous report
+	FractionLost *float64 `json:"fractionLost,omitempty"`
+	// interarrival jitter, in milliseconds
+	Jitter *float64 `json:"jitter,omitempty"`
+	// round trip time, in milliseconds
+	RTT *float64 `json:"rtt,omitempty"`
+	// bytes waiting to be sent in the TCP send queue
+	SendQueue *uint64 `json:"sendQueue,omitempty"`
+}
+
+type readerQualityTrack struct {
+	clockRate    int
+	received     bool
+	packetsLost  uint64
+	fractionLost float64
+	jitter       float64
+	rtt          *float64
+}
+
+// readerQuality collects the receiver reports sent by a reader.
+type readerQuality struct {
+	mutex  sync.Mutex
+	tracks map[int]*readerQualityTrack
+}
+
+func newReaderQuality(clockRates map[int]int) *readerQuality {
+	q := &readerQuality{
+		tracks: make(map[int]*readerQualityTrack),
+	}
+
+	for trackID, clockRate := range clockRates {
+		q.tracks[trackID] = &readerQualityTrack{
+			clockRate: clockRate,
+		}
+	}
+
+	return q
+}
+
+// processRTCP reads the receiver reports contained in a RTCP (compound) packet.
+func (q *readerQuality) processRTCP(now time.Time, trackID int, payload []byte) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	t, ok := q.tracks[trackID]
+	if !ok {
+		return
+	}
+
+	for len(payload) >= 4 {
+		// length is in 32-bit words, minus one
+		l := (int(binary.BigEndian.Uint16(payload[2:])) + 1) * 4
+		if l > len(payload) {
+			return
+		}
+
+		reportCount := int(payload[0] & 0x1F)
+
+		// the first report block follows the header and the SSRC of the sender
+		if payload[1] == rtcpPayloadTypeReceiverReport && reportCount >= 1 && l >= 32 {
+			block := payload[8:32]
+
+			t.received = true
+			t.fractionLost = float64(block[4]) * 100 / 256
+
+			// cumulative number of packets lost is a signed 24-bit integer
+			lost := int32(uint32(block[5])<<24|uint32(block[6])<<16|uint32(block[7])<<8) >> 8
+			if lost < 0 {
+				lost = 0
+			}
+			t.packetsLost = uint64(lost)
+
+			if t.clockRate != 0 {
+				t.jitter = float64(binary.BigEndian.Uint32(block[12:])) * 1000 / float64(t.clockRate)
+			}
+
+			// RTT is computed with the middle 32 bits of the NTP timestamps (RFC3550, 6.4.1)
+			lsr := binary.BigEndian.Uint32(block[16:])
+			dlsr := binary.BigEndian.Uint32(block[20:])
+			if lsr != 0 {
+				a := uint32(timeToNTP(now) >> 16)
+				rtt := float64(a-lsr-dlsr) * 1000 / 65536
+				t.rtt = &rtt
+			}
+		}
+
+		payload = payload[l:]
+	}
+}
+
+// describe returns the worst values among the ones of all tracks.
+func (q *readerQuality) describe(nconn net.Conn) readerQualityInfo {
+	var ret readerQualityInfo
+
+	if q != nil {
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+
+		for _, t := range q.tracks {
+			if !t.received {
+				continue
+			}
+
+			packetsLost := t.packetsLost
+			if ret.PacketsLost != nil {
+				packetsLost += *ret.PacketsLost
+			}
+			ret.PacketsLost = &packetsLost
+
+			if ret.FractionLost == nil || t.fractionLost > *ret.FractionLost {
+				v := t.fractionLost
+				ret.FractionLost = &v
+			}
+
+			if ret.Jitter == nil || t.jitter > *ret.Jitter {
+				v := t.jitter
+				ret.Jitter = &v
+			}
+
+			if t.rtt != nil && (ret.RTT == nil || *t.rtt > *ret.RTT) {
+				v := *t.rtt
+				ret.RTT = &v
+			}
+		}
+	}
+
+	if nconn != nil {
+		if v, ok := tcpSendQueue(nconn); ok {
+			ret.SendQueue = &v
+		}
+	}
+
+	return ret
+}
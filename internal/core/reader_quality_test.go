@@ -0,0 +1,49 @@
+package core
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaderQuality(t *testing.T) {
+	q := newReaderQuality(map[int]int{0: 90000, 1: 48000})
+
+	info := q.describe(nil)
+	require.Equal(t, readerQualityInfo{}, info)
+
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// the sender report was sent 300ms ago and the reader waited 100ms before replying
+	lsr := uint32(timeToNTP(now.Add(-300*time.Millisecond)) >> 16)
+	dlsr := uint32(65536 / 10)
+
+	rr := []byte{
+		0x81, 0xc9, 0x00, 0x07, // receiver report with 1 block
+		0x01, 0x02, 0x03, 0x04, // SSRC of sender
+		0x05, 0x06, 0x07, 0x08, // SSRC of source
+		0x40,             // fraction lost: 25%
+		0x00, 0x00, 0x0a, // cumulative lost: 10
+		0x00, 0x00, 0x10, 0x00, // extended highest sequence number
+		0x00, 0x00, 0x03, 0x84, // jitter: 900 = 10ms
+		0x00, 0x00, 0x00, 0x00, // LSR
+		0x00, 0x00, 0x00, 0x00, // DLSR
+	}
+	binary.BigEndian.PutUint32(rr[24:], lsr)
+	binary.BigEndian.PutUint32(rr[28:], dlsr)
+
+	q.processRTCP(now, 0, rr)
+
+	info = q.describe(nil)
+	require.Equal(t, uint64(10), *info.PacketsLost)
+	require.Equal(t, float64(25), *info.FractionLost)
+	require.Equal(t, float64(10), *info.Jitter)
+	require.InDelta(t, 200, *info.RTT, 1)
+
+	// reports of unknown tracks are ignored
+	q.processRTCP(now, 3, rr)
+	info = q.describe(nil)
+	require.Equal(t, uint64(10), *info.PacketsLost)
+}
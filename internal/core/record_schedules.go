@@ -0,0 +1,65 @@
+package core
+
+import (
+	"sync"
+)
+
+// recordSchedules contains the record schedules that have been set through the API,
+// that replace the ones of the configuration.
+// It is shared with paths and survives configuration reloads,
+// in order not to lose schedules when paths are recreated.
+type recordSchedules struct {
+	mutex   sync.Mutex
+	exprs   map[string]string
+	changed chan struct{}
+}
+
+func newRecordSchedules() *recordSchedules {
+	return &recordSchedules{
+		exprs:   make(map[string]string),
+		changed: make(chan struct{}),
+	}
+}
+
+// set sets the schedule of a path.
+func (r *recordSchedules) set(name string, expr string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.exprs[name] = expr
+	r.notify()
+}
+
+// reset restores the schedule of the configuration.
+// It returns false if the schedule was not set.
+func (r *recordSchedules) reset(name string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.exprs[name]; !ok {
+		return false
+	}
+
+	delete(r.exprs, name)
+	r.notify()
+	return true
+}
+
+// get returns the schedule of a path, if it has been set.
+func (r *recordSchedules) get(name string) (string, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	expr, ok := r.exprs[name]
+	return expr, ok
+}
+
+// onChange returns a channel that is closed when a schedule changes.
+func (r *recordSchedules) onChange() chan struct{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.changed
+}
+
+func (r *recordSchedules) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"net"
 	"net/url"
+	gopath "path"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aler9/gortsplib"
@@ -16,13 +18,15 @@ import (
 	"github.com/aler9/gortsplib/pkg/rtpaac"
 	"github.com/aler9/gortsplib/pkg/rtph264"
 	"github.com/notedit/rtmp/av"
+	"github.com/notedit/rtmp/format/flv/flvio"
 	"github.com/pion/rtp"
 
 	"github.com/aler9/rtsp-simple-server/internal/conf"
-	"github.com/aler9/rtsp-simple-server/internal/externalcmd"
 	"github.com/aler9/rtsp-simple-server/internal/logger"
 	"github.com/aler9/rtsp-simple-server/internal/rtcpsenderset"
 	"github.com/aler9/rtsp-simple-server/internal/rtmp"
+	"github.com/aler9/rtsp-simple-server/internal/rtpav1"
+	"github.com/aler9/rtsp-simple-server/internal/rtph265"
 )
 
 const (
@@ -45,6 +49,7 @@ type rtmpConnTrackIDPayloadPair struct {
 type rtmpConnPathManager interface {
 	onReaderSetupPlay(req pathReaderSetupPlayReq) pathReaderSetupPlayRes
 	onPublisherAnnounce(req pathPublisherAnnounceReq) pathPublisherAnnounceRes
+	tenantPathName(host string, name string) string
 }
 
 type rtmpConnParent interface {
@@ -53,6 +58,11 @@ type rtmpConnParent interface {
 }
 
 type rtmpConn struct {
+	// fields accessed atomically must be placed first
+	// in order to be aligned on 32-bit platforms.
+	bytesSent uint64
+	reading   int32
+
 	id                  string
 	rtspAddress         string
 	readTimeout         conf.StringDuration
@@ -60,11 +70,13 @@ type rtmpConn struct {
 	readBufferCount     int
 	runOnConnect        string
 	runOnConnectRestart bool
+	hookStdinJSON       bool
 	wg                  *sync.WaitGroup
 	conn                *rtmp.Conn
 	pathManager         rtmpConnPathManager
 	parent              rtmpConnParent
 
+	created    time.Time
 	ctx        context.Context
 	ctxCancel  func()
 	path       *path
@@ -82,6 +94,7 @@ func newRTMPConn(
 	readBufferCount int,
 	runOnConnect string,
 	runOnConnectRestart bool,
+	hookStdinJSON bool,
 	wg *sync.WaitGroup,
 	nconn net.Conn,
 	pathManager rtmpConnPathManager,
@@ -96,10 +109,12 @@ func newRTMPConn(
 		readBufferCount:     readBufferCount,
 		runOnConnect:        runOnConnect,
 		runOnConnectRestart: runOnConnectRestart,
+		hookStdinJSON:       hookStdinJSON,
 		wg:                  wg,
 		conn:                rtmp.NewServerConn(nconn),
 		pathManager:         pathManager,
 		parent:              parent,
+		created:             time.Now(),
 		ctx:                 ctx,
 		ctxCancel:           ctxCancel,
 	}
@@ -128,7 +143,8 @@ func (c *rtmpConn) RemoteAddr() net.Addr {
 }
 
 func (c *rtmpConn) log(level logger.Level, format string, args ...interface{}) {
-	c.parent.log(level, "[conn %v] "+format, append([]interface{}{c.conn.NetConn().RemoteAddr()}, args...)...)
+	c.parent.log(level, "[conn %v] [session %s] "+format,
+		append([]interface{}{c.conn.NetConn().RemoteAddr(), c.id}, args...)...)
 }
 
 func (c *rtmpConn) ip() net.IP {
@@ -141,22 +157,36 @@ func (c *rtmpConn) safeState() gortsplib.ServerSessionState {
 	return c.state
 }
 
+// apiQuality returns the network quality of a reader.
+// RTMP doesn't provide receiver reports, therefore only the send queue is available.
+func (c *rtmpConn) apiQuality() *readerQualityInfo {
+	if c.safeState() != gortsplib.ServerSessionStateRead {
+		return nil
+	}
+
+	var q *readerQuality
+	info := q.describe(c.conn.NetConn())
+	return &info
+}
+
 func (c *rtmpConn) run() {
 	defer c.wg.Done()
 
 	err := func() error {
 		if c.runOnConnect != "" {
-			c.log(logger.Info, "runOnConnect command started")
 			_, port, _ := net.SplitHostPort(c.rtspAddress)
-			onConnectCmd := externalcmd.New(c.runOnConnect, c.runOnConnectRestart, externalcmd.Environment{
-				Path: "",
-				Port: port,
+			onConnectCmd := hookStart(c.log, "runOnConnect", c.runOnConnect, c.runOnConnectRestart, c.hookStdinJSON, hookEvent{
+				Event:      "connect",
+				Port:       port,
+				RemoteAddr: c.RemoteAddr().String(),
 			})
 
-			defer func() {
-				onConnectCmd.Close()
-				c.log(logger.Info, "runOnConnect command stopped")
-			}()
+			if onConnectCmd != nil {
+				defer func() {
+					onConnectCmd.Close()
+					c.log(logger.Info, "runOnConnect command stopped")
+				}()
+			}
 		}
 
 		ctx, cancel := context.WithCancel(c.ctx)
@@ -184,10 +214,22 @@ func (c *rtmpConn) run() {
 	c.log(logger.Info, "closed (%v)", err)
 }
 
+// applyPathSettings replaces the settings of the server with the ones of the path.
+func (c *rtmpConn) applyPathSettings() {
+	c.readTimeout = c.path.readTimeout
+	c.writeTimeout = c.path.writeTimeout
+	c.readBufferCount = c.path.readBufferCount
+}
+
 func (c *rtmpConn) runInner(ctx context.Context) error {
 	go func() {
 		<-ctx.Done()
-		c.conn.NetConn().Close()
+
+		// readers close the connection by themselves,
+		// after notifying that the stream has ended.
+		if atomic.LoadInt32(&c.reading) == 0 {
+			c.conn.NetConn().Close()
+		}
 	}()
 
 	c.conn.NetConn().SetReadDeadline(time.Now().Add(time.Duration(c.readTimeout)))
@@ -205,10 +247,14 @@ func (c *rtmpConn) runInner(ctx context.Context) error {
 
 func (c *rtmpConn) runRead(ctx context.Context) error {
 	pathName, query := pathNameAndQuery(c.conn.URL())
+	pathName = c.pathManager.tenantPathName(c.conn.URL().Host, pathName)
 
 	res := c.pathManager.onReaderSetupPlay(pathReaderSetupPlayReq{
 		Author:   c,
 		PathName: pathName,
+		Query:    query.Encode(),
+		Protocol: "rtmp",
+		User:     query.Get("user"),
 		IP:       c.ip(),
 		ValidateCredentials: func(pathUser conf.Credential, pathPass conf.Credential) error {
 			return c.validateCredentials(pathUser, pathPass, query)
@@ -225,6 +271,7 @@ func (c *rtmpConn) runRead(ctx context.Context) error {
 	}
 
 	c.path = res.Path
+	c.applyPathSettings()
 
 	defer func() {
 		c.path.onReaderRemove(pathReaderRemoveReq{Author: c})
@@ -268,7 +315,7 @@ func (c *rtmpConn) runRead(ctx context.Context) error {
 	}
 
 	c.conn.NetConn().SetWriteDeadline(time.Now().Add(time.Duration(c.writeTimeout)))
-	c.conn.WriteMetadata(videoTrack, audioTrack)
+	c.conn.WriteMetadata(videoTrack, audioTrack, rtmpConnMetadata(res.Stream, videoTrackID, audioTrackID))
 
 	c.ringBuffer = ringbuffer.New(uint64(c.readBufferCount))
 
@@ -277,21 +324,29 @@ func (c *rtmpConn) runRead(ctx context.Context) error {
 		c.ringBuffer.Close()
 	}()
 
+	atomic.StoreInt32(&c.reading, 1)
+	defer c.conn.NetConn().Close()
+
 	c.path.onReaderPlay(pathReaderPlayReq{
 		Author: c,
 	})
 
 	if c.path.Conf().RunOnRead != "" {
-		c.log(logger.Info, "runOnRead command started")
 		_, port, _ := net.SplitHostPort(c.rtspAddress)
-		onReadCmd := externalcmd.New(c.path.Conf().RunOnRead, c.path.Conf().RunOnReadRestart, externalcmd.Environment{
-			Path: c.path.Name(),
-			Port: port,
+		onReadCmd := hookStart(c.log, "runOnRead", c.path.Conf().RunOnRead, c.path.Conf().RunOnReadRestart, c.hookStdinJSON, hookEvent{
+			Event:      "read",
+			Path:       c.path.Name(),
+			Port:       port,
+			SourceURL:  hookSourceURL(c.path.Conf()),
+			Client:     c.onReaderAPIDescribe(),
+			RemoteAddr: c.RemoteAddr().String(),
 		})
-		defer func() {
-			onReadCmd.Close()
-			c.log(logger.Info, "runOnRead command stopped")
-		}()
+		if onReadCmd != nil {
+			defer func() {
+				onReadCmd.Close()
+				c.log(logger.Info, "runOnRead command stopped")
+			}()
+		}
 	}
 
 	// disable read deadline
@@ -304,6 +359,8 @@ func (c *rtmpConn) runRead(ctx context.Context) error {
 	for {
 		data, ok := c.ringBuffer.Pull()
 		if !ok {
+			c.conn.NetConn().SetWriteDeadline(time.Now().Add(time.Duration(c.writeTimeout)))
+			c.conn.WriteStreamEOF()
 			return fmt.Errorf("terminated")
 		}
 		pair := data.(rtmpConnTrackIDPayloadPair)
@@ -420,7 +477,7 @@ func (c *rtmpConn) runRead(ctx context.Context) error {
 
 func (c *rtmpConn) runPublish(ctx context.Context) error {
 	c.conn.NetConn().SetReadDeadline(time.Now().Add(time.Duration(c.readTimeout)))
-	videoTrack, audioTrack, err := c.conn.ReadMetadata()
+	videoTrack, audioTrack, md, err := c.conn.ReadMetadata()
 	if err != nil {
 		return err
 	}
@@ -430,8 +487,19 @@ func (c *rtmpConn) runPublish(ctx context.Context) error {
 	audioTrackID := -1
 
 	var h264Encoder *rtph264.Encoder
+	var h265Encoder *rtph265.Encoder
+	var av1Encoder *rtpav1.Encoder
 	if videoTrack != nil {
-		h264Encoder = rtph264.NewEncoder(96, nil, nil, nil)
+		switch {
+		case rtph265.IsTrack(videoTrack):
+			h265Encoder = rtph265.NewEncoder(96, nil, nil, nil)
+
+		case rtpav1.IsTrack(videoTrack):
+			av1Encoder = rtpav1.NewEncoder(96, nil, nil, nil)
+
+		default:
+			h264Encoder = rtph264.NewEncoder(96, nil, nil, nil)
+		}
 		videoTrackID = len(tracks)
 		tracks = append(tracks, videoTrack)
 	}
@@ -445,11 +513,17 @@ func (c *rtmpConn) runPublish(ctx context.Context) error {
 	}
 
 	pathName, query := pathNameAndQuery(c.conn.URL())
+	pathName = c.pathManager.tenantPathName(c.conn.URL().Host, pathName)
 
+	// the last part of the URL can be a stream key
+	// (rtmp://host/app/streamkey), that is resolved into a path.
 	res := c.pathManager.onPublisherAnnounce(pathPublisherAnnounceReq{
-		Author:   c,
-		PathName: pathName,
-		IP:       c.ip(),
+		Author:    c,
+		PathName:  pathName,
+		StreamKey: gopath.Base(pathName),
+		Protocol:  "rtmp",
+		User:      query.Get("user"),
+		IP:        c.ip(),
 		ValidateCredentials: func(pathUser conf.Credential, pathPass conf.Credential) error {
 			return c.validateCredentials(pathUser, pathPass, query)
 		},
@@ -464,7 +538,12 @@ func (c *rtmpConn) runPublish(ctx context.Context) error {
 		return res.Err
 	}
 
+	if res.Backchannel != nil {
+		return fmt.Errorf("the backchannel of path '%s' can be used only with RTSP", res.Path.Name())
+	}
+
 	c.path = res.Path
+	c.applyPathSettings()
 
 	defer func() {
 		c.path.onPublisherRemove(pathPublisherRemoveReq{Author: c})
@@ -485,6 +564,8 @@ func (c *rtmpConn) runPublish(ctx context.Context) error {
 		return rres.Err
 	}
 
+	rres.Stream.setRTMPMetadata(md)
+
 	rtcpSenders := rtcpsenderset.New(tracks, rres.Stream.onPacketRTCP)
 	defer rtcpSenders.Close()
 
@@ -501,8 +582,15 @@ func (c *rtmpConn) runPublish(ctx context.Context) error {
 		}
 
 		switch pkt.Type {
+		case av.Metadata:
+			// metadata can be updated during the stream
+			md, err := rtmp.DecodeMetadata(pkt.Data)
+			if err == nil {
+				rres.Stream.setRTMPMetadata(md)
+			}
+
 		case av.H264:
-			if videoTrack == nil {
+			if h264Encoder == nil {
 				return fmt.Errorf("received an H264 packet, but track is not set up")
 			}
 
@@ -546,6 +634,78 @@ func (c *rtmpConn) runPublish(ctx context.Context) error {
 				onPacketRTP(videoTrackID, byts)
 			}
 
+		case rtmp.PacketTypeH265:
+			if h265Encoder == nil {
+				return fmt.Errorf("received an H265 packet, but track is not set up")
+			}
+
+			nalus, err := h264.DecodeAVCC(pkt.Data)
+			if err != nil {
+				return err
+			}
+
+			var outNALUs [][]byte
+
+			for _, nalu := range nalus {
+				if len(nalu) < 2 {
+					continue
+				}
+
+				// remove VPS, SPS, PPS and AUD, not needed by RTSP
+				switch rtph265.NALUTypeOf(nalu) {
+				case rtph265.NALUTypeVPS, rtph265.NALUTypeSPS, rtph265.NALUTypePPS,
+					rtph265.NALUTypeAccessUnitDelimiter:
+					continue
+				}
+
+				outNALUs = append(outNALUs, nalu)
+			}
+
+			if len(outNALUs) == 0 {
+				continue
+			}
+
+			pkts, err := h265Encoder.Encode(outNALUs, pkt.Time+pkt.CTime)
+			if err != nil {
+				return fmt.Errorf("error while encoding H265: %v", err)
+			}
+
+			bytss := make([][]byte, len(pkts))
+			for i, pkt := range pkts {
+				byts, err := pkt.Marshal()
+				if err != nil {
+					return fmt.Errorf("error while encoding H265: %v", err)
+				}
+				bytss[i] = byts
+			}
+
+			for _, byts := range bytss {
+				onPacketRTP(videoTrackID, byts)
+			}
+
+		case rtmp.PacketTypeAV1:
+			if av1Encoder == nil {
+				return fmt.Errorf("received an AV1 packet, but track is not set up")
+			}
+
+			pkts, err := av1Encoder.Encode(pkt.Data, pkt.Time)
+			if err != nil {
+				return fmt.Errorf("error while encoding AV1: %v", err)
+			}
+
+			bytss := make([][]byte, len(pkts))
+			for i, pkt := range pkts {
+				byts, err := pkt.Marshal()
+				if err != nil {
+					return fmt.Errorf("error while encoding AV1: %v", err)
+				}
+				bytss[i] = byts
+			}
+
+			for _, byts := range bytss {
+				onPacketRTP(videoTrackID, byts)
+			}
+
 		case av.AAC:
 			if audioTrack == nil {
 				return fmt.Errorf("received an AAC packet, but track is not set up")
@@ -572,6 +732,58 @@ func (c *rtmpConn) runPublish(ctx context.Context) error {
 	}
 }
 
+// rtmpConnMetadata returns the metadata sent to readers, that is the one sent
+// by the publisher, if any, completed with informations extracted from the stream,
+// since some players refuse to start without them.
+func rtmpConnMetadata(stream *stream, videoTrackID int, audioTrackID int) flvio.AMFMap {
+	ret := append(flvio.AMFMap(nil), stream.getRTMPMetadata()...)
+
+	add := func(k string, v interface{}) {
+		if ret.Get(k) == nil {
+			ret = append(ret, flvio.AMFKv{K: k, V: v})
+		}
+	}
+
+	infos := stream.info.describe(stream.tracks())
+
+	if videoTrackID >= 0 {
+		info := infos[videoTrackID]
+
+		// do not mix the resolution of the publisher with the one of the stream
+		if info.Width != 0 && ret.Get("width") == nil && ret.Get("height") == nil {
+			add("width", float64(info.Width))
+			add("height", float64(info.Height))
+		}
+
+		if info.FPS != 0 {
+			add("framerate", info.FPS)
+		}
+
+		if info.Bitrate != 0 {
+			add("videodatarate", float64(info.Bitrate)/1000)
+		}
+	}
+
+	if audioTrackID >= 0 {
+		info := infos[audioTrackID]
+
+		if info.SampleRate != 0 {
+			add("audiosamplerate", float64(info.SampleRate))
+		}
+
+		if info.ChannelCount != 0 {
+			add("audiochannels", float64(info.ChannelCount))
+			add("stereo", info.ChannelCount >= 2)
+		}
+
+		if info.Bitrate != 0 {
+			add("audiodatarate", float64(info.Bitrate)/1000)
+		}
+	}
+
+	return ret
+}
+
 func (c *rtmpConn) validateCredentials(
 	pathUser conf.Credential,
 	pathPass conf.Credential,
@@ -594,6 +806,7 @@ func (c *rtmpConn) onReaderAccepted() {
 
 // onReaderPacketRTP implements reader.
 func (c *rtmpConn) onReaderPacketRTP(trackID int, payload []byte) {
+	atomic.AddUint64(&c.bytesSent, uint64(len(payload)))
 	c.ringBuffer.Push(rtmpConnTrackIDPayloadPair{trackID, payload})
 }
 
@@ -609,6 +822,21 @@ func (c *rtmpConn) onReaderAPIDescribe() interface{} {
 	}{"rtmpConn", c.id}
 }
 
+// onReaderAPIReadersItem implements reader.
+func (c *rtmpConn) onReaderAPIReadersItem() pathAPIPathsReadersItem {
+	_, query := pathNameAndQuery(c.conn.URL())
+
+	return pathAPIPathsReadersItem{
+		Type:       "rtmpConn",
+		ID:         c.id,
+		Protocol:   "rtmp",
+		RemoteAddr: c.RemoteAddr().String(),
+		User:       query.Get("user"),
+		Created:    c.created,
+		BytesSent:  atomic.LoadUint64(&c.bytesSent),
+	}
+}
+
 // onSourceAPIDescribe implements source.
 func (c *rtmpConn) onSourceAPIDescribe() interface{} {
 	return struct {
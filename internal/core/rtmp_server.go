@@ -16,8 +16,9 @@ import (
 )
 
 type rtmpServerAPIConnsListItem struct {
-	RemoteAddr string `json:"remoteAddr"`
-	State      string `json:"state"`
+	RemoteAddr string             `json:"remoteAddr"`
+	State      string             `json:"state"`
+	Quality    *readerQualityInfo `json:"quality,omitempty"`
 }
 
 type rtmpServerAPIConnsListData struct {
@@ -53,7 +54,9 @@ type rtmpServer struct {
 	rtspAddress         string
 	runOnConnect        string
 	runOnConnectRestart bool
-	metrics             *metrics
+	hookStdinJSON       bool
+	limiter             *limiter
+	bans                *banList
 	pathManager         *pathManager
 	parent              rtmpServerParent
 
@@ -72,16 +75,22 @@ type rtmpServer struct {
 func newRTMPServer(
 	parentCtx context.Context,
 	address string,
+	ipv6Disable bool,
+	listenReusePort bool,
+	proxyProtocol bool,
+	proxyProtocolTrustedProxies conf.IPsOrNets,
 	readTimeout conf.StringDuration,
 	writeTimeout conf.StringDuration,
 	readBufferCount int,
 	rtspAddress string,
 	runOnConnect string,
 	runOnConnectRestart bool,
-	metrics *metrics,
+	hookStdinJSON bool,
+	limiter *limiter,
+	bans *banList,
 	pathManager *pathManager,
 	parent rtmpServerParent) (*rtmpServer, error) {
-	l, err := net.Listen("tcp", address)
+	l, err := listenTCP(address, ipv6Disable, listenReusePort, proxyProtocol, proxyProtocolTrustedProxies)
 	if err != nil {
 		return nil, err
 	}
@@ -95,7 +104,9 @@ func newRTMPServer(
 		rtspAddress:         rtspAddress,
 		runOnConnect:        runOnConnect,
 		runOnConnectRestart: runOnConnectRestart,
-		metrics:             metrics,
+		hookStdinJSON:       hookStdinJSON,
+		limiter:             limiter,
+		bans:                bans,
 		pathManager:         pathManager,
 		parent:              parent,
 		ctx:                 ctx,
@@ -109,10 +120,6 @@ func newRTMPServer(
 
 	s.log(logger.Info, "listener opened on %s", address)
 
-	if s.metrics != nil {
-		s.metrics.onRTMPServerSet(s)
-	}
-
 	s.wg.Add(1)
 	go s.run()
 
@@ -129,6 +136,11 @@ func (s *rtmpServer) close() {
 	s.log(logger.Info, "listener closed")
 }
 
+// onDrain is called by core.
+func (s *rtmpServer) onDrain() {
+	handOverListener(s.l)
+}
+
 func (s *rtmpServer) run() {
 	defer s.wg.Done()
 
@@ -166,6 +178,34 @@ outer:
 			break outer
 
 		case nconn := <-connNew:
+			// RTMP doesn't provide a way to reply with an error
+			// before the handshake, therefore connections are closed.
+			if s.bans.isBanned(nconn.RemoteAddr().(*net.TCPAddr).IP) {
+				s.log(logger.Warn, "connection from %v rejected: IP is banned", nconn.RemoteAddr())
+				nconn.Close()
+				continue
+			}
+
+			if !s.limiter.allowConnection(nconn.RemoteAddr().(*net.TCPAddr).IP) {
+				s.log(logger.Warn, "connection from %v rejected: too many connections from the same IP", nconn.RemoteAddr())
+				nconn.Close()
+				continue
+			}
+
+			if !s.limiter.addConnection() {
+				s.log(logger.Warn, "connection from %v rejected: too many connections", nconn.RemoteAddr())
+				nconn.Close()
+				continue
+			}
+
+			// an RTMP connection is also a session
+			if !s.limiter.addSession() {
+				s.limiter.removeConnection()
+				s.log(logger.Warn, "connection from %v rejected: too many sessions", nconn.RemoteAddr())
+				nconn.Close()
+				continue
+			}
+
 			id, _ := s.newConnID()
 
 			c := newRTMPConn(
@@ -177,6 +217,7 @@ outer:
 				s.readBufferCount,
 				s.runOnConnect,
 				s.runOnConnectRestart,
+				s.hookStdinJSON,
 				&s.wg,
 				nconn,
 				s.pathManager,
@@ -187,7 +228,7 @@ outer:
 			if _, ok := s.conns[c]; !ok {
 				continue
 			}
-			delete(s.conns, c)
+			s.deleteConn(c)
 
 		case req := <-s.apiConnsList:
 			data := &rtmpServerAPIConnsListData{
@@ -207,6 +248,7 @@ outer:
 						}
 						return "idle"
 					}(),
+					Quality: c.apiQuality(),
 				}
 			}
 
@@ -216,7 +258,7 @@ outer:
 			res := func() bool {
 				for c := range s.conns {
 					if c.ID() == req.ID {
-						delete(s.conns, c)
+						s.deleteConn(c)
 						c.close()
 						return true
 					}
@@ -238,11 +280,17 @@ outer:
 
 	s.l.Close()
 
-	if s.metrics != nil {
-		s.metrics.onRTMPServerSet(s)
+	for c := range s.conns {
+		s.deleteConn(c)
 	}
 }
 
+func (s *rtmpServer) deleteConn(c *rtmpConn) {
+	delete(s.conns, c)
+	s.limiter.removeSession()
+	s.limiter.removeConnection()
+}
+
 func (s *rtmpServer) newConnID() (string, error) {
 	for {
 		b := make([]byte, 4)
@@ -4,7 +4,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aler9/gortsplib"
+	"github.com/notedit/rtmp/format/flv/flvio"
 	"github.com/stretchr/testify/require"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
 )
 
 func TestRTMPServerPublish(t *testing.T) {
@@ -147,6 +151,41 @@ func TestRTMPServerAuth(t *testing.T) {
 		defer cnt2.close()
 		require.Equal(t, 0, cnt2.wait())
 	})
+
+	t.Run("streamkey", func(t *testing.T) {
+		p, ok := newInstance("rtspDisable: yes\n" +
+			"hlsDisable: yes\n" +
+			"paths:\n" +
+			"  teststream:\n" +
+			"    publishUser: testuser\n" +
+			"    publishPass: testpass\n" +
+			"    publishStreamKey: k8c1x0a9\n")
+		require.Equal(t, true, ok)
+		defer p.close()
+
+		cnt1, err := newContainer("ffmpeg", "source", []string{
+			"-re",
+			"-stream_loop", "-1",
+			"-i", "emptyvideo.mkv",
+			"-c", "copy",
+			"-f", "flv",
+			"rtmp://localhost/live/k8c1x0a9",
+		})
+		require.NoError(t, err)
+		defer cnt1.close()
+
+		time.Sleep(1 * time.Second)
+
+		cnt2, err := newContainer("ffmpeg", "dest", []string{
+			"-i", "rtmp://127.0.0.1/teststream",
+			"-vframes", "1",
+			"-f", "image2",
+			"-y", "/dev/null",
+		})
+		require.NoError(t, err)
+		defer cnt2.close()
+		require.Equal(t, 0, cnt2.wait())
+	})
 }
 
 func TestRTMPServerAuthFail(t *testing.T) {
@@ -218,3 +257,50 @@ func TestRTMPServerAuthFail(t *testing.T) {
 		require.NotEqual(t, 0, cnt2.wait())
 	})
 }
+
+func TestRTMPConnMetadata(t *testing.T) {
+	videoTrack, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{
+			SPS: []byte{
+				0x67, 0x64, 0x00, 0x1f, 0xac, 0xd9, 0x40, 0x50,
+				0x05, 0xbb, 0x01, 0x6c, 0x80, 0x00, 0x00, 0x03,
+				0x00, 0x80, 0x00, 0x00, 0x1e, 0x07, 0x8c, 0x18,
+				0xcb,
+			},
+			PPS: []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0},
+		})
+	require.NoError(t, err)
+
+	audioTrack, err := gortsplib.NewTrackAAC(96, &gortsplib.TrackConfigAAC{
+		Type:         2,
+		SampleRate:   44100,
+		ChannelCount: 2,
+	})
+	require.NoError(t, err)
+
+	s := newStream(gortsplib.Tracks{videoTrack, audioTrack}, &conf.PathConf{}, nil)
+	defer s.close()
+
+	// stream originating from RTSP
+	require.Equal(t, flvio.AMFMap{
+		{K: "width", V: float64(1280)},
+		{K: "height", V: float64(720)},
+		{K: "audiosamplerate", V: float64(44100)},
+		{K: "audiochannels", V: float64(2)},
+		{K: "stereo", V: true},
+	}, rtmpConnMetadata(s, 0, 1))
+
+	// stream originating from RTMP
+	s.setRTMPMetadata(flvio.AMFMap{
+		{K: "encoder", V: "obs-output module"},
+		{K: "width", V: float64(1920)},
+	})
+
+	require.Equal(t, flvio.AMFMap{
+		{K: "encoder", V: "obs-output module"},
+		{K: "width", V: float64(1920)},
+		{K: "audiosamplerate", V: float64(44100)},
+		{K: "audiochannels", V: float64(2)},
+		{K: "stereo", V: true},
+	}, rtmpConnMetadata(s, 0, 1))
+}
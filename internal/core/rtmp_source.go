@@ -16,10 +16,8 @@ import (
 	"github.com/aler9/rtsp-simple-server/internal/logger"
 	"github.com/aler9/rtsp-simple-server/internal/rtcpsenderset"
 	"github.com/aler9/rtsp-simple-server/internal/rtmp"
-)
-
-const (
-	rtmpSourceRetryPause = 5 * time.Second
+	"github.com/aler9/rtsp-simple-server/internal/rtpav1"
+	"github.com/aler9/rtsp-simple-server/internal/rtph265"
 )
 
 type rtmpSourceParent interface {
@@ -32,6 +30,7 @@ type rtmpSource struct {
 	ur           string
 	readTimeout  conf.StringDuration
 	writeTimeout conf.StringDuration
+	retry        *sourceRetry
 	wg           *sync.WaitGroup
 	parent       rtmpSourceParent
 
@@ -44,6 +43,7 @@ func newRTMPSource(
 	ur string,
 	readTimeout conf.StringDuration,
 	writeTimeout conf.StringDuration,
+	retry *sourceRetry,
 	wg *sync.WaitGroup,
 	parent rtmpSourceParent) *rtmpSource {
 	ctx, ctxCancel := context.WithCancel(parentCtx)
@@ -52,6 +52,7 @@ func newRTMPSource(
 		ur:           ur,
 		readTimeout:  readTimeout,
 		writeTimeout: writeTimeout,
+		retry:        retry,
 		wg:           wg,
 		parent:       parent,
 		ctx:          ctx,
@@ -86,8 +87,14 @@ outer:
 			break outer
 		}
 
+		pause, ok := s.retry.onFailure()
+		if !ok {
+			s.log(logger.Info, "too many consecutive failures, giving up")
+			break outer
+		}
+
 		select {
-		case <-time.After(rtmpSourceRetryPause):
+		case <-time.After(pause):
 		case <-s.ctx.Done():
 			break outer
 		}
@@ -125,7 +132,7 @@ func (s *rtmpSource) runInner() bool {
 					conn.NetConn().SetWriteDeadline(time.Time{})
 
 					conn.NetConn().SetReadDeadline(time.Now().Add(time.Duration(s.readTimeout)))
-					videoTrack, audioTrack, err := conn.ReadMetadata()
+					videoTrack, audioTrack, md, err := conn.ReadMetadata()
 					if err != nil {
 						return err
 					}
@@ -135,8 +142,19 @@ func (s *rtmpSource) runInner() bool {
 					audioTrackID := -1
 
 					var h264Encoder *rtph264.Encoder
+					var h265Encoder *rtph265.Encoder
+					var av1Encoder *rtpav1.Encoder
 					if videoTrack != nil {
-						h264Encoder = rtph264.NewEncoder(96, nil, nil, nil)
+						switch {
+						case rtph265.IsTrack(videoTrack):
+							h265Encoder = rtph265.NewEncoder(96, nil, nil, nil)
+
+						case rtpav1.IsTrack(videoTrack):
+							av1Encoder = rtpav1.NewEncoder(96, nil, nil, nil)
+
+						default:
+							h264Encoder = rtph264.NewEncoder(96, nil, nil, nil)
+						}
 						videoTrackID = len(tracks)
 						tracks = append(tracks, videoTrack)
 					}
@@ -158,11 +176,14 @@ func (s *rtmpSource) runInner() bool {
 					}
 
 					s.log(logger.Info, "ready")
+					s.retry.onSuccess()
 
 					defer func() {
 						s.parent.OnSourceStaticSetNotReady(pathSourceStaticSetNotReadyReq{Source: s})
 					}()
 
+					res.Stream.setRTMPMetadata(md)
+
 					rtcpSenders := rtcpsenderset.New(tracks, res.Stream.onPacketRTCP)
 					defer rtcpSenders.Close()
 
@@ -179,8 +200,14 @@ func (s *rtmpSource) runInner() bool {
 						}
 
 						switch pkt.Type {
+						case av.Metadata:
+							md, err := rtmp.DecodeMetadata(pkt.Data)
+							if err == nil {
+								res.Stream.setRTMPMetadata(md)
+							}
+
 						case av.H264:
-							if videoTrack == nil {
+							if h264Encoder == nil {
 								return fmt.Errorf("received an H264 packet, but track is not set up")
 							}
 
@@ -219,6 +246,78 @@ func (s *rtmpSource) runInner() bool {
 								onPacketRTP(videoTrackID, byts)
 							}
 
+						case rtmp.PacketTypeH265:
+							if h265Encoder == nil {
+								return fmt.Errorf("received an H265 packet, but track is not set up")
+							}
+
+							nalus, err := h264.DecodeAVCC(pkt.Data)
+							if err != nil {
+								return err
+							}
+
+							var outNALUs [][]byte
+
+							for _, nalu := range nalus {
+								if len(nalu) < 2 {
+									continue
+								}
+
+								// remove VPS, SPS, PPS and AUD, not needed by RTSP / RTMP
+								switch rtph265.NALUTypeOf(nalu) {
+								case rtph265.NALUTypeVPS, rtph265.NALUTypeSPS, rtph265.NALUTypePPS,
+									rtph265.NALUTypeAccessUnitDelimiter:
+									continue
+								}
+
+								outNALUs = append(outNALUs, nalu)
+							}
+
+							if len(outNALUs) == 0 {
+								continue
+							}
+
+							pkts, err := h265Encoder.Encode(outNALUs, pkt.Time+pkt.CTime)
+							if err != nil {
+								return fmt.Errorf("error while encoding H265: %v", err)
+							}
+
+							bytss := make([][]byte, len(pkts))
+							for i, pkt := range pkts {
+								byts, err := pkt.Marshal()
+								if err != nil {
+									return fmt.Errorf("error while encoding H265: %v", err)
+								}
+								bytss[i] = byts
+							}
+
+							for _, byts := range bytss {
+								onPacketRTP(videoTrackID, byts)
+							}
+
+						case rtmp.PacketTypeAV1:
+							if av1Encoder == nil {
+								return fmt.Errorf("received an AV1 packet, but track is not set up")
+							}
+
+							pkts, err := av1Encoder.Encode(pkt.Data, pkt.Time)
+							if err != nil {
+								return fmt.Errorf("error while encoding AV1: %v", err)
+							}
+
+							bytss := make([][]byte, len(pkts))
+							for i, pkt := range pkts {
+								byts, err := pkt.Marshal()
+								if err != nil {
+									return fmt.Errorf("error while encoding AV1: %v", err)
+								}
+								bytss[i] = byts
+							}
+
+							for _, byts := range bytss {
+								onPacketRTP(videoTrackID, byts)
+							}
+
 						case av.AAC:
 							if audioTrack == nil {
 								return fmt.Errorf("received an AAC packet, but track is not set up")
@@ -2,7 +2,9 @@ package core
 
 import (
 	"errors"
+	"math"
 	"net"
+	"strconv"
 	"time"
 
 	"github.com/aler9/gortsplib"
@@ -24,11 +26,13 @@ type rtspConnParent interface {
 }
 
 type rtspConn struct {
+	isTLS               bool
 	rtspAddress         string
 	authMethods         []headers.AuthMethod
 	readTimeout         conf.StringDuration
 	runOnConnect        string
 	runOnConnectRestart bool
+	hookStdinJSON       bool
 	pathManager         *pathManager
 	conn                *gortsplib.ServerConn
 	parent              rtspConnParent
@@ -38,23 +42,29 @@ type rtspConn struct {
 	authPass      string
 	authValidator *auth.Validator
 	authFailures  int
+	rejected      bool
+	banned        bool
 }
 
 func newRTSPConn(
+	isTLS bool,
 	rtspAddress string,
 	authMethods []headers.AuthMethod,
 	readTimeout conf.StringDuration,
 	runOnConnect string,
 	runOnConnectRestart bool,
+	hookStdinJSON bool,
 	pathManager *pathManager,
 	conn *gortsplib.ServerConn,
 	parent rtspConnParent) *rtspConn {
 	c := &rtspConn{
+		isTLS:               isTLS,
 		rtspAddress:         rtspAddress,
 		authMethods:         authMethods,
 		readTimeout:         readTimeout,
 		runOnConnect:        runOnConnect,
 		runOnConnectRestart: runOnConnectRestart,
+		hookStdinJSON:       hookStdinJSON,
 		pathManager:         pathManager,
 		conn:                conn,
 		parent:              parent,
@@ -63,11 +73,11 @@ func newRTSPConn(
 	c.log(logger.Info, "opened")
 
 	if c.runOnConnect != "" {
-		c.log(logger.Info, "runOnConnect command started")
 		_, port, _ := net.SplitHostPort(c.rtspAddress)
-		c.onConnectCmd = externalcmd.New(c.runOnConnect, c.runOnConnectRestart, externalcmd.Environment{
-			Path: "",
-			Port: port,
+		c.onConnectCmd = hookStart(c.log, "runOnConnect", c.runOnConnect, c.runOnConnectRestart, c.hookStdinJSON, hookEvent{
+			Event:      "connect",
+			Port:       port,
+			RemoteAddr: c.conn.NetConn().RemoteAddr().String(),
 		})
 	}
 
@@ -87,6 +97,31 @@ func (c *rtspConn) ip() net.IP {
 	return c.conn.NetConn().RemoteAddr().(*net.TCPAddr).IP
 }
 
+func (c *rtspConn) protocol() string {
+	if c.isTLS {
+		return "rtsps"
+	}
+	return "rtsp"
+}
+
+// requestUser returns the user that is provided in the Authorization header of a request, if any.
+func requestUser(req *base.Request) string {
+	var h headers.Authorization
+	err := h.Read(req.Header["Authorization"])
+	if err != nil {
+		return ""
+	}
+
+	if h.Method == headers.AuthBasic {
+		return h.BasicUser
+	}
+
+	if h.DigestValues.Username != nil {
+		return *h.DigestValues.Username
+	}
+	return ""
+}
+
 func (c *rtspConn) validateCredentials(
 	pathUser conf.Credential,
 	pathPass conf.Credential,
@@ -122,7 +157,13 @@ func (c *rtspConn) validateCredentials(
 			c.log(logger.Debug, "WARN: unauthorized: %s", err)
 		}
 
+		var message string
+		if _, ok := req.Header["Authorization"]; ok {
+			message = "unauthorized: " + err.Error()
+		}
+
 		return pathErrAuthNotCritical{
+			Message: message,
 			Response: &base.Response{
 				StatusCode: base.StatusUnauthorized,
 				Header: base.Header{
@@ -162,8 +203,11 @@ func (c *rtspConn) OnResponse(res *base.Response) {
 func (c *rtspConn) onDescribe(ctx *gortsplib.ServerHandlerOnDescribeCtx,
 ) (*base.Response, *gortsplib.ServerStream, error) {
 	res := c.pathManager.onDescribe(pathDescribeReq{
-		PathName: ctx.Path,
+		PathName: c.pathManager.tenantPathName(ctx.Req.URL.Host, ctx.Path),
+		Query:    ctx.Query,
 		URL:      ctx.Req.URL,
+		Protocol: c.protocol(),
+		User:     requestUser(ctx.Req),
 		IP:       c.ip(),
 		ValidateCredentials: func(pathUser conf.Credential, pathPass conf.Credential) error {
 			return c.validateCredentials(pathUser, pathPass, ctx.Req)
@@ -181,11 +225,29 @@ func (c *rtspConn) onDescribe(ctx *gortsplib.ServerHandlerOnDescribeCtx,
 
 			return terr.Response, nil, errors.New(terr.Message)
 
-		case pathErrNoOnePublishing:
+		case pathErrNoOnePublishing, pathErrDisabled:
 			return &base.Response{
 				StatusCode: base.StatusNotFound,
 			}, nil, res.Err
 
+		case pathErrQuotaExceeded:
+			return &base.Response{
+				StatusCode: base.StatusNotEnoughBandwidth,
+			}, nil, res.Err
+
+		case pathErrDraining:
+			return &base.Response{
+				StatusCode: base.StatusServiceUnavailable,
+			}, nil, res.Err
+
+		case pathErrSourceNotReady:
+			return &base.Response{
+				StatusCode: base.StatusServiceUnavailable,
+				Header: base.Header{
+					"Retry-After": base.HeaderValue{strconv.FormatInt(int64(math.Ceil(terr.RetryAfter.Seconds())), 10)},
+				},
+			}, nil, res.Err
+
 		default:
 			return &base.Response{
 				StatusCode: base.StatusBadRequest,
@@ -202,6 +264,13 @@ func (c *rtspConn) onDescribe(ctx *gortsplib.ServerHandlerOnDescribeCtx,
 		}, nil, nil
 	}
 
+	if res.Stream.srtp != nil {
+		return &base.Response{
+			StatusCode: base.StatusOK,
+			Body:       res.Stream.srtp.sdp(res.Stream.rtspStream.Tracks()),
+		}, nil, nil
+	}
+
 	return &base.Response{
 		StatusCode: base.StatusOK,
 	}, res.Stream.rtspStream, nil
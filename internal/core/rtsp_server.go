@@ -6,6 +6,7 @@ import (
 	"crypto/tls"
 	"encoding/binary"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 	"sync"
@@ -21,8 +22,9 @@ import (
 )
 
 type rtspServerAPISessionsListItem struct {
-	RemoteAddr string `json:"remoteAddr"`
-	State      string `json:"state"`
+	RemoteAddr string             `json:"remoteAddr"`
+	State      string             `json:"state"`
+	Quality    *readerQualityInfo `json:"quality,omitempty"`
 }
 
 type rtspServerAPISessionsListData struct {
@@ -56,7 +58,9 @@ type rtspServer struct {
 	protocols           map[conf.Protocol]struct{}
 	runOnConnect        string
 	runOnConnectRestart bool
-	metrics             *metrics
+	hookStdinJSON       bool
+	limiter             *limiter
+	bans                *banList
 	pathManager         *pathManager
 	parent              rtspServerParent
 
@@ -64,14 +68,21 @@ type rtspServer struct {
 	ctxCancel func()
 	wg        sync.WaitGroup
 	srv       *gortsplib.Server
+	ln        net.Listener
 	mutex     sync.RWMutex
 	conns     map[*gortsplib.ServerConn]*rtspConn
 	sessions  map[*gortsplib.ServerSession]*rtspSession
+	setupTime *histogram
+	udpPorts  []int
 }
 
 func newRTSPServer(
 	parentCtx context.Context,
 	address string,
+	ipv6Disable bool,
+	listenReusePort bool,
+	proxyProtocol bool,
+	proxyProtocolTrustedProxies conf.IPsOrNets,
 	authMethods []headers.AuthMethod,
 	readTimeout conf.StringDuration,
 	writeTimeout conf.StringDuration,
@@ -85,30 +96,36 @@ func newRTSPServer(
 	multicastRTPPort int,
 	multicastRTCPPort int,
 	isTLS bool,
-	serverCert string,
-	serverKey string,
+	tlsConfig *tls.Config,
 	rtspAddress string,
 	protocols map[conf.Protocol]struct{},
 	runOnConnect string,
 	runOnConnectRestart bool,
-	metrics *metrics,
+	hookStdinJSON bool,
+	limiter *limiter,
+	bans *banList,
 	pathManager *pathManager,
 	parent rtspServerParent) (*rtspServer, error) {
 	ctx, ctxCancel := context.WithCancel(parentCtx)
 
 	s := &rtspServer{
-		authMethods: authMethods,
-		readTimeout: readTimeout,
-		isTLS:       isTLS,
-		rtspAddress: rtspAddress,
-		protocols:   protocols,
-		metrics:     metrics,
-		pathManager: pathManager,
-		parent:      parent,
-		ctx:         ctx,
-		ctxCancel:   ctxCancel,
-		conns:       make(map[*gortsplib.ServerConn]*rtspConn),
-		sessions:    make(map[*gortsplib.ServerSession]*rtspSession),
+		authMethods:         authMethods,
+		readTimeout:         readTimeout,
+		isTLS:               isTLS,
+		rtspAddress:         rtspAddress,
+		protocols:           protocols,
+		runOnConnect:        runOnConnect,
+		runOnConnectRestart: runOnConnectRestart,
+		hookStdinJSON:       hookStdinJSON,
+		limiter:             limiter,
+		bans:                bans,
+		pathManager:         pathManager,
+		parent:              parent,
+		ctx:                 ctx,
+		ctxCancel:           ctxCancel,
+		conns:               make(map[*gortsplib.ServerConn]*rtspConn),
+		sessions:            make(map[*gortsplib.ServerSession]*rtspSession),
+		setupTime:           newHistogram(histogramLatencyBuckets),
 	}
 
 	s.srv = &gortsplib.Server{
@@ -120,9 +137,26 @@ func newRTSPServer(
 		RTSPAddress:     address,
 	}
 
+	s.srv.Listen = func(network string, address string) (net.Listener, error) {
+		ln, err := listenTCP(address, ipv6Disable, listenReusePort, proxyProtocol, proxyProtocolTrustedProxies)
+		s.ln = ln
+		return ln, err
+	}
+
+	s.srv.ListenPacket = func(network string, address string) (net.PacketConn, error) {
+		return listenUDP(address, ipv6Disable)
+	}
+
 	if useUDP {
 		s.srv.UDPRTPAddress = rtpAddress
 		s.srv.UDPRTCPAddress = rtcpAddress
+
+		for _, addr := range []string{rtpAddress, rtcpAddress} {
+			_, tmp, _ := net.SplitHostPort(addr)
+			if port, err := strconv.Atoi(tmp); err == nil {
+				s.udpPorts = append(s.udpPorts, port)
+			}
+		}
 	}
 
 	if useMulticast {
@@ -132,12 +166,7 @@ func newRTSPServer(
 	}
 
 	if isTLS {
-		cert, err := tls.LoadX509KeyPair(serverCert, serverKey)
-		if err != nil {
-			return nil, err
-		}
-
-		s.srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		s.srv.TLSConfig = tlsConfig
 	}
 
 	err := s.srv.Start()
@@ -159,14 +188,6 @@ func newRTSPServer(
 
 	s.log(logger.Info, "listener opened on "+strings.Join(temp, ", "))
 
-	if s.metrics != nil {
-		if !isTLS {
-			s.metrics.onRTSPServerSet(s)
-		} else {
-			s.metrics.onRTSPSServerSet(s)
-		}
-	}
-
 	s.wg.Add(1)
 	go s.run()
 
@@ -189,6 +210,11 @@ func (s *rtspServer) close() {
 	s.log(logger.Info, "listener closed")
 }
 
+// onDrain is called by core.
+func (s *rtspServer) onDrain() {
+	handOverListener(s.ln)
+}
+
 func (s *rtspServer) run() {
 	defer s.wg.Done()
 
@@ -210,14 +236,6 @@ outer:
 	}
 
 	s.ctxCancel()
-
-	if s.metrics != nil {
-		if !s.isTLS {
-			s.metrics.onRTSPServerSet(nil)
-		} else {
-			s.metrics.onRTSPSServerSet(nil)
-		}
-	}
 }
 
 func (s *rtspServer) newSessionID() (string, error) {
@@ -251,15 +269,34 @@ func (s *rtspServer) newSessionID() (string, error) {
 // OnConnOpen implements gortsplib.ServerHandlerOnConnOpen.
 func (s *rtspServer) OnConnOpen(ctx *gortsplib.ServerHandlerOnConnOpenCtx) {
 	c := newRTSPConn(
+		s.isTLS,
 		s.rtspAddress,
 		s.authMethods,
 		s.readTimeout,
 		s.runOnConnect,
 		s.runOnConnectRestart,
+		s.hookStdinJSON,
 		s.pathManager,
 		ctx.Conn,
 		s)
 
+	// banned connections and connections beyond the limit
+	// are kept open in order to reply with an error
+	switch {
+	case s.bans.isBanned(c.ip()):
+		c.rejected = true
+		c.banned = true
+		c.log(logger.Warn, "rejected: IP is banned")
+
+	case !s.limiter.allowConnection(c.ip()):
+		c.rejected = true
+		c.log(logger.Warn, "rejected: too many connections from the same IP")
+
+	case !s.limiter.addConnection():
+		c.rejected = true
+		c.log(logger.Warn, "rejected: too many connections")
+	}
+
 	s.mutex.Lock()
 	s.conns[ctx.Conn] = c
 	s.mutex.Unlock()
@@ -272,6 +309,10 @@ func (s *rtspServer) OnConnClose(ctx *gortsplib.ServerHandlerOnConnCloseCtx) {
 	delete(s.conns, ctx.Conn)
 	s.mutex.Unlock()
 
+	if !c.rejected {
+		s.limiter.removeConnection()
+	}
+
 	c.onClose(ctx.Error)
 }
 
@@ -303,12 +344,18 @@ func (s *rtspServer) OnSessionOpen(ctx *gortsplib.ServerHandlerOnSessionOpenCtx)
 		s.isTLS,
 		s.rtspAddress,
 		s.protocols,
+		s.hookStdinJSON,
 		id,
 		ctx.Session,
 		ctx.Conn,
 		s.pathManager,
 		s)
 
+	if !s.limiter.addSession() {
+		se.rejected = true
+		se.log(logger.Warn, "rejected: too many sessions")
+	}
+
 	s.sessions[ctx.Session] = se
 	s.mutex.Unlock()
 }
@@ -321,6 +368,10 @@ func (s *rtspServer) OnSessionClose(ctx *gortsplib.ServerHandlerOnSessionCloseCt
 	s.mutex.Unlock()
 
 	if se != nil {
+		if !se.rejected {
+			s.limiter.removeSession()
+		}
+
 		se.onClose(ctx.Error)
 	}
 }
@@ -331,6 +382,11 @@ func (s *rtspServer) OnDescribe(ctx *gortsplib.ServerHandlerOnDescribeCtx,
 	s.mutex.RLock()
 	c := s.conns[ctx.Conn]
 	s.mutex.RUnlock()
+
+	if res := s.checkLimits(c, nil); res != nil {
+		return res, nil, nil
+	}
+
 	return c.onDescribe(ctx)
 }
 
@@ -340,6 +396,11 @@ func (s *rtspServer) OnAnnounce(ctx *gortsplib.ServerHandlerOnAnnounceCtx) (*bas
 	c := s.conns[ctx.Conn]
 	se := s.sessions[ctx.Session]
 	s.mutex.RUnlock()
+
+	if res := s.checkLimits(c, se); res != nil {
+		return res, nil
+	}
+
 	return se.onAnnounce(c, ctx)
 }
 
@@ -349,9 +410,38 @@ func (s *rtspServer) OnSetup(ctx *gortsplib.ServerHandlerOnSetupCtx) (*base.Resp
 	c := s.conns[ctx.Conn]
 	se := s.sessions[ctx.Session]
 	s.mutex.RUnlock()
+
+	if res := s.checkLimits(c, se); res != nil {
+		return res, nil, nil
+	}
+
 	return se.onSetup(c, ctx)
 }
 
+// checkLimits returns the response sent to connections and sessions
+// that have been rejected by the limiter or by the ban list, or nil.
+func (s *rtspServer) checkLimits(c *rtspConn, se *rtspSession) *base.Response {
+	if c.banned {
+		return &base.Response{
+			StatusCode: base.StatusForbidden,
+		}
+	}
+
+	if c.rejected {
+		return &base.Response{
+			StatusCode: base.StatusServiceUnavailable,
+		}
+	}
+
+	if se != nil && se.rejected {
+		return &base.Response{
+			StatusCode: base.StatusSessionNotFound,
+		}
+	}
+
+	return nil
+}
+
 // OnPlay implements gortsplib.ServerHandlerOnPlay.
 func (s *rtspServer) OnPlay(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
 	s.mutex.RLock()
@@ -376,6 +466,51 @@ func (s *rtspServer) OnPause(ctx *gortsplib.ServerHandlerOnPauseCtx) (*base.Resp
 	return se.onPause(ctx)
 }
 
+// OnGetParameter implements gortsplib.ServerHandlerOnGetParameter.
+func (s *rtspServer) OnGetParameter(ctx *gortsplib.ServerHandlerOnGetParameterCtx) (*base.Response, error) {
+	// GET_PARAMETER without a body is used as a keepalive
+	if len(ctx.Req.Body) != 0 {
+		s.mutex.RLock()
+		se := s.sessions[ctx.Session]
+		s.mutex.RUnlock()
+
+		if se != nil {
+			return se.onParameter(ctx.Req)
+		}
+	}
+
+	return &base.Response{
+		StatusCode: base.StatusOK,
+		Header: base.Header{
+			"Content-Type": base.HeaderValue{"text/parameters"},
+		},
+		Body: []byte{},
+	}, nil
+}
+
+// OnSetParameter implements gortsplib.ServerHandlerOnSetParameter.
+func (s *rtspServer) OnSetParameter(ctx *gortsplib.ServerHandlerOnSetParameterCtx) (*base.Response, error) {
+	// the session is not provided by gortsplib; use the session
+	// that has been opened by the connection.
+	s.mutex.RLock()
+	var se *rtspSession
+	for _, cur := range s.sessions {
+		if cur.author == ctx.Conn {
+			se = cur
+			break
+		}
+	}
+	s.mutex.RUnlock()
+
+	if se == nil {
+		return &base.Response{
+			StatusCode: base.StatusNotImplemented,
+		}, nil
+	}
+
+	return se.onParameter(ctx.Req)
+}
+
 // OnPacketRTP implements gortsplib.ServerHandlerOnPacket.
 func (s *rtspServer) OnPacketRTP(ctx *gortsplib.ServerHandlerOnPacketRTPCtx) {
 	s.mutex.RLock()
@@ -393,6 +528,36 @@ func (s *rtspServer) OnPacketRTCP(ctx *gortsplib.ServerHandlerOnPacketRTCPCtx) {
 }
 
 // onAPISessionsList is called by api and metrics.
+// onSessionSetupDone is called by rtspSession.
+func (s *rtspServer) onSessionSetupDone(d time.Duration) {
+	s.setupTime.observe(d.Seconds())
+}
+
+// udpDrops returns the packets dropped by the UDP sockets of the server,
+// that are shared by all the sessions that use the UDP transport protocol.
+// It is called by rtspSession and metrics.
+func (s *rtspServer) udpDrops() (uint64, bool) {
+	var ret uint64
+	found := false
+
+	for _, port := range s.udpPorts {
+		if n, ok := udpDrops(port); ok {
+			ret += n
+			found = true
+		}
+	}
+
+	return ret, found
+}
+
+// onMetricsHistograms is called by metrics.
+func (s *rtspServer) onMetricsHistograms() string {
+	if s.isTLS {
+		return metricHistogram("rtsps_session_setup_duration_seconds", "", s.setupTime)
+	}
+	return metricHistogram("rtsp_session_setup_duration_seconds", "", s.setupTime)
+}
+
 func (s *rtspServer) onAPISessionsList(req rtspServerAPISessionsListReq) rtspServerAPISessionsListRes {
 	select {
 	case <-s.ctx.Done():
@@ -422,6 +587,7 @@ func (s *rtspServer) onAPISessionsList(req rtspServerAPISessionsListReq) rtspSer
 				}
 				return "idle"
 			}(),
+			Quality: s.apiQuality(),
 		}
 	}
 
@@ -22,49 +22,65 @@ const (
 type rtspSessionPathManager interface {
 	onPublisherAnnounce(req pathPublisherAnnounceReq) pathPublisherAnnounceRes
 	onReaderSetupPlay(req pathReaderSetupPlayReq) pathReaderSetupPlayRes
+	tenantPathName(host string, name string) string
 }
 
 type rtspSessionParent interface {
 	log(logger.Level, string, ...interface{})
+	onSessionSetupDone(time.Duration)
+	udpDrops() (uint64, bool)
 }
 
 type rtspSession struct {
-	isTLS       bool
-	rtspAddress string
-	protocols   map[conf.Protocol]struct{}
-	id          string
-	ss          *gortsplib.ServerSession
-	author      *gortsplib.ServerConn
-	pathManager rtspSessionPathManager
-	parent      rtspSessionParent
-
+	isTLS         bool
+	rtspAddress   string
+	protocols     map[conf.Protocol]struct{}
+	hookStdinJSON bool
+	id            string
+	ss            *gortsplib.ServerSession
+	author        *gortsplib.ServerConn
+	pathManager   rtspSessionPathManager
+	parent        rtspSessionParent
+
+	created         time.Time
+	setupDone       bool
 	path            *path
 	state           gortsplib.ServerSessionState
 	stateMutex      sync.Mutex
 	setuppedTracks  map[int]*gortsplib.Track // read
+	readUser        string                   // read
+	readStream      *stream                  // read
+	readBytesStart  map[int]uint64           // read
 	onReadCmd       *externalcmd.Cmd         // read
+	quality         *readerQuality           // read
+	multicastSetups map[int]*base.Response   // read
 	announcedTracks gortsplib.Tracks         // publish
 	stream          *stream                  // publish
+	backchannel     *rtspSource              // publish
+	rejected        bool
 }
 
 func newRTSPSession(
 	isTLS bool,
 	rtspAddress string,
 	protocols map[conf.Protocol]struct{},
+	hookStdinJSON bool,
 	id string,
 	ss *gortsplib.ServerSession,
 	sc *gortsplib.ServerConn,
 	pathManager rtspSessionPathManager,
 	parent rtspSessionParent) *rtspSession {
 	s := &rtspSession{
-		isTLS:       isTLS,
-		rtspAddress: rtspAddress,
-		protocols:   protocols,
-		id:          id,
-		ss:          ss,
-		author:      sc,
-		pathManager: pathManager,
-		parent:      parent,
+		isTLS:         isTLS,
+		rtspAddress:   rtspAddress,
+		protocols:     protocols,
+		hookStdinJSON: hookStdinJSON,
+		id:            id,
+		ss:            ss,
+		author:        sc,
+		pathManager:   pathManager,
+		parent:        parent,
+		created:       time.Now(),
 	}
 
 	s.log(logger.Info, "opened by %v", s.author.NetConn().RemoteAddr())
@@ -91,6 +107,29 @@ func (s *rtspSession) safeState() gortsplib.ServerSessionState {
 	return s.state
 }
 
+func (s *rtspSession) safeQuality() *readerQuality {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	return s.quality
+}
+
+// apiQuality returns the network quality of a reader.
+func (s *rtspSession) apiQuality() *readerQualityInfo {
+	q := s.safeQuality()
+	if q == nil {
+		return nil
+	}
+
+	// the send queue is meaningful only when data is sent through the connection
+	var nconn net.Conn
+	if t := s.ss.SetuppedTransport(); t != nil && *t == gortsplib.TransportTCP {
+		nconn = s.author.NetConn()
+	}
+
+	info := q.describe(nconn)
+	return &info
+}
+
 // RemoteAddr returns the remote address of the author of the session.
 func (s *rtspSession) RemoteAddr() net.Addr {
 	return s.author.NetConn().RemoteAddr()
@@ -112,10 +151,19 @@ func (s *rtspSession) onClose(err error) {
 
 	switch s.ss.State() {
 	case gortsplib.ServerSessionStatePreRead, gortsplib.ServerSessionStateRead:
+		if s.readStream.sap != nil {
+			s.readStream.sap.readerRemove(s)
+		}
+
 		s.path.onReaderRemove(pathReaderRemoveReq{Author: s})
 		s.path = nil
 
 	case gortsplib.ServerSessionStatePrePublish, gortsplib.ServerSessionStatePublish:
+		if s.backchannel != nil {
+			s.backchannel.backchannelDetach(s)
+			s.backchannel = nil
+		}
+
 		s.path.onPublisherRemove(pathPublisherRemoveReq{Author: s})
 		s.path = nil
 	}
@@ -156,7 +204,9 @@ func (s *rtspSession) onAnnounce(c *rtspConn, ctx *gortsplib.ServerHandlerOnAnno
 
 	res := s.pathManager.onPublisherAnnounce(pathPublisherAnnounceReq{
 		Author:   s,
-		PathName: ctx.Path,
+		PathName: s.pathManager.tenantPathName(ctx.Req.URL.Host, ctx.Path),
+		Protocol: c.protocol(),
+		User:     requestUser(ctx.Req),
 		IP:       ctx.Conn.NetConn().RemoteAddr().(*net.TCPAddr).IP,
 		ValidateCredentials: func(pathUser conf.Credential, pathPass conf.Credential) error {
 			return c.validateCredentials(pathUser, pathPass, ctx.Req)
@@ -174,6 +224,21 @@ func (s *rtspSession) onAnnounce(c *rtspConn, ctx *gortsplib.ServerHandlerOnAnno
 
 			return terr.Response, errors.New(terr.Message)
 
+		case pathErrDisabled:
+			return &base.Response{
+				StatusCode: base.StatusForbidden,
+			}, res.Err
+
+		case pathErrQuotaExceeded:
+			return &base.Response{
+				StatusCode: base.StatusNotEnoughBandwidth,
+			}, res.Err
+
+		case pathErrDraining:
+			return &base.Response{
+				StatusCode: base.StatusServiceUnavailable,
+			}, res.Err
+
 		default:
 			return &base.Response{
 				StatusCode: base.StatusBadRequest,
@@ -183,6 +248,7 @@ func (s *rtspSession) onAnnounce(c *rtspConn, ctx *gortsplib.ServerHandlerOnAnno
 
 	s.path = res.Path
 	s.announcedTracks = ctx.Tracks
+	s.backchannel = res.Backchannel
 
 	s.stateMutex.Lock()
 	s.state = gortsplib.ServerSessionStatePrePublish
@@ -212,7 +278,10 @@ func (s *rtspSession) onSetup(c *rtspConn, ctx *gortsplib.ServerHandlerOnSetupCt
 	case gortsplib.ServerSessionStateInitial, gortsplib.ServerSessionStatePreRead: // play
 		res := s.pathManager.onReaderSetupPlay(pathReaderSetupPlayReq{
 			Author:   s,
-			PathName: ctx.Path,
+			PathName: s.pathManager.tenantPathName(ctx.Req.URL.Host, ctx.Path),
+			Query:    ctx.Query,
+			Protocol: c.protocol(),
+			User:     requestUser(ctx.Req),
 			IP:       ctx.Conn.NetConn().RemoteAddr().(*net.TCPAddr).IP,
 			ValidateCredentials: func(pathUser conf.Credential, pathPass conf.Credential) error {
 				return c.validateCredentials(pathUser, pathPass, ctx.Req)
@@ -230,11 +299,21 @@ func (s *rtspSession) onSetup(c *rtspConn, ctx *gortsplib.ServerHandlerOnSetupCt
 
 				return terr.Response, nil, errors.New(terr.Message)
 
-			case pathErrNoOnePublishing:
+			case pathErrNoOnePublishing, pathErrDisabled:
 				return &base.Response{
 					StatusCode: base.StatusNotFound,
 				}, nil, res.Err
 
+			case pathErrQuotaExceeded, pathErrCongested:
+				return &base.Response{
+					StatusCode: base.StatusNotEnoughBandwidth,
+				}, nil, res.Err
+
+			case pathErrDraining:
+				return &base.Response{
+					StatusCode: base.StatusServiceUnavailable,
+				}, nil, res.Err
+
 			default:
 				return &base.Response{
 					StatusCode: base.StatusBadRequest,
@@ -244,6 +323,14 @@ func (s *rtspSession) onSetup(c *rtspConn, ctx *gortsplib.ServerHandlerOnSetupCt
 
 		s.path = res.Path
 
+		// packets are encrypted, and can be decrypted only by multicast readers,
+		// that receive the key in the SDP.
+		if res.Stream.srtp != nil && ctx.Transport != gortsplib.TransportUDPMulticast {
+			return &base.Response{
+				StatusCode: base.StatusUnsupportedTransport,
+			}, nil, fmt.Errorf("path '%s' can be read only with the UDP-multicast transport protocol", res.Path.Name())
+		}
+
 		if ctx.TrackID >= len(res.Stream.tracks()) {
 			return &base.Response{
 				StatusCode: base.StatusBadRequest,
@@ -257,11 +344,24 @@ func (s *rtspSession) onSetup(c *rtspConn, ctx *gortsplib.ServerHandlerOnSetupCt
 
 		s.stateMutex.Lock()
 		s.state = gortsplib.ServerSessionStatePreRead
+		s.readUser = requestUser(ctx.Req)
+		s.readStream = res.Stream
 		s.stateMutex.Unlock()
 
-		return &base.Response{
+		setupRes := &base.Response{
 			StatusCode: base.StatusOK,
-		}, res.Stream.rtspStream, nil
+		}
+
+		// the multicast group is written by gortsplib into the response,
+		// that is read when the session starts playing.
+		if ctx.Transport == gortsplib.TransportUDPMulticast {
+			if s.multicastSetups == nil {
+				s.multicastSetups = make(map[int]*base.Response)
+			}
+			s.multicastSetups[ctx.TrackID] = setupRes
+		}
+
+		return setupRes, res.Stream.rtspStream, nil
 
 	default: // record
 		return &base.Response{
@@ -278,17 +378,40 @@ func (s *rtspSession) onPlay(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Respo
 		s.path.onReaderPlay(pathReaderPlayReq{Author: s})
 
 		if s.path.Conf().RunOnRead != "" {
-			s.log(logger.Info, "runOnRead command started")
 			_, port, _ := net.SplitHostPort(s.rtspAddress)
-			s.onReadCmd = externalcmd.New(s.path.Conf().RunOnRead, s.path.Conf().RunOnReadRestart, externalcmd.Environment{
-				Path: s.path.Name(),
-				Port: port,
+			s.onReadCmd = hookStart(s.log, "runOnRead", s.path.Conf().RunOnRead, s.path.Conf().RunOnReadRestart, s.hookStdinJSON, hookEvent{
+				Event:      "read",
+				Path:       s.path.Name(),
+				Port:       port,
+				SourceURL:  hookSourceURL(s.path.Conf()),
+				Client:     s.onReaderAPIDescribe(),
+				RemoteAddr: hookRemoteAddr(s),
 			})
 		}
 
+		clockRates := make(map[int]int)
+		for trackID, track := range s.setuppedTracks {
+			clockRates[trackID], _ = track.ClockRate()
+		}
+
+		// the amount of sent data is computed from the data received by the stream
+		// since the beginning of the reading
+		bytesStart := make(map[int]uint64)
+		for trackID := range s.setuppedTracks {
+			bytesStart[trackID] = s.readStream.info.bytes(trackID)
+		}
+
 		s.stateMutex.Lock()
 		s.state = gortsplib.ServerSessionStateRead
+		s.quality = newReaderQuality(clockRates)
+		s.readBytesStart = bytesStart
 		s.stateMutex.Unlock()
+
+		if s.readStream.sap != nil && s.multicastSetups != nil {
+			s.readStream.sap.readerAdd(s, sapGroups(s.multicastSetups))
+		}
+
+		s.onSetupDone()
 	}
 
 	return &base.Response{
@@ -299,6 +422,25 @@ func (s *rtspSession) onPlay(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Respo
 
 // onRecord is called by rtspServer.
 func (s *rtspSession) onRecord(ctx *gortsplib.ServerHandlerOnRecordCtx) (*base.Response, error) {
+	if s.backchannel != nil {
+		err := s.backchannel.backchannelAttach(s, s.announcedTracks)
+		if err != nil {
+			return &base.Response{
+				StatusCode: base.StatusBadRequest,
+			}, err
+		}
+
+		s.log(logger.Info, "is publishing to the backchannel of path '%s'", s.path.Name())
+
+		s.stateMutex.Lock()
+		s.state = gortsplib.ServerSessionStatePublish
+		s.stateMutex.Unlock()
+
+		return &base.Response{
+			StatusCode: base.StatusOK,
+		}, nil
+	}
+
 	res := s.path.onPublisherRecord(pathPublisherRecordReq{
 		Author: s,
 		Tracks: s.announcedTracks,
@@ -315,11 +457,23 @@ func (s *rtspSession) onRecord(ctx *gortsplib.ServerHandlerOnRecordCtx) (*base.R
 	s.state = gortsplib.ServerSessionStatePublish
 	s.stateMutex.Unlock()
 
+	s.onSetupDone()
+
 	return &base.Response{
 		StatusCode: base.StatusOK,
 	}, nil
 }
 
+// onSetupDone measures the time elapsed between the creation of the session
+// and the first PLAY or RECORD request.
+func (s *rtspSession) onSetupDone() {
+	if s.setupDone {
+		return
+	}
+	s.setupDone = true
+	s.parent.onSessionSetupDone(time.Since(s.created))
+}
+
 // onPause is called by rtspServer.
 func (s *rtspSession) onPause(ctx *gortsplib.ServerHandlerOnPauseCtx) (*base.Response, error) {
 	switch s.ss.State() {
@@ -329,6 +483,10 @@ func (s *rtspSession) onPause(ctx *gortsplib.ServerHandlerOnPauseCtx) (*base.Res
 			s.onReadCmd.Close()
 		}
 
+		if s.readStream.sap != nil {
+			s.readStream.sap.readerRemove(s)
+		}
+
 		s.path.onReaderPause(pathReaderPauseReq{Author: s})
 
 		s.stateMutex.Lock()
@@ -336,6 +494,10 @@ func (s *rtspSession) onPause(ctx *gortsplib.ServerHandlerOnPauseCtx) (*base.Res
 		s.stateMutex.Unlock()
 
 	case gortsplib.ServerSessionStatePublish:
+		if s.backchannel != nil {
+			s.backchannel.backchannelDetach(s)
+		}
+
 		s.path.onPublisherPause(pathPublisherPauseReq{Author: s})
 
 		s.stateMutex.Lock()
@@ -348,6 +510,46 @@ func (s *rtspSession) onPause(ctx *gortsplib.ServerHandlerOnPauseCtx) (*base.Res
 	}, nil
 }
 
+// onParameter is called by rtspServer.
+func (s *rtspSession) onParameter(req *base.Request) (*base.Response, error) {
+	notImplemented := func() (*base.Response, error) {
+		if req.Method == base.GetParameter {
+			return &base.Response{
+				StatusCode: base.StatusOK,
+				Header: base.Header{
+					"Content-Type": base.HeaderValue{"text/parameters"},
+				},
+				Body: []byte{},
+			}, nil
+		}
+
+		return &base.Response{
+			StatusCode: base.StatusNotImplemented,
+		}, nil
+	}
+
+	switch s.safeState() {
+	case gortsplib.ServerSessionStatePreRead, gortsplib.ServerSessionStateRead:
+	default:
+		return notImplemented()
+	}
+
+	res := s.path.onReaderSourceParameter(pathReaderSourceParameterReq{Author: s})
+	if res.Err != nil {
+		return notImplemented()
+	}
+
+	fwdRes, err := res.Source.forwardParameter(req)
+	if err != nil {
+		s.log(logger.Info, "unable to forward %s to source: %s", req.Method, err)
+		return &base.Response{
+			StatusCode: base.StatusBadGateway,
+		}, nil
+	}
+
+	return fwdRes, nil
+}
+
 // onReaderAccepted implements reader.
 func (s *rtspSession) onReaderAccepted() {
 	tracksLen := len(s.ss.SetuppedTracks())
@@ -389,6 +591,58 @@ func (s *rtspSession) onReaderAPIDescribe() interface{} {
 	}{typ, s.id}
 }
 
+// onReaderAPIReadersItem implements reader.
+func (s *rtspSession) onReaderAPIReadersItem() pathAPIPathsReadersItem {
+	var typ string
+	var protocol string
+	if s.isTLS {
+		typ = "rtspsSession"
+		protocol = "rtsps"
+	} else {
+		typ = "rtspSession"
+		protocol = "rtsp"
+	}
+
+	s.stateMutex.Lock()
+	user := s.readUser
+	var bytesSent uint64
+	for trackID, start := range s.readBytesStart {
+		bytesSent += s.readStream.info.bytes(trackID) - start
+	}
+	s.stateMutex.Unlock()
+
+	if t := s.ss.SetuppedTransport(); t != nil {
+		switch *t {
+		case gortsplib.TransportUDP:
+			protocol += "/udp"
+
+		case gortsplib.TransportUDPMulticast:
+			protocol += "/multicast"
+
+		default:
+			protocol += "/tcp"
+		}
+	}
+
+	return pathAPIPathsReadersItem{
+		Type:       typ,
+		ID:         s.id,
+		Protocol:   protocol,
+		RemoteAddr: s.RemoteAddr().String(),
+		User:       user,
+		Created:    s.created,
+		BytesSent:  bytesSent,
+	}
+}
+
+// onSourceUDPDrops implements sourceUDPDrops.
+func (s *rtspSession) onSourceUDPDrops() (uint64, bool) {
+	if t := s.ss.SetuppedTransport(); t == nil || *t != gortsplib.TransportUDP {
+		return 0, false
+	}
+	return s.parent.udpDrops()
+}
+
 // onSourceAPIDescribe implements source.
 func (s *rtspSession) onSourceAPIDescribe() interface{} {
 	var typ string
@@ -424,12 +678,25 @@ func (s *rtspSession) onPacketRTP(ctx *gortsplib.ServerHandlerOnPacketRTPCtx) {
 		return
 	}
 
+	if s.backchannel != nil {
+		s.backchannel.backchannelWritePacketRTP(s, ctx.TrackID, ctx.Payload)
+		return
+	}
+
 	s.stream.onPacketRTP(ctx.TrackID, ctx.Payload)
 }
 
 // onPacketRTCP is called by rtspServer.
 func (s *rtspSession) onPacketRTCP(ctx *gortsplib.ServerHandlerOnPacketRTCPCtx) {
-	if s.ss.State() != gortsplib.ServerSessionStatePublish {
+	// receiver reports of readers
+	if s.ss.State() == gortsplib.ServerSessionStateRead {
+		if q := s.safeQuality(); q != nil {
+			q.processRTCP(time.Now(), ctx.TrackID, ctx.Payload)
+		}
+		return
+	}
+
+	if s.ss.State() != gortsplib.ServerSessionStatePublish || s.backchannel != nil {
 		return
 	}
 
@@ -1,18 +1,23 @@
 package core
 
 import (
+	"bufio"
 	"context"
 	"crypto/sha256"
 	"crypto/tls"
 	"encoding/hex"
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/aler9/gortsplib"
+	"github.com/aler9/gortsplib/pkg/auth"
 	"github.com/aler9/gortsplib/pkg/base"
 	"github.com/aler9/gortsplib/pkg/h264"
+	"github.com/aler9/gortsplib/pkg/headers"
 	"github.com/aler9/gortsplib/pkg/rtph264"
 	"github.com/pion/rtp"
 
@@ -21,29 +26,57 @@ import (
 )
 
 const (
-	rtspSourceRetryPause = 5 * time.Second
+	// tag used to request the ONVIF audio backchannel.
+	rtspSourceBackchannelRequire = "www.onvif.org/ver20/backchannel"
 )
 
+// rtspSourceSession contains the parameters needed to send requests
+// inside the session of the source.
+type rtspSourceSession struct {
+	u  *base.URL
+	id string
+}
+
 type rtspSourceParent interface {
 	log(logger.Level, string, ...interface{})
 	onSourceStaticSetReady(req pathSourceStaticSetReadyReq) pathSourceStaticSetReadyRes
 	OnSourceStaticSetNotReady(req pathSourceStaticSetNotReadyReq)
 }
 
+// rtspSourceBackchannelTrack is a track of the source backchannel
+// that has been associated to a track of the backchannel publisher.
+type rtspSourceBackchannelTrack struct {
+	trackID     int
+	payloadType uint8
+}
+
 type rtspSource struct {
 	ur              string
 	proto           conf.SourceProtocol
 	anyPortEnable   bool
+	repairSDP       bool
 	fingerprint     string
+	backchannel     bool
 	readTimeout     conf.StringDuration
 	writeTimeout    conf.StringDuration
 	readBufferCount int
 	readBufferSize  int
+	retry           *sourceRetry
 	wg              *sync.WaitGroup
 	parent          rtspSourceParent
 
 	ctx       context.Context
 	ctxCancel func()
+
+	sessionMutex sync.Mutex
+	session      *rtspSourceSession
+
+	backchannelMutex        sync.Mutex
+	backchannelClient       *gortsplib.Client
+	backchannelSourceTracks map[int]*gortsplib.Track
+	backchannelAuthor       publisher
+	backchannelAuthorTracks gortsplib.Tracks
+	backchannelMap          map[int]rtspSourceBackchannelTrack
 }
 
 func newRTSPSource(
@@ -51,11 +84,14 @@ func newRTSPSource(
 	ur string,
 	proto conf.SourceProtocol,
 	anyPortEnable bool,
+	repairSDP bool,
 	fingerprint string,
+	backchannel bool,
 	readTimeout conf.StringDuration,
 	writeTimeout conf.StringDuration,
 	readBufferCount int,
 	readBufferSize int,
+	retry *sourceRetry,
 	wg *sync.WaitGroup,
 	parent rtspSourceParent) *rtspSource {
 	ctx, ctxCancel := context.WithCancel(parentCtx)
@@ -64,11 +100,14 @@ func newRTSPSource(
 		ur:              ur,
 		proto:           proto,
 		anyPortEnable:   anyPortEnable,
+		repairSDP:       repairSDP,
 		fingerprint:     fingerprint,
+		backchannel:     backchannel,
 		readTimeout:     readTimeout,
 		writeTimeout:    writeTimeout,
 		readBufferCount: readBufferCount,
 		readBufferSize:  readBufferSize,
+		retry:           retry,
 		wg:              wg,
 		parent:          parent,
 		ctx:             ctx,
@@ -102,8 +141,14 @@ func (s *rtspSource) run() {
 				return false
 			}
 
+			pause, ok := s.retry.onFailure()
+			if !ok {
+				s.log(logger.Info, "too many consecutive failures, giving up")
+				return false
+			}
+
 			select {
-			case <-time.After(rtspSourceRetryPause):
+			case <-time.After(pause):
 				return true
 			case <-s.ctx.Done():
 				return false
@@ -117,9 +162,7 @@ func (s *rtspSource) run() {
 	s.ctxCancel()
 }
 
-func (s *rtspSource) runInner() bool {
-	s.log(logger.Debug, "connecting")
-
+func (s *rtspSource) tlsConfig() *tls.Config {
 	tlsConfig := &tls.Config{}
 	if s.fingerprint != "" {
 		tlsConfig.InsecureSkipVerify = true
@@ -137,20 +180,39 @@ func (s *rtspSource) runInner() bool {
 			return nil
 		}
 	}
+	return tlsConfig
+}
+
+func (s *rtspSource) runInner() bool {
+	s.log(logger.Debug, "connecting")
 
 	c := &gortsplib.Client{
 		Transport:       s.proto.Transport,
-		TLSConfig:       tlsConfig,
+		TLSConfig:       s.tlsConfig(),
 		ReadTimeout:     time.Duration(s.readTimeout),
 		WriteTimeout:    time.Duration(s.writeTimeout),
 		ReadBufferCount: s.readBufferCount,
 		ReadBufferSize:  s.readBufferSize,
 		AnyPortEnable:   s.anyPortEnable,
 		OnRequest: func(req *base.Request) {
+			if s.backchannel {
+				switch req.Method {
+				case base.Describe, base.Setup, base.Play:
+					req.Header["Require"] = base.HeaderValue{rtspSourceBackchannelRequire}
+				}
+			}
+
 			s.log(logger.Debug, "c->s %v", req)
 		},
 		OnResponse: func(res *base.Response) {
 			s.log(logger.Debug, "s->c %v", res)
+
+			if s.repairSDP && len(res.Body) != 0 {
+				if ct, ok := res.Header["Content-Type"]; ok && len(ct) == 1 &&
+					strings.HasPrefix(strings.ToLower(ct[0]), "application/sdp") {
+					res.Body = sdpRepair(res.Body)
+				}
+			}
 		},
 	}
 
@@ -179,38 +241,71 @@ func (s *rtspSource) runInner() bool {
 				return err
 			}
 
+			var session *rtspSourceSession
+
 			for _, t := range tracks {
-				_, err := c.Setup(true, t, baseURL, 0, 0)
+				res, err := c.Setup(true, t, baseURL, 0, 0)
 				if err != nil {
 					return err
 				}
+
+				if session == nil {
+					if v, ok := res.Header["Session"]; ok {
+						var sx headers.Session
+						err := sx.Read(v)
+						if err == nil {
+							session = &rtspSourceSession{u: u, id: sx.Session}
+						}
+					}
+				}
+			}
+
+			s.setSession(session)
+			defer s.setSession(nil)
+
+			// backchannel tracks are used to send data to the source,
+			// therefore they're not part of the stream.
+			streamTracks, streamTrackIDs, backchannelTracks := rtspSourceSplitTracks(c.Tracks())
+
+			if s.backchannel {
+				if len(backchannelTracks) == 0 {
+					s.log(logger.Warn, "source does not provide a backchannel")
+				}
+
+				s.backchannelSetClient(c, backchannelTracks)
+				defer s.backchannelSetClient(nil, nil)
 			}
 
-			err = s.handleMissingH264Params(c, tracks)
+			err = s.handleMissingH264Params(c, streamTracks, streamTrackIDs)
 			if err != nil {
 				return err
 			}
 
 			res := s.parent.onSourceStaticSetReady(pathSourceStaticSetReadyReq{
 				Source: s,
-				Tracks: c.Tracks(),
+				Tracks: streamTracks,
 			})
 			if res.Err != nil {
 				return res.Err
 			}
 
 			s.log(logger.Info, "ready")
+			s.retry.onSuccess()
 
 			defer func() {
 				s.parent.OnSourceStaticSetNotReady(pathSourceStaticSetNotReadyReq{Source: s})
 			}()
 
 			c.OnPacketRTP = func(trackID int, payload []byte) {
-				res.Stream.onPacketRTP(trackID, payload)
+				if trackID, ok := streamTrackIDs[trackID]; ok {
+					res.Stream.onPacketRTP(trackID, payload)
+				}
 			}
 
 			c.OnPacketRTCP = func(trackID int, payload []byte) {
-				res.Stream.onPacketRTCP(trackID, payload)
+				if trackID, ok := streamTrackIDs[trackID]; ok {
+					res.Stream.onPacketRTCP(trackID, payload)
+				}
 			}
 
 			_, err = c.Play(nil)
@@ -234,7 +329,8 @@ func (s *rtspSource) runInner() bool {
 	}
 }
 
-func (s *rtspSource) handleMissingH264Params(c *gortsplib.Client, tracks gortsplib.Tracks) error {
+func (s *rtspSource) handleMissingH264Params(c *gortsplib.Client, tracks gortsplib.Tracks,
+	streamTrackIDs map[int]int) error {
 	h264TrackID := func() int {
 		for i, t := range tracks {
 			if t.IsH264() {
@@ -264,6 +360,11 @@ func (s *rtspSource) handleMissingH264Params(c *gortsplib.Client, tracks gortspl
 	paramsReceived := make(chan struct{})
 
 	c.OnPacketRTP = func(trackID int, payload []byte) {
+		trackID, ok := streamTrackIDs[trackID]
+		if !ok {
+			return
+		}
+
 		streamMutex.RLock()
 		defer streamMutex.RUnlock()
 
@@ -313,6 +414,11 @@ func (s *rtspSource) handleMissingH264Params(c *gortsplib.Client, tracks gortspl
 	}
 
 	c.OnPacketRTCP = func(trackID int, payload []byte) {
+		trackID, ok := streamTrackIDs[trackID]
+		if !ok {
+			return
+		}
+
 		streamMutex.RLock()
 		defer streamMutex.RUnlock()
 
@@ -378,6 +484,302 @@ func (s *rtspSource) handleMissingH264Params(c *gortsplib.Client, tracks gortspl
 	return <-waitError
 }
 
+func (s *rtspSource) setSession(session *rtspSourceSession) {
+	s.sessionMutex.Lock()
+	defer s.sessionMutex.Unlock()
+	s.session = session
+}
+
+// forwardParameter sends a GET_PARAMETER or SET_PARAMETER request
+// to the source, inside the session of the source, and returns the response.
+// The request is sent with a dedicated connection, in order not to interfere
+// with the connection used to read the stream.
+func (s *rtspSource) forwardParameter(req *base.Request) (*base.Response, error) {
+	s.sessionMutex.Lock()
+	session := s.session
+	s.sessionMutex.Unlock()
+
+	if session == nil {
+		return nil, fmt.Errorf("source is not ready")
+	}
+
+	host := session.u.Host
+	if !strings.Contains(host, ":") {
+		host += ":554"
+	}
+
+	ctx, ctxCancel := context.WithTimeout(s.ctx, time.Duration(s.readTimeout))
+	defer ctxCancel()
+
+	nconn, err := (&net.Dialer{}).DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	defer nconn.Close()
+
+	// close the connection when the source is closed or the timeout expires
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			nconn.Close()
+		case <-done:
+		}
+	}()
+
+	conn := nconn
+	if session.u.Scheme == "rtsps" {
+		conn = tls.Client(nconn, s.tlsConfig())
+	}
+
+	br := bufio.NewReader(conn)
+	bw := bufio.NewWriter(conn)
+
+	fwdReq := &base.Request{
+		Method: req.Method,
+		URL:    session.u.CloneWithoutCredentials(),
+		Header: base.Header{
+			"CSeq":    base.HeaderValue{"1"},
+			"Session": base.HeaderValue{session.id},
+		},
+		Body: req.Body,
+	}
+	if v, ok := req.Header["Content-Type"]; ok {
+		fwdReq.Header["Content-Type"] = v
+	}
+
+	roundTrip := func() (*base.Response, error) {
+		s.log(logger.Debug, "c->s %v", fwdReq)
+
+		err := fwdReq.Write(bw)
+		if err != nil {
+			return nil, err
+		}
+
+		var res base.Response
+		err = res.Read(br)
+		if err != nil {
+			return nil, err
+		}
+
+		s.log(logger.Debug, "s->c %v", &res)
+		return &res, nil
+	}
+
+	res, err := roundTrip()
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == base.StatusUnauthorized && session.u.User != nil {
+		pass, _ := session.u.User.Password()
+		sender, err := auth.NewSender(res.Header["WWW-Authenticate"], session.u.User.Username(), pass)
+		if err != nil {
+			return nil, err
+		}
+
+		fwdReq.Header["CSeq"] = base.HeaderValue{"2"}
+		sender.AddAuthorization(fwdReq)
+
+		res, err = roundTrip()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fwdRes := &base.Response{
+		StatusCode:    res.StatusCode,
+		StatusMessage: res.StatusMessage,
+		Header:        base.Header{},
+		Body:          res.Body,
+	}
+	if v, ok := res.Header["Content-Type"]; ok {
+		fwdRes.Header["Content-Type"] = v
+	}
+
+	return fwdRes, nil
+}
+
+// rtspSourceSplitTracks splits the tracks of the source into the tracks
+// that are part of the stream and the backchannel tracks.
+// It returns the stream tracks, a map that associates the IDs of the source tracks
+// to the IDs of the stream tracks, and the backchannel tracks, indexed by source track ID.
+func rtspSourceSplitTracks(tracks gortsplib.Tracks) (gortsplib.Tracks, map[int]int, map[int]*gortsplib.Track) {
+	var streamTracks gortsplib.Tracks
+	streamTrackIDs := make(map[int]int)
+	backchannelTracks := make(map[int]*gortsplib.Track)
+
+	for i, t := range tracks {
+		if _, ok := t.Media.Attribute("sendonly"); ok {
+			backchannelTracks[i] = t
+			continue
+		}
+
+		streamTrackIDs[i] = len(streamTracks)
+		streamTracks = append(streamTracks, t)
+	}
+
+	return streamTracks, streamTrackIDs, backchannelTracks
+}
+
+// rtspSourceTrackCodec returns the payload type and the codec of a track,
+// in the format name/clockrate.
+func rtspSourceTrackCodec(t *gortsplib.Track) (uint8, string, bool) {
+	if len(t.Media.MediaName.Formats) == 0 {
+		return 0, "", false
+	}
+
+	tmp, err := strconv.ParseUint(t.Media.MediaName.Formats[0], 10, 8)
+	if err != nil {
+		return 0, "", false
+	}
+	payloadType := uint8(tmp)
+
+	for _, attr := range t.Media.Attributes {
+		if attr.Key != "rtpmap" {
+			continue
+		}
+
+		parts := strings.SplitN(attr.Value, " ", 2)
+		if len(parts) != 2 || parts[0] != t.Media.MediaName.Formats[0] {
+			continue
+		}
+
+		// remove the number of channels
+		codec := strings.Split(strings.ToLower(parts[1]), "/")
+		if len(codec) < 2 {
+			return 0, "", false
+		}
+
+		return payloadType, codec[0] + "/" + codec[1], true
+	}
+
+	// static payload types
+	switch payloadType {
+	case 0:
+		return payloadType, "pcmu/8000", true
+
+	case 8:
+		return payloadType, "pcma/8000", true
+	}
+
+	return 0, "", false
+}
+
+func (s *rtspSource) backchannelSetClient(c *gortsplib.Client, tracks map[int]*gortsplib.Track) {
+	s.backchannelMutex.Lock()
+	defer s.backchannelMutex.Unlock()
+
+	s.backchannelClient = c
+	s.backchannelSourceTracks = tracks
+
+	if s.backchannelAuthor != nil {
+		var err error
+		s.backchannelMap, err = s.backchannelBuildMap(s.backchannelAuthorTracks)
+		if err != nil {
+			s.log(logger.Warn, "unable to send backchannel: %s", err)
+		}
+	}
+}
+
+func (s *rtspSource) backchannelBuildMap(authorTracks gortsplib.Tracks) (map[int]rtspSourceBackchannelTrack, error) {
+	if s.backchannelClient == nil {
+		return nil, nil
+	}
+
+	ret := make(map[int]rtspSourceBackchannelTrack)
+	used := make(map[int]struct{})
+
+	for i, at := range authorTracks {
+		_, codec, ok := rtspSourceTrackCodec(at)
+		if !ok {
+			return nil, fmt.Errorf("track %d has an unsupported codec", i+1)
+		}
+
+		found := false
+		for trackID, bt := range s.backchannelSourceTracks {
+			if _, ok := used[trackID]; ok {
+				continue
+			}
+
+			payloadType, bcodec, ok := rtspSourceTrackCodec(bt)
+			if ok && bcodec == codec {
+				ret[i] = rtspSourceBackchannelTrack{
+					trackID:     trackID,
+					payloadType: payloadType,
+				}
+				used[trackID] = struct{}{}
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("the backchannel of the source does not support codec '%s'", codec)
+		}
+	}
+
+	return ret, nil
+}
+
+// backchannelAttach assigns the backchannel of the source to a publisher.
+func (s *rtspSource) backchannelAttach(author publisher, tracks gortsplib.Tracks) error {
+	s.backchannelMutex.Lock()
+	defer s.backchannelMutex.Unlock()
+
+	if s.backchannelAuthor != nil {
+		return fmt.Errorf("the backchannel is in use by another publisher")
+	}
+
+	m, err := s.backchannelBuildMap(tracks)
+	if err != nil {
+		return err
+	}
+
+	s.backchannelAuthor = author
+	s.backchannelAuthorTracks = tracks
+	s.backchannelMap = m
+
+	return nil
+}
+
+// backchannelDetach releases the backchannel of the source.
+func (s *rtspSource) backchannelDetach(author publisher) {
+	s.backchannelMutex.Lock()
+	defer s.backchannelMutex.Unlock()
+
+	if s.backchannelAuthor != author {
+		return
+	}
+
+	s.backchannelAuthor = nil
+	s.backchannelAuthorTracks = nil
+	s.backchannelMap = nil
+}
+
+// backchannelWritePacketRTP sends a RTP packet of the publisher to the backchannel of the source.
+func (s *rtspSource) backchannelWritePacketRTP(author publisher, trackID int, payload []byte) {
+	s.backchannelMutex.Lock()
+	defer s.backchannelMutex.Unlock()
+
+	if s.backchannelAuthor != author || s.backchannelClient == nil || len(payload) < 2 {
+		return
+	}
+
+	t, ok := s.backchannelMap[trackID]
+	if !ok {
+		return
+	}
+
+	// the payload type of the publisher may differ from the one of the source
+	buf := make([]byte, len(payload))
+	copy(buf, payload)
+	buf[1] = (buf[1] & 0x80) | t.payloadType
+
+	s.backchannelClient.WritePacketRTP(t.trackID, buf)
+}
+
 // onSourceAPIDescribe implements source.
 func (*rtspSource) onSourceAPIDescribe() interface{} {
 	return struct {
@@ -1,7 +1,9 @@
 package core
 
 import (
+	"bufio"
 	"crypto/tls"
+	"net"
 	"os"
 	"testing"
 	"time"
@@ -34,6 +36,23 @@ func (sh *testServer) OnPlay(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Respo
 	return sh.onPlay(ctx)
 }
 
+func mustParseURL(s string) *base.URL {
+	u, err := base.ParseURL(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+type testServerParameter struct {
+	testServer
+	onSetParameter func(*gortsplib.ServerHandlerOnSetParameterCtx) (*base.Response, error)
+}
+
+func (sh *testServerParameter) OnSetParameter(ctx *gortsplib.ServerHandlerOnSetParameterCtx) (*base.Response, error) {
+	return sh.onSetParameter(ctx)
+}
+
 func TestRTSPSource(t *testing.T) {
 	for _, source := range []string{
 		"udp",
@@ -209,6 +228,112 @@ func TestRTSPSourceNoPassword(t *testing.T) {
 	<-done
 }
 
+func TestRTSPSourcePathPlaceholder(t *testing.T) {
+	track, _ := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x01, 0x02, 0x03, 0x04}, PPS: []byte{0x05, 0x06}})
+	stream := gortsplib.NewServerStream(gortsplib.Tracks{track})
+	requestedPath := make(chan string, 1)
+
+	s := gortsplib.Server{
+		Handler: &testServer{
+			onDescribe: func(ctx *gortsplib.ServerHandlerOnDescribeCtx) (*base.Response, *gortsplib.ServerStream, error) {
+				requestedPath <- ctx.Path
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onSetup: func(ctx *gortsplib.ServerHandlerOnSetupCtx) (*base.Response, *gortsplib.ServerStream, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onPlay: func(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, nil
+			},
+		},
+		RTSPAddress: "127.0.0.1:8555",
+	}
+	err := s.Start()
+	require.NoError(t, err)
+	defer s.Wait()
+	defer s.Close()
+
+	p, ok := newInstance("rtmpDisable: yes\n" +
+		"hlsDisable: yes\n" +
+		"paths:\n" +
+		"  '~^cam.*$':\n" +
+		"    source: rtsp://127.0.0.1:8555/origin/$RTSP_PATH\n" +
+		"    sourceProtocol: tcp\n" +
+		"    sourceOnDemand: yes\n")
+	require.Equal(t, true, ok)
+	defer p.close()
+
+	c := gortsplib.Client{}
+	err = c.StartReading("rtsp://127.0.0.1:8554/cam1")
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.Equal(t, "origin/cam1", <-requestedPath)
+}
+
+func TestRTSPSourceQueryParams(t *testing.T) {
+	track, _ := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x01, 0x02, 0x03, 0x04}, PPS: []byte{0x05, 0x06}})
+	stream := gortsplib.NewServerStream(gortsplib.Tracks{track})
+	requestedURL := make(chan string, 1)
+
+	s := gortsplib.Server{
+		Handler: &testServer{
+			onDescribe: func(ctx *gortsplib.ServerHandlerOnDescribeCtx) (*base.Response, *gortsplib.ServerStream, error) {
+				requestedURL <- ctx.Path + "?" + ctx.Query
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onSetup: func(ctx *gortsplib.ServerHandlerOnSetupCtx) (*base.Response, *gortsplib.ServerStream, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onPlay: func(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, nil
+			},
+		},
+		RTSPAddress: "127.0.0.1:8555",
+	}
+	err := s.Start()
+	require.NoError(t, err)
+	defer s.Wait()
+	defer s.Close()
+
+	p, ok := newInstance("rtmpDisable: yes\n" +
+		"hlsDisable: yes\n" +
+		"paths:\n" +
+		"  proxied:\n" +
+		"    source: rtsp://127.0.0.1:8555/$RTSP_QUERY_stream?a=b\n" +
+		"    sourceProtocol: tcp\n" +
+		"    sourceOnDemand: yes\n" +
+		"    sourceQueryParams: [stream, token]\n")
+	require.Equal(t, true, ok)
+	defer p.close()
+
+	c := gortsplib.Client{}
+	err = c.StartReading("rtsp://127.0.0.1:8554/proxied?stream=sub&token=abc&other=def")
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.Equal(t, "sub?a=b&token=abc", <-requestedURL)
+
+	// readers of the running source must provide the same parameters
+	c2 := gortsplib.Client{}
+	err = c2.StartReading("rtsp://127.0.0.1:8554/proxied?stream=main")
+	require.Error(t, err)
+}
+
 func TestRTSPSourceMissingH264Params(t *testing.T) {
 	track, _ := gortsplib.NewTrackH264(96,
 		&gortsplib.TrackConfigH264{SPS: []byte{0x01, 0x02, 0x03, 0x04}, PPS: []byte{0x05, 0x06}})
@@ -321,3 +446,275 @@ func TestRTSPSourceMissingH264Params(t *testing.T) {
 
 	<-received
 }
+
+func TestRTSPSourceParameterPassthrough(t *testing.T) {
+	track, _ := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x01, 0x02, 0x03, 0x04}, PPS: []byte{0x05, 0x06}})
+	stream := gortsplib.NewServerStream(gortsplib.Tracks{track})
+	ready := make(chan struct{})
+
+	s := gortsplib.Server{
+		Handler: &testServerParameter{
+			testServer: testServer{
+				onDescribe: func(ctx *gortsplib.ServerHandlerOnDescribeCtx) (*base.Response, *gortsplib.ServerStream, error) {
+					return &base.Response{
+						StatusCode: base.StatusOK,
+					}, stream, nil
+				},
+				onSetup: func(ctx *gortsplib.ServerHandlerOnSetupCtx) (*base.Response, *gortsplib.ServerStream, error) {
+					return &base.Response{
+						StatusCode: base.StatusOK,
+					}, stream, nil
+				},
+				onPlay: func(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+					close(ready)
+					return &base.Response{
+						StatusCode: base.StatusOK,
+					}, nil
+				},
+			},
+			onSetParameter: func(ctx *gortsplib.ServerHandlerOnSetParameterCtx) (*base.Response, error) {
+				require.Equal(t, "teststream", ctx.Path)
+				require.NotEmpty(t, ctx.Req.Header["Session"])
+				require.Equal(t, []byte("bitrate: 1000\r\n"), ctx.Req.Body)
+				return &base.Response{
+					StatusCode: base.StatusOK,
+					Header: base.Header{
+						"Content-Type": base.HeaderValue{"text/parameters"},
+					},
+					Body: []byte("bitrate: 1000\r\n"),
+				}, nil
+			},
+		},
+		RTSPAddress: "127.0.0.1:8555",
+	}
+	err := s.Start()
+	require.NoError(t, err)
+	defer s.Wait()
+	defer s.Close()
+
+	p, ok := newInstance("rtmpDisable: yes\n" +
+		"hlsDisable: yes\n" +
+		"paths:\n" +
+		"  proxied:\n" +
+		"    source: rtsp://127.0.0.1:8555/teststream\n" +
+		"    sourceProtocol: tcp\n" +
+		"    sourceParameterPassthrough: yes\n")
+	require.Equal(t, true, ok)
+	defer p.close()
+
+	<-ready
+
+	conn, err := net.Dial("tcp", "127.0.0.1:8554")
+	require.NoError(t, err)
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	bw := bufio.NewWriter(conn)
+
+	writeReqReadRes := func(req base.Request) *base.Response {
+		err := req.Write(bw)
+		require.NoError(t, err)
+
+		var res base.Response
+		err = res.Read(br)
+		require.NoError(t, err)
+		return &res
+	}
+
+	res := writeReqReadRes(base.Request{
+		Method: base.Setup,
+		URL:    mustParseURL("rtsp://127.0.0.1:8554/proxied/trackID=0"),
+		Header: base.Header{
+			"CSeq":      base.HeaderValue{"1"},
+			"Transport": base.HeaderValue{"RTP/AVP/TCP;unicast;interleaved=0-1"},
+		},
+	})
+	require.Equal(t, base.StatusOK, res.StatusCode)
+	session := res.Header["Session"]
+
+	res = writeReqReadRes(base.Request{
+		Method: base.SetParameter,
+		URL:    mustParseURL("rtsp://127.0.0.1:8554/proxied"),
+		Header: base.Header{
+			"CSeq":         base.HeaderValue{"2"},
+			"Session":      session,
+			"Content-Type": base.HeaderValue{"text/parameters"},
+		},
+		Body: []byte("bitrate: 1000\r\n"),
+	})
+	require.Equal(t, base.StatusOK, res.StatusCode)
+	require.Equal(t, []byte("bitrate: 1000\r\n"), res.Body)
+
+	// GET_PARAMETER without a body is answered locally
+	res = writeReqReadRes(base.Request{
+		Method: base.GetParameter,
+		URL:    mustParseURL("rtsp://127.0.0.1:8554/proxied"),
+		Header: base.Header{
+			"CSeq":    base.HeaderValue{"3"},
+			"Session": session,
+		},
+	})
+	require.Equal(t, base.StatusOK, res.StatusCode)
+}
+
+func TestRTSPSourceBackchannel(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:8555")
+	require.NoError(t, err)
+	defer l.Close()
+
+	received := make(chan []byte, 1)
+	serverDone := make(chan struct{})
+
+	go func() {
+		defer close(serverDone)
+
+		nconn, err := l.Accept()
+		require.NoError(t, err)
+		defer nconn.Close()
+		br := bufio.NewReader(nconn)
+		bw := bufio.NewWriter(nconn)
+
+		writeRes := func(req *base.Request, res base.Response) {
+			if res.Header == nil {
+				res.Header = base.Header{}
+			}
+			res.Header["CSeq"] = req.Header["CSeq"]
+			err := res.Write(bw)
+			require.NoError(t, err)
+		}
+
+		for {
+			var req base.Request
+			frame := base.InterleavedFrame{
+				Payload: make([]byte, 2048),
+			}
+			what, err := base.ReadInterleavedFrameOrRequest(&frame, &req, br)
+			if err != nil {
+				return
+			}
+
+			if _, ok := what.(*base.InterleavedFrame); ok {
+				// channels 2-3 are assigned to the backchannel track
+				if frame.Channel == 2 {
+					received <- frame.Payload
+					return
+				}
+				continue
+			}
+
+			switch req.Method {
+			case base.Options:
+				writeRes(&req, base.Response{
+					StatusCode: base.StatusOK,
+					Header: base.Header{
+						"Public": base.HeaderValue{"DESCRIBE, SETUP, PLAY"},
+					},
+				})
+
+			case base.Describe:
+				require.Equal(t, base.HeaderValue{"www.onvif.org/ver20/backchannel"}, req.Header["Require"])
+
+				writeRes(&req, base.Response{
+					StatusCode: base.StatusOK,
+					Header: base.Header{
+						"Content-Type": base.HeaderValue{"application/sdp"},
+						"Content-Base": base.HeaderValue{"rtsp://127.0.0.1:8555/teststream/"},
+					},
+					Body: []byte("v=0\r\n" +
+						"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+						"s=Stream\r\n" +
+						"c=IN IP4 0.0.0.0\r\n" +
+						"t=0 0\r\n" +
+						"m=video 0 RTP/AVP 96\r\n" +
+						"a=control:trackID=0\r\n" +
+						"a=rtpmap:96 H264/90000\r\n" +
+						"a=fmtp:96 packetization-mode=1; sprop-parameter-sets=AQIDBA==,BQY=\r\n" +
+						"m=audio 0 RTP/AVP 0\r\n" +
+						"a=control:trackID=1\r\n" +
+						"a=rtpmap:0 PCMU/8000\r\n" +
+						"a=sendonly\r\n"),
+				})
+
+			case base.Setup:
+				writeRes(&req, base.Response{
+					StatusCode: base.StatusOK,
+					Header: base.Header{
+						"Transport": req.Header["Transport"],
+						"Session":   base.HeaderValue{"12345678"},
+					},
+				})
+
+			default:
+				writeRes(&req, base.Response{
+					StatusCode: base.StatusOK,
+				})
+			}
+		}
+	}()
+
+	p, ok := newInstance("rtmpDisable: yes\n" +
+		"hlsDisable: yes\n" +
+		"paths:\n" +
+		"  proxied:\n" +
+		"    source: rtsp://127.0.0.1:8555/teststream\n" +
+		"    sourceProtocol: tcp\n" +
+		"    sourceBackchannel: yes\n")
+	require.Equal(t, true, ok)
+	defer p.close()
+
+	tracks, err := gortsplib.ReadTracks([]byte("v=0\r\n" +
+		"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+		"s=Stream\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"t=0 0\r\n" +
+		"m=audio 0 RTP/AVP 97\r\n" +
+		"a=control:trackID=0\r\n" +
+		"a=rtpmap:97 PCMU/8000\r\n"))
+	require.NoError(t, err)
+
+	// wait for the source to be ready
+	var publisher *gortsplib.Client
+	require.Eventually(t, func() bool {
+		c := &gortsplib.Client{}
+		err := c.StartPublishing("rtsp://127.0.0.1:8554/proxied", tracks)
+		if err != nil {
+			return false
+		}
+		publisher = c
+		return true
+	}, 5*time.Second, 100*time.Millisecond)
+	defer publisher.Close()
+
+	pkt := rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    97,
+			SequenceNumber: 123,
+			Timestamp:      45343,
+			SSRC:           563423,
+		},
+		Payload: []byte{0x01, 0x02, 0x03, 0x04},
+	}
+
+	var byts []byte
+	require.Eventually(t, func() bool {
+		byts, _ = pkt.Marshal()
+		publisher.WritePacketRTP(0, byts)
+
+		select {
+		case byts = <-received:
+			return true
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+
+	var recv rtp.Packet
+	err = recv.Unmarshal(byts)
+	require.NoError(t, err)
+	require.Equal(t, uint8(0), recv.PayloadType)
+	require.Equal(t, []byte{0x01, 0x02, 0x03, 0x04}, recv.Payload)
+
+	l.Close()
+	<-serverDone
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"strings"
+)
+
+// order of session-level lines, defined by RFC 4566.
+const sdpRepairSessionOrder = "vosiuepcbtrzka"
+
+// session-level lines that are mandatory, with their default value.
+var sdpRepairSessionDefaults = map[byte]string{
+	'v': "v=0",
+	'o': "o=- 0 0 IN IP4 127.0.0.1",
+	's': "s=Stream",
+	't': "t=0 0",
+}
+
+// sdpRepair repairs a session description generated by a non-compliant device,
+// in order to allow it to be parsed. It normalizes line endings, removes
+// invalid lines, sorts session-level lines and adds missing mandatory lines.
+func sdpRepair(byts []byte) []byte {
+	session := make(map[byte][]string)
+	var medias [][]string
+
+	for _, line := range strings.Split(string(byts), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) < 2 || line[1] != '=' || line[0] < 'a' || line[0] > 'z' {
+			continue
+		}
+
+		if line[0] == 'm' {
+			medias = append(medias, []string{line})
+			continue
+		}
+
+		if len(medias) != 0 {
+			medias[len(medias)-1] = append(medias[len(medias)-1], line)
+			continue
+		}
+
+		if !strings.Contains(sdpRepairSessionOrder, line[:1]) {
+			continue
+		}
+
+		// lines that can be present once
+		if _, ok := sdpRepairSessionDefaults[line[0]]; ok && line[0] != 't' && len(session[line[0]]) != 0 {
+			continue
+		}
+
+		session[line[0]] = append(session[line[0]], line)
+	}
+
+	var out []string
+
+	for i := range sdpRepairSessionOrder {
+		key := sdpRepairSessionOrder[i]
+
+		lines := session[key]
+		if len(lines) == 0 {
+			if def, ok := sdpRepairSessionDefaults[key]; ok {
+				lines = []string{def}
+			}
+		}
+
+		out = append(out, lines...)
+	}
+
+	for _, media := range medias {
+		out = append(out, media...)
+	}
+
+	return []byte(strings.Join(out, "\r\n") + "\r\n")
+}
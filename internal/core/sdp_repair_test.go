@@ -0,0 +1,40 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/aler9/gortsplib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSDPRepair(t *testing.T) {
+	// SDP with LF line endings, session-level lines in the wrong order,
+	// a missing session name, a missing timing line and garbage.
+	in := []byte("v=0\n" +
+		"a=control:*\n" +
+		"o=- 1 1 IN IP4 192.168.1.10\n" +
+		"c=IN IP4 0.0.0.0\n" +
+		" \n" +
+		"garbage\n" +
+		"m=video 0 RTP/AVP 96\n" +
+		"a=rtpmap:96 H264/90000 \n" +
+		"a=control:trackID=1\n")
+
+	_, err := gortsplib.ReadTracks(in)
+	require.Error(t, err)
+
+	out := sdpRepair(in)
+	require.Equal(t, "v=0\r\n"+
+		"o=- 1 1 IN IP4 192.168.1.10\r\n"+
+		"s=Stream\r\n"+
+		"c=IN IP4 0.0.0.0\r\n"+
+		"t=0 0\r\n"+
+		"a=control:*\r\n"+
+		"m=video 0 RTP/AVP 96\r\n"+
+		"a=rtpmap:96 H264/90000\r\n"+
+		"a=control:trackID=1\r\n", string(out))
+
+	tracks, err := gortsplib.ReadTracks(out)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(tracks))
+}
@@ -0,0 +1,280 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/aler9/gortsplib/pkg/sdp"
+	psdp "github.com/pion/sdp/v3"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+const (
+	// UDP payloads are limited by the MTU, therefore this is enough for RTP and RTCP packets.
+	sdpSourceMaxPacketSize = 2048
+
+	sdpSourceCheckPeriod = 1 * time.Second
+)
+
+type sdpSourceParent interface {
+	log(logger.Level, string, ...interface{})
+	onSourceStaticSetReady(req pathSourceStaticSetReadyReq) pathSourceStaticSetReadyRes
+	OnSourceStaticSetNotReady(req pathSourceStaticSetNotReadyReq)
+}
+
+// sdpSource is a static source that receives RTP and RTCP packets on the UDP ports
+// listed inside a SDP file, without any signaling.
+type sdpSource struct {
+	filePath    string
+	readTimeout conf.StringDuration
+	retry       *sourceRetry
+	wg          *sync.WaitGroup
+	parent      sdpSourceParent
+
+	ctx       context.Context
+	ctxCancel func()
+}
+
+func newSDPSource(
+	parentCtx context.Context,
+	filePath string,
+	readTimeout conf.StringDuration,
+	retry *sourceRetry,
+	wg *sync.WaitGroup,
+	parent sdpSourceParent) *sdpSource {
+	ctx, ctxCancel := context.WithCancel(parentCtx)
+
+	s := &sdpSource{
+		filePath:    filePath,
+		readTimeout: readTimeout,
+		retry:       retry,
+		wg:          wg,
+		parent:      parent,
+		ctx:         ctx,
+		ctxCancel:   ctxCancel,
+	}
+
+	s.log(logger.Info, "started")
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s
+}
+
+func (s *sdpSource) close() {
+	s.log(logger.Info, "stopped")
+	s.ctxCancel()
+}
+
+func (s *sdpSource) log(level logger.Level, format string, args ...interface{}) {
+	s.parent.log(level, "[sdp source] "+format, args...)
+}
+
+func (s *sdpSource) run() {
+	defer s.wg.Done()
+
+outer:
+	for {
+		err := s.runInner()
+		if err == nil {
+			break outer
+		}
+
+		s.log(logger.Info, "ERR: %s", err)
+
+		pause, ok := s.retry.onFailure()
+		if !ok {
+			s.log(logger.Info, "too many consecutive failures, giving up")
+			break outer
+		}
+
+		select {
+		case <-time.After(pause):
+		case <-s.ctx.Done():
+			break outer
+		}
+	}
+
+	s.ctxCancel()
+}
+
+// sdpConnectionIP returns the IP of the connection information of a media,
+// or of the session if the media doesn't have one.
+func sdpConnectionIP(desc *sdp.SessionDescription, media *psdp.MediaDescription) (net.IP, error) {
+	ci := media.ConnectionInformation
+	if ci == nil {
+		ci = desc.ConnectionInformation
+	}
+	if ci == nil || ci.Address == nil {
+		return nil, nil
+	}
+
+	// remove the TTL and the number of addresses
+	addr := strings.Split(ci.Address.Address, "/")[0]
+
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid connection address: %s", ci.Address.Address)
+	}
+	return ip, nil
+}
+
+// sdpListen listens on a UDP port. If ip is a multicast address, the multicast group is joined.
+func sdpListen(ip net.IP, port int) (*net.UDPConn, error) {
+	if ip != nil && ip.IsMulticast() {
+		return net.ListenMulticastUDP("udp", nil, &net.UDPAddr{IP: ip, Port: port})
+	}
+	return net.ListenUDP("udp", &net.UDPAddr{Port: port})
+}
+
+// runInner receives packets until the source is closed (and returns nil) or an error occurs.
+func (s *sdpSource) runInner() error {
+	s.log(logger.Debug, "reading %s", s.filePath)
+
+	byts, err := os.ReadFile(s.filePath)
+	if err != nil {
+		return err
+	}
+
+	var desc sdp.SessionDescription
+	err = desc.Unmarshal(byts)
+	if err != nil {
+		return fmt.Errorf("invalid SDP: %s", err)
+	}
+
+	tracks, err := gortsplib.ReadTracks(byts)
+	if err != nil {
+		return fmt.Errorf("invalid SDP: %s", err)
+	}
+
+	if len(tracks) == 0 {
+		return fmt.Errorf("the SDP doesn't contain any media")
+	}
+
+	var conns []*net.UDPConn
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	// RTP and RTCP connections of every track
+	rtpConns := make([]*net.UDPConn, len(tracks))
+	rtcpConns := make([]*net.UDPConn, len(tracks))
+
+	for i, media := range desc.MediaDescriptions {
+		port := media.MediaName.Port.Value
+		if port <= 0 || port >= 65535 {
+			return fmt.Errorf("invalid port of media %d: %d", i, port)
+		}
+
+		ip, err := sdpConnectionIP(&desc, media)
+		if err != nil {
+			return err
+		}
+
+		rtpConns[i], err = sdpListen(ip, port)
+		if err != nil {
+			return err
+		}
+		conns = append(conns, rtpConns[i])
+
+		rtcpConns[i], err = sdpListen(ip, port+1)
+		if err != nil {
+			return err
+		}
+		conns = append(conns, rtcpConns[i])
+
+		s.log(logger.Debug, "media %d: listening on port %d (RTP) and %d (RTCP)", i, port, port+1)
+	}
+
+	res := s.parent.onSourceStaticSetReady(pathSourceStaticSetReadyReq{
+		Source: s,
+		Tracks: tracks,
+	})
+	if res.Err != nil {
+		return res.Err
+	}
+
+	s.log(logger.Info, "ready")
+	s.retry.onSuccess()
+
+	defer func() {
+		s.parent.OnSourceStaticSetNotReady(pathSourceStaticSetNotReadyReq{Source: s})
+	}()
+
+	lastPacketTime := time.Now().Unix()
+	readErr := make(chan error, len(conns))
+	var readWg sync.WaitGroup
+
+	read := func(conn *net.UDPConn, cb func([]byte)) {
+		defer readWg.Done()
+
+		for {
+			buf := make([]byte, sdpSourceMaxPacketSize)
+			n, err := conn.Read(buf)
+			if err != nil {
+				readErr <- err
+				return
+			}
+
+			atomic.StoreInt64(&lastPacketTime, time.Now().Unix())
+			cb(buf[:n])
+		}
+	}
+
+	for i := range tracks {
+		trackID := i
+
+		readWg.Add(2)
+		go read(rtpConns[i], func(byts []byte) {
+			res.Stream.onPacketRTP(trackID, byts)
+		})
+		go read(rtcpConns[i], func(byts []byte) {
+			res.Stream.onPacketRTCP(trackID, byts)
+		})
+	}
+
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+		readWg.Wait()
+	}()
+
+	checkTicker := time.NewTicker(sdpSourceCheckPeriod)
+	defer checkTicker.Stop()
+
+	for {
+		select {
+		case <-checkTicker.C:
+			last := time.Unix(atomic.LoadInt64(&lastPacketTime), 0)
+			if time.Since(last) >= time.Duration(s.readTimeout) {
+				return fmt.Errorf("no packets received recently")
+			}
+
+		case err := <-readErr:
+			return err
+
+		case <-s.ctx.Done():
+			return nil
+		}
+	}
+}
+
+// onSourceAPIDescribe implements source.
+func (s *sdpSource) onSourceAPIDescribe() interface{} {
+	return struct {
+		Type string `json:"type"`
+	}{"sdpSource"}
+}
@@ -0,0 +1,93 @@
+package core
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSDPSource(t *testing.T) {
+	tmpf, err := writeTempFile([]byte("v=0\r\n" +
+		"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+		"s=Stream\r\n" +
+		"c=IN IP4 127.0.0.1\r\n" +
+		"t=0 0\r\n" +
+		"m=video 9300 RTP/AVP 96\r\n" +
+		"a=rtpmap:96 H264/90000\r\n" +
+		"a=fmtp:96 packetization-mode=1; sprop-parameter-sets=Z2QAKKy0A8ARPyo=,aO48sA==\r\n"))
+	require.NoError(t, err)
+	defer os.Remove(tmpf)
+
+	// the source is recognized by the file extension
+	err = os.Rename(tmpf, tmpf+".sdp")
+	require.NoError(t, err)
+	defer os.Remove(tmpf + ".sdp")
+
+	p, ok := newInstance("hlsDisable: yes\n" +
+		"rtmpDisable: yes\n" +
+		"paths:\n" +
+		"  encoder:\n" +
+		"    source: " + tmpf + ".sdp\n")
+	require.Equal(t, true, ok)
+	defer p.close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	received := make(chan []byte)
+
+	c := gortsplib.Client{
+		OnPacketRTP: func(trackID int, payload []byte) {
+			select {
+			case received <- payload:
+			default:
+			}
+		},
+	}
+
+	err = c.StartReading("rtsp://localhost:8554/encoder")
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.Equal(t, 1, len(c.Tracks()))
+	require.Equal(t, true, c.Tracks()[0].IsH264())
+
+	conn, err := net.Dial("udp", "127.0.0.1:9300")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	pkt := rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    96,
+			SequenceNumber: 123,
+			Timestamp:      45343,
+			SSRC:           563423,
+			Marker:         true,
+		},
+		Payload: []byte{0x05, 0x02, 0x03, 0x04},
+	}
+	byts, err := pkt.Marshal()
+	require.NoError(t, err)
+
+	go func() {
+		for i := 0; i < 10; i++ {
+			conn.Write(byts)
+			time.Sleep(100 * time.Millisecond)
+		}
+	}()
+
+	select {
+	case payload := <-received:
+		var recv rtp.Packet
+		err := recv.Unmarshal(payload)
+		require.NoError(t, err)
+		require.Equal(t, pkt.Payload, recv.Payload)
+	case <-time.After(2 * time.Second):
+		t.Errorf("no packets received")
+	}
+}
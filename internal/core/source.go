@@ -10,3 +10,9 @@ type sourceStatic interface {
 	source
 	close()
 }
+
+// sourceUDPDrops is implemented by sources that receive packets through
+// UDP sockets, whose drops can be measured.
+type sourceUDPDrops interface {
+	onSourceUDPDrops() (uint64, bool)
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+)
+
+// sourceRetry computes the pause between connection attempts of a static source,
+// that grows exponentially with the number of consecutive failures.
+type sourceRetry struct {
+	// fields accessed atomically must be placed first
+	// in order to be aligned on 32-bit platforms.
+	failures uint64
+
+	pause    time.Duration
+	maxPause time.Duration
+	jitter   int
+	maxCount int
+}
+
+func newSourceRetry(pconf *conf.PathConf) *sourceRetry {
+	return &sourceRetry{
+		pause:    time.Duration(pconf.SourceRetryPause),
+		maxPause: time.Duration(pconf.SourceRetryMaxPause),
+		jitter:   pconf.SourceRetryJitter,
+		maxCount: pconf.SourceRetryMaxCount,
+	}
+}
+
+// onSuccess is called when the source becomes ready.
+func (r *sourceRetry) onSuccess() {
+	atomic.StoreUint64(&r.failures, 0)
+}
+
+// onFailure is called when the source fails. It returns the pause before
+// the next attempt, or false if the source must not be retried anymore.
+func (r *sourceRetry) onFailure() (time.Duration, bool) {
+	failures := atomic.AddUint64(&r.failures, 1)
+
+	if r.maxCount != 0 && failures > uint64(r.maxCount) {
+		return 0, false
+	}
+
+	pause := r.pause
+	for i := uint64(1); i < failures && pause < r.maxPause; i++ {
+		pause *= 2
+	}
+	if pause > r.maxPause {
+		pause = r.maxPause
+	}
+
+	if r.jitter != 0 {
+		// random value between -jitter and +jitter percent
+		delta := time.Duration(float64(pause) * float64(r.jitter) / 100 * (2*rand.Float64() - 1))
+		pause += delta
+	}
+
+	return pause, true
+}
+
+// consecutiveFailures returns the number of failures since the source was last ready.
+func (r *sourceRetry) consecutiveFailures() uint64 {
+	return atomic.LoadUint64(&r.failures)
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+)
+
+func TestSourceRetry(t *testing.T) {
+	r := newSourceRetry(&conf.PathConf{
+		SourceRetryPause:    conf.StringDuration(1 * time.Second),
+		SourceRetryMaxPause: conf.StringDuration(5 * time.Second),
+		SourceRetryMaxCount: 5,
+	})
+
+	for _, exp := range []time.Duration{
+		1 * time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		5 * time.Second,
+		5 * time.Second,
+	} {
+		pause, ok := r.onFailure()
+		require.Equal(t, true, ok)
+		require.Equal(t, exp, pause)
+	}
+
+	_, ok := r.onFailure()
+	require.Equal(t, false, ok)
+	require.Equal(t, uint64(6), r.consecutiveFailures())
+
+	r.onSuccess()
+	require.Equal(t, uint64(0), r.consecutiveFailures())
+
+	pause, ok := r.onFailure()
+	require.Equal(t, true, ok)
+	require.Equal(t, 1*time.Second, pause)
+}
+
+func TestSourceRetryJitter(t *testing.T) {
+	r := newSourceRetry(&conf.PathConf{
+		SourceRetryPause:    conf.StringDuration(10 * time.Second),
+		SourceRetryMaxPause: conf.StringDuration(10 * time.Second),
+		SourceRetryJitter:   20,
+	})
+
+	for i := 0; i < 100; i++ {
+		pause, ok := r.onFailure()
+		require.Equal(t, true, ok)
+		require.GreaterOrEqual(t, pause, 8*time.Second)
+		require.LessOrEqual(t, pause, 12*time.Second)
+	}
+}
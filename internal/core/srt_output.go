@@ -0,0 +1,338 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/aler9/gortsplib/pkg/ringbuffer"
+	"github.com/aler9/gortsplib/pkg/rtpaac"
+	"github.com/aler9/gortsplib/pkg/rtph264"
+	"github.com/pion/rtp"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+	"github.com/aler9/rtsp-simple-server/internal/mpegts"
+	"github.com/aler9/rtsp-simple-server/internal/redact"
+	"github.com/aler9/rtsp-simple-server/internal/srt"
+)
+
+const (
+	srtOutputRetryPause = 5 * time.Second
+)
+
+type srtOutputTrackIDPayloadPair struct {
+	trackID int
+	buf     []byte
+}
+
+type srtOutputParent interface {
+	log(logger.Level, string, ...interface{})
+}
+
+// srtOutput reads the stream of a path and sends it to a SRT receiver, remuxed into MPEG-TS.
+// In caller mode, it connects to the receiver; in listener mode, it waits for a receiver at a time.
+type srtOutput struct {
+	// fields accessed atomically must be placed first
+	// in order to be aligned on 32-bit platforms.
+	bytesSent uint64
+
+	ur              string
+	readTimeout     conf.StringDuration
+	readBufferCount int
+	stream          *stream
+	parent          srtOutputParent
+
+	created    time.Time
+	ctx        context.Context
+	ctxCancel  func()
+	done       chan struct{}
+	ringBuffer *ringbuffer.RingBuffer
+	remoteAddr string
+	mutex      sync.RWMutex
+}
+
+func newSRTOutput(
+	parentCtx context.Context,
+	ur string,
+	readTimeout conf.StringDuration,
+	readBufferCount int,
+	stream *stream,
+	parent srtOutputParent) *srtOutput {
+	ctx, ctxCancel := context.WithCancel(parentCtx)
+
+	o := &srtOutput{
+		ur:              ur,
+		readTimeout:     readTimeout,
+		readBufferCount: readBufferCount,
+		stream:          stream,
+		parent:          parent,
+		created:         time.Now(),
+		ctx:             ctx,
+		ctxCancel:       ctxCancel,
+		done:            make(chan struct{}),
+	}
+
+	o.log(logger.Info, "started")
+
+	go o.run()
+
+	return o
+}
+
+// close stops the output and waits for its routine to exit.
+func (o *srtOutput) close() {
+	o.log(logger.Info, "stopped")
+	o.ctxCancel()
+	<-o.done
+}
+
+func (o *srtOutput) log(level logger.Level, format string, args ...interface{}) {
+	o.parent.log(level, "[SRT output] "+format, args...)
+}
+
+func (o *srtOutput) run() {
+	defer close(o.done)
+
+	// the URL has already been checked by the configuration
+	u, _ := srt.ParseURL(o.ur)
+
+	var videoTrack *gortsplib.Track
+	videoTrackID := -1
+	var audioTrack *gortsplib.Track
+	audioTrackID := -1
+
+	for i, t := range o.stream.tracks() {
+		switch {
+		case t.IsH264() && videoTrack == nil:
+			videoTrack = t
+			videoTrackID = i
+
+		case t.IsAAC() && audioTrack == nil:
+			audioTrack = t
+			audioTrackID = i
+		}
+	}
+
+	// the stream doesn't change until the source is replaced, therefore the output is not retried.
+	if videoTrack == nil && audioTrack == nil {
+		o.log(logger.Error, "the stream doesn't contain an H264 track or an AAC track")
+		<-o.ctx.Done()
+		return
+	}
+
+	var l *srt.Listener
+	if u.Mode == srt.ModeListener {
+		var err error
+		l, err = srt.Listen(u)
+		if err != nil {
+			o.log(logger.Error, "%s", err)
+			<-o.ctx.Done()
+			return
+		}
+		defer l.Close()
+
+		o.log(logger.Info, "listener opened on %s", l.Addr())
+	}
+
+	for {
+		err := o.runInner(u, l, videoTrack, videoTrackID, audioTrack, audioTrackID)
+		if err == nil {
+			return
+		}
+
+		o.log(logger.Info, "ERR: %s", err)
+
+		// in listener mode, the next receiver is accepted immediately
+		if l != nil {
+			continue
+		}
+
+		select {
+		case <-time.After(srtOutputRetryPause):
+		case <-o.ctx.Done():
+			return
+		}
+	}
+}
+
+func (o *srtOutput) connect(u *srt.URL, l *srt.Listener) (*srt.Conn, error) {
+	if l != nil {
+		return l.Accept(o.ctx)
+	}
+
+	o.log(logger.Debug, "connecting to %s", redact.Text(o.ur))
+
+	ctx, cancel := context.WithTimeout(o.ctx, time.Duration(o.readTimeout))
+	defer cancel()
+
+	return srt.Dial(ctx, u)
+}
+
+func (o *srtOutput) runInner(
+	u *srt.URL,
+	l *srt.Listener,
+	videoTrack *gortsplib.Track,
+	videoTrackID int,
+	audioTrack *gortsplib.Track,
+	audioTrackID int,
+) error {
+	conn, err := o.connect(u, l)
+	if err != nil {
+		select {
+		case <-o.ctx.Done():
+			return nil
+		default:
+			return err
+		}
+	}
+	defer conn.Close()
+
+	w, err := mpegts.NewWriter(conn, videoTrack, audioTrack)
+	if err != nil {
+		return err
+	}
+
+	o.log(logger.Info, "sending to %s (latency %v)", conn.RemoteAddr(), conn.Latency())
+
+	ringBuffer := ringbuffer.New(uint64(o.readBufferCount))
+
+	o.mutex.Lock()
+	o.ringBuffer = ringBuffer
+	o.remoteAddr = conn.RemoteAddr().String()
+	o.mutex.Unlock()
+
+	defer func() {
+		o.mutex.Lock()
+		o.ringBuffer = nil
+		o.remoteAddr = ""
+		o.mutex.Unlock()
+	}()
+
+	writeDone := make(chan error)
+	go func() {
+		writeDone <- o.writePackets(w, ringBuffer, videoTrackID, audioTrack, audioTrackID)
+	}()
+
+	select {
+	case err := <-writeDone:
+		return err
+
+	case <-o.ctx.Done():
+		ringBuffer.Close()
+		<-writeDone
+		return nil
+	}
+}
+
+func (o *srtOutput) writePackets(
+	w *mpegts.Writer,
+	ringBuffer *ringbuffer.RingBuffer,
+	videoTrackID int,
+	audioTrack *gortsplib.Track,
+	audioTrackID int,
+) error {
+	h264Decoder := rtph264.NewDecoder()
+
+	var aacDecoder *rtpaac.Decoder
+	if audioTrack != nil {
+		clockRate, _ := audioTrack.ClockRate()
+		aacDecoder = rtpaac.NewDecoder(clockRate)
+	}
+
+	for {
+		data, ok := ringBuffer.Pull()
+		if !ok {
+			return fmt.Errorf("terminated")
+		}
+		pair := data.(srtOutputTrackIDPayloadPair)
+
+		var pkt rtp.Packet
+		err := pkt.Unmarshal(pair.buf)
+		if err != nil {
+			o.log(logger.Warn, "unable to decode RTP packet: %v", err)
+			continue
+		}
+
+		switch pair.trackID {
+		case videoTrackID:
+			nalus, pts, err := h264Decoder.DecodeUntilMarker(&pkt)
+			if err != nil {
+				if err != rtph264.ErrMorePacketsNeeded &&
+					err != rtph264.ErrNonStartingPacketAndNoPrevious {
+					o.log(logger.Warn, "unable to decode video track: %v", err)
+				}
+				continue
+			}
+
+			err = w.WriteH264(pts, nalus)
+			if err != nil {
+				return err
+			}
+
+		case audioTrackID:
+			aus, pts, err := aacDecoder.Decode(&pkt)
+			if err != nil {
+				if err != rtpaac.ErrMorePacketsNeeded {
+					o.log(logger.Warn, "unable to decode audio track: %v", err)
+				}
+				continue
+			}
+
+			err = w.WriteAAC(pts, aus)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ID implements reader.
+func (o *srtOutput) ID() string {
+	return "srtOutput"
+}
+
+// onReaderAccepted implements reader.
+func (o *srtOutput) onReaderAccepted() {
+}
+
+// onReaderPacketRTP implements reader.
+func (o *srtOutput) onReaderPacketRTP(trackID int, payload []byte) {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+
+	// packets are discarded while there's no receiver
+	if o.ringBuffer != nil {
+		atomic.AddUint64(&o.bytesSent, uint64(len(payload)))
+		o.ringBuffer.Push(srtOutputTrackIDPayloadPair{trackID, payload})
+	}
+}
+
+// onReaderPacketRTCP implements reader.
+func (o *srtOutput) onReaderPacketRTCP(trackID int, payload []byte) {
+}
+
+// onReaderAPIDescribe implements reader.
+func (o *srtOutput) onReaderAPIDescribe() interface{} {
+	return struct {
+		Type string `json:"type"`
+	}{"srtOutput"}
+}
+
+// onReaderAPIReadersItem implements reader.
+func (o *srtOutput) onReaderAPIReadersItem() pathAPIPathsReadersItem {
+	o.mutex.RLock()
+	remoteAddr := o.remoteAddr
+	o.mutex.RUnlock()
+
+	return pathAPIPathsReadersItem{
+		Type:       "srtOutput",
+		Protocol:   "srt",
+		RemoteAddr: remoteAddr,
+		Created:    o.created,
+		BytesSent:  atomic.LoadUint64(&o.bytesSent),
+	}
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aler9/rtsp-simple-server/internal/srt"
+)
+
+func TestSRTOutput(t *testing.T) {
+	p, ok := newInstance("api: yes\n" +
+		"hlsDisable: yes\n" +
+		"paths:\n" +
+		"  source:\n" +
+		"    source: testsrc\n" +
+		"    testsrcWidth: 160\n" +
+		"    testsrcHeight: 120\n" +
+		"    testsrcFPS: 10\n" +
+		"    srtOutput: srt://127.0.0.1:9710?mode=listener&streamid=source\n")
+	require.Equal(t, true, ok)
+	defer p.close()
+
+	time.Sleep(1 * time.Second)
+
+	u, err := srt.ParseURL("srt://127.0.0.1:9710?streamid=source")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := srt.Dial(ctx, u)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	time.Sleep(1 * time.Second)
+
+	var out struct {
+		Items []struct {
+			Type       string `json:"type"`
+			Protocol   string `json:"protocol"`
+			RemoteAddr string `json:"remoteAddr"`
+			BytesSent  uint64 `json:"bytesSent"`
+		} `json:"items"`
+	}
+	err = httpRequest(http.MethodGet, "http://localhost:9997/v1/paths/readers/source", nil, &out)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(out.Items))
+	require.Equal(t, "srtOutput", out.Items[0].Type)
+	require.Equal(t, "srt", out.Items[0].Protocol)
+	require.NotEqual(t, "", out.Items[0].RemoteAddr)
+	require.NotZero(t, out.Items[0].BytesSent)
+}
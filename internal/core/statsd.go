@@ -0,0 +1,199 @@
+package core
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+// maximum size of a packet, that avoids fragmentation on common networks.
+const statsdMaxPacketSize = 1432
+
+// statsdTagReplacer replaces characters that are not allowed in tags.
+var statsdTagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "@", "_", "\n", "_")
+
+// statsdMetric converts a metric in the Prometheus text format into
+// a gauge in the DogStatsD format. Labels are converted into tags.
+func statsdMetric(prefix string, tags string, line string) (string, bool) {
+	i := strings.LastIndexByte(line, ' ')
+	if i < 0 {
+		return "", false
+	}
+	key, value := line[:i], line[i+1:]
+
+	name := key
+	var labels []string
+
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		name = key[:start]
+		rest := strings.TrimSuffix(key[start+1:], "}")
+
+		for rest != "" {
+			j := strings.Index(rest, "=\"")
+			if j < 0 {
+				return "", false
+			}
+			k := rest[:j]
+			rest = rest[j+2:]
+
+			// values are quoted and can contain escaped quotes
+			var v strings.Builder
+			for {
+				if rest == "" {
+					return "", false
+				}
+				if rest[0] == '\\' && len(rest) >= 2 {
+					v.WriteByte(rest[1])
+					rest = rest[2:]
+					continue
+				}
+				if rest[0] == '"' {
+					rest = rest[1:]
+					break
+				}
+				v.WriteByte(rest[0])
+				rest = rest[1:]
+			}
+
+			labels = append(labels, k+":"+statsdTagReplacer.Replace(v.String()))
+			rest = strings.TrimPrefix(rest, ",")
+		}
+	}
+
+	if tags != "" {
+		labels = append(labels, tags)
+	}
+
+	out := prefix + "." + name + ":" + value + "|g"
+	if len(labels) != 0 {
+		out += "|#" + strings.Join(labels, ",")
+	}
+	return out, true
+}
+
+type statsdParent interface {
+	Log(logger.Level, string, ...interface{})
+}
+
+type statsd struct {
+	metricsSources
+
+	prefix   string
+	tags     string
+	interval time.Duration
+	parent   statsdParent
+
+	ctx       context.Context
+	ctxCancel func()
+	conn      net.Conn
+	done      chan struct{}
+}
+
+func newStatsD(
+	address string,
+	prefix string,
+	tags conf.StatsDTags,
+	interval conf.StringDuration,
+	parent statsdParent,
+) (*statsd, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	// tags are sorted in order to obtain the same output every time
+	var tagList []string
+	for k, v := range tags {
+		tagList = append(tagList, k+":"+v)
+	}
+	sort.Strings(tagList)
+
+	ctx, ctxCancel := context.WithCancel(context.Background())
+
+	s := &statsd{
+		prefix:    prefix,
+		tags:      strings.Join(tagList, ","),
+		interval:  time.Duration(interval),
+		parent:    parent,
+		ctx:       ctx,
+		ctxCancel: ctxCancel,
+		conn:      conn,
+		done:      make(chan struct{}),
+	}
+
+	s.log(logger.Info, "sending metrics to "+address)
+
+	go s.run()
+
+	return s, nil
+}
+
+func (s *statsd) close() {
+	s.ctxCancel()
+	<-s.done
+	s.conn.Close()
+	s.log(logger.Info, "closed")
+}
+
+func (s *statsd) log(level logger.Level, format string, args ...interface{}) {
+	s.parent.Log(level, "[statsd] "+format, args...)
+}
+
+func (s *statsd) run() {
+	defer close(s.done)
+
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			err := s.send()
+			if err != nil {
+				s.log(logger.Warn, "unable to send metrics: %s", err)
+			}
+
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// send sends all metrics, grouped into packets.
+func (s *statsd) send() error {
+	var buf []byte
+
+	for _, line := range strings.Split(s.collect(), "\n") {
+		m, ok := statsdMetric(s.prefix, s.tags, line)
+		if !ok {
+			continue
+		}
+
+		if len(buf) != 0 && (len(buf)+1+len(m)) > statsdMaxPacketSize {
+			_, err := s.conn.Write(buf)
+			if err != nil {
+				return err
+			}
+			buf = buf[:0]
+		}
+
+		if len(buf) != 0 {
+			buf = append(buf, '\n')
+		}
+		buf = append(buf, m...)
+	}
+
+	if len(buf) != 0 {
+		_, err := s.conn.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
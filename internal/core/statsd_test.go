@@ -0,0 +1,98 @@
+package core
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+type testStatsDParent struct{}
+
+func (testStatsDParent) Log(logger.Level, string, ...interface{}) {}
+
+type testStatsDLimiter struct{}
+
+func (*testStatsDLimiter) rejected() (int64, int64) {
+	return 3, 4
+}
+
+func (*testStatsDLimiter) rateLimited() int64 {
+	return 5
+}
+
+func TestStatsDMetric(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		tags string
+		line string
+		out  string
+	}{
+		{
+			"plain",
+			"",
+			"rejected_connections 0",
+			"pref.rejected_connections:0|g",
+		},
+		{
+			"labels",
+			"",
+			"paths{name=\"my,path\",state=\"ready\"} 1",
+			"pref.paths:1|g|#name:my_path,state:ready",
+		},
+		{
+			"labels and tags",
+			"env:prod",
+			"rtsp_session_jitter_ms{id=\"123\"} 1.5",
+			"pref.rtsp_session_jitter_ms:1.5|g|#id:123,env:prod",
+		},
+		{
+			"escaped quote",
+			"",
+			"paths{name=\"a\\\"b\"} 1",
+			"pref.paths:1|g|#name:a\"b",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			out, ok := statsdMetric("pref", ca.tags, ca.line)
+			require.Equal(t, true, ok)
+			require.Equal(t, ca.out, out)
+		})
+	}
+
+	_, ok := statsdMetric("pref", "", "")
+	require.Equal(t, false, ok)
+}
+
+func TestStatsD(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+
+	s, err := newStatsD(
+		pc.LocalAddr().String(),
+		"myprefix",
+		conf.StatsDTags{"region": "eu", "env": "prod"},
+		conf.StringDuration(100*time.Millisecond),
+		testStatsDParent{})
+	require.NoError(t, err)
+	defer s.close()
+
+	s.onLimiterSet(&testStatsDLimiter{})
+
+	pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 2048)
+	n, _, err := pc.ReadFrom(buf)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"myprefix.rejected_connections:3|g|#env:prod,region:eu",
+		"myprefix.rejected_sessions:4|g|#env:prod,region:eu",
+		"myprefix.rate_limited_connections:5|g|#env:prod,region:eu",
+	}, strings.Split(string(buf[:n]), "\n"))
+}
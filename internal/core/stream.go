@@ -1,9 +1,16 @@
 package core
 
 import (
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/aler9/gortsplib"
+	"github.com/notedit/rtmp/format/flv/flvio"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
 )
 
 type streamNonRTSPReadersMap struct {
@@ -53,20 +60,195 @@ func (m *streamNonRTSPReadersMap) forwardPacketRTCP(trackID int, payload []byte)
 	}
 }
 
+// unusedPayloadType returns a payload type that is not used by other tracks.
+func unusedPayloadType(tracks gortsplib.Tracks) uint8 {
+	used := make(map[string]struct{})
+	for _, t := range tracks {
+		for _, f := range t.Media.MediaName.Formats {
+			used[f] = struct{}{}
+		}
+	}
+
+	for pt := uint8(96); pt < 128; pt++ {
+		if _, ok := used[strconv.FormatInt(int64(pt), 10)]; !ok {
+			return pt
+		}
+	}
+	return 96
+}
+
 type stream struct {
-	nonRTSPReaders *streamNonRTSPReadersMap
-	rtspStream     *gortsplib.ServerStream
+	// fields accessed atomically must be placed first
+	// in order to be aligned on 32-bit platforms.
+	readersCount int64
+	bytesSent    uint64
+
+	sourceTracksCount int
+	stripExtensions   bool
+	stripPadding      bool
+	ignoreRTCP        bool
+	nonRTSPReaders    *streamNonRTSPReadersMap
+	rtspStream        *gortsplib.ServerStream
+	info              *streamInfo
+	qos               *streamQoS
+	silentAudio       *streamSilentAudio
+	hold              *streamHold
+	rtcpSender        *streamRTCPSender
+	timecodeSEI       *streamTimecodeSEI
+	clockDrift        *streamClockDrift
+	ssrc              *streamSSRC
+	motion            *streamMotion
+	inference         *streamInference
+	fec               *streamFEC
+	impairment        *streamImpairment
+	sap               *streamSAP
+	srtp              *streamSRTP
+	quota             *quotasTenant
+
+	rtmpMetadataMutex sync.RWMutex
+	rtmpMetadata      flvio.AMFMap
 }
 
-func newStream(tracks gortsplib.Tracks) *stream {
+func newStream(
+	tracks gortsplib.Tracks,
+	pathConf *conf.PathConf,
+	quota *quotasTenant,
+) *stream {
+	sourceTracksCount := len(tracks)
+	silentAudioTrackID := -1
+	var silentAudioPT uint8
+
+	if pathConf.InjectSilentAudio && !tracksHaveAudio(tracks) {
+		silentAudioPT = unusedPayloadType(tracks)
+		track, err := gortsplib.NewTrackAAC(silentAudioPT, &gortsplib.TrackConfigAAC{
+			Type:         2,
+			SampleRate:   silentAudioSampleRate,
+			ChannelCount: 1,
+		})
+		if err == nil {
+			// do not modify the tracks of the source
+			tracks = append(append(gortsplib.Tracks(nil), tracks...), track)
+			silentAudioTrackID = len(tracks) - 1
+		}
+	}
+
+	var fecTrackIDs []int
+
+	if pathConf.FlexFEC {
+		fecTrackIDs = make([]int, len(tracks))
+		for trackID := range fecTrackIDs {
+			fecTrackIDs[trackID] = -1
+		}
+
+		// do not modify the tracks of the source
+		tracks = append(gortsplib.Tracks(nil), tracks...)
+
+		for trackID := 0; trackID < sourceTracksCount; trackID++ {
+			if tracks[trackID].Media.MediaName.Media == "video" {
+				tracks = append(tracks, fecTrack(unusedPayloadType(tracks)))
+				fecTrackIDs[trackID] = len(tracks) - 1
+			}
+		}
+	}
+
+	inferenceTrackID := -1
+	metadataTrackID := -1
+
+	if pathConf.InferenceURL != "" {
+		for trackID := 0; trackID < sourceTracksCount; trackID++ {
+			if tracks[trackID].IsH264() {
+				// do not modify the tracks of the source
+				tracks = append(append(gortsplib.Tracks(nil), tracks...), metadataTrack(unusedPayloadType(tracks)))
+				inferenceTrackID = trackID
+				metadataTrackID = len(tracks) - 1
+				break
+			}
+		}
+	}
+
+	if pathConf.SanitizeReaderSDP {
+		tracks = sdpSanitizeTracks(tracks)
+	}
+
 	s := &stream{
-		nonRTSPReaders: newStreamNonRTSPReadersMap(),
-		rtspStream:     gortsplib.NewServerStream(tracks),
+		sourceTracksCount: sourceTracksCount,
+		stripExtensions:   pathConf.StripRTPHeaderExtensions,
+		stripPadding:      pathConf.StripRTPPadding,
+		ignoreRTCP:        pathConf.SourceQuirks.Has(conf.QuirkIgnoreRTCP),
+		nonRTSPReaders:    newStreamNonRTSPReadersMap(),
+		rtspStream:        gortsplib.NewServerStream(tracks),
+		info:              newStreamInfo(tracks),
+		qos:               newStreamQoS(tracks[:sourceTracksCount]),
+		quota:             quota,
+	}
+
+	if silentAudioTrackID >= 0 {
+		s.silentAudio = newStreamSilentAudio(silentAudioTrackID, silentAudioPT, s.writePacketRTP)
+	}
+
+	if pathConf.SourceOutageHold != 0 {
+		s.hold = newStreamHold(tracks, s.writePacketRTP)
+	}
+
+	if pathConf.SourceQuirks.Has(conf.QuirkSSRCChange) {
+		s.ssrc = newStreamSSRC(sourceTracksCount)
 	}
+
+	if pathConf.InsertTimecodeSEI {
+		s.timecodeSEI = newStreamTimecodeSEI(tracks)
+	}
+
+	if pathConf.MulticastEncryption {
+		s.srtp = newStreamSRTP()
+	}
+
+	if pathConf.ClockDriftCompensation {
+		clockDrift := newStreamClockDrift(tracks[:sourceTracksCount])
+		if clockDrift.enabled() {
+			s.clockDrift = clockDrift
+		}
+	}
+
+	if inferenceTrackID >= 0 {
+		s.inference = newStreamInference(tracks, inferenceTrackID, metadataTrackID, s.forwardPacketRTP)
+	}
+
+	if fecTrackIDs != nil {
+		s.fec = newStreamFEC(tracks, fecTrackIDs, pathConf.FlexFECGroupSize, s.forwardPacketRTP)
+	}
+
+	if pathConf.HasImpairment() {
+		s.impairment = newStreamImpairment(
+			pathConf.ImpairmentLoss,
+			pathConf.ImpairmentReorder,
+			time.Duration(pathConf.ImpairmentLatency),
+			s.sendPacketRTP)
+	}
+
+	s.rtcpSender = newStreamRTCPSender(tracks, s.writePacketRTCP)
+
 	return s
 }
 
 func (s *stream) close() {
+	if s.hold != nil {
+		s.hold.stop()
+	}
+	if s.silentAudio != nil {
+		s.silentAudio.close()
+	}
+	if s.motion != nil {
+		s.motion.close()
+	}
+	if s.impairment != nil {
+		s.impairment.close()
+	}
+	if s.sap != nil {
+		s.sap.close()
+	}
+	s.rtcpSender.close()
+	s.info.close()
+	s.qos.close()
 	s.nonRTSPReaders.close()
 	s.rtspStream.Close()
 }
@@ -75,29 +257,197 @@ func (s *stream) tracks() gortsplib.Tracks {
 	return s.rtspStream.Tracks()
 }
 
+// acceptsSourceTracks checks whether a new source with the given tracks
+// can write to the stream, in place of the previous one.
+func (s *stream) acceptsSourceTracks(tracks gortsplib.Tracks) bool {
+	own := s.tracks()[:s.sourceTracksCount]
+
+	if len(own) != len(tracks) {
+		return false
+	}
+
+	for i, track := range tracks {
+		cr1, _ := track.ClockRate()
+		cr2, _ := own[i].ClockRate()
+
+		if trackCodecName(track) != trackCodecName(own[i]) ||
+			cr1 != cr2 ||
+			strings.Join(track.Media.MediaName.Formats, " ") != strings.Join(own[i].Media.MediaName.Formats, " ") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sourceBytes returns the bytes received from the source,
+// excluding the ones of the tracks added by the server.
+func (s *stream) sourceBytes() uint64 {
+	n := uint64(0)
+	for trackID := 0; trackID < s.sourceTracksCount; trackID++ {
+		n += s.info.bytes(trackID)
+	}
+	return n
+}
+
+// egressBytes returns the bytes sent to readers, estimated by
+// multiplying the bytes of every packet by the number of readers.
+func (s *stream) egressBytes() uint64 {
+	return atomic.LoadUint64(&s.bytesSent)
+}
+
+// setRTMPMetadata stores the metadata sent by a RTMP publisher,
+// in order to forward it to RTMP readers.
+func (s *stream) setRTMPMetadata(md flvio.AMFMap) {
+	s.rtmpMetadataMutex.Lock()
+	defer s.rtmpMetadataMutex.Unlock()
+	s.rtmpMetadata = md
+}
+
+func (s *stream) getRTMPMetadata() flvio.AMFMap {
+	s.rtmpMetadataMutex.RLock()
+	defer s.rtmpMetadataMutex.RUnlock()
+	return s.rtmpMetadata
+}
+
 func (s *stream) readerAdd(r reader) {
+	atomic.AddInt64(&s.readersCount, 1)
+
 	if _, ok := r.(pathRTSPSession); !ok {
 		s.nonRTSPReaders.add(r)
 	}
 }
 
 func (s *stream) readerRemove(r reader) {
+	atomic.AddInt64(&s.readersCount, -1)
+
 	if _, ok := r.(pathRTSPSession); !ok {
 		s.nonRTSPReaders.remove(r)
 	}
 }
 
 func (s *stream) onPacketRTP(trackID int, payload []byte) {
+	s.qos.processPacketRTP(time.Now(), trackID, payload)
+
+	if s.quota != nil {
+		s.quota.onBytesReceived(uint64(len(payload)))
+	}
+
+	if s.stripExtensions || s.stripPadding {
+		payload = rtpNormalize(payload, s.stripExtensions, s.stripPadding)
+	}
+
+	if s.ssrc != nil {
+		s.ssrc.process(trackID, payload)
+	}
+
+	if s.clockDrift != nil {
+		s.clockDrift.processPacketRTP(time.Now(), trackID, payload)
+	}
+
+	if s.motion != nil {
+		s.motion.process(trackID, payload)
+	}
+
+	if s.inference != nil {
+		s.inference.process(trackID, payload)
+	}
+
+	if s.hold != nil {
+		payload = s.hold.processSource(trackID, payload)
+		if payload == nil {
+			return
+		}
+	}
+
+	s.writePacketRTP(trackID, payload)
+}
+
+func (s *stream) writePacketRTP(trackID int, payload []byte) {
+	if s.timecodeSEI != nil {
+		for _, byts := range s.timecodeSEI.process(trackID, payload) {
+			s.forwardPacketRTP(trackID, byts)
+		}
+		return
+	}
+
+	s.forwardPacketRTP(trackID, payload)
+}
+
+func (s *stream) forwardPacketRTP(trackID int, payload []byte) {
+	s.info.onPacketRTP(trackID, payload)
+	s.rtcpSender.processPacketRTP(trackID, payload)
+
+	if s.fec != nil {
+		s.fec.processPacketRTP(trackID, payload)
+	}
+
+	if s.impairment != nil {
+		s.impairment.process(trackID, payload)
+		return
+	}
+
+	s.sendPacketRTP(trackID, payload)
+}
+
+func (s *stream) sendPacketRTP(trackID int, payload []byte) {
+	n := uint64(len(payload)) * uint64(atomic.LoadInt64(&s.readersCount))
+	atomic.AddUint64(&s.bytesSent, n)
+
+	if s.quota != nil {
+		s.quota.onBytesSent(n)
+	}
+
 	// forward to RTSP readers
-	s.rtspStream.WritePacketRTP(trackID, payload)
+	if s.srtp != nil {
+		if byts := s.srtp.encryptRTP(payload); byts != nil {
+			s.rtspStream.WritePacketRTP(trackID, byts)
+		}
+	} else {
+		s.rtspStream.WritePacketRTP(trackID, payload)
+	}
 
 	// forward to non-RTSP readers
 	s.nonRTSPReaders.forwardPacketRTP(trackID, payload)
 }
 
 func (s *stream) onPacketRTCP(trackID int, payload []byte) {
+	if s.ignoreRTCP {
+		return
+	}
+
+	s.qos.processPacketRTCP(trackID, payload)
+
+	// sender reports are generated by rtcpSender, with the absolute time of the source.
+	if ntp, rtpTime, ok := rtcpSenderReport(payload); ok {
+		if s.clockDrift != nil {
+			rtpTime = s.clockDrift.processSenderReport(trackID, rtpTime)
+		}
+
+		if s.hold != nil {
+			offset, ok := s.hold.timestampOffset(trackID)
+			if !ok {
+				return
+			}
+			rtpTime += offset
+		}
+
+		s.rtcpSender.processSourceReport(trackID, ntp, rtpTime)
+		return
+	}
+
+	s.writePacketRTCP(trackID, payload)
+}
+
+func (s *stream) writePacketRTCP(trackID int, payload []byte) {
 	// forward to RTSP readers
-	s.rtspStream.WritePacketRTCP(trackID, payload)
+	if s.srtp != nil {
+		if byts := s.srtp.encryptRTCP(payload); byts != nil {
+			s.rtspStream.WritePacketRTCP(trackID, byts)
+		}
+	} else {
+		s.rtspStream.WritePacketRTCP(trackID, payload)
+	}
 
 	// forward to non-RTSP readers
 	s.nonRTSPReaders.forwardPacketRTCP(trackID, payload)
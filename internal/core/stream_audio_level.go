@@ -0,0 +1,168 @@
+package core
+
+import (
+	"math"
+	"sync"
+
+	"github.com/aler9/gortsplib"
+)
+
+// level that is reported when there's no signal, in dBFS.
+const audioLevelMin = -100
+
+type audioLevelCodec int
+
+const (
+	audioLevelCodecPCMU audioLevelCodec = iota
+	audioLevelCodecPCMA
+	audioLevelCodecL16
+)
+
+// g711ULawDecode decodes a G.711 mu-law sample.
+func g711ULawDecode(u byte) int16 {
+	u = ^u
+	t := (int16(u&0x0F) << 3) + 0x84
+	t <<= (u & 0x70) >> 4
+	if (u & 0x80) != 0 {
+		return 0x84 - t
+	}
+	return t - 0x84
+}
+
+// g711ALawDecode decodes a G.711 A-law sample.
+func g711ALawDecode(a byte) int16 {
+	a ^= 0x55
+	t := int16(a&0x0F) << 4
+	switch seg := (a & 0x70) >> 4; seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= seg - 1
+	}
+	if (a & 0x80) != 0 {
+		return t
+	}
+	return -t
+}
+
+// audioLevelDBFS converts a sample amplitude into dBFS.
+func audioLevelDBFS(v float64) float64 {
+	if v <= 0 {
+		return audioLevelMin
+	}
+	db := 20 * math.Log10(v/32768)
+	if db < audioLevelMin {
+		return audioLevelMin
+	}
+	return math.Round(db*10) / 10
+}
+
+type streamAudioLevelInfo struct {
+	RMS  float64 `json:"rms"`
+	Peak float64 `json:"peak"`
+}
+
+// streamAudioLevel computes the RMS and peak levels of an audio track,
+// in order to detect silent feeds. Only uncompressed and G.711 tracks are
+// supported, since they can be decoded without significant effort.
+type streamAudioLevel struct {
+	codec audioLevelCodec
+
+	mutex      sync.Mutex
+	sumSquares float64
+	count      int
+	peak       int
+	last       *streamAudioLevelInfo
+}
+
+// newStreamAudioLevel allocates a streamAudioLevel, or returns nil
+// if the codec of the track is not supported.
+func newStreamAudioLevel(track *gortsplib.Track) *streamAudioLevel {
+	if track.Media.MediaName.Media != "audio" || len(track.Media.MediaName.Formats) == 0 {
+		return nil
+	}
+
+	var codec audioLevelCodec
+
+	switch {
+	case track.Media.MediaName.Formats[0] == "0" || trackCodecName(track) == "PCMU":
+		codec = audioLevelCodecPCMU
+
+	case track.Media.MediaName.Formats[0] == "8" || trackCodecName(track) == "PCMA":
+		codec = audioLevelCodecPCMA
+
+	case trackCodecName(track) == "L16":
+		codec = audioLevelCodecL16
+
+	default:
+		return nil
+	}
+
+	return &streamAudioLevel{
+		codec: codec,
+	}
+}
+
+// process is called with the payload of every RTP packet of the track.
+func (l *streamAudioLevel) process(payload []byte) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	add := func(v int) {
+		if v < 0 {
+			v = -v
+		}
+		l.sumSquares += float64(v) * float64(v)
+		l.count++
+		if v > l.peak {
+			l.peak = v
+		}
+	}
+
+	switch l.codec {
+	case audioLevelCodecPCMU:
+		for _, b := range payload {
+			add(int(g711ULawDecode(b)))
+		}
+
+	case audioLevelCodecPCMA:
+		for _, b := range payload {
+			add(int(g711ALawDecode(b)))
+		}
+
+	case audioLevelCodecL16:
+		for i := 0; i+1 < len(payload); i += 2 {
+			add(int(int16(uint16(payload[i])<<8 | uint16(payload[i+1]))))
+		}
+	}
+}
+
+// update computes the levels of the samples received since the previous call.
+func (l *streamAudioLevel) update() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.count == 0 {
+		l.last = nil
+		return
+	}
+
+	l.last = &streamAudioLevelInfo{
+		RMS:  audioLevelDBFS(math.Sqrt(l.sumSquares / float64(l.count))),
+		Peak: audioLevelDBFS(float64(l.peak)),
+	}
+
+	l.sumSquares = 0
+	l.count = 0
+	l.peak = 0
+}
+
+// info returns the levels computed by the last update, or nil if no samples were received.
+func (l *streamAudioLevel) info() *streamAudioLevelInfo {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.last
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/aler9/gortsplib"
+	psdp "github.com/pion/sdp/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestG711Decode(t *testing.T) {
+	require.Equal(t, int16(0), g711ULawDecode(0xFF))
+	require.Equal(t, int16(0), g711ULawDecode(0x7F))
+	require.Equal(t, int16(-32124), g711ULawDecode(0x00))
+	require.Equal(t, int16(32124), g711ULawDecode(0x80))
+
+	require.Equal(t, int16(8), g711ALawDecode(0xD5))
+	require.Equal(t, int16(-8), g711ALawDecode(0x55))
+	require.Equal(t, int16(32256), g711ALawDecode(0xAA))
+	require.Equal(t, int16(-32256), g711ALawDecode(0x2A))
+}
+
+func TestStreamAudioLevel(t *testing.T) {
+	videoTrack, err := gortsplib.NewTrackH264(96, &gortsplib.TrackConfigH264{
+		SPS: []byte{0x01, 0x02, 0x03, 0x04},
+		PPS: []byte{0x01, 0x02, 0x03, 0x04},
+	})
+	require.NoError(t, err)
+	require.Nil(t, newStreamAudioLevel(videoTrack))
+
+	aacTrack, err := gortsplib.NewTrackAAC(97, &gortsplib.TrackConfigAAC{
+		Type:         2,
+		SampleRate:   44100,
+		ChannelCount: 2,
+	})
+	require.NoError(t, err)
+	require.Nil(t, newStreamAudioLevel(aacTrack))
+
+	t.Run("pcmu", func(t *testing.T) {
+		l := newStreamAudioLevel(newPCMUTrack())
+		require.NotNil(t, l)
+		require.Nil(t, l.info())
+
+		l.process([]byte{0xFF, 0x7F, 0xFF, 0x7F})
+		l.update()
+		require.Equal(t, &streamAudioLevelInfo{RMS: -100, Peak: -100}, l.info())
+
+		// no samples
+		l.update()
+		require.Nil(t, l.info())
+	})
+
+	t.Run("l16", func(t *testing.T) {
+		l := newStreamAudioLevel(&gortsplib.Track{
+			Media: &psdp.MediaDescription{
+				MediaName: psdp.MediaName{
+					Media:   "audio",
+					Protos:  []string{"RTP", "AVP"},
+					Formats: []string{"98"},
+				},
+				Attributes: []psdp.Attribute{
+					{Key: "rtpmap", Value: "98 L16/48000/2"},
+				},
+			},
+		})
+		require.NotNil(t, l)
+
+		// square wave at half of the full scale
+		l.process([]byte{0x40, 0x00, 0xC0, 0x00, 0x40, 0x00, 0xC0, 0x00})
+		l.update()
+		require.Equal(t, &streamAudioLevelInfo{RMS: -6, Peak: -6}, l.info())
+	})
+}
@@ -0,0 +1,196 @@
+package core
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aler9/gortsplib"
+)
+
+const (
+	// period in which the minimum transit time of every track is measured.
+	// The minimum is used since network jitter can only delay packets.
+	streamClockDriftWindow = 10 * time.Second
+
+	// variations of the offset between tracks bigger than this, in a single window,
+	// are not caused by drift but by discontinuities of timestamps, and are ignored.
+	streamClockDriftMaxStep = 200 * time.Millisecond
+)
+
+type streamClockDriftTrack struct {
+	clockRate float64
+
+	initialized bool
+	lastTS      uint32
+	unwrapped   int64
+
+	// minimum difference between media time and arrival time, in the current window.
+	minTransit  float64
+	haveTransit bool
+
+	// offset from the reference track
+	haveOffset    bool
+	initialOffset float64
+	lastOffset    float64
+	correction    uint32
+}
+
+func (t *streamClockDriftTrack) processTimestamp(arrival float64, ts uint32) {
+	if !t.initialized {
+		t.initialized = true
+	} else {
+		t.unwrapped += int64(int32(ts - t.lastTS))
+	}
+	t.lastTS = ts
+
+	transit := float64(t.unwrapped)/t.clockRate - arrival
+	if !t.haveTransit || transit < t.minTransit {
+		t.minTransit = transit
+		t.haveTransit = true
+	}
+}
+
+// streamClockDrift compensates the drift between the clock of audio tracks
+// and the clock of the video track, that is common in cameras that encode
+// audio and video with different chips.
+// The offset between the media time of every audio track and the one of the
+// video track is measured periodically, and its variations are removed
+// from the timestamps of the audio track.
+type streamClockDrift struct {
+	refTrackID int
+	tracks     []*streamClockDriftTrack
+
+	mutex       sync.Mutex
+	start       time.Time
+	windowStart time.Time
+}
+
+func newStreamClockDrift(tracks gortsplib.Tracks) *streamClockDrift {
+	d := &streamClockDrift{
+		refTrackID: -1,
+		tracks:     make([]*streamClockDriftTrack, len(tracks)),
+	}
+
+	for i, track := range tracks {
+		clockRate, _ := track.ClockRate()
+		if clockRate == 0 {
+			continue
+		}
+
+		media := track.Media.MediaName.Media
+		if media == "video" && d.refTrackID < 0 {
+			d.refTrackID = i
+		} else if media != "audio" {
+			continue
+		}
+
+		d.tracks[i] = &streamClockDriftTrack{clockRate: float64(clockRate)}
+	}
+
+	return d
+}
+
+// enabled returns whether there are both a video track and an audio track.
+func (d *streamClockDrift) enabled() bool {
+	if d.refTrackID < 0 {
+		return false
+	}
+
+	for i, t := range d.tracks {
+		if i != d.refTrackID && t != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// processPacketRTP measures the drift and corrects the timestamp of a RTP packet
+// received from the source.
+func (d *streamClockDrift) processPacketRTP(now time.Time, trackID int, payload []byte) {
+	if trackID >= len(d.tracks) || d.tracks[trackID] == nil || len(payload) < 12 {
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.start.IsZero() {
+		d.start = now
+		d.windowStart = now
+	}
+
+	t := d.tracks[trackID]
+	ts := binary.BigEndian.Uint32(payload[4:])
+
+	t.processTimestamp(now.Sub(d.start).Seconds(), ts)
+
+	if now.Sub(d.windowStart) >= streamClockDriftWindow {
+		d.windowStart = now
+		d.updateCorrections()
+	}
+
+	if trackID != d.refTrackID && t.correction != 0 {
+		binary.BigEndian.PutUint32(payload[4:], ts-t.correction)
+	}
+}
+
+func (d *streamClockDrift) updateCorrections() {
+	ref := d.tracks[d.refTrackID]
+
+	for i, t := range d.tracks {
+		if i == d.refTrackID || t == nil {
+			continue
+		}
+
+		if ref.haveTransit && t.haveTransit {
+			offset := t.minTransit - ref.minTransit
+
+			switch {
+			case !t.haveOffset:
+				t.haveOffset = true
+				t.initialOffset = offset
+
+			case math.Abs(offset-t.lastOffset) > streamClockDriftMaxStep.Seconds():
+				// keep the current correction
+				t.initialOffset += offset - t.lastOffset
+			}
+
+			t.lastOffset = offset
+			t.correction = uint32(int64(math.Round((offset - t.initialOffset) * t.clockRate)))
+		}
+
+		t.haveTransit = false
+	}
+
+	ref.haveTransit = false
+}
+
+// processSenderReport corrects the RTP timestamp of a sender report
+// received from the source, in order to keep it consistent with packets.
+func (d *streamClockDrift) processSenderReport(trackID int, rtpTime uint32) uint32 {
+	if trackID >= len(d.tracks) || d.tracks[trackID] == nil {
+		return rtpTime
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return rtpTime - d.tracks[trackID].correction
+}
+
+// correction returns the correction applied to the timestamps of a track,
+// in milliseconds, or nil if the track is not corrected.
+func (d *streamClockDrift) correction(trackID int) *float64 {
+	if trackID == d.refTrackID || d.tracks[trackID] == nil {
+		return nil
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	t := d.tracks[trackID]
+	v := float64(int(float64(int32(t.correction))*1000/t.clockRate*100)) / 100
+	return &v
+}
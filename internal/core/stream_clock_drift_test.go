@@ -0,0 +1,83 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamClockDrift(t *testing.T) {
+	videoTrack, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x01, 0x02, 0x03, 0x04}, PPS: []byte{0x01, 0x02, 0x03, 0x04}})
+	require.NoError(t, err)
+
+	audioTrack, err := gortsplib.NewTrackAAC(97,
+		&gortsplib.TrackConfigAAC{Type: 2, SampleRate: 48000, ChannelCount: 2})
+	require.NoError(t, err)
+
+	d := newStreamClockDrift(gortsplib.Tracks{videoTrack, audioTrack})
+	require.Equal(t, true, d.enabled())
+
+	start := time.Date(2021, 5, 3, 10, 20, 30, 0, time.UTC)
+
+	// the clock of the audio track runs 0.1% faster than the one of the video track
+	audioTS := func(elapsed time.Duration) uint32 {
+		return uint32(int64(elapsed.Seconds() * 1.001 * 48000))
+	}
+
+	var lastAudioTS uint32
+
+	for i := 0; i <= 3000; i++ {
+		elapsed := time.Duration(i) * 20 * time.Millisecond
+		now := start.Add(elapsed)
+
+		if (i % 2) == 0 {
+			byts, _ := (&rtp.Packet{
+				Header: rtp.Header{
+					Version:     2,
+					PayloadType: 96,
+					Timestamp:   uint32(int64(elapsed.Seconds() * 90000)),
+				},
+				Payload: []byte{0x05},
+			}).Marshal()
+			d.processPacketRTP(now, 0, byts)
+		}
+
+		byts, _ := (&rtp.Packet{
+			Header: rtp.Header{
+				Version:     2,
+				PayloadType: 97,
+				Timestamp:   audioTS(elapsed),
+			},
+			Payload: []byte{0x01, 0x02},
+		}).Marshal()
+		d.processPacketRTP(now, 1, byts)
+
+		var pkt rtp.Packet
+		err := pkt.Unmarshal(byts)
+		require.NoError(t, err)
+		lastAudioTS = pkt.Timestamp
+	}
+
+	// the drift accumulated until the beginning of the last window is compensated
+	require.Nil(t, d.correction(0))
+	correction := d.correction(1)
+	require.NotNil(t, correction)
+	require.InDelta(t, 50, *correction, 1)
+
+	require.Equal(t, audioTS(60*time.Second)-d.tracks[1].correction, lastAudioTS)
+	require.Equal(t, lastAudioTS, d.processSenderReport(1, audioTS(60*time.Second)))
+	require.Equal(t, uint32(1234), d.processSenderReport(0, 1234))
+}
+
+func TestStreamClockDriftDisabled(t *testing.T) {
+	videoTrack, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x01, 0x02, 0x03, 0x04}, PPS: []byte{0x01, 0x02, 0x03, 0x04}})
+	require.NoError(t, err)
+
+	d := newStreamClockDrift(gortsplib.Tracks{videoTrack})
+	require.Equal(t, false, d.enabled())
+}
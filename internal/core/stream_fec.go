@@ -0,0 +1,190 @@
+package core
+
+import (
+	"encoding/binary"
+	"strconv"
+	"sync"
+
+	"github.com/aler9/gortsplib"
+	"github.com/pion/rtp"
+	psdp "github.com/pion/sdp/v3"
+)
+
+const (
+	// maximum number of packets protected by a FEC packet,
+	// that is the size of the first mask of the FlexFEC header.
+	fecMaxGroupSize = 15
+
+	// time span of the protected packets, in microseconds.
+	fecRepairWindow = 200000
+)
+
+// fecTrack returns a track that contains FlexFEC packets (RFC 8627).
+func fecTrack(payloadType uint8) *gortsplib.Track {
+	pt := strconv.FormatInt(int64(payloadType), 10)
+
+	return &gortsplib.Track{
+		Media: &psdp.MediaDescription{
+			MediaName: psdp.MediaName{
+				Media:   "video",
+				Protos:  []string{"RTP", "AVP"},
+				Formats: []string{pt},
+			},
+			Attributes: []psdp.Attribute{
+				{
+					Key:   "rtpmap",
+					Value: pt + " flexfec/90000",
+				},
+				{
+					Key:   "fmtp",
+					Value: pt + " repair-window=" + strconv.FormatInt(fecRepairWindow, 10),
+				},
+			},
+		},
+	}
+}
+
+type streamFECTrack struct {
+	mutex       sync.Mutex
+	fecTrackID  int
+	payloadType uint8
+	ssrc        uint32
+	seq         uint16
+
+	// group of packets that is being protected
+	count     int
+	snBase    uint16
+	mask      uint16
+	header    [2]byte
+	lenRec    uint16
+	tsRec     uint32
+	payload   []byte
+	timestamp uint32
+}
+
+// streamFEC generates FlexFEC packets, that allow readers to recover lost
+// packets without retransmissions. Every group of packets of a video track
+// is protected by a FEC packet that contains the XOR of the packets
+// (1-D non-interleaved FEC), that is sent on a dedicated track.
+type streamFEC struct {
+	groupSize   int
+	tracks      []*streamFECTrack
+	onPacketRTP func(int, []byte)
+}
+
+// newStreamFEC allocates a streamFEC.
+// fecTrackIDs contains, for every track, the ID of the track that contains its
+// FEC packets, or -1 if the track is not protected.
+func newStreamFEC(
+	tracks gortsplib.Tracks,
+	fecTrackIDs []int,
+	groupSize int,
+	onPacketRTP func(int, []byte),
+) *streamFEC {
+	s := &streamFEC{
+		groupSize:   groupSize,
+		tracks:      make([]*streamFECTrack, len(tracks)),
+		onPacketRTP: onPacketRTP,
+	}
+
+	for trackID, fecTrackID := range fecTrackIDs {
+		if fecTrackID < 0 {
+			continue
+		}
+
+		pt, _ := strconv.ParseUint(tracks[fecTrackID].Media.MediaName.Formats[0], 10, 8)
+		ssrc, _ := randUint32()
+		seq, _ := randUint32()
+
+		s.tracks[trackID] = &streamFECTrack{
+			fecTrackID:  fecTrackID,
+			payloadType: uint8(pt),
+			ssrc:        ssrc,
+			seq:         uint16(seq),
+		}
+	}
+
+	return s
+}
+
+// processPacketRTP is called when a RTP packet is sent to readers.
+func (s *streamFEC) processPacketRTP(trackID int, payload []byte) {
+	if trackID >= len(s.tracks) {
+		return
+	}
+
+	t := s.tracks[trackID]
+	if t == nil || len(payload) < 12 {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	seq := binary.BigEndian.Uint16(payload[2:4])
+
+	// the packet can't be described by the mask of the current group
+	if t.count != 0 && seq-t.snBase >= fecMaxGroupSize {
+		s.writeFEC(t)
+	}
+
+	if t.count == 0 {
+		t.snBase = seq
+		t.mask = 0
+		t.header = [2]byte{}
+		t.lenRec = 0
+		t.tsRec = 0
+		t.payload = t.payload[:0]
+	}
+
+	t.header[0] ^= payload[0]
+	t.header[1] ^= payload[1]
+	t.lenRec ^= uint16(len(payload) - 12)
+	t.timestamp = binary.BigEndian.Uint32(payload[4:8])
+	t.tsRec ^= t.timestamp
+
+	for i, b := range payload[12:] {
+		if i < len(t.payload) {
+			t.payload[i] ^= b
+		} else {
+			t.payload = append(t.payload, b)
+		}
+	}
+
+	t.mask |= 1 << (fecMaxGroupSize - 1 - (seq - t.snBase))
+	t.count++
+
+	if t.count >= s.groupSize {
+		s.writeFEC(t)
+	}
+}
+
+func (s *streamFEC) writeFEC(t *streamFECTrack) {
+	fecHeader := make([]byte, 12, 12+len(t.payload))
+	fecHeader[0] = t.header[0] & 0x3F // R=0, F=0 (flexible mask)
+	fecHeader[1] = t.header[1]
+	binary.BigEndian.PutUint16(fecHeader[2:4], t.lenRec)
+	binary.BigEndian.PutUint32(fecHeader[4:8], t.tsRec)
+	binary.BigEndian.PutUint16(fecHeader[8:10], t.snBase)
+	binary.BigEndian.PutUint16(fecHeader[10:12], 0x8000|t.mask) // k=1: the mask ends here
+
+	pkt := rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    t.payloadType,
+			SequenceNumber: t.seq,
+			Timestamp:      t.timestamp,
+			SSRC:           t.ssrc,
+		},
+		Payload: append(fecHeader, t.payload...),
+	}
+	t.seq++
+	t.count = 0
+
+	byts, err := pkt.Marshal()
+	if err != nil {
+		return
+	}
+
+	s.onPacketRTP(t.fecTrackID, byts)
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/aler9/gortsplib"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamFEC(t *testing.T) {
+	videoTrack, err := gortsplib.NewTrackH264(96, &gortsplib.TrackConfigH264{
+		SPS: []byte{0x01, 0x02, 0x03, 0x04},
+		PPS: []byte{0x01, 0x02, 0x03, 0x04},
+	})
+	require.NoError(t, err)
+
+	tracks := gortsplib.Tracks{videoTrack}
+	tracks = append(tracks, fecTrack(unusedPayloadType(tracks)))
+	require.Equal(t, "97", tracks[1].Media.MediaName.Formats[0])
+
+	var fecPackets [][]byte
+	s := newStreamFEC(tracks, []int{1}, 3, func(trackID int, byts []byte) {
+		require.Equal(t, 1, trackID)
+		fecPackets = append(fecPackets, byts)
+	})
+
+	var packets [][]byte
+	for i, payload := range [][]byte{{0x01, 0x02, 0x03}, {0x04, 0x05}, {0x06, 0x07, 0x08, 0x09}} {
+		pkt := rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         i == 2,
+				PayloadType:    96,
+				SequenceNumber: uint16(65534 + i),
+				Timestamp:      45343 + uint32(i)*3000,
+				SSRC:           978651231,
+			},
+			Payload: payload,
+		}
+		byts, err := pkt.Marshal()
+		require.NoError(t, err)
+		packets = append(packets, byts)
+		s.processPacketRTP(0, byts)
+	}
+
+	require.Equal(t, 1, len(fecPackets))
+
+	var fec rtp.Packet
+	err = fec.Unmarshal(fecPackets[0])
+	require.NoError(t, err)
+	require.Equal(t, uint8(97), fec.PayloadType)
+	require.Equal(t, uint16(65534), binary.BigEndian.Uint16(fec.Payload[8:10]))
+	require.Equal(t, uint16(0x8000|0x7000), binary.BigEndian.Uint16(fec.Payload[10:12]))
+
+	// recover the second packet from the FEC packet and the other packets
+	header := []byte{fec.Payload[0], fec.Payload[1]}
+	lenRec := binary.BigEndian.Uint16(fec.Payload[2:4])
+	tsRec := binary.BigEndian.Uint32(fec.Payload[4:8])
+	payload := append([]byte(nil), fec.Payload[12:]...)
+
+	for _, i := range []int{0, 2} {
+		header[0] ^= packets[i][0]
+		header[1] ^= packets[i][1]
+		lenRec ^= uint16(len(packets[i]) - 12)
+		tsRec ^= binary.BigEndian.Uint32(packets[i][4:8])
+		for j, b := range packets[i][12:] {
+			payload[j] ^= b
+		}
+	}
+
+	recovered := make([]byte, 12)
+	recovered[0] = 0x80 | (header[0] & 0x3F)
+	recovered[1] = header[1]
+	binary.BigEndian.PutUint16(recovered[2:4], 65535)
+	binary.BigEndian.PutUint32(recovered[4:8], tsRec)
+	binary.BigEndian.PutUint32(recovered[8:12], 978651231)
+	recovered = append(recovered, payload[:lenRec]...)
+
+	require.Equal(t, packets[1], recovered)
+}
@@ -0,0 +1,316 @@
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/aler9/gortsplib/pkg/h264"
+	"github.com/pion/rtp"
+)
+
+const (
+	// period between repetitions of the last key frame.
+	streamHoldFramePeriod = 200 * time.Millisecond
+)
+
+// rtpH264ContainsIDR checks whether a H264 RTP packet contains an IDR.
+func rtpH264ContainsIDR(pkt *rtp.Packet) bool {
+	if len(pkt.Payload) == 0 {
+		return false
+	}
+
+	switch h264.NALUType(pkt.Payload[0] & 0x1F) {
+	case h264.NALUTypeIDR:
+		return true
+
+	case 24: // STAP-A
+		payload := pkt.Payload[1:]
+		for len(payload) > 2 {
+			size := int(payload[0])<<8 | int(payload[1])
+			payload = payload[2:]
+			if size == 0 || size > len(payload) {
+				return false
+			}
+			if h264.NALUType(payload[0]&0x1F) == h264.NALUTypeIDR {
+				return true
+			}
+			payload = payload[size:]
+		}
+
+	case 28: // FU-A
+		if len(pkt.Payload) >= 2 &&
+			h264.NALUType(pkt.Payload[1]&0x1F) == h264.NALUTypeIDR {
+			return true
+		}
+	}
+
+	return false
+}
+
+type streamHoldTrack struct {
+	mutex     sync.Mutex
+	isH264    bool
+	clockRate int
+
+	// last packet sent to readers
+	hasLast  bool
+	lastSeq  uint16
+	lastTS   uint32
+	lastTime time.Time
+
+	// offsets applied to the packets of the source, in order to continue
+	// the sequence numbers and timestamps of the repeated frames.
+	resync    bool
+	seqOffset uint16
+	tsOffset  uint32
+
+	// access unit that is being received, and last complete key frame
+	curAU    []*rtp.Packet
+	curIDR   bool
+	keyFrame []*rtp.Packet
+}
+
+func (t *streamHoldTrack) setLast(pkt *rtp.Packet, now time.Time) {
+	t.hasLast = true
+	t.lastSeq = pkt.SequenceNumber
+	t.lastTS = pkt.Timestamp
+	t.lastTime = now
+}
+
+// timestamp returns the timestamp that follows the last one, at the given time.
+func (t *streamHoldTrack) timestamp(now time.Time) uint32 {
+	ts := t.lastTS + uint32(now.Sub(t.lastTime).Seconds()*float64(t.clockRate))
+	if ts == t.lastTS {
+		ts++
+	}
+	return ts
+}
+
+// streamHold keeps a stream alive when its source is missing, by repeating
+// the last key frame received from the source, in order not to interrupt
+// readers during short outages of the source (i.e. camera reboots).
+// When a new source is attached, its sequence numbers and timestamps
+// are shifted in order to continue the ones of the repeated frames.
+type streamHold struct {
+	tracks      []*streamHoldTrack
+	onPacketRTP func(int, []byte)
+
+	mutex   sync.Mutex
+	holding bool
+
+	// in
+	terminate chan struct{}
+
+	// out
+	done chan struct{}
+}
+
+func newStreamHold(
+	tracks gortsplib.Tracks,
+	onPacketRTP func(int, []byte),
+) *streamHold {
+	h := &streamHold{
+		tracks:      make([]*streamHoldTrack, len(tracks)),
+		onPacketRTP: onPacketRTP,
+	}
+
+	for i, track := range tracks {
+		clockRate, _ := track.ClockRate()
+		h.tracks[i] = &streamHoldTrack{
+			isH264:    track.IsH264() && clockRate > 0,
+			clockRate: clockRate,
+		}
+	}
+
+	return h
+}
+
+// processSource processes a packet of the source, and returns the packet
+// that must be forwarded to readers, or nil if the packet must be discarded.
+func (h *streamHold) processSource(trackID int, payload []byte) []byte {
+	h.mutex.Lock()
+	holding := h.holding
+	h.mutex.Unlock()
+
+	// discard packets sent by the previous source after it has been removed
+	if holding {
+		return nil
+	}
+
+	var pkt rtp.Packet
+	err := pkt.Unmarshal(payload)
+	if err != nil {
+		return payload
+	}
+
+	t := h.tracks[trackID]
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+
+	if t.resync {
+		t.resync = false
+		t.seqOffset = t.lastSeq + 1 - pkt.SequenceNumber
+		t.tsOffset = t.timestamp(now) - pkt.Timestamp
+	}
+
+	pkt.SequenceNumber += t.seqOffset
+	pkt.Timestamp += t.tsOffset
+	t.setLast(&pkt, now)
+
+	if t.isH264 {
+		if len(t.curAU) != 0 && t.curAU[0].Timestamp != pkt.Timestamp {
+			t.curAU = nil
+			t.curIDR = false
+		}
+
+		cpy := pkt
+		cpy.Payload = append([]byte(nil), pkt.Payload...)
+		t.curAU = append(t.curAU, &cpy)
+		if rtpH264ContainsIDR(&pkt) {
+			t.curIDR = true
+		}
+
+		if pkt.Marker {
+			if t.curIDR {
+				t.keyFrame = t.curAU
+			}
+			t.curAU = nil
+			t.curIDR = false
+		}
+	}
+
+	if t.seqOffset == 0 && t.tsOffset == 0 {
+		return payload
+	}
+
+	byts, err := pkt.Marshal()
+	if err != nil {
+		return nil
+	}
+	return byts
+}
+
+// timestampOffset returns the offset that must be applied to the timestamps
+// of the source. It returns false if the offset is not known yet.
+func (h *streamHold) timestampOffset(trackID int) (uint32, bool) {
+	h.mutex.Lock()
+	holding := h.holding
+	h.mutex.Unlock()
+
+	if holding {
+		return 0, false
+	}
+
+	t := h.tracks[trackID]
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.resync {
+		return 0, false
+	}
+
+	return t.tsOffset, true
+}
+
+// start starts repeating the last key frame.
+// It returns false if a key frame is not available.
+func (h *streamHold) start() bool {
+	available := false
+	for _, t := range h.tracks {
+		t.mutex.Lock()
+		if t.keyFrame != nil {
+			available = true
+		}
+		t.mutex.Unlock()
+	}
+
+	if !available {
+		return false
+	}
+
+	h.mutex.Lock()
+	h.holding = true
+	h.mutex.Unlock()
+
+	h.terminate = make(chan struct{})
+	h.done = make(chan struct{})
+	go h.run()
+
+	return true
+}
+
+// stop stops repeating the last key frame, and prepares
+// the stream to receive packets from a new source.
+func (h *streamHold) stop() {
+	if h.terminate == nil {
+		return
+	}
+
+	close(h.terminate)
+	<-h.done
+	h.terminate = nil
+
+	for _, t := range h.tracks {
+		t.mutex.Lock()
+		t.resync = t.hasLast
+		t.curAU = nil
+		t.curIDR = false
+		t.mutex.Unlock()
+	}
+
+	h.mutex.Lock()
+	h.holding = false
+	h.mutex.Unlock()
+}
+
+func (h *streamHold) run() {
+	defer close(h.done)
+
+	t := time.NewTicker(streamHoldFramePeriod)
+	defer t.Stop()
+
+	for {
+		select {
+		case now := <-t.C:
+			for trackID, track := range h.tracks {
+				for _, byts := range track.repeatKeyFrame(now) {
+					h.onPacketRTP(trackID, byts)
+				}
+			}
+
+		case <-h.terminate:
+			return
+		}
+	}
+}
+
+func (t *streamHoldTrack) repeatKeyFrame(now time.Time) [][]byte {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.keyFrame == nil {
+		return nil
+	}
+
+	ts := t.timestamp(now)
+	ret := make([][]byte, 0, len(t.keyFrame))
+
+	for _, orig := range t.keyFrame {
+		pkt := *orig
+		pkt.SequenceNumber = t.lastSeq + 1
+		pkt.Timestamp = ts
+
+		byts, err := pkt.Marshal()
+		if err != nil {
+			return ret
+		}
+
+		t.setLast(&pkt, now)
+		ret = append(ret, byts)
+	}
+
+	return ret
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRTPH264ContainsIDR(t *testing.T) {
+	for _, ca := range []struct {
+		name    string
+		payload []byte
+		ok      bool
+	}{
+		{"idr", []byte{0x65, 0x01}, true},
+		{"non-idr", []byte{0x41, 0x01}, false},
+		{"stap-a", []byte{0x18, 0x00, 0x02, 0x67, 0x01, 0x00, 0x02, 0x65, 0x01}, true},
+		{"fu-a start", []byte{0x7c, 0x85, 0x01}, true},
+		{"fu-a non-idr", []byte{0x7c, 0x81, 0x01}, false},
+		{"empty", nil, false},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			require.Equal(t, ca.ok, rtpH264ContainsIDR(&rtp.Packet{Payload: ca.payload}))
+		})
+	}
+}
+
+func TestStreamHold(t *testing.T) {
+	track, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x01, 0x02, 0x03, 0x04}, PPS: []byte{0x01, 0x02, 0x03, 0x04}})
+	require.NoError(t, err)
+
+	var mutex sync.Mutex
+	var repeated []*rtp.Packet
+
+	h := newStreamHold(gortsplib.Tracks{track}, func(trackID int, byts []byte) {
+		var pkt rtp.Packet
+		err := pkt.Unmarshal(byts)
+		require.NoError(t, err)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		repeated = append(repeated, &pkt)
+	})
+
+	marshal := func(seq uint16, ts uint32, payload []byte) []byte {
+		byts, err := (&rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         true,
+				PayloadType:    96,
+				SequenceNumber: seq,
+				Timestamp:      ts,
+				SSRC:           0x10203040,
+			},
+			Payload: payload,
+		}).Marshal()
+		require.NoError(t, err)
+		return byts
+	}
+
+	// the stream can't be held without a key frame
+	byts := marshal(100, 1000, []byte{0x41, 0x01})
+	require.Equal(t, byts, h.processSource(0, byts))
+	require.Equal(t, false, h.start())
+
+	byts = marshal(101, 2000, []byte{0x65, 0x01})
+	require.Equal(t, byts, h.processSource(0, byts))
+	require.Equal(t, true, h.start())
+
+	// packets of the previous source are discarded
+	require.Nil(t, h.processSource(0, marshal(102, 3000, []byte{0x41, 0x01})))
+
+	time.Sleep(streamHoldFramePeriod * 5 / 2)
+	h.stop()
+
+	mutex.Lock()
+	require.GreaterOrEqual(t, len(repeated), 2)
+	for i, pkt := range repeated {
+		require.Equal(t, uint16(102+i), pkt.SequenceNumber)
+		require.Greater(t, pkt.Timestamp, uint32(2000))
+		require.Equal(t, []byte{0x65, 0x01}, pkt.Payload)
+	}
+	last := repeated[len(repeated)-1]
+	mutex.Unlock()
+
+	// packets of the new source continue the sequence numbers and timestamps
+	var pkt rtp.Packet
+	err = pkt.Unmarshal(h.processSource(0, marshal(5000, 100, []byte{0x41, 0x01})))
+	require.NoError(t, err)
+	require.Equal(t, last.SequenceNumber+1, pkt.SequenceNumber)
+	require.Greater(t, pkt.Timestamp, last.Timestamp)
+
+	err = pkt.Unmarshal(h.processSource(0, marshal(5001, 3100, []byte{0x41, 0x01})))
+	require.NoError(t, err)
+	require.Equal(t, last.SequenceNumber+2, pkt.SequenceNumber)
+}
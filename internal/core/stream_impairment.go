@@ -0,0 +1,142 @@
+package core
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// maximum number of packets that can be delayed at once.
+const impairmentQueueSize = 4096
+
+type streamImpairmentPacket struct {
+	deadline time.Time
+	trackID  int
+	payload  []byte
+}
+
+// streamImpairment simulates a lossy network on the packets sent to readers,
+// by dropping, reordering and delaying them. It's meant for testing
+// FEC, retransmissions and player behavior.
+type streamImpairment struct {
+	loss        int
+	reorder     int
+	latency     time.Duration
+	onPacketRTP func(int, []byte)
+
+	mutex sync.Mutex
+	rand  *rand.Rand
+	held  map[int][]byte
+
+	// in
+	queue     chan streamImpairmentPacket
+	terminate chan struct{}
+
+	// out
+	done chan struct{}
+}
+
+func newStreamImpairment(
+	loss int,
+	reorder int,
+	latency time.Duration,
+	onPacketRTP func(int, []byte),
+) *streamImpairment {
+	m := &streamImpairment{
+		loss:        loss,
+		reorder:     reorder,
+		latency:     latency,
+		onPacketRTP: onPacketRTP,
+		rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		held:        make(map[int][]byte),
+		terminate:   make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	if latency != 0 {
+		m.queue = make(chan streamImpairmentPacket, impairmentQueueSize)
+		go m.run()
+	} else {
+		close(m.done)
+	}
+
+	return m
+}
+
+func (m *streamImpairment) close() {
+	close(m.terminate)
+	<-m.done
+}
+
+// process is called with every packet directed to readers.
+func (m *streamImpairment) process(trackID int, payload []byte) {
+	m.mutex.Lock()
+
+	if m.rand.Intn(100) < m.loss {
+		m.mutex.Unlock()
+		return
+	}
+
+	// a held packet is sent after the following one of the same track.
+	if held, ok := m.held[trackID]; ok {
+		delete(m.held, trackID)
+		m.mutex.Unlock()
+		m.write(trackID, payload)
+		m.write(trackID, held)
+		return
+	}
+
+	if m.rand.Intn(100) < m.reorder {
+		// the buffer of the payload may be reused by the source
+		m.held[trackID] = append([]byte(nil), payload...)
+		m.mutex.Unlock()
+		return
+	}
+
+	m.mutex.Unlock()
+	m.write(trackID, payload)
+}
+
+func (m *streamImpairment) write(trackID int, payload []byte) {
+	if m.queue == nil {
+		m.onPacketRTP(trackID, payload)
+		return
+	}
+
+	select {
+	case m.queue <- streamImpairmentPacket{
+		deadline: time.Now().Add(m.latency),
+		trackID:  trackID,
+		payload:  append([]byte(nil), payload...),
+	}:
+	default:
+		// queue is full; the packet is lost
+	}
+}
+
+func (m *streamImpairment) run() {
+	defer close(m.done)
+
+	t := time.NewTimer(0)
+	<-t.C
+
+	for {
+		select {
+		case pkt := <-m.queue:
+			// the latency is fixed, therefore packets are queued in deadline order.
+			t.Reset(time.Until(pkt.deadline))
+
+			select {
+			case <-t.C:
+			case <-m.terminate:
+				t.Stop()
+				return
+			}
+
+			m.onPacketRTP(pkt.trackID, pkt.payload)
+
+		case <-m.terminate:
+			return
+		}
+	}
+}
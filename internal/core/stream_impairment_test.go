@@ -0,0 +1,63 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamImpairment(t *testing.T) {
+	t.Run("loss", func(t *testing.T) {
+		var out [][]byte
+		m := newStreamImpairment(100, 0, 0, func(trackID int, payload []byte) {
+			out = append(out, payload)
+		})
+		defer m.close()
+
+		for i := 0; i < 10; i++ {
+			m.process(0, []byte{byte(i)})
+		}
+		require.Equal(t, [][]byte(nil), out)
+	})
+
+	t.Run("reorder", func(t *testing.T) {
+		type pkt struct {
+			trackID int
+			payload byte
+		}
+		var out []pkt
+		m := newStreamImpairment(0, 100, 0, func(trackID int, payload []byte) {
+			out = append(out, pkt{trackID, payload[0]})
+		})
+		defer m.close()
+
+		m.process(0, []byte{1})
+		m.process(1, []byte{2})
+		m.process(0, []byte{3})
+		m.process(0, []byte{4})
+		m.process(1, []byte{5})
+
+		require.Equal(t, []pkt{{0, 3}, {0, 1}, {1, 5}, {1, 2}}, out)
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		out := make(chan []byte, 10)
+		m := newStreamImpairment(0, 0, 100*time.Millisecond, func(trackID int, payload []byte) {
+			out <- payload
+		})
+		defer m.close()
+
+		start := time.Now()
+		buf := []byte{1, 2}
+		m.process(0, buf)
+		m.process(0, []byte{3, 4})
+
+		// the payload is copied
+		buf[0] = 5
+
+		require.Equal(t, []byte{1, 2}, <-out)
+		require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+		require.Equal(t, []byte{3, 4}, <-out)
+	})
+}
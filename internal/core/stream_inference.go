@@ -0,0 +1,232 @@
+package core
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+	"sync"
+
+	"github.com/aler9/gortsplib"
+	"github.com/aler9/gortsplib/pkg/h264"
+	"github.com/aler9/gortsplib/pkg/rtph264"
+	"github.com/pion/rtp"
+	psdp "github.com/pion/sdp/v3"
+)
+
+// maximum size of the payload of metadata RTP packets.
+const streamInferenceMaxPayloadSize = 1184
+
+// metadataTrack returns a track that contains ONVIF metadata.
+func metadataTrack(payloadType uint8) *gortsplib.Track {
+	pt := strconv.FormatInt(int64(payloadType), 10)
+
+	return &gortsplib.Track{
+		Media: &psdp.MediaDescription{
+			MediaName: psdp.MediaName{
+				Media:   "application",
+				Protos:  []string{"RTP", "AVP"},
+				Formats: []string{pt},
+			},
+			Attributes: []psdp.Attribute{
+				{
+					Key:   "rtpmap",
+					Value: pt + " vnd.onvif.metadata/90000",
+				},
+			},
+		},
+	}
+}
+
+// onvifMetadata returns a ONVIF MetadataStream document that contains the detections.
+// Boxes are converted from the [0, 1] range, with the origin in the top left corner,
+// to the [-1, 1] range used by ONVIF, with the origin in the center.
+func onvifMetadata(res *inferenceResult) []byte {
+	var buf bytes.Buffer
+	esc := func(s string) string {
+		var b bytes.Buffer
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	coord := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 4, 64)
+	}
+
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` +
+		`<tt:MetadataStream xmlns:tt="http://www.onvif.org/ver10/schema">` +
+		`<tt:VideoAnalytics><tt:Frame UtcTime="` + res.Time.UTC().Format("2006-01-02T15:04:05.000Z") + `">`)
+
+	for i, d := range res.Detections {
+		buf.WriteString(`<tt:Object ObjectId="` + strconv.FormatInt(int64(i), 10) + `">` +
+			`<tt:Appearance><tt:Shape><tt:BoundingBox` +
+			` left="` + coord(2*d.Box[0]-1) + `"` +
+			` top="` + coord(1-2*d.Box[1]) + `"` +
+			` right="` + coord(2*(d.Box[0]+d.Box[2])-1) + `"` +
+			` bottom="` + coord(1-2*(d.Box[1]+d.Box[3])) + `"/>` +
+			`</tt:Shape><tt:Class><tt:Type Likelihood="` + coord(d.Confidence) + `">` +
+			esc(d.Label) + `</tt:Type></tt:Class></tt:Appearance></tt:Object>`)
+	}
+
+	buf.WriteString(`</tt:Frame></tt:VideoAnalytics></tt:MetadataStream>`)
+
+	return buf.Bytes()
+}
+
+// streamInference extracts key frames from the first H264 track, in order to send them
+// to an external inference service, and writes the returned detections into a
+// metadata track.
+type streamInference struct {
+	trackID         int
+	metadataTrackID int
+	payloadType     uint8
+	sps             []byte
+	pps             []byte
+	onPacketRTP     func(int, []byte)
+
+	// set before the stream is used by the source
+	onKeyFrame func(ts uint32, frame []byte)
+
+	decoderMutex sync.Mutex
+	decoder      *rtph264.Decoder
+
+	writeMutex sync.Mutex
+	ssrc       uint32
+	seq        uint16
+}
+
+func newStreamInference(
+	tracks gortsplib.Tracks,
+	trackID int,
+	metadataTrackID int,
+	onPacketRTP func(int, []byte),
+) *streamInference {
+	pt, _ := strconv.ParseUint(tracks[metadataTrackID].Media.MediaName.Formats[0], 10, 8)
+	ssrc, _ := randUint32()
+	seq, _ := randUint32()
+
+	s := &streamInference{
+		trackID:         trackID,
+		metadataTrackID: metadataTrackID,
+		payloadType:     uint8(pt),
+		onPacketRTP:     onPacketRTP,
+		decoder:         rtph264.NewDecoder(),
+		ssrc:            ssrc,
+		seq:             uint16(seq),
+	}
+
+	if conf, err := tracks[trackID].ExtractConfigH264(); err == nil {
+		s.sps = conf.SPS
+		s.pps = conf.PPS
+	}
+
+	return s
+}
+
+func (s *streamInference) process(trackID int, payload []byte) {
+	if trackID != s.trackID || s.onKeyFrame == nil {
+		return
+	}
+
+	var pkt rtp.Packet
+	err := pkt.Unmarshal(payload)
+	if err != nil {
+		return
+	}
+
+	frame := func() []byte {
+		s.decoderMutex.Lock()
+		defer s.decoderMutex.Unlock()
+
+		nalus, _, err := s.decoder.DecodeUntilMarker(&pkt)
+		if err != nil {
+			return nil
+		}
+
+		return h264KeyFrame(nalus, s.sps, s.pps)
+	}()
+
+	if frame != nil {
+		s.onKeyFrame(pkt.Timestamp, frame)
+	}
+}
+
+// h264KeyFrame returns the access unit in Annex-B format if it contains an IDR,
+// otherwise nil. SPS and PPS are added if they're not present.
+func h264KeyFrame(nalus [][]byte, sps []byte, pps []byte) []byte {
+	hasIDR := false
+	hasSPS := false
+	hasPPS := false
+
+	for _, nalu := range nalus {
+		if len(nalu) == 0 {
+			continue
+		}
+
+		switch h264.NALUType(nalu[0] & 0x1F) {
+		case h264.NALUTypeIDR:
+			hasIDR = true
+		case h264.NALUTypeSPS:
+			hasSPS = true
+		case h264.NALUTypePPS:
+			hasPPS = true
+		}
+	}
+
+	if !hasIDR {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	write := func(nalu []byte) {
+		buf.Write([]byte{0x00, 0x00, 0x00, 0x01})
+		buf.Write(nalu)
+	}
+
+	if !hasSPS && sps != nil {
+		write(sps)
+	}
+	if !hasPPS && pps != nil {
+		write(pps)
+	}
+	for _, nalu := range nalus {
+		write(nalu)
+	}
+
+	return buf.Bytes()
+}
+
+// writeDetections writes detections into the metadata track, with the timestamp
+// of the key frame they refer to.
+func (s *streamInference) writeDetections(ts uint32, res *inferenceResult) {
+	doc := onvifMetadata(res)
+
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	for len(doc) > 0 {
+		n := len(doc)
+		if n > streamInferenceMaxPayloadSize {
+			n = streamInferenceMaxPayloadSize
+		}
+
+		pkt := rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         n == len(doc),
+				PayloadType:    s.payloadType,
+				SequenceNumber: s.seq,
+				Timestamp:      ts,
+				SSRC:           s.ssrc,
+			},
+			Payload: doc[:n],
+		}
+		s.seq++
+		doc = doc[n:]
+
+		byts, err := pkt.Marshal()
+		if err != nil {
+			return
+		}
+
+		s.onPacketRTP(s.metadataTrackID, byts)
+	}
+}
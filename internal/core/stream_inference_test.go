@@ -0,0 +1,147 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+type testInferenceParent struct{}
+
+func (testInferenceParent) log(logger.Level, string, ...interface{}) {}
+
+func TestH264KeyFrame(t *testing.T) {
+	require.Nil(t, h264KeyFrame([][]byte{{0x01, 0x02}}, []byte{0x07}, []byte{0x08}))
+
+	require.Equal(t, []byte{
+		0x00, 0x00, 0x00, 0x01, 0x07,
+		0x00, 0x00, 0x00, 0x01, 0x08,
+		0x00, 0x00, 0x00, 0x01, 0x05, 0x01,
+	}, h264KeyFrame([][]byte{{0x05, 0x01}}, []byte{0x07}, []byte{0x08}))
+
+	require.Equal(t, []byte{
+		0x00, 0x00, 0x00, 0x01, 0x07, 0x01,
+		0x00, 0x00, 0x00, 0x01, 0x08, 0x01,
+		0x00, 0x00, 0x00, 0x01, 0x05, 0x01,
+	}, h264KeyFrame([][]byte{{0x07, 0x01}, {0x08, 0x01}, {0x05, 0x01}}, []byte{0x07}, []byte{0x08}))
+}
+
+func TestONVIFMetadata(t *testing.T) {
+	require.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>`+
+		`<tt:MetadataStream xmlns:tt="http://www.onvif.org/ver10/schema">`+
+		`<tt:VideoAnalytics><tt:Frame UtcTime="2022-01-02T03:04:05.000Z">`+
+		`<tt:Object ObjectId="0"><tt:Appearance><tt:Shape>`+
+		`<tt:BoundingBox left="-0.5000" top="0.5000" right="0.5000" bottom="-0.5000"/>`+
+		`</tt:Shape><tt:Class><tt:Type Likelihood="0.9000">car &amp; truck</tt:Type></tt:Class>`+
+		`</tt:Appearance></tt:Object>`+
+		`</tt:Frame></tt:VideoAnalytics></tt:MetadataStream>`,
+		string(onvifMetadata(&inferenceResult{
+			Time: time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC),
+			Detections: []inferenceDetection{{
+				Label:      "car & truck",
+				Confidence: 0.9,
+				Box:        [4]float64{0.25, 0.25, 0.5, 0.5},
+			}},
+		})))
+}
+
+func TestInferenceClient(t *testing.T) {
+	received := make(chan []byte, 1)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "/infer/mypath", r.URL.Path)
+		require.Equal(t, "video/h264", r.Header.Get("Content-Type"))
+
+		byts, _ := ioutil.ReadAll(r.Body)
+		received <- byts
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"detections": []interface{}{
+				map[string]interface{}{
+					"label":      "person",
+					"confidence": 0.8,
+					"box":        []float64{0.1, 0.2, 0.3, 0.4},
+				},
+			},
+		})
+	}))
+	defer s.Close()
+
+	videoTrack, err := gortsplib.NewTrackH264(96, &gortsplib.TrackConfigH264{
+		SPS: []byte{0x67, 0x64, 0x00, 0x1f},
+		PPS: []byte{0x68, 0xee, 0x3c, 0x80},
+	})
+	require.NoError(t, err)
+
+	tracks := gortsplib.Tracks{videoTrack}
+	tracks = append(tracks, metadataTrack(unusedPayloadType(tracks)))
+
+	written := make(chan rtp.Packet, 10)
+	si := newStreamInference(tracks, 0, 1, func(trackID int, byts []byte) {
+		require.Equal(t, 1, trackID)
+		var pkt rtp.Packet
+		err := pkt.Unmarshal(byts)
+		require.NoError(t, err)
+		written <- pkt
+	})
+
+	c := newInferenceClient(context.Background(), s.URL+"/infer/mypath",
+		time.Second, 5*time.Second, si, testInferenceParent{})
+	defer c.close()
+
+	for i, nalu := range [][]byte{{0x01, 0x02}, {0x05, 0x03}, {0x05, 0x04}} {
+		pkt := rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         true,
+				PayloadType:    96,
+				SequenceNumber: uint16(i),
+				Timestamp:      uint32(i) * 3000,
+				SSRC:           978651231,
+			},
+			Payload: nalu,
+		}
+		byts, err := pkt.Marshal()
+		require.NoError(t, err)
+		si.process(0, byts)
+	}
+
+	// the first key frame is sent, the second is discarded because of the interval
+	require.Equal(t, []byte{
+		0x00, 0x00, 0x00, 0x01, 0x67, 0x64, 0x00, 0x1f,
+		0x00, 0x00, 0x00, 0x01, 0x68, 0xee, 0x3c, 0x80,
+		0x00, 0x00, 0x00, 0x01, 0x05, 0x03,
+	}, <-received)
+
+	pkt := <-written
+	require.Equal(t, uint8(97), pkt.PayloadType)
+	require.Equal(t, uint32(3000), pkt.Timestamp)
+	require.Equal(t, true, pkt.Marker)
+	require.Equal(t, true, strings.Contains(string(pkt.Payload), `>person</tt:Type>`))
+
+	res := c.lastResult()
+	require.NotNil(t, res)
+	require.Equal(t, []inferenceDetection{{
+		Label:      "person",
+		Confidence: 0.8,
+		Box:        [4]float64{0.1, 0.2, 0.3, 0.4},
+	}}, res.Detections)
+
+	select {
+	case <-received:
+		t.Errorf("unexpected request")
+	default:
+	}
+}
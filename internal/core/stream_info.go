@@ -0,0 +1,351 @@
+package core
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/aler9/gortsplib/pkg/h264"
+
+	"github.com/aler9/rtsp-simple-server/internal/h264sps"
+)
+
+const (
+	streamInfoPeriod = 1 * time.Second
+)
+
+// rtpPayloadOffset returns the position of the payload inside a RTP packet.
+func rtpPayloadOffset(pkt []byte) int {
+	if len(pkt) < 12 {
+		return -1
+	}
+
+	pos := 12 + int(pkt[0]&0x0F)*4
+
+	// header extension
+	if (pkt[0] & 0x10) != 0 {
+		if len(pkt) < (pos + 4) {
+			return -1
+		}
+		pos += 4 + (int(pkt[pos+2])<<8|int(pkt[pos+3]))*4
+	}
+
+	if len(pkt) <= pos {
+		return -1
+	}
+
+	return pos
+}
+
+// rtpH264NALU is a NALU that starts inside a H264 RTP packet.
+type rtpH264NALU struct {
+	typ h264.NALUType
+
+	// payload is nil when the NALU is fragmented.
+	payload []byte
+}
+
+// rtpH264NALUs returns the NALUs that start inside a H264 RTP packet.
+func rtpH264NALUs(payload []byte) []rtpH264NALU {
+	typ := h264.NALUType(payload[0] & 0x1F)
+
+	switch typ {
+	case 24: // STAP-A
+		var ret []rtpH264NALU
+		payload = payload[1:]
+
+		for len(payload) >= 3 {
+			size := int(payload[0])<<8 | int(payload[1])
+			if size == 0 || len(payload) < (2+size) {
+				break
+			}
+
+			ret = append(ret, rtpH264NALU{
+				typ:     h264.NALUType(payload[2] & 0x1F),
+				payload: payload[2 : 2+size],
+			})
+			payload = payload[2+size:]
+		}
+
+		return ret
+
+	case 28: // FU-A
+		if len(payload) < 2 {
+			return nil
+		}
+
+		// start bit
+		if (payload[1] & 0x80) == 0 {
+			return nil
+		}
+
+		return []rtpH264NALU{{typ: h264.NALUType(payload[1] & 0x1F)}}
+	}
+
+	return []rtpH264NALU{{typ: typ, payload: payload}}
+}
+
+type streamTrackInfo struct {
+	// fields accessed atomically must be placed first
+	// in order to be aligned on 32-bit platforms.
+	bytes        uint64
+	frames       uint64
+	lastKeyFrame int64
+
+	isVideo    bool
+	isH264     bool
+	sps        atomic.Value
+	audioLevel *streamAudioLevel
+
+	mutex   sync.Mutex
+	bitrate uint64
+	fps     float64
+}
+
+type streamInfo struct {
+	tracks []*streamTrackInfo
+
+	// in
+	terminate chan struct{}
+
+	// out
+	done chan struct{}
+}
+
+func newStreamInfo(tracks gortsplib.Tracks) *streamInfo {
+	si := &streamInfo{
+		tracks:    make([]*streamTrackInfo, len(tracks)),
+		terminate: make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	for i, track := range tracks {
+		ti := &streamTrackInfo{
+			isVideo:    track.Media.MediaName.Media == "video",
+			isH264:     track.IsH264(),
+			audioLevel: newStreamAudioLevel(track),
+		}
+
+		if ti.isH264 {
+			conf, err := track.ExtractConfigH264()
+			if err == nil {
+				ti.sps.Store(conf.SPS)
+			}
+		}
+
+		si.tracks[i] = ti
+	}
+
+	go si.run()
+
+	return si
+}
+
+func (si *streamInfo) close() {
+	close(si.terminate)
+	<-si.done
+}
+
+func (si *streamInfo) run() {
+	defer close(si.done)
+
+	t := time.NewTicker(streamInfoPeriod)
+	defer t.Stop()
+
+	prevBytes := make([]uint64, len(si.tracks))
+	prevFrames := make([]uint64, len(si.tracks))
+	prevTime := time.Now()
+
+	for {
+		select {
+		case now := <-t.C:
+			elapsed := now.Sub(prevTime).Seconds()
+			prevTime = now
+
+			for i, ti := range si.tracks {
+				bytes := atomic.LoadUint64(&ti.bytes)
+				frames := atomic.LoadUint64(&ti.frames)
+
+				ti.mutex.Lock()
+				ti.bitrate = uint64(float64(bytes-prevBytes[i]) * 8 / elapsed)
+				ti.fps = float64(frames-prevFrames[i]) / elapsed
+				ti.mutex.Unlock()
+
+				prevBytes[i] = bytes
+				prevFrames[i] = frames
+
+				if ti.audioLevel != nil {
+					ti.audioLevel.update()
+				}
+			}
+
+		case <-si.terminate:
+			return
+		}
+	}
+}
+
+func (si *streamInfo) onPacketRTP(trackID int, pkt []byte) {
+	ti := si.tracks[trackID]
+
+	atomic.AddUint64(&ti.bytes, uint64(len(pkt)))
+
+	if ti.audioLevel != nil {
+		if pos := rtpPayloadOffset(pkt); pos >= 0 {
+			ti.audioLevel.process(pkt[pos:])
+		}
+		return
+	}
+
+	if !ti.isVideo {
+		return
+	}
+
+	// marker bit
+	if len(pkt) >= 2 && (pkt[1]&0x80) != 0 {
+		atomic.AddUint64(&ti.frames, 1)
+	}
+
+	if !ti.isH264 {
+		return
+	}
+
+	pos := rtpPayloadOffset(pkt)
+	if pos < 0 {
+		return
+	}
+
+	for _, nalu := range rtpH264NALUs(pkt[pos:]) {
+		switch nalu.typ {
+		case h264.NALUTypeIDR:
+			atomic.StoreInt64(&ti.lastKeyFrame, time.Now().UnixNano())
+
+		case h264.NALUTypeSPS:
+			if nalu.payload != nil {
+				sps := make([]byte, len(nalu.payload))
+				copy(sps, nalu.payload)
+				ti.sps.Store(sps)
+			}
+		}
+	}
+}
+
+type streamInfoTrack struct {
+	Type            string                `json:"type"`
+	Codec           string                `json:"codec"`
+	Profile         string                `json:"profile,omitempty"`
+	Level           string                `json:"level,omitempty"`
+	Width           int                   `json:"width,omitempty"`
+	Height          int                   `json:"height,omitempty"`
+	FPS             float64               `json:"fps,omitempty"`
+	SampleRate      int                   `json:"sampleRate,omitempty"`
+	ChannelCount    int                   `json:"channelCount,omitempty"`
+	Bitrate         uint64                `json:"bitrate"`
+	LastKeyFrameAge *string               `json:"lastKeyFrameAge,omitempty"`
+	AudioLevel      *streamAudioLevelInfo `json:"audioLevel,omitempty"`
+}
+
+// audioLevel returns the levels of the first audio track whose levels can be computed,
+// or nil if there's none.
+func (si *streamInfo) audioLevel() *streamAudioLevelInfo {
+	for _, ti := range si.tracks {
+		if ti.audioLevel != nil {
+			return ti.audioLevel.info()
+		}
+	}
+	return nil
+}
+
+// bytes returns the amount of RTP data received by a track.
+func (si *streamInfo) bytes(trackID int) uint64 {
+	return atomic.LoadUint64(&si.tracks[trackID].bytes)
+}
+
+func trackCodecName(track *gortsplib.Track) string {
+	switch {
+	case track.IsH264():
+		return "H264"
+
+	case track.IsAAC():
+		return "AAC"
+
+	case track.IsOpus():
+		return "Opus"
+	}
+
+	v, ok := track.Media.Attribute("rtpmap")
+	if !ok {
+		return "unknown"
+	}
+
+	// "96 H265/90000"
+	vals := strings.Split(v, " ")
+	if len(vals) != 2 {
+		return "unknown"
+	}
+
+	return strings.Split(vals[1], "/")[0]
+}
+
+func (si *streamInfo) describe(tracks gortsplib.Tracks) []streamInfoTrack {
+	ret := make([]streamInfoTrack, len(tracks))
+	now := time.Now()
+
+	for i, track := range tracks {
+		ti := si.tracks[i]
+
+		item := streamInfoTrack{
+			Type:  track.Media.MediaName.Media,
+			Codec: trackCodecName(track),
+		}
+
+		switch {
+		case ti.isH264:
+			if byts, ok := ti.sps.Load().([]byte); ok {
+				var sps h264sps.SPS
+				if sps.Decode(byts) == nil {
+					item.Profile = sps.ProfileName()
+					item.Level = sps.Level()
+					item.Width = sps.Width
+					item.Height = sps.Height
+				}
+			}
+
+			if v := atomic.LoadInt64(&ti.lastKeyFrame); v != 0 {
+				age := now.Sub(time.Unix(0, v)).Round(time.Millisecond).String()
+				item.LastKeyFrameAge = &age
+			}
+
+		case track.IsAAC():
+			conf, err := track.ExtractConfigAAC()
+			if err == nil {
+				item.SampleRate = conf.SampleRate
+				item.ChannelCount = conf.ChannelCount
+			}
+
+		case track.IsOpus():
+			conf, err := track.ExtractConfigOpus()
+			if err == nil {
+				item.SampleRate = conf.SampleRate
+				item.ChannelCount = conf.ChannelCount
+			}
+		}
+
+		if ti.audioLevel != nil {
+			item.AudioLevel = ti.audioLevel.info()
+		}
+
+		ti.mutex.Lock()
+		item.Bitrate = ti.bitrate
+		if ti.isVideo {
+			item.FPS = float64(int(ti.fps*100)) / 100
+		}
+		ti.mutex.Unlock()
+
+		ret[i] = item
+	}
+
+	return ret
+}
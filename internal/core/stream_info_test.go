@@ -0,0 +1,61 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/aler9/gortsplib"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamInfoSPSInSTAPA(t *testing.T) {
+	track, err := gortsplib.NewTrackH264(96, &gortsplib.TrackConfigH264{
+		SPS: []byte{
+			0x67, 0x64, 0x00, 0x0c, 0xac, 0x3b, 0x50, 0xb0,
+			0x4b, 0x42, 0x00, 0x00, 0x03, 0x00, 0x02, 0x00,
+			0x00, 0x03, 0x00, 0x3d, 0x08,
+		},
+		PPS: []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0},
+	})
+	require.NoError(t, err)
+
+	si := newStreamInfo(gortsplib.Tracks{track})
+	defer si.close()
+
+	require.Equal(t, 352, si.describe(gortsplib.Tracks{track})[0].Width)
+
+	sps := []byte{
+		0x67, 0x64, 0x00, 0x1f, 0xac, 0xd9, 0x40, 0x50,
+		0x05, 0xbb, 0x01, 0x6c, 0x80, 0x00, 0x00, 0x03,
+		0x00, 0x80, 0x00, 0x00, 0x1e, 0x07, 0x8c, 0x18,
+		0xcb,
+	}
+	pps := []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+	idr := []byte{0x65, 0x88, 0x84, 0x00}
+
+	// SPS, PPS and IDR aggregated into a single STAP-A packet
+	payload := []byte{24}
+	for _, nalu := range [][]byte{sps, pps, idr} {
+		payload = append(payload, byte(len(nalu)>>8), byte(len(nalu)))
+		payload = append(payload, nalu...)
+	}
+
+	pkt, err := (&rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			Marker:         true,
+			PayloadType:    96,
+			SequenceNumber: 1,
+			SSRC:           0x9dbb7812,
+		},
+		Payload: payload,
+	}).Marshal()
+	require.NoError(t, err)
+
+	si.onPacketRTP(0, pkt)
+
+	info := si.describe(gortsplib.Tracks{track})[0]
+	require.Equal(t, 1280, info.Width)
+	require.Equal(t, 720, info.Height)
+	require.NotNil(t, info.LastKeyFrameAge)
+}
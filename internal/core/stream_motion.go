@@ -0,0 +1,140 @@
+package core
+
+import (
+	"sync"
+
+	"github.com/aler9/gortsplib"
+	"github.com/pion/rtp"
+)
+
+const (
+	// number of inter frames used to compute the initial average size.
+	streamMotionWarmUpFrames = 25
+
+	// weight of each new inter frame in the average size.
+	streamMotionAverageWeight = 0.05
+
+	// number of consecutive inter frames that must exceed the threshold
+	// in order to detect motion.
+	streamMotionConsecutiveFrames = 3
+
+	// time without motion after which motion is considered ended, in H264 clock ticks.
+	streamMotionHangover = 2 * 90000
+)
+
+// streamMotion is a lightweight motion detector that works on the compressed stream.
+// Since frames are not decoded, it compares the size of every H264 inter frame
+// with the average size of previous inter frames: the size of an inter frame
+// is proportional to the amount of picture that changed since the previous frame.
+type streamMotion struct {
+	trackID   int
+	threshold int
+	onChange  func(active bool)
+
+	mutex        sync.Mutex
+	closed       bool
+	hasFrame     bool
+	frameTS      uint32
+	frameSize    int
+	frameIsIDR   bool
+	frameCount   int
+	average      float64
+	exceeding    int
+	active       bool
+	lastMotionTS uint32
+}
+
+// newStreamMotion allocates a streamMotion that analyzes the first H264 track,
+// or returns nil if there's no H264 track.
+// threshold is the percentage of the average size that an inter frame must exceed.
+func newStreamMotion(tracks gortsplib.Tracks, threshold int, onChange func(active bool)) *streamMotion {
+	for trackID, track := range tracks {
+		if track.IsH264() {
+			return &streamMotion{
+				trackID:   trackID,
+				threshold: threshold,
+				onChange:  onChange,
+			}
+		}
+	}
+	return nil
+}
+
+func (m *streamMotion) close() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.closed = true
+
+	if m.active {
+		m.active = false
+		m.onChange(false)
+	}
+}
+
+func (m *streamMotion) process(trackID int, payload []byte) {
+	if trackID != m.trackID {
+		return
+	}
+
+	var pkt rtp.Packet
+	err := pkt.Unmarshal(payload)
+	if err != nil || len(pkt.Payload) == 0 {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return
+	}
+
+	if m.hasFrame && pkt.Timestamp != m.frameTS {
+		m.processFrame()
+		m.frameSize = 0
+		m.frameIsIDR = false
+	}
+
+	m.hasFrame = true
+	m.frameTS = pkt.Timestamp
+	m.frameSize += len(pkt.Payload)
+	if rtpH264ContainsIDR(&pkt) {
+		m.frameIsIDR = true
+	}
+}
+
+func (m *streamMotion) processFrame() {
+	// the size of IDR frames does not depend on motion
+	if m.frameIsIDR {
+		return
+	}
+
+	if m.frameCount < streamMotionWarmUpFrames {
+		m.frameCount++
+		m.average += (float64(m.frameSize) - m.average) / float64(m.frameCount)
+		return
+	}
+
+	if float64(m.frameSize)*100 > m.average*float64(m.threshold) {
+		m.exceeding++
+		m.lastMotionTS = m.frameTS
+
+		if !m.active && m.exceeding >= streamMotionConsecutiveFrames {
+			m.active = true
+			m.onChange(true)
+		}
+		return
+	}
+
+	m.exceeding = 0
+
+	// update the average with frames without motion only,
+	// in order to adapt to the scene without absorbing motion
+	m.average += (float64(m.frameSize) - m.average) * streamMotionAverageWeight
+
+	if m.active && int32(m.frameTS-m.lastMotionTS) >= streamMotionHangover {
+		m.active = false
+		m.onChange(false)
+	}
+}
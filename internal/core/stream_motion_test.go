@@ -0,0 +1,96 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/aler9/gortsplib"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamMotion(t *testing.T) {
+	videoTrack, err := gortsplib.NewTrackH264(96, &gortsplib.TrackConfigH264{
+		SPS: []byte{0x01, 0x02, 0x03, 0x04},
+		PPS: []byte{0x01, 0x02, 0x03, 0x04},
+	})
+	require.NoError(t, err)
+
+	audioTrack, err := gortsplib.NewTrackAAC(97, &gortsplib.TrackConfigAAC{
+		Type:         2,
+		SampleRate:   44100,
+		ChannelCount: 2,
+	})
+	require.NoError(t, err)
+
+	require.Nil(t, newStreamMotion(gortsplib.Tracks{audioTrack}, 300, nil))
+
+	var events []bool
+	m := newStreamMotion(gortsplib.Tracks{audioTrack, videoTrack}, 300, func(active bool) {
+		events = append(events, active)
+	})
+	require.Equal(t, 1, m.trackID)
+
+	seq := uint16(0)
+	ts := uint32(0)
+
+	writeFrame := func(naluType byte, size int) {
+		pkt := rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         true,
+				PayloadType:    96,
+				SequenceNumber: seq,
+				Timestamp:      ts,
+				SSRC:           978651231,
+			},
+			Payload: append([]byte{naluType}, make([]byte, size-1)...),
+		}
+		byts, err := pkt.Marshal()
+		require.NoError(t, err)
+		m.process(1, byts)
+		seq++
+		ts += 3600
+	}
+
+	// packets of other tracks are ignored
+	m.process(0, []byte{0x80, 0x61, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01})
+
+	// static scene; IDR frames are not taken into account
+	writeFrame(0x05, 5000)
+	for i := 0; i < 50; i++ {
+		writeFrame(0x01, 100)
+	}
+	writeFrame(0x05, 5000)
+	require.Equal(t, []bool(nil), events)
+
+	// a single large frame is not enough
+	writeFrame(0x01, 1000)
+	writeFrame(0x01, 100)
+	require.Equal(t, []bool(nil), events)
+
+	// motion
+	for i := 0; i < 5; i++ {
+		writeFrame(0x01, 1000)
+	}
+	require.Equal(t, []bool{true}, events)
+
+	// motion ends after the hangover
+	for i := 0; i < 60; i++ {
+		writeFrame(0x01, 100)
+	}
+	require.Equal(t, []bool{true, false}, events)
+
+	// motion is ended when the stream is closed
+	for i := 0; i < 5; i++ {
+		writeFrame(0x01, 1000)
+	}
+	require.Equal(t, []bool{true, false, true}, events)
+
+	m.close()
+	require.Equal(t, []bool{true, false, true, false}, events)
+
+	for i := 0; i < 5; i++ {
+		writeFrame(0x01, 1000)
+	}
+	require.Equal(t, []bool{true, false, true, false}, events)
+}
@@ -0,0 +1,298 @@
+package core
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/aler9/gortsplib"
+)
+
+const (
+	streamQoSPeriod = 1 * time.Second
+
+	// sequence number gaps bigger than this are considered a restart
+	// of the source, instead of lost packets (RFC3550, A.1).
+	streamQoSMaxDropout  = 3000
+	streamQoSMaxMisorder = 100
+)
+
+// streamQoSTrackInfo describes the quality of the packets received from the source.
+type streamQoSTrackInfo struct {
+	// packets received since the beginning of the stream
+	PacketsReceived uint64 `json:"packetsReceived"`
+	// packets lost since the beginning of the stream
+	PacketsLost uint64 `json:"packetsLost"`
+	// percentage of packets lost in the last second
+	FractionLost float64 `json:"fractionLost"`
+	// interarrival jitter, in milliseconds
+	Jitter *float64 `json:"jitter,omitempty"`
+	// bitrate of the received packets
+	Bitrate uint64 `json:"bitrate"`
+	// payload bitrate declared by the source in RTCP sender reports
+	SenderBitrate *uint64 `json:"senderBitrate,omitempty"`
+	// correction applied to timestamps by clock drift compensation, in milliseconds
+	ClockDriftCorrection *float64 `json:"clockDriftCorrection,omitempty"`
+}
+
+type streamQoSTrack struct {
+	clockRate int
+
+	mutex        sync.Mutex
+	initialized  bool
+	baseSeq      uint16
+	maxSeq       uint16
+	cycles       uint64
+	expectedBase uint64
+	received     uint64
+	bytes        uint64
+	start        time.Time
+	transit      uint32
+	jitter       float64
+
+	// values of the previous period
+	prevExpected uint64
+	prevReceived uint64
+	prevBytes    uint64
+	fractionLost float64
+	bitrate      uint64
+
+	// sender reports
+	srNTP         uint64
+	srOctets      uint32
+	senderBitrate *uint64
+}
+
+func (t *streamQoSTrack) expected() uint64 {
+	if !t.initialized {
+		return t.expectedBase
+	}
+	return t.expectedBase + t.cycles + uint64(t.maxSeq) - uint64(t.baseSeq) + 1
+}
+
+func (t *streamQoSTrack) lost() uint64 {
+	expected := t.expected()
+	if t.received > expected {
+		return 0
+	}
+	return expected - t.received
+}
+
+// streamQoS measures packet loss, jitter and bitrate of the packets
+// received from the source, before they are modified by the server.
+type streamQoS struct {
+	tracks []*streamQoSTrack
+
+	// in
+	terminate chan struct{}
+
+	// out
+	done chan struct{}
+}
+
+func newStreamQoS(tracks gortsplib.Tracks) *streamQoS {
+	q := &streamQoS{
+		tracks:    make([]*streamQoSTrack, len(tracks)),
+		terminate: make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	for i, track := range tracks {
+		clockRate, _ := track.ClockRate()
+		q.tracks[i] = &streamQoSTrack{clockRate: clockRate}
+	}
+
+	go q.run()
+
+	return q
+}
+
+func (q *streamQoS) close() {
+	close(q.terminate)
+	<-q.done
+}
+
+func (q *streamQoS) run() {
+	defer close(q.done)
+
+	t := time.NewTicker(streamQoSPeriod)
+	defer t.Stop()
+
+	prevTime := time.Now()
+
+	for {
+		select {
+		case now := <-t.C:
+			elapsed := now.Sub(prevTime).Seconds()
+			prevTime = now
+
+			for _, ti := range q.tracks {
+				ti.mutex.Lock()
+
+				expected := ti.expected()
+				expectedInterval := expected - ti.prevExpected
+				receivedInterval := ti.received - ti.prevReceived
+				if expectedInterval == 0 || receivedInterval >= expectedInterval {
+					ti.fractionLost = 0
+				} else {
+					ti.fractionLost = float64(expectedInterval-receivedInterval) * 100 / float64(expectedInterval)
+				}
+
+				ti.bitrate = uint64(float64(ti.bytes-ti.prevBytes) * 8 / elapsed)
+
+				ti.prevExpected = expected
+				ti.prevReceived = ti.received
+				ti.prevBytes = ti.bytes
+
+				ti.mutex.Unlock()
+			}
+
+		case <-q.terminate:
+			return
+		}
+	}
+}
+
+// processPacketRTP updates sequence number and jitter statistics (RFC3550, A.1 and A.8).
+func (q *streamQoS) processPacketRTP(now time.Time, trackID int, pkt []byte) {
+	if trackID >= len(q.tracks) || len(pkt) < 12 {
+		return
+	}
+
+	t := q.tracks[trackID]
+	seq := binary.BigEndian.Uint16(pkt[2:])
+	ts := binary.BigEndian.Uint32(pkt[4:])
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.received++
+	t.bytes += uint64(len(pkt))
+
+	if !t.initialized {
+		t.initialized = true
+		t.baseSeq = seq
+		t.maxSeq = seq
+		t.start = now
+	} else {
+		delta := seq - t.maxSeq
+
+		switch {
+		case delta < streamQoSMaxDropout:
+			if seq < t.maxSeq {
+				t.cycles += 1 << 16
+			}
+			t.maxSeq = seq
+
+		case delta <= (1<<16)-streamQoSMaxMisorder:
+			// the source restarted with different sequence numbers
+			t.expectedBase = t.expected()
+			t.baseSeq = seq
+			t.maxSeq = seq
+			t.cycles = 0
+		}
+	}
+
+	if t.clockRate == 0 {
+		return
+	}
+
+	// differences are computed with modular arithmetic, in order to support wrap-arounds
+	arrival := uint32(int64(now.Sub(t.start).Seconds() * float64(t.clockRate)))
+	transit := arrival - ts
+
+	if t.received > 1 {
+		d := int32(transit - t.transit)
+		if d < 0 {
+			d = -d
+		}
+		t.jitter += (float64(d) - t.jitter) / 16
+	}
+
+	t.transit = transit
+}
+
+// processPacketRTCP reads the sender reports sent by the source.
+func (q *streamQoS) processPacketRTCP(trackID int, payload []byte) {
+	if trackID >= len(q.tracks) {
+		return
+	}
+
+	ntp, octets, ok := rtcpSenderReportOctets(payload)
+	if !ok {
+		return
+	}
+
+	t := q.tracks[trackID]
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.srNTP != 0 && ntp > t.srNTP {
+		elapsed := ntpToTime(ntp).Sub(ntpToTime(t.srNTP)).Seconds()
+		if elapsed > 0 {
+			v := uint64(float64(octets-t.srOctets) * 8 / elapsed)
+			t.senderBitrate = &v
+		}
+	}
+
+	t.srNTP = ntp
+	t.srOctets = octets
+}
+
+// rtcpSenderReportOctets returns the NTP timestamp and the sender's octet count
+// of the last sender report contained in a RTCP (compound) packet.
+func rtcpSenderReportOctets(payload []byte) (uint64, uint32, bool) {
+	var ntp uint64
+	var octets uint32
+	found := false
+
+	for len(payload) >= 4 {
+		// length is in 32-bit words, minus one
+		l := (int(binary.BigEndian.Uint16(payload[2:])) + 1) * 4
+		if l > len(payload) {
+			break
+		}
+
+		if payload[1] == rtcpPayloadTypeSenderReport && l >= 28 {
+			ntp = binary.BigEndian.Uint64(payload[8:])
+			octets = binary.BigEndian.Uint32(payload[24:])
+			found = true
+		}
+
+		payload = payload[l:]
+	}
+
+	return ntp, octets, found
+}
+
+func (q *streamQoS) describe() []streamQoSTrackInfo {
+	ret := make([]streamQoSTrackInfo, len(q.tracks))
+
+	for i, t := range q.tracks {
+		t.mutex.Lock()
+
+		item := streamQoSTrackInfo{
+			PacketsReceived: t.received,
+			PacketsLost:     t.lost(),
+			FractionLost:    float64(int(t.fractionLost*100)) / 100,
+			Bitrate:         t.bitrate,
+		}
+
+		if t.clockRate != 0 && t.received != 0 {
+			v := float64(int(t.jitter*1000/float64(t.clockRate)*100)) / 100
+			item.Jitter = &v
+		}
+
+		if t.senderBitrate != nil {
+			v := *t.senderBitrate
+			item.SenderBitrate = &v
+		}
+
+		t.mutex.Unlock()
+
+		ret[i] = item
+	}
+
+	return ret
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamQoS(t *testing.T) {
+	track, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x01, 0x02, 0x03, 0x04}, PPS: []byte{0x01, 0x02, 0x03, 0x04}})
+	require.NoError(t, err)
+
+	q := newStreamQoS(gortsplib.Tracks{track})
+	defer q.close()
+
+	start := time.Now()
+
+	write := func(seq uint16, ts uint32, arrival time.Duration) {
+		byts, err := (&rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    96,
+				SequenceNumber: seq,
+				Timestamp:      ts,
+			},
+			Payload: []byte{0x01, 0x02, 0x03, 0x04},
+		}).Marshal()
+		require.NoError(t, err)
+		q.processPacketRTP(start.Add(arrival), 0, byts)
+	}
+
+	// packets arrive at the same pace of their timestamps
+	write(65533, 0, 0)
+	write(65534, 9000, 100*time.Millisecond)
+	write(0, 27000, 300*time.Millisecond) // wrap-around and one packet lost
+	write(1, 36000, 400*time.Millisecond)
+
+	info := q.describe()[0]
+	require.Equal(t, uint64(4), info.PacketsReceived)
+	require.Equal(t, uint64(1), info.PacketsLost)
+	require.Equal(t, float64(0), *info.Jitter)
+
+	// a packet arrives late
+	write(2, 45000, 580*time.Millisecond)
+
+	info = q.describe()[0]
+	require.Equal(t, 5, int(info.PacketsReceived))
+	require.Equal(t, 5, int(*info.Jitter))
+
+	// the source restarts with different sequence numbers
+	write(30000, 54000, 600*time.Millisecond)
+
+	info = q.describe()[0]
+	require.Equal(t, uint64(6), info.PacketsReceived)
+	require.Equal(t, uint64(1), info.PacketsLost)
+
+	require.Eventually(t, func() bool {
+		info := q.describe()[0]
+		return info.FractionLost == 14.28 && info.Bitrate != 0
+	}, 2*time.Second, 50*time.Millisecond)
+
+	senderReport := func(ntp time.Time, octets uint32) []byte {
+		byts := make([]byte, 28)
+		byts[0] = 0x80
+		byts[1] = rtcpPayloadTypeSenderReport
+		binary.BigEndian.PutUint16(byts[2:], 6)
+		binary.BigEndian.PutUint64(byts[8:], timeToNTP(ntp))
+		binary.BigEndian.PutUint32(byts[24:], octets)
+		return byts
+	}
+
+	q.processPacketRTCP(0, senderReport(start, 1000))
+	require.Nil(t, q.describe()[0].SenderBitrate)
+
+	q.processPacketRTCP(0, senderReport(start.Add(2*time.Second), 3000))
+	require.Equal(t, uint64(8000), *q.describe()[0].SenderBitrate)
+}
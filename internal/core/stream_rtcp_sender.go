@@ -0,0 +1,166 @@
+package core
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/pion/rtp"
+)
+
+const (
+	// period between RTCP sender reports sent to readers.
+	streamRTCPSenderPeriod = 10 * time.Second
+)
+
+type streamRTCPSenderTrack struct {
+	mutex     sync.Mutex
+	clockRate int
+
+	// last packet sent to readers
+	hasLast     bool
+	ssrc        uint32
+	lastRTP     uint32
+	lastTime    time.Time
+	packetCount uint32
+	octetCount  uint32
+
+	// absolute time, taken from the sender reports of the source.
+	ntpEst *ntpEstimator
+}
+
+// streamRTCPSender generates the RTCP sender reports sent to readers.
+// When the source sends its own sender reports, their absolute time is used,
+// otherwise the absolute time is taken from the local clock.
+// Sender reports of the source are not forwarded directly, since they may refer
+// to sequence numbers and timestamps that have been changed by the server.
+type streamRTCPSender struct {
+	tracks       []*streamRTCPSenderTrack
+	onPacketRTCP func(int, []byte)
+
+	// in
+	terminate chan struct{}
+
+	// out
+	done chan struct{}
+}
+
+func newStreamRTCPSender(
+	tracks gortsplib.Tracks,
+	onPacketRTCP func(int, []byte),
+) *streamRTCPSender {
+	s := &streamRTCPSender{
+		tracks:       make([]*streamRTCPSenderTrack, len(tracks)),
+		onPacketRTCP: onPacketRTCP,
+		terminate:    make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+
+	for i, track := range tracks {
+		clockRate, _ := track.ClockRate()
+		s.tracks[i] = &streamRTCPSenderTrack{
+			clockRate: clockRate,
+			ntpEst:    newNTPEstimator(clockRate),
+		}
+	}
+
+	go s.run()
+
+	return s
+}
+
+func (s *streamRTCPSender) close() {
+	close(s.terminate)
+	<-s.done
+}
+
+func (s *streamRTCPSender) run() {
+	defer close(s.done)
+
+	t := time.NewTicker(streamRTCPSenderPeriod)
+	defer t.Stop()
+
+	for {
+		select {
+		case now := <-t.C:
+			for trackID, track := range s.tracks {
+				if r := track.report(now); r != nil {
+					s.onPacketRTCP(trackID, r)
+				}
+			}
+
+		case <-s.terminate:
+			return
+		}
+	}
+}
+
+// processPacketRTP is called when a RTP packet is sent to readers.
+func (s *streamRTCPSender) processPacketRTP(trackID int, payload []byte) {
+	var pkt rtp.Packet
+	err := pkt.Unmarshal(payload)
+	if err != nil {
+		return
+	}
+
+	t := s.tracks[trackID]
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// counters are related to the SSRC, that changes when the source changes.
+	if t.hasLast && pkt.SSRC != t.ssrc {
+		t.packetCount = 0
+		t.octetCount = 0
+	}
+
+	t.hasLast = true
+	t.ssrc = pkt.SSRC
+	t.lastRTP = pkt.Timestamp
+	t.lastTime = time.Now()
+	t.packetCount++
+	t.octetCount += uint32(len(pkt.Payload))
+}
+
+// processSourceReport is called when the source sends a sender report.
+// rtpTime must be expressed in the timestamps sent to readers.
+func (s *streamRTCPSender) processSourceReport(trackID int, ntp uint64, rtpTime uint32) {
+	t := s.tracks[trackID]
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.ntpEst.processSenderReport(ntp, rtpTime)
+}
+
+// resetSource is called when the source changes,
+// since the absolute time of the previous source is not valid anymore.
+func (s *streamRTCPSender) resetSource() {
+	for _, t := range s.tracks {
+		t.mutex.Lock()
+		t.ntpEst = newNTPEstimator(t.clockRate)
+		t.mutex.Unlock()
+	}
+}
+
+func (t *streamRTCPSenderTrack) report(now time.Time) []byte {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.hasLast || t.clockRate == 0 {
+		return nil
+	}
+
+	rtpTime := t.lastRTP + uint32(now.Sub(t.lastTime).Seconds()*float64(t.clockRate))
+
+	byts := make([]byte, 28)
+	byts[0] = 2 << 6
+	byts[1] = rtcpPayloadTypeSenderReport
+	binary.BigEndian.PutUint16(byts[2:4], 6)
+	binary.BigEndian.PutUint32(byts[4:8], t.ssrc)
+	binary.BigEndian.PutUint64(byts[8:16], timeToNTP(t.ntpEst.estimate(now, rtpTime)))
+	binary.BigEndian.PutUint32(byts[16:20], rtpTime)
+	binary.BigEndian.PutUint32(byts[20:24], t.packetCount)
+	binary.BigEndian.PutUint32(byts[24:28], t.octetCount)
+
+	return byts
+}
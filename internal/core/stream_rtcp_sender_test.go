@@ -0,0 +1,63 @@
+package core
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamRTCPSender(t *testing.T) {
+	track, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x01, 0x02, 0x03, 0x04}, PPS: []byte{0x01, 0x02, 0x03, 0x04}})
+	require.NoError(t, err)
+
+	s := newStreamRTCPSender(gortsplib.Tracks{track}, func(int, []byte) {})
+	defer s.close()
+
+	require.Nil(t, s.tracks[0].report(time.Now()))
+
+	byts, err := (&rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    96,
+			SequenceNumber: 100,
+			Timestamp:      90000,
+			SSRC:           0x10203040,
+		},
+		Payload: []byte{0x01, 0x02, 0x03},
+	}).Marshal()
+	require.NoError(t, err)
+	s.processPacketRTP(0, byts)
+
+	parse := func(r []byte) (uint32, time.Time, uint32, uint32, uint32) {
+		ntp, rtpTime, ok := rtcpSenderReport(r)
+		require.Equal(t, true, ok)
+		return binary.BigEndian.Uint32(r[4:8]), ntpToTime(ntp), rtpTime,
+			binary.BigEndian.Uint32(r[20:24]), binary.BigEndian.Uint32(r[24:28])
+	}
+
+	// without sender reports of the source, the local clock is used
+	now := time.Now()
+	ssrc, ntp, rtpTime, packetCount, octetCount := parse(s.tracks[0].report(now))
+	require.Equal(t, uint32(0x10203040), ssrc)
+	require.WithinDuration(t, now, ntp, time.Millisecond)
+	require.InDelta(t, 90000, float64(rtpTime), 900)
+	require.Equal(t, uint32(1), packetCount)
+	require.Equal(t, uint32(3), octetCount)
+
+	// the absolute time of the source is used
+	sourceNTP := time.Date(2021, 5, 3, 10, 20, 30, 0, time.UTC)
+	s.processSourceReport(0, timeToNTP(sourceNTP), 0)
+
+	_, ntp, rtpTime, _, _ = parse(s.tracks[0].report(now))
+	require.WithinDuration(t, sourceNTP.Add(time.Duration(float64(rtpTime)/90000*float64(time.Second))), ntp, time.Millisecond)
+	require.WithinDuration(t, sourceNTP.Add(1*time.Second), ntp, 10*time.Millisecond)
+
+	s.resetSource()
+	_, ntp, _, _, _ = parse(s.tracks[0].report(now))
+	require.WithinDuration(t, now, ntp, time.Millisecond)
+}
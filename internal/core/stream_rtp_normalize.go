@@ -0,0 +1,68 @@
+package core
+
+import (
+	"encoding/binary"
+)
+
+// rtpNormalize removes header extensions and/or padding from a RTP packet,
+// since some decoders are not able to handle them.
+// Packets that don't need to be modified, or that are malformed, are returned as they are.
+func rtpNormalize(payload []byte, stripExtensions bool, stripPadding bool) []byte {
+	if len(payload) < 12 {
+		return payload
+	}
+
+	hasExtension := stripExtensions && (payload[0]&0x10) != 0
+	hasPadding := stripPadding && (payload[0]&0x20) != 0
+
+	if !hasExtension && !hasPadding {
+		return payload
+	}
+
+	headerLen := 12 + 4*int(payload[0]&0x0F)
+	if len(payload) < headerLen {
+		return payload
+	}
+
+	body := payload[headerLen:]
+
+	if (payload[0] & 0x10) != 0 {
+		if len(body) < 4 {
+			return payload
+		}
+		extLen := 4 + 4*int(binary.BigEndian.Uint16(body[2:4]))
+		if len(body) < extLen {
+			return payload
+		}
+
+		if hasExtension {
+			body = body[extLen:]
+		} else {
+			headerLen += extLen
+			body = payload[headerLen:]
+		}
+	}
+
+	if hasPadding {
+		if len(body) == 0 {
+			return payload
+		}
+		padLen := int(body[len(body)-1])
+		if padLen == 0 || padLen > len(body) {
+			return payload
+		}
+		body = body[:len(body)-padLen]
+	}
+
+	// do not modify the buffer of the source
+	ret := make([]byte, headerLen, headerLen+len(body))
+	copy(ret, payload[:headerLen])
+	if hasExtension {
+		ret[0] &^= 0x10
+	}
+	if hasPadding {
+		ret[0] &^= 0x20
+	}
+
+	return append(ret, body...)
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRTPNormalize(t *testing.T) {
+	for _, ca := range []struct {
+		name       string
+		extensions bool
+		padding    bool
+		in         []byte
+		out        []byte
+	}{
+		{
+			"extension",
+			true,
+			false,
+			[]byte{
+				0x90, 0x60, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x03,
+				0xbe, 0xde, 0x00, 0x01, 0x10, 0xaa, 0x00, 0x00,
+				0x05, 0x01, 0x02,
+			},
+			[]byte{
+				0x80, 0x60, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x03,
+				0x05, 0x01, 0x02,
+			},
+		},
+		{
+			"padding",
+			false,
+			true,
+			[]byte{
+				0xa0, 0x60, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x03,
+				0x05, 0x01, 0x00, 0x00, 0x03,
+			},
+			[]byte{
+				0x80, 0x60, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x03,
+				0x05, 0x01,
+			},
+		},
+		{
+			"padding with extension and csrc",
+			false,
+			true,
+			[]byte{
+				0xb1, 0x60, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x03,
+				0x00, 0x00, 0x00, 0x04,
+				0xbe, 0xde, 0x00, 0x01, 0x10, 0xaa, 0x00, 0x00,
+				0x05, 0x01, 0x02,
+			},
+			[]byte{
+				0x91, 0x60, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x03,
+				0x00, 0x00, 0x00, 0x04,
+				0xbe, 0xde, 0x00, 0x01, 0x10, 0xaa, 0x00, 0x00,
+				0x05,
+			},
+		},
+		{
+			"both",
+			true,
+			true,
+			[]byte{
+				0xb0, 0x60, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x03,
+				0xbe, 0xde, 0x00, 0x01, 0x10, 0xaa, 0x00, 0x00,
+				0x05, 0x01, 0x02,
+			},
+			[]byte{
+				0x80, 0x60, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x03,
+				0x05,
+			},
+		},
+		{
+			"malformed",
+			true,
+			true,
+			[]byte{
+				0x90, 0x60, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x03,
+				0xbe, 0xde, 0x00, 0x04,
+			},
+			[]byte{
+				0x90, 0x60, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x03,
+				0xbe, 0xde, 0x00, 0x04,
+			},
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			in := append([]byte(nil), ca.in...)
+			require.Equal(t, ca.out, rtpNormalize(in, ca.extensions, ca.padding))
+			require.Equal(t, ca.in, in)
+		})
+	}
+}
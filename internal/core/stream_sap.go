@@ -0,0 +1,277 @@
+package core
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/aler9/gortsplib/pkg/base"
+	"github.com/aler9/gortsplib/pkg/headers"
+	psdp "github.com/pion/sdp/v3"
+)
+
+const (
+	// standard SAP group and port (RFC 2974).
+	sapAddress = "224.2.127.254:9875"
+
+	// interval between announcements.
+	sapInterval = 5 * time.Second
+
+	// TTL of the multicast groups, the same one of the Transport header.
+	sapTTL = 127
+)
+
+// sapPacket encodes a SAP announcement or deletion (RFC 2974)
+// without authentication and with a IPv4 origin.
+func sapPacket(deletion bool, msgIDHash uint16, origin net.IP, sdp []byte) []byte {
+	flags := byte(0x20) // version 1
+	if deletion {
+		flags |= 0x04
+	}
+
+	buf := make([]byte, 8, 8+len("application/sdp")+1+len(sdp))
+	buf[0] = flags
+	buf[1] = 0 // authentication length
+	binary.BigEndian.PutUint16(buf[2:], msgIDHash)
+	copy(buf[4:], origin.To4())
+	buf = append(buf, "application/sdp"...)
+	buf = append(buf, 0)
+	buf = append(buf, sdp...)
+	return buf
+}
+
+// sapSDP returns the session description of the tracks
+// that are sent to the given multicast groups.
+func sapSDP(name string, origin net.IP, tracks gortsplib.Tracks, groups map[int]*net.UDPAddr) []byte {
+	trackIDs := make([]int, 0, len(groups))
+	for trackID := range groups {
+		trackIDs = append(trackIDs, trackID)
+	}
+	sort.Ints(trackIDs)
+
+	ttl := sapTTL
+
+	sout := &psdp.SessionDescription{
+		Origin: psdp.Origin{
+			Username:       "-",
+			NetworkType:    "IN",
+			AddressType:    "IP4",
+			UnicastAddress: origin.String(),
+		},
+		SessionName: psdp.SessionName(name),
+		TimeDescriptions: []psdp.TimeDescription{
+			{Timing: psdp.Timing{StartTime: 0, StopTime: 0}},
+		},
+	}
+
+	for _, trackID := range trackIDs {
+		group := groups[trackID]
+
+		// do not modify the tracks of the stream
+		media := *tracks[trackID].Media
+		media.MediaName.Port = psdp.RangedPort{Value: group.Port}
+		media.ConnectionInformation = &psdp.ConnectionInformation{
+			NetworkType: "IN",
+			AddressType: "IP4",
+			Address:     &psdp.Address{Address: group.IP.String(), TTL: &ttl},
+		}
+		media.Attributes = nil
+		for _, attr := range tracks[trackID].Media.Attributes {
+			if attr.Key != "control" {
+				media.Attributes = append(media.Attributes, attr)
+			}
+		}
+
+		sout.MediaDescriptions = append(sout.MediaDescriptions, &media)
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	sout.Origin.SessionID = uint64(h.Sum32())
+	sout.Origin.SessionVersion = sout.Origin.SessionID
+
+	byts, _ := sout.Marshal()
+	return byts
+}
+
+// streamSAP announces the multicast groups of a stream with SAP,
+// in order to allow decoders to discover them.
+// Groups are announced while there's at least a multicast reader,
+// since the server sends multicast packets only in this case.
+type streamSAP struct {
+	name     string
+	tracks   gortsplib.Tracks
+	interval time.Duration
+	conn     *net.UDPConn
+	origin   net.IP
+
+	mutex   sync.Mutex
+	readers map[reader]map[int]*net.UDPAddr
+
+	// in
+	changed   chan struct{}
+	terminate chan struct{}
+
+	// out
+	done chan struct{}
+}
+
+func newStreamSAP(
+	address string,
+	interval time.Duration,
+	name string,
+	tracks gortsplib.Tracks,
+) (*streamSAP, error) {
+	addr, err := net.ResolveUDPAddr("udp4", address)
+	if err != nil {
+		return nil, err
+	}
+
+	// the origin is the local address used to reach the SAP group
+	conn, err := net.DialUDP("udp4", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &streamSAP{
+		name:      name,
+		tracks:    tracks,
+		interval:  interval,
+		conn:      conn,
+		origin:    conn.LocalAddr().(*net.UDPAddr).IP,
+		readers:   make(map[reader]map[int]*net.UDPAddr),
+		changed:   make(chan struct{}, 1),
+		terminate: make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	go s.run()
+
+	return s, nil
+}
+
+func (s *streamSAP) close() {
+	close(s.terminate)
+	<-s.done
+	s.conn.Close()
+}
+
+// readerAdd is called when a multicast reader starts reading.
+func (s *streamSAP) readerAdd(r reader, groups map[int]*net.UDPAddr) {
+	s.mutex.Lock()
+	s.readers[r] = groups
+	s.mutex.Unlock()
+	s.notify()
+}
+
+// readerRemove is called when a multicast reader stops reading.
+func (s *streamSAP) readerRemove(r reader) {
+	s.mutex.Lock()
+	_, ok := s.readers[r]
+	delete(s.readers, r)
+	s.mutex.Unlock()
+
+	if ok {
+		s.notify()
+	}
+}
+
+func (s *streamSAP) notify() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// sdp returns the session description of the groups in use,
+// or nil if there are no multicast readers.
+func (s *streamSAP) sdp() []byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.readers) == 0 {
+		return nil
+	}
+
+	groups := make(map[int]*net.UDPAddr)
+	for _, rg := range s.readers {
+		for trackID, group := range rg {
+			if trackID < len(s.tracks) {
+				groups[trackID] = group
+			}
+		}
+	}
+
+	return sapSDP(s.name, s.origin, s.tracks, groups)
+}
+
+func (s *streamSAP) send(deletion bool, sdp []byte) {
+	h := fnv.New32a()
+	h.Write(sdp)
+	s.conn.Write(sapPacket(deletion, uint16(h.Sum32()), s.origin, sdp))
+}
+
+func (s *streamSAP) run() {
+	defer close(s.done)
+
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+
+	var announced []byte
+
+	update := func(periodic bool) {
+		cur := s.sdp()
+
+		if string(cur) != string(announced) {
+			if announced != nil {
+				s.send(true, announced)
+			}
+			announced = cur
+			if cur != nil {
+				s.send(false, cur)
+			}
+			return
+		}
+
+		if periodic && cur != nil {
+			s.send(false, cur)
+		}
+	}
+
+	for {
+		select {
+		case <-s.changed:
+			update(false)
+
+		case <-t.C:
+			update(true)
+
+		case <-s.terminate:
+			if announced != nil {
+				s.send(true, announced)
+			}
+			return
+		}
+	}
+}
+
+// sapGroups returns the multicast groups contained in the responses to SETUP requests.
+func sapGroups(responses map[int]*base.Response) map[int]*net.UDPAddr {
+	ret := make(map[int]*net.UDPAddr)
+
+	for trackID, res := range responses {
+		var th headers.Transport
+		err := th.Read(res.Header["Transport"])
+		if err != nil || th.Destination == nil || th.Ports == nil {
+			continue
+		}
+
+		ret[trackID] = &net.UDPAddr{IP: *th.Destination, Port: th.Ports[0]}
+	}
+
+	return ret
+}
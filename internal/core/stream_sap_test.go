@@ -0,0 +1,129 @@
+package core
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/aler9/gortsplib/pkg/base"
+	"github.com/aler9/gortsplib/pkg/headers"
+	psdp "github.com/pion/sdp/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSAPPacket(t *testing.T) {
+	byts := sapPacket(false, 0x1234, net.ParseIP("192.168.1.2"), []byte("v=0\r\n"))
+	require.Equal(t, append([]byte{0x20, 0x00, 0x12, 0x34, 192, 168, 1, 2},
+		[]byte("application/sdp\x00v=0\r\n")...), byts)
+
+	byts = sapPacket(true, 0x1234, net.ParseIP("192.168.1.2"), []byte("v=0\r\n"))
+	require.Equal(t, byte(0x24), byts[0])
+}
+
+func TestSAPSDP(t *testing.T) {
+	track1, err := gortsplib.NewTrackH264(96, &gortsplib.TrackConfigH264{
+		SPS: []byte{0x01, 0x02, 0x03, 0x04},
+		PPS: []byte{0x01, 0x02, 0x03, 0x04},
+	})
+	require.NoError(t, err)
+
+	track2, err := gortsplib.NewTrackAAC(97, &gortsplib.TrackConfigAAC{Type: 2, SampleRate: 44100, ChannelCount: 2})
+	require.NoError(t, err)
+
+	track1.Media.Attributes = append(track1.Media.Attributes, psdp.Attribute{Key: "control", Value: "trackID=0"})
+	tracks := gortsplib.Tracks{track1, track2}
+
+	byts := sapSDP("mystream", net.ParseIP("192.168.1.2"), tracks, map[int]*net.UDPAddr{
+		1: {IP: net.ParseIP("224.1.0.1"), Port: 8002},
+		0: {IP: net.ParseIP("224.1.0.0"), Port: 8002},
+	})
+
+	require.Equal(t, "v=0\r\n"+
+		"o=- 4074331899 4074331899 IN IP4 192.168.1.2\r\n"+
+		"s=mystream\r\n"+
+		"t=0 0\r\n"+
+		"m=video 8002 RTP/AVP 96\r\n"+
+		"c=IN IP4 224.1.0.0/127\r\n"+
+		"a=rtpmap:96 H264/90000\r\n"+
+		"a=fmtp:96 packetization-mode=1; sprop-parameter-sets=AQIDBA==,AQIDBA==; profile-level-id=020304\r\n"+
+		"m=audio 8002 RTP/AVP 97\r\n"+
+		"c=IN IP4 224.1.0.1/127\r\n"+
+		"a=rtpmap:97 mpeg4-generic/44100/2\r\n"+
+		"a=fmtp:97 profile-level-id=1; mode=AAC-hbr; sizelength=13; indexlength=3; "+
+		"indexdeltalength=3; config=1210\r\n",
+		string(byts))
+
+	// controls of the stream are not modified
+	require.Equal(t, "trackID=0", tracks[0].Media.Attributes[len(tracks[0].Media.Attributes)-1].Value)
+}
+
+func TestSAPGroups(t *testing.T) {
+	de := headers.TransportDeliveryMulticast
+	ip := net.ParseIP("224.1.0.3")
+	th := headers.Transport{
+		Protocol:    headers.TransportProtocolUDP,
+		Delivery:    &de,
+		Destination: &ip,
+		Ports:       &[2]int{8002, 8003},
+	}
+
+	groups := sapGroups(map[int]*base.Response{
+		1: {StatusCode: base.StatusOK, Header: base.Header{"Transport": th.Write()}},
+		2: {StatusCode: base.StatusOK},
+	})
+	require.Equal(t, map[int]*net.UDPAddr{
+		1: {IP: ip, Port: 8002},
+	}, groups)
+}
+
+func TestStreamSAP(t *testing.T) {
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+
+	track, err := gortsplib.NewTrackH264(96, &gortsplib.TrackConfigH264{
+		SPS: []byte{0x01, 0x02, 0x03, 0x04},
+		PPS: []byte{0x01, 0x02, 0x03, 0x04},
+	})
+	require.NoError(t, err)
+
+	s, err := newStreamSAP(pc.LocalAddr().String(), 100*time.Millisecond, "mystream", gortsplib.Tracks{track})
+	require.NoError(t, err)
+
+	read := func() []byte {
+		pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+		buf := make([]byte, 2048)
+		n, _, err := pc.ReadFrom(buf)
+		require.NoError(t, err)
+		return buf[:n]
+	}
+
+	// nothing is announced without multicast readers
+	pc.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	_, _, err = pc.ReadFrom(make([]byte, 2048))
+	require.Error(t, err)
+
+	r := &rtspSession{}
+	s.readerAdd(r, map[int]*net.UDPAddr{0: {IP: net.ParseIP("224.1.0.0"), Port: 8002}})
+
+	byts := read()
+	require.Equal(t, byte(0x20), byts[0])
+	require.Equal(t, true, bytes.Contains(byts, []byte("m=video 8002 RTP/AVP 96\r\nc=IN IP4 224.1.0.0/127\r\n")))
+
+	// announcements are repeated
+	require.Equal(t, byts, read())
+
+	s.readerRemove(r)
+
+	for {
+		byts2 := read()
+		if byts2[0] == 0x24 {
+			require.Equal(t, byts[2:], byts2[2:])
+			break
+		}
+	}
+
+	s.close()
+}
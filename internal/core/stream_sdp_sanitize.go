@@ -0,0 +1,83 @@
+package core
+
+import (
+	"strings"
+
+	"github.com/aler9/gortsplib"
+	psdp "github.com/pion/sdp/v3"
+)
+
+// bandwidth types defined by RFC 4566 and RFC 3890.
+var sdpSanitizeBandwidthTypes = map[string]struct{}{
+	"AS":   {},
+	"CT":   {},
+	"RR":   {},
+	"RS":   {},
+	"TIAS": {},
+}
+
+// sdpSanitizeTracks returns a copy of the tracks whose session description
+// can be handled by strict decoders. It removes vendor-specific attributes,
+// removes invalid bandwidth lines and forces packetization-mode=1 on H264 tracks.
+func sdpSanitizeTracks(tracks gortsplib.Tracks) gortsplib.Tracks {
+	ret := make(gortsplib.Tracks, len(tracks))
+
+	for i, track := range tracks {
+		// do not modify the tracks of the source
+		media := *track.Media
+		media.Bandwidth = nil
+		media.Attributes = nil
+
+		for _, bw := range track.Media.Bandwidth {
+			if _, ok := sdpSanitizeBandwidthTypes[bw.Type]; !ok || bw.Experimental || bw.Bandwidth == 0 {
+				continue
+			}
+			media.Bandwidth = append(media.Bandwidth, bw)
+		}
+
+		isH264 := track.IsH264()
+		hasFMTP := false
+
+		for _, attr := range track.Media.Attributes {
+			if strings.HasPrefix(strings.ToLower(attr.Key), "x-") {
+				continue
+			}
+
+			if isH264 && attr.Key == "fmtp" {
+				attr.Value = sdpSanitizeH264FMTP(attr.Value)
+				hasFMTP = true
+			}
+
+			media.Attributes = append(media.Attributes, attr)
+		}
+
+		if isH264 && !hasFMTP && len(media.MediaName.Formats) != 0 {
+			media.Attributes = append(media.Attributes, psdp.Attribute{
+				Key:   "fmtp",
+				Value: media.MediaName.Formats[0] + " packetization-mode=1",
+			})
+		}
+
+		ret[i] = &gortsplib.Track{Media: &media}
+	}
+
+	return ret
+}
+
+func sdpSanitizeH264FMTP(v string) string {
+	tmp := strings.SplitN(v, " ", 2)
+	if len(tmp) != 2 {
+		return v + " packetization-mode=1"
+	}
+
+	var params []string
+	for _, kv := range strings.Split(tmp[1], ";") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" || strings.HasPrefix(strings.ToLower(kv), "packetization-mode=") {
+			continue
+		}
+		params = append(params, kv)
+	}
+
+	return tmp[0] + " " + strings.Join(append([]string{"packetization-mode=1"}, params...), "; ")
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/aler9/gortsplib"
+	psdp "github.com/pion/sdp/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSDPSanitizeTracks(t *testing.T) {
+	videoTrack := &gortsplib.Track{
+		Media: &psdp.MediaDescription{
+			MediaName: psdp.MediaName{
+				Media:   "video",
+				Protos:  []string{"RTP", "AVP"},
+				Formats: []string{"96"},
+			},
+			Bandwidth: []psdp.Bandwidth{
+				{Type: "AS", Bandwidth: 5000},
+				{Type: "AS", Bandwidth: 0},
+				{Experimental: true, Type: "ONVIF", Bandwidth: 1000},
+				{Type: "XYZ", Bandwidth: 1000},
+			},
+			Attributes: []psdp.Attribute{
+				{Key: "rtpmap", Value: "96 H264/90000"},
+				{Key: "fmtp", Value: "96 profile-level-id=64001f; packetization-mode=0;sprop-parameter-sets=Z2QAH6zZQFAFuhAAAAMAEAAAAwPI8YMZYA==,aOvjyyLA"},
+				{Key: "x-dimensions", Value: "1920,1080"},
+				{Key: "X-Framerate", Value: "25"},
+				{Key: "control", Value: "trackID=0"},
+			},
+		},
+	}
+
+	audioTrack := &gortsplib.Track{
+		Media: &psdp.MediaDescription{
+			MediaName: psdp.MediaName{
+				Media:   "audio",
+				Protos:  []string{"RTP", "AVP"},
+				Formats: []string{"0"},
+			},
+			Attributes: []psdp.Attribute{
+				{Key: "x-vendor", Value: "abc"},
+				{Key: "control", Value: "trackID=1"},
+			},
+		},
+	}
+
+	bareVideoTrack := &gortsplib.Track{
+		Media: &psdp.MediaDescription{
+			MediaName: psdp.MediaName{
+				Media:   "video",
+				Protos:  []string{"RTP", "AVP"},
+				Formats: []string{"97"},
+			},
+			Attributes: []psdp.Attribute{
+				{Key: "rtpmap", Value: "97 H264/90000"},
+			},
+		},
+	}
+
+	tracks := gortsplib.Tracks{videoTrack, audioTrack, bareVideoTrack}
+	sanitized := sdpSanitizeTracks(tracks)
+
+	require.Equal(t, []psdp.Bandwidth{{Type: "AS", Bandwidth: 5000}}, sanitized[0].Media.Bandwidth)
+	require.Equal(t, []psdp.Attribute{
+		{Key: "rtpmap", Value: "96 H264/90000"},
+		{Key: "fmtp", Value: "96 packetization-mode=1; profile-level-id=64001f; " +
+			"sprop-parameter-sets=Z2QAH6zZQFAFuhAAAAMAEAAAAwPI8YMZYA==,aOvjyyLA"},
+		{Key: "control", Value: "trackID=0"},
+	}, sanitized[0].Media.Attributes)
+
+	conf, err := sanitized[0].ExtractConfigH264()
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}, conf.PPS)
+
+	require.Equal(t, []psdp.Attribute{
+		{Key: "control", Value: "trackID=1"},
+	}, sanitized[1].Media.Attributes)
+
+	require.Equal(t, []psdp.Attribute{
+		{Key: "rtpmap", Value: "97 H264/90000"},
+		{Key: "fmtp", Value: "97 packetization-mode=1"},
+	}, sanitized[2].Media.Attributes)
+
+	// the tracks of the source are not modified
+	require.Equal(t, 4, len(videoTrack.Media.Bandwidth))
+	require.Equal(t, 5, len(videoTrack.Media.Attributes))
+	require.Equal(t, 2, len(audioTrack.Media.Attributes))
+}
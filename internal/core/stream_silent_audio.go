@@ -0,0 +1,109 @@
+package core
+
+import (
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/aler9/gortsplib/pkg/rtpaac"
+)
+
+const (
+	silentAudioSampleRate = 44100
+
+	// number of access units sent in every RTP packet.
+	silentAudioBatchSize = 4
+)
+
+// a raw AAC-LC mono frame that decodes to silence.
+var silentAudioFrame = []byte{0x01, 0x40, 0x20, 0x07}
+
+// silentAudioFrameDuration is the duration of an AAC frame (1024 samples).
+var silentAudioFrameDuration = time.Duration(1024) * time.Second / silentAudioSampleRate
+
+func tracksHaveAudio(tracks gortsplib.Tracks) bool {
+	for _, t := range tracks {
+		if t.Media.MediaName.Media == "audio" {
+			return true
+		}
+	}
+	return false
+}
+
+type streamSilentAudio struct {
+	trackID     int
+	payloadType uint8
+	onPacketRTP func(int, []byte)
+
+	// in
+	terminate chan struct{}
+
+	// out
+	done chan struct{}
+}
+
+func newStreamSilentAudio(
+	trackID int,
+	payloadType uint8,
+	onPacketRTP func(int, []byte),
+) *streamSilentAudio {
+	s := &streamSilentAudio{
+		trackID:     trackID,
+		payloadType: payloadType,
+		onPacketRTP: onPacketRTP,
+		terminate:   make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	go s.run()
+
+	return s
+}
+
+func (s *streamSilentAudio) close() {
+	close(s.terminate)
+	<-s.done
+}
+
+func (s *streamSilentAudio) run() {
+	defer close(s.done)
+
+	encoder := rtpaac.NewEncoder(s.payloadType, silentAudioSampleRate, nil, nil, nil)
+
+	aus := make([][]byte, silentAudioBatchSize)
+	for i := range aus {
+		aus[i] = silentAudioFrame
+	}
+
+	t := time.NewTicker(silentAudioBatchSize * silentAudioFrameDuration)
+	defer t.Stop()
+
+	start := time.Now()
+	sent := 0
+
+	for {
+		select {
+		case now := <-t.C:
+			// send all the frames that are due, in order not to drift
+			// from the wall clock when the ticker is late.
+			for (sent + silentAudioBatchSize) <= int(now.Sub(start)/silentAudioFrameDuration) {
+				pkts, err := encoder.Encode(aus, time.Duration(sent)*silentAudioFrameDuration)
+				if err != nil {
+					return
+				}
+
+				for _, pkt := range pkts {
+					byts, err := pkt.Marshal()
+					if err != nil {
+						return
+					}
+					s.onPacketRTP(s.trackID, byts)
+				}
+
+				sent += silentAudioBatchSize
+			}
+
+		case <-s.terminate:
+			return
+		}
+	}
+}
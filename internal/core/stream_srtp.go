@@ -0,0 +1,88 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+
+	"github.com/aler9/gortsplib"
+	psdp "github.com/pion/sdp/v3"
+
+	"github.com/aler9/rtsp-simple-server/internal/srtp"
+)
+
+// streamSRTP encrypts the packets sent to RTSP readers with SRTP (RFC 3711),
+// since multicast packets can be received by anyone who joins the multicast group.
+// The master key is sent to readers inside the SDP (RFC 4568), after they
+// have been authenticated, and is replaced when rotate() is called.
+type streamSRTP struct {
+	mutex sync.Mutex
+	key   []byte
+	ctx   *srtp.Context
+}
+
+func newStreamSRTP() *streamSRTP {
+	s := &streamSRTP{}
+	s.rotate()
+	return s
+}
+
+// rotate replaces the master key with a new random one.
+func (s *streamSRTP) rotate() {
+	key := make([]byte, srtp.KeyLen+srtp.SaltLen)
+	rand.Read(key)
+
+	ctx, _ := srtp.NewContext(key[:srtp.KeyLen], key[srtp.KeyLen:])
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.key = key
+	s.ctx = ctx
+}
+
+func (s *streamSRTP) encryptRTP(payload []byte) []byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	byts, err := s.ctx.EncryptRTP(payload)
+	if err != nil {
+		return nil
+	}
+	return byts
+}
+
+func (s *streamSRTP) encryptRTCP(payload []byte) []byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	byts, err := s.ctx.EncryptRTCP(payload)
+	if err != nil {
+		return nil
+	}
+	return byts
+}
+
+// sdp returns the session description sent to readers, that contains the master key.
+// It can't be generated by gortsplib, since it removes unknown attributes from tracks.
+func (s *streamSRTP) sdp(tracks gortsplib.Tracks) []byte {
+	s.mutex.Lock()
+	crypto := "1 " + srtp.CryptoSuite + " inline:" + base64.StdEncoding.EncodeToString(s.key)
+	s.mutex.Unlock()
+
+	ret := make(gortsplib.Tracks, len(tracks))
+
+	for i, track := range tracks {
+		md := *track.Media
+		md.MediaName.Protos = []string{"RTP", "SAVP"}
+		md.Attributes = append(append([]psdp.Attribute(nil), md.Attributes...), psdp.Attribute{
+			Key:   "crypto",
+			Value: crypto,
+		})
+		ret[i] = &gortsplib.Track{Media: &md}
+	}
+
+	// readers must use the UDP-multicast transport protocol,
+	// therefore the SDP contains a multicast address.
+	return ret.Write(true)
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/aler9/gortsplib"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aler9/rtsp-simple-server/internal/srtp"
+)
+
+func TestStreamSRTP(t *testing.T) {
+	track, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x01, 0x02, 0x03, 0x04}, PPS: []byte{0x01, 0x02, 0x03, 0x04}})
+	require.NoError(t, err)
+
+	s := newStreamSRTP()
+
+	tracks, err := gortsplib.ReadTracks(s.sdp(gortsplib.Tracks{track}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"RTP", "SAVP"}, tracks[0].Media.MediaName.Protos)
+
+	crypto, ok := tracks[0].Media.Attribute("crypto")
+	require.Equal(t, true, ok)
+	require.Equal(t, true, strings.HasPrefix(crypto, "1 AES_CM_128_HMAC_SHA1_80 inline:"))
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(crypto, "1 AES_CM_128_HMAC_SHA1_80 inline:"))
+	require.NoError(t, err)
+
+	dec, err := srtp.NewContext(key[:srtp.KeyLen], key[srtp.KeyLen:])
+	require.NoError(t, err)
+
+	pkt := []byte{
+		0x80, 0x60, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x01,
+		0x05, 0x02,
+	}
+
+	decrypted, err := dec.DecryptRTP(s.encryptRTP(pkt))
+	require.NoError(t, err)
+	require.Equal(t, pkt, decrypted)
+
+	// packets encrypted with the new key can't be decrypted with the old one
+	s.rotate()
+
+	pkt[3] = 0x02
+	_, err = dec.DecryptRTP(s.encryptRTP(pkt))
+	require.EqualError(t, err, "authentication failed")
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"encoding/binary"
+	"sync"
+)
+
+type streamSSRCTrack struct {
+	mutex sync.Mutex
+	set   bool
+	ssrc  uint32
+}
+
+// streamSSRC keeps the SSRC of tracks constant, replacing it with the first one
+// received, since some sources change it without reason and some readers
+// stop decoding when it changes.
+type streamSSRC struct {
+	tracks []*streamSSRCTrack
+}
+
+func newStreamSSRC(tracksLen int) *streamSSRC {
+	s := &streamSSRC{
+		tracks: make([]*streamSSRCTrack, tracksLen),
+	}
+
+	for i := range s.tracks {
+		s.tracks[i] = &streamSSRCTrack{}
+	}
+
+	return s
+}
+
+// process replaces the SSRC of a RTP packet received from the source.
+func (s *streamSSRC) process(trackID int, payload []byte) {
+	if len(payload) < 12 {
+		return
+	}
+
+	t := s.tracks[trackID]
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.set {
+		t.set = true
+		t.ssrc = binary.BigEndian.Uint32(payload[8:12])
+		return
+	}
+
+	binary.BigEndian.PutUint32(payload[8:12], t.ssrc)
+}
@@ -0,0 +1,25 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamSSRC(t *testing.T) {
+	s := newStreamSSRC(1)
+
+	pkt := []byte{
+		0x80, 0x60, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02,
+		0x01, 0x02, 0x03, 0x04, 0x05,
+	}
+	s.process(0, pkt)
+	require.Equal(t, []byte{0x01, 0x02, 0x03, 0x04}, pkt[8:12])
+
+	pkt = []byte{
+		0x80, 0x60, 0x00, 0x02, 0x00, 0x00, 0x00, 0x03,
+		0x0a, 0x0b, 0x0c, 0x0d, 0x05,
+	}
+	s.process(0, pkt)
+	require.Equal(t, []byte{0x01, 0x02, 0x03, 0x04}, pkt[8:12])
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/pion/rtp"
+)
+
+// UUID of the precision time stamp defined by MISB ST 0604.
+var timecodeSEIUUID = []byte("MISPmicrosectime")
+
+// timecodeSEI returns a H264 SEI NALU of type user_data_unregistered,
+// that contains the given time in the format defined by MISB ST 0604:
+// microseconds since the Unix epoch, interleaved with 0xFF bytes
+// in order to avoid start code emulation.
+func timecodeSEI(t time.Time) []byte {
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(t.UnixNano()/1000))
+
+	payload := append([]byte(nil), timecodeSEIUUID...)
+	payload = append(payload,
+		0x1F, // status
+		ts[0], ts[1], 0xFF,
+		ts[2], ts[3], 0xFF,
+		ts[4], ts[5], 0xFF,
+		ts[6], ts[7])
+
+	nalu := []byte{
+		0x06, // SEI
+		0x05, // user_data_unregistered
+		byte(len(payload)),
+	}
+	nalu = append(nalu, payload...)
+	nalu = append(nalu, 0x80) // rbsp_trailing_bits
+
+	return nalu
+}
+
+type streamTimecodeSEITrack struct {
+	mutex     sync.Mutex
+	hasLast   bool
+	lastTS    uint32
+	seqOffset uint16
+}
+
+// streamTimecodeSEI inserts a SEI NALU with the time of the server
+// before every access unit of H264 tracks. SEI NALUs are sent in dedicated
+// RTP packets, therefore the sequence numbers of the following packets are shifted.
+type streamTimecodeSEI struct {
+	tracks []*streamTimecodeSEITrack
+}
+
+func newStreamTimecodeSEI(tracks gortsplib.Tracks) *streamTimecodeSEI {
+	s := &streamTimecodeSEI{
+		tracks: make([]*streamTimecodeSEITrack, len(tracks)),
+	}
+
+	for i, track := range tracks {
+		if track.IsH264() {
+			s.tracks[i] = &streamTimecodeSEITrack{}
+		}
+	}
+
+	return s
+}
+
+// process returns the packets that must be forwarded to readers in place of the given one.
+func (s *streamTimecodeSEI) process(trackID int, payload []byte) [][]byte {
+	t := s.tracks[trackID]
+	if t == nil {
+		return [][]byte{payload}
+	}
+
+	var pkt rtp.Packet
+	err := pkt.Unmarshal(payload)
+	if err != nil {
+		return [][]byte{payload}
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var ret [][]byte
+
+	// the packet begins a new access unit
+	if !t.hasLast || pkt.Timestamp != t.lastTS {
+		sei := rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    pkt.PayloadType,
+				SequenceNumber: pkt.SequenceNumber + t.seqOffset,
+				Timestamp:      pkt.Timestamp,
+				SSRC:           pkt.SSRC,
+			},
+			Payload: timecodeSEI(time.Now()),
+		}
+
+		byts, err := sei.Marshal()
+		if err == nil {
+			ret = append(ret, byts)
+			t.seqOffset++
+		}
+	}
+
+	t.hasLast = true
+	t.lastTS = pkt.Timestamp
+
+	pkt.SequenceNumber += t.seqOffset
+	byts, err := pkt.Marshal()
+	if err != nil {
+		return ret
+	}
+
+	return append(ret, byts)
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimecodeSEI(t *testing.T) {
+	ts := time.Date(2021, 5, 3, 10, 20, 30, 123456000, time.UTC)
+	nalu := timecodeSEI(ts)
+
+	require.Equal(t, []byte{0x06, 0x05, 28}, nalu[:3])
+	require.Equal(t, []byte("MISPmicrosectime"), nalu[3:19])
+	require.Equal(t, byte(0x80), nalu[len(nalu)-1])
+
+	raw := nalu[20:31]
+	require.Equal(t, byte(0xFF), raw[2])
+	require.Equal(t, byte(0xFF), raw[5])
+	require.Equal(t, byte(0xFF), raw[8])
+
+	us := binary.BigEndian.Uint64([]byte{raw[0], raw[1], raw[3], raw[4], raw[6], raw[7], raw[9], raw[10]})
+	require.Equal(t, uint64(ts.UnixNano()/1000), us)
+}
+
+func TestStreamTimecodeSEI(t *testing.T) {
+	videoTrack, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x01, 0x02, 0x03, 0x04}, PPS: []byte{0x01, 0x02, 0x03, 0x04}})
+	require.NoError(t, err)
+
+	audioTrack, err := gortsplib.NewTrackAAC(97,
+		&gortsplib.TrackConfigAAC{Type: 2, SampleRate: 44100, ChannelCount: 2})
+	require.NoError(t, err)
+
+	s := newStreamTimecodeSEI(gortsplib.Tracks{videoTrack, audioTrack})
+
+	marshal := func(seq uint16, ts uint32, marker bool) []byte {
+		byts, err := (&rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         marker,
+				PayloadType:    96,
+				SequenceNumber: seq,
+				Timestamp:      ts,
+				SSRC:           0x10203040,
+			},
+			Payload: []byte{0x7c, 0x85, 0x01},
+		}).Marshal()
+		require.NoError(t, err)
+		return byts
+	}
+
+	// non-H264 tracks are not modified
+	byts := marshal(10, 1000, true)
+	require.Equal(t, [][]byte{byts}, s.process(1, byts))
+
+	var out []*rtp.Packet
+	for _, in := range [][]byte{
+		marshal(100, 1000, false),
+		marshal(101, 1000, true),
+		marshal(102, 4000, true),
+	} {
+		for _, byts := range s.process(0, in) {
+			var pkt rtp.Packet
+			err := pkt.Unmarshal(byts)
+			require.NoError(t, err)
+			out = append(out, &pkt)
+		}
+	}
+
+	require.Len(t, out, 5)
+
+	for i, pkt := range out {
+		require.Equal(t, uint16(100+i), pkt.SequenceNumber)
+	}
+
+	// a SEI is inserted before every access unit
+	require.Equal(t, byte(0x06), out[0].Payload[0])
+	require.Equal(t, uint32(1000), out[0].Timestamp)
+	require.Equal(t, false, out[0].Marker)
+	require.Equal(t, byte(0x06), out[3].Payload[0])
+	require.Equal(t, uint32(4000), out[3].Timestamp)
+	require.Equal(t, []byte{0x7c, 0x85, 0x01}, out[4].Payload)
+}
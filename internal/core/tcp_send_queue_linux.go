@@ -0,0 +1,37 @@
+//go:build linux
+// +build linux
+
+package core
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// tcpSendQueue returns the number of bytes that are in the send queue
+// of a TCP connection, and have not been sent or acknowledged yet.
+func tcpSendQueue(nconn net.Conn) (uint64, bool) {
+	tc, ok := nconn.(*net.TCPConn)
+	if !ok {
+		return 0, false
+	}
+
+	rc, err := tc.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+
+	var v int32
+	var errno syscall.Errno
+
+	err = rc.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd,
+			uintptr(syscall.TIOCOUTQ), uintptr(unsafe.Pointer(&v)))
+	})
+	if err != nil || errno != 0 || v < 0 {
+		return 0, false
+	}
+
+	return uint64(v), true
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package core
+
+import (
+	"net"
+)
+
+// tcpSendQueue is not available on this platform.
+func tcpSendQueue(nconn net.Conn) (uint64, bool) {
+	return 0, false
+}
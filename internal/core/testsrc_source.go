@@ -0,0 +1,269 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/aler9/gortsplib/pkg/rtph264"
+	"github.com/pion/rtp"
+	psdp "github.com/pion/sdp/v3"
+
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+	"github.com/aler9/rtsp-simple-server/internal/rtcpsenderset"
+	"github.com/aler9/rtsp-simple-server/internal/testsrc"
+)
+
+const (
+	// duration of the audio contained in every RTP packet.
+	testsrcAudioPacketDuration = 20 * time.Millisecond
+
+	// interval between IDR frames.
+	testsrcIDRInterval = 1 * time.Second
+)
+
+type testsrcSourceParent interface {
+	log(logger.Level, string, ...interface{})
+	onSourceStaticSetReady(req pathSourceStaticSetReadyReq) pathSourceStaticSetReadyRes
+	OnSourceStaticSetNotReady(req pathSourceStaticSetNotReadyReq)
+}
+
+// testsrcSource is a static source that generates a test pattern.
+type testsrcSource struct {
+	width  int
+	height int
+	fps    int
+	retry  *sourceRetry
+	wg     *sync.WaitGroup
+	parent testsrcSourceParent
+
+	ctx       context.Context
+	ctxCancel func()
+}
+
+func newTestsrcSource(
+	parentCtx context.Context,
+	width int,
+	height int,
+	fps int,
+	retry *sourceRetry,
+	wg *sync.WaitGroup,
+	parent testsrcSourceParent) *testsrcSource {
+	ctx, ctxCancel := context.WithCancel(parentCtx)
+
+	s := &testsrcSource{
+		width:     width,
+		height:    height,
+		fps:       fps,
+		retry:     retry,
+		wg:        wg,
+		parent:    parent,
+		ctx:       ctx,
+		ctxCancel: ctxCancel,
+	}
+
+	s.log(logger.Info, "started")
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s
+}
+
+func (s *testsrcSource) close() {
+	s.log(logger.Info, "stopped")
+	s.ctxCancel()
+}
+
+func (s *testsrcSource) log(level logger.Level, format string, args ...interface{}) {
+	s.parent.log(level, "[testsrc source] "+format, args...)
+}
+
+func (s *testsrcSource) run() {
+	defer s.wg.Done()
+
+outer:
+	for {
+		err := s.runInner()
+		if err == nil {
+			break outer
+		}
+
+		s.log(logger.Info, "ERR: %s", err)
+
+		pause, ok := s.retry.onFailure()
+		if !ok {
+			s.log(logger.Info, "too many consecutive failures, giving up")
+			break outer
+		}
+
+		select {
+		case <-time.After(pause):
+		case <-s.ctx.Done():
+			break outer
+		}
+	}
+
+	s.ctxCancel()
+}
+
+func randUint32() (uint32, error) {
+	var b [4]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b[:]), nil
+}
+
+// newPCMUTrack returns a G.711 mu-law track.
+func newPCMUTrack() *gortsplib.Track {
+	return &gortsplib.Track{
+		Media: &psdp.MediaDescription{
+			MediaName: psdp.MediaName{
+				Media:   "audio",
+				Protos:  []string{"RTP", "AVP"},
+				Formats: []string{"0"},
+			},
+			Attributes: []psdp.Attribute{
+				{
+					Key:   "rtpmap",
+					Value: "0 PCMU/8000",
+				},
+			},
+		},
+	}
+}
+
+// runInner generates the test pattern until the source is closed (and returns nil) or an error occurs.
+func (s *testsrcSource) runInner() error {
+	pattern := testsrc.NewPattern(s.width, s.height, s.fps)
+	encoder := testsrc.NewEncoder(s.width, s.height, s.fps,
+		int(time.Duration(s.fps)*testsrcIDRInterval/time.Second))
+	var tone testsrc.Tone
+
+	videoTrack, err := gortsplib.NewTrackH264(96, &gortsplib.TrackConfigH264{
+		SPS: encoder.SPS(),
+		PPS: encoder.PPS(),
+	})
+	if err != nil {
+		return err
+	}
+
+	tracks := gortsplib.Tracks{videoTrack, newPCMUTrack()}
+
+	audioSSRC, err := randUint32()
+	if err != nil {
+		return err
+	}
+	audioSequenceNumber, err := randUint32()
+	if err != nil {
+		return err
+	}
+	audioTimestamp, err := randUint32()
+	if err != nil {
+		return err
+	}
+
+	res := s.parent.onSourceStaticSetReady(pathSourceStaticSetReadyReq{
+		Source: s,
+		Tracks: tracks,
+	})
+	if res.Err != nil {
+		return res.Err
+	}
+
+	s.log(logger.Info, "ready")
+	s.retry.onSuccess()
+
+	defer func() {
+		s.parent.OnSourceStaticSetNotReady(pathSourceStaticSetNotReadyReq{Source: s})
+	}()
+
+	rtcpSenders := rtcpsenderset.New(tracks, res.Stream.onPacketRTCP)
+	defer rtcpSenders.Close()
+
+	videoEncoder := rtph264.NewEncoder(96, nil, nil, nil)
+	audioSamples := int(testsrcAudioPacketDuration * testsrc.ToneSampleRate / time.Second)
+
+	start := time.Now()
+	videoCount := 0
+	audioCount := 0
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		videoPTS := time.Duration(videoCount) * time.Second / time.Duration(s.fps)
+		audioPTS := time.Duration(audioCount) * testsrcAudioPacketDuration
+
+		pts := videoPTS
+		if audioPTS < pts {
+			pts = audioPTS
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(time.Until(start.Add(pts)))
+
+		select {
+		case <-timer.C:
+		case <-s.ctx.Done():
+			return nil
+		}
+
+		if videoPTS <= audioPTS {
+			nalu, _ := encoder.Encode(pattern.Draw(videoCount))
+			videoCount++
+
+			pkts, err := videoEncoder.Encode([][]byte{nalu}, videoPTS)
+			if err != nil {
+				return fmt.Errorf("error while encoding H264: %v", err)
+			}
+
+			byts, err := marshalRTPPackets(pkts)
+			if err != nil {
+				return fmt.Errorf("error while encoding H264: %v", err)
+			}
+
+			for _, pkt := range byts {
+				rtcpSenders.OnPacketRTP(0, pkt)
+				res.Stream.onPacketRTP(0, pkt)
+			}
+		} else {
+			pkt := rtp.Packet{
+				Header: rtp.Header{
+					Version:        2,
+					PayloadType:    0,
+					SequenceNumber: uint16(audioSequenceNumber) + uint16(audioCount),
+					Timestamp:      audioTimestamp + uint32(audioCount*audioSamples),
+					SSRC:           audioSSRC,
+				},
+				Payload: tone.Read(audioSamples),
+			}
+			audioCount++
+
+			byts, err := pkt.Marshal()
+			if err != nil {
+				return err
+			}
+			rtcpSenders.OnPacketRTP(1, byts)
+			res.Stream.onPacketRTP(1, byts)
+		}
+	}
+}
+
+// onSourceAPIDescribe implements source.
+func (s *testsrcSource) onSourceAPIDescribe() interface{} {
+	return struct {
+		Type string `json:"type"`
+	}{"testsrcSource"}
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTestsrcSource(t *testing.T) {
+	p, ok := newInstance("hlsDisable: yes\n" +
+		"rtmpDisable: yes\n" +
+		"paths:\n" +
+		"  test:\n" +
+		"    source: testsrc\n" +
+		"    testsrcWidth: 160\n" +
+		"    testsrcHeight: 120\n" +
+		"    testsrcFPS: 10\n")
+	require.Equal(t, true, ok)
+	defer p.close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	var mutex sync.Mutex
+	received := make(map[int]int)
+
+	c := gortsplib.Client{
+		OnPacketRTP: func(trackID int, payload []byte) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			received[trackID]++
+		},
+	}
+
+	err := c.StartReading("rtsp://localhost:8554/test")
+	require.NoError(t, err)
+	defer c.Close()
+
+	tracks := c.Tracks()
+	require.Equal(t, 2, len(tracks))
+	require.Equal(t, true, tracks[0].IsH264())
+	require.Equal(t, []string{"0"}, tracks[1].Media.MediaName.Formats)
+
+	time.Sleep(500 * time.Millisecond)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.NotZero(t, received[0])
+	require.NotZero(t, received[1])
+}
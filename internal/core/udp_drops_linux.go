@@ -0,0 +1,70 @@
+//go:build linux
+// +build linux
+
+package core
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// udpDrops returns the number of packets that were dropped by the UDP sockets
+// bound to a local port, since their receive buffer was full.
+func udpDrops(port int) (uint64, bool) {
+	var ret uint64
+	found := false
+
+	for _, fpath := range []string{"/proc/net/udp", "/proc/net/udp6"} {
+		byts, err := ioutil.ReadFile(fpath)
+		if err != nil {
+			continue
+		}
+
+		if n, ok := procNetUDPDrops(string(byts), port); ok {
+			ret += n
+			found = true
+		}
+	}
+
+	return ret, found
+}
+
+// procNetUDPDrops sums the drops of the sockets listed in /proc/net/udp
+// that are bound to a local port.
+func procNetUDPDrops(content string, port int) (uint64, bool) {
+	var ret uint64
+	found := false
+
+	// the first line contains the header
+	lines := strings.Split(content, "\n")
+
+	for _, line := range lines[1:] {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt
+		// uid timeout inode ref pointer drops
+		fields := strings.Fields(line)
+		if len(fields) < 13 {
+			continue
+		}
+
+		i := strings.LastIndexByte(fields[1], ':')
+		if i < 0 {
+			continue
+		}
+
+		p, err := strconv.ParseUint(fields[1][i+1:], 16, 16)
+		if err != nil || int(p) != port {
+			continue
+		}
+
+		n, err := strconv.ParseUint(fields[12], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		ret += n
+		found = true
+	}
+
+	return ret, found
+}
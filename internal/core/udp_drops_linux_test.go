@@ -0,0 +1,29 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcNetUDPDrops(t *testing.T) {
+	content := "   sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt" +
+		"   uid  timeout inode ref pointer drops            \n" +
+		"  100: 00000000:1F40 00000000:0000 07 00000000:00000000 00:00000000 00000000" +
+		"     0        0 23190 2 0000000000000000 15        \n" +
+		"  101: 00000000:1F41 00000000:0000 07 00000000:00000000 00:00000000 00000000" +
+		"     0        0 23191 2 0000000000000000 0         \n" +
+		"  102: 0100007F:1F40 00000000:0000 07 00000000:00000000 00:00000000 00000000" +
+		"     0        0 23192 2 0000000000000000 3         \n"
+
+	n, ok := procNetUDPDrops(content, 8000)
+	require.Equal(t, true, ok)
+	require.Equal(t, uint64(18), n)
+
+	n, ok = procNetUDPDrops(content, 8001)
+	require.Equal(t, true, ok)
+	require.Equal(t, uint64(0), n)
+
+	_, ok = procNetUDPDrops(content, 8002)
+	require.Equal(t, false, ok)
+}
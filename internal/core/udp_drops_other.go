@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package core
+
+// udpDrops is not available on this platform.
+func udpDrops(port int) (uint64, bool) {
+	return 0, false
+}
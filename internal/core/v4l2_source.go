@@ -0,0 +1,273 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/aler9/gortsplib/pkg/h264"
+	"github.com/aler9/gortsplib/pkg/rtph264"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+	"github.com/aler9/rtsp-simple-server/internal/rtcpsenderset"
+	"github.com/aler9/rtsp-simple-server/internal/v4l2"
+)
+
+// device of the Raspberry Pi Camera, provided by the legacy camera stack.
+const rpiCameraDevice = "/dev/video0"
+
+// maximum time spent inside a single read, that allows to check whether the source has been closed.
+const v4l2SourceReadPeriod = 500 * time.Millisecond
+
+type v4l2SourceParent interface {
+	log(logger.Level, string, ...interface{})
+	onSourceStaticSetReady(req pathSourceStaticSetReadyReq) pathSourceStaticSetReadyRes
+	OnSourceStaticSetNotReady(req pathSourceStaticSetNotReadyReq)
+}
+
+type v4l2Source struct {
+	typ         string
+	device      string
+	params      v4l2.Params
+	readTimeout conf.StringDuration
+	retry       *sourceRetry
+	wg          *sync.WaitGroup
+	parent      v4l2SourceParent
+
+	ctx       context.Context
+	ctxCancel func()
+}
+
+func newV4L2Source(
+	parentCtx context.Context,
+	typ string,
+	device string,
+	params v4l2.Params,
+	readTimeout conf.StringDuration,
+	retry *sourceRetry,
+	wg *sync.WaitGroup,
+	parent v4l2SourceParent) *v4l2Source {
+	ctx, ctxCancel := context.WithCancel(parentCtx)
+
+	s := &v4l2Source{
+		typ:         typ,
+		device:      device,
+		params:      params,
+		readTimeout: readTimeout,
+		retry:       retry,
+		wg:          wg,
+		parent:      parent,
+		ctx:         ctx,
+		ctxCancel:   ctxCancel,
+	}
+
+	s.log(logger.Info, "started")
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s
+}
+
+func (s *v4l2Source) close() {
+	s.log(logger.Info, "stopped")
+	s.ctxCancel()
+}
+
+func (s *v4l2Source) log(level logger.Level, format string, args ...interface{}) {
+	s.parent.log(level, "["+strings.ToLower(s.typ)+" source] "+format, args...)
+}
+
+func (s *v4l2Source) run() {
+	defer s.wg.Done()
+
+outer:
+	for {
+		err := s.runInner()
+		if err == nil {
+			break outer
+		}
+
+		s.log(logger.Info, "ERR: %s", err)
+
+		pause, ok := s.retry.onFailure()
+		if !ok {
+			s.log(logger.Info, "too many consecutive failures, giving up")
+			break outer
+		}
+
+		select {
+		case <-time.After(pause):
+		case <-s.ctx.Done():
+			break outer
+		}
+	}
+
+	s.ctxCancel()
+}
+
+// runInner captures frames until the source is closed (and returns nil) or an error occurs.
+func (s *v4l2Source) runInner() error {
+	s.log(logger.Debug, "opening %s", s.device)
+
+	dev, err := v4l2.Open(s.device, s.params)
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+
+	lastFrame := time.Now()
+
+	readFrame := func() ([]byte, error) {
+		for {
+			frame, err := dev.Read(v4l2SourceReadPeriod)
+			if err != nil {
+				return nil, err
+			}
+
+			select {
+			case <-s.ctx.Done():
+				return nil, nil
+			default:
+			}
+
+			if frame != nil {
+				lastFrame = time.Now()
+				return frame, nil
+			}
+
+			if time.Since(lastFrame) >= time.Duration(s.readTimeout) {
+				return nil, fmt.Errorf("no frames received")
+			}
+		}
+	}
+
+	return runH264FrameSource(readFrame, s, s.parent, s.retry, s.log)
+}
+
+// runH264FrameSource publishes frames in the H264 Annex-B format, read with readFrame,
+// that returns nil when the source is closed.
+// The source becomes ready as soon as SPS and PPS are received.
+func runH264FrameSource(
+	readFrame func() ([]byte, error),
+	src sourceStatic,
+	parent v4l2SourceParent,
+	retry *sourceRetry,
+	log func(logger.Level, string, ...interface{}),
+) error {
+	var sps []byte
+	var pps []byte
+	var frame []byte
+
+	for sps == nil || pps == nil {
+		var err error
+		frame, err = readFrame()
+		if err != nil {
+			return err
+		}
+		if frame == nil {
+			return nil
+		}
+
+		nalus, err := h264.DecodeAnnexB(frame)
+		if err != nil {
+			return err
+		}
+
+		for _, nalu := range nalus {
+			if len(nalu) == 0 {
+				continue
+			}
+
+			switch h264.NALUType(nalu[0] & 0x1F) {
+			case h264.NALUTypeSPS:
+				sps = append([]byte(nil), nalu...)
+			case h264.NALUTypePPS:
+				pps = append([]byte(nil), nalu...)
+			}
+		}
+	}
+
+	track, err := gortsplib.NewTrackH264(96, &gortsplib.TrackConfigH264{SPS: sps, PPS: pps})
+	if err != nil {
+		return err
+	}
+	tracks := gortsplib.Tracks{track}
+
+	res := parent.onSourceStaticSetReady(pathSourceStaticSetReadyReq{
+		Source: src,
+		Tracks: tracks,
+	})
+	if res.Err != nil {
+		return res.Err
+	}
+
+	log(logger.Info, "ready")
+	retry.onSuccess()
+
+	defer func() {
+		parent.OnSourceStaticSetNotReady(pathSourceStaticSetNotReadyReq{Source: src})
+	}()
+
+	rtcpSenders := rtcpsenderset.New(tracks, res.Stream.onPacketRTCP)
+	defer rtcpSenders.Close()
+
+	encoder := rtph264.NewEncoder(96, nil, nil, nil)
+	start := time.Now()
+
+	for {
+		nalus, err := h264.DecodeAnnexB(frame)
+		if err != nil {
+			return err
+		}
+
+		var outNALUs [][]byte
+		for _, nalu := range nalus {
+			if len(nalu) == 0 {
+				continue
+			}
+
+			// remove SPS, PPS and AUD, not needed by RTSP / RTMP
+			switch h264.NALUType(nalu[0] & 0x1F) {
+			case h264.NALUTypeSPS, h264.NALUTypePPS, h264.NALUTypeAccessUnitDelimiter:
+				continue
+			}
+			outNALUs = append(outNALUs, nalu)
+		}
+
+		if len(outNALUs) != 0 {
+			pkts, err := encoder.Encode(outNALUs, time.Since(start))
+			if err != nil {
+				return fmt.Errorf("error while encoding H264: %v", err)
+			}
+
+			for _, pkt := range pkts {
+				byts, err := pkt.Marshal()
+				if err != nil {
+					return fmt.Errorf("error while encoding H264: %v", err)
+				}
+				rtcpSenders.OnPacketRTP(0, byts)
+				res.Stream.onPacketRTP(0, byts)
+			}
+		}
+
+		frame, err = readFrame()
+		if err != nil {
+			return err
+		}
+		if frame == nil {
+			return nil
+		}
+	}
+}
+
+// onSourceAPIDescribe implements source.
+func (s *v4l2Source) onSourceAPIDescribe() interface{} {
+	return struct {
+		Type string `json:"type"`
+	}{s.typ + "Source"}
+}
@@ -0,0 +1,178 @@
+// Package cron contains a parser of cron-like schedule expressions.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type field struct {
+	name  string
+	min   int
+	max   int
+	names []string
+}
+
+var fields = []field{
+	{"minute", 0, 59, nil},
+	{"hour", 0, 23, nil},
+	{"day of month", 1, 31, nil},
+	{"month", 1, 12, []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	// 7 is an alias of Sunday
+	{"day of week", 0, 7, []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// Schedule is a cron-like schedule expression, made of five fields
+// (minute, hour, day of month, month, day of week).
+// Every field can be a wildcard (*), a value, a range (1-5), a list (1,3,5)
+// and can have a step (*/15, 9-17/2). Months and days of week can be
+// specified with their three-letter english names.
+type Schedule struct {
+	minutes  uint64
+	hours    uint64
+	doms     uint64
+	months   uint64
+	dows     uint64
+	domStar  bool
+	dowStar  bool
+	original string
+}
+
+// Parse parses a schedule expression.
+func Parse(s string) (*Schedule, error) {
+	parts := strings.Fields(s)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("expected %d fields, got %d", len(fields), len(parts))
+	}
+
+	var sets [5]uint64
+	for i, f := range fields {
+		var err error
+		sets[i], err = f.parse(parts[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Sunday can be specified with 0 or 7
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return &Schedule{
+		minutes:  sets[0],
+		hours:    sets[1],
+		doms:     sets[2],
+		months:   sets[3],
+		dows:     sets[4],
+		domStar:  parts[2] == "*",
+		dowStar:  parts[4] == "*",
+		original: s,
+	}, nil
+}
+
+// String implements fmt.Stringer.
+func (s *Schedule) String() string {
+	return s.original
+}
+
+// Match checks whether a time is inside the schedule.
+// The precision is one minute.
+func (s *Schedule) Match(t time.Time) bool {
+	if s.minutes&(1<<uint(t.Minute())) == 0 ||
+		s.hours&(1<<uint(t.Hour())) == 0 ||
+		s.months&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	dom := s.doms&(1<<uint(t.Day())) != 0
+	dow := s.dows&(1<<uint(t.Weekday())) != 0
+
+	// when both days of month and days of week are restricted,
+	// a time matches if it matches either one, like in cron.
+	if !s.domStar && !s.dowStar {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+func (f field) value(s string) (int, error) {
+	for i, n := range f.names {
+		if strings.EqualFold(s, n) {
+			return f.min + i, nil
+		}
+	}
+
+	v, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: '%s'", f.name, s)
+	}
+
+	if int(v) < f.min || int(v) > f.max {
+		return 0, fmt.Errorf("invalid %s: %d (it must be between %d and %d)", f.name, v, f.min, f.max)
+	}
+
+	return int(v), nil
+}
+
+func (f field) parse(s string) (uint64, error) {
+	var set uint64
+
+	for _, item := range strings.Split(s, ",") {
+		step := 1
+		if i := strings.IndexByte(item, '/'); i >= 0 {
+			v, err := strconv.ParseUint(item[i+1:], 10, 8)
+			if err != nil || v == 0 {
+				return 0, fmt.Errorf("invalid step of %s: '%s'", f.name, item[i+1:])
+			}
+			step = int(v)
+			item = item[:i]
+		}
+
+		var start, end int
+
+		switch {
+		case item == "*":
+			start, end = f.min, f.max
+
+		case strings.Contains(item, "-"):
+			tmp := strings.SplitN(item, "-", 2)
+
+			var err error
+			start, err = f.value(tmp[0])
+			if err != nil {
+				return 0, err
+			}
+
+			end, err = f.value(tmp[1])
+			if err != nil {
+				return 0, err
+			}
+
+			if end < start {
+				return 0, fmt.Errorf("invalid range of %s: '%s'", f.name, item)
+			}
+
+		default:
+			var err error
+			start, err = f.value(item)
+			if err != nil {
+				return 0, err
+			}
+
+			// a value with a step is the start of a range, like in cron
+			end = start
+			if step != 1 {
+				end = f.max
+			}
+		}
+
+		for v := start; v <= end; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+
+	return set, nil
+}
@@ -0,0 +1,63 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatch(t *testing.T) {
+	for _, ca := range []struct {
+		name  string
+		expr  string
+		time  string
+		match bool
+	}{
+		{"wildcard", "* * * * *", "2021-12-06 03:04", true},
+		{"business hours", "* 9-17 * * mon-fri", "2021-12-06 09:00", true},
+		{"business hours end", "* 9-17 * * mon-fri", "2021-12-06 18:00", false},
+		{"business hours weekend", "* 9-17 * * mon-fri", "2021-12-05 10:00", false},
+		{"step", "*/15 * * * *", "2021-12-06 10:45", true},
+		{"step no match", "*/15 * * * *", "2021-12-06 10:46", false},
+		{"range step", "0-30/10 * * * *", "2021-12-06 10:20", true},
+		{"value step", "5/20 * * * *", "2021-12-06 10:45", true},
+		{"list", "0 8,20 * * *", "2021-12-06 20:00", true},
+		{"month name", "* * * dec *", "2021-12-06 20:00", true},
+		{"month", "* * * 1-11 *", "2021-12-06 20:00", false},
+		{"sunday 7", "* * * * 7", "2021-12-05 20:00", true},
+		{"dom or dow", "* * 1 * mon", "2021-12-06 20:00", true},
+		{"dom or dow no match", "* * 1 * tue", "2021-12-06 20:00", false},
+		{"dom and wildcard dow", "* * 6 * *", "2021-12-06 20:00", true},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			s, err := Parse(ca.expr)
+			require.NoError(t, err)
+			require.Equal(t, ca.expr, s.String())
+
+			tm, err := time.Parse("2006-01-02 15:04", ca.time)
+			require.NoError(t, err)
+			require.Equal(t, ca.match, s.Match(tm))
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, ca := range []struct {
+		expr string
+		err  string
+	}{
+		{"* * * *", "expected 5 fields, got 4"},
+		{"60 * * * *", "invalid minute: 60 (it must be between 0 and 59)"},
+		{"* 24 * * *", "invalid hour: 24 (it must be between 0 and 23)"},
+		{"* * 0 * *", "invalid day of month: 0 (it must be between 1 and 31)"},
+		{"* * * foo *", "invalid month: 'foo'"},
+		{"* * * * 5-1", "invalid range of day of week: '5-1'"},
+		{"*/0 * * * *", "invalid step of minute: '0'"},
+	} {
+		t.Run(ca.expr, func(t *testing.T) {
+			_, err := Parse(ca.expr)
+			require.EqualError(t, err, ca.err)
+		})
+	}
+}
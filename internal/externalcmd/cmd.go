@@ -1,6 +1,7 @@
 package externalcmd
 
 import (
+	"strconv"
 	"time"
 )
 
@@ -12,6 +13,25 @@ const (
 type Environment struct {
 	Path string
 	Port string
+
+	// capture groups of the regular expression of the path,
+	// available in the G1, G2, ... variables.
+	Captures []string
+
+	// if not nil, it is written to the standard input of the command
+	// every time the command is started.
+	Stdin []byte
+}
+
+func (env Environment) variables() []string {
+	ret := []string{
+		"RTSP_PATH=" + env.Path,
+		"RTSP_PORT=" + env.Port,
+	}
+	for i, c := range env.Captures {
+		ret = append(ret, "G"+strconv.Itoa(i+1)+"="+c)
+	}
+	return ret
 }
 
 // Cmd is an external command.
@@ -4,6 +4,7 @@
 package externalcmd
 
 import (
+	"bytes"
 	"os"
 	"os/exec"
 	"syscall"
@@ -12,10 +13,11 @@ import (
 func (e *Cmd) runInner() bool {
 	cmd := exec.Command("/bin/sh", "-c", "exec "+e.cmdstr)
 
-	cmd.Env = append(os.Environ(),
-		"RTSP_PATH="+e.env.Path,
-		"RTSP_PORT="+e.env.Port,
-	)
+	cmd.Env = append(os.Environ(), e.env.variables()...)
+
+	if e.env.Stdin != nil {
+		cmd.Stdin = bytes.NewReader(e.env.Stdin)
+	}
 
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
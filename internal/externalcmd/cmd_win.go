@@ -4,8 +4,10 @@
 package externalcmd
 
 import (
+	"bytes"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 
 	"github.com/kballard/go-shellquote"
@@ -17,6 +19,10 @@ func (e *Cmd) runInner() bool {
 	// with Linux commands
 	tmp := strings.ReplaceAll(e.cmdstr, "$RTSP_PATH", e.env.Path)
 	tmp = strings.ReplaceAll(tmp, "$RTSP_PORT", e.env.Port)
+	// replace from the last capture, in order not to replace $G1 inside $G10
+	for i := len(e.env.Captures) - 1; i >= 0; i-- {
+		tmp = strings.ReplaceAll(tmp, "$G"+strconv.Itoa(i+1), e.env.Captures[i])
+	}
 	parts, err := shellquote.Split(tmp)
 	if err != nil {
 		return true
@@ -24,10 +30,11 @@ func (e *Cmd) runInner() bool {
 
 	cmd := exec.Command(parts[0], parts[1:]...)
 
-	cmd.Env = append(os.Environ(),
-		"RTSP_PATH="+e.env.Path,
-		"RTSP_PORT="+e.env.Port,
-	)
+	cmd.Env = append(os.Environ(), e.env.variables()...)
+
+	if e.env.Stdin != nil {
+		cmd.Stdin = bytes.NewReader(e.env.Stdin)
+	}
 
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
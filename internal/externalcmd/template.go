@@ -0,0 +1,82 @@
+package externalcmd
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// functions that can be used inside command templates, mainly to filter events.
+var templateFuncs = template.FuncMap{
+	// match reports whether a string matches a regular expression.
+	"match": func(pattern string, s string) (bool, error) {
+		return regexp.MatchString(pattern, s)
+	},
+
+	// inNet reports whether an address (with or without port) belongs
+	// to an IP or to a network in CIDR notation.
+	"inNet": func(addr string, ipOrNet string) (bool, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return false, nil
+		}
+
+		if strings.Contains(ipOrNet, "/") {
+			_, ipnet, err := net.ParseCIDR(ipOrNet)
+			if err != nil {
+				return false, err
+			}
+			return ipnet.Contains(ip), nil
+		}
+
+		other := net.ParseIP(ipOrNet)
+		if other == nil {
+			return false, fmt.Errorf("invalid IP: %s", ipOrNet)
+		}
+		return ip.Equal(other), nil
+	},
+}
+
+func isTemplate(cmdstr string) bool {
+	return strings.Contains(cmdstr, "{{")
+}
+
+// CheckTemplate checks the syntax of a command that contains template actions.
+func CheckTemplate(cmdstr string) error {
+	if !isTemplate(cmdstr) {
+		return nil
+	}
+
+	_, err := template.New("cmd").Funcs(templateFuncs).Parse(cmdstr)
+	return err
+}
+
+// ExpandTemplate expands the template actions of a command with the given data.
+// Commands without template actions are returned unchanged.
+// An empty string means that the command must not be run.
+func ExpandTemplate(cmdstr string, data interface{}) (string, error) {
+	if !isTemplate(cmdstr) {
+		return cmdstr, nil
+	}
+
+	tmpl, err := template.New("cmd").Funcs(templateFuncs).Parse(cmdstr)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
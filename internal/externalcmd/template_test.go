@@ -0,0 +1,67 @@
+package externalcmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	data := struct {
+		Path       string
+		RemoteAddr string
+	}{
+		Path:       "cam1",
+		RemoteAddr: "192.168.1.10:5000",
+	}
+
+	for _, ca := range []struct {
+		name   string
+		cmdstr string
+		out    string
+	}{
+		{
+			"plain",
+			"ffmpeg -i rtsp://localhost:$RTSP_PORT/$RTSP_PATH",
+			"ffmpeg -i rtsp://localhost:$RTSP_PORT/$RTSP_PATH",
+		},
+		{
+			"field",
+			"echo {{.Path}}",
+			"echo cam1",
+		},
+		{
+			"match",
+			"{{if match \"^cam\" .Path}}echo yes{{end}}",
+			"echo yes",
+		},
+		{
+			"not match",
+			"{{if match \"^mic\" .Path}}echo yes{{end}}",
+			"",
+		},
+		{
+			"in net",
+			"{{if inNet .RemoteAddr \"192.168.0.0/16\"}}echo yes{{end}}",
+			"echo yes",
+		},
+		{
+			"in ip",
+			"{{if inNet .RemoteAddr \"192.168.1.11\"}}echo yes{{end}}",
+			"",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			out, err := ExpandTemplate(ca.cmdstr, data)
+			require.NoError(t, err)
+			require.Equal(t, ca.out, out)
+		})
+	}
+}
+
+func TestCheckTemplate(t *testing.T) {
+	require.NoError(t, CheckTemplate("echo $RTSP_PATH"))
+	require.NoError(t, CheckTemplate("{{if match \"a\" .Path}}echo{{end}}"))
+	require.Error(t, CheckTemplate("{{if .Path}}echo"))
+	require.Error(t, CheckTemplate("{{unknown .Path}}"))
+}
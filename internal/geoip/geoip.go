@@ -0,0 +1,415 @@
+// Package geoip contains a reader of MaxMind DB files (GeoLite2-Country, GeoIP2-City, etc.)
+// that is able to find the country of IPs.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+)
+
+// the metadata section starts after the last occurrence of this marker.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+const (
+	typeExtended = 0
+	typePointer  = 1
+	typeString   = 2
+	typeDouble   = 3
+	typeBytes    = 4
+	typeUint16   = 5
+	typeUint32   = 6
+	typeMap      = 7
+	typeInt32    = 8
+	typeUint64   = 9
+	typeUint128  = 10
+	typeArray    = 11
+	typeBool     = 14
+	typeFloat    = 15
+)
+
+// Database is a MaxMind DB file.
+type Database struct {
+	buf        []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	treeSize   uint
+	data       []byte
+	ipv4Start  uint
+}
+
+// Open opens a MaxMind DB file.
+// The file is read entirely into memory.
+func Open(fpath string) (*Database, error) {
+	buf, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(buf)
+}
+
+// New allocates a Database from the content of a MaxMind DB file.
+func New(buf []byte) (*Database, error) {
+	i := bytes.LastIndex(buf, metadataMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("invalid MaxMind DB file: metadata not found")
+	}
+
+	d := decoder{buf: buf[i+len(metadataMarker):]}
+	v, _, err := d.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %s", err)
+	}
+
+	meta, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid metadata: not a map")
+	}
+
+	getUint := func(key string) (uint, error) {
+		v, ok := meta[key].(uint64)
+		if !ok {
+			return 0, fmt.Errorf("invalid metadata: '%s' is missing", key)
+		}
+		return uint(v), nil
+	}
+
+	db := &Database{buf: buf}
+
+	db.nodeCount, err = getUint("node_count")
+	if err != nil {
+		return nil, err
+	}
+
+	db.recordSize, err = getUint("record_size")
+	if err != nil {
+		return nil, err
+	}
+
+	db.ipVersion, err = getUint("ip_version")
+	if err != nil {
+		return nil, err
+	}
+
+	switch db.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported record size: %d", db.recordSize)
+	}
+
+	if db.ipVersion != 4 && db.ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported IP version: %d", db.ipVersion)
+	}
+
+	db.treeSize = db.nodeCount * db.recordSize / 4
+
+	// the data section is separated from the search tree by 16 zero bytes
+	if db.treeSize+16 > uint(i) {
+		return nil, fmt.Errorf("invalid MaxMind DB file: search tree is too big")
+	}
+	db.data = buf[db.treeSize+16 : i]
+
+	// IPv4 addresses are stored into IPv6 trees as ::a.b.c.d
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for j := 0; j < 96 && node < db.nodeCount; j++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+
+	return db, nil
+}
+
+func (db *Database) record(node uint, bit uint) uint {
+	switch db.recordSize {
+	case 24:
+		off := node*6 + bit*3
+		b := db.buf[off : off+3]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+
+	case 28:
+		off := node * 7
+		b := db.buf[off : off+7]
+		if bit == 0 {
+			return uint(b[3]>>4)<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+
+	default: // 32
+		off := node*8 + bit*4
+		return uint(binary.BigEndian.Uint32(db.buf[off : off+4]))
+	}
+}
+
+// Lookup returns the record of an IP, or nil if the IP is not in the database.
+func (db *Database) Lookup(ip net.IP) (map[string]interface{}, error) {
+	node := uint(0)
+
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		if db.ipVersion == 6 {
+			node = db.ipv4Start
+		}
+	} else {
+		if db.ipVersion == 4 {
+			return nil, nil
+		}
+		ip = ip.To16()
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP")
+		}
+	}
+
+	for i := 0; i < len(ip)*8 && node < db.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-uint(i%8))) & 1
+		node = db.record(node, bit)
+	}
+
+	if node == db.nodeCount {
+		return nil, nil
+	}
+
+	if node < db.nodeCount {
+		return nil, fmt.Errorf("invalid search tree")
+	}
+
+	off := node - db.nodeCount - 16
+	if off >= uint(len(db.data)) {
+		return nil, fmt.Errorf("invalid search tree")
+	}
+
+	d := decoder{buf: db.data}
+	v, _, err := d.decode(off, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	rec, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid record: not a map")
+	}
+
+	return rec, nil
+}
+
+// Country returns the ISO 3166-1 code of the country of an IP,
+// or an empty string if the IP is not in the database.
+// When the country is not available, the registered country is used.
+func (db *Database) Country(ip net.IP) (string, error) {
+	rec, err := db.Lookup(ip)
+	if err != nil || rec == nil {
+		return "", err
+	}
+
+	for _, key := range []string{"country", "registered_country"} {
+		if c, ok := rec[key].(map[string]interface{}); ok {
+			if code, ok := c["iso_code"].(string); ok {
+				return code, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// nested pointers and containers are limited in order to avoid loops.
+const maxDepth = 32
+
+type decoder struct {
+	buf []byte
+}
+
+func (d decoder) bytes(off uint, n uint) ([]byte, error) {
+	if off+n > uint(len(d.buf)) || off+n < off {
+		return nil, fmt.Errorf("unexpected end of data")
+	}
+	return d.buf[off : off+n], nil
+}
+
+func (d decoder) uint(off uint, n uint) (uint64, error) {
+	if n > 8 {
+		return 0, fmt.Errorf("invalid integer size: %d", n)
+	}
+
+	b, err := d.bytes(off, n)
+	if err != nil {
+		return 0, err
+	}
+
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+// decode decodes the field at the given offset.
+// It returns the value and the offset of the next field.
+func (d decoder) decode(off uint, depth int) (interface{}, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, fmt.Errorf("maximum depth exceeded")
+	}
+
+	b, err := d.bytes(off, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	ctrl := b[0]
+	off++
+
+	typ := uint(ctrl >> 5)
+
+	if typ == typePointer {
+		ss := uint(ctrl>>3) & 0x03
+		v, err := d.uint(off, ss+1)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var ptr uint
+		switch ss {
+		case 0:
+			ptr = uint(ctrl&0x07)<<8 | uint(v)
+		case 1:
+			ptr = (uint(ctrl&0x07)<<16 | uint(v)) + 2048
+		case 2:
+			ptr = (uint(ctrl&0x07)<<24 | uint(v)) + 526336
+		default:
+			ptr = uint(v)
+		}
+
+		val, _, err := d.decode(ptr, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		return val, off + ss + 1, nil
+	}
+
+	if typ == typeExtended {
+		b, err := d.bytes(off, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		typ = 7 + uint(b[0])
+		off++
+	}
+
+	size := uint(ctrl & 0x1F)
+	if size >= 29 {
+		n := size - 28
+		v, err := d.uint(off, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		off += n
+
+		switch n {
+		case 1:
+			size = 29 + uint(v)
+		case 2:
+			size = 285 + uint(v)
+		default:
+			size = 65821 + uint(v)
+		}
+	}
+
+	switch typ {
+	case typeString:
+		b, err := d.bytes(off, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return string(b), off + size, nil
+
+	case typeBytes:
+		b, err := d.bytes(off, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return b, off + size, nil
+
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size: %d", size)
+		}
+		v, err := d.uint(off, 8)
+		if err != nil {
+			return nil, 0, err
+		}
+		return math.Float64frombits(v), off + 8, nil
+
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size: %d", size)
+		}
+		v, err := d.uint(off, 4)
+		if err != nil {
+			return nil, 0, err
+		}
+		return float64(math.Float32frombits(uint32(v))), off + 4, nil
+
+	case typeUint16, typeUint32, typeUint64:
+		v, err := d.uint(off, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return v, off + size, nil
+
+	case typeInt32:
+		v, err := d.uint(off, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return int64(int32(uint32(v))), off + size, nil
+
+	case typeUint128:
+		b, err := d.bytes(off, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return b, off + size, nil
+
+	case typeBool:
+		return size != 0, off, nil
+
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			var k interface{}
+			k, off, err = d.decode(off, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			ks, ok := k.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("invalid map key")
+			}
+
+			m[ks], off, err = d.decode(off, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return m, off, nil
+
+	case typeArray:
+		a := make([]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			a[i], off, err = d.decode(off, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return a, off, nil
+
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type: %d", typ)
+	}
+}
@@ -0,0 +1,211 @@
+package geoip
+
+import (
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func encodeCtrl(typ byte, size int) []byte {
+	var ret []byte
+	if typ > 7 {
+		ret = []byte{0, typ - 7}
+	} else {
+		ret = []byte{typ << 5}
+	}
+
+	switch {
+	case size < 29:
+		ret[0] |= byte(size)
+	case size < 285:
+		ret[0] |= 29
+		ret = append(ret, byte(size-29))
+	default:
+		ret[0] |= 30
+		ret = append(ret, byte((size-285)>>8), byte(size-285))
+	}
+	return ret
+}
+
+func encode(v interface{}) []byte {
+	switch tv := v.(type) {
+	case string:
+		return append(encodeCtrl(typeString, len(tv)), tv...)
+
+	case uint64:
+		var b []byte
+		for x := tv; x != 0; x >>= 8 {
+			b = append([]byte{byte(x)}, b...)
+		}
+		return append(encodeCtrl(typeUint32, len(b)), b...)
+
+	case map[string]interface{}:
+		var keys []string
+		for k := range tv {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		ret := encodeCtrl(typeMap, len(tv))
+		for _, k := range keys {
+			ret = append(ret, encode(k)...)
+			ret = append(ret, encode(tv[k])...)
+		}
+		return ret
+
+	case []byte: // pre-encoded field
+		return tv
+	}
+
+	panic("unsupported")
+}
+
+type testNode struct {
+	children [2]*testNode
+	data     int // -1 when the node is not a leaf
+}
+
+// writeDatabase writes a database with an IPv6 tree and 24-bit records.
+func writeDatabase(networks map[string][]byte) []byte {
+	root := &testNode{data: -1}
+
+	var data []byte
+	var names []string
+	for n := range networks {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		_, ipnet, err := net.ParseCIDR(n)
+		if err != nil {
+			panic(err)
+		}
+
+		ones, bits := ipnet.Mask.Size()
+		// IPv4 networks are stored as ::a.b.c.d
+		ip := ipnet.IP.To16()
+		offset := 0
+		if bits == 32 {
+			offset = 96
+			ones += 96
+		}
+
+		node := root
+		for i := 0; i < ones; i++ {
+			bit := 0
+			if i >= offset {
+				bit = int(ip[i/8]>>(7-uint(i%8))) & 1
+			}
+
+			if node.children[bit] == nil {
+				node.children[bit] = &testNode{data: -1}
+			}
+			node = node.children[bit]
+		}
+
+		node.data = len(data)
+		data = append(data, networks[n]...)
+	}
+
+	// number nodes
+	var nodes []*testNode
+	ids := make(map[*testNode]int)
+	var visit func(n *testNode)
+	visit = func(n *testNode) {
+		if n == nil || n.data >= 0 {
+			return
+		}
+		ids[n] = len(nodes)
+		nodes = append(nodes, n)
+		visit(n.children[0])
+		visit(n.children[1])
+	}
+	visit(root)
+
+	var buf []byte
+	for _, n := range nodes {
+		for _, c := range n.children {
+			var v int
+			switch {
+			case c == nil:
+				v = len(nodes)
+			case c.data >= 0:
+				v = len(nodes) + 16 + c.data
+			default:
+				v = ids[c]
+			}
+			buf = append(buf, byte(v>>16), byte(v>>8), byte(v))
+		}
+	}
+
+	buf = append(buf, make([]byte, 16)...)
+	buf = append(buf, data...)
+	buf = append(buf, metadataMarker...)
+	buf = append(buf, encode(map[string]interface{}{
+		"node_count":    uint64(len(nodes)),
+		"record_size":   uint64(24),
+		"ip_version":    uint64(6),
+		"database_type": "Test-Country",
+	})...)
+
+	return buf
+}
+
+func TestCountry(t *testing.T) {
+	it := encode(map[string]interface{}{
+		"country": map[string]interface{}{
+			"iso_code":   "IT",
+			"geoname_id": uint64(3175395),
+		},
+	})
+
+	// a record that points to the country of the first one
+	// (the data of 10.0.0.0/8 comes first, since networks are sorted,
+	// and its country is after the map header and the key)
+	ptr := append(encode("country"), 0x20, 0x09)
+	ptrRecord := append(encodeCtrl(typeMap, 1), ptr...)
+
+	buf := writeDatabase(map[string][]byte{
+		"10.0.0.0/8":     it,
+		"192.168.0.0/16": encode(map[string]interface{}{"registered_country": map[string]interface{}{"iso_code": "US"}}),
+		"2001:db8::/32":  encode(map[string]interface{}{"country": map[string]interface{}{"iso_code": "DE"}}),
+		"172.16.0.0/12":  ptrRecord,
+	})
+
+	db, err := New(buf)
+	require.NoError(t, err)
+
+	for _, ca := range []struct {
+		ip      string
+		country string
+	}{
+		{"10.1.2.3", "IT"},
+		{"172.16.1.1", "IT"},
+		{"192.168.1.1", "US"},
+		{"2001:db8::1", "DE"},
+		{"127.0.0.1", ""},
+		{"2001:db9::1", ""},
+	} {
+		t.Run(ca.ip, func(t *testing.T) {
+			c, err := db.Country(net.ParseIP(ca.ip))
+			require.NoError(t, err)
+			require.Equal(t, ca.country, c)
+		})
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	_, err := New([]byte("asd"))
+	require.EqualError(t, err, "invalid MaxMind DB file: metadata not found")
+
+	buf := append(append([]byte{}, metadataMarker...), encode(map[string]interface{}{
+		"node_count":  uint64(1),
+		"record_size": uint64(20),
+		"ip_version":  uint64(6),
+	})...)
+	_, err = New(buf)
+	require.EqualError(t, err, "unsupported record size: 20")
+}
@@ -0,0 +1,493 @@
+// Package h264sps contains a H264 sequence parameter set parser.
+package h264sps
+
+import (
+	"fmt"
+
+	"github.com/aler9/gortsplib/pkg/h264"
+)
+
+type bitReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *bitReader) readBit() (uint32, error) {
+	if r.pos >= len(r.buf)*8 {
+		return 0, fmt.Errorf("not enough bits")
+	}
+
+	v := (r.buf[r.pos/8] >> (7 - uint(r.pos%8))) & 0x01
+	r.pos++
+	return uint32(v), nil
+}
+
+func (r *bitReader) readBits(n int) (uint32, error) {
+	var v uint32
+	for i := 0; i < n; i++ {
+		b, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v = (v << 1) | b
+	}
+	return v, nil
+}
+
+func (r *bitReader) readFlag() (bool, error) {
+	b, err := r.readBit()
+	return b == 1, err
+}
+
+// readUE reads an unsigned Exp-Golomb code.
+func (r *bitReader) readUE() (uint32, error) {
+	leadingZeros := 0
+	for {
+		b, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if b != 0 {
+			break
+		}
+
+		leadingZeros++
+		if leadingZeros > 31 {
+			return 0, fmt.Errorf("invalid Exp-Golomb code")
+		}
+	}
+
+	v, err := r.readBits(leadingZeros)
+	if err != nil {
+		return 0, err
+	}
+
+	return (1 << uint(leadingZeros)) - 1 + v, nil
+}
+
+// readSE reads a signed Exp-Golomb code.
+func (r *bitReader) readSE() (int32, error) {
+	v, err := r.readUE()
+	if err != nil {
+		return 0, err
+	}
+
+	if (v & 0x01) != 0 {
+		return int32((v + 1) / 2), nil
+	}
+	return -int32(v / 2), nil
+}
+
+func (r *bitReader) skipScalingList(size int) error {
+	lastScale := int32(8)
+	nextScale := int32(8)
+
+	for j := 0; j < size; j++ {
+		if nextScale != 0 {
+			delta, err := r.readSE()
+			if err != nil {
+				return err
+			}
+			nextScale = (lastScale + delta + 256) % 256
+		}
+		if nextScale != 0 {
+			lastScale = nextScale
+		}
+	}
+
+	return nil
+}
+
+// SPS is a H264 sequence parameter set.
+type SPS struct {
+	ProfileIdc uint8
+	LevelIdc   uint8
+	Width      int
+	Height     int
+
+	// frame rate declared in the VUI timing info, or zero if not available.
+	FPS float64
+}
+
+// Decode decodes a SPS NALU.
+func (s *SPS) Decode(byts []byte) error {
+	if len(byts) < 4 {
+		return fmt.Errorf("SPS is too short")
+	}
+
+	if h264.NALUType(byts[0]&0x1F) != h264.NALUTypeSPS {
+		return fmt.Errorf("not a SPS")
+	}
+
+	r := &bitReader{buf: h264.AntiCompetitionRemove(byts[1:])}
+
+	err := s.decode(r)
+	if err != nil {
+		return fmt.Errorf("invalid SPS: %s", err)
+	}
+
+	return nil
+}
+
+func (s *SPS) decode(r *bitReader) error {
+	v, err := r.readBits(8)
+	if err != nil {
+		return err
+	}
+	s.ProfileIdc = uint8(v)
+
+	// constraint flags and reserved bits
+	_, err = r.readBits(8)
+	if err != nil {
+		return err
+	}
+
+	v, err = r.readBits(8)
+	if err != nil {
+		return err
+	}
+	s.LevelIdc = uint8(v)
+
+	// seq_parameter_set_id
+	_, err = r.readUE()
+	if err != nil {
+		return err
+	}
+
+	chromaFormatIdc := uint32(1)
+	separateColourPlane := false
+
+	switch s.ProfileIdc {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		chromaFormatIdc, err = r.readUE()
+		if err != nil {
+			return err
+		}
+
+		if chromaFormatIdc == 3 {
+			separateColourPlane, err = r.readFlag()
+			if err != nil {
+				return err
+			}
+		}
+
+		// bit_depth_luma_minus8, bit_depth_chroma_minus8
+		for i := 0; i < 2; i++ {
+			_, err = r.readUE()
+			if err != nil {
+				return err
+			}
+		}
+
+		// qpprime_y_zero_transform_bypass_flag
+		_, err = r.readFlag()
+		if err != nil {
+			return err
+		}
+
+		scalingMatrixPresent, err := r.readFlag()
+		if err != nil {
+			return err
+		}
+
+		if scalingMatrixPresent {
+			count := 8
+			if chromaFormatIdc == 3 {
+				count = 12
+			}
+
+			for i := 0; i < count; i++ {
+				present, err := r.readFlag()
+				if err != nil {
+					return err
+				}
+
+				if present {
+					size := 16
+					if i >= 6 {
+						size = 64
+					}
+
+					err = r.skipScalingList(size)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	// log2_max_frame_num_minus4
+	_, err = r.readUE()
+	if err != nil {
+		return err
+	}
+
+	picOrderCntType, err := r.readUE()
+	if err != nil {
+		return err
+	}
+
+	switch picOrderCntType {
+	case 0:
+		// log2_max_pic_order_cnt_lsb_minus4
+		_, err = r.readUE()
+		if err != nil {
+			return err
+		}
+
+	case 1:
+		// delta_pic_order_always_zero_flag
+		_, err = r.readFlag()
+		if err != nil {
+			return err
+		}
+
+		// offset_for_non_ref_pic, offset_for_top_to_bottom_field
+		for i := 0; i < 2; i++ {
+			_, err = r.readSE()
+			if err != nil {
+				return err
+			}
+		}
+
+		numRefFramesInPicOrderCntCycle, err := r.readUE()
+		if err != nil {
+			return err
+		}
+
+		for i := uint32(0); i < numRefFramesInPicOrderCntCycle; i++ {
+			_, err = r.readSE()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// max_num_ref_frames
+	_, err = r.readUE()
+	if err != nil {
+		return err
+	}
+
+	// gaps_in_frame_num_value_allowed_flag
+	_, err = r.readFlag()
+	if err != nil {
+		return err
+	}
+
+	picWidthInMbsMinus1, err := r.readUE()
+	if err != nil {
+		return err
+	}
+
+	picHeightInMapUnitsMinus1, err := r.readUE()
+	if err != nil {
+		return err
+	}
+
+	frameMbsOnly, err := r.readFlag()
+	if err != nil {
+		return err
+	}
+
+	if !frameMbsOnly {
+		// mb_adaptive_frame_field_flag
+		_, err = r.readFlag()
+		if err != nil {
+			return err
+		}
+	}
+
+	// direct_8x8_inference_flag
+	_, err = r.readFlag()
+	if err != nil {
+		return err
+	}
+
+	frameCropping, err := r.readFlag()
+	if err != nil {
+		return err
+	}
+
+	var cropLeft, cropRight, cropTop, cropBottom uint32
+	if frameCropping {
+		cropLeft, err = r.readUE()
+		if err != nil {
+			return err
+		}
+
+		cropRight, err = r.readUE()
+		if err != nil {
+			return err
+		}
+
+		cropTop, err = r.readUE()
+		if err != nil {
+			return err
+		}
+
+		cropBottom, err = r.readUE()
+		if err != nil {
+			return err
+		}
+	}
+
+	frameHeightFactor := 2
+	if frameMbsOnly {
+		frameHeightFactor = 1
+	}
+
+	cropUnitX := 1
+	cropUnitY := frameHeightFactor
+	if chromaFormatIdc != 0 && !separateColourPlane {
+		subWidthC := 2
+		subHeightC := 2
+		switch chromaFormatIdc {
+		case 2:
+			subHeightC = 1
+		case 3:
+			subWidthC = 1
+			subHeightC = 1
+		}
+		cropUnitX = subWidthC
+		cropUnitY = subHeightC * frameHeightFactor
+	}
+
+	s.Width = int(picWidthInMbsMinus1+1)*16 - cropUnitX*int(cropLeft+cropRight)
+	s.Height = frameHeightFactor*int(picHeightInMapUnitsMinus1+1)*16 - cropUnitY*int(cropTop+cropBottom)
+
+	vuiPresent, err := r.readFlag()
+	if err != nil {
+		return err
+	}
+
+	if vuiPresent {
+		// the VUI is optional, therefore errors are not fatal
+		s.decodeVUI(r)
+	}
+
+	return nil
+}
+
+func (s *SPS) decodeVUI(r *bitReader) error {
+	aspectRatioInfoPresent, err := r.readFlag()
+	if err != nil {
+		return err
+	}
+
+	if aspectRatioInfoPresent {
+		aspectRatioIdc, err := r.readBits(8)
+		if err != nil {
+			return err
+		}
+
+		// extended SAR
+		if aspectRatioIdc == 255 {
+			_, err = r.readBits(32)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	overscanInfoPresent, err := r.readFlag()
+	if err != nil {
+		return err
+	}
+
+	if overscanInfoPresent {
+		_, err = r.readFlag()
+		if err != nil {
+			return err
+		}
+	}
+
+	videoSignalTypePresent, err := r.readFlag()
+	if err != nil {
+		return err
+	}
+
+	if videoSignalTypePresent {
+		// video_format, video_full_range_flag
+		_, err = r.readBits(4)
+		if err != nil {
+			return err
+		}
+
+		colourDescriptionPresent, err := r.readFlag()
+		if err != nil {
+			return err
+		}
+
+		if colourDescriptionPresent {
+			_, err = r.readBits(24)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	chromaLocInfoPresent, err := r.readFlag()
+	if err != nil {
+		return err
+	}
+
+	if chromaLocInfoPresent {
+		for i := 0; i < 2; i++ {
+			_, err = r.readUE()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	timingInfoPresent, err := r.readFlag()
+	if err != nil {
+		return err
+	}
+
+	if timingInfoPresent {
+		numUnitsInTick, err := r.readBits(32)
+		if err != nil {
+			return err
+		}
+
+		timeScale, err := r.readBits(32)
+		if err != nil {
+			return err
+		}
+
+		if numUnitsInTick != 0 {
+			s.FPS = float64(timeScale) / float64(2*numUnitsInTick)
+		}
+	}
+
+	return nil
+}
+
+// ProfileName returns the name of the profile.
+func (s SPS) ProfileName() string {
+	switch s.ProfileIdc {
+	case 66:
+		return "Baseline"
+	case 77:
+		return "Main"
+	case 88:
+		return "Extended"
+	case 100:
+		return "High"
+	case 110:
+		return "High 10"
+	case 122:
+		return "High 4:2:2"
+	case 244:
+		return "High 4:4:4 Predictive"
+	}
+	return fmt.Sprintf("unknown (%d)", s.ProfileIdc)
+}
+
+// Level returns the level, as a string.
+func (s SPS) Level() string {
+	return fmt.Sprintf("%d.%d", s.LevelIdc/10, s.LevelIdc%10)
+}
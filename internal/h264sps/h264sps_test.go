@@ -0,0 +1,89 @@
+package h264sps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		byts []byte
+		sps  SPS
+	}{
+		{
+			"352x288",
+			[]byte{
+				0x67, 0x64, 0x00, 0x0c, 0xac, 0x3b, 0x50, 0xb0,
+				0x4b, 0x42, 0x00, 0x00, 0x03, 0x00, 0x02, 0x00,
+				0x00, 0x03, 0x00, 0x3d, 0x08,
+			},
+			SPS{
+				ProfileIdc: 100,
+				LevelIdc:   12,
+				Width:      352,
+				Height:     288,
+				FPS:        15,
+			},
+		},
+		{
+			"1280x720",
+			[]byte{
+				0x67, 0x64, 0x00, 0x1f, 0xac, 0xd9, 0x40, 0x50,
+				0x05, 0xbb, 0x01, 0x6c, 0x80, 0x00, 0x00, 0x03,
+				0x00, 0x80, 0x00, 0x00, 0x1e, 0x07, 0x8c, 0x18,
+				0xcb,
+			},
+			SPS{
+				ProfileIdc: 100,
+				LevelIdc:   31,
+				Width:      1280,
+				Height:     720,
+				FPS:        30,
+			},
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			var sps SPS
+			err := sps.Decode(ca.byts)
+			require.NoError(t, err)
+			require.Equal(t, ca.sps, sps)
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		byts []byte
+		err  string
+	}{
+		{
+			"too short",
+			[]byte{0x67, 0x64},
+			"SPS is too short",
+		},
+		{
+			"not a SPS",
+			[]byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0},
+			"not a SPS",
+		},
+		{
+			"truncated",
+			[]byte{0x67, 0x64, 0x00, 0x1f, 0xac},
+			"invalid SPS: not enough bits",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			var sps SPS
+			err := sps.Decode(ca.byts)
+			require.EqualError(t, err, ca.err)
+		})
+	}
+}
+
+func TestProfileName(t *testing.T) {
+	require.Equal(t, "High", SPS{ProfileIdc: 100}.ProfileName())
+	require.Equal(t, "3.1", SPS{LevelIdc: 31}.Level())
+}
@@ -0,0 +1,150 @@
+// Package healthcheck contains the healthcheck subcommand, that checks
+// whether a local instance of the server is working.
+package healthcheck
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+)
+
+// Main handles the "healthcheck" subcommand and returns the exit code.
+func Main(args []string) int {
+	k := kingpin.New("rtsp-simple-server healthcheck",
+		"Check whether the local server is working. Exits with code 0 if the server is healthy, 1 otherwise.")
+
+	argConfPath := k.Arg("confpath", "path to the config file of the server.").
+		Default("rtsp-simple-server.yml").String()
+	argTimeout := k.Flag("timeout", "timeout of the check.").
+		Default("5s").Duration()
+
+	kingpin.MustParse(k.Parse(args))
+
+	cnf, _, err := conf.Load(*argConfPath)
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return 1
+	}
+
+	err = Check(cnf, *argTimeout)
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// Check checks whether the server that uses the given configuration is working.
+// The API is used if enabled, otherwise the RTSP or HLS listener is queried.
+func Check(cnf *conf.Conf, timeout time.Duration) error {
+	switch {
+	case cnf.API:
+		return checkAPI(localAddress(cnf.APIAddress), timeout)
+
+	case !cnf.RTSPDisable && cnf.Encryption != conf.EncryptionStrict:
+		return checkRTSP(localAddress(cnf.RTSPAddress), timeout)
+
+	case !cnf.HLSDisable:
+		return checkHLS(localAddress(cnf.HLSAddress), timeout)
+	}
+
+	return fmt.Errorf("the API, RTSP and HLS listeners are disabled, there's nothing to check")
+}
+
+// localAddress converts a listen address into an address that can be dialed.
+func localAddress(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+
+	return net.JoinHostPort(host, port)
+}
+
+// newHTTPClient returns a client and a base URL that can be used to query
+// a HTTP listener, that can be bound to a TCP address or to a Unix socket.
+func newHTTPClient(address string, timeout time.Duration) (*http.Client, string) {
+	pa, ok := conf.UnixSocketPath(address)
+	if !ok {
+		return &http.Client{Timeout: timeout}, "http://" + address
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", pa)
+			},
+		},
+	}, "http://localhost"
+}
+
+func checkAPI(address string, timeout time.Duration) error {
+	c, baseURL := newHTTPClient(address, timeout)
+
+	res, err := c.Get(baseURL + "/v1/paths/list")
+	if err != nil {
+		return fmt.Errorf("API: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("API: bad status code: %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+func checkRTSP(address string, timeout time.Duration) error {
+	nconn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return fmt.Errorf("RTSP: %s", err)
+	}
+	defer nconn.Close()
+
+	nconn.SetDeadline(time.Now().Add(timeout))
+
+	_, err = nconn.Write([]byte("OPTIONS rtsp://" + address + "/ RTSP/1.0\r\n" +
+		"CSeq: 1\r\n" +
+		"\r\n"))
+	if err != nil {
+		return fmt.Errorf("RTSP: %s", err)
+	}
+
+	line, err := bufio.NewReader(nconn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("RTSP: %s", err)
+	}
+
+	if !strings.HasPrefix(line, "RTSP/1.0 200") {
+		return fmt.Errorf("RTSP: unexpected response: %s", strings.TrimSpace(line))
+	}
+
+	return nil
+}
+
+func checkHLS(address string, timeout time.Duration) error {
+	c, baseURL := newHTTPClient(address, timeout)
+
+	// any response means that the server is able to handle requests
+	res, err := c.Get(baseURL + "/")
+	if err != nil {
+		return fmt.Errorf("HLS: %s", err)
+	}
+	res.Body.Close()
+
+	return nil
+}
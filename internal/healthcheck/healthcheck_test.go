@@ -0,0 +1,102 @@
+package healthcheck
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aler9/rtsp-simple-server/internal/conf"
+)
+
+func TestLocalAddress(t *testing.T) {
+	require.Equal(t, "127.0.0.1:8554", localAddress(":8554"))
+	require.Equal(t, "127.0.0.1:8554", localAddress("0.0.0.0:8554"))
+	require.Equal(t, "192.168.1.1:8554", localAddress("192.168.1.1:8554"))
+}
+
+func TestCheckAPI(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/paths/list", r.URL.Path)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	cnf := &conf.Conf{
+		API:        true,
+		APIAddress: strings.TrimPrefix(srv.URL, "http://"),
+	}
+
+	err := Check(cnf, time.Second)
+	require.NoError(t, err)
+
+	status = http.StatusInternalServerError
+	err = Check(cnf, time.Second)
+	require.EqualError(t, err, "API: bad status code: 500")
+}
+
+func TestCheckAPIUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtsp-healthcheck")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pa := filepath.Join(dir, "api.sock")
+
+	ln, err := net.Listen("unix", pa)
+	require.NoError(t, err)
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/paths/list", r.URL.Path)
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	err = Check(&conf.Conf{API: true, APIAddress: "unix:" + pa}, time.Second)
+	require.NoError(t, err)
+}
+
+func TestCheckRTSP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	go func() {
+		nconn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer nconn.Close()
+
+		br := bufio.NewReader(nconn)
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil || line == "\r\n" {
+				break
+			}
+		}
+
+		nconn.Write([]byte("RTSP/1.0 200 OK\r\nCSeq: 1\r\n\r\n"))
+	}()
+
+	err = Check(&conf.Conf{RTSPAddress: ln.Addr().String(), HLSDisable: true}, time.Second)
+	require.NoError(t, err)
+
+	ln.Close()
+
+	err = Check(&conf.Conf{RTSPAddress: ln.Addr().String(), HLSDisable: true}, time.Second)
+	require.Error(t, err)
+}
+
+func TestCheckNothing(t *testing.T) {
+	err := Check(&conf.Conf{RTSPDisable: true, HLSDisable: true}, time.Second)
+	require.EqualError(t, err, "the API, RTSP and HLS listeners are disabled, there's nothing to check")
+}
@@ -2,24 +2,50 @@ package hls
 
 import (
 	"io"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aler9/gortsplib"
 )
 
+const (
+	audioSegmentNamePrefix = "audio_"
+)
+
 // Muxer is a HLS muxer.
 type Muxer struct {
+	output          muxerOutput
 	primaryPlaylist *muxerPrimaryPlaylist
 	streamPlaylist  *muxerStreamPlaylist
 	tsGenerator     *muxerTSGenerator
+
+	// audio-only rendition
+	audioPlaylist    *muxerStreamPlaylist
+	audioTSGenerator *muxerTSGenerator
+
+	mutex sync.Mutex
+	ended bool
 }
 
 // NewMuxer allocates a Muxer.
+// If dirPath is filled, playlists and segments are written into a directory.
+// If pushURL is filled, playlists and segments are uploaded with HTTP PUT requests
+// to the given URL, and errors are passed to onPushError.
+// onSegment, if not nil, is called with the duration of every segment
+// that is added to the stream playlist.
 func NewMuxer(
 	hlsSegmentCount int,
 	hlsSegmentDuration time.Duration,
+	hlsEncryption bool,
+	hlsEncryptionKeyRotation time.Duration,
+	dirPath string,
+	pushURL string,
+	onPushError func(error),
+	audioOnlyRendition bool,
 	videoTrack *gortsplib.Track,
-	audioTrack *gortsplib.Track) (*Muxer, error) {
+	audioTrack *gortsplib.Track,
+	onSegment func(time.Duration)) (*Muxer, error) {
 	var h264Conf *gortsplib.TrackConfigH264
 	if videoTrack != nil {
 		var err error
@@ -38,9 +64,49 @@ func NewMuxer(
 		}
 	}
 
-	primaryPlaylist := newMuxerPrimaryPlaylist(videoTrack, audioTrack, h264Conf)
+	// the audio-only rendition makes sense only when there's also a video track
+	audioOnlyRendition = audioOnlyRendition && videoTrack != nil && audioTrack != nil
+
+	primaryPlaylist := newMuxerPrimaryPlaylist(videoTrack, audioTrack, h264Conf, audioOnlyRendition)
+
+	var outputs muxerOutputs
+
+	if dirPath != "" {
+		dir, err := newMuxerDir(dirPath)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, dir)
+	}
+
+	if pushURL != "" {
+		push, err := newMuxerPush(pushURL, onPushError)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, push)
+	}
+
+	// a nil interface is used when there are no outputs
+	var output muxerOutput
+	switch len(outputs) {
+	case 0:
+	case 1:
+		output = outputs[0]
+	default:
+		output = outputs
+	}
+
+	if output != nil {
+		err := output.writeFile("index.m3u8", primaryPlaylist.cnt)
+		if err != nil {
+			output.close()
+			return nil, err
+		}
+	}
 
-	streamPlaylist := newMuxerStreamPlaylist(hlsSegmentCount)
+	streamPlaylist := newMuxerStreamPlaylist("stream.m3u8", hlsSegmentCount,
+		hlsEncryption, hlsEncryptionKeyRotation, output, onSegment)
 
 	tsGenerator := newMuxerTSGenerator(
 		hlsSegmentCount,
@@ -49,30 +115,111 @@ func NewMuxer(
 		audioTrack,
 		h264Conf,
 		aacConf,
-		streamPlaylist)
+		streamPlaylist,
+		"")
 
 	m := &Muxer{
+		output:          output,
 		primaryPlaylist: primaryPlaylist,
 		streamPlaylist:  streamPlaylist,
 		tsGenerator:     tsGenerator,
 	}
 
+	if audioOnlyRendition {
+		m.audioPlaylist = newMuxerStreamPlaylist("audio.m3u8", hlsSegmentCount,
+			hlsEncryption, hlsEncryptionKeyRotation, output, nil)
+
+		m.audioTSGenerator = newMuxerTSGenerator(
+			hlsSegmentCount,
+			hlsSegmentDuration,
+			nil,
+			audioTrack,
+			nil,
+			aacConf,
+			m.audioPlaylist,
+			audioSegmentNamePrefix)
+	}
+
 	return m, nil
 }
 
 // Close closes a Muxer.
 func (m *Muxer) Close() {
 	m.streamPlaylist.close()
+
+	if m.audioPlaylist != nil {
+		m.audioPlaylist.close()
+	}
+
+	if m.output != nil {
+		m.output.removeFile("index.m3u8")
+		m.output.close()
+	}
+}
+
+// End writes the segment that is being generated, even if it's shorter than
+// the segment duration, and adds an end marker to playlists, in order to notify
+// clients that the stream is ending. Data written after End is discarded.
+func (m *Muxer) End() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.ended {
+		return nil
+	}
+	m.ended = true
+
+	err := m.tsGenerator.flush()
+
+	if m.audioTSGenerator != nil {
+		err2 := m.audioTSGenerator.flush()
+		if err == nil {
+			err = err2
+		}
+	}
+
+	m.streamPlaylist.end()
+
+	if m.audioPlaylist != nil {
+		m.audioPlaylist.end()
+	}
+
+	return err
 }
 
 // WriteH264 writes H264 NALUs, grouped by PTS, into the muxer.
-func (m *Muxer) WriteH264(pts time.Duration, nalus [][]byte) error {
-	return m.tsGenerator.writeH264(pts, nalus)
+// ntp is the absolute time of the NALUs, that is used to fill EXT-X-PROGRAM-DATE-TIME.
+func (m *Muxer) WriteH264(ntp time.Time, pts time.Duration, nalus [][]byte) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.ended {
+		return nil
+	}
+
+	return m.tsGenerator.writeH264(ntp, pts, nalus)
 }
 
 // WriteAAC writes AAC AUs, grouped by PTS, into the muxer.
-func (m *Muxer) WriteAAC(pts time.Duration, aus [][]byte) error {
-	return m.tsGenerator.writeAAC(pts, aus)
+// ntp is the absolute time of the first AU, that is used to fill EXT-X-PROGRAM-DATE-TIME.
+func (m *Muxer) WriteAAC(ntp time.Time, pts time.Duration, aus [][]byte) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.ended {
+		return nil
+	}
+
+	err := m.tsGenerator.writeAAC(ntp, pts, aus)
+	if err != nil {
+		return err
+	}
+
+	if m.audioTSGenerator != nil {
+		return m.audioTSGenerator.writeAAC(ntp, pts, aus)
+	}
+
+	return nil
 }
 
 // PrimaryPlaylist returns a reader to read the primary playlist.
@@ -85,7 +232,37 @@ func (m *Muxer) StreamPlaylist() io.Reader {
 	return m.streamPlaylist.reader()
 }
 
-// Segment returns a reader to read a segment listed in the stream playlist.
-func (m *Muxer) Segment(fname string) io.Reader {
+// AudioPlaylist returns a reader to read the playlist of the audio-only rendition,
+// or nil if the rendition is not available.
+func (m *Muxer) AudioPlaylist() io.Reader {
+	if m.audioPlaylist == nil {
+		return nil
+	}
+	return m.audioPlaylist.reader()
+}
+
+// Segment returns a reader to read a segment listed in the stream playlist
+// or in the audio-only playlist.
+func (m *Muxer) Segment(fname string) *MuxerFile {
+	if strings.HasPrefix(fname, audioSegmentNamePrefix) {
+		if m.audioPlaylist == nil {
+			return nil
+		}
+		return m.audioPlaylist.segment(fname)
+	}
+
 	return m.streamPlaylist.segment(fname)
 }
+
+// Key returns a reader to read a key used to encrypt segments.
+func (m *Muxer) Key(fname string) io.Reader {
+	if r := m.streamPlaylist.key(fname); r != nil {
+		return r
+	}
+
+	if m.audioPlaylist != nil {
+		return m.audioPlaylist.key(fname)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package hls
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// muxerDir is a directory where playlists and segments are written,
+// in order to allow external HTTP servers to serve them.
+type muxerDir struct {
+	path string
+}
+
+func newMuxerDir(path string) (*muxerDir, error) {
+	err := os.MkdirAll(path, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &muxerDir{
+		path: path,
+	}, nil
+}
+
+// writeFile writes a file atomically, in order to prevent external servers
+// from serving partially-written files.
+func (d *muxerDir) writeFile(name string, byts []byte) error {
+	fpath := filepath.Join(d.path, name)
+
+	tmpPath := fpath + ".tmp"
+	err := ioutil.WriteFile(tmpPath, byts, 0o644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, fpath)
+}
+
+func (d *muxerDir) removeFile(name string) {
+	os.Remove(filepath.Join(d.path, name))
+}
+
+func (d *muxerDir) close() {
+}
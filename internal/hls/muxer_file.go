@@ -0,0 +1,24 @@
+package hls
+
+import (
+	"hash/fnv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// MuxerFile is a file that doesn't change once it has been generated.
+// It can be read partially, and its modification time and entity tag
+// allow to answer conditional requests.
+type MuxerFile struct {
+	io.ReadSeeker
+	ModTime time.Time
+	ETag    string
+}
+
+// fileETag returns a strong entity tag of a file, based on its content.
+func fileETag(byts []byte) string {
+	h := fnv.New64a()
+	h.Write(byts)
+	return `"` + strconv.FormatUint(h.Sum64(), 16) + "-" + strconv.FormatInt(int64(len(byts)), 16) + `"`
+}
@@ -0,0 +1,58 @@
+package hls
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// muxerKey is an AES-128 key used to encrypt segments.
+type muxerKey struct {
+	name    string
+	key     []byte
+	created time.Time
+}
+
+func newMuxerKey() (*muxerKey, error) {
+	key := make([]byte, 16)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// the name is random, in order not to allow clients to guess
+	// the URL of keys that have not been listed yet.
+	name := make([]byte, 8)
+	_, err = rand.Read(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &muxerKey{
+		name:    hex.EncodeToString(name),
+		key:     key,
+		created: time.Now(),
+	}, nil
+}
+
+// encrypt encrypts a payload with AES-128-CBC and PKCS7 padding, as required by
+// the AES-128 method of the HLS specification.
+func (k *muxerKey) encrypt(iv []byte, payload []byte) ([]byte, error) {
+	block, err := aes.NewCipher(k.key)
+	if err != nil {
+		return nil, err
+	}
+
+	padLen := aes.BlockSize - len(payload)%aes.BlockSize
+	padded := make([]byte, len(payload), len(payload)+padLen)
+	copy(padded, payload)
+	padded = append(padded, bytes.Repeat([]byte{byte(padLen)}, padLen)...)
+
+	enc := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(enc, padded)
+
+	return enc, nil
+}
@@ -0,0 +1,34 @@
+package hls
+
+// muxerOutput is a destination where playlists and segments are written,
+// in addition to the embedded HTTP server.
+type muxerOutput interface {
+	writeFile(name string, byts []byte) error
+	removeFile(name string)
+	close()
+}
+
+// muxerOutputs writes files to multiple outputs.
+type muxerOutputs []muxerOutput
+
+func (o muxerOutputs) writeFile(name string, byts []byte) error {
+	for _, out := range o {
+		err := out.writeFile(name, byts)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o muxerOutputs) removeFile(name string) {
+	for _, out := range o {
+		out.removeFile(name)
+	}
+}
+
+func (o muxerOutputs) close() {
+	for _, out := range o {
+		out.close()
+	}
+}
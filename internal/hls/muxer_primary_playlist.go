@@ -21,6 +21,7 @@ func newMuxerPrimaryPlaylist(
 	videoTrack *gortsplib.Track,
 	audioTrack *gortsplib.Track,
 	h264Conf *gortsplib.TrackConfigH264,
+	audioOnlyRendition bool,
 ) *muxerPrimaryPlaylist {
 	p := &muxerPrimaryPlaylist{
 		videoTrack: videoTrack,
@@ -38,9 +39,16 @@ func newMuxerPrimaryPlaylist(
 		codecs = append(codecs, "mp4a.40.2")
 	}
 
-	p.cnt = []byte("#EXTM3U\n" +
+	cnt := "#EXTM3U\n" +
 		"#EXT-X-STREAM-INF:BANDWIDTH=200000,CODECS=\"" + strings.Join(codecs, ",") + "\"\n" +
-		"stream.m3u8\n")
+		"stream.m3u8\n"
+
+	if audioOnlyRendition {
+		cnt += "#EXT-X-STREAM-INF:BANDWIDTH=64000,CODECS=\"mp4a.40.2\"\n" +
+			"audio.m3u8\n"
+	}
+
+	p.cnt = []byte(cnt)
 
 	return p
 }
@@ -0,0 +1,135 @@
+package hls
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// maximum number of files that are waiting to be uploaded.
+	muxerPushQueueSize = 64
+
+	muxerPushTimeout = 10 * time.Second
+)
+
+func contentType(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".m3u8"):
+		return "application/vnd.apple.mpegurl"
+	case strings.HasSuffix(name, ".ts"):
+		return "video/MP2T"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+type muxerPushOp struct {
+	name   string
+	byts   []byte
+	remove bool
+}
+
+// muxerPush uploads playlists and segments to a remote HTTP server with PUT requests,
+// and removes them with DELETE requests.
+// Uploads are performed in order by a dedicated routine, in order not to block the muxer.
+type muxerPush struct {
+	baseURL string
+	onError func(error)
+	client  *http.Client
+
+	queue chan muxerPushOp
+}
+
+func newMuxerPush(baseURL string, onError func(error)) (*muxerPush, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL scheme: %s", u.Scheme)
+	}
+
+	p := &muxerPush{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		onError: onError,
+		client: &http.Client{
+			Timeout: muxerPushTimeout,
+		},
+		queue: make(chan muxerPushOp, muxerPushQueueSize),
+	}
+
+	go p.run()
+
+	return p, nil
+}
+
+// close stops the routine after all the pending files have been processed.
+func (p *muxerPush) close() {
+	close(p.queue)
+}
+
+func (p *muxerPush) run() {
+	for op := range p.queue {
+		err := p.do(op)
+		if err != nil && p.onError != nil {
+			p.onError(err)
+		}
+	}
+
+	p.client.CloseIdleConnections()
+}
+
+func (p *muxerPush) do(op muxerPushOp) error {
+	var req *http.Request
+	var err error
+
+	if op.remove {
+		req, err = http.NewRequest(http.MethodDelete, p.baseURL+"/"+op.name, nil)
+	} else {
+		req, err = http.NewRequest(http.MethodPut, p.baseURL+"/"+op.name, bytes.NewReader(op.byts))
+		if err == nil {
+			req.Header.Set("Content-Type", contentType(op.name))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	// a missing file is not an error when it has to be removed
+	if res.StatusCode/100 != 2 && !(op.remove && res.StatusCode == http.StatusNotFound) {
+		return fmt.Errorf("%s %s: bad status code: %d", req.Method, op.name, res.StatusCode)
+	}
+
+	return nil
+}
+
+func (p *muxerPush) enqueue(op muxerPushOp) {
+	select {
+	case p.queue <- op:
+	default:
+		if p.onError != nil {
+			p.onError(fmt.Errorf("upload queue is full, discarding %s", op.name))
+		}
+	}
+}
+
+// writeFile enqueues the upload of a file. Failed uploads are reported to onError,
+// without interrupting the muxer.
+func (p *muxerPush) writeFile(name string, byts []byte) error {
+	p.enqueue(muxerPushOp{name: name, byts: byts})
+	return nil
+}
+
+func (p *muxerPush) removeFile(name string) {
+	p.enqueue(muxerPushOp{name: name, remove: true})
+}
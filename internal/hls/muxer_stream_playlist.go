@@ -2,11 +2,13 @@ package hls
 
 import (
 	"bytes"
+	"encoding/hex"
 	"io"
 	"math"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 type asyncReader struct {
@@ -22,20 +24,41 @@ func (r *asyncReader) Read(buf []byte) (int, error) {
 }
 
 type muxerStreamPlaylist struct {
-	hlsSegmentCount int
+	fileName                 string
+	hlsSegmentCount          int
+	hlsEncryption            bool
+	hlsEncryptionKeyRotation time.Duration
+	output                   muxerOutput
+	onSegment                func(time.Duration)
 
+	curKey             *muxerKey
 	mutex              sync.Mutex
 	cond               *sync.Cond
 	closed             bool
+	ended              bool
 	segments           []*muxerTSSegment
 	segmentByName      map[string]*muxerTSSegment
 	segmentDeleteCount int
+	keyByName          map[string]*muxerKey
 }
 
-func newMuxerStreamPlaylist(hlsSegmentCount int) *muxerStreamPlaylist {
+func newMuxerStreamPlaylist(
+	fileName string,
+	hlsSegmentCount int,
+	hlsEncryption bool,
+	hlsEncryptionKeyRotation time.Duration,
+	output muxerOutput,
+	onSegment func(time.Duration),
+) *muxerStreamPlaylist {
 	p := &muxerStreamPlaylist{
-		hlsSegmentCount: hlsSegmentCount,
-		segmentByName:   make(map[string]*muxerTSSegment),
+		fileName:                 fileName,
+		hlsSegmentCount:          hlsSegmentCount,
+		hlsEncryption:            hlsEncryption,
+		hlsEncryptionKeyRotation: hlsEncryptionKeyRotation,
+		output:                   output,
+		onSegment:                onSegment,
+		segmentByName:            make(map[string]*muxerTSSegment),
+		keyByName:                make(map[string]*muxerKey),
 	}
 	p.cond = sync.NewCond(&p.mutex)
 	return p
@@ -46,17 +69,49 @@ func (p *muxerStreamPlaylist) close() {
 		p.mutex.Lock()
 		defer p.mutex.Unlock()
 		p.closed = true
+
+		// files are removed in order not to leave stale streams on outputs
+		if p.output != nil {
+			p.output.removeFile(p.fileName)
+			for _, s := range p.segments {
+				p.output.removeFile(s.name + ".ts")
+			}
+			for name := range p.keyByName {
+				p.output.removeFile(name + ".key")
+			}
+		}
 	}()
 
 	p.cond.Broadcast()
 }
 
+// end marks the playlist as ended, in order to make clients stop reloading it.
+func (p *muxerStreamPlaylist) end() {
+	var cnt []byte
+
+	func() {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		p.ended = true
+
+		if p.output != nil {
+			cnt = p.generate()
+		}
+	}()
+
+	p.cond.Broadcast()
+
+	if p.output != nil {
+		p.output.writeFile(p.fileName, cnt)
+	}
+}
+
 func (p *muxerStreamPlaylist) reader() io.Reader {
 	return &asyncReader{generator: func() []byte {
 		p.mutex.Lock()
 		defer p.mutex.Unlock()
 
-		if !p.closed && len(p.segments) == 0 {
+		if !p.closed && !p.ended && len(p.segments) == 0 {
 			p.cond.Wait()
 		}
 
@@ -64,37 +119,50 @@ func (p *muxerStreamPlaylist) reader() io.Reader {
 			return nil
 		}
 
-		cnt := "#EXTM3U\n"
-		cnt += "#EXT-X-VERSION:3\n"
-		cnt += "#EXT-X-ALLOW-CACHE:NO\n"
+		return p.generate()
+	}}
+}
+
+// generate generates the content of the playlist. It must be called with the mutex locked.
+func (p *muxerStreamPlaylist) generate() []byte {
+	cnt := "#EXTM3U\n"
+	cnt += "#EXT-X-VERSION:3\n"
+	cnt += "#EXT-X-ALLOW-CACHE:NO\n"
 
-		targetDuration := func() uint {
-			ret := uint(0)
+	targetDuration := func() uint {
+		ret := uint(0)
 
-			// EXTINF, when rounded to the nearest integer, must be <= EXT-X-TARGETDURATION
-			for _, f := range p.segments {
-				v2 := uint(math.Round(f.duration().Seconds()))
-				if v2 > ret {
-					ret = v2
-				}
+		// EXTINF, when rounded to the nearest integer, must be <= EXT-X-TARGETDURATION
+		for _, f := range p.segments {
+			v2 := uint(math.Round(f.duration().Seconds()))
+			if v2 > ret {
+				ret = v2
 			}
+		}
 
-			return ret
-		}()
-		cnt += "#EXT-X-TARGETDURATION:" + strconv.FormatUint(uint64(targetDuration), 10) + "\n"
+		return ret
+	}()
+	cnt += "#EXT-X-TARGETDURATION:" + strconv.FormatUint(uint64(targetDuration), 10) + "\n"
 
-		cnt += "#EXT-X-MEDIA-SEQUENCE:" + strconv.FormatInt(int64(p.segmentDeleteCount), 10) + "\n"
+	cnt += "#EXT-X-MEDIA-SEQUENCE:" + strconv.FormatInt(int64(p.segmentDeleteCount), 10) + "\n"
 
-		for _, f := range p.segments {
-			cnt += "#EXTINF:" + strconv.FormatFloat(f.duration().Seconds(), 'f', -1, 64) + ",\n"
-			cnt += f.name + ".ts\n"
+	for _, f := range p.segments {
+		if f.key != nil {
+			cnt += "#EXT-X-KEY:METHOD=AES-128,URI=\"" + f.key.name + ".key\",IV=0x" + hex.EncodeToString(f.iv) + "\n"
 		}
+		cnt += "#EXT-X-PROGRAM-DATE-TIME:" + f.startNTP.UTC().Format("2006-01-02T15:04:05.999Z07:00") + "\n"
+		cnt += "#EXTINF:" + strconv.FormatFloat(f.duration().Seconds(), 'f', -1, 64) + ",\n"
+		cnt += f.name + ".ts\n"
+	}
 
-		return []byte(cnt)
-	}}
+	if p.ended {
+		cnt += "#EXT-X-ENDLIST\n"
+	}
+
+	return []byte(cnt)
 }
 
-func (p *muxerStreamPlaylist) segment(fname string) io.Reader {
+func (p *muxerStreamPlaylist) segment(fname string) *MuxerFile {
 	base := strings.TrimSuffix(fname, ".ts")
 
 	p.mutex.Lock()
@@ -105,10 +173,63 @@ func (p *muxerStreamPlaylist) segment(fname string) io.Reader {
 		return nil
 	}
 
-	return f.reader()
+	return f.file()
 }
 
-func (p *muxerStreamPlaylist) pushSegment(t *muxerTSSegment) {
+func (p *muxerStreamPlaylist) key(fname string) io.Reader {
+	base := strings.TrimSuffix(fname, ".key")
+
+	p.mutex.Lock()
+	k, ok := p.keyByName[base]
+	p.mutex.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	return bytes.NewReader(k.key)
+}
+
+func (p *muxerStreamPlaylist) pushSegment(t *muxerTSSegment) error {
+	// encryption is performed outside the mutex, since curKey is accessed
+	// by the writer only.
+	if p.hlsEncryption {
+		if p.curKey == nil || time.Since(p.curKey.created) >= p.hlsEncryptionKeyRotation {
+			k, err := newMuxerKey()
+			if err != nil {
+				return err
+			}
+			p.curKey = k
+		}
+
+		err := t.encrypt(p.curKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	t.finalize()
+
+	// files are written before the segment is listed in the playlist,
+	// in order to prevent external servers from serving missing files.
+	if p.output != nil {
+		err := p.output.writeFile(t.name+".ts", t.buf.Bytes())
+		if err != nil {
+			return err
+		}
+
+		if t.key != nil {
+			err := p.output.writeFile(t.key.name+".key", t.key.key)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	var cnt []byte
+	var removed *muxerTSSegment
+	removedKey := false
+
 	func() {
 		p.mutex.Lock()
 		defer p.mutex.Unlock()
@@ -116,12 +237,48 @@ func (p *muxerStreamPlaylist) pushSegment(t *muxerTSSegment) {
 		p.segmentByName[t.name] = t
 		p.segments = append(p.segments, t)
 
+		if t.key != nil {
+			p.keyByName[t.key.name] = t.key
+		}
+
 		if len(p.segments) > p.hlsSegmentCount {
-			delete(p.segmentByName, p.segments[0].name)
+			removed = p.segments[0]
+			delete(p.segmentByName, removed.name)
 			p.segments = p.segments[1:]
 			p.segmentDeleteCount++
+
+			// keys are removed when they're not used by any segment
+			if removed.key != nil && removed.key != p.segments[0].key {
+				delete(p.keyByName, removed.key.name)
+				removedKey = true
+			}
+		}
+
+		if p.output != nil {
+			cnt = p.generate()
 		}
 	}()
 
 	p.cond.Broadcast()
+
+	if p.onSegment != nil {
+		p.onSegment(t.duration())
+	}
+
+	if p.output != nil {
+		err := p.output.writeFile(p.fileName, cnt)
+		if err != nil {
+			return err
+		}
+
+		// segments that are not listed anymore are removed after the playlist is updated
+		if removed != nil && removed.name != t.name {
+			p.output.removeFile(removed.name + ".ts")
+		}
+		if removedKey {
+			p.output.removeFile(removed.key.name + ".key")
+		}
+	}
+
+	return nil
 }
@@ -1,8 +1,17 @@
 package hls
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -25,19 +34,21 @@ func TestMuxer(t *testing.T) {
 		&gortsplib.TrackConfigAAC{Type: 2, SampleRate: 44100, ChannelCount: 2})
 	require.NoError(t, err)
 
-	m, err := NewMuxer(3, 1*time.Second, videoTrack, audioTrack)
+	m, err := NewMuxer(3, 1*time.Second, false, 0, "", "", nil, false, videoTrack, audioTrack, nil)
 	require.NoError(t, err)
 	defer m.Close()
 
+	ntp := time.Date(2010, 0o1, 0o1, 10, 0, 0, 0, time.UTC)
+
 	// group without IDR
-	err = m.WriteH264(1*time.Second, [][]byte{
+	err = m.WriteH264(ntp.Add(1*time.Second), 1*time.Second, [][]byte{
 		{0x06},
 		{0x07},
 	})
 	require.NoError(t, err)
 
 	// group with IDR
-	err = m.WriteH264(2*time.Second, [][]byte{
+	err = m.WriteH264(ntp.Add(2*time.Second), 2*time.Second, [][]byte{
 		{5}, // IDR
 		{9}, // AUD
 		{8}, // PPS
@@ -45,14 +56,14 @@ func TestMuxer(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	err = m.WriteAAC(3*time.Second, [][]byte{
+	err = m.WriteAAC(ntp.Add(3*time.Second), 3*time.Second, [][]byte{
 		{0x01, 0x02, 0x03, 0x04},
 		{0x05, 0x06, 0x07, 0x08},
 	})
 	require.NoError(t, err)
 
 	// group without IDR
-	err = m.WriteH264(4*time.Second, [][]byte{
+	err = m.WriteH264(ntp.Add(4*time.Second), 4*time.Second, [][]byte{
 		{6},
 		{7},
 	})
@@ -61,7 +72,7 @@ func TestMuxer(t *testing.T) {
 	time.Sleep(2 * time.Second)
 
 	// group with IDR
-	err = m.WriteH264(6*time.Second, [][]byte{
+	err = m.WriteH264(ntp.Add(6*time.Second), 6*time.Second, [][]byte{
 		{5}, // IDR
 	})
 	require.NoError(t, err)
@@ -81,13 +92,20 @@ func TestMuxer(t *testing.T) {
 		`#EXT-X-ALLOW-CACHE:NO\n` +
 		`#EXT-X-TARGETDURATION:4\n` +
 		`#EXT-X-MEDIA-SEQUENCE:0\n` +
+		`#EXT-X-PROGRAM-DATE-TIME:2010-01-01T10:00:02Z\n` +
 		`#EXTINF:4,\n` +
 		`([0-9]+\.ts)\n$`)
 	ma := re.FindStringSubmatch(string(byts))
 	require.NotEqual(t, 0, len(ma))
 
-	byts, err = ioutil.ReadAll(m.Segment(ma[1]))
+	seg := m.Segment(ma[1])
+	require.NotEqual(t, "", seg.ETag)
+	require.Equal(t, false, seg.ModTime.IsZero())
+	require.Equal(t, seg.ETag, m.Segment(ma[1]).ETag)
+
+	byts, err = ioutil.ReadAll(seg)
 	require.NoError(t, err)
+	require.Equal(t, fileETag(byts), seg.ETag)
 
 	checkTSPacket(t, byts, 0, 1)
 	byts = byts[188:]
@@ -116,11 +134,11 @@ func TestMuxerCloseBeforeFirstSegment(t *testing.T) {
 		&gortsplib.TrackConfigAAC{Type: 2, SampleRate: 44100, ChannelCount: 2})
 	require.NoError(t, err)
 
-	m, err := NewMuxer(3, 1*time.Second, videoTrack, audioTrack)
+	m, err := NewMuxer(3, 1*time.Second, false, 0, "", "", nil, false, videoTrack, audioTrack, nil)
 	require.NoError(t, err)
 
 	// group with IDR
-	err = m.WriteH264(2*time.Second, [][]byte{
+	err = m.WriteH264(time.Now(), 2*time.Second, [][]byte{
 		{5}, // IDR
 		{9}, // AUD
 		{8}, // PPS
@@ -134,3 +152,321 @@ func TestMuxerCloseBeforeFirstSegment(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, []byte{}, byts)
 }
+
+func TestMuxerEnd(t *testing.T) {
+	videoTrack, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x07, 0x01, 0x02, 0x03}, PPS: []byte{0x08}})
+	require.NoError(t, err)
+
+	m, err := NewMuxer(3, 1*time.Second, false, 0, "", "", nil, false, videoTrack, nil, nil)
+	require.NoError(t, err)
+	defer m.Close()
+
+	// the playlist is returned even if there are no segments
+	m.End()
+
+	byts, err := ioutil.ReadAll(m.StreamPlaylist())
+	require.NoError(t, err)
+	require.Regexp(t, regexp.MustCompile(`#EXT-X-ENDLIST\n$`), string(byts))
+}
+
+func TestMuxerEndWritesLastSegment(t *testing.T) {
+	videoTrack, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x07, 0x01, 0x02, 0x03}, PPS: []byte{0x08}})
+	require.NoError(t, err)
+
+	m, err := NewMuxer(3, 10*time.Second, false, 0, "", "", nil, false, videoTrack, nil, nil)
+	require.NoError(t, err)
+	defer m.Close()
+
+	for _, pts := range []time.Duration{2 * time.Second, 3 * time.Second} {
+		err = m.WriteH264(time.Now(), pts, [][]byte{
+			{5}, // IDR
+		})
+		require.NoError(t, err)
+	}
+
+	err = m.End()
+	require.NoError(t, err)
+
+	// data written after the end is discarded
+	err = m.WriteH264(time.Now(), 20*time.Second, [][]byte{
+		{5}, // IDR
+	})
+	require.NoError(t, err)
+
+	byts, err := ioutil.ReadAll(m.StreamPlaylist())
+	require.NoError(t, err)
+	require.Regexp(t, regexp.MustCompile(`#EXT-X-MEDIA-SEQUENCE:0\n`+
+		`#EXT-X-PROGRAM-DATE-TIME:[^\n]+\n`+
+		`#EXTINF:1,\n`+
+		`[0-9]+\.ts\n`+
+		`#EXT-X-ENDLIST\n$`), string(byts))
+}
+
+func TestMuxerEncryption(t *testing.T) {
+	videoTrack, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x07, 0x01, 0x02, 0x03}, PPS: []byte{0x08}})
+	require.NoError(t, err)
+
+	m, err := NewMuxer(3, 1*time.Second, true, 1*time.Minute, "", "", nil, false, videoTrack, nil, nil)
+	require.NoError(t, err)
+	defer m.Close()
+
+	for _, pts := range []time.Duration{2 * time.Second, 4 * time.Second, 6 * time.Second} {
+		err = m.WriteH264(time.Now(), pts, [][]byte{
+			{5}, // IDR
+		})
+		require.NoError(t, err)
+	}
+
+	byts, err := ioutil.ReadAll(m.StreamPlaylist())
+	require.NoError(t, err)
+
+	re := regexp.MustCompile(`^#EXTM3U\n` +
+		`#EXT-X-VERSION:3\n` +
+		`#EXT-X-ALLOW-CACHE:NO\n` +
+		`#EXT-X-TARGETDURATION:2\n` +
+		`#EXT-X-MEDIA-SEQUENCE:0\n` +
+		`#EXT-X-KEY:METHOD=AES-128,URI="([0-9a-f]+\.key)",IV=0x([0-9a-f]{32})\n` +
+		`#EXT-X-PROGRAM-DATE-TIME:[^\n]+\n` +
+		`#EXTINF:2,\n` +
+		`([0-9]+\.ts)\n` +
+		`#EXT-X-KEY:METHOD=AES-128,URI="([0-9a-f]+\.key)",IV=0x([0-9a-f]{32})\n` +
+		`#EXT-X-PROGRAM-DATE-TIME:[^\n]+\n` +
+		`#EXTINF:2,\n` +
+		`([0-9]+\.ts)\n$`)
+	ma := re.FindStringSubmatch(string(byts))
+	require.NotEqual(t, 0, len(ma))
+
+	// the key is not rotated before the rotation period
+	require.Equal(t, ma[1], ma[4])
+	require.NotEqual(t, ma[2], ma[5])
+
+	key, err := ioutil.ReadAll(m.Key(ma[1]))
+	require.NoError(t, err)
+	require.Equal(t, 16, len(key))
+
+	require.Nil(t, m.Key("0000000000000000.key"))
+
+	iv, err := hex.DecodeString(ma[5])
+	require.NoError(t, err)
+
+	byts, err = ioutil.ReadAll(m.Segment(ma[6]))
+	require.NoError(t, err)
+	require.Equal(t, 0, len(byts)%aes.BlockSize)
+
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	dec := make([]byte, len(byts))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(dec, byts)
+
+	// remove PKCS7 padding
+	padLen := int(dec[len(dec)-1])
+	dec = dec[:len(dec)-padLen]
+	require.Equal(t, 0, len(dec)%188)
+
+	checkTSPacket(t, dec, 0, 1)
+}
+
+func TestMuxerDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtsp-hls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	videoTrack, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x07, 0x01, 0x02, 0x03}, PPS: []byte{0x08}})
+	require.NoError(t, err)
+
+	m, err := NewMuxer(3, 1*time.Second, false, 0, filepath.Join(dir, "mypath"), "", nil, false, videoTrack, nil, nil)
+	require.NoError(t, err)
+
+	for _, pts := range []time.Duration{2 * time.Second, 4 * time.Second} {
+		err = m.WriteH264(time.Now(), pts, [][]byte{
+			{5}, // IDR
+		})
+		require.NoError(t, err)
+	}
+
+	byts, err := ioutil.ReadFile(filepath.Join(dir, "mypath", "index.m3u8"))
+	require.NoError(t, err)
+	require.Equal(t, "#EXTM3U\n"+
+		"#EXT-X-STREAM-INF:BANDWIDTH=200000,CODECS=\"avc1.010203\"\n"+
+		"stream.m3u8\n", string(byts))
+
+	byts, err = ioutil.ReadFile(filepath.Join(dir, "mypath", "stream.m3u8"))
+	require.NoError(t, err)
+
+	byts2, err := ioutil.ReadAll(m.StreamPlaylist())
+	require.NoError(t, err)
+	require.Equal(t, string(byts2), string(byts))
+
+	ma := regexp.MustCompile(`\n([0-9]+\.ts)\n$`).FindStringSubmatch(string(byts))
+	require.NotEqual(t, 0, len(ma))
+
+	byts, err = ioutil.ReadFile(filepath.Join(dir, "mypath", ma[1]))
+	require.NoError(t, err)
+	checkTSPacket(t, byts, 0, 1)
+
+	// files are removed when the muxer is closed
+	m.Close()
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, "mypath"))
+	require.NoError(t, err)
+	require.Equal(t, 0, len(files))
+}
+
+func TestMuxerPush(t *testing.T) {
+	var mutex sync.Mutex
+	files := make(map[string][]byte)
+	contentTypes := make(map[string]string)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "myuser" || pass != "mypass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		name := strings.TrimPrefix(r.URL.Path, "/live/mypath/")
+
+		switch r.Method {
+		case http.MethodPut:
+			byts, _ := ioutil.ReadAll(r.Body)
+			files[name] = byts
+			contentTypes[name] = r.Header.Get("Content-Type")
+
+		case http.MethodDelete:
+			delete(files, name)
+		}
+	}))
+	defer s.Close()
+
+	videoTrack, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x07, 0x01, 0x02, 0x03}, PPS: []byte{0x08}})
+	require.NoError(t, err)
+
+	pushURL := strings.Replace(s.URL, "http://", "http://myuser:mypass@", 1) + "/live/mypath"
+
+	m, err := NewMuxer(3, 1*time.Second, false, 0, "", pushURL, func(err error) {
+		t.Errorf("unexpected error: %v", err)
+	}, false, videoTrack, nil, nil)
+	require.NoError(t, err)
+
+	for _, pts := range []time.Duration{2 * time.Second, 4 * time.Second} {
+		err = m.WriteH264(time.Now(), pts, [][]byte{
+			{5}, // IDR
+		})
+		require.NoError(t, err)
+	}
+
+	byts2, err := ioutil.ReadAll(m.StreamPlaylist())
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return string(files["stream.m3u8"]) == string(byts2)
+	}, 2*time.Second, 10*time.Millisecond)
+
+	mutex.Lock()
+	require.Equal(t, "#EXTM3U\n"+
+		"#EXT-X-STREAM-INF:BANDWIDTH=200000,CODECS=\"avc1.010203\"\n"+
+		"stream.m3u8\n", string(files["index.m3u8"]))
+	require.Equal(t, "application/vnd.apple.mpegurl", contentTypes["index.m3u8"])
+
+	ma := regexp.MustCompile(`\n([0-9]+\.ts)\n$`).FindStringSubmatch(string(byts2))
+	require.NotEqual(t, 0, len(ma))
+	checkTSPacket(t, files[ma[1]], 0, 1)
+	require.Equal(t, "video/MP2T", contentTypes[ma[1]])
+	mutex.Unlock()
+
+	// files are removed when the muxer is closed
+	m.Close()
+
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(files) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestMuxerPushError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer s.Close()
+
+	videoTrack, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x07, 0x01, 0x02, 0x03}, PPS: []byte{0x08}})
+	require.NoError(t, err)
+
+	pushErr := make(chan error, 16)
+
+	m, err := NewMuxer(3, 1*time.Second, false, 0, "", s.URL+"/mypath", func(err error) {
+		select {
+		case pushErr <- err:
+		default:
+		}
+	}, false, videoTrack, nil, nil)
+	require.NoError(t, err)
+	defer m.Close()
+
+	select {
+	case err := <-pushErr:
+		require.EqualError(t, err, "PUT index.m3u8: bad status code: 403")
+	case <-time.After(2 * time.Second):
+		t.Errorf("timed out")
+	}
+}
+
+func TestMuxerAudioOnlyRendition(t *testing.T) {
+	videoTrack, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x07, 0x01, 0x02, 0x03}, PPS: []byte{0x08}})
+	require.NoError(t, err)
+
+	audioTrack, err := gortsplib.NewTrackAAC(97,
+		&gortsplib.TrackConfigAAC{Type: 2, SampleRate: 44100, ChannelCount: 2})
+	require.NoError(t, err)
+
+	m, err := NewMuxer(3, 1*time.Second, false, 0, "", "", nil, true, videoTrack, audioTrack, nil)
+	require.NoError(t, err)
+	defer m.Close()
+
+	byts, err := ioutil.ReadAll(m.PrimaryPlaylist())
+	require.NoError(t, err)
+	require.Equal(t, "#EXTM3U\n"+
+		"#EXT-X-STREAM-INF:BANDWIDTH=200000,CODECS=\"avc1.010203,mp4a.40.2\"\n"+
+		"stream.m3u8\n"+
+		"#EXT-X-STREAM-INF:BANDWIDTH=64000,CODECS=\"mp4a.40.2\"\n"+
+		"audio.m3u8\n", string(byts))
+
+	aus := make([][]byte, 60)
+	for i := range aus {
+		aus[i] = []byte{0x01, 0x02, 0x03, 0x04}
+	}
+
+	for _, pts := range []time.Duration{0, 1500 * time.Millisecond, 3 * time.Second} {
+		err = m.WriteAAC(time.Now(), pts, aus)
+		require.NoError(t, err)
+	}
+
+	byts, err = ioutil.ReadAll(m.AudioPlaylist())
+	require.NoError(t, err)
+
+	ma := regexp.MustCompile(`\n(audio_[0-9]+\.ts)\n$`).FindStringSubmatch(string(byts))
+	require.NotEqual(t, 0, len(ma))
+
+	byts, err = ioutil.ReadAll(m.Segment(ma[1]))
+	require.NoError(t, err)
+	checkTSPacket(t, byts, 0, 1)
+
+	// the audio-only rendition is not available without a video track
+	m2, err := NewMuxer(3, 1*time.Second, false, 0, "", "", nil, true, nil, audioTrack, nil)
+	require.NoError(t, err)
+	defer m2.Close()
+	require.Nil(t, m2.AudioPlaylist())
+}
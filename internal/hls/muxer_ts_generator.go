@@ -23,6 +23,7 @@ type muxerTSGenerator struct {
 	h264Conf           *gortsplib.TrackConfigH264
 	aacConf            *gortsplib.TrackConfigAAC
 	streamPlaylist     *muxerStreamPlaylist
+	segmentNamePrefix  string
 
 	writer         *muxerTSWriter
 	currentSegment *muxerTSSegment
@@ -30,6 +31,7 @@ type muxerTSGenerator struct {
 	audioAUCount   int
 	startPCR       time.Time
 	startPTS       time.Duration
+	lastPTS        time.Duration
 }
 
 func newMuxerTSGenerator(
@@ -40,6 +42,7 @@ func newMuxerTSGenerator(
 	h264Conf *gortsplib.TrackConfigH264,
 	aacConf *gortsplib.TrackConfigAAC,
 	streamPlaylist *muxerStreamPlaylist,
+	segmentNamePrefix string,
 ) *muxerTSGenerator {
 	m := &muxerTSGenerator{
 		hlsSegmentCount:    hlsSegmentCount,
@@ -49,15 +52,16 @@ func newMuxerTSGenerator(
 		h264Conf:           h264Conf,
 		aacConf:            aacConf,
 		streamPlaylist:     streamPlaylist,
+		segmentNamePrefix:  segmentNamePrefix,
 		writer:             newMuxerTSWriter(videoTrack, audioTrack),
 	}
 
-	m.currentSegment = newMuxerTSSegment(m.videoTrack, m.writer)
+	m.currentSegment = newMuxerTSSegment(m.videoTrack, m.writer, m.segmentNamePrefix)
 
 	return m
 }
 
-func (m *muxerTSGenerator) writeH264(pts time.Duration, nalus [][]byte) error {
+func (m *muxerTSGenerator) writeH264(ntp time.Time, pts time.Duration, nalus [][]byte) error {
 	idrPresent := func() bool {
 		for _, nalu := range nalus {
 			typ := h264.NALUType(nalu[0] & 0x1F)
@@ -87,8 +91,11 @@ func (m *muxerTSGenerator) writeH264(pts time.Duration, nalus [][]byte) error {
 		if idrPresent &&
 			(pts-m.currentSegment.startPTS) >= m.hlsSegmentDuration {
 			m.currentSegment.endPTS = pts
-			m.streamPlaylist.pushSegment(m.currentSegment)
-			m.currentSegment = newMuxerTSSegment(m.videoTrack, m.writer)
+			err := m.streamPlaylist.pushSegment(m.currentSegment)
+			if err != nil {
+				return err
+			}
+			m.currentSegment = newMuxerTSSegment(m.videoTrack, m.writer, m.segmentNamePrefix)
 		}
 	}
 
@@ -118,10 +125,12 @@ func (m *muxerTSGenerator) writeH264(pts time.Duration, nalus [][]byte) error {
 		return err
 	}
 
-	return m.currentSegment.writeH264(m.startPCR, dts, pts, idrPresent, enc)
+	m.lastPTS = pts
+
+	return m.currentSegment.writeH264(m.startPCR, ntp, dts, pts, idrPresent, enc)
 }
 
-func (m *muxerTSGenerator) writeAAC(pts time.Duration, aus [][]byte) error {
+func (m *muxerTSGenerator) writeAAC(ntp time.Time, pts time.Duration, aus [][]byte) error {
 	if m.videoTrack == nil && !m.currentSegment.firstPacketWritten {
 		m.startPCR = time.Now()
 		m.startPTS = pts
@@ -136,8 +145,11 @@ func (m *muxerTSGenerator) writeAAC(pts time.Duration, aus [][]byte) error {
 				(pts-m.currentSegment.startPTS) >= m.hlsSegmentDuration {
 				m.audioAUCount = 0
 				m.currentSegment.endPTS = pts
-				m.streamPlaylist.pushSegment(m.currentSegment)
-				m.currentSegment = newMuxerTSSegment(m.videoTrack, m.writer)
+				err := m.streamPlaylist.pushSegment(m.currentSegment)
+				if err != nil {
+					return err
+				}
+				m.currentSegment = newMuxerTSSegment(m.videoTrack, m.writer, m.segmentNamePrefix)
 			}
 		}
 	} else {
@@ -146,7 +158,7 @@ func (m *muxerTSGenerator) writeAAC(pts time.Duration, aus [][]byte) error {
 		}
 	}
 
-	for _, au := range aus {
+	for i, au := range aus {
 		enc, err := aac.EncodeADTS([]*aac.ADTSPacket{
 			{
 				SampleRate:   m.aacConf.SampleRate,
@@ -158,7 +170,9 @@ func (m *muxerTSGenerator) writeAAC(pts time.Duration, aus [][]byte) error {
 			return err
 		}
 
-		err = m.currentSegment.writeAAC(m.startPCR, pts, enc)
+		auNTP := ntp.Add(time.Duration(i) * 1000 * time.Second / time.Duration(m.aacConf.SampleRate))
+
+		err = m.currentSegment.writeAAC(m.startPCR, auNTP, pts, enc)
 		if err != nil {
 			return err
 		}
@@ -170,5 +184,22 @@ func (m *muxerTSGenerator) writeAAC(pts time.Duration, aus [][]byte) error {
 		pts += 1000 * time.Second / time.Duration(m.aacConf.SampleRate)
 	}
 
+	if m.videoTrack == nil {
+		m.lastPTS = pts
+	}
+
 	return nil
 }
+
+// flush writes the current segment into the playlist, even if it's shorter
+// than the segment duration.
+func (m *muxerTSGenerator) flush() error {
+	if !m.currentSegment.firstPacketWritten {
+		return nil
+	}
+
+	m.currentSegment.endPTS = m.lastPTS
+	err := m.streamPlaylist.pushSegment(m.currentSegment)
+	m.currentSegment = newMuxerTSSegment(m.videoTrack, m.writer, m.segmentNamePrefix)
+	return err
+}
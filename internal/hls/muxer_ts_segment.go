@@ -2,7 +2,8 @@ package hls
 
 import (
 	"bytes"
-	"io"
+	"crypto/aes"
+	"crypto/rand"
 	"strconv"
 	"time"
 
@@ -18,18 +19,24 @@ type muxerTSSegment struct {
 	buf                bytes.Buffer
 	firstPacketWritten bool
 	startPTS           time.Duration
+	startNTP           time.Time
 	endPTS             time.Duration
 	pcrSendCounter     int
+	key                *muxerKey
+	iv                 []byte
+	modTime            time.Time
+	etag               string
 }
 
 func newMuxerTSSegment(
 	videoTrack *gortsplib.Track,
 	writer *muxerTSWriter,
+	namePrefix string,
 ) *muxerTSSegment {
 	t := &muxerTSSegment{
 		videoTrack: videoTrack,
 		writer:     writer,
-		name:       strconv.FormatInt(time.Now().Unix(), 10),
+		name:       namePrefix + strconv.FormatInt(time.Now().Unix(), 10),
 	}
 
 	// WriteTable() is called automatically when WriteData() is called with
@@ -50,12 +57,44 @@ func (t *muxerTSSegment) write(p []byte) (int, error) {
 	return t.buf.Write(p)
 }
 
-func (t *muxerTSSegment) reader() io.Reader {
-	return bytes.NewReader(t.buf.Bytes())
+// encrypt encrypts the content of the segment with a key and a random IV.
+func (t *muxerTSSegment) encrypt(k *muxerKey) error {
+	iv := make([]byte, aes.BlockSize)
+	_, err := rand.Read(iv)
+	if err != nil {
+		return err
+	}
+
+	enc, err := k.encrypt(iv, t.buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	t.buf.Reset()
+	t.buf.Write(enc)
+	t.key = k
+	t.iv = iv
+
+	return nil
+}
+
+// finalize is called when the segment is complete and doesn't change anymore.
+func (t *muxerTSSegment) finalize() {
+	t.modTime = time.Now()
+	t.etag = fileETag(t.buf.Bytes())
+}
+
+func (t *muxerTSSegment) file() *MuxerFile {
+	return &MuxerFile{
+		ReadSeeker: bytes.NewReader(t.buf.Bytes()),
+		ModTime:    t.modTime,
+		ETag:       t.etag,
+	}
 }
 
 func (t *muxerTSSegment) writeH264(
 	startPCR time.Time,
+	ntp time.Time,
 	dts time.Duration,
 	pts time.Duration,
 	idrPresent bool,
@@ -63,6 +102,7 @@ func (t *muxerTSSegment) writeH264(
 	if !t.firstPacketWritten {
 		t.firstPacketWritten = true
 		t.startPTS = pts
+		t.startNTP = ntp
 	}
 
 	var af *astits.PacketAdaptationField
@@ -114,12 +154,14 @@ func (t *muxerTSSegment) writeH264(
 
 func (t *muxerTSSegment) writeAAC(
 	startPCR time.Time,
+	ntp time.Time,
 	pts time.Duration,
 	enc []byte) error {
 	if t.videoTrack == nil {
 		if !t.firstPacketWritten {
 			t.firstPacketWritten = true
 			t.startPTS = pts
+			t.startNTP = ntp
 		}
 	}
 
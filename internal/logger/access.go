@@ -0,0 +1,158 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aler9/rtsp-simple-server/internal/redact"
+)
+
+// AccessFormat is the format of an access log.
+type AccessFormat int
+
+const (
+	// AccessFormatCLF writes lines in the Common Log Format.
+	AccessFormatCLF AccessFormat = iota
+
+	// AccessFormatJSON writes a JSON object per line.
+	AccessFormatJSON
+)
+
+// AccessEntry is a HTTP request that is written into an access log.
+type AccessEntry struct {
+	Time       time.Time
+	Component  string
+	RemoteAddr string
+	User       string
+	Method     string
+	URI        string
+	Proto      string
+	Status     int
+	Size       int
+	Duration   time.Duration
+	Referer    string
+	UserAgent  string
+}
+
+type accessJSONEntry struct {
+	Time      string  `json:"time"`
+	Component string  `json:"component"`
+	ClientIP  string  `json:"clientIP"`
+	User      string  `json:"user,omitempty"`
+	Method    string  `json:"method"`
+	URI       string  `json:"uri"`
+	Proto     string  `json:"proto"`
+	Status    int     `json:"status"`
+	Size      int     `json:"size"`
+	Duration  float64 `json:"duration"`
+	Referer   string  `json:"referer,omitempty"`
+	UserAgent string  `json:"userAgent,omitempty"`
+}
+
+func (e AccessEntry) clientIP() string {
+	host, _, err := net.SplitHostPort(e.RemoteAddr)
+	if err != nil {
+		return e.RemoteAddr
+	}
+	return host
+}
+
+func clfField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// 127.0.0.1 - user [10/Oct/2000:13:55:36 -0700] "GET /stream/index.m3u8 HTTP/1.1" 200 2326
+func (e AccessEntry) writeCLF(buf *bytes.Buffer) {
+	buf.WriteString(e.clientIP())
+	buf.WriteString(" - ")
+	buf.WriteString(clfField(e.User))
+	buf.WriteString(" [")
+	buf.WriteString(e.Time.Format("02/Jan/2006:15:04:05 -0700"))
+	buf.WriteString("] \"")
+	buf.WriteString(e.Method)
+	buf.WriteByte(' ')
+	buf.WriteString(e.URI)
+	buf.WriteByte(' ')
+	buf.WriteString(e.Proto)
+	buf.WriteString("\" ")
+	buf.WriteString(strconv.FormatInt(int64(e.Status), 10))
+	buf.WriteByte(' ')
+	if e.Size > 0 {
+		buf.WriteString(strconv.FormatInt(int64(e.Size), 10))
+	} else {
+		buf.WriteByte('-')
+	}
+	buf.WriteByte('\n')
+}
+
+func (e AccessEntry) writeJSON(buf *bytes.Buffer) {
+	byts, _ := json.Marshal(accessJSONEntry{
+		Time:      e.Time.Format(time.RFC3339Nano),
+		Component: e.Component,
+		ClientIP:  e.clientIP(),
+		User:      e.User,
+		Method:    e.Method,
+		URI:       e.URI,
+		Proto:     e.Proto,
+		Status:    e.Status,
+		Size:      e.Size,
+		Duration:  e.Duration.Seconds(),
+		Referer:   e.Referer,
+		UserAgent: e.UserAgent,
+	})
+	buf.Write(byts)
+	buf.WriteByte('\n')
+}
+
+// AccessLog writes HTTP requests into a file.
+type AccessLog struct {
+	format AccessFormat
+
+	mutex sync.Mutex
+	file  *file
+	buf   bytes.Buffer
+}
+
+// NewAccessLog allocates an AccessLog.
+func NewAccessLog(format AccessFormat, filePath string, fileRotation FileRotation) (*AccessLog, error) {
+	f, err := newFile(filePath, fileRotation)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AccessLog{
+		format: format,
+		file:   f,
+	}, nil
+}
+
+// Close closes an AccessLog.
+func (l *AccessLog) Close() {
+	l.file.Close()
+}
+
+// Log writes an entry.
+func (l *AccessLog) Log(e AccessEntry) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.buf.Reset()
+
+	// credentials can be passed through query parameters
+	e.URI = redact.Text(e.URI)
+
+	if l.format == AccessFormatJSON {
+		e.writeJSON(&l.buf)
+	} else {
+		e.writeCLF(&l.buf)
+	}
+
+	l.file.Write(l.buf.Bytes())
+}
@@ -0,0 +1,73 @@
+package logger
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLog(t *testing.T) {
+	entry := AccessEntry{
+		Time:       time.Date(2021, 10, 10, 13, 55, 36, 0, time.FixedZone("", -7*3600)),
+		Component:  "HLS",
+		RemoteAddr: "127.0.0.1:4567",
+		Method:     "GET",
+		URI:        "/mypath/index.m3u8",
+		Proto:      "HTTP/1.1",
+		Status:     200,
+		Size:       2326,
+		Duration:   1500 * time.Millisecond,
+		UserAgent:  "myagent",
+	}
+
+	for _, ca := range []string{"clf", "json"} {
+		t.Run(ca, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "rtsp-accesslog")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			fpath := filepath.Join(dir, "access.log")
+
+			format := AccessFormatCLF
+			if ca == "json" {
+				format = AccessFormatJSON
+			}
+
+			l, err := NewAccessLog(format, fpath, FileRotation{})
+			require.NoError(t, err)
+			l.Log(entry)
+			l.Close()
+
+			byts, err := ioutil.ReadFile(fpath)
+			require.NoError(t, err)
+
+			if ca == "clf" {
+				require.Equal(t, "127.0.0.1 - - [10/Oct/2021:13:55:36 -0700] "+
+					"\"GET /mypath/index.m3u8 HTTP/1.1\" 200 2326\n", string(byts))
+				return
+			}
+
+			var out map[string]interface{}
+			err = json.Unmarshal([]byte(strings.TrimSuffix(string(byts), "\n")), &out)
+			require.NoError(t, err)
+			require.Equal(t, map[string]interface{}{
+				"time":      "2021-10-10T13:55:36-07:00",
+				"component": "HLS",
+				"clientIP":  "127.0.0.1",
+				"method":    "GET",
+				"uri":       "/mypath/index.m3u8",
+				"proto":     "HTTP/1.1",
+				"status":    float64(200),
+				"size":      float64(2326),
+				"duration":  1.5,
+				"userAgent": "myagent",
+			}, out)
+		})
+	}
+}
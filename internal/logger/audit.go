@@ -0,0 +1,84 @@
+package logger
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// AuditOutcome is the outcome of an authentication or authorization decision.
+type AuditOutcome string
+
+// outcomes.
+const (
+	AuditSuccess AuditOutcome = "success"
+	AuditFailure AuditOutcome = "failure"
+)
+
+// AuditEntry is an authentication or authorization decision that is written into an audit log.
+type AuditEntry struct {
+	Time     time.Time
+	Protocol string
+	Action   string
+	Path     string
+	User     string
+	IP       string
+	Outcome  AuditOutcome
+	Reason   string
+}
+
+type auditJSONEntry struct {
+	Time     string       `json:"time"`
+	Protocol string       `json:"protocol"`
+	Action   string       `json:"action"`
+	Path     string       `json:"path"`
+	User     string       `json:"user,omitempty"`
+	IP       string       `json:"ip,omitempty"`
+	Outcome  AuditOutcome `json:"outcome"`
+	Reason   string       `json:"reason,omitempty"`
+}
+
+// AuditLog writes authentication and authorization decisions into a file,
+// a JSON object per line.
+// The file is opened in append mode and is never rotated, in order to preserve records.
+type AuditLog struct {
+	mutex sync.Mutex
+	file  *file
+}
+
+// NewAuditLog allocates an AuditLog.
+func NewAuditLog(filePath string) (*AuditLog, error) {
+	f, err := newFile(filePath, FileRotation{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuditLog{
+		file: f,
+	}, nil
+}
+
+// Close closes an AuditLog.
+func (l *AuditLog) Close() {
+	l.file.Close()
+}
+
+// Log writes an entry.
+func (l *AuditLog) Log(e AuditEntry) {
+	byts, _ := json.Marshal(auditJSONEntry{
+		Time:     e.Time.Format(time.RFC3339Nano),
+		Protocol: e.Protocol,
+		Action:   e.Action,
+		Path:     e.Path,
+		User:     e.User,
+		IP:       e.IP,
+		Outcome:  e.Outcome,
+		Reason:   e.Reason,
+	})
+	byts = append(byts, '\n')
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.file.Write(byts)
+}
@@ -0,0 +1,60 @@
+package logger
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtsp-auditlog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "audit.log")
+
+	// existing records are preserved
+	err = ioutil.WriteFile(fpath, []byte("previous\n"), 0o644)
+	require.NoError(t, err)
+
+	l, err := NewAuditLog(fpath)
+	require.NoError(t, err)
+	l.Log(AuditEntry{
+		Time:     time.Date(2021, 10, 10, 13, 55, 36, 0, time.UTC),
+		Protocol: "rtsp",
+		Action:   "publish",
+		Path:     "mypath",
+		User:     "myuser",
+		IP:       "127.0.0.1",
+		Outcome:  AuditFailure,
+		Reason:   "wrong credentials",
+	})
+	l.Close()
+
+	byts, err := ioutil.ReadFile(fpath)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(string(byts), "\n"), "\n")
+	require.Equal(t, 2, len(lines))
+	require.Equal(t, "previous", lines[0])
+
+	var out map[string]interface{}
+	err = json.Unmarshal([]byte(lines[1]), &out)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"time":     "2021-10-10T13:55:36Z",
+		"protocol": "rtsp",
+		"action":   "publish",
+		"path":     "mypath",
+		"user":     "myuser",
+		"ip":       "127.0.0.1",
+		"outcome":  "failure",
+		"reason":   "wrong credentials",
+	}, out)
+}
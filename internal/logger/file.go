@@ -0,0 +1,194 @@
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fileBackupTimeFormat = "20060102-150405.000"
+)
+
+// FileRotation contains the rotation parameters of the log file.
+type FileRotation struct {
+	// rotate the file when it reaches this size, in bytes. Zero disables the check.
+	MaxSize int64
+
+	// rotate the file when it has been open for this duration. Zero disables the check.
+	MaxAge time.Duration
+
+	// maximum number of rotated files to keep. Zero keeps all files.
+	MaxBackups int
+
+	// compress rotated files with gzip.
+	Compress bool
+}
+
+type file struct {
+	path     string
+	rotation FileRotation
+
+	f        *os.File
+	size     int64
+	openTime time.Time
+	wg       sync.WaitGroup
+}
+
+func newFile(path string, rotation FileRotation) (*file, error) {
+	lf := &file{
+		path:     path,
+		rotation: rotation,
+	}
+
+	err := lf.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return lf, nil
+}
+
+func (lf *file) open() error {
+	f, err := os.OpenFile(lf.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	lf.f = f
+	lf.size = fi.Size()
+	lf.openTime = time.Now()
+	return nil
+}
+
+func (lf *file) Close() error {
+	lf.wg.Wait()
+	if lf.f == nil {
+		return nil
+	}
+	return lf.f.Close()
+}
+
+func (lf *file) shouldRotate(n int) bool {
+	if lf.rotation.MaxSize > 0 && lf.size > 0 && (lf.size+int64(n)) > lf.rotation.MaxSize {
+		return true
+	}
+
+	if lf.rotation.MaxAge > 0 && time.Since(lf.openTime) >= lf.rotation.MaxAge {
+		return true
+	}
+
+	return false
+}
+
+func (lf *file) Write(p []byte) (int, error) {
+	if lf.f != nil && lf.shouldRotate(len(p)) {
+		lf.rotate()
+	}
+
+	// the file can't be opened after a rotation, try again
+	if lf.f == nil {
+		err := lf.open()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := lf.f.Write(p)
+	lf.size += int64(n)
+	return n, err
+}
+
+func (lf *file) rotate() {
+	lf.f.Close()
+	lf.f = nil
+
+	backupPath := lf.path + "." + time.Now().Format(fileBackupTimeFormat)
+	err := os.Rename(lf.path, backupPath)
+	if err != nil {
+		return
+	}
+
+	// compress and remove old files in the background
+	// in order not to block the logger
+	lf.wg.Wait()
+	lf.wg.Add(1)
+	go func() {
+		defer lf.wg.Done()
+
+		if lf.rotation.Compress {
+			compressFile(backupPath)
+		}
+
+		lf.removeOldBackups()
+	}()
+
+	lf.open()
+}
+
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	gw := gzip.NewWriter(out)
+
+	_, err = io.Copy(gw, in)
+	if err == nil {
+		err = gw.Close()
+	}
+	out.Close()
+
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// backups returns the rotated files, from the oldest to the newest.
+func (lf *file) backups() []string {
+	matches, _ := filepath.Glob(lf.path + ".*")
+
+	var ret []string
+	for _, m := range matches {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(m, lf.path+"."), ".gz")
+		if _, err := time.Parse(fileBackupTimeFormat, suffix); err == nil {
+			ret = append(ret, m)
+		}
+	}
+
+	sort.Strings(ret)
+	return ret
+}
+
+func (lf *file) removeOldBackups() {
+	if lf.rotation.MaxBackups <= 0 {
+		return
+	}
+
+	backups := lf.backups()
+	for len(backups) > lf.rotation.MaxBackups {
+		os.Remove(backups[0])
+		backups = backups[1:]
+	}
+}
@@ -0,0 +1,45 @@
+package logger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtsp-logger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "test.log")
+
+	lf, err := newFile(fpath, FileRotation{
+		MaxSize:    10,
+		MaxBackups: 2,
+		Compress:   true,
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		_, err = lf.Write([]byte("0123456789"))
+		require.NoError(t, err)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	lf.Close()
+
+	backups := lf.backups()
+	require.Equal(t, 2, len(backups))
+	for _, b := range backups {
+		require.Equal(t, true, strings.HasSuffix(b, ".gz"))
+	}
+
+	byts, err := ioutil.ReadFile(fpath)
+	require.NoError(t, err)
+	require.Equal(t, "0123456789", string(byts))
+}
@@ -0,0 +1,108 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"time"
+)
+
+type jsonEntry struct {
+	Time      string `json:"time"`
+	Level     string `json:"level"`
+	Component string `json:"component,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Session   string `json:"session,omitempty"`
+	Conn      string `json:"conn,omitempty"`
+	ClientIP  string `json:"clientIP,omitempty"`
+	Message   string `json:"message"`
+}
+
+func levelName(level Level) string {
+	switch level {
+	case Debug:
+		return "debug"
+
+	case Info:
+		return "info"
+
+	case Warn:
+		return "warn"
+	}
+	return "error"
+}
+
+// closingBracket returns the position of the bracket that closes the first one,
+// skipping nested brackets, like the ones of IPv6 addresses.
+func closingBracket(s string) int {
+	depth := 0
+	for i, c := range s {
+		switch c {
+		case '[':
+			depth++
+
+		case ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// fillContext moves the prefixes that are added by the various components
+// ("[RTSP] [conn 1.2.3.4:5678] [session 123] ...") into dedicated fields.
+func (e *jsonEntry) fillContext(content string) {
+	for strings.HasPrefix(content, "[") {
+		end := closingBracket(content)
+		if end < 0 {
+			break
+		}
+
+		label := content[1:end]
+		key, value := label, ""
+		if i := strings.Index(label, " "); i >= 0 {
+			key, value = label[:i], label[i+1:]
+		}
+
+		switch {
+		case key == "path" || key == "muxer":
+			e.Path = value
+
+		case key == "session":
+			e.Session = value
+
+		case key == "conn":
+			e.Conn = value
+			if host, _, err := net.SplitHostPort(value); err == nil {
+				e.ClientIP = host
+			}
+
+		case value == "source" || (value == "" && key != "c->s" && key != "s->c"):
+			// "[RTSP]", "[HLS]", "[rtsp source]", ...
+			e.Component = label
+
+		default:
+			e.Message = content
+			return
+		}
+
+		content = strings.TrimPrefix(content[end+1:], " ")
+	}
+
+	e.Message = content
+}
+
+func writeJSON(buf *bytes.Buffer, level Level, content string) {
+	e := jsonEntry{
+		Time:  time.Now().Format(time.RFC3339Nano),
+		Level: levelName(level),
+	}
+	e.fillContext(content)
+
+	byts, _ := json.Marshal(e)
+	buf.Write(byts)
+	buf.WriteByte('\n')
+}
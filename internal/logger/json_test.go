@@ -0,0 +1,59 @@
+package logger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONEntryFillContext(t *testing.T) {
+	for _, ca := range []struct {
+		name    string
+		content string
+		entry   jsonEntry
+	}{
+		{
+			"plain",
+			"rtsp-simple-server v0.0.0",
+			jsonEntry{
+				Message: "rtsp-simple-server v0.0.0",
+			},
+		},
+		{
+			"session",
+			"[RTSP] [conn 127.0.0.1:4567] [session 123456789] created by 127.0.0.1:4567",
+			jsonEntry{
+				Component: "RTSP",
+				Conn:      "127.0.0.1:4567",
+				ClientIP:  "127.0.0.1",
+				Session:   "123456789",
+				Message:   "created by 127.0.0.1:4567",
+			},
+		},
+		{
+			"source",
+			"[path cam1] [rtsp source] ready",
+			jsonEntry{
+				Component: "rtsp source",
+				Path:      "cam1",
+				Message:   "ready",
+			},
+		},
+		{
+			"dump",
+			"[API] [conn [::1]:4567] [c->s] GET / HTTP/1.1",
+			jsonEntry{
+				Component: "API",
+				Conn:      "[::1]:4567",
+				ClientIP:  "::1",
+				Message:   "[c->s] GET / HTTP/1.1",
+			},
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			var e jsonEntry
+			e.fillContext(ca.content)
+			require.Equal(t, ca.entry, e)
+		})
+	}
+}
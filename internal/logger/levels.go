@@ -0,0 +1,82 @@
+package logger
+
+import (
+	"regexp"
+	"strings"
+)
+
+// PathLevel is the log level of a path, or of all the paths
+// that match a regular expression.
+type PathLevel struct {
+	Name   string
+	Regexp *regexp.Regexp
+	Level  Level
+}
+
+// LevelOverrides contains log levels that replace the global one
+// for specific components or paths.
+type LevelOverrides struct {
+	// levels of components, keyed by their label in lowercase ("rtsp", "hls", "hikka", ...).
+	Components map[string]Level
+
+	// levels of paths. Paths with a name are checked before regular expressions.
+	Paths []PathLevel
+}
+
+func (o LevelOverrides) isEmpty() bool {
+	return len(o.Components) == 0 && len(o.Paths) == 0
+}
+
+// minLevel returns the lowest level between the default one and the overrides.
+func (o LevelOverrides) minLevel(def Level) Level {
+	ret := def
+	for _, l := range o.Components {
+		if l < ret {
+			ret = l
+		}
+	}
+	for _, pl := range o.Paths {
+		if pl.Level < ret {
+			ret = pl.Level
+		}
+	}
+	return ret
+}
+
+func (o LevelOverrides) pathLevel(name string) (Level, bool) {
+	for _, pl := range o.Paths {
+		if pl.Regexp == nil && pl.Name == name {
+			return pl.Level, true
+		}
+	}
+
+	for _, pl := range o.Paths {
+		if pl.Regexp != nil && pl.Regexp.MatchString(name) {
+			return pl.Level, true
+		}
+	}
+
+	return 0, false
+}
+
+// levelOf returns the level that applies to a log entry, given its content.
+// Component and path are extracted from the prefixes of the content,
+// with the path having the priority over the component.
+func (o LevelOverrides) levelOf(def Level, content string) Level {
+	var e jsonEntry
+	e.fillContext(content)
+
+	if e.Path != "" {
+		if l, ok := o.pathLevel(e.Path); ok {
+			return l
+		}
+	}
+
+	if e.Component != "" {
+		if l, ok := o.Components[strings.ToLower(e.Component)]; ok {
+			return l
+		}
+	}
+
+	return def
+}
@@ -0,0 +1,107 @@
+package logger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevelOverrides(t *testing.T) {
+	o := LevelOverrides{
+		Components: map[string]Level{
+			"hls":   Debug,
+			"hikka": Error,
+		},
+		Paths: []PathLevel{
+			{Regexp: regexp.MustCompile("^cam"), Level: Warn},
+			{Name: "cam1", Level: Debug},
+		},
+	}
+
+	require.Equal(t, Debug, o.minLevel(Info))
+
+	for _, ca := range []struct {
+		name    string
+		content string
+		level   Level
+	}{
+		{
+			"no prefix",
+			"rtsp-simple-server v0.0.0",
+			Info,
+		},
+		{
+			"component",
+			"[HLS] listener opened on :8888",
+			Debug,
+		},
+		{
+			"component lowercase",
+			"[hikka] listener opened on :9999",
+			Error,
+		},
+		{
+			"component without override",
+			"[RTSP] [conn 127.0.0.1:4567] opened",
+			Info,
+		},
+		{
+			"path name",
+			"[path cam1] [rtsp source] ready",
+			Debug,
+		},
+		{
+			"path regexp",
+			"[path cam2] [rtsp source] ready",
+			Warn,
+		},
+		{
+			"path has priority",
+			"[HLS] [muxer cam3] created automatically",
+			Warn,
+		},
+		{
+			"path without override",
+			"[HLS] [muxer other] created automatically",
+			Debug,
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			require.Equal(t, ca.level, o.levelOf(Info, ca.content))
+		})
+	}
+}
+
+func TestLoggerSetLevels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtsp-logger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "test.log")
+
+	lh, err := New(Info, LevelOverrides{}, FormatJSON,
+		map[Destination]struct{}{DestinationFile: {}}, fpath, FileRotation{}, "")
+	require.NoError(t, err)
+	defer lh.Close()
+
+	lh.Log(Debug, "[HLS] before")
+
+	overrides := LevelOverrides{Components: map[string]Level{"hls": Debug}}
+	lh.SetLevels(Warn, overrides)
+
+	level, cur := lh.Levels()
+	require.Equal(t, Warn, level)
+	require.Equal(t, overrides, cur)
+
+	lh.Log(Debug, "[HLS] after")
+	lh.Log(Info, "[RTSP] after")
+
+	byts, err := ioutil.ReadFile(fpath)
+	require.NoError(t, err)
+	require.Regexp(t, regexp.MustCompile(
+		`^\{[^\n]+"level":"debug","component":"HLS","message":"after"\}\n$`), string(byts))
+}
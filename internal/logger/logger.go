@@ -3,12 +3,13 @@ package logger
 import (
 	"bytes"
 	"fmt"
-	"io"
 	"os"
 	"sync"
 	"time"
 
 	"github.com/gookit/color"
+
+	"github.com/aler9/rtsp-simple-server/internal/redact"
 )
 
 // Level is a log level.
@@ -36,29 +37,58 @@ const (
 	DestinationSyslog
 )
 
+// Format is a log format.
+type Format int
+
+const (
+	// FormatPlain writes human-readable lines.
+	FormatPlain Format = iota
+
+	// FormatJSON writes a JSON object per line.
+	FormatJSON
+)
+
 // Logger is a log handler.
 type Logger struct {
-	level        Level
+	format       Format
 	destinations map[Destination]struct{}
 
+	levelsMutex sync.RWMutex
+	level       Level
+	overrides   LevelOverrides
+	minLevel    Level
+
 	mutex        sync.Mutex
-	file         *os.File
-	syslog       io.WriteCloser
+	file         *file
+	syslog       syslogWriter
 	stdoutBuffer bytes.Buffer
 	fileBuffer   bytes.Buffer
 	syslogBuffer bytes.Buffer
 }
 
 // New allocates a log handler.
-func New(level Level, destinations map[Destination]struct{}, filePath string) (*Logger, error) {
+// If syslogAddress is not empty, syslog messages are sent to a remote server
+// (udp://host:port or tcp://host:port) with the RFC5424 format.
+func New(
+	level Level,
+	overrides LevelOverrides,
+	format Format,
+	destinations map[Destination]struct{},
+	filePath string,
+	fileRotation FileRotation,
+	syslogAddress string,
+) (*Logger, error) {
 	lh := &Logger{
-		level:        level,
+		format:       format,
 		destinations: destinations,
+		level:        level,
+		overrides:    overrides,
+		minLevel:     overrides.minLevel(level),
 	}
 
 	if _, ok := destinations[DestinationFile]; ok {
 		var err error
-		lh.file, err = os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		lh.file, err = newFile(filePath, fileRotation)
 		if err != nil {
 			lh.Close()
 			return nil, err
@@ -67,7 +97,11 @@ func New(level Level, destinations map[Destination]struct{}, filePath string) (*
 
 	if _, ok := destinations[DestinationSyslog]; ok {
 		var err error
-		lh.syslog, err = newSyslog("rtsp-simple-server")
+		if syslogAddress != "" {
+			lh.syslog, err = newSyslogRemote(syslogAddress, "rtsp-simple-server")
+		} else {
+			lh.syslog, err = newSyslog("rtsp-simple-server")
+		}
 		if err != nil {
 			lh.Close()
 			return nil, err
@@ -88,6 +122,23 @@ func (lh *Logger) Close() {
 	}
 }
 
+// Levels returns the global log level and its overrides.
+func (lh *Logger) Levels() (Level, LevelOverrides) {
+	lh.levelsMutex.RLock()
+	defer lh.levelsMutex.RUnlock()
+	return lh.level, lh.overrides
+}
+
+// SetLevels replaces the global log level and its overrides
+// without interrupting the log handler.
+func (lh *Logger) SetLevels(level Level, overrides LevelOverrides) {
+	lh.levelsMutex.Lock()
+	defer lh.levelsMutex.Unlock()
+	lh.level = level
+	lh.overrides = overrides
+	lh.minLevel = overrides.minLevel(level)
+}
+
 // https://golang.org/src/log/log.go#L78
 func itoa(i int, wid int) []byte {
 	// Assemble decimal in reverse order.
@@ -167,25 +218,48 @@ func writeLevel(buf *bytes.Buffer, level Level, doColor bool) {
 	buf.WriteByte(' ')
 }
 
-func writeContent(buf *bytes.Buffer, format string, args []interface{}) {
-	buf.Write([]byte(fmt.Sprintf(format, args...)))
+func writeContent(buf *bytes.Buffer, content string) {
+	buf.WriteString(content)
 	buf.WriteByte('\n')
 }
 
 // Log writes a log entry.
 func (lh *Logger) Log(level Level, format string, args ...interface{}) {
-	if level < lh.level {
+	lh.levelsMutex.RLock()
+	defLevel, overrides, minLevel := lh.level, lh.overrides, lh.minLevel
+	lh.levelsMutex.RUnlock()
+
+	if level < minLevel {
+		return
+	}
+
+	content := fmt.Sprintf(format, args...)
+
+	if !overrides.isEmpty() {
+		if level < overrides.levelOf(defLevel, content) {
+			return
+		}
+	} else if level < defLevel {
 		return
 	}
 
+	content = redact.Text(content)
+
 	lh.mutex.Lock()
 	defer lh.mutex.Unlock()
 
+	if lh.format == FormatJSON {
+		lh.stdoutBuffer.Reset()
+		writeJSON(&lh.stdoutBuffer, level, content)
+		lh.write(level, lh.stdoutBuffer.Bytes())
+		return
+	}
+
 	if _, ok := lh.destinations[DestinationStdout]; ok {
 		lh.stdoutBuffer.Reset()
 		writeTime(&lh.stdoutBuffer, true)
 		writeLevel(&lh.stdoutBuffer, level, true)
-		writeContent(&lh.stdoutBuffer, format, args)
+		writeContent(&lh.stdoutBuffer, content)
 		print(lh.stdoutBuffer.String())
 	}
 
@@ -193,7 +267,7 @@ func (lh *Logger) Log(level Level, format string, args ...interface{}) {
 		lh.fileBuffer.Reset()
 		writeTime(&lh.fileBuffer, false)
 		writeLevel(&lh.fileBuffer, level, false)
-		writeContent(&lh.fileBuffer, format, args)
+		writeContent(&lh.fileBuffer, content)
 		lh.file.Write(lh.fileBuffer.Bytes())
 	}
 
@@ -201,7 +275,21 @@ func (lh *Logger) Log(level Level, format string, args ...interface{}) {
 		lh.syslogBuffer.Reset()
 		writeTime(&lh.syslogBuffer, false)
 		writeLevel(&lh.syslogBuffer, level, false)
-		writeContent(&lh.syslogBuffer, format, args)
-		lh.syslog.Write(lh.syslogBuffer.Bytes())
+		writeContent(&lh.syslogBuffer, content)
+		lh.syslog.Write(level, lh.syslogBuffer.Bytes())
+	}
+}
+
+func (lh *Logger) write(level Level, byts []byte) {
+	if _, ok := lh.destinations[DestinationStdout]; ok {
+		os.Stdout.Write(byts)
+	}
+
+	if _, ok := lh.destinations[DestinationFile]; ok {
+		lh.file.Write(byts)
+	}
+
+	if _, ok := lh.destinations[DestinationSyslog]; ok {
+		lh.syslog.Write(level, byts)
 	}
 }
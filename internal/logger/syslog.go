@@ -0,0 +1,139 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+type syslogWriter interface {
+	Write(level Level, p []byte) error
+	Close() error
+}
+
+// syslog facility "daemon".
+const syslogFacility = 3
+
+func syslogSeverity(level Level) int {
+	switch level {
+	case Debug:
+		return 7
+
+	case Info:
+		return 6
+
+	case Warn:
+		return 4
+	}
+	return 3
+}
+
+// syslogRemote sends messages to a remote syslog server with the RFC5424 format.
+type syslogRemote struct {
+	network  string
+	address  string
+	appName  string
+	hostname string
+	procID   string
+
+	conn net.Conn
+	buf  bytes.Buffer
+}
+
+func newSyslogRemote(address string, appName string) (syslogWriter, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "udp" && u.Scheme != "tcp" {
+		return nil, fmt.Errorf("unsupported syslog protocol: %s", u.Scheme)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	ls := &syslogRemote{
+		network:  u.Scheme,
+		address:  u.Host,
+		appName:  appName,
+		hostname: hostname,
+		procID:   strconv.FormatInt(int64(os.Getpid()), 10),
+	}
+
+	err = ls.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	return ls, nil
+}
+
+func (ls *syslogRemote) connect() error {
+	conn, err := net.DialTimeout(ls.network, ls.address, 5*time.Second)
+	if err != nil {
+		return err
+	}
+
+	ls.conn = conn
+	return nil
+}
+
+func (ls *syslogRemote) Close() error {
+	if ls.conn != nil {
+		return ls.conn.Close()
+	}
+	return nil
+}
+
+func (ls *syslogRemote) encode(level Level, now time.Time, p []byte) []byte {
+	p = bytes.TrimRight(p, "\n")
+
+	// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+	msg := fmt.Sprintf("<%d>1 %s %s %s %s - - ",
+		syslogFacility*8+syslogSeverity(level),
+		now.Format(time.RFC3339Nano),
+		ls.hostname,
+		ls.appName,
+		ls.procID)
+
+	ls.buf.Reset()
+
+	// RFC6587 octet counting is needed to delimit messages on TCP
+	if ls.network == "tcp" {
+		ls.buf.WriteString(strconv.FormatInt(int64(len(msg)+len(p)), 10))
+		ls.buf.WriteByte(' ')
+	}
+
+	ls.buf.WriteString(msg)
+	ls.buf.Write(p)
+	return ls.buf.Bytes()
+}
+
+func (ls *syslogRemote) Write(level Level, p []byte) error {
+	byts := ls.encode(level, time.Now(), p)
+
+	if ls.conn == nil {
+		err := ls.connect()
+		if err != nil {
+			return err
+		}
+	}
+
+	ls.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, err := ls.conn.Write(byts)
+	if err != nil {
+		// try to reconnect on the next message
+		ls.conn.Close()
+		ls.conn = nil
+		return err
+	}
+
+	return nil
+}
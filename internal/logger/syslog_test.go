@@ -0,0 +1,68 @@
+package logger
+
+import (
+	"net"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyslogRemote(t *testing.T) {
+	for _, ca := range []string{"udp", "tcp"} {
+		t.Run(ca, func(t *testing.T) {
+			var addr string
+			recv := make(chan []byte)
+
+			if ca == "udp" {
+				pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+				require.NoError(t, err)
+				defer pc.Close()
+				addr = pc.LocalAddr().String()
+
+				go func() {
+					buf := make([]byte, 2048)
+					n, _, err := pc.ReadFrom(buf)
+					if err == nil {
+						recv <- buf[:n]
+					}
+				}()
+			} else {
+				l, err := net.Listen("tcp", "127.0.0.1:0")
+				require.NoError(t, err)
+				defer l.Close()
+				addr = l.Addr().String()
+
+				go func() {
+					conn, err := l.Accept()
+					if err != nil {
+						return
+					}
+					defer conn.Close()
+
+					buf := make([]byte, 2048)
+					n, err := conn.Read(buf)
+					if err == nil {
+						recv <- buf[:n]
+					}
+				}()
+			}
+
+			lh, err := New(Info, LevelOverrides{}, FormatPlain,
+				map[Destination]struct{}{DestinationSyslog: {}}, "", FileRotation{}, ca+"://"+addr)
+			require.NoError(t, err)
+			defer lh.Close()
+
+			lh.Log(Warn, "test %d", 1)
+
+			msg := string(<-recv)
+
+			prefix := ""
+			if ca == "tcp" {
+				prefix = `[0-9]+ `
+			}
+			require.Regexp(t, regexp.MustCompile(
+				`^`+prefix+`<28>1 [^ ]+ [^ ]+ rtsp-simple-server [0-9]+ - - [0-9/]+ [0-9:]+ WAR test 1$`), msg)
+		})
+	}
+}
@@ -4,7 +4,6 @@
 package logger
 
 import (
-	"io"
 	native "log/syslog"
 )
 
@@ -12,7 +11,7 @@ type syslog struct {
 	inner *native.Writer
 }
 
-func newSyslog(prefix string) (io.WriteCloser, error) {
+func newSyslog(prefix string) (syslogWriter, error) {
 	inner, err := native.New(native.LOG_INFO|native.LOG_DAEMON, prefix)
 	if err != nil {
 		return nil, err
@@ -27,6 +26,16 @@ func (ls *syslog) Close() error {
 	return ls.inner.Close()
 }
 
-func (ls *syslog) Write(p []byte) (int, error) {
-	return ls.inner.Write(p)
+func (ls *syslog) Write(level Level, p []byte) error {
+	switch level {
+	case Debug:
+		return ls.inner.Debug(string(p))
+
+	case Info:
+		return ls.inner.Info(string(p))
+
+	case Warn:
+		return ls.inner.Warning(string(p))
+	}
+	return ls.inner.Err(string(p))
 }
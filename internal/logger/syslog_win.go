@@ -4,10 +4,36 @@
 package logger
 
 import (
-	"fmt"
-	"io"
+	"golang.org/x/sys/windows/svc/eventlog"
 )
 
-func newSyslog(prefix string) (io.WriteCloser, error) {
-	return nil, fmt.Errorf("not implemented on windows")
+// on Windows, the local system logger is the event log.
+type syslog struct {
+	inner *eventlog.Log
+}
+
+func newSyslog(prefix string) (syslogWriter, error) {
+	inner, err := eventlog.Open(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &syslog{
+		inner: inner,
+	}, nil
+}
+
+func (ls *syslog) Close() error {
+	return ls.inner.Close()
+}
+
+func (ls *syslog) Write(level Level, p []byte) error {
+	switch level {
+	case Debug, Info:
+		return ls.inner.Info(1, string(p))
+
+	case Warn:
+		return ls.inner.Warning(1, string(p))
+	}
+	return ls.inner.Error(1, string(p))
 }
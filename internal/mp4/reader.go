@@ -0,0 +1,671 @@
+// Package mp4 contains a MP4 demuxer, that reads H264 and AAC tracks
+// of non-fragmented files.
+package mp4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Codec is the codec of a track.
+type Codec int
+
+// supported codecs.
+const (
+	CodecH264 Codec = iota
+	CodecAAC
+)
+
+// Sample is a sample of a track.
+type Sample struct {
+	Offset int64
+	Size   uint32
+	// decoding timestamp, in units of the track time scale.
+	DTS uint64
+	// difference between presentation timestamp and decoding timestamp.
+	PTSOffset int32
+	IsSync    bool
+}
+
+// Track is a track of a file.
+type Track struct {
+	ID        uint32
+	Codec     Codec
+	TimeScale uint32
+	// duration, in units of the track time scale.
+	Duration uint64
+
+	// H264 parameters.
+	SPS            []byte
+	PPS            []byte
+	NALULengthSize int
+
+	// AAC parameters (AudioSpecificConfig).
+	AACConfig []byte
+
+	Samples []Sample
+}
+
+// Reader is a MP4 reader.
+type Reader struct {
+	r io.ReaderAt
+
+	// tracks with a supported codec. Other tracks are ignored.
+	Tracks []*Track
+}
+
+// NewReader allocates a Reader and reads the index of the file.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	var moov []byte
+
+	pos := int64(0)
+	for pos < size {
+		var hdr [16]byte
+		_, err := r.ReadAt(hdr[:8], pos)
+		if err != nil {
+			return nil, err
+		}
+
+		boxSize := int64(binary.BigEndian.Uint32(hdr[:4]))
+		typ := string(hdr[4:8])
+		hdrSize := int64(8)
+
+		switch boxSize {
+		case 0:
+			boxSize = size - pos
+		case 1:
+			_, err := r.ReadAt(hdr[8:16], pos+8)
+			if err != nil {
+				return nil, err
+			}
+			boxSize = int64(binary.BigEndian.Uint64(hdr[8:16]))
+			hdrSize = 16
+		}
+
+		if boxSize < hdrSize || pos+boxSize > size {
+			return nil, fmt.Errorf("invalid size of box '%s'", typ)
+		}
+
+		switch typ {
+		case "moov":
+			moov = make([]byte, boxSize-hdrSize)
+			_, err := r.ReadAt(moov, pos+hdrSize)
+			if err != nil {
+				return nil, err
+			}
+
+		case "moof":
+			return nil, fmt.Errorf("fragmented files are not supported")
+		}
+
+		pos += boxSize
+	}
+
+	if moov == nil {
+		return nil, fmt.Errorf("moov box not found")
+	}
+
+	rd := &Reader{r: r}
+
+	err := forEachBox(moov, func(typ string, payload []byte) error {
+		if typ != "trak" {
+			return nil
+		}
+
+		track, err := parseTrak(payload)
+		if err != nil {
+			return err
+		}
+
+		if track != nil {
+			rd.Tracks = append(rd.Tracks, track)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rd.Tracks) == 0 {
+		return nil, fmt.Errorf("the file doesn't contain any H264 or AAC track")
+	}
+
+	return rd, nil
+}
+
+// ReadSample reads the content of a sample.
+func (rd *Reader) ReadSample(s *Sample) ([]byte, error) {
+	buf := make([]byte, s.Size)
+	_, err := rd.r.ReadAt(buf, s.Offset)
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// forEachBox calls cb for each box contained in buf.
+func forEachBox(buf []byte, cb func(typ string, payload []byte) error) error {
+	for len(buf) != 0 {
+		if len(buf) < 8 {
+			return fmt.Errorf("invalid box")
+		}
+
+		size := uint64(binary.BigEndian.Uint32(buf[:4]))
+		typ := string(buf[4:8])
+		hdrSize := uint64(8)
+
+		switch size {
+		case 0:
+			size = uint64(len(buf))
+		case 1:
+			if len(buf) < 16 {
+				return fmt.Errorf("invalid box")
+			}
+			size = binary.BigEndian.Uint64(buf[8:16])
+			hdrSize = 16
+		}
+
+		if size < hdrSize || size > uint64(len(buf)) {
+			return fmt.Errorf("invalid size of box '%s'", typ)
+		}
+
+		err := cb(typ, buf[hdrSize:size])
+		if err != nil {
+			return err
+		}
+
+		buf = buf[size:]
+	}
+
+	return nil
+}
+
+// fullBox returns the payload of a box with version and flags.
+func fullBox(typ string, payload []byte, minSize int) (byte, []byte, error) {
+	if len(payload) < 4+minSize {
+		return 0, nil, fmt.Errorf("invalid box '%s'", typ)
+	}
+	return payload[0], payload[4:], nil
+}
+
+type sampleTables struct {
+	stts []byte
+	ctts []byte
+	stss []byte
+	stsz []byte
+	stsc []byte
+	stco []byte
+	co64 []byte
+}
+
+// parseTrak parses a track. It returns nil if the codec is not supported.
+func parseTrak(buf []byte) (*Track, error) {
+	track := &Track{}
+	var handler string
+	var stsd []byte
+	var tables sampleTables
+
+	var parse func(typ string, payload []byte) error
+	parse = func(typ string, payload []byte) error {
+		switch typ {
+		case "mdia", "minf", "stbl":
+			return forEachBox(payload, parse)
+
+		case "tkhd":
+			version, body, err := fullBox(typ, payload, 12)
+			if err != nil {
+				return err
+			}
+			if version == 1 {
+				if len(body) < 20 {
+					return fmt.Errorf("invalid box 'tkhd'")
+				}
+				track.ID = binary.BigEndian.Uint32(body[16:20])
+			} else {
+				track.ID = binary.BigEndian.Uint32(body[8:12])
+			}
+
+		case "mdhd":
+			version, body, err := fullBox(typ, payload, 16)
+			if err != nil {
+				return err
+			}
+			if version == 1 {
+				if len(body) < 28 {
+					return fmt.Errorf("invalid box 'mdhd'")
+				}
+				track.TimeScale = binary.BigEndian.Uint32(body[16:20])
+				track.Duration = binary.BigEndian.Uint64(body[20:28])
+			} else {
+				track.TimeScale = binary.BigEndian.Uint32(body[8:12])
+				track.Duration = uint64(binary.BigEndian.Uint32(body[12:16]))
+			}
+
+		case "hdlr":
+			_, body, err := fullBox(typ, payload, 8)
+			if err != nil {
+				return err
+			}
+			handler = string(body[4:8])
+
+		case "stsd":
+			stsd = payload
+
+		case "stts":
+			tables.stts = payload
+		case "ctts":
+			tables.ctts = payload
+		case "stss":
+			tables.stss = payload
+		case "stsz":
+			tables.stsz = payload
+		case "stsc":
+			tables.stsc = payload
+		case "stco":
+			tables.stco = payload
+		case "co64":
+			tables.co64 = payload
+		}
+
+		return nil
+	}
+
+	err := forEachBox(buf, parse)
+	if err != nil {
+		return nil, err
+	}
+
+	if (handler != "vide" && handler != "soun") || stsd == nil {
+		return nil, nil
+	}
+
+	if track.TimeScale == 0 {
+		return nil, fmt.Errorf("invalid time scale")
+	}
+
+	ok, err := parseStsd(track, stsd)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	err = track.fillSamples(&tables)
+	if err != nil {
+		return nil, err
+	}
+
+	return track, nil
+}
+
+// parseStsd parses the sample description. It returns false if the codec is not supported.
+func parseStsd(track *Track, payload []byte) (bool, error) {
+	_, body, err := fullBox("stsd", payload, 4)
+	if err != nil {
+		return false, err
+	}
+
+	found := false
+
+	err = forEachBox(body[4:], func(typ string, entry []byte) error {
+		if found {
+			return nil
+		}
+
+		switch typ {
+		case "avc1", "avc3":
+			// size of the visual sample entry
+			if len(entry) < 78 {
+				return fmt.Errorf("invalid box '%s'", typ)
+			}
+
+			return forEachBox(entry[78:], func(typ string, payload []byte) error {
+				if typ != "avcC" {
+					return nil
+				}
+
+				err := parseAvcC(track, payload)
+				if err != nil {
+					return err
+				}
+
+				track.Codec = CodecH264
+				found = true
+				return nil
+			})
+
+		case "mp4a":
+			// size of the audio sample entry
+			if len(entry) < 28 {
+				return fmt.Errorf("invalid box 'mp4a'")
+			}
+
+			return forEachBox(entry[28:], func(typ string, payload []byte) error {
+				if typ != "esds" {
+					return nil
+				}
+
+				config, err := parseEsds(payload)
+				if err != nil {
+					return err
+				}
+
+				track.AACConfig = config
+				track.Codec = CodecAAC
+				found = true
+				return nil
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return found, nil
+}
+
+func parseAvcC(track *Track, buf []byte) error {
+	if len(buf) < 7 {
+		return fmt.Errorf("invalid box 'avcC'")
+	}
+
+	track.NALULengthSize = int(buf[4]&0x03) + 1
+
+	readParams := func(buf []byte, count int) ([]byte, []byte, error) {
+		var first []byte
+		for i := 0; i < count; i++ {
+			if len(buf) < 2 {
+				return nil, nil, fmt.Errorf("invalid box 'avcC'")
+			}
+			l := int(binary.BigEndian.Uint16(buf[:2]))
+			if len(buf) < 2+l {
+				return nil, nil, fmt.Errorf("invalid box 'avcC'")
+			}
+			if first == nil {
+				first = buf[2 : 2+l]
+			}
+			buf = buf[2+l:]
+		}
+		return first, buf, nil
+	}
+
+	sps, rest, err := readParams(buf[6:], int(buf[5]&0x1F))
+	if err != nil {
+		return err
+	}
+
+	if len(rest) < 1 {
+		return fmt.Errorf("invalid box 'avcC'")
+	}
+
+	pps, _, err := readParams(rest[1:], int(rest[0]))
+	if err != nil {
+		return err
+	}
+
+	if sps == nil || pps == nil {
+		return fmt.Errorf("SPS or PPS not found")
+	}
+
+	track.SPS = sps
+	track.PPS = pps
+	return nil
+}
+
+// readDescriptor reads a descriptor of an ES_Descriptor.
+func readDescriptor(buf []byte) (byte, []byte, []byte, error) {
+	if len(buf) < 2 {
+		return 0, nil, nil, fmt.Errorf("invalid descriptor")
+	}
+
+	tag := buf[0]
+	buf = buf[1:]
+
+	// the length is encoded with up to 4 bytes, 7 bits each
+	l := 0
+	for i := 0; i < 4; i++ {
+		if len(buf) == 0 {
+			return 0, nil, nil, fmt.Errorf("invalid descriptor")
+		}
+		b := buf[0]
+		buf = buf[1:]
+		l = (l << 7) | int(b&0x7F)
+		if (b & 0x80) == 0 {
+			break
+		}
+	}
+
+	if len(buf) < l {
+		return 0, nil, nil, fmt.Errorf("invalid descriptor")
+	}
+
+	return tag, buf[:l], buf[l:], nil
+}
+
+func parseEsds(payload []byte) ([]byte, error) {
+	_, body, err := fullBox("esds", payload, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	tag, es, _, err := readDescriptor(body)
+	if err != nil {
+		return nil, err
+	}
+	if tag != 0x03 || len(es) < 3 {
+		return nil, fmt.Errorf("ES descriptor not found")
+	}
+
+	flags := es[2]
+	es = es[3:]
+	if (flags & 0x80) != 0 { // streamDependenceFlag
+		if len(es) < 2 {
+			return nil, fmt.Errorf("invalid ES descriptor")
+		}
+		es = es[2:]
+	}
+	if (flags & 0x40) != 0 { // URL_Flag
+		if len(es) < 1 || len(es) < 1+int(es[0]) {
+			return nil, fmt.Errorf("invalid ES descriptor")
+		}
+		es = es[1+int(es[0]):]
+	}
+	if (flags & 0x20) != 0 { // OCRstreamFlag
+		if len(es) < 2 {
+			return nil, fmt.Errorf("invalid ES descriptor")
+		}
+		es = es[2:]
+	}
+
+	tag, dc, _, err := readDescriptor(es)
+	if err != nil {
+		return nil, err
+	}
+	if tag != 0x04 || len(dc) < 13 {
+		return nil, fmt.Errorf("decoder config descriptor not found")
+	}
+
+	// MPEG-4 audio
+	if dc[0] != 0x40 {
+		return nil, fmt.Errorf("unsupported audio codec: 0x%x", dc[0])
+	}
+
+	tag, dsi, _, err := readDescriptor(dc[13:])
+	if err != nil {
+		return nil, err
+	}
+	if tag != 0x05 {
+		return nil, fmt.Errorf("decoder specific info not found")
+	}
+
+	return dsi, nil
+}
+
+// fillSamples builds the sample list from the sample tables.
+func (track *Track) fillSamples(t *sampleTables) error {
+	if t.stsz == nil || t.stts == nil || t.stsc == nil || (t.stco == nil && t.co64 == nil) {
+		return fmt.Errorf("sample tables not found")
+	}
+
+	// sizes
+	_, body, err := fullBox("stsz", t.stsz, 8)
+	if err != nil {
+		return err
+	}
+	fixedSize := binary.BigEndian.Uint32(body[0:4])
+	count := int(binary.BigEndian.Uint32(body[4:8]))
+	if fixedSize == 0 && len(body) < 8+count*4 {
+		return fmt.Errorf("invalid box 'stsz'")
+	}
+
+	track.Samples = make([]Sample, count)
+	for i := range track.Samples {
+		if fixedSize != 0 {
+			track.Samples[i].Size = fixedSize
+		} else {
+			track.Samples[i].Size = binary.BigEndian.Uint32(body[8+i*4:])
+		}
+	}
+
+	// decoding timestamps
+	_, body, err = fullBox("stts", t.stts, 4)
+	if err != nil {
+		return err
+	}
+	entries := int(binary.BigEndian.Uint32(body[0:4]))
+	if len(body) < 4+entries*8 {
+		return fmt.Errorf("invalid box 'stts'")
+	}
+	i := 0
+	dts := uint64(0)
+	for e := 0; e < entries; e++ {
+		n := int(binary.BigEndian.Uint32(body[4+e*8:]))
+		delta := uint64(binary.BigEndian.Uint32(body[8+e*8:]))
+		for j := 0; j < n && i < count; j++ {
+			track.Samples[i].DTS = dts
+			dts += delta
+			i++
+		}
+	}
+
+	// presentation timestamp offsets
+	if t.ctts != nil {
+		_, body, err = fullBox("ctts", t.ctts, 4)
+		if err != nil {
+			return err
+		}
+		entries = int(binary.BigEndian.Uint32(body[0:4]))
+		if len(body) < 4+entries*8 {
+			return fmt.Errorf("invalid box 'ctts'")
+		}
+		i = 0
+		for e := 0; e < entries; e++ {
+			n := int(binary.BigEndian.Uint32(body[4+e*8:]))
+			offset := int32(binary.BigEndian.Uint32(body[8+e*8:]))
+			for j := 0; j < n && i < count; j++ {
+				track.Samples[i].PTSOffset = offset
+				i++
+			}
+		}
+	}
+
+	// sync samples. When the table is not present, all samples are sync samples.
+	if t.stss != nil {
+		_, body, err = fullBox("stss", t.stss, 4)
+		if err != nil {
+			return err
+		}
+		entries = int(binary.BigEndian.Uint32(body[0:4]))
+		if len(body) < 4+entries*4 {
+			return fmt.Errorf("invalid box 'stss'")
+		}
+		for e := 0; e < entries; e++ {
+			n := int(binary.BigEndian.Uint32(body[4+e*4:]))
+			if n >= 1 && n <= count {
+				track.Samples[n-1].IsSync = true
+			}
+		}
+	} else {
+		for i := range track.Samples {
+			track.Samples[i].IsSync = true
+		}
+	}
+
+	// chunk offsets
+	var chunkOffsets []int64
+	if t.stco != nil {
+		_, body, err = fullBox("stco", t.stco, 4)
+		if err != nil {
+			return err
+		}
+		entries = int(binary.BigEndian.Uint32(body[0:4]))
+		if len(body) < 4+entries*4 {
+			return fmt.Errorf("invalid box 'stco'")
+		}
+		chunkOffsets = make([]int64, entries)
+		for e := range chunkOffsets {
+			chunkOffsets[e] = int64(binary.BigEndian.Uint32(body[4+e*4:]))
+		}
+	} else {
+		_, body, err = fullBox("co64", t.co64, 4)
+		if err != nil {
+			return err
+		}
+		entries = int(binary.BigEndian.Uint32(body[0:4]))
+		if len(body) < 4+entries*8 {
+			return fmt.Errorf("invalid box 'co64'")
+		}
+		chunkOffsets = make([]int64, entries)
+		for e := range chunkOffsets {
+			chunkOffsets[e] = int64(binary.BigEndian.Uint64(body[4+e*8:]))
+		}
+	}
+
+	// samples per chunk
+	_, body, err = fullBox("stsc", t.stsc, 4)
+	if err != nil {
+		return err
+	}
+	entries = int(binary.BigEndian.Uint32(body[0:4]))
+	if len(body) < 4+entries*12 {
+		return fmt.Errorf("invalid box 'stsc'")
+	}
+
+	i = 0
+	for e := 0; e < entries; e++ {
+		firstChunk := int(binary.BigEndian.Uint32(body[4+e*12:]))
+		samplesPerChunk := int(binary.BigEndian.Uint32(body[8+e*12:]))
+
+		lastChunk := len(chunkOffsets)
+		if e+1 < entries {
+			lastChunk = int(binary.BigEndian.Uint32(body[4+(e+1)*12:])) - 1
+		}
+
+		if firstChunk < 1 || lastChunk > len(chunkOffsets) {
+			return fmt.Errorf("invalid box 'stsc'")
+		}
+
+		for c := firstChunk; c <= lastChunk; c++ {
+			offset := chunkOffsets[c-1]
+			for j := 0; j < samplesPerChunk && i < count; j++ {
+				track.Samples[i].Offset = offset
+				offset += int64(track.Samples[i].Size)
+				i++
+			}
+		}
+	}
+
+	if i != count {
+		return fmt.Errorf("sample tables are inconsistent")
+	}
+
+	if track.Duration == 0 {
+		track.Duration = dts
+	}
+
+	return nil
+}
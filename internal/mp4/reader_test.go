@@ -0,0 +1,168 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func box(typ string, payload ...[]byte) []byte {
+	cnt := bytes.Join(payload, nil)
+	buf := make([]byte, 8, 8+len(cnt))
+	binary.BigEndian.PutUint32(buf, uint32(8+len(cnt)))
+	copy(buf[4:], typ)
+	return append(buf, cnt...)
+}
+
+func fullBoxPayload(version byte, fields ...uint32) []byte {
+	buf := []byte{version, 0, 0, 0}
+	for _, f := range fields {
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], f)
+		buf = append(buf, b[:]...)
+	}
+	return buf
+}
+
+func testTrak(id uint32, handler string, timeScale uint32, duration uint32, entry []byte, tables ...[]byte) []byte {
+	tkhd := fullBoxPayload(0, 0, 0, id, 0, duration)
+	mdhd := fullBoxPayload(0, 0, 0, timeScale, duration, 0)
+	hdlr := append(fullBoxPayload(0, 0), []byte(handler+"\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")...)
+	stsd := append(fullBoxPayload(0, 1), entry...)
+
+	return box("trak",
+		box("tkhd", tkhd),
+		box("mdia",
+			box("mdhd", mdhd),
+			box("hdlr", hdlr),
+			box("minf",
+				box("stbl", append([][]byte{box("stsd", stsd)}, tables...)...))))
+}
+
+func testFile() ([]byte, int) {
+	ftyp := box("ftyp", []byte("isom\x00\x00\x02\x00isomavc1"))
+
+	videoSamples := [][]byte{
+		{0, 0, 0, 2, 0x65, 0x01},
+		{0, 0, 0, 2, 0x41, 0x02},
+		{0, 0, 0, 2, 0x41, 0x03},
+	}
+	audioSamples := [][]byte{
+		{0x21, 0x10},
+		{0x21, 0x20},
+	}
+
+	mdatPayload := bytes.Join(append(videoSamples, audioSamples...), nil)
+	mdat := box("mdat", mdatPayload)
+	mdatStart := len(ftyp) + 8
+
+	avcC := []byte{
+		1, 0x64, 0, 0x1f, 0xff,
+		0xe1, 0, 4, 0x67, 0x64, 0x00, 0x1f,
+		1, 0, 2, 0x68, 0xee,
+	}
+	avc1 := box("avc1", make([]byte, 78), box("avcC", avcC))
+
+	esds := append(fullBoxPayload(0),
+		0x03, 0x19, 0, 1, 0,
+		0x04, 0x11, 0x40, 0x15, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0x05, 0x02, 0x12, 0x10,
+		0x06, 0x01, 0x02)
+	mp4a := box("mp4a", make([]byte, 28), box("esds", esds))
+
+	videoTrak := testTrak(1, "vide", 90000, 9000, avc1,
+		box("stts", fullBoxPayload(0, 1, 3, 3000)),
+		box("ctts", fullBoxPayload(0, 1, 3, 6000)),
+		box("stss", fullBoxPayload(0, 1, 1)),
+		box("stsz", fullBoxPayload(0, 6, 3)),
+		box("stsc", fullBoxPayload(0, 2, 1, 2, 1, 2, 1, 1)),
+		box("stco", fullBoxPayload(0, 2, uint32(mdatStart), uint32(mdatStart+12))))
+
+	co64 := append(fullBoxPayload(0, 1), make([]byte, 8)...)
+	binary.BigEndian.PutUint64(co64[8:], uint64(mdatStart+18))
+
+	audioTrak := testTrak(2, "soun", 44100, 2048, mp4a,
+		box("stts", fullBoxPayload(0, 1, 2, 1024)),
+		box("stsz", fullBoxPayload(0, 0, 2, 2, 2)),
+		box("stsc", fullBoxPayload(0, 1, 1, 2, 1)),
+		box("co64", co64))
+
+	moov := box("moov", box("mvhd", fullBoxPayload(0, 0, 0, 1000, 100)), videoTrak, audioTrak)
+
+	return bytes.Join([][]byte{ftyp, mdat, moov}, nil), mdatStart
+}
+
+func TestReader(t *testing.T) {
+	byts, mdatStart := testFile()
+
+	rd, err := NewReader(bytes.NewReader(byts), int64(len(byts)))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(rd.Tracks))
+
+	video := rd.Tracks[0]
+	require.Equal(t, uint32(1), video.ID)
+	require.Equal(t, CodecH264, video.Codec)
+	require.Equal(t, uint32(90000), video.TimeScale)
+	require.Equal(t, uint64(9000), video.Duration)
+	require.Equal(t, []byte{0x67, 0x64, 0x00, 0x1f}, video.SPS)
+	require.Equal(t, []byte{0x68, 0xee}, video.PPS)
+	require.Equal(t, 4, video.NALULengthSize)
+	require.Equal(t, []Sample{
+		{Offset: int64(mdatStart), Size: 6, DTS: 0, PTSOffset: 6000, IsSync: true},
+		{Offset: int64(mdatStart + 6), Size: 6, DTS: 3000, PTSOffset: 6000},
+		{Offset: int64(mdatStart + 12), Size: 6, DTS: 6000, PTSOffset: 6000},
+	}, video.Samples)
+
+	audio := rd.Tracks[1]
+	require.Equal(t, uint32(2), audio.ID)
+	require.Equal(t, CodecAAC, audio.Codec)
+	require.Equal(t, []byte{0x12, 0x10}, audio.AACConfig)
+	require.Equal(t, []Sample{
+		{Offset: int64(mdatStart + 18), Size: 2, DTS: 0, IsSync: true},
+		{Offset: int64(mdatStart + 20), Size: 2, DTS: 1024, IsSync: true},
+	}, audio.Samples)
+
+	buf, err := rd.ReadSample(&video.Samples[1])
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 0, 0, 2, 0x41, 0x02}, buf)
+
+	buf, err = rd.ReadSample(&audio.Samples[1])
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x21, 0x20}, buf)
+}
+
+func TestReaderErrors(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		byts []byte
+		err  string
+	}{
+		{
+			"no moov",
+			box("ftyp", []byte("isom")),
+			"moov box not found",
+		},
+		{
+			"fragmented",
+			bytes.Join([][]byte{box("moov"), box("moof")}, nil),
+			"fragmented files are not supported",
+		},
+		{
+			"no tracks",
+			box("moov", box("mvhd", fullBoxPayload(0))),
+			"the file doesn't contain any H264 or AAC track",
+		},
+		{
+			"invalid size",
+			[]byte{0, 0, 0, 100, 'm', 'o', 'o', 'v'},
+			"invalid size of box 'moov'",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			_, err := NewReader(bytes.NewReader(ca.byts), int64(len(ca.byts)))
+			require.EqualError(t, err, ca.err)
+		})
+	}
+}
@@ -0,0 +1,279 @@
+// Package mpegts contains a MPEG-TS writer that produces a continuous stream,
+// that can be read by clients that don't support segmented streams.
+package mpegts
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/aler9/gortsplib/pkg/aac"
+	"github.com/aler9/gortsplib/pkg/h264"
+	"github.com/asticode/go-astits"
+)
+
+const (
+	// an offset between PCR and PTS/DTS is needed to avoid PCR > PTS
+	pcrOffset = 500 * time.Millisecond
+
+	videoPID = 256
+	audioPID = 257
+)
+
+// Writer is a MPEG-TS writer.
+type Writer struct {
+	w          io.Writer
+	videoTrack *gortsplib.Track
+	audioTrack *gortsplib.Track
+	h264Conf   *gortsplib.TrackConfigH264
+	aacConf    *gortsplib.TrackConfigAAC
+
+	buf                bytes.Buffer
+	innerMuxer         *astits.Muxer
+	firstPacketWritten bool
+	startPCR           time.Time
+	startPTS           time.Duration
+	videoDTSEst        *h264.DTSEstimator
+	pcrSendCounter     int
+}
+
+// NewWriter allocates a Writer.
+func NewWriter(
+	w io.Writer,
+	videoTrack *gortsplib.Track,
+	audioTrack *gortsplib.Track,
+) (*Writer, error) {
+	tw := &Writer{
+		w:          w,
+		videoTrack: videoTrack,
+		audioTrack: audioTrack,
+	}
+
+	if videoTrack != nil {
+		var err error
+		tw.h264Conf, err = videoTrack.ExtractConfigH264()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if audioTrack != nil {
+		var err error
+		tw.aacConf, err = audioTrack.ExtractConfigAAC()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tw.innerMuxer = astits.NewMuxer(context.Background(), &tw.buf)
+
+	if videoTrack != nil {
+		tw.innerMuxer.AddElementaryStream(astits.PMTElementaryStream{
+			ElementaryPID: videoPID,
+			StreamType:    astits.StreamTypeH264Video,
+		})
+	}
+
+	if audioTrack != nil {
+		tw.innerMuxer.AddElementaryStream(astits.PMTElementaryStream{
+			ElementaryPID: audioPID,
+			StreamType:    astits.StreamTypeAACAudio,
+		})
+	}
+
+	// WriteTable() is called automatically when WriteData() is called with
+	// - PID == PCRPID
+	// - AdaptationField != nil
+	// - RandomAccessIndicator = true
+	// therefore tables are repeated before every IDR, allowing clients to join the stream at any time.
+	if videoTrack != nil {
+		tw.innerMuxer.SetPCRPID(videoPID)
+	} else {
+		tw.innerMuxer.SetPCRPID(audioPID)
+	}
+
+	return tw, nil
+}
+
+// flush writes the packets of an access unit with a single call,
+// in order not to send a TCP segment for every 188-byte packet.
+func (tw *Writer) flush() error {
+	_, err := tw.w.Write(tw.buf.Bytes())
+	tw.buf.Reset()
+	return err
+}
+
+func (tw *Writer) pcr() *astits.ClockReference {
+	return &astits.ClockReference{Base: int64(time.Since(tw.startPCR).Seconds() * 90000)}
+}
+
+// WriteH264 writes a H264 access unit.
+func (tw *Writer) WriteH264(pts time.Duration, nalus [][]byte) error {
+	idrPresent := func() bool {
+		for _, nalu := range nalus {
+			typ := h264.NALUType(nalu[0] & 0x1F)
+			if typ == h264.NALUTypeIDR {
+				return true
+			}
+		}
+		return false
+	}()
+
+	// skip access units silently until we find one with a IDR
+	if !tw.firstPacketWritten {
+		if !idrPresent {
+			return nil
+		}
+
+		tw.firstPacketWritten = true
+		tw.startPCR = time.Now()
+		tw.startPTS = pts
+		tw.videoDTSEst = h264.NewDTSEstimator()
+	}
+
+	dts := tw.videoDTSEst.Feed(pts-tw.startPTS) + pcrOffset
+	pts = pts - tw.startPTS + pcrOffset
+
+	// prepend an AUD. This is required by some decoders
+	filteredNALUs := [][]byte{
+		{byte(h264.NALUTypeAccessUnitDelimiter), 240},
+	}
+
+	for _, nalu := range nalus {
+		// remove existing SPS, PPS, AUD
+		typ := h264.NALUType(nalu[0] & 0x1F)
+		switch typ {
+		case h264.NALUTypeSPS, h264.NALUTypePPS, h264.NALUTypeAccessUnitDelimiter:
+			continue
+		}
+
+		// add SPS and PPS before every IDR
+		if typ == h264.NALUTypeIDR {
+			filteredNALUs = append(filteredNALUs, tw.h264Conf.SPS, tw.h264Conf.PPS)
+		}
+
+		filteredNALUs = append(filteredNALUs, nalu)
+	}
+
+	enc, err := h264.EncodeAnnexB(filteredNALUs)
+	if err != nil {
+		return err
+	}
+
+	var af *astits.PacketAdaptationField
+
+	if idrPresent {
+		af = &astits.PacketAdaptationField{}
+		af.RandomAccessIndicator = true
+	}
+
+	// send PCR once in a while
+	if tw.pcrSendCounter == 0 {
+		if af == nil {
+			af = &astits.PacketAdaptationField{}
+		}
+		af.HasPCR = true
+		af.PCR = tw.pcr()
+		tw.pcrSendCounter = 3
+	}
+	tw.pcrSendCounter--
+
+	oh := &astits.PESOptionalHeader{
+		MarkerBits: 2,
+	}
+
+	if dts == pts {
+		oh.PTSDTSIndicator = astits.PTSDTSIndicatorOnlyPTS
+		oh.PTS = &astits.ClockReference{Base: int64(pts.Seconds() * 90000)}
+	} else {
+		oh.PTSDTSIndicator = astits.PTSDTSIndicatorBothPresent
+		oh.DTS = &astits.ClockReference{Base: int64(dts.Seconds() * 90000)}
+		oh.PTS = &astits.ClockReference{Base: int64(pts.Seconds() * 90000)}
+	}
+
+	_, err = tw.innerMuxer.WriteData(&astits.MuxerData{
+		PID:             videoPID,
+		AdaptationField: af,
+		PES: &astits.PESData{
+			Header: &astits.PESHeader{
+				OptionalHeader: oh,
+				StreamID:       224, // video
+			},
+			Data: enc,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.flush()
+}
+
+// WriteAAC writes AAC access units.
+func (tw *Writer) WriteAAC(pts time.Duration, aus [][]byte) error {
+	if !tw.firstPacketWritten {
+		// wait for the first IDR
+		if tw.videoTrack != nil {
+			return nil
+		}
+
+		tw.firstPacketWritten = true
+		tw.startPCR = time.Now()
+		tw.startPTS = pts
+	}
+
+	pts = pts - tw.startPTS + pcrOffset
+
+	for _, au := range aus {
+		enc, err := aac.EncodeADTS([]*aac.ADTSPacket{
+			{
+				SampleRate:   tw.aacConf.SampleRate,
+				ChannelCount: tw.aacConf.ChannelCount,
+				AU:           au,
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		af := &astits.PacketAdaptationField{
+			RandomAccessIndicator: true,
+		}
+
+		// if audio is the only track, send PCR once in a while
+		if tw.videoTrack == nil {
+			if tw.pcrSendCounter == 0 {
+				af.HasPCR = true
+				af.PCR = tw.pcr()
+				tw.pcrSendCounter = 3
+			}
+			tw.pcrSendCounter--
+		}
+
+		_, err = tw.innerMuxer.WriteData(&astits.MuxerData{
+			PID:             audioPID,
+			AdaptationField: af,
+			PES: &astits.PESData{
+				Header: &astits.PESHeader{
+					OptionalHeader: &astits.PESOptionalHeader{
+						MarkerBits:      2,
+						PTSDTSIndicator: astits.PTSDTSIndicatorOnlyPTS,
+						PTS:             &astits.ClockReference{Base: int64(pts.Seconds() * 90000)},
+					},
+					PacketLength: uint16(len(enc) + 8),
+					StreamID:     192, // audio
+				},
+				Data: enc,
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		pts += 1000 * time.Second / time.Duration(tw.aacConf.SampleRate)
+	}
+
+	return tw.flush()
+}
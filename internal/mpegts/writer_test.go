@@ -0,0 +1,135 @@
+package mpegts
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aler9/gortsplib"
+	"github.com/asticode/go-astits"
+	"github.com/stretchr/testify/require"
+)
+
+type countingWriter struct {
+	bytes.Buffer
+	calls int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.calls++
+	return w.Buffer.Write(p)
+}
+
+func TestWriter(t *testing.T) {
+	videoTrack, err := gortsplib.NewTrackH264(96,
+		&gortsplib.TrackConfigH264{SPS: []byte{0x07, 0x01, 0x02, 0x03}, PPS: []byte{0x08}})
+	require.NoError(t, err)
+
+	audioTrack, err := gortsplib.NewTrackAAC(97,
+		&gortsplib.TrackConfigAAC{Type: 2, SampleRate: 44100, ChannelCount: 2})
+	require.NoError(t, err)
+
+	var buf countingWriter
+	w, err := NewWriter(&buf, videoTrack, audioTrack)
+	require.NoError(t, err)
+
+	// audio and video without IDR are skipped
+	err = w.WriteAAC(1*time.Second, [][]byte{{0x01, 0x02, 0x03, 0x04}})
+	require.NoError(t, err)
+
+	err = w.WriteH264(1*time.Second, [][]byte{{0x06}, {0x07}})
+	require.NoError(t, err)
+	require.Equal(t, 0, buf.Len())
+
+	err = w.WriteH264(2*time.Second, [][]byte{
+		{5}, // IDR
+		{9}, // AUD
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, buf.calls)
+
+	err = w.WriteAAC(2*time.Second, [][]byte{
+		{0x01, 0x02, 0x03, 0x04},
+		{0x05, 0x06, 0x07, 0x08},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, buf.calls)
+
+	err = w.WriteH264(3*time.Second, [][]byte{{1}})
+	require.NoError(t, err)
+
+	require.Equal(t, 0, buf.Len()%188)
+
+	dem := astits.NewDemuxer(context.Background(), bytes.NewReader(buf.Bytes()))
+
+	type pes struct {
+		pts  int64
+		data []byte
+	}
+	pess := make(map[uint16][]pes)
+	pmtFound := false
+
+	for {
+		d, err := dem.NextData()
+		if err != nil {
+			break
+		}
+
+		if d.PMT != nil {
+			pmtFound = true
+			require.Equal(t, uint16(256), d.PMT.PCRPID)
+		}
+
+		if d.PES != nil {
+			pess[d.PID] = append(pess[d.PID], pes{
+				pts:  d.PES.Header.OptionalHeader.PTS.Base,
+				data: d.PES.Data,
+			})
+		}
+	}
+
+	require.Equal(t, true, pmtFound)
+
+	video := pess[256]
+	require.Equal(t, 2, len(video))
+	require.Equal(t, int64(0.5*90000), video[0].pts)
+	require.Equal(t, []byte{
+		0, 0, 0, 1, 9, 240, // AUD
+		0, 0, 0, 1, 7, 1, 2, 3, // SPS
+		0, 0, 0, 1, 8, // PPS
+		0, 0, 0, 1, 5, // IDR
+	}, video[0].data)
+	require.Equal(t, int64(1.5*90000), video[1].pts)
+
+	audio := pess[257]
+	require.Equal(t, 2, len(audio))
+	require.Equal(t, int64(0.5*90000), audio[0].pts)
+	require.Equal(t, int64((500*time.Millisecond+1000*time.Second/44100).Seconds()*90000), audio[1].pts)
+}
+
+func TestWriterAudioOnly(t *testing.T) {
+	audioTrack, err := gortsplib.NewTrackAAC(97,
+		&gortsplib.TrackConfigAAC{Type: 2, SampleRate: 44100, ChannelCount: 2})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, nil, audioTrack)
+	require.NoError(t, err)
+
+	err = w.WriteAAC(3*time.Second, [][]byte{{0x01, 0x02, 0x03, 0x04}})
+	require.NoError(t, err)
+	require.NotEqual(t, 0, buf.Len())
+
+	dem := astits.NewDemuxer(context.Background(), bytes.NewReader(buf.Bytes()))
+
+	for {
+		d, err := dem.NextData()
+		require.NoError(t, err)
+
+		if d.PMT != nil {
+			require.Equal(t, uint16(257), d.PMT.PCRPID)
+			break
+		}
+	}
+}
@@ -0,0 +1,262 @@
+// Package proxyproto implements the receiving side of the PROXY protocol (versions 1 and 2),
+// that allows load balancers to forward the address of clients.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	headerTimeout = 5 * time.Second
+	v1MaxLength   = 107
+)
+
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+type conn struct {
+	net.Conn
+	br         *bufio.Reader
+	remoteAddr net.Addr
+}
+
+// Read implements net.Conn.
+func (c *conn) Read(p []byte) (int, error) {
+	return c.br.Read(p)
+}
+
+// RemoteAddr implements net.Conn.
+// It returns the client address contained in the header.
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// readHeader reads the PROXY protocol header and returns the client address.
+// The original address is returned when the header doesn't contain any
+// (LOCAL command or UNKNOWN protocol).
+func readHeader(br *bufio.Reader, original net.Addr) (net.Addr, error) {
+	sig, err := br.Peek(len(v2Signature))
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(sig, v2Signature) {
+		return readHeaderV2(br, original)
+	}
+
+	if bytes.HasPrefix(sig, []byte("PROXY ")) {
+		return readHeaderV1(br, original)
+	}
+
+	return nil, fmt.Errorf("PROXY protocol header not found")
+}
+
+func readHeaderV1(br *bufio.Reader, original net.Addr) (net.Addr, error) {
+	var line []byte
+	for {
+		byt, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		line = append(line, byt)
+		if byt == '\n' {
+			break
+		}
+
+		if len(line) >= v1MaxLength {
+			return nil, fmt.Errorf("PROXY protocol header is too long")
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("invalid PROXY protocol header")
+	}
+
+	parts := strings.Split(string(line[:len(line)-2]), " ")
+
+	if len(parts) >= 2 && parts[1] == "UNKNOWN" {
+		return original, nil
+	}
+
+	if len(parts) != 6 || (parts[1] != "TCP4" && parts[1] != "TCP6") {
+		return nil, fmt.Errorf("invalid PROXY protocol header")
+	}
+
+	ip := net.ParseIP(parts[2])
+	if ip == nil || (parts[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("invalid source address in PROXY protocol header: '%s'", parts[2])
+	}
+
+	port, err := strconv.ParseUint(parts[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source port in PROXY protocol header: '%s'", parts[4])
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func readHeaderV2(br *bufio.Reader, original net.Addr) (net.Addr, error) {
+	header := make([]byte, 16)
+	_, err := io.ReadFull(br, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if (header[12] >> 4) != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version: %d", header[12]>>4)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	_, err = io.ReadFull(br, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	switch header[12] & 0x0F {
+	case 0: // LOCAL
+		return original, nil
+
+	case 1: // PROXY
+
+	default:
+		return nil, fmt.Errorf("unsupported PROXY protocol command: %d", header[12]&0x0F)
+	}
+
+	switch header[13] {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return nil, fmt.Errorf("invalid PROXY protocol header")
+		}
+		return &net.TCPAddr{
+			IP:   net.IP(payload[0:4]),
+			Port: int(binary.BigEndian.Uint16(payload[8:])),
+		}, nil
+
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return nil, fmt.Errorf("invalid PROXY protocol header")
+		}
+		return &net.TCPAddr{
+			IP:   net.IP(payload[0:16]),
+			Port: int(binary.BigEndian.Uint16(payload[32:])),
+		}, nil
+	}
+
+	// other families (UDP, UNIX) or unspecified
+	return original, nil
+}
+
+// Listener is a net.Listener that reads the PROXY protocol header
+// of incoming connections and replaces their remote address
+// with the address of the client.
+// Connections with a missing or invalid header are closed.
+type Listener struct {
+	inner     net.Listener
+	isTrusted func(net.IP) bool
+
+	closeOnce sync.Once
+	conns     chan net.Conn
+	err       error
+	done      chan struct{}
+	terminate chan struct{}
+}
+
+// NewListener allocates a Listener.
+// Headers are read only from connections whose address is accepted by isTrusted,
+// or from all connections if isTrusted is nil.
+func NewListener(inner net.Listener, isTrusted func(net.IP) bool) *Listener {
+	l := &Listener{
+		inner:     inner,
+		isTrusted: isTrusted,
+		conns:     make(chan net.Conn),
+		done:      make(chan struct{}),
+		terminate: make(chan struct{}),
+	}
+
+	go l.run()
+
+	return l
+}
+
+// Accept implements net.Listener.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+// Close implements net.Listener.
+func (l *Listener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.terminate)
+		err = l.inner.Close()
+	})
+	return err
+}
+
+// Addr implements net.Listener.
+func (l *Listener) Addr() net.Addr {
+	return l.inner.Addr()
+}
+
+func (l *Listener) run() {
+	defer close(l.done)
+
+	for {
+		nconn, err := l.inner.Accept()
+		if err != nil {
+			l.err = err
+			return
+		}
+
+		// headers are read in a dedicated routine, in order not to
+		// block other connections while waiting for them.
+		go l.handle(nconn)
+	}
+}
+
+func (l *Listener) isTrustedAddr(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	return ok && l.isTrusted(tcpAddr.IP)
+}
+
+func (l *Listener) handle(nconn net.Conn) {
+	c := &conn{
+		Conn:       nconn,
+		br:         bufio.NewReader(nconn),
+		remoteAddr: nconn.RemoteAddr(),
+	}
+
+	if l.isTrusted == nil || l.isTrustedAddr(nconn.RemoteAddr()) {
+		nconn.SetReadDeadline(time.Now().Add(headerTimeout))
+
+		addr, err := readHeader(c.br, nconn.RemoteAddr())
+		if err != nil {
+			nconn.Close()
+			return
+		}
+
+		nconn.SetReadDeadline(time.Time{})
+		c.remoteAddr = addr
+	}
+
+	select {
+	case l.conns <- c:
+	case <-l.terminate:
+		nconn.Close()
+	}
+}
@@ -0,0 +1,139 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadHeader(t *testing.T) {
+	original := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}
+
+	for _, ca := range []struct {
+		name string
+		byts []byte
+		addr string
+	}{
+		{
+			"v1 tcp4",
+			[]byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"),
+			"192.168.0.1:56324",
+		},
+		{
+			"v1 tcp6",
+			[]byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"),
+			"[2001:db8::1]:56324",
+		},
+		{
+			"v1 unknown",
+			[]byte("PROXY UNKNOWN\r\n"),
+			"10.0.0.1:1234",
+		},
+		{
+			"v2 tcp4",
+			append(append([]byte{}, v2Signature...),
+				0x21, 0x11, 0x00, 0x0C,
+				192, 168, 0, 1,
+				192, 168, 0, 11,
+				0xDC, 0x04,
+				0x01, 0xBB),
+			"192.168.0.1:56324",
+		},
+		{
+			"v2 local",
+			append(append([]byte{}, v2Signature...),
+				0x20, 0x00, 0x00, 0x00),
+			"10.0.0.1:1234",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			br := bufio.NewReader(bytes.NewReader(append(ca.byts, []byte("OPTIONS")...)))
+			addr, err := readHeader(br, original)
+			require.NoError(t, err)
+			require.Equal(t, ca.addr, addr.String())
+
+			// data following the header is preserved
+			rest, err := ioutil.ReadAll(br)
+			require.NoError(t, err)
+			require.Equal(t, []byte("OPTIONS"), rest)
+		})
+	}
+}
+
+func TestReadHeaderErrors(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		byts []byte
+		err  string
+	}{
+		{
+			"missing",
+			[]byte("OPTIONS rtsp://localhost RTSP/1.0\r\n"),
+			"PROXY protocol header not found",
+		},
+		{
+			"v1 invalid address",
+			[]byte("PROXY TCP4 2001:db8::1 192.168.0.11 56324 443\r\n"),
+			"invalid source address in PROXY protocol header: '2001:db8::1'",
+		},
+		{
+			"v2 invalid command",
+			append(append([]byte{}, v2Signature...),
+				0x22, 0x11, 0x00, 0x00),
+			"unsupported PROXY protocol command: 2",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			_, err := readHeader(bufio.NewReader(bytes.NewReader(ca.byts)), nil)
+			require.EqualError(t, err, ca.err)
+		})
+	}
+}
+
+func TestListener(t *testing.T) {
+	for _, ca := range []string{
+		"trusted",
+		"untrusted",
+	} {
+		t.Run(ca, func(t *testing.T) {
+			inner, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+
+			l := NewListener(inner, func(ip net.IP) bool {
+				return ca == "trusted"
+			})
+			defer l.Close()
+
+			go func() {
+				nconn, err := net.Dial("tcp", l.Addr().String())
+				require.NoError(t, err)
+				defer nconn.Close()
+
+				if ca == "trusted" {
+					nconn.Write([]byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"))
+				}
+				nconn.Write([]byte("OPTIONS"))
+			}()
+
+			nconn, err := l.Accept()
+			require.NoError(t, err)
+			defer nconn.Close()
+
+			if ca == "trusted" {
+				require.Equal(t, "192.168.0.1:56324", nconn.RemoteAddr().String())
+			} else {
+				require.Equal(t, "127.0.0.1", nconn.RemoteAddr().(*net.TCPAddr).IP.String())
+			}
+
+			buf := make([]byte, 7)
+			_, err = io.ReadFull(nconn, buf)
+			require.NoError(t, err)
+			require.Equal(t, []byte("OPTIONS"), buf)
+		})
+	}
+}
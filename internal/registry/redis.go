@@ -0,0 +1,150 @@
+package registry
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisConn is a minimal client of the Redis serialization protocol (RESP).
+type redisConn struct {
+	nconn net.Conn
+	br    *bufio.Reader
+}
+
+func dialRedis(ctx context.Context, u *url.URL, timeout time.Duration) (*redisConn, error) {
+	d := net.Dialer{Timeout: timeout}
+	nconn, err := d.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &redisConn{
+		nconn: nconn,
+		br:    bufio.NewReader(nconn),
+	}
+
+	if u.User != nil {
+		pass, ok := u.User.Password()
+		if ok {
+			if user := u.User.Username(); user != "" {
+				_, err = c.do(timeout, "AUTH", user, pass)
+			} else {
+				_, err = c.do(timeout, "AUTH", pass)
+			}
+			if err != nil {
+				nconn.Close()
+				return nil, err
+			}
+		}
+	}
+
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		_, err = c.do(timeout, "SELECT", db)
+		if err != nil {
+			nconn.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func (c *redisConn) close() {
+	c.nconn.Close()
+}
+
+// do sends a command and returns its reply,
+// that is a string, an int64, nil or a []interface{}.
+func (c *redisConn) do(timeout time.Duration, args ...string) (interface{}, error) {
+	c.nconn.SetDeadline(time.Now().Add(timeout))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	_, err := c.nconn.Write([]byte(b.String()))
+	if err != nil {
+		return nil, err
+	}
+
+	return c.readReply()
+}
+
+func (c *redisConn) readLine() (string, error) {
+	line, err := c.br.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("invalid reply")
+	}
+
+	return line[:len(line)-2], nil
+}
+
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+
+	case '-':
+		return nil, fmt.Errorf("redis: %s", line[1:])
+
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		if n < 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, n+2)
+		_, err = io.ReadFull(c.br, buf)
+		if err != nil {
+			return nil, err
+		}
+
+		return string(buf[:n]), nil
+
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		if n < 0 {
+			return nil, nil
+		}
+
+		ret := make([]interface{}, n)
+		for i := 0; i < n; i++ {
+			ret[i], err = c.readReply()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return ret, nil
+	}
+
+	return nil, fmt.Errorf("invalid reply")
+}
@@ -0,0 +1,249 @@
+// Package registry contains a registry of the streams published on each
+// instance of a multi-instance deployment, that is shared through Redis.
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+const (
+	keyPrefix      = "rtsp-simple-server:paths:"
+	requestTimeout = 2 * time.Second
+)
+
+// Parent is implemented by Core.
+type Parent interface {
+	Log(logger.Level, string, ...interface{})
+}
+
+// Registry stores into Redis which instance is hosting each published path,
+// and allows to find out the instance that is hosting a path published elsewhere.
+type Registry struct {
+	u           *url.URL
+	instanceURL string
+	ttl         time.Duration
+	parent      Parent
+
+	ctx       context.Context
+	ctxCancel func()
+	wg        sync.WaitGroup
+
+	mutex     sync.Mutex
+	conn      *redisConn
+	published map[string]struct{}
+	removed   map[string]struct{}
+
+	// in
+	trigger chan struct{}
+}
+
+// New allocates a Registry.
+// address is in the format redis://[:password@]host:port[/db].
+// instanceURL is the base RTSP URL of this instance, that is sent to readers
+// of paths hosted by this instance but requested to other instances.
+func New(
+	address string,
+	instanceURL string,
+	ttl time.Duration,
+	parent Parent,
+) (*Registry, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("unsupported registry: '%s'", address)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("host is missing in '%s'", address)
+	}
+
+	ctx, ctxCancel := context.WithCancel(context.Background())
+
+	r := &Registry{
+		u:           u,
+		instanceURL: instanceURL,
+		ttl:         ttl,
+		parent:      parent,
+		ctx:         ctx,
+		ctxCancel:   ctxCancel,
+		published:   make(map[string]struct{}),
+		removed:     make(map[string]struct{}),
+		trigger:     make(chan struct{}, 1),
+	}
+
+	r.wg.Add(1)
+	go r.run()
+
+	return r, nil
+}
+
+// Close closes a Registry. The paths published by this instance are removed.
+func (r *Registry) Close() {
+	r.ctxCancel()
+	r.wg.Wait()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for name := range r.published {
+		r.removed[name] = struct{}{}
+	}
+	r.published = make(map[string]struct{})
+
+	r.sync(context.Background())
+
+	if r.conn != nil {
+		r.conn.close()
+		r.conn = nil
+	}
+}
+
+// Publish registers a path as hosted by this instance. It doesn't block.
+func (r *Registry) Publish(pathName string) {
+	r.mutex.Lock()
+	r.published[pathName] = struct{}{}
+	delete(r.removed, pathName)
+	r.mutex.Unlock()
+
+	r.notify()
+}
+
+// Unpublish removes a path from the registry. It doesn't block.
+func (r *Registry) Unpublish(pathName string) {
+	r.mutex.Lock()
+	if _, ok := r.published[pathName]; ok {
+		delete(r.published, pathName)
+		r.removed[pathName] = struct{}{}
+	}
+	r.mutex.Unlock()
+
+	r.notify()
+}
+
+// Lookup returns the RTSP URL of a path published on another instance,
+// or an empty string if the path is not published elsewhere.
+func (r *Registry) Lookup(pathName string) (string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	res, err := r.do(r.ctx, "GET", keyPrefix+pathName)
+	if err != nil {
+		return "", err
+	}
+
+	instanceURL, ok := res.(string)
+	if !ok || instanceURL == r.instanceURL {
+		return "", nil
+	}
+
+	return instanceURL + "/" + pathName, nil
+}
+
+func (r *Registry) notify() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Registry) run() {
+	defer r.wg.Done()
+
+	// keys expire when they're not refreshed, in order to remove paths
+	// of instances that have crashed.
+	t := time.NewTicker(r.ttl / 3)
+	defer t.Stop()
+
+	// log only the first of consecutive errors
+	failing := false
+
+	for {
+		select {
+		case <-r.trigger:
+		case <-t.C:
+		case <-r.ctx.Done():
+			return
+		}
+
+		r.mutex.Lock()
+		err := r.sync(r.ctx)
+		r.mutex.Unlock()
+
+		if err != nil {
+			if r.ctx.Err() != nil {
+				return
+			}
+
+			if !failing {
+				r.parent.Log(logger.Warn, "[registry] %s", err)
+				failing = true
+			}
+			continue
+		}
+
+		if failing {
+			r.parent.Log(logger.Info, "[registry] redis is reachable again")
+			failing = false
+		}
+	}
+}
+
+// sync writes the state of paths into Redis. It must be called with the mutex locked.
+func (r *Registry) sync(ctx context.Context) error {
+	ttl := fmt.Sprintf("%d", int64(r.ttl/time.Second))
+
+	for name := range r.published {
+		_, err := r.do(ctx, "SET", keyPrefix+name, r.instanceURL, "EX", ttl)
+		if err != nil {
+			return err
+		}
+	}
+
+	for name := range r.removed {
+		// do not remove paths that have been published by other instances in the meanwhile
+		res, err := r.do(ctx, "GET", keyPrefix+name)
+		if err != nil {
+			return err
+		}
+
+		if v, ok := res.(string); ok && v == r.instanceURL {
+			_, err = r.do(ctx, "DEL", keyPrefix+name)
+			if err != nil {
+				return err
+			}
+		}
+
+		delete(r.removed, name)
+	}
+
+	return nil
+}
+
+// do sends a command, connecting to Redis if needed. It must be called with the mutex locked.
+func (r *Registry) do(ctx context.Context, args ...string) (interface{}, error) {
+	if r.conn == nil {
+		conn, err := dialRedis(ctx, r.u, requestTimeout)
+		if err != nil {
+			return nil, err
+		}
+		r.conn = conn
+	}
+
+	res, err := r.conn.do(requestTimeout, args...)
+	if err != nil {
+		r.conn.close()
+		r.conn = nil
+		return nil, err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,183 @@
+package registry
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aler9/rtsp-simple-server/internal/logger"
+)
+
+type nilParent struct{}
+
+func (nilParent) Log(logger.Level, string, ...interface{}) {}
+
+// testRedis is a Redis server that supports the commands used by the registry.
+type testRedis struct {
+	ln    net.Listener
+	mutex sync.Mutex
+	keys  map[string]string
+	auth  []string
+}
+
+func newTestRedis() (*testRedis, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &testRedis{
+		ln:   ln,
+		keys: make(map[string]string),
+	}
+
+	go func() {
+		for {
+			nconn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.handleConn(nconn)
+		}
+	}()
+
+	return s, nil
+}
+
+func (s *testRedis) close() {
+	s.ln.Close()
+}
+
+func (s *testRedis) get(key string) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	v, ok := s.keys[key]
+	return v, ok
+}
+
+func (s *testRedis) set(key string, value string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keys[key] = value
+}
+
+func (s *testRedis) handleConn(nconn net.Conn) {
+	defer nconn.Close()
+	br := bufio.NewReader(nconn)
+
+	readLine := func() (string, error) {
+		line, err := br.ReadString('\n')
+		return strings.TrimSuffix(line, "\r\n"), err
+	}
+
+	for {
+		line, err := readLine()
+		if err != nil {
+			return
+		}
+
+		n, _ := strconv.Atoi(line[1:])
+		args := make([]string, n)
+		for i := 0; i < n; i++ {
+			line, err := readLine()
+			if err != nil {
+				return
+			}
+			l, _ := strconv.Atoi(line[1:])
+			buf := make([]byte, l+2)
+			_, err = io.ReadFull(br, buf)
+			if err != nil {
+				return
+			}
+			args[i] = string(buf[:l])
+		}
+
+		s.mutex.Lock()
+		switch args[0] {
+		case "AUTH":
+			s.auth = args[1:]
+			nconn.Write([]byte("+OK\r\n"))
+
+		case "SELECT":
+			nconn.Write([]byte("+OK\r\n"))
+
+		case "SET":
+			s.keys[args[1]] = args[2]
+			nconn.Write([]byte("+OK\r\n"))
+
+		case "GET":
+			if v, ok := s.keys[args[1]]; ok {
+				fmt.Fprintf(nconn, "$%d\r\n%s\r\n", len(v), v)
+			} else {
+				nconn.Write([]byte("$-1\r\n"))
+			}
+
+		case "DEL":
+			delete(s.keys, args[1])
+			nconn.Write([]byte(":1\r\n"))
+
+		default:
+			nconn.Write([]byte("-ERR unknown command\r\n"))
+		}
+		s.mutex.Unlock()
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	_, err := New("http://localhost:6379", "rtsp://node1:8554", 30*time.Second, nilParent{})
+	require.EqualError(t, err, "unsupported registry: 'http://localhost:6379'")
+
+	_, err = New("redis:///0", "rtsp://node1:8554", 30*time.Second, nilParent{})
+	require.EqualError(t, err, "host is missing in 'redis:///0'")
+}
+
+func TestRegistry(t *testing.T) {
+	srv, err := newTestRedis()
+	require.NoError(t, err)
+	defer srv.close()
+
+	r, err := New("redis://:mypass@"+srv.ln.Addr().String()+"/1", "rtsp://node1:8554", 30*time.Second, nilParent{})
+	require.NoError(t, err)
+	defer r.Close()
+
+	r.Publish("cam1")
+
+	require.Eventually(t, func() bool {
+		v, ok := srv.get(keyPrefix + "cam1")
+		return ok && v == "rtsp://node1:8554"
+	}, 2*time.Second, 10*time.Millisecond)
+
+	srv.mutex.Lock()
+	require.Equal(t, []string{"mypass"}, srv.auth)
+	srv.mutex.Unlock()
+
+	// paths hosted by this instance are not redirected
+	ur, err := r.Lookup("cam1")
+	require.NoError(t, err)
+	require.Equal(t, "", ur)
+
+	// paths hosted by other instances are
+	srv.set(keyPrefix+"cam2", "rtsp://node2:8554")
+	ur, err = r.Lookup("cam2")
+	require.NoError(t, err)
+	require.Equal(t, "rtsp://node2:8554/cam2", ur)
+
+	ur, err = r.Lookup("cam3")
+	require.NoError(t, err)
+	require.Equal(t, "", ur)
+
+	r.Unpublish("cam1")
+
+	require.Eventually(t, func() bool {
+		_, ok := srv.get(keyPrefix + "cam1")
+		return !ok
+	}, 2*time.Second, 10*time.Millisecond)
+}
@@ -3,13 +3,15 @@ package rtmp
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
 	"net"
 	"net/url"
 
 	"github.com/notedit/rtmp/format/rtmp"
 )
 
-// DialContext connects to a server in reading mode.
+// DialContext connects to a server. rtmps URLs are served with TLS.
+// The direction of the connection is chosen by the handshake.
 func DialContext(ctx context.Context, address string) (*Conn, error) {
 	// https://github.com/aler9/rtmp/blob/3be4a55359274dcd88762e72aa0a702e2d8ba2fd/format/rtmp/client.go#L74
 
@@ -19,8 +21,16 @@ func DialContext(ctx context.Context, address string) (*Conn, error) {
 	}
 	host := rtmp.UrlGetHost(u)
 
-	var d net.Dialer
-	nconn, err := d.DialContext(ctx, "tcp", host)
+	var nconn net.Conn
+	if u.Scheme == "rtmps" {
+		d := tls.Dialer{
+			Config: &tls.Config{ServerName: u.Hostname()},
+		}
+		nconn, err = d.DialContext(ctx, "tcp", host)
+	} else {
+		var d net.Dialer
+		nconn, err = d.DialContext(ctx, "tcp", host)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -38,7 +48,12 @@ func DialContext(ctx context.Context, address string) (*Conn, error) {
 	}, nil
 }
 
-// ClientHandshake performs the handshake of a client-side connection.
+// ClientHandshake performs the handshake of a client-side connection in reading mode.
 func (c *Conn) ClientHandshake() error {
 	return c.rconn.Prepare(rtmp.StageGotPublishOrPlayCommand, rtmp.PrepareReading)
 }
+
+// ClientHandshakePublish performs the handshake of a client-side connection in publishing mode.
+func (c *Conn) ClientHandshakePublish() error {
+	return c.rconn.Prepare(rtmp.StageGotPublishOrPlayCommand, rtmp.PrepareWriting)
+}
@@ -1,13 +1,20 @@
 package rtmp
 
 import (
+	"encoding/binary"
+	"errors"
 	"net"
 	"net/url"
 
 	"github.com/notedit/rtmp/av"
+	"github.com/notedit/rtmp/format/flv"
+	"github.com/notedit/rtmp/format/flv/flvio"
 	"github.com/notedit/rtmp/format/rtmp"
 )
 
+// errEnhancedPacket is used to stop flv.ReadPacket when an enhanced packet is found.
+var errEnhancedPacket = errors.New("enhanced packet")
+
 // Conn is a RTMP connection.
 type Conn struct {
 	rconn *rtmp.Conn
@@ -31,7 +38,40 @@ func (c *Conn) URL() *url.URL {
 
 // ReadPacket reads a packet.
 func (c *Conn) ReadPacket() (av.Packet, error) {
-	return c.rconn.ReadPacket()
+	err := c.rconn.Prepare(rtmp.StageCommandDone, rtmp.PrepareReading)
+	if err != nil {
+		return av.Packet{}, err
+	}
+
+	// video tags with the enhanced RTMP header are silently discarded by flv,
+	// therefore they are intercepted and decoded here.
+	var enhanced *av.Packet
+
+	pkt, err := flv.ReadPacket(func() (flvio.Tag, error) {
+		for {
+			tag, err := c.rconn.ReadTag()
+			if err != nil {
+				return tag, err
+			}
+
+			if !isEnhancedVideoTag(tag) {
+				return tag, nil
+			}
+
+			enhanced, err = decodeEnhancedVideoTag(tag)
+			if err != nil {
+				return tag, err
+			}
+
+			if enhanced != nil {
+				return tag, errEnhancedPacket
+			}
+		}
+	})
+	if enhanced != nil {
+		return *enhanced, nil
+	}
+	return pkt, err
 }
 
 // WritePacket writes a packet.
@@ -42,3 +82,17 @@ func (c *Conn) WritePacket(pkt av.Packet) error {
 	}
 	return c.rconn.FlushWrite()
 }
+
+// WriteStreamEOF notifies a reading connection that the stream has ended,
+// by sending a StreamEOF user control message.
+func (c *Conn) WriteStreamEOF() error {
+	byts := make([]byte, 6)
+	binary.BigEndian.PutUint16(byts[0:2], 1) // StreamEOF
+	binary.BigEndian.PutUint32(byts[2:6], 1) // ID of the stream created by the server
+
+	err := c.rconn.WriteEvent(4, byts) // user control message
+	if err != nil {
+		return err
+	}
+	return c.rconn.FlushWrite()
+}
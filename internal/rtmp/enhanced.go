@@ -0,0 +1,117 @@
+package rtmp
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/notedit/rtmp/av"
+	"github.com/notedit/rtmp/format/flv/flvio"
+)
+
+// enhanced RTMP allows to transmit additional video codecs by using a FourCC.
+// https://github.com/veovera/enhanced-rtmp
+const (
+	videoFrameTypeExHeader = 0x08
+
+	videoPacketTypeSequenceStart = 0
+	videoPacketTypeCodedFrames   = 1
+	videoPacketTypeSequenceEnd   = 2
+	videoPacketTypeCodedFramesX  = 3
+
+	fourCCHEVC = 'h'<<24 | 'v'<<16 | 'c'<<8 | '1'
+	fourCCAV1  = 'a'<<24 | 'v'<<16 | '0'<<8 | '1'
+)
+
+// packet types that are not provided by the av package.
+const (
+	PacketTypeH265 = 64 + iota
+	PacketTypeH265DecoderConfig
+	PacketTypeAV1
+	PacketTypeAV1DecoderConfig
+)
+
+func isEnhancedVideoTag(tag flvio.Tag) bool {
+	return tag.Type == flvio.TAG_VIDEO && (tag.FrameType&videoFrameTypeExHeader) != 0
+}
+
+// decodeEnhancedVideoTag decodes a video tag that uses the enhanced RTMP header.
+// It returns nil when the tag doesn't contain anything useful.
+func decodeEnhancedVideoTag(tag flvio.Tag) (*av.Packet, error) {
+	// the header has been parsed by flvio as if it was a legacy one:
+	// the frame type is in the upper 4 bits, the packet type in the lower ones.
+	frameType := tag.FrameType &^ videoFrameTypeExHeader
+	packetType := tag.VideoFormat
+
+	// packet type 7 (ModEx) is not supported; furthermore, flvio consumed
+	// the FourCC as if it was an AVC packet type and a composition time.
+	if packetType == flvio.VIDEO_H264 {
+		return nil, nil
+	}
+
+	if len(tag.Data) < 4 {
+		return nil, fmt.Errorf("invalid enhanced video tag")
+	}
+
+	fourCC := binary.BigEndian.Uint32(tag.Data)
+	data := tag.Data[4:]
+
+	switch fourCC {
+	case fourCCHEVC:
+		switch packetType {
+		case videoPacketTypeSequenceStart:
+			return &av.Packet{
+				Type: PacketTypeH265DecoderConfig,
+				Data: data,
+			}, nil
+
+		case videoPacketTypeCodedFrames, videoPacketTypeCodedFramesX:
+			var ctime int32
+			if packetType == videoPacketTypeCodedFrames {
+				if len(data) < 3 {
+					return nil, fmt.Errorf("invalid enhanced video tag")
+				}
+
+				// signed 24-bit composition time offset
+				ctime = int32(uint32(data[0])<<24|uint32(data[1])<<16|uint32(data[2])<<8) >> 8
+				data = data[3:]
+			}
+
+			return &av.Packet{
+				Type:       PacketTypeH265,
+				Data:       data,
+				Time:       flvio.TsToTime(int64(tag.Time)),
+				CTime:      flvio.TsToTime(int64(ctime)),
+				IsKeyFrame: frameType == flvio.FRAME_KEY,
+			}, nil
+		}
+
+	case fourCCAV1:
+		switch packetType {
+		case videoPacketTypeSequenceStart:
+			return &av.Packet{
+				Type: PacketTypeAV1DecoderConfig,
+				Data: data,
+			}, nil
+
+		case videoPacketTypeCodedFrames:
+			return &av.Packet{
+				Type:       PacketTypeAV1,
+				Data:       data,
+				Time:       flvio.TsToTime(int64(tag.Time)),
+				IsKeyFrame: frameType == flvio.FRAME_KEY,
+			}, nil
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported video codec %s", fourCCString(fourCC))
+	}
+
+	// sequence end and other packet types
+	return nil, nil
+}
+
+func fourCCString(v uint32) string {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return string(buf[:])
+}
@@ -0,0 +1,125 @@
+package rtmp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/notedit/rtmp/av"
+	"github.com/notedit/rtmp/format/flv/flvio"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeEnhancedVideoTag(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		tag  flvio.Tag
+		pkt  *av.Packet
+	}{
+		{
+			"h265 config",
+			flvio.Tag{
+				Type:        flvio.TAG_VIDEO,
+				FrameType:   0x8 | flvio.FRAME_KEY,
+				VideoFormat: videoPacketTypeSequenceStart,
+				Data:        []byte{'h', 'v', 'c', '1', 0x01, 0x02},
+			},
+			&av.Packet{
+				Type: PacketTypeH265DecoderConfig,
+				Data: []byte{0x01, 0x02},
+			},
+		},
+		{
+			"h265 frames",
+			flvio.Tag{
+				Type:        flvio.TAG_VIDEO,
+				FrameType:   0x8 | flvio.FRAME_KEY,
+				VideoFormat: videoPacketTypeCodedFrames,
+				Time:        1000,
+				Data:        []byte{'h', 'v', 'c', '1', 0xff, 0xff, 0xce, 0x01, 0x02},
+			},
+			&av.Packet{
+				Type:       PacketTypeH265,
+				Data:       []byte{0x01, 0x02},
+				Time:       1 * time.Second,
+				CTime:      -50 * time.Millisecond,
+				IsKeyFrame: true,
+			},
+		},
+		{
+			"h265 frames without composition time",
+			flvio.Tag{
+				Type:        flvio.TAG_VIDEO,
+				FrameType:   0x8 | flvio.FRAME_INTER,
+				VideoFormat: videoPacketTypeCodedFramesX,
+				Time:        1000,
+				Data:        []byte{'h', 'v', 'c', '1', 0x01, 0x02},
+			},
+			&av.Packet{
+				Type: PacketTypeH265,
+				Data: []byte{0x01, 0x02},
+				Time: 1 * time.Second,
+			},
+		},
+		{
+			"av1 frames",
+			flvio.Tag{
+				Type:        flvio.TAG_VIDEO,
+				FrameType:   0x8 | flvio.FRAME_KEY,
+				VideoFormat: videoPacketTypeCodedFrames,
+				Time:        1000,
+				Data:        []byte{'a', 'v', '0', '1', 0x01, 0x02},
+			},
+			&av.Packet{
+				Type:       PacketTypeAV1,
+				Data:       []byte{0x01, 0x02},
+				Time:       1 * time.Second,
+				IsKeyFrame: true,
+			},
+		},
+		{
+			"sequence end",
+			flvio.Tag{
+				Type:        flvio.TAG_VIDEO,
+				FrameType:   0x8 | flvio.FRAME_KEY,
+				VideoFormat: videoPacketTypeSequenceEnd,
+				Data:        []byte{'a', 'v', '0', '1'},
+			},
+			nil,
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			require.Equal(t, true, isEnhancedVideoTag(ca.tag))
+			pkt, err := decodeEnhancedVideoTag(ca.tag)
+			require.NoError(t, err)
+			require.Equal(t, ca.pkt, pkt)
+		})
+	}
+
+	_, err := decodeEnhancedVideoTag(flvio.Tag{
+		Type:        flvio.TAG_VIDEO,
+		FrameType:   0x8 | flvio.FRAME_KEY,
+		VideoFormat: videoPacketTypeCodedFrames,
+		Data:        []byte{'v', 'p', '0', '9', 0x01},
+	})
+	require.EqualError(t, err, "unsupported video codec vp09")
+}
+
+func TestDecodeHEVCDecoderConfig(t *testing.T) {
+	byts := make([]byte, 22)
+	byts[0] = 1
+	byts = append(byts,
+		3,
+		0x20, 0x00, 0x01, 0x00, 0x02, 0x40, 0x01,
+		0x21, 0x00, 0x01, 0x00, 0x02, 0x42, 0x01,
+		0x22, 0x00, 0x01, 0x00, 0x02, 0x44, 0x01,
+	)
+
+	vps, sps, pps, err := decodeHEVCDecoderConfig(byts)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x40, 0x01}, vps)
+	require.Equal(t, []byte{0x42, 0x01}, sps)
+	require.Equal(t, []byte{0x44, 0x01}, pps)
+
+	_, _, _, err = decodeHEVCDecoderConfig(byts[:26])
+	require.Error(t, err)
+}
@@ -1,6 +1,7 @@
 package rtmp
 
 import (
+	"encoding/binary"
 	"fmt"
 
 	"github.com/aler9/gortsplib"
@@ -8,6 +9,9 @@ import (
 	"github.com/notedit/rtmp/av"
 	nh264 "github.com/notedit/rtmp/codec/h264"
 	"github.com/notedit/rtmp/format/flv/flvio"
+
+	"github.com/aler9/rtsp-simple-server/internal/rtpav1"
+	"github.com/aler9/rtsp-simple-server/internal/rtph265"
 )
 
 const (
@@ -15,8 +19,28 @@ const (
 	codecAAC  = 10
 )
 
+// DecodeMetadata decodes the content of a metadata packet.
+func DecodeMetadata(byts []byte) (flvio.AMFMap, error) {
+	arr, err := flvio.ParseAMFVals(byts, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(arr) != 1 {
+		return nil, fmt.Errorf("invalid metadata")
+	}
+
+	ma, ok := arr[0].(flvio.AMFMap)
+	if !ok {
+		return nil, fmt.Errorf("invalid metadata")
+	}
+
+	return ma, nil
+}
+
 // ReadMetadata extracts track informations from a connection that is publishing.
-func (c *Conn) ReadMetadata() (*gortsplib.Track, *gortsplib.Track, error) {
+// It also returns the metadata sent by the publisher.
+func (c *Conn) ReadMetadata() (*gortsplib.Track, *gortsplib.Track, flvio.AMFMap, error) {
 	var videoTrack *gortsplib.Track
 	var audioTrack *gortsplib.Track
 
@@ -30,24 +54,10 @@ func (c *Conn) ReadMetadata() (*gortsplib.Track, *gortsplib.Track, error) {
 			return nil, fmt.Errorf("first packet must be metadata")
 		}
 
-		arr, err := flvio.ParseAMFVals(pkt.Data, false)
-		if err != nil {
-			return nil, err
-		}
-
-		if len(arr) != 1 {
-			return nil, fmt.Errorf("invalid metadata")
-		}
-
-		ma, ok := arr[0].(flvio.AMFMap)
-		if !ok {
-			return nil, fmt.Errorf("invalid metadata")
-		}
-
-		return ma, nil
+		return DecodeMetadata(pkt.Data)
 	}()
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	hasVideo, err := func() (bool, error) {
@@ -62,12 +72,13 @@ func (c *Conn) ReadMetadata() (*gortsplib.Track, *gortsplib.Track, error) {
 			case 0:
 				return false, nil
 
-			case codecH264:
+			case codecH264, fourCCHEVC, fourCCAV1:
 				return true, nil
 			}
 
 		case string:
-			if vt == "avc1" {
+			switch vt {
+			case "avc1", "hvc1", "av01":
 				return true, nil
 			}
 		}
@@ -75,7 +86,7 @@ func (c *Conn) ReadMetadata() (*gortsplib.Track, *gortsplib.Track, error) {
 		return false, fmt.Errorf("unsupported video codec %v", v)
 	}()
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	hasAudio, err := func() (bool, error) {
@@ -103,53 +114,83 @@ func (c *Conn) ReadMetadata() (*gortsplib.Track, *gortsplib.Track, error) {
 		return false, fmt.Errorf("unsupported audio codec %v", v)
 	}()
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	if !hasVideo && !hasAudio {
-		return nil, nil, fmt.Errorf("stream doesn't contain tracks with supported codecs (H264 or AAC)")
+		return nil, nil, nil, fmt.Errorf("stream doesn't contain tracks with supported codecs (H264, H265, AV1 or AAC)")
 	}
 
 	for {
 		var pkt av.Packet
 		pkt, err = c.ReadPacket()
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
 
 		switch pkt.Type {
 		case av.H264DecoderConfig:
 			if !hasVideo {
-				return nil, nil, fmt.Errorf("unexpected video packet")
+				return nil, nil, nil, fmt.Errorf("unexpected video packet")
 			}
 
 			if videoTrack != nil {
-				return nil, nil, fmt.Errorf("video track setupped twice")
+				return nil, nil, nil, fmt.Errorf("video track setupped twice")
 			}
 
 			codec, err := nh264.FromDecoderConfig(pkt.Data)
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, nil, err
 			}
 
 			videoTrack, err = gortsplib.NewTrackH264(96, &gortsplib.TrackConfigH264{SPS: codec.SPS[0], PPS: codec.PPS[0]})
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, nil, err
+			}
+
+		case PacketTypeH265DecoderConfig:
+			if !hasVideo {
+				return nil, nil, nil, fmt.Errorf("unexpected video packet")
+			}
+
+			if videoTrack != nil {
+				return nil, nil, nil, fmt.Errorf("video track setupped twice")
+			}
+
+			vps, sps, pps, err := decodeHEVCDecoderConfig(pkt.Data)
+			if err != nil {
+				return nil, nil, nil, err
 			}
 
+			videoTrack, err = rtph265.NewTrack(96, vps, sps, pps)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+		case PacketTypeAV1DecoderConfig:
+			if !hasVideo {
+				return nil, nil, nil, fmt.Errorf("unexpected video packet")
+			}
+
+			if videoTrack != nil {
+				return nil, nil, nil, fmt.Errorf("video track setupped twice")
+			}
+
+			videoTrack = rtpav1.NewTrack(96)
+
 		case av.AACDecoderConfig:
 			if !hasAudio {
-				return nil, nil, fmt.Errorf("unexpected audio packet")
+				return nil, nil, nil, fmt.Errorf("unexpected audio packet")
 			}
 
 			if audioTrack != nil {
-				return nil, nil, fmt.Errorf("audio track setupped twice")
+				return nil, nil, nil, fmt.Errorf("audio track setupped twice")
 			}
 
 			var mpegConf aac.MPEG4AudioConfig
 			err := mpegConf.Decode(pkt.Data)
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, nil, err
 			}
 
 			audioTrack, err = gortsplib.NewTrackAAC(96, &gortsplib.TrackConfigAAC{
@@ -159,49 +200,130 @@ func (c *Conn) ReadMetadata() (*gortsplib.Track, *gortsplib.Track, error) {
 				AOTSpecificConfig: mpegConf.AOTSpecificConfig,
 			})
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, nil, err
 			}
 		}
 
 		if (!hasVideo || videoTrack != nil) &&
 			(!hasAudio || audioTrack != nil) {
-			return videoTrack, audioTrack, nil
+			return videoTrack, audioTrack, md, nil
+		}
+	}
+}
+
+// decodeHEVCDecoderConfig extracts the parameter sets
+// from a HEVCDecoderConfigurationRecord (ISO/IEC 14496-15).
+func decodeHEVCDecoderConfig(byts []byte) ([]byte, []byte, []byte, error) {
+	if len(byts) < 23 {
+		return nil, nil, nil, fmt.Errorf("invalid HEVC decoder configuration")
+	}
+
+	var vps []byte
+	var sps []byte
+	var pps []byte
+
+	arrayCount := int(byts[22])
+	pos := 23
+
+	for i := 0; i < arrayCount; i++ {
+		if (len(byts) - pos) < 3 {
+			return nil, nil, nil, fmt.Errorf("invalid HEVC decoder configuration")
+		}
+
+		typ := byts[pos] & 0x3F
+		naluCount := int(binary.BigEndian.Uint16(byts[pos+1:]))
+		pos += 3
+
+		for j := 0; j < naluCount; j++ {
+			if (len(byts) - pos) < 2 {
+				return nil, nil, nil, fmt.Errorf("invalid HEVC decoder configuration")
+			}
+
+			l := int(binary.BigEndian.Uint16(byts[pos:]))
+			pos += 2
+
+			if (len(byts) - pos) < l {
+				return nil, nil, nil, fmt.Errorf("invalid HEVC decoder configuration")
+			}
+
+			nalu := byts[pos : pos+l]
+			pos += l
+
+			switch rtph265.NALUType(typ) {
+			case rtph265.NALUTypeVPS:
+				if vps == nil {
+					vps = nalu
+				}
+
+			case rtph265.NALUTypeSPS:
+				if sps == nil {
+					sps = nalu
+				}
+
+			case rtph265.NALUTypePPS:
+				if pps == nil {
+					pps = nalu
+				}
+			}
 		}
 	}
+
+	if vps == nil || sps == nil || pps == nil {
+		return nil, nil, nil, fmt.Errorf("HEVC decoder configuration doesn't contain VPS, SPS and PPS")
+	}
+
+	return vps, sps, pps, nil
 }
 
 // WriteMetadata writes track informations to a connection that is reading.
-func (c *Conn) WriteMetadata(videoTrack *gortsplib.Track, audioTrack *gortsplib.Track) error {
+// Additional metadata entries can be provided, and are sent to the reader
+// together with the codecs; entries that describe codecs are ignored.
+func (c *Conn) WriteMetadata(videoTrack *gortsplib.Track, audioTrack *gortsplib.Track, extra flvio.AMFMap) error {
+	md := flvio.AMFMap{
+		{
+			K: "videodatarate",
+			V: float64(0),
+		},
+		{
+			K: "videocodecid",
+			V: func() float64 {
+				if videoTrack != nil {
+					return codecH264
+				}
+				return 0
+			}(),
+		},
+		{
+			K: "audiodatarate",
+			V: float64(0),
+		},
+		{
+			K: "audiocodecid",
+			V: func() float64 {
+				if audioTrack != nil {
+					return codecAAC
+				}
+				return 0
+			}(),
+		},
+	}
+
+	for _, kv := range extra {
+		switch kv.K {
+		case "videocodecid", "audiocodecid":
+			continue
+		}
+
+		if ekv := md.Get(kv.K); ekv != nil {
+			ekv.V = kv.V
+		} else {
+			md = append(md, kv)
+		}
+	}
+
 	err := c.WritePacket(av.Packet{
 		Type: av.Metadata,
-		Data: flvio.FillAMF0ValMalloc(flvio.AMFMap{
-			{
-				K: "videodatarate",
-				V: float64(0),
-			},
-			{
-				K: "videocodecid",
-				V: func() float64 {
-					if videoTrack != nil {
-						return codecH264
-					}
-					return 0
-				}(),
-			},
-			{
-				K: "audiodatarate",
-				V: float64(0),
-			},
-			{
-				K: "audiocodecid",
-				V: func() float64 {
-					if audioTrack != nil {
-						return codecAAC
-					}
-					return 0
-				}(),
-			},
-		}),
+		Data: flvio.FillAMF0ValMalloc(md),
 	})
 	if err != nil {
 		return err
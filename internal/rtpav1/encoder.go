@@ -0,0 +1,146 @@
+// Package rtpav1 contains a RTP/AV1 encoder.
+package rtpav1
+
+import (
+	"crypto/rand"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+const (
+	rtpVersion        = 0x02
+	rtpPayloadMaxSize = 1460  // 1500 (mtu) - 20 (ip header) - 8 (udp header) - 12 (rtp header)
+	rtpClockRate      = 90000 // av1 always uses 90khz
+)
+
+func randUint32() uint32 {
+	var b [4]byte
+	rand.Read(b[:])
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+// Encoder is a RTP/AV1 encoder.
+// Specification: https://aomediacodec.github.io/av1-rtp-spec/
+type Encoder struct {
+	payloadType    uint8
+	sequenceNumber uint16
+	ssrc           uint32
+	initialTs      uint32
+}
+
+// NewEncoder allocates an Encoder.
+func NewEncoder(payloadType uint8,
+	sequenceNumber *uint16,
+	ssrc *uint32,
+	initialTs *uint32) *Encoder {
+	return &Encoder{
+		payloadType: payloadType,
+		sequenceNumber: func() uint16 {
+			if sequenceNumber != nil {
+				return *sequenceNumber
+			}
+			return uint16(randUint32())
+		}(),
+		ssrc: func() uint32 {
+			if ssrc != nil {
+				return *ssrc
+			}
+			return randUint32()
+		}(),
+		initialTs: func() uint32 {
+			if initialTs != nil {
+				return *initialTs
+			}
+			return randUint32()
+		}(),
+	}
+}
+
+func (e *Encoder) encodeTimestamp(ts time.Duration) uint32 {
+	return e.initialTs + uint32(ts.Seconds()*rtpClockRate)
+}
+
+// Encode encodes a temporal unit, in the low overhead bitstream format,
+// into RTP/AV1 packets.
+func (e *Encoder) Encode(tu []byte, pts time.Duration) ([]*rtp.Packet, error) {
+	obus, err := splitOBUs(tu)
+	if err != nil {
+		return nil, err
+	}
+
+	// temporal delimiters, tile lists and padding must not be transmitted
+	var outOBUs [][]byte
+	newSequence := false
+
+	for _, obu := range obus {
+		switch obuType(obu) {
+		case obuTypeTemporalDelimiter, obuTypeTileList, obuTypePadding:
+			continue
+
+		case obuTypeSequenceHeader:
+			newSequence = true
+		}
+
+		outOBUs = append(outOBUs, obu)
+	}
+
+	if len(outOBUs) == 0 {
+		return nil, nil
+	}
+
+	var rets []*rtp.Packet
+	encPTS := e.encodeTimestamp(pts)
+
+	// every packet contains a single OBU element (W=1),
+	// that can be a fragment of an OBU (Z and Y flags).
+	for i, obu := range outOBUs {
+		first := true
+
+		for {
+			le := len(obu)
+			if le > (rtpPayloadMaxSize - 1) {
+				le = rtpPayloadMaxSize - 1
+			}
+			last := (le == len(obu))
+
+			header := uint8(1 << 4) // W
+			if !first {
+				header |= 1 << 7 // Z
+			}
+			if !last {
+				header |= 1 << 6 // Y
+			}
+			if newSequence && len(rets) == 0 {
+				header |= 1 << 3 // N
+			}
+
+			data := make([]byte, 1+le)
+			data[0] = header
+			copy(data[1:], obu[:le])
+			obu = obu[le:]
+
+			rets = append(rets, &rtp.Packet{
+				Header: rtp.Header{
+					Version:        rtpVersion,
+					PayloadType:    e.payloadType,
+					SequenceNumber: e.sequenceNumber,
+					Timestamp:      encPTS,
+					SSRC:           e.ssrc,
+					// marker is used to indicate the last packet of a temporal unit
+					Marker: (last && i == (len(outOBUs)-1)),
+				},
+				Payload: data,
+			})
+
+			e.sequenceNumber++
+
+			if last {
+				break
+			}
+			first = false
+		}
+	}
+
+	return rets, nil
+}
@@ -0,0 +1,56 @@
+package rtpav1
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncode(t *testing.T) {
+	sequenceNumber := uint16(0x44ed)
+	ssrc := uint32(0x9dbb7812)
+	initialTs := uint32(0x88776655)
+	e := NewEncoder(96, &sequenceNumber, &ssrc, &initialTs)
+
+	frame := bytes.Repeat([]byte{0x01, 0x02, 0x03, 0x04}, 500)
+
+	tu := []byte{
+		0x12, 0x00, // temporal delimiter
+		0x0a, 0x03, 0x01, 0x02, 0x03, // sequence header
+		0x32, 0xd0, 0x0f, // frame, size 2000 in LEB128
+	}
+	tu = append(tu, frame...)
+
+	pkts, err := e.Encode(tu, 0)
+	require.NoError(t, err)
+
+	header := rtp.Header{
+		Version:        2,
+		PayloadType:    96,
+		SequenceNumber: 0x44ed,
+		Timestamp:      0x88776655,
+		SSRC:           0x9dbb7812,
+	}
+
+	expected := []*rtp.Packet{
+		{
+			Header:  header,
+			Payload: []byte{0x18, 0x08, 0x01, 0x02, 0x03},
+		},
+		{
+			Header:  header,
+			Payload: append([]byte{0x50, 0x30}, frame[:1458]...),
+		},
+		{
+			Header:  header,
+			Payload: append([]byte{0x90}, frame[1458:]...),
+		},
+	}
+	expected[1].SequenceNumber = 0x44ee
+	expected[2].SequenceNumber = 0x44ef
+	expected[2].Marker = true
+
+	require.Equal(t, expected, pkts)
+}
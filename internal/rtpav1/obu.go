@@ -0,0 +1,81 @@
+package rtpav1
+
+import (
+	"fmt"
+)
+
+// OBU types.
+const (
+	obuTypeSequenceHeader    = 1
+	obuTypeTemporalDelimiter = 2
+	obuTypeTileList          = 8
+	obuTypePadding           = 15
+)
+
+func readLEB128(byts []byte) (uint64, int, error) {
+	var v uint64
+
+	for i := 0; i < 8; i++ {
+		if i >= len(byts) {
+			return 0, 0, fmt.Errorf("not enough bytes")
+		}
+
+		v |= uint64(byts[i]&0x7F) << (7 * i)
+
+		if (byts[i] & 0x80) == 0 {
+			return v, i + 1, nil
+		}
+	}
+
+	return 0, 0, fmt.Errorf("LEB128 value is too long")
+}
+
+// splitOBUs splits a temporal unit in the low overhead bitstream format
+// into OBUs, and removes their size fields, as required by RTP.
+func splitOBUs(byts []byte) ([][]byte, error) {
+	var ret [][]byte
+
+	for len(byts) > 0 {
+		headerLen := 1
+		if (byts[0] & 0x04) != 0 {
+			headerLen = 2
+		}
+
+		if len(byts) < headerLen {
+			return nil, fmt.Errorf("invalid OBU")
+		}
+
+		header := byts[:headerLen]
+		var payload []byte
+
+		if (byts[0] & 0x02) != 0 {
+			size, n, err := readLEB128(byts[headerLen:])
+			if err != nil {
+				return nil, err
+			}
+
+			start := headerLen + n
+			if uint64(len(byts)-start) < size {
+				return nil, fmt.Errorf("invalid OBU size")
+			}
+
+			payload = byts[start : start+int(size)]
+			byts = byts[start+int(size):]
+		} else {
+			payload = byts[headerLen:]
+			byts = nil
+		}
+
+		obu := make([]byte, headerLen+len(payload))
+		copy(obu, header)
+		obu[0] &^= 0x02
+		copy(obu[headerLen:], payload)
+		ret = append(ret, obu)
+	}
+
+	return ret, nil
+}
+
+func obuType(obu []byte) uint8 {
+	return (obu[0] >> 3) & 0x0F
+}
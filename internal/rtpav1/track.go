@@ -0,0 +1,49 @@
+package rtpav1
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/aler9/gortsplib"
+	psdp "github.com/pion/sdp/v3"
+)
+
+// NewTrack allocates an AV1 track.
+func NewTrack(payloadType uint8) *gortsplib.Track {
+	typ := strconv.FormatInt(int64(payloadType), 10)
+
+	return &gortsplib.Track{
+		Media: &psdp.MediaDescription{
+			MediaName: psdp.MediaName{
+				Media:   "video",
+				Protos:  []string{"RTP", "AVP"},
+				Formats: []string{typ},
+			},
+			Attributes: []psdp.Attribute{
+				{
+					Key:   "rtpmap",
+					Value: typ + " AV1/90000",
+				},
+			},
+		},
+	}
+}
+
+// IsTrack checks whether a track is an AV1 track.
+func IsTrack(t *gortsplib.Track) bool {
+	if t.Media.MediaName.Media != "video" {
+		return false
+	}
+
+	v, ok := t.Media.Attribute("rtpmap")
+	if !ok {
+		return false
+	}
+
+	vals := strings.Split(strings.TrimSpace(v), " ")
+	if len(vals) != 2 {
+		return false
+	}
+
+	return strings.HasPrefix(strings.ToUpper(vals[1]), "AV1/")
+}
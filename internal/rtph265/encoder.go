@@ -0,0 +1,151 @@
+// Package rtph265 contains a RTP/H265 encoder.
+package rtph265
+
+import (
+	"crypto/rand"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+const (
+	rtpVersion        = 0x02
+	rtpPayloadMaxSize = 1460  // 1500 (mtu) - 20 (ip header) - 8 (udp header) - 12 (rtp header)
+	rtpClockRate      = 90000 // h265 always uses 90khz
+)
+
+func randUint32() uint32 {
+	var b [4]byte
+	rand.Read(b[:])
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+// Encoder is a RTP/H265 encoder.
+// Specification: RFC7798
+type Encoder struct {
+	payloadType    uint8
+	sequenceNumber uint16
+	ssrc           uint32
+	initialTs      uint32
+}
+
+// NewEncoder allocates an Encoder.
+func NewEncoder(payloadType uint8,
+	sequenceNumber *uint16,
+	ssrc *uint32,
+	initialTs *uint32) *Encoder {
+	return &Encoder{
+		payloadType: payloadType,
+		sequenceNumber: func() uint16 {
+			if sequenceNumber != nil {
+				return *sequenceNumber
+			}
+			return uint16(randUint32())
+		}(),
+		ssrc: func() uint32 {
+			if ssrc != nil {
+				return *ssrc
+			}
+			return randUint32()
+		}(),
+		initialTs: func() uint32 {
+			if initialTs != nil {
+				return *initialTs
+			}
+			return randUint32()
+		}(),
+	}
+}
+
+func (e *Encoder) encodeTimestamp(ts time.Duration) uint32 {
+	return e.initialTs + uint32(ts.Seconds()*rtpClockRate)
+}
+
+// Encode encodes NALUs into RTP/H265 packets.
+func (e *Encoder) Encode(nalus [][]byte, pts time.Duration) ([]*rtp.Packet, error) {
+	var rets []*rtp.Packet
+
+	for i, nalu := range nalus {
+		// marker is used to indicate when all NALUs with same PTS have been sent
+		marker := (i == len(nalus)-1)
+
+		var pkts []*rtp.Packet
+		if len(nalu) <= rtpPayloadMaxSize {
+			pkts = e.writeSingle(nalu, pts, marker)
+		} else {
+			pkts = e.writeFragmented(nalu, pts, marker)
+		}
+
+		rets = append(rets, pkts...)
+	}
+
+	return rets, nil
+}
+
+func (e *Encoder) writeSingle(nalu []byte, pts time.Duration, marker bool) []*rtp.Packet {
+	pkt := &rtp.Packet{
+		Header: rtp.Header{
+			Version:        rtpVersion,
+			PayloadType:    e.payloadType,
+			SequenceNumber: e.sequenceNumber,
+			Timestamp:      e.encodeTimestamp(pts),
+			SSRC:           e.ssrc,
+			Marker:         marker,
+		},
+		Payload: nalu,
+	}
+
+	e.sequenceNumber++
+
+	return []*rtp.Packet{pkt}
+}
+
+func (e *Encoder) writeFragmented(nalu []byte, pts time.Duration, marker bool) []*rtp.Packet {
+	// each packet contains a 2-byte payload header and a 1-byte FU header
+	packetCount := (len(nalu) - 2 + rtpPayloadMaxSize - 4) / (rtpPayloadMaxSize - 3)
+
+	ret := make([]*rtp.Packet, packetCount)
+	encPTS := e.encodeTimestamp(pts)
+
+	// keep F, LayerId and TID of the original NALU
+	header0 := (nalu[0] & 0x81) | (uint8(NALUTypeFragmentationUnit) << 1)
+	header1 := nalu[1]
+	typ := uint8(NALUTypeOf(nalu))
+	nalu = nalu[2:] // remove header
+
+	for i := range ret {
+		start := uint8(0)
+		if i == 0 {
+			start = 1
+		}
+		end := uint8(0)
+		le := rtpPayloadMaxSize - 3
+		if i == (packetCount - 1) {
+			end = 1
+			le = len(nalu)
+		}
+
+		data := make([]byte, 3+le)
+		data[0] = header0
+		data[1] = header1
+		data[2] = (start << 7) | (end << 6) | typ
+		copy(data[3:], nalu[:le])
+		nalu = nalu[le:]
+
+		ret[i] = &rtp.Packet{
+			Header: rtp.Header{
+				Version:        rtpVersion,
+				PayloadType:    e.payloadType,
+				SequenceNumber: e.sequenceNumber,
+				Timestamp:      encPTS,
+				SSRC:           e.ssrc,
+				Marker:         (i == (packetCount-1) && marker),
+			},
+			Payload: data,
+		}
+
+		e.sequenceNumber++
+	}
+
+	return ret
+}
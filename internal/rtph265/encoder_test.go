@@ -0,0 +1,65 @@
+package rtph265
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncode(t *testing.T) {
+	sequenceNumber := uint16(0x44ed)
+	ssrc := uint32(0x9dbb7812)
+	initialTs := uint32(0x88776655)
+	e := NewEncoder(96, &sequenceNumber, &ssrc, &initialTs)
+
+	big := append([]byte{0x26, 0x01}, bytes.Repeat([]byte{0x01, 0x02, 0x03, 0x04}, 500)...)
+
+	pkts, err := e.Encode([][]byte{
+		{0x02, 0x01, 0xaa},
+		big,
+	}, 0)
+	require.NoError(t, err)
+
+	expected := []*rtp.Packet{
+		{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    96,
+				SequenceNumber: 0x44ed,
+				Timestamp:      0x88776655,
+				SSRC:           0x9dbb7812,
+			},
+			Payload: []byte{0x02, 0x01, 0xaa},
+		},
+		{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    96,
+				SequenceNumber: 0x44ee,
+				Timestamp:      0x88776655,
+				SSRC:           0x9dbb7812,
+			},
+			Payload: append([]byte{0x62, 0x01, 0x93}, big[2:2+1457]...),
+		},
+		{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    96,
+				SequenceNumber: 0x44ef,
+				Timestamp:      0x88776655,
+				SSRC:           0x9dbb7812,
+				Marker:         true,
+			},
+			Payload: append([]byte{0x62, 0x01, 0x53}, big[2+1457:]...),
+		},
+	}
+	require.Equal(t, expected, pkts)
+
+	pkts, err = e.Encode([][]byte{{0x02, 0x01, 0xbb}}, 1*time.Second)
+	require.NoError(t, err)
+	require.Equal(t, uint32(0x88776655+90000), pkts[0].Timestamp)
+	require.Equal(t, true, pkts[0].Marker)
+}
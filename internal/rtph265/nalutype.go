@@ -0,0 +1,19 @@
+package rtph265
+
+// NALUType is the type of a H265 NALU.
+type NALUType uint8
+
+// NALU types.
+const (
+	NALUTypeVPS                 NALUType = 32
+	NALUTypeSPS                 NALUType = 33
+	NALUTypePPS                 NALUType = 34
+	NALUTypeAccessUnitDelimiter NALUType = 35
+	NALUTypeAggregationUnit     NALUType = 48
+	NALUTypeFragmentationUnit   NALUType = 49
+)
+
+// NALUTypeOf returns the type of a NALU.
+func NALUTypeOf(nalu []byte) NALUType {
+	return NALUType((nalu[0] >> 1) & 0x3F)
+}
@@ -0,0 +1,61 @@
+package rtph265
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aler9/gortsplib"
+	psdp "github.com/pion/sdp/v3"
+)
+
+// NewTrack allocates a H265 track.
+func NewTrack(payloadType uint8, vps []byte, sps []byte, pps []byte) (*gortsplib.Track, error) {
+	if len(vps) < 2 || len(sps) < 2 || len(pps) < 2 {
+		return nil, fmt.Errorf("invalid parameter sets")
+	}
+
+	typ := strconv.FormatInt(int64(payloadType), 10)
+
+	return &gortsplib.Track{
+		Media: &psdp.MediaDescription{
+			MediaName: psdp.MediaName{
+				Media:   "video",
+				Protos:  []string{"RTP", "AVP"},
+				Formats: []string{typ},
+			},
+			Attributes: []psdp.Attribute{
+				{
+					Key:   "rtpmap",
+					Value: typ + " H265/90000",
+				},
+				{
+					Key: "fmtp",
+					Value: typ + " sprop-vps=" + base64.StdEncoding.EncodeToString(vps) + "; " +
+						"sprop-sps=" + base64.StdEncoding.EncodeToString(sps) + "; " +
+						"sprop-pps=" + base64.StdEncoding.EncodeToString(pps),
+				},
+			},
+		},
+	}, nil
+}
+
+// IsTrack checks whether a track is a H265 track.
+func IsTrack(t *gortsplib.Track) bool {
+	if t.Media.MediaName.Media != "video" {
+		return false
+	}
+
+	v, ok := t.Media.Attribute("rtpmap")
+	if !ok {
+		return false
+	}
+
+	vals := strings.Split(strings.TrimSpace(v), " ")
+	if len(vals) != 2 {
+		return false
+	}
+
+	return strings.HasPrefix(strings.ToUpper(vals[1]), "H265/")
+}
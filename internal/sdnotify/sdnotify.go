@@ -0,0 +1,33 @@
+// Package sdnotify contains functions to notify the service manager (systemd)
+// about the state of the server.
+package sdnotify
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// states that can be sent to the service manager.
+const (
+	Ready     = "READY=1"
+	Reloading = "RELOADING=1"
+	Stopping  = "STOPPING=1"
+	Watchdog  = "WATCHDOG=1"
+)
+
+// WatchdogInterval returns the interval within which the service manager
+// expects to receive watchdog notifications, or zero if the watchdog is disabled.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseUint(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec == 0 {
+		return 0
+	}
+
+	// the watchdog may be addressed to another process
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond
+}
@@ -0,0 +1,27 @@
+//go:build !windows
+// +build !windows
+
+package sdnotify
+
+import (
+	"net"
+	"os"
+)
+
+// Notify sends a state to the service manager.
+// It does nothing when the server is not started by a service manager.
+func Notify(state string) error {
+	sockPath := os.Getenv("NOTIFY_SOCKET")
+	if sockPath == "" {
+		return nil
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: sockPath, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
@@ -0,0 +1,353 @@
+package srt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// size of the payload of data packets, that can contain 7 MPEG-TS packets.
+	maxPayloadSize = 1316
+
+	tickInterval      = 100 * time.Millisecond
+	keepaliveInterval = 1 * time.Second
+	peerIdleTimeout   = 5 * time.Second
+
+	// packets are kept for retransmission for at least this duration,
+	// even if the latency is lower.
+	minDropThreshold = 1 * time.Second
+)
+
+type sentPacket struct {
+	seq  uint32
+	buf  []byte
+	sent time.Time
+}
+
+// Conn is a SRT connection that sends a live stream to the peer.
+// Packets sent by the peer are not delivered to the user.
+type Conn struct {
+	socketID     uint32
+	peerSocketID uint32
+	peerAddr     *net.UDPAddr
+	streamID     string
+	latency      time.Duration
+	start        time.Time
+	writeRaw     func([]byte) error
+	onClose      func()
+
+	mutex    sync.Mutex
+	nextSeq  uint32
+	nextMsg  uint32
+	sendBuf  []*sentPacket
+	lastSent time.Time
+	err      error
+
+	// in
+	in        chan []byte
+	terminate chan struct{}
+
+	// out
+	done chan struct{}
+}
+
+func newConn(
+	socketID uint32,
+	peerSocketID uint32,
+	peerAddr *net.UDPAddr,
+	streamID string,
+	latency time.Duration,
+	isn uint32,
+	start time.Time,
+	writeRaw func([]byte) error,
+	onClose func(),
+) *Conn {
+	c := &Conn{
+		socketID:     socketID,
+		peerSocketID: peerSocketID,
+		peerAddr:     peerAddr,
+		streamID:     streamID,
+		latency:      latency,
+		start:        start,
+		writeRaw:     writeRaw,
+		onClose:      onClose,
+		nextSeq:      isn,
+		nextMsg:      1,
+		lastSent:     time.Now(),
+		in:           make(chan []byte, 64),
+		terminate:    make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+
+	go c.run()
+
+	return c
+}
+
+// Close closes the connection and notifies the peer.
+func (c *Conn) Close() error {
+	close(c.terminate)
+	<-c.done
+	return nil
+}
+
+// RemoteAddr returns the address of the peer.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.peerAddr
+}
+
+// StreamID returns the stream ID of the connection.
+func (c *Conn) StreamID() string {
+	return c.streamID
+}
+
+// Latency returns the latency negotiated with the peer.
+func (c *Conn) Latency() time.Duration {
+	return c.latency
+}
+
+func (c *Conn) timestamp(now time.Time) uint32 {
+	return uint32(now.Sub(c.start) / time.Microsecond)
+}
+
+// Write sends data to the peer. Data is split into packets,
+// therefore MPEG-TS streams should be written in multiples of 188 bytes.
+// Packets that are not acknowledged in time are retransmitted.
+func (c *Conn) Write(p []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	now := time.Now()
+	c.dropExpired(now)
+
+	n := 0
+	for len(p) > 0 {
+		size := len(p)
+		if size > maxPayloadSize {
+			size = maxPayloadSize
+		}
+
+		pkt := &sentPacket{
+			seq: c.nextSeq,
+			buf: dataPacket{
+				seq:         c.nextSeq,
+				msgNo:       c.nextMsg,
+				timestamp:   c.timestamp(now),
+				dstSocketID: c.peerSocketID,
+				payload:     p[:size],
+			}.marshal(),
+			sent: now,
+		}
+		c.nextSeq = seqNext(c.nextSeq)
+		c.nextMsg = msgNext(c.nextMsg)
+
+		// the packet is buffered even if it can't be sent,
+		// in order to keep sequence numbers of the buffer consecutive.
+		c.sendBuf = append(c.sendBuf, pkt)
+
+		err := c.writeRaw(pkt.buf)
+		if err != nil {
+			return n, err
+		}
+
+		p = p[size:]
+		n += size
+	}
+
+	c.lastSent = now
+	return n, nil
+}
+
+// dropExpired removes the packets that would reach the peer too late to be played.
+func (c *Conn) dropExpired(now time.Time) {
+	threshold := c.latency * 5 / 4
+	if threshold < minDropThreshold {
+		threshold = minDropThreshold
+	}
+
+	i := 0
+	for i < len(c.sendBuf) && now.Sub(c.sendBuf[i].sent) > threshold {
+		i++
+	}
+	c.sendBuf = c.sendBuf[i:]
+}
+
+// push is called by the routine that reads from the socket.
+// Packets are discarded when the connection is too slow to process them.
+func (c *Conn) push(buf []byte) {
+	select {
+	case c.in <- buf:
+	default:
+	}
+}
+
+func (c *Conn) writeControl(typ controlType, typeSpecific uint32, cif []byte) error {
+	return c.writeRaw(controlPacket{
+		typ:          typ,
+		typeSpecific: typeSpecific,
+		timestamp:    c.timestamp(time.Now()),
+		dstSocketID:  c.peerSocketID,
+		cif:          cif,
+	}.marshal())
+}
+
+func (c *Conn) run() {
+	defer close(c.done)
+
+	err := c.runInner()
+
+	c.mutex.Lock()
+	c.err = err
+	c.sendBuf = nil
+	c.mutex.Unlock()
+
+	c.onClose()
+}
+
+func (c *Conn) runInner() error {
+	t := time.NewTicker(tickInterval)
+	defer t.Stop()
+
+	lastReceived := time.Now()
+
+	for {
+		select {
+		case buf := <-c.in:
+			lastReceived = time.Now()
+
+			err := c.handlePacket(buf)
+			if err != nil {
+				return err
+			}
+
+		case now := <-t.C:
+			if now.Sub(lastReceived) >= peerIdleTimeout {
+				return fmt.Errorf("no packets received from the peer in %v", peerIdleTimeout)
+			}
+
+			c.mutex.Lock()
+			idle := now.Sub(c.lastSent) >= keepaliveInterval
+			if idle {
+				c.lastSent = now
+			}
+			c.mutex.Unlock()
+
+			if idle {
+				c.writeControl(controlTypeKeepalive, 0, nil)
+			}
+
+		case <-c.terminate:
+			c.writeControl(controlTypeShutdown, 0, nil)
+			return fmt.Errorf("terminated")
+		}
+	}
+}
+
+func (c *Conn) handlePacket(buf []byte) error {
+	// data sent by the peer is discarded
+	if !isControlPacket(buf) {
+		return nil
+	}
+
+	var pkt controlPacket
+	err := pkt.unmarshal(buf)
+	if err != nil {
+		return nil
+	}
+
+	switch pkt.typ {
+	case controlTypeACK:
+		if len(pkt.cif) < 4 {
+			return nil
+		}
+		c.onACK(binary.BigEndian.Uint32(pkt.cif) & maxSeq)
+
+		// full ACKs are acknowledged, in order to allow the peer to compute the RTT
+		if pkt.typeSpecific != 0 && len(pkt.cif) > 4 {
+			c.writeControl(controlTypeACKACK, pkt.typeSpecific, nil)
+		}
+
+	case controlTypeNAK:
+		ranges, err := parseLossList(pkt.cif)
+		if err != nil {
+			return nil
+		}
+		c.onNAK(ranges)
+
+	case controlTypeShutdown:
+		return fmt.Errorf("connection closed by the peer")
+	}
+
+	return nil
+}
+
+// onACK removes the packets that have been received by the peer.
+// The sequence number is the one of the next packet that the peer expects.
+func (c *Conn) onACK(seq uint32) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	i := 0
+	for i < len(c.sendBuf) && seqDiff(c.sendBuf[i].seq, seq) < 0 {
+		i++
+	}
+	c.sendBuf = c.sendBuf[i:]
+}
+
+// onNAK retransmits the packets that have been lost. The peer is asked
+// to stop waiting for packets that are not available anymore.
+func (c *Conn) onNAK(ranges []lossRange) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, r := range ranges {
+		if seqDiff(r.last, r.first) < 0 {
+			continue
+		}
+
+		var first uint32
+		if len(c.sendBuf) > 0 {
+			first = c.sendBuf[0].seq
+		} else {
+			first = c.nextSeq
+		}
+
+		if seqDiff(r.first, first) < 0 {
+			dropLast := r.last
+			if seqDiff(dropLast, first) >= 0 {
+				dropLast = (first - 1) & maxSeq
+			}
+
+			cif := make([]byte, 8)
+			binary.BigEndian.PutUint32(cif[0:], r.first)
+			binary.BigEndian.PutUint32(cif[4:], dropLast)
+			c.writeControl(controlTypeDropReq, 0, cif)
+		}
+
+		// the buffer contains consecutive sequence numbers
+		start := int(seqDiff(r.first, first))
+		if start < 0 {
+			start = 0
+		}
+		end := int(seqDiff(r.last, first))
+		if end >= len(c.sendBuf) {
+			end = len(c.sendBuf) - 1
+		}
+
+		if start > end {
+			continue
+		}
+
+		for _, pkt := range c.sendBuf[start : end+1] {
+			binary.BigEndian.PutUint32(pkt.buf[4:], binary.BigEndian.Uint32(pkt.buf[4:])|dataFlagRetransmit)
+			c.writeRaw(pkt.buf)
+		}
+	}
+}
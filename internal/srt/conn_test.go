@@ -0,0 +1,377 @@
+package srt
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testPeer is a SRT receiver whose packets are written by hand.
+type testPeer struct {
+	t    *testing.T
+	pc   *net.UDPConn
+	addr *net.UDPAddr
+}
+
+func (p *testPeer) read() []byte {
+	p.pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, mtu)
+	n, addr, err := p.pc.ReadFromUDP(buf)
+	require.NoError(p.t, err)
+	p.addr = addr
+	return buf[:n]
+}
+
+// readControl returns the next control packet, skipping keepalives and data.
+func (p *testPeer) readControl() controlPacket {
+	for {
+		buf := p.read()
+		if !isControlPacket(buf) {
+			continue
+		}
+
+		var pkt controlPacket
+		err := pkt.unmarshal(buf)
+		require.NoError(p.t, err)
+
+		if pkt.typ != controlTypeKeepalive {
+			return pkt
+		}
+	}
+}
+
+func (p *testPeer) readHandshake() (controlPacket, handshake) {
+	pkt := p.readControl()
+	require.Equal(p.t, controlTypeHandshake, pkt.typ)
+
+	var h handshake
+	err := h.unmarshal(pkt.cif)
+	require.NoError(p.t, err)
+
+	return pkt, h
+}
+
+// readData returns the next data packet and its raw content.
+func (p *testPeer) readData() (dataPacket, []byte) {
+	for {
+		buf := p.read()
+		if isControlPacket(buf) {
+			continue
+		}
+
+		var pkt dataPacket
+		err := pkt.unmarshal(buf)
+		require.NoError(p.t, err)
+		return pkt, buf
+	}
+}
+
+func (p *testPeer) write(pkt controlPacket) {
+	_, err := p.pc.WriteToUDP(pkt.marshal(), p.addr)
+	require.NoError(p.t, err)
+}
+
+func (p *testPeer) writeHandshake(dst uint32, h handshake) {
+	p.write(controlPacket{
+		typ:         controlTypeHandshake,
+		dstSocketID: dst,
+		cif:         h.marshal(),
+	})
+}
+
+// waitClosed waits until the connection is closed because of the peer.
+func waitClosed(t *testing.T, c *Conn) {
+	for i := 0; i < 20; i++ {
+		_, err := c.Write(make([]byte, 188))
+		if err != nil {
+			require.EqualError(t, err, "connection closed by the peer")
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Errorf("connection not closed")
+}
+
+func TestDial(t *testing.T) {
+	pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer pc.Close()
+
+	p := &testPeer{t: t, pc: pc}
+
+	type dialRes struct {
+		c   *Conn
+		err error
+	}
+	dialDone := make(chan dialRes)
+
+	go func() {
+		c, err := Dial(context.Background(), &URL{
+			Host:     pc.LocalAddr().String(),
+			StreamID: "live/mystream",
+			Latency:  200 * time.Millisecond,
+		})
+		dialDone <- dialRes{c, err}
+	}()
+
+	pkt, req := p.readHandshake()
+	require.Equal(t, uint32(0), pkt.dstSocketID)
+	require.Equal(t, uint32(4), req.version)
+	require.Equal(t, uint16(handshakeDgram), req.extensionField)
+	require.Equal(t, uint32(handshakeTypeInduction), req.typ)
+	callerID := req.socketID
+	isn := req.isn
+
+	p.writeHandshake(callerID, handshake{
+		version:        5,
+		extensionField: handshakeMagic,
+		isn:            isn,
+		mtu:            mtu,
+		flowWindow:     flowWindow,
+		typ:            handshakeTypeInduction,
+		cookie:         1234,
+	})
+
+	pkt, req = p.readHandshake()
+	require.Equal(t, uint32(0), pkt.dstSocketID)
+	require.Equal(t, uint32(5), req.version)
+	require.Equal(t, uint16(handshakeExtFlagHSREQ|handshakeExtFlagConfig), req.extensionField)
+	require.Equal(t, uint32(handshakeTypeConclusion), req.typ)
+	require.Equal(t, uint32(1234), req.cookie)
+	require.Equal(t, callerID, req.socketID)
+	require.Equal(t, isn, req.isn)
+	require.Equal(t, "live/mystream", req.streamID)
+	require.Equal(t, uint16(handshakeExtTypeHSREQ), req.srtExtType)
+	require.Equal(t, &handshakeSRTExt{
+		version:     srtVersion,
+		flags:       srtFlags,
+		recvLatency: 200 * time.Millisecond,
+		sendLatency: 200 * time.Millisecond,
+	}, req.srtExt)
+
+	p.writeHandshake(callerID, handshake{
+		version:        5,
+		extensionField: handshakeExtFlagHSREQ,
+		isn:            isn,
+		mtu:            mtu,
+		flowWindow:     flowWindow,
+		typ:            handshakeTypeConclusion,
+		socketID:       5678,
+		srtExtType:     handshakeExtTypeHSRSP,
+		srtExt: &handshakeSRTExt{
+			version:     srtVersion,
+			flags:       srtFlags,
+			recvLatency: 300 * time.Millisecond,
+			sendLatency: 300 * time.Millisecond,
+		},
+	})
+
+	res := <-dialDone
+	require.NoError(t, res.err)
+	c := res.c
+	defer c.Close()
+	require.Equal(t, 300*time.Millisecond, c.Latency())
+
+	// data is split into packets
+	n, err := c.Write(make([]byte, 188*10))
+	require.NoError(t, err)
+	require.Equal(t, 188*10, n)
+
+	data, _ := p.readData()
+	require.Equal(t, isn, data.seq)
+	require.Equal(t, uint32(5678), data.dstSocketID)
+	require.Equal(t, uint32(1), data.msgNo)
+	require.Equal(t, 1316, len(data.payload))
+
+	data, _ = p.readData()
+	require.Equal(t, seqNext(isn), data.seq)
+	require.Equal(t, uint32(2), data.msgNo)
+	require.Equal(t, 188*10-1316, len(data.payload))
+
+	// lost packets are retransmitted
+	cif := make([]byte, 4)
+	binary.BigEndian.PutUint32(cif, isn)
+	p.write(controlPacket{typ: controlTypeNAK, dstSocketID: callerID, cif: cif})
+
+	data, raw := p.readData()
+	require.Equal(t, isn, data.seq)
+	require.NotEqual(t, uint32(0), binary.BigEndian.Uint32(raw[4:])&dataFlagRetransmit)
+
+	// full ACKs are acknowledged
+	cif = make([]byte, 28)
+	binary.BigEndian.PutUint32(cif, seqNext(seqNext(isn)))
+	p.write(controlPacket{typ: controlTypeACK, typeSpecific: 1, dstSocketID: callerID, cif: cif})
+
+	pkt = p.readControl()
+	require.Equal(t, controlTypeACKACK, pkt.typ)
+	require.Equal(t, uint32(1), pkt.typeSpecific)
+	require.Equal(t, uint32(5678), pkt.dstSocketID)
+
+	// acknowledged packets can't be retransmitted anymore
+	cif = make([]byte, 4)
+	binary.BigEndian.PutUint32(cif, isn)
+	p.write(controlPacket{typ: controlTypeNAK, dstSocketID: callerID, cif: cif})
+
+	pkt = p.readControl()
+	require.Equal(t, controlTypeDropReq, pkt.typ)
+	require.Equal(t, []byte{
+		byte(isn >> 24), byte(isn >> 16), byte(isn >> 8), byte(isn),
+		byte(isn >> 24), byte(isn >> 16), byte(isn >> 8), byte(isn),
+	}, pkt.cif)
+
+	p.write(controlPacket{typ: controlTypeShutdown, dstSocketID: callerID})
+	waitClosed(t, c)
+}
+
+func TestDialRejected(t *testing.T) {
+	pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer pc.Close()
+
+	p := &testPeer{t: t, pc: pc}
+
+	dialDone := make(chan error)
+	go func() {
+		_, err := Dial(context.Background(), &URL{Host: pc.LocalAddr().String(), Latency: defaultLatency})
+		dialDone <- err
+	}()
+
+	_, req := p.readHandshake()
+	p.writeHandshake(req.socketID, handshake{version: 5, typ: rejectionBacklog})
+
+	require.EqualError(t, <-dialDone, "connection rejected by the peer: too many connections")
+}
+
+func TestListen(t *testing.T) {
+	l, err := Listen(&URL{
+		Host:     "127.0.0.1:0",
+		Mode:     ModeListener,
+		StreamID: "mystream",
+		Latency:  120 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer l.Close()
+
+	pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer pc.Close()
+
+	p := &testPeer{t: t, pc: pc, addr: l.Addr().(*net.UDPAddr)}
+
+	const callerID = 1234
+	const isn = 5678
+
+	p.writeHandshake(0, handshake{
+		version:        4,
+		extensionField: handshakeDgram,
+		isn:            isn,
+		mtu:            mtu,
+		flowWindow:     flowWindow,
+		typ:            handshakeTypeInduction,
+		socketID:       callerID,
+	})
+
+	pkt, res := p.readHandshake()
+	require.Equal(t, uint32(callerID), pkt.dstSocketID)
+	require.Equal(t, uint32(5), res.version)
+	require.Equal(t, uint16(handshakeMagic), res.extensionField)
+	require.Equal(t, uint32(handshakeTypeInduction), res.typ)
+	cookie := res.cookie
+
+	conclusion := handshake{
+		version:        5,
+		extensionField: handshakeExtFlagHSREQ | handshakeExtFlagConfig,
+		isn:            isn,
+		mtu:            mtu,
+		flowWindow:     flowWindow,
+		typ:            handshakeTypeConclusion,
+		socketID:       callerID,
+		cookie:         cookie,
+		srtExtType:     handshakeExtTypeHSREQ,
+		srtExt: &handshakeSRTExt{
+			version:     srtVersion,
+			flags:       srtFlags,
+			recvLatency: 500 * time.Millisecond,
+			sendLatency: 500 * time.Millisecond,
+		},
+		streamID: "otherstream",
+	}
+
+	// stream IDs are checked
+	p.writeHandshake(0, conclusion)
+	_, res = p.readHandshake()
+	require.Equal(t, uint32(rejectionForbidden), res.typ)
+
+	conclusion.streamID = "mystream"
+	p.writeHandshake(0, conclusion)
+
+	pkt, res = p.readHandshake()
+	require.Equal(t, uint32(callerID), pkt.dstSocketID)
+	require.Equal(t, uint32(handshakeTypeConclusion), res.typ)
+	require.Equal(t, uint32(isn), res.isn)
+	require.NotEqual(t, uint32(0), res.socketID)
+	require.Equal(t, uint16(handshakeExtTypeHSRSP), res.srtExtType)
+	require.Equal(t, 500*time.Millisecond, res.srtExt.recvLatency)
+	listenerID := res.socketID
+
+	// the response is sent again when the request is repeated
+	p.writeHandshake(0, conclusion)
+	_, res = p.readHandshake()
+	require.Equal(t, listenerID, res.socketID)
+
+	c, err := l.Accept(context.Background())
+	require.NoError(t, err)
+	defer c.Close()
+	require.Equal(t, "mystream", c.StreamID())
+	require.Equal(t, 500*time.Millisecond, c.Latency())
+
+	_, err = c.Write(make([]byte, 188))
+	require.NoError(t, err)
+
+	data, _ := p.readData()
+	require.Equal(t, uint32(isn), data.seq)
+	require.Equal(t, uint32(callerID), data.dstSocketID)
+	require.Equal(t, 188, len(data.payload))
+
+	p.write(controlPacket{typ: controlTypeShutdown, dstSocketID: listenerID})
+	waitClosed(t, c)
+}
+
+func TestDialListen(t *testing.T) {
+	l, err := Listen(&URL{
+		Host:     "127.0.0.1:0",
+		Mode:     ModeListener,
+		StreamID: "mystream",
+		Latency:  120 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer l.Close()
+
+	_, err = Dial(context.Background(), &URL{
+		Host:     l.Addr().String(),
+		StreamID: "otherstream",
+		Latency:  defaultLatency,
+	})
+	require.EqualError(t, err, "connection rejected by the peer: the stream ID is not allowed")
+
+	c1, err := Dial(context.Background(), &URL{
+		Host:     l.Addr().String(),
+		StreamID: "mystream",
+		Latency:  200 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 200*time.Millisecond, c1.Latency())
+
+	c2, err := l.Accept(context.Background())
+	require.NoError(t, err)
+	defer c2.Close()
+	require.Equal(t, 200*time.Millisecond, c2.Latency())
+
+	// the peer is notified when the connection is closed
+	c1.Close()
+	waitClosed(t, c2)
+}
@@ -0,0 +1,215 @@
+package srt
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// interval between retransmissions of handshake requests.
+const handshakeRetryInterval = 250 * time.Millisecond
+
+func randUint32() uint32 {
+	var b [4]byte
+	rand.Read(b[:])
+	return binary.BigEndian.Uint32(b[:])
+}
+
+// newSocketID returns a random socket ID. Zero is reserved to connection requests.
+func newSocketID() uint32 {
+	for {
+		if id := randUint32() & 0x3FFFFFFF; id != 0 {
+			return id
+		}
+	}
+}
+
+// handshakeRoundTrip sends a handshake request until a response is received,
+// or the context is canceled.
+func handshakeRoundTrip(
+	ctx context.Context,
+	nconn *net.UDPConn,
+	start time.Time,
+	socketID uint32,
+	req *handshake,
+) (*handshake, error) {
+	reqBuf := controlPacket{
+		typ:       controlTypeHandshake,
+		timestamp: uint32(time.Since(start) / time.Microsecond),
+		cif:       req.marshal(),
+	}.marshal()
+
+	buf := make([]byte, mtu)
+
+	for {
+		_, err := nconn.Write(reqBuf)
+		if err != nil {
+			return nil, err
+		}
+
+		deadline := time.Now().Add(handshakeRetryInterval)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("handshake timed out")
+			default:
+			}
+
+			nconn.SetReadDeadline(deadline)
+			n, err := nconn.Read(buf)
+			if err != nil {
+				var nerr net.Error
+				if errors.As(err, &nerr) && nerr.Timeout() {
+					break
+				}
+				return nil, err
+			}
+
+			var pkt controlPacket
+			if pkt.unmarshal(buf[:n]) != nil || pkt.typ != controlTypeHandshake || pkt.dstSocketID != socketID {
+				continue
+			}
+
+			var res handshake
+			if res.unmarshal(pkt.cif) != nil {
+				continue
+			}
+
+			if res.typ >= handshakeTypeRejection && res.typ != handshakeTypeConclusion {
+				return nil, rejectionError{res.typ}
+			}
+
+			// skip responses to previous requests
+			if res.typ != req.typ {
+				continue
+			}
+
+			return &res, nil
+		}
+	}
+}
+
+// Dial connects to a SRT listener.
+func Dial(ctx context.Context, u *URL) (*Conn, error) {
+	addr, err := net.ResolveUDPAddr("udp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	nconn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := dialInner(ctx, nconn, addr, u)
+	if err != nil {
+		nconn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func dialInner(ctx context.Context, nconn *net.UDPConn, addr *net.UDPAddr, u *URL) (*Conn, error) {
+	socketID := newSocketID()
+	isn := randUint32() & maxSeq
+	start := time.Now()
+
+	res, err := handshakeRoundTrip(ctx, nconn, start, socketID, &handshake{
+		version:        4,
+		extensionField: handshakeDgram,
+		isn:            isn,
+		mtu:            mtu,
+		flowWindow:     flowWindow,
+		typ:            handshakeTypeInduction,
+		socketID:       socketID,
+		peerIP:         addr.IP,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if res.version != 5 || res.extensionField != handshakeMagic {
+		return nil, fmt.Errorf("the listener doesn't support version 5 of the protocol")
+	}
+
+	if res.encryptionField != 0 {
+		return nil, fmt.Errorf("the listener requires encryption, that is not supported")
+	}
+
+	extFlags := uint16(handshakeExtFlagHSREQ)
+	if u.StreamID != "" {
+		extFlags |= handshakeExtFlagConfig
+	}
+
+	res, err = handshakeRoundTrip(ctx, nconn, start, socketID, &handshake{
+		version:        5,
+		extensionField: extFlags,
+		isn:            isn,
+		mtu:            mtu,
+		flowWindow:     flowWindow,
+		typ:            handshakeTypeConclusion,
+		socketID:       socketID,
+		cookie:         res.cookie,
+		peerIP:         addr.IP,
+		srtExtType:     handshakeExtTypeHSREQ,
+		srtExt: &handshakeSRTExt{
+			version:     srtVersion,
+			flags:       srtFlags,
+			recvLatency: u.Latency,
+			sendLatency: u.Latency,
+		},
+		streamID: u.StreamID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	latency := u.Latency
+	if res.srtExt != nil && res.srtExt.recvLatency > latency {
+		latency = res.srtExt.recvLatency
+	}
+
+	nconn.SetReadDeadline(time.Time{})
+
+	c := newConn(
+		socketID,
+		res.socketID,
+		addr,
+		u.StreamID,
+		latency,
+		isn,
+		start,
+		func(buf []byte) error {
+			_, err := nconn.Write(buf)
+			return err
+		},
+		func() {
+			nconn.Close()
+		})
+
+	go func() {
+		for {
+			buf := make([]byte, mtu)
+			n, err := nconn.Read(buf)
+			if err != nil {
+				// errors caused by ICMP messages are not fatal
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				continue
+			}
+
+			if dst, ok := packetDestination(buf[:n]); ok && dst == socketID {
+				c.push(buf[:n])
+			}
+		}
+	}()
+
+	return c, nil
+}
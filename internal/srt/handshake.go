@@ -0,0 +1,225 @@
+package srt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	handshakeSize = 48
+
+	// value of the extension field of the induction response of listeners that support HSv5.
+	handshakeMagic = 0x4A17
+
+	// extension field of induction requests (UDT_DGRAM).
+	handshakeDgram = 2
+
+	handshakeTypeInduction  = 0x00000001
+	handshakeTypeConclusion = 0xFFFFFFFF
+
+	// handshake types greater or equal than this value are rejections.
+	handshakeTypeRejection = 1000
+
+	// flags of the extension field of conclusion requests.
+	handshakeExtFlagHSREQ  = 0x0001
+	handshakeExtFlagKMREQ  = 0x0002
+	handshakeExtFlagConfig = 0x0004
+
+	handshakeExtTypeHSREQ = 1
+	handshakeExtTypeHSRSP = 2
+	handshakeExtTypeKMREQ = 3
+	handshakeExtTypeSID   = 5
+
+	// version of the protocol implemented by libsrt that is advertised to peers.
+	srtVersion = 0x00010401
+
+	// flags of the HSREQ and HSRSP extensions.
+	srtFlagTSBPDSND    = 0x01
+	srtFlagTSBPDRCV    = 0x02
+	srtFlagTLPktDrop   = 0x08
+	srtFlagPeriodicNAK = 0x10
+	srtFlagRexmit      = 0x20
+
+	srtFlags = srtFlagTSBPDSND | srtFlagTSBPDRCV | srtFlagTLPktDrop | srtFlagPeriodicNAK | srtFlagRexmit
+
+	mtu        = 1500
+	flowWindow = 8192
+)
+
+// rejection reasons, as defined by libsrt.
+const (
+	rejectionPeer      = handshakeTypeRejection + 2
+	rejectionBacklog   = handshakeTypeRejection + 5
+	rejectionVersion   = handshakeTypeRejection + 8
+	rejectionUnsecure  = handshakeTypeRejection + 11
+	rejectionForbidden = handshakeTypeRejection + 1403
+)
+
+// handshakeSRTExt is the content of a HSREQ or HSRSP extension.
+type handshakeSRTExt struct {
+	version     uint32
+	flags       uint32
+	recvLatency time.Duration
+	sendLatency time.Duration
+}
+
+type handshake struct {
+	version         uint32
+	encryptionField uint16
+	extensionField  uint16
+	isn             uint32
+	mtu             uint32
+	flowWindow      uint32
+	typ             uint32
+	socketID        uint32
+	cookie          uint32
+	peerIP          net.IP
+
+	srtExtType uint16
+	srtExt     *handshakeSRTExt
+	streamID   string
+	encrypted  bool
+}
+
+// reversed returns a copy of a buffer in which the bytes of every 32-bit word are reversed.
+// libsrt encodes stream IDs and peer IPs in this way.
+func reversed(buf []byte) []byte {
+	ret := make([]byte, (len(buf)+3)/4*4)
+	copy(ret, buf)
+
+	for i := 0; i < len(ret); i += 4 {
+		ret[i], ret[i+1], ret[i+2], ret[i+3] = ret[i+3], ret[i+2], ret[i+1], ret[i]
+	}
+
+	return ret
+}
+
+func durationMS(v uint16) time.Duration {
+	return time.Duration(v) * time.Millisecond
+}
+
+func (h handshake) marshal() []byte {
+	buf := make([]byte, handshakeSize)
+	binary.BigEndian.PutUint32(buf[0:], h.version)
+	binary.BigEndian.PutUint16(buf[4:], h.encryptionField)
+	binary.BigEndian.PutUint16(buf[6:], h.extensionField)
+	binary.BigEndian.PutUint32(buf[8:], h.isn)
+	binary.BigEndian.PutUint32(buf[12:], h.mtu)
+	binary.BigEndian.PutUint32(buf[16:], h.flowWindow)
+	binary.BigEndian.PutUint32(buf[20:], h.typ)
+	binary.BigEndian.PutUint32(buf[24:], h.socketID)
+	binary.BigEndian.PutUint32(buf[28:], h.cookie)
+
+	if ip4 := h.peerIP.To4(); ip4 != nil {
+		copy(buf[32:], reversed(ip4))
+	} else if len(h.peerIP) == net.IPv6len {
+		copy(buf[32:], reversed(h.peerIP))
+	}
+
+	if h.srtExt != nil {
+		ext := make([]byte, 16)
+		binary.BigEndian.PutUint16(ext[0:], h.srtExtType)
+		binary.BigEndian.PutUint16(ext[2:], 3)
+		binary.BigEndian.PutUint32(ext[4:], h.srtExt.version)
+		binary.BigEndian.PutUint32(ext[8:], h.srtExt.flags)
+		binary.BigEndian.PutUint16(ext[12:], uint16(h.srtExt.recvLatency/time.Millisecond))
+		binary.BigEndian.PutUint16(ext[14:], uint16(h.srtExt.sendLatency/time.Millisecond))
+		buf = append(buf, ext...)
+	}
+
+	if h.streamID != "" {
+		content := reversed([]byte(h.streamID))
+		ext := make([]byte, 4)
+		binary.BigEndian.PutUint16(ext[0:], handshakeExtTypeSID)
+		binary.BigEndian.PutUint16(ext[2:], uint16(len(content)/4))
+		buf = append(buf, ext...)
+		buf = append(buf, content...)
+	}
+
+	return buf
+}
+
+func (h *handshake) unmarshal(buf []byte) error {
+	if len(buf) < handshakeSize {
+		return fmt.Errorf("handshake is too short")
+	}
+
+	h.version = binary.BigEndian.Uint32(buf[0:])
+	h.encryptionField = binary.BigEndian.Uint16(buf[4:])
+	h.extensionField = binary.BigEndian.Uint16(buf[6:])
+	h.isn = binary.BigEndian.Uint32(buf[8:]) & maxSeq
+	h.mtu = binary.BigEndian.Uint32(buf[12:])
+	h.flowWindow = binary.BigEndian.Uint32(buf[16:])
+	h.typ = binary.BigEndian.Uint32(buf[20:])
+	h.socketID = binary.BigEndian.Uint32(buf[24:])
+	h.cookie = binary.BigEndian.Uint32(buf[28:])
+	buf = buf[handshakeSize:]
+
+	// extensions are present in conclusion packets only
+	if h.typ != handshakeTypeConclusion {
+		return nil
+	}
+
+	for len(buf) >= 4 {
+		typ := binary.BigEndian.Uint16(buf[0:])
+		size := int(binary.BigEndian.Uint16(buf[2:])) * 4
+		buf = buf[4:]
+
+		if len(buf) < size {
+			return fmt.Errorf("invalid handshake extension")
+		}
+		content := buf[:size]
+		buf = buf[size:]
+
+		switch typ {
+		case handshakeExtTypeHSREQ, handshakeExtTypeHSRSP:
+			if len(content) < 12 {
+				return fmt.Errorf("invalid handshake extension")
+			}
+
+			h.srtExtType = typ
+			h.srtExt = &handshakeSRTExt{
+				version:     binary.BigEndian.Uint32(content[0:]),
+				flags:       binary.BigEndian.Uint32(content[4:]),
+				recvLatency: durationMS(binary.BigEndian.Uint16(content[8:])),
+				sendLatency: durationMS(binary.BigEndian.Uint16(content[10:])),
+			}
+
+		case handshakeExtTypeKMREQ:
+			h.encrypted = true
+
+		case handshakeExtTypeSID:
+			sid := reversed(content)
+			for len(sid) > 0 && sid[len(sid)-1] == 0 {
+				sid = sid[:len(sid)-1]
+			}
+			h.streamID = string(sid)
+		}
+	}
+
+	return nil
+}
+
+// rejectionError is returned when the peer rejects the connection.
+type rejectionError struct {
+	reason uint32
+}
+
+// Error implements the error interface.
+func (e rejectionError) Error() string {
+	switch e.reason {
+	case rejectionPeer:
+		return "connection rejected by the peer"
+	case rejectionBacklog:
+		return "connection rejected by the peer: too many connections"
+	case rejectionVersion:
+		return "connection rejected by the peer: unsupported version"
+	case rejectionUnsecure:
+		return "connection rejected by the peer: encryption is required"
+	case rejectionForbidden:
+		return "connection rejected by the peer: the stream ID is not allowed"
+	}
+	return fmt.Sprintf("connection rejected by the peer (reason %d)", e.reason-handshakeTypeRejection)
+}
@@ -0,0 +1,49 @@
+package srt
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandshakeMarshal(t *testing.T) {
+	h := handshake{
+		version:        5,
+		extensionField: handshakeExtFlagHSREQ | handshakeExtFlagConfig,
+		isn:            0x12345678,
+		mtu:            mtu,
+		flowWindow:     flowWindow,
+		typ:            handshakeTypeConclusion,
+		socketID:       0x0a0b0c0d,
+		cookie:         0x01020304,
+		peerIP:         net.ParseIP("192.168.1.10"),
+		srtExtType:     handshakeExtTypeHSREQ,
+		srtExt: &handshakeSRTExt{
+			version:     srtVersion,
+			flags:       srtFlags,
+			recvLatency: 120 * time.Millisecond,
+			sendLatency: 240 * time.Millisecond,
+		},
+		streamID: "abcdef",
+	}
+
+	buf := h.marshal()
+	require.Equal(t, []byte{10, 1, 168, 192}, buf[32:36])
+	require.Equal(t, []byte{
+		0x00, 0x01, 0x00, 0x03, // HSREQ
+		0x00, 0x01, 0x04, 0x01,
+		0x00, 0x00, 0x00, 0x3b,
+		0x00, 0x78, 0x00, 0xf0,
+		0x00, 0x05, 0x00, 0x02, // stream ID
+		'd', 'c', 'b', 'a',
+		0x00, 0x00, 'f', 'e',
+	}, buf[handshakeSize:])
+
+	var dec handshake
+	err := dec.unmarshal(buf)
+	require.NoError(t, err)
+	dec.peerIP = h.peerIP
+	require.Equal(t, h, dec)
+}
@@ -0,0 +1,287 @@
+package srt
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"sync"
+	"time"
+)
+
+// Listener waits for connections of SRT callers.
+// Callers that connect while another one is waiting to be accepted are rejected.
+type Listener struct {
+	u            *URL
+	pc           *net.UDPConn
+	cookieSecret uint32
+	start        time.Time
+
+	mutex sync.Mutex
+	conns map[uint32]*listenerConn
+
+	// out
+	accept chan *Conn
+	done   chan struct{}
+}
+
+type listenerConn struct {
+	c        *Conn
+	peerAddr string
+	peerID   uint32
+	response []byte
+}
+
+// Listen creates a listener.
+func Listen(u *URL) (*Listener, error) {
+	addr, err := net.ResolveUDPAddr("udp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	pc, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Listener{
+		u:            u,
+		pc:           pc,
+		cookieSecret: randUint32(),
+		start:        time.Now(),
+		conns:        make(map[uint32]*listenerConn),
+		accept:       make(chan *Conn, 1),
+		done:         make(chan struct{}),
+	}
+
+	go l.run()
+
+	return l, nil
+}
+
+// Close closes the listener.
+// Connections that have been accepted are not closed, but can't send packets anymore.
+func (l *Listener) Close() error {
+	l.pc.Close()
+	<-l.done
+
+	select {
+	case c := <-l.accept:
+		c.Close()
+	default:
+	}
+
+	return nil
+}
+
+// Addr returns the address of the listener.
+func (l *Listener) Addr() net.Addr {
+	return l.pc.LocalAddr()
+}
+
+// Accept waits for a connection.
+func (l *Listener) Accept(ctx context.Context) (*Conn, error) {
+	select {
+	case c := <-l.accept:
+		return c, nil
+
+	case <-l.done:
+		return nil, fmt.Errorf("terminated")
+
+	case <-ctx.Done():
+		return nil, fmt.Errorf("terminated")
+	}
+}
+
+// cookie returns the SYN cookie of a caller, that changes every minute.
+func (l *Listener) cookie(addr *net.UDPAddr, minute int64) uint32 {
+	h := fnv.New32a()
+	var b [12]byte
+	binary.BigEndian.PutUint32(b[0:], l.cookieSecret)
+	binary.BigEndian.PutUint64(b[4:], uint64(minute))
+	h.Write(b[:])
+	h.Write([]byte(addr.String()))
+	return h.Sum32()
+}
+
+func (l *Listener) run() {
+	defer close(l.done)
+
+	for {
+		buf := make([]byte, mtu)
+		n, addr, err := l.pc.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		buf = buf[:n]
+
+		dst, ok := packetDestination(buf)
+		if !ok {
+			continue
+		}
+
+		if dst == 0 {
+			l.handleHandshake(buf, addr)
+			continue
+		}
+
+		l.mutex.Lock()
+		lc, ok := l.conns[dst]
+		l.mutex.Unlock()
+
+		if ok && lc.peerAddr == addr.String() {
+			lc.c.push(buf)
+		}
+	}
+}
+
+func (l *Listener) writeHandshake(addr *net.UDPAddr, dst uint32, start time.Time, h *handshake) []byte {
+	buf := controlPacket{
+		typ:         controlTypeHandshake,
+		timestamp:   uint32(time.Since(start) / time.Microsecond),
+		dstSocketID: dst,
+		cif:         h.marshal(),
+	}.marshal()
+	l.pc.WriteToUDP(buf, addr)
+	return buf
+}
+
+func (l *Listener) reject(addr *net.UDPAddr, req *handshake, reason uint32) {
+	l.writeHandshake(addr, req.socketID, l.start, &handshake{
+		version:    5,
+		isn:        req.isn,
+		mtu:        mtu,
+		flowWindow: flowWindow,
+		typ:        reason,
+		peerIP:     addr.IP,
+	})
+}
+
+func (l *Listener) handleHandshake(buf []byte, addr *net.UDPAddr) {
+	var pkt controlPacket
+	if pkt.unmarshal(buf) != nil || pkt.typ != controlTypeHandshake {
+		return
+	}
+
+	var req handshake
+	if req.unmarshal(pkt.cif) != nil {
+		return
+	}
+
+	minute := time.Now().Unix() / 60
+
+	switch req.typ {
+	case handshakeTypeInduction:
+		l.writeHandshake(addr, req.socketID, l.start, &handshake{
+			version:        5,
+			extensionField: handshakeMagic,
+			isn:            req.isn,
+			mtu:            mtu,
+			flowWindow:     flowWindow,
+			typ:            handshakeTypeInduction,
+			cookie:         l.cookie(addr, minute),
+			peerIP:         addr.IP,
+		})
+
+	case handshakeTypeConclusion:
+		// cookies of the previous minute are accepted too
+		if req.cookie != l.cookie(addr, minute) && req.cookie != l.cookie(addr, minute-1) {
+			return
+		}
+
+		l.handleConclusion(&req, addr)
+	}
+}
+
+func (l *Listener) handleConclusion(req *handshake, addr *net.UDPAddr) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// the response has been lost and the caller is sending the request again
+	for _, lc := range l.conns {
+		if lc.peerAddr == addr.String() && lc.peerID == req.socketID {
+			l.pc.WriteToUDP(lc.response, addr)
+			return
+		}
+	}
+
+	if req.version != 5 || req.srtExt == nil || req.srtExtType != handshakeExtTypeHSREQ {
+		l.reject(addr, req, rejectionVersion)
+		return
+	}
+
+	if req.encrypted || (req.extensionField&handshakeExtFlagKMREQ) != 0 {
+		l.reject(addr, req, rejectionUnsecure)
+		return
+	}
+
+	if l.u.StreamID != "" && req.streamID != l.u.StreamID {
+		l.reject(addr, req, rejectionForbidden)
+		return
+	}
+
+	if len(l.accept) != 0 {
+		l.reject(addr, req, rejectionBacklog)
+		return
+	}
+
+	// the latency of the peer is the one it uses to receive
+	latency := l.u.Latency
+	if req.srtExt.recvLatency > latency {
+		latency = req.srtExt.recvLatency
+	}
+
+	socketID := newSocketID()
+	for l.conns[socketID] != nil {
+		socketID = newSocketID()
+	}
+
+	// timestamps of the connection are relative to the response
+	start := time.Now()
+
+	response := l.writeHandshake(addr, req.socketID, start, &handshake{
+		version:        5,
+		extensionField: handshakeExtFlagHSREQ,
+		isn:            req.isn,
+		mtu:            mtu,
+		flowWindow:     flowWindow,
+		typ:            handshakeTypeConclusion,
+		socketID:       socketID,
+		peerIP:         addr.IP,
+		srtExtType:     handshakeExtTypeHSRSP,
+		srtExt: &handshakeSRTExt{
+			version:     srtVersion,
+			flags:       srtFlags,
+			recvLatency: latency,
+			sendLatency: latency,
+		},
+	})
+
+	c := newConn(
+		socketID,
+		req.socketID,
+		addr,
+		req.streamID,
+		latency,
+		req.isn,
+		start,
+		func(buf []byte) error {
+			_, err := l.pc.WriteToUDP(buf, addr)
+			return err
+		},
+		func() {
+			l.mutex.Lock()
+			delete(l.conns, socketID)
+			l.mutex.Unlock()
+		})
+
+	l.conns[socketID] = &listenerConn{
+		c:        c,
+		peerAddr: addr.String(),
+		peerID:   req.socketID,
+		response: response,
+	}
+
+	l.accept <- c
+}
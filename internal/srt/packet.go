@@ -0,0 +1,173 @@
+// Package srt contains a SRT sender, that delivers a live stream to SRT receivers
+// in caller or listener mode. Encryption is not supported.
+// Specification: draft-sharabayko-srt-01
+package srt
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	headerSize = 16
+
+	// sequence numbers are 31-bit wide.
+	maxSeq = 0x7FFFFFFF
+
+	// message numbers are 26-bit wide.
+	maxMsgNo = 0x03FFFFFF
+
+	// flags of the second word of data packets.
+	// All packets are single-packet messages (PP = 11).
+	dataFlagSolo       = 0xC0000000
+	dataFlagRetransmit = 0x04000000
+)
+
+type controlType uint16
+
+const (
+	controlTypeHandshake controlType = 0x0000
+	controlTypeKeepalive controlType = 0x0001
+	controlTypeACK       controlType = 0x0002
+	controlTypeNAK       controlType = 0x0003
+	controlTypeShutdown  controlType = 0x0005
+	controlTypeACKACK    controlType = 0x0006
+	controlTypeDropReq   controlType = 0x0007
+)
+
+// seqNext returns the sequence number that follows the given one.
+func seqNext(seq uint32) uint32 {
+	return (seq + 1) & maxSeq
+}
+
+// seqDiff returns the distance between two sequence numbers, taking into account wrap-arounds.
+func seqDiff(a uint32, b uint32) int32 {
+	d := (a - b) & maxSeq
+	if d > maxSeq/2 {
+		return int32(int64(d) - maxSeq - 1)
+	}
+	return int32(d)
+}
+
+// msgNext returns the message number that follows the given one.
+// Message number zero is reserved.
+func msgNext(msgNo uint32) uint32 {
+	msgNo = (msgNo + 1) & maxMsgNo
+	if msgNo == 0 {
+		msgNo = 1
+	}
+	return msgNo
+}
+
+func isControlPacket(buf []byte) bool {
+	return len(buf) >= headerSize && (buf[0]&0x80) != 0
+}
+
+// packetDestination returns the socket ID of the destination of a packet.
+func packetDestination(buf []byte) (uint32, bool) {
+	if len(buf) < headerSize {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(buf[12:]), true
+}
+
+type dataPacket struct {
+	seq         uint32
+	msgNo       uint32
+	timestamp   uint32
+	dstSocketID uint32
+	payload     []byte
+}
+
+func (p dataPacket) marshal() []byte {
+	buf := make([]byte, headerSize+len(p.payload))
+	binary.BigEndian.PutUint32(buf[0:], p.seq&maxSeq)
+	binary.BigEndian.PutUint32(buf[4:], dataFlagSolo|(p.msgNo&maxMsgNo))
+	binary.BigEndian.PutUint32(buf[8:], p.timestamp)
+	binary.BigEndian.PutUint32(buf[12:], p.dstSocketID)
+	copy(buf[headerSize:], p.payload)
+	return buf
+}
+
+func (p *dataPacket) unmarshal(buf []byte) error {
+	if len(buf) < headerSize {
+		return fmt.Errorf("packet is too short")
+	}
+
+	if isControlPacket(buf) {
+		return fmt.Errorf("not a data packet")
+	}
+
+	p.seq = binary.BigEndian.Uint32(buf[0:]) & maxSeq
+	p.msgNo = binary.BigEndian.Uint32(buf[4:]) & maxMsgNo
+	p.timestamp = binary.BigEndian.Uint32(buf[8:])
+	p.dstSocketID = binary.BigEndian.Uint32(buf[12:])
+	p.payload = buf[headerSize:]
+	return nil
+}
+
+type controlPacket struct {
+	typ          controlType
+	typeSpecific uint32
+	timestamp    uint32
+	dstSocketID  uint32
+	cif          []byte
+}
+
+func (p controlPacket) marshal() []byte {
+	buf := make([]byte, headerSize+len(p.cif))
+	binary.BigEndian.PutUint16(buf[0:], 0x8000|uint16(p.typ))
+	binary.BigEndian.PutUint32(buf[4:], p.typeSpecific)
+	binary.BigEndian.PutUint32(buf[8:], p.timestamp)
+	binary.BigEndian.PutUint32(buf[12:], p.dstSocketID)
+	copy(buf[headerSize:], p.cif)
+	return buf
+}
+
+func (p *controlPacket) unmarshal(buf []byte) error {
+	if len(buf) < headerSize {
+		return fmt.Errorf("packet is too short")
+	}
+
+	if !isControlPacket(buf) {
+		return fmt.Errorf("not a control packet")
+	}
+
+	p.typ = controlType(binary.BigEndian.Uint16(buf[0:]) & 0x7FFF)
+	p.typeSpecific = binary.BigEndian.Uint32(buf[4:])
+	p.timestamp = binary.BigEndian.Uint32(buf[8:])
+	p.dstSocketID = binary.BigEndian.Uint32(buf[12:])
+	p.cif = buf[headerSize:]
+	return nil
+}
+
+// lossRange is a range of lost sequence numbers, reported by a NAK packet.
+type lossRange struct {
+	first uint32
+	last  uint32
+}
+
+// parseLossList decodes the loss list of a NAK packet. Ranges are encoded
+// with two numbers, the first of which has the most significant bit set.
+func parseLossList(cif []byte) ([]lossRange, error) {
+	var ret []lossRange
+
+	for len(cif) >= 4 {
+		v := binary.BigEndian.Uint32(cif)
+		cif = cif[4:]
+
+		if (v & 0x80000000) == 0 {
+			ret = append(ret, lossRange{v, v})
+			continue
+		}
+
+		if len(cif) < 4 {
+			return nil, fmt.Errorf("invalid loss list")
+		}
+
+		ret = append(ret, lossRange{v & maxSeq, binary.BigEndian.Uint32(cif) & maxSeq})
+		cif = cif[4:]
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,110 @@
+package srt
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultLatency = 120 * time.Millisecond
+	maxLatency     = 65535 * time.Millisecond
+)
+
+// Mode is the connection mode.
+type Mode int
+
+// connection modes.
+const (
+	// ModeCaller connects to a SRT listener.
+	ModeCaller Mode = iota
+
+	// ModeListener waits for connections of SRT callers.
+	ModeListener
+)
+
+// URL is a SRT URL, in the format used by libsrt applications:
+// srt://host:port?mode=caller&streamid=id&latency=ms
+type URL struct {
+	// address in the host:port format. The host can be empty in listener mode.
+	Host string
+
+	Mode     Mode
+	StreamID string
+	Latency  time.Duration
+}
+
+// ParseURL parses a SRT URL.
+// The mode is caller when the host is set, listener otherwise.
+func ParseURL(s string) (*URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "srt" {
+		return nil, fmt.Errorf("unsupported scheme '%s'", u.Scheme)
+	}
+
+	if u.Port() == "" {
+		return nil, fmt.Errorf("port is missing")
+	}
+
+	ret := &URL{
+		Host:    u.Host,
+		Latency: defaultLatency,
+	}
+
+	if u.Hostname() == "" {
+		ret.Mode = ModeListener
+	}
+
+	for key, vals := range u.Query() {
+		val := vals[0]
+
+		switch key {
+		case "mode":
+			switch val {
+			case "caller", "client":
+				ret.Mode = ModeCaller
+
+			case "listener", "server":
+				ret.Mode = ModeListener
+
+			default:
+				return nil, fmt.Errorf("unsupported mode '%s'", val)
+			}
+
+		case "streamid":
+			if len(val) > 512 {
+				return nil, fmt.Errorf("stream ID can't be longer than 512 characters")
+			}
+			ret.StreamID = val
+
+		case "latency":
+			v, err := strconv.ParseUint(val, 10, 64)
+			if err != nil || v > uint64(maxLatency/time.Millisecond) {
+				return nil, fmt.Errorf("invalid latency '%s'", val)
+			}
+			ret.Latency = time.Duration(v) * time.Millisecond
+
+		case "passphrase", "pbkeylen":
+			return nil, fmt.Errorf("encryption is not supported")
+
+		default:
+			return nil, fmt.Errorf("unsupported parameter '%s'", key)
+		}
+	}
+
+	if ret.Mode == ModeCaller && u.Hostname() == "" {
+		return nil, fmt.Errorf("host is required in caller mode")
+	}
+
+	if _, _, err := net.SplitHostPort(ret.Host); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,72 @@
+package srt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseURL(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		in   string
+		out  *URL
+	}{
+		{
+			"caller",
+			"srt://myhost:9000?streamid=live/mystream&latency=500",
+			&URL{
+				Host:     "myhost:9000",
+				Mode:     ModeCaller,
+				StreamID: "live/mystream",
+				Latency:  500 * time.Millisecond,
+			},
+		},
+		{
+			"listener",
+			"srt://:9000",
+			&URL{
+				Host:    ":9000",
+				Mode:    ModeListener,
+				Latency: 120 * time.Millisecond,
+			},
+		},
+		{
+			"listener with host",
+			"srt://127.0.0.1:9000?mode=listener",
+			&URL{
+				Host:    "127.0.0.1:9000",
+				Mode:    ModeListener,
+				Latency: 120 * time.Millisecond,
+			},
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			u, err := ParseURL(ca.in)
+			require.NoError(t, err)
+			require.Equal(t, ca.out, u)
+		})
+	}
+}
+
+func TestParseURLErrors(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		in   string
+		err  string
+	}{
+		{"scheme", "rtmp://myhost:9000", "unsupported scheme 'rtmp'"},
+		{"port", "srt://myhost", "port is missing"},
+		{"mode", "srt://myhost:9000?mode=rendezvous", "unsupported mode 'rendezvous'"},
+		{"caller without host", "srt://:9000?mode=caller", "host is required in caller mode"},
+		{"latency", "srt://myhost:9000?latency=70000", "invalid latency '70000'"},
+		{"passphrase", "srt://myhost:9000?passphrase=0123456789", "encryption is not supported"},
+		{"parameter", "srt://myhost:9000?maxbw=10", "unsupported parameter 'maxbw'"},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			_, err := ParseURL(ca.in)
+			require.EqualError(t, err, ca.err)
+		})
+	}
+}
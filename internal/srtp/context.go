@@ -0,0 +1,306 @@
+// Package srtp contains a SRTP/SRTCP encryptor that uses the AES_CM_128_HMAC_SHA1_80 crypto suite.
+// Specification: RFC3711
+package srtp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"hash"
+)
+
+const (
+	// KeyLen is the length of the master key.
+	KeyLen = 16
+
+	// SaltLen is the length of the master salt.
+	SaltLen = 14
+
+	authKeyLen = 20
+	authTagLen = 10
+
+	srtcpIndexLen = 4
+
+	labelSRTPEncryption  = 0x00
+	labelSRTPAuth        = 0x01
+	labelSRTPSalt        = 0x02
+	labelSRTCPEncryption = 0x03
+	labelSRTCPAuth       = 0x04
+	labelSRTCPSalt       = 0x05
+)
+
+// CryptoSuite is the name of the crypto suite, as used in SDP crypto attributes (RFC4568).
+const CryptoSuite = "AES_CM_128_HMAC_SHA1_80"
+
+type ssrcState struct {
+	initialized bool
+	lastSeq     uint16
+	roc         uint32
+	srtcpIndex  uint32
+}
+
+// Context is a SRTP/SRTCP cryptographic context.
+// It can be used with packets of multiple SSRCs, and it is not safe for concurrent use.
+type Context struct {
+	srtpBlock  cipher.Block
+	srtpSalt   []byte
+	srtpAuth   hash.Hash
+	srtcpBlock cipher.Block
+	srtcpSalt  []byte
+	srtcpAuth  hash.Hash
+
+	ssrcs map[uint32]*ssrcState
+}
+
+// NewContext allocates a Context.
+func NewContext(masterKey []byte, masterSalt []byte) (*Context, error) {
+	if len(masterKey) != KeyLen {
+		return nil, fmt.Errorf("invalid master key length: %d", len(masterKey))
+	}
+
+	if len(masterSalt) != SaltLen {
+		return nil, fmt.Errorf("invalid master salt length: %d", len(masterSalt))
+	}
+
+	masterBlock, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	derive := func(label byte, n int) []byte {
+		return deriveKey(masterBlock, masterSalt, label, n)
+	}
+
+	c := &Context{
+		srtpSalt:  derive(labelSRTPSalt, SaltLen),
+		srtpAuth:  hmac.New(sha1.New, derive(labelSRTPAuth, authKeyLen)),
+		srtcpSalt: derive(labelSRTCPSalt, SaltLen),
+		srtcpAuth: hmac.New(sha1.New, derive(labelSRTCPAuth, authKeyLen)),
+		ssrcs:     make(map[uint32]*ssrcState),
+	}
+
+	c.srtpBlock, err = aes.NewCipher(derive(labelSRTPEncryption, KeyLen))
+	if err != nil {
+		return nil, err
+	}
+
+	c.srtcpBlock, err = aes.NewCipher(derive(labelSRTCPEncryption, KeyLen))
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// deriveKey derives a session key from the master key (RFC3711, section 4.3),
+// with a key derivation rate equal to zero.
+func deriveKey(masterBlock cipher.Block, masterSalt []byte, label byte, n int) []byte {
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, masterSalt)
+	iv[7] ^= label
+
+	out := make([]byte, n)
+	cipher.NewCTR(masterBlock, iv).XORKeyStream(out, out)
+	return out
+}
+
+// counter returns the initial counter of AES-CM (RFC3711, section 4.1.1).
+func counter(salt []byte, ssrc uint32, index uint64) []byte {
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, salt)
+
+	var tmp [8]byte
+	binary.BigEndian.PutUint32(tmp[:4], ssrc)
+	for i := 0; i < 4; i++ {
+		iv[4+i] ^= tmp[i]
+	}
+
+	binary.BigEndian.PutUint64(tmp[:], index<<16)
+	for i := 0; i < 8; i++ {
+		iv[8+i] ^= tmp[i]
+	}
+
+	return iv
+}
+
+func (c *Context) ssrcState(ssrc uint32) *ssrcState {
+	s, ok := c.ssrcs[ssrc]
+	if !ok {
+		s = &ssrcState{}
+		c.ssrcs[ssrc] = s
+	}
+	return s
+}
+
+// rtpHeaderLen returns the length of the header of a RTP packet,
+// including CSRCs and extensions.
+func rtpHeaderLen(pkt []byte) (int, error) {
+	if len(pkt) < 12 {
+		return 0, fmt.Errorf("RTP packet is too short")
+	}
+
+	n := 12 + int(pkt[0]&0x0F)*4
+
+	if (pkt[0] & 0x10) != 0 {
+		if len(pkt) < n+4 {
+			return 0, fmt.Errorf("RTP packet is too short")
+		}
+		n += 4 + int(binary.BigEndian.Uint16(pkt[n+2:]))*4
+	}
+
+	if len(pkt) < n {
+		return 0, fmt.Errorf("RTP packet is too short")
+	}
+
+	return n, nil
+}
+
+// rollOverCounter returns the roll-over counter of a sequence number
+// and updates the state of the sender (RFC3711, section 3.3.1).
+func (s *ssrcState) rollOverCounter(seq uint16) uint32 {
+	if !s.initialized {
+		s.initialized = true
+		s.lastSeq = seq
+		return s.roc
+	}
+
+	switch {
+	case seq < s.lastSeq && (s.lastSeq-seq) > 0x8000:
+		// wrap-around
+		s.roc++
+		s.lastSeq = seq
+		return s.roc
+
+	case seq > s.lastSeq && (seq-s.lastSeq) > 0x8000:
+		// packet sent before the last wrap-around
+		return s.roc - 1
+
+	case seq > s.lastSeq:
+		s.lastSeq = seq
+	}
+
+	return s.roc
+}
+
+// EncryptRTP encrypts a RTP packet into a SRTP packet.
+func (c *Context) EncryptRTP(pkt []byte) ([]byte, error) {
+	headerLen, err := rtpHeaderLen(pkt)
+	if err != nil {
+		return nil, err
+	}
+
+	seq := binary.BigEndian.Uint16(pkt[2:])
+	ssrc := binary.BigEndian.Uint32(pkt[8:])
+	roc := c.ssrcState(ssrc).rollOverCounter(seq)
+
+	out := make([]byte, len(pkt), len(pkt)+authTagLen)
+	copy(out, pkt[:headerLen])
+
+	index := uint64(roc)<<16 | uint64(seq)
+	cipher.NewCTR(c.srtpBlock, counter(c.srtpSalt, ssrc, index)).
+		XORKeyStream(out[headerLen:], pkt[headerLen:])
+
+	var rocBytes [4]byte
+	binary.BigEndian.PutUint32(rocBytes[:], roc)
+
+	return append(out, c.authTag(c.srtpAuth, out, rocBytes[:])...), nil
+}
+
+// EncryptRTCP encrypts a RTCP (compound) packet into a SRTCP packet.
+func (c *Context) EncryptRTCP(pkt []byte) ([]byte, error) {
+	if len(pkt) < 8 {
+		return nil, fmt.Errorf("RTCP packet is too short")
+	}
+
+	ssrc := binary.BigEndian.Uint32(pkt[4:])
+	s := c.ssrcState(ssrc)
+	index := s.srtcpIndex
+	s.srtcpIndex = (s.srtcpIndex + 1) & 0x7FFFFFFF
+
+	out := make([]byte, len(pkt), len(pkt)+srtcpIndexLen+authTagLen)
+	copy(out, pkt[:8])
+
+	cipher.NewCTR(c.srtcpBlock, counter(c.srtcpSalt, ssrc, uint64(index))).
+		XORKeyStream(out[8:], pkt[8:])
+
+	// the E flag is set since the packet is encrypted
+	var indexBytes [4]byte
+	binary.BigEndian.PutUint32(indexBytes[:], index|0x80000000)
+	out = append(out, indexBytes[:]...)
+
+	return append(out, c.authTag(c.srtcpAuth, out, nil)...), nil
+}
+
+// DecryptRTP decrypts a SRTP packet into a RTP packet.
+func (c *Context) DecryptRTP(pkt []byte) ([]byte, error) {
+	if len(pkt) < authTagLen {
+		return nil, fmt.Errorf("SRTP packet is too short")
+	}
+
+	tag := pkt[len(pkt)-authTagLen:]
+	pkt = pkt[:len(pkt)-authTagLen]
+
+	headerLen, err := rtpHeaderLen(pkt)
+	if err != nil {
+		return nil, err
+	}
+
+	seq := binary.BigEndian.Uint16(pkt[2:])
+	ssrc := binary.BigEndian.Uint32(pkt[8:])
+	roc := c.ssrcState(ssrc).rollOverCounter(seq)
+
+	var rocBytes [4]byte
+	binary.BigEndian.PutUint32(rocBytes[:], roc)
+
+	if subtle.ConstantTimeCompare(tag, c.authTag(c.srtpAuth, pkt, rocBytes[:])) != 1 {
+		return nil, fmt.Errorf("authentication failed")
+	}
+
+	out := make([]byte, len(pkt))
+	copy(out, pkt[:headerLen])
+
+	index := uint64(roc)<<16 | uint64(seq)
+	cipher.NewCTR(c.srtpBlock, counter(c.srtpSalt, ssrc, index)).
+		XORKeyStream(out[headerLen:], pkt[headerLen:])
+
+	return out, nil
+}
+
+// DecryptRTCP decrypts a SRTCP packet into a RTCP packet.
+func (c *Context) DecryptRTCP(pkt []byte) ([]byte, error) {
+	if len(pkt) < 8+srtcpIndexLen+authTagLen {
+		return nil, fmt.Errorf("SRTCP packet is too short")
+	}
+
+	tag := pkt[len(pkt)-authTagLen:]
+	pkt = pkt[:len(pkt)-authTagLen]
+
+	if subtle.ConstantTimeCompare(tag, c.authTag(c.srtcpAuth, pkt, nil)) != 1 {
+		return nil, fmt.Errorf("authentication failed")
+	}
+
+	index := binary.BigEndian.Uint32(pkt[len(pkt)-srtcpIndexLen:])
+	pkt = pkt[:len(pkt)-srtcpIndexLen]
+
+	out := make([]byte, len(pkt))
+	copy(out, pkt)
+
+	if (index & 0x80000000) != 0 {
+		ssrc := binary.BigEndian.Uint32(pkt[4:])
+		cipher.NewCTR(c.srtcpBlock, counter(c.srtcpSalt, ssrc, uint64(index&0x7FFFFFFF))).
+			XORKeyStream(out[8:], pkt[8:])
+	}
+
+	return out, nil
+}
+
+func (c *Context) authTag(h hash.Hash, pkt []byte, roc []byte) []byte {
+	h.Reset()
+	h.Write(pkt)
+	h.Write(roc)
+	return h.Sum(nil)[:authTagLen]
+}
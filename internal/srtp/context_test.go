@@ -0,0 +1,121 @@
+package srtp
+
+import (
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+func mustDecodeHex(s string) []byte {
+	byts, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return byts
+}
+
+func TestDeriveKey(t *testing.T) {
+	// RFC3711, appendix B.3
+	masterKey := mustDecodeHex("E1F97A0D3E018BE0D64FA32C06DE4139")
+	masterSalt := mustDecodeHex("0EC675AD498AFEEBB6960B3AABE6")
+
+	masterBlock, err := aes.NewCipher(masterKey)
+	require.NoError(t, err)
+
+	require.Equal(t, mustDecodeHex("C61E7A93744F39EE10734AFE3FF7A087"),
+		deriveKey(masterBlock, masterSalt, labelSRTPEncryption, KeyLen))
+	require.Equal(t, mustDecodeHex("30CBBC08863D8C85D49DB34A9AE1"),
+		deriveKey(masterBlock, masterSalt, labelSRTPSalt, SaltLen))
+	require.Equal(t, mustDecodeHex("CEBE321F6FF7716B6FD4AB49AF256A156D38BAA4"),
+		deriveKey(masterBlock, masterSalt, labelSRTPAuth, authKeyLen))
+}
+
+func TestCounter(t *testing.T) {
+	// RFC3711, appendix B.2
+	salt := mustDecodeHex("F0F1F2F3F4F5F6F7F8F9FAFBFCFD")
+	require.Equal(t, mustDecodeHex("F0F1F2F3F4F5F6F7F8F9FAFBFCFD0000"), counter(salt, 0, 0))
+	require.Equal(t, mustDecodeHex("F0F1F2F3E6E7E4E5F8F9FAFBFCF00000"), counter(salt, 0x12121212, 0x0D))
+}
+
+func TestRTP(t *testing.T) {
+	masterKey := mustDecodeHex("E1F97A0D3E018BE0D64FA32C06DE4139")
+	masterSalt := mustDecodeHex("0EC675AD498AFEEBB6960B3AABE6")
+
+	enc, err := NewContext(masterKey, masterSalt)
+	require.NoError(t, err)
+
+	dec, err := NewContext(masterKey, masterSalt)
+	require.NoError(t, err)
+
+	// sequence numbers wrap around
+	for _, seq := range []uint16{65534, 65535, 0, 1} {
+		pkt, err := (&rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    96,
+				SequenceNumber: seq,
+				Timestamp:      123456,
+				SSRC:           0x9dbb7812,
+			},
+			Payload: []byte{0x01, 0x02, 0x03, 0x04},
+		}).Marshal()
+		require.NoError(t, err)
+
+		encrypted, err := enc.EncryptRTP(pkt)
+		require.NoError(t, err)
+		require.Equal(t, len(pkt)+authTagLen, len(encrypted))
+		require.Equal(t, pkt[:12], encrypted[:12])
+		require.NotEqual(t, pkt[12:], encrypted[12:len(pkt)])
+
+		decrypted, err := dec.DecryptRTP(encrypted)
+		require.NoError(t, err)
+		require.Equal(t, pkt, decrypted)
+	}
+
+	require.Equal(t, uint32(1), enc.ssrcs[0x9dbb7812].roc)
+
+	// packets with a wrong key are rejected
+	wrong, err := NewContext(masterKey, mustDecodeHex("0EC675AD498AFEEBB6960B3AABE7"))
+	require.NoError(t, err)
+
+	pkt := []byte{0x80, 0x60, 0x00, 0x02, 0x00, 0x01, 0xe2, 0x40, 0x9d, 0xbb, 0x78, 0x12, 0x01, 0x02}
+	encrypted, err := enc.EncryptRTP(pkt)
+	require.NoError(t, err)
+
+	_, err = wrong.DecryptRTP(encrypted)
+	require.EqualError(t, err, "authentication failed")
+}
+
+func TestRTCP(t *testing.T) {
+	masterKey := mustDecodeHex("E1F97A0D3E018BE0D64FA32C06DE4139")
+	masterSalt := mustDecodeHex("0EC675AD498AFEEBB6960B3AABE6")
+
+	enc, err := NewContext(masterKey, masterSalt)
+	require.NoError(t, err)
+
+	dec, err := NewContext(masterKey, masterSalt)
+	require.NoError(t, err)
+
+	// sender report
+	pkt := []byte{
+		0x80, 0xc8, 0x00, 0x06, 0x9d, 0xbb, 0x78, 0x12,
+		0xe1, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde,
+		0x00, 0x01, 0xe2, 0x40, 0x00, 0x00, 0x00, 0x0a,
+		0x00, 0x00, 0x03, 0xe8,
+	}
+
+	for i := 0; i < 2; i++ {
+		encrypted, err := enc.EncryptRTCP(pkt)
+		require.NoError(t, err)
+		require.Equal(t, len(pkt)+srtcpIndexLen+authTagLen, len(encrypted))
+		require.Equal(t, pkt[:8], encrypted[:8])
+		require.Equal(t, []byte{0x80, 0x00, 0x00, byte(i)}, encrypted[len(pkt):len(pkt)+srtcpIndexLen])
+
+		decrypted, err := dec.DecryptRTCP(encrypted)
+		require.NoError(t, err)
+		require.Equal(t, pkt, decrypted)
+	}
+}
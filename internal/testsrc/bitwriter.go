@@ -0,0 +1,68 @@
+package testsrc
+
+type bitWriter struct {
+	buf []byte
+	n   int // number of bits written
+}
+
+func (w *bitWriter) writeBit(v uint32) {
+	if w.n%8 == 0 {
+		w.buf = append(w.buf, 0)
+	}
+	if v != 0 {
+		w.buf[len(w.buf)-1] |= 1 << (7 - uint(w.n%8))
+	}
+	w.n++
+}
+
+func (w *bitWriter) writeBits(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.writeBit((v >> uint(i)) & 0x01)
+	}
+}
+
+func (w *bitWriter) writeFlag(v bool) {
+	if v {
+		w.writeBit(1)
+	} else {
+		w.writeBit(0)
+	}
+}
+
+// writeUE writes an unsigned Exp-Golomb code.
+func (w *bitWriter) writeUE(v uint32) {
+	v++
+	size := 0
+	for tmp := v; tmp != 0; tmp >>= 1 {
+		size++
+	}
+	w.writeBits(0, size-1)
+	w.writeBits(v, size)
+}
+
+// writeSE writes a signed Exp-Golomb code.
+func (w *bitWriter) writeSE(v int32) {
+	if v > 0 {
+		w.writeUE(uint32(v)*2 - 1)
+	} else {
+		w.writeUE(uint32(-v) * 2)
+	}
+}
+
+func (w *bitWriter) isByteAligned() bool {
+	return w.n%8 == 0
+}
+
+// writeBytes writes bytes, that must be aligned.
+func (w *bitWriter) writeBytes(byts []byte) {
+	w.buf = append(w.buf, byts...)
+	w.n += len(byts) * 8
+}
+
+// writeTrailingBits writes the RBSP trailing bits.
+func (w *bitWriter) writeTrailingBits() {
+	w.writeBit(1)
+	for !w.isByteAligned() {
+		w.writeBit(0)
+	}
+}
@@ -0,0 +1,271 @@
+// Package testsrc contains a generator of test patterns, made of color bars with
+// a burned-in timecode and a sine tone, and the encoders needed to publish them.
+package testsrc
+
+const (
+	// frame_num is encoded with 8 bits.
+	log2MaxFrameNum = 8
+
+	// mb_type of I_PCM macroblocks inside I slices and P slices.
+	mbTypeIPCM       = 25
+	mbTypeIPCMInterP = 5 + mbTypeIPCM
+
+	sliceTypeP = 5
+	sliceTypeI = 7
+)
+
+// limits of H264 levels, in macroblocks per frame and macroblocks per second.
+var levels = []struct {
+	idc  uint32
+	mbs  int
+	mbps int
+}{
+	{30, 1620, 40500},
+	{31, 3600, 108000},
+	{32, 5120, 216000},
+	{40, 8192, 245760},
+	{42, 8704, 522240},
+	{50, 22080, 589824},
+	{51, 36864, 983040},
+}
+
+// addEmulationPrevention converts a RBSP into the payload of a NALU.
+func addEmulationPrevention(rbsp []byte) []byte {
+	ret := make([]byte, 0, len(rbsp)+len(rbsp)/64)
+	zeros := 0
+
+	for _, b := range rbsp {
+		if zeros == 2 && b <= 3 {
+			ret = append(ret, 0x03)
+			zeros = 0
+		}
+
+		ret = append(ret, b)
+
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+
+	return ret
+}
+
+// Encoder is a H264 encoder that produces a Constrained Baseline stream made of
+// uncompressed (I_PCM) macroblocks. It is meant for synthetic pictures that
+// change in small areas only: IDR frames contain the whole picture, while the
+// other frames contain only the macroblocks that changed since the previous frame.
+type Encoder struct {
+	width       int
+	height      int
+	fps         int
+	idrInterval int
+
+	sps  []byte
+	pps  []byte
+	prev *Frame
+
+	framesSinceIDR int
+	frameNum       uint32
+	idrPicID       uint32
+}
+
+// NewEncoder allocates an Encoder. An IDR frame is produced every idrInterval frames.
+func NewEncoder(width int, height int, fps int, idrInterval int) *Encoder {
+	e := &Encoder{
+		width:       width,
+		height:      height,
+		fps:         fps,
+		idrInterval: idrInterval,
+	}
+
+	e.sps = e.generateSPS()
+	e.pps = e.generatePPS()
+
+	return e
+}
+
+// SPS returns the sequence parameter set.
+func (e *Encoder) SPS() []byte {
+	return e.sps
+}
+
+// PPS returns the picture parameter set.
+func (e *Encoder) PPS() []byte {
+	return e.pps
+}
+
+func (e *Encoder) level() uint32 {
+	mbs := ((e.width + 15) / 16) * ((e.height + 15) / 16)
+	for _, l := range levels {
+		if mbs <= l.mbs && mbs*e.fps <= l.mbps {
+			return l.idc
+		}
+	}
+	return levels[len(levels)-1].idc
+}
+
+func (e *Encoder) generateSPS() []byte {
+	mbWidth := (e.width + 15) / 16
+	mbHeight := (e.height + 15) / 16
+
+	w := &bitWriter{}
+
+	w.writeBits(66, 8)   // profile_idc (baseline)
+	w.writeBits(0xC0, 8) // constraint_set0_flag, constraint_set1_flag (constrained baseline)
+	w.writeBits(e.level(), 8)
+	w.writeUE(0)                   // seq_parameter_set_id
+	w.writeUE(log2MaxFrameNum - 4) // log2_max_frame_num_minus4
+	w.writeUE(2)                   // pic_order_cnt_type
+	w.writeUE(1)                   // max_num_ref_frames
+	w.writeFlag(false)             // gaps_in_frame_num_value_allowed_flag
+	w.writeUE(uint32(mbWidth - 1))
+	w.writeUE(uint32(mbHeight - 1))
+	w.writeFlag(true) // frame_mbs_only_flag
+	w.writeFlag(true) // direct_8x8_inference_flag
+
+	// cropping is expressed in units of 2 pixels, since chroma is subsampled
+	cropRight := (mbWidth*16 - e.width) / 2
+	cropBottom := (mbHeight*16 - e.height) / 2
+	if cropRight != 0 || cropBottom != 0 {
+		w.writeFlag(true)
+		w.writeUE(0)
+		w.writeUE(uint32(cropRight))
+		w.writeUE(0)
+		w.writeUE(uint32(cropBottom))
+	} else {
+		w.writeFlag(false)
+	}
+
+	w.writeFlag(true)  // vui_parameters_present_flag
+	w.writeFlag(false) // aspect_ratio_info_present_flag
+	w.writeFlag(false) // overscan_info_present_flag
+	w.writeFlag(false) // video_signal_type_present_flag
+	w.writeFlag(false) // chroma_loc_info_present_flag
+	w.writeFlag(true)  // timing_info_present_flag
+	w.writeBits(1, 32) // num_units_in_tick
+	w.writeBits(uint32(e.fps*2), 32)
+	w.writeFlag(true)  // fixed_frame_rate_flag
+	w.writeFlag(false) // nal_hrd_parameters_present_flag
+	w.writeFlag(false) // vcl_hrd_parameters_present_flag
+	w.writeFlag(false) // pic_struct_present_flag
+	w.writeFlag(true)  // bitstream_restriction_flag
+	w.writeFlag(true)  // motion_vectors_over_pic_boundaries_flag
+	w.writeUE(0)       // max_bytes_per_pic_denom
+	w.writeUE(0)       // max_bits_per_mb_denom
+	w.writeUE(16)      // log2_max_mv_length_horizontal
+	w.writeUE(16)      // log2_max_mv_length_vertical
+	w.writeUE(0)       // max_num_reorder_frames
+	w.writeUE(1)       // max_dec_frame_buffering
+
+	w.writeTrailingBits()
+
+	return append([]byte{0x67}, addEmulationPrevention(w.buf)...)
+}
+
+func (e *Encoder) generatePPS() []byte {
+	w := &bitWriter{}
+
+	w.writeUE(0)       // pic_parameter_set_id
+	w.writeUE(0)       // seq_parameter_set_id
+	w.writeFlag(false) // entropy_coding_mode_flag
+	w.writeFlag(false) // bottom_field_pic_order_in_frame_present_flag
+	w.writeUE(0)       // num_slice_groups_minus1
+	w.writeUE(0)       // num_ref_idx_l0_default_active_minus1
+	w.writeUE(0)       // num_ref_idx_l1_default_active_minus1
+	w.writeFlag(false) // weighted_pred_flag
+	w.writeBits(0, 2)  // weighted_bipred_idc
+	w.writeSE(0)       // pic_init_qp_minus26
+	w.writeSE(0)       // pic_init_qs_minus26
+	w.writeSE(0)       // chroma_qp_index_offset
+	w.writeFlag(true)  // deblocking_filter_control_present_flag
+	w.writeFlag(false) // constrained_intra_pred_flag
+	w.writeFlag(false) // redundant_pic_cnt_present_flag
+
+	w.writeTrailingBits()
+
+	return append([]byte{0x68}, addEmulationPrevention(w.buf)...)
+}
+
+// Encode encodes a frame into a NALU, and returns whether it is an IDR.
+func (e *Encoder) Encode(f *Frame) ([]byte, bool) {
+	idr := e.prev == nil || e.framesSinceIDR >= e.idrInterval
+
+	if idr {
+		e.framesSinceIDR = 0
+		e.frameNum = 0
+	} else {
+		e.frameNum = (e.frameNum + 1) % (1 << log2MaxFrameNum)
+	}
+	e.framesSinceIDR++
+
+	w := &bitWriter{}
+
+	// slice header
+	w.writeUE(0) // first_mb_in_slice
+	if idr {
+		w.writeUE(sliceTypeI)
+	} else {
+		w.writeUE(sliceTypeP)
+	}
+	w.writeUE(0) // pic_parameter_set_id
+	w.writeBits(e.frameNum, log2MaxFrameNum)
+	if idr {
+		w.writeUE(e.idrPicID)
+	} else {
+		w.writeFlag(false) // num_ref_idx_active_override_flag
+		w.writeFlag(false) // ref_pic_list_modification_flag_l0
+	}
+	if idr {
+		w.writeFlag(false) // no_output_of_prior_pics_flag
+		w.writeFlag(false) // long_term_reference_flag
+	} else {
+		w.writeFlag(false) // adaptive_ref_pic_marking_mode_flag
+	}
+	w.writeSE(0) // slice_qp_delta
+	w.writeUE(1) // disable_deblocking_filter_idc
+
+	// slice data
+	skipRun := uint32(0)
+	for mbY := 0; mbY < f.mbHeight; mbY++ {
+		for mbX := 0; mbX < f.mbWidth; mbX++ {
+			if idr {
+				w.writeUE(mbTypeIPCM)
+			} else {
+				if f.macroblockEqual(e.prev, mbX, mbY) {
+					skipRun++
+					continue
+				}
+
+				w.writeUE(skipRun)
+				skipRun = 0
+				w.writeUE(mbTypeIPCMInterP)
+			}
+
+			for !w.isByteAligned() {
+				w.writeBit(0) // pcm_alignment_zero_bit
+			}
+			f.writePCMSamples(w, mbX, mbY)
+		}
+	}
+	if skipRun != 0 {
+		w.writeUE(skipRun)
+	}
+
+	w.writeTrailingBits()
+
+	var nalu []byte
+	if idr {
+		// IDR, nal_ref_idc = 3
+		nalu = append([]byte{0x65}, addEmulationPrevention(w.buf)...)
+		e.idrPicID = (e.idrPicID + 1) % 2
+	} else {
+		// non-IDR, nal_ref_idc = 2
+		nalu = append([]byte{0x41}, addEmulationPrevention(w.buf)...)
+	}
+
+	e.prev = f.Copy()
+
+	return nalu, idr
+}
@@ -0,0 +1,227 @@
+package testsrc
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aler9/gortsplib/pkg/h264"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aler9/rtsp-simple-server/internal/h264sps"
+)
+
+type testBitReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *testBitReader) readBits(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		v = (v << 1) | uint32((r.buf[r.pos/8]>>(7-uint(r.pos%8)))&0x01)
+		r.pos++
+	}
+	return v
+}
+
+func (r *testBitReader) readUE() uint32 {
+	leadingZeros := 0
+	for r.readBits(1) == 0 {
+		leadingZeros++
+	}
+	return (1 << uint(leadingZeros)) - 1 + r.readBits(leadingZeros)
+}
+
+func removeEmulationPrevention(buf []byte) []byte {
+	var ret []byte
+	zeros := 0
+
+	for _, b := range buf {
+		if zeros == 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+
+		ret = append(ret, b)
+
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+
+	return ret
+}
+
+// decodeTestSlice decodes the slices produced by the Encoder.
+func decodeTestSlice(nalu []byte, prev *Frame, width int, height int) (*Frame, error) {
+	idr := h264.NALUType(nalu[0]&0x1F) == h264.NALUTypeIDR
+	if !idr && prev == nil {
+		return nil, fmt.Errorf("missing reference")
+	}
+
+	r := &testBitReader{buf: removeEmulationPrevention(nalu[1:])}
+
+	r.readUE() // first_mb_in_slice
+	sliceType := r.readUE()
+	if (idr && sliceType != sliceTypeI) || (!idr && sliceType != sliceTypeP) {
+		return nil, fmt.Errorf("unexpected slice type %d", sliceType)
+	}
+	r.readUE() // pic_parameter_set_id
+	r.readBits(log2MaxFrameNum)
+	if idr {
+		r.readUE() // idr_pic_id
+		r.readBits(2)
+	} else {
+		r.readBits(3)
+	}
+	r.readUE() // slice_qp_delta
+	if r.readUE() != 1 {
+		return nil, fmt.Errorf("deblocking is enabled")
+	}
+
+	var f *Frame
+	if idr {
+		f = NewFrame(width, height)
+	} else {
+		f = prev.Copy()
+	}
+
+	readMacroblock := func(addr int) error {
+		for r.pos%8 != 0 {
+			if r.readBits(1) != 0 {
+				return fmt.Errorf("invalid alignment bit")
+			}
+		}
+
+		mbX := addr % f.mbWidth
+		mbY := addr / f.mbWidth
+		buf := r.buf[r.pos/8 : r.pos/8+384]
+		r.pos += 384 * 8
+
+		for j := 0; j < 16; j++ {
+			copy(f.Y[(mbY*16+j)*f.stride+mbX*16:], buf[j*16:j*16+16])
+		}
+		for j := 0; j < 8; j++ {
+			copy(f.Cb[(mbY*8+j)*f.stride/2+mbX*8:], buf[256+j*8:256+j*8+8])
+			copy(f.Cr[(mbY*8+j)*f.stride/2+mbX*8:], buf[320+j*8:320+j*8+8])
+		}
+		return nil
+	}
+
+	total := f.mbWidth * f.mbHeight
+	for addr := 0; addr < total; {
+		if !idr {
+			addr += int(r.readUE())
+			if addr >= total {
+				break
+			}
+		}
+
+		mbType := r.readUE()
+		if (idr && mbType != mbTypeIPCM) || (!idr && mbType != mbTypeIPCMInterP) {
+			return nil, fmt.Errorf("unexpected macroblock type %d", mbType)
+		}
+
+		err := readMacroblock(addr)
+		if err != nil {
+			return nil, err
+		}
+		addr++
+	}
+
+	// rbsp_trailing_bits
+	if r.readBits(1) != 1 {
+		return nil, fmt.Errorf("missing stop bit")
+	}
+	for r.pos < len(r.buf)*8 {
+		if r.readBits(1) != 0 {
+			return nil, fmt.Errorf("unexpected data after stop bit")
+		}
+	}
+
+	return f, nil
+}
+
+func TestEncoderParameters(t *testing.T) {
+	for _, ca := range []struct {
+		width  int
+		height int
+		fps    int
+		level  uint8
+	}{
+		{640, 480, 30, 30},
+		{1280, 720, 30, 31},
+		{1920, 1080, 30, 40},
+		{1920, 1080, 60, 42},
+		{322, 242, 25, 30},
+	} {
+		t.Run(fmt.Sprintf("%dx%d", ca.width, ca.height), func(t *testing.T) {
+			e := NewEncoder(ca.width, ca.height, ca.fps, ca.fps)
+
+			var sps h264sps.SPS
+			err := sps.Decode(e.SPS())
+			require.NoError(t, err)
+			require.Equal(t, h264sps.SPS{
+				ProfileIdc: 66,
+				LevelIdc:   ca.level,
+				Width:      ca.width,
+				Height:     ca.height,
+				FPS:        float64(ca.fps),
+			}, sps)
+
+			require.Equal(t, h264.NALUTypePPS, h264.NALUType(e.PPS()[0]&0x1F))
+		})
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	p := NewPattern(322, 242, 25)
+	e := NewEncoder(322, 242, 25, 10)
+
+	var prev *Frame
+	var idrSize int
+
+	for n := 0; n < 25; n++ {
+		in := p.Draw(n)
+		nalu, idr := e.Encode(in)
+		require.Equal(t, n%10 == 0, idr)
+
+		if n == 0 {
+			idrSize = len(nalu)
+		} else if !idr {
+			require.Less(t, len(nalu), idrSize/10)
+		}
+
+		out, err := decodeTestSlice(nalu, prev, 322, 242)
+		require.NoError(t, err)
+		require.Equal(t, in.Y, out.Y)
+		require.Equal(t, in.Cb, out.Cb)
+		require.Equal(t, in.Cr, out.Cr)
+		prev = out
+	}
+}
+
+func TestAddEmulationPrevention(t *testing.T) {
+	for _, ca := range []struct {
+		in  []byte
+		out []byte
+	}{
+		{
+			[]byte{0x00, 0x00, 0x01, 0x05},
+			[]byte{0x00, 0x00, 0x03, 0x01, 0x05},
+		},
+		{
+			[]byte{0x00, 0x00, 0x00, 0x00, 0x01},
+			[]byte{0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x01},
+		},
+		{
+			[]byte{0x00, 0x00, 0x04, 0x00, 0x00},
+			[]byte{0x00, 0x00, 0x04, 0x00, 0x00},
+		},
+	} {
+		require.Equal(t, ca.out, addEmulationPrevention(ca.in))
+		require.Equal(t, ca.in, removeEmulationPrevention(ca.out))
+	}
+}
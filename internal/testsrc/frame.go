@@ -0,0 +1,127 @@
+package testsrc
+
+// Frame is a picture in the YUV 4:2:0 format.
+// Planes are padded to a multiple of the macroblock size.
+type Frame struct {
+	Width  int
+	Height int
+
+	Y  []byte
+	Cb []byte
+	Cr []byte
+
+	// size of a row of the Y plane; rows of chroma planes have half the size.
+	stride   int
+	mbWidth  int
+	mbHeight int
+}
+
+// NewFrame allocates a black Frame.
+func NewFrame(width int, height int) *Frame {
+	mbWidth := (width + 15) / 16
+	mbHeight := (height + 15) / 16
+
+	f := &Frame{
+		Width:    width,
+		Height:   height,
+		Y:        make([]byte, mbWidth*16*mbHeight*16),
+		Cb:       make([]byte, mbWidth*8*mbHeight*8),
+		Cr:       make([]byte, mbWidth*8*mbHeight*8),
+		stride:   mbWidth * 16,
+		mbWidth:  mbWidth,
+		mbHeight: mbHeight,
+	}
+
+	fill(f.Y, 16)
+	fill(f.Cb, 128)
+	fill(f.Cr, 128)
+
+	return f
+}
+
+func fill(buf []byte, v byte) {
+	for i := range buf {
+		buf[i] = v
+	}
+}
+
+// Copy returns a copy of the frame.
+func (f *Frame) Copy() *Frame {
+	ret := *f
+	ret.Y = append([]byte(nil), f.Y...)
+	ret.Cb = append([]byte(nil), f.Cb...)
+	ret.Cr = append([]byte(nil), f.Cr...)
+	return &ret
+}
+
+// FillRect fills a rectangle with a color. Since chroma is subsampled,
+// the chroma of rectangles with odd coordinates or sizes is extended by a pixel.
+func (f *Frame) FillRect(x int, y int, w int, h int, c Color) {
+	if x+w > f.Width {
+		w = f.Width - x
+	}
+	if y+h > f.Height {
+		h = f.Height - y
+	}
+	if x < 0 || y < 0 || w <= 0 || h <= 0 {
+		return
+	}
+
+	for j := y; j < y+h; j++ {
+		fill(f.Y[j*f.stride+x:j*f.stride+x+w], c.Y)
+	}
+
+	cstride := f.stride / 2
+	for j := y / 2; j < (y+h+1)/2; j++ {
+		fill(f.Cb[j*cstride+x/2:j*cstride+(x+w+1)/2], c.Cb)
+		fill(f.Cr[j*cstride+x/2:j*cstride+(x+w+1)/2], c.Cr)
+	}
+}
+
+// macroblockEqual checks whether a macroblock is equal to the same macroblock of another frame.
+func (f *Frame) macroblockEqual(o *Frame, mbX int, mbY int) bool {
+	for j := 0; j < 16; j++ {
+		start := (mbY*16+j)*f.stride + mbX*16
+		if string(f.Y[start:start+16]) != string(o.Y[start:start+16]) {
+			return false
+		}
+	}
+
+	cstride := f.stride / 2
+	for j := 0; j < 8; j++ {
+		start := (mbY*8+j)*cstride + mbX*8
+		if string(f.Cb[start:start+8]) != string(o.Cb[start:start+8]) ||
+			string(f.Cr[start:start+8]) != string(o.Cr[start:start+8]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// writePCMSamples writes the samples of a macroblock.
+func (f *Frame) writePCMSamples(w *bitWriter, mbX int, mbY int) {
+	samples := make([]byte, 0, 384)
+
+	for j := 0; j < 16; j++ {
+		start := (mbY*16+j)*f.stride + mbX*16
+		samples = append(samples, f.Y[start:start+16]...)
+	}
+
+	cstride := f.stride / 2
+	for _, plane := range [][]byte{f.Cb, f.Cr} {
+		for j := 0; j < 8; j++ {
+			start := (mbY*8+j)*cstride + mbX*8
+			samples = append(samples, plane[start:start+8]...)
+		}
+	}
+
+	// zero samples are forbidden by early versions of the specification
+	for i, s := range samples {
+		if s == 0 {
+			samples[i] = 1
+		}
+	}
+
+	w.writeBytes(samples)
+}
@@ -0,0 +1,128 @@
+package testsrc
+
+import (
+	"fmt"
+)
+
+// Color is a color in the YCbCr format, with limited range (BT.601).
+type Color struct {
+	Y  byte
+	Cb byte
+	Cr byte
+}
+
+// colors of 75% color bars.
+var (
+	colorWhite   = Color{180, 128, 128}
+	colorYellow  = Color{162, 44, 142}
+	colorCyan    = Color{131, 156, 44}
+	colorGreen   = Color{112, 72, 58}
+	colorMagenta = Color{84, 184, 198}
+	colorRed     = Color{65, 100, 212}
+	colorBlue    = Color{35, 212, 114}
+	colorBlack   = Color{16, 128, 128}
+	colorText    = Color{235, 128, 128}
+)
+
+var bars = []Color{
+	colorWhite,
+	colorYellow,
+	colorCyan,
+	colorGreen,
+	colorMagenta,
+	colorRed,
+	colorBlue,
+}
+
+// 5x7 font of the characters used by the timecode.
+var glyphs = map[rune][7]string{
+	'0': {" ### ", "#   #", "#  ##", "# # #", "##  #", "#   #", " ### "},
+	'1': {"  #  ", " ##  ", "  #  ", "  #  ", "  #  ", "  #  ", " ### "},
+	'2': {" ### ", "#   #", "    #", "   # ", "  #  ", " #   ", "#####"},
+	'3': {"#####", "   # ", "  #  ", "   # ", "    #", "#   #", " ### "},
+	'4': {"   # ", "  ## ", " # # ", "#  # ", "#####", "   # ", "   # "},
+	'5': {"#####", "#    ", "#### ", "    #", "    #", "#   #", " ### "},
+	'6': {"  ## ", " #   ", "#    ", "#### ", "#   #", "#   #", " ### "},
+	'7': {"#####", "    #", "   # ", "  #  ", " #   ", " #   ", " #   "},
+	'8': {" ### ", "#   #", "#   #", " ### ", "#   #", "#   #", " ### "},
+	'9': {" ### ", "#   #", "#   #", " ####", "    #", "   # ", " ##  "},
+	':': {"     ", "  #  ", "  #  ", "     ", "  #  ", "  #  ", "     "},
+}
+
+const (
+	glyphWidth  = 5
+	glyphHeight = 7
+
+	// length of a timecode in the HH:MM:SS:FF format.
+	timecodeLen = 11
+)
+
+// Pattern draws color bars, with a timecode burned into the lower part of the picture.
+type Pattern struct {
+	fps   int
+	frame *Frame
+
+	textY     int
+	textScale int
+}
+
+// NewPattern allocates a Pattern.
+func NewPattern(width int, height int, fps int) *Pattern {
+	p := &Pattern{
+		fps:   fps,
+		frame: NewFrame(width, height),
+	}
+
+	barsHeight := height * 2 / 3
+	for i, c := range bars {
+		x := i * width / len(bars)
+		p.frame.FillRect(x, 0, (i+1)*width/len(bars)-x, barsHeight, c)
+	}
+
+	// the timecode fills the width of the picture, with a character of margin on both sides
+	p.textScale = width / ((timecodeLen + 2) * (glyphWidth + 1))
+	if s := (height - barsHeight) / (glyphHeight * 2); s < p.textScale {
+		p.textScale = s
+	}
+	if p.textScale < 1 {
+		p.textScale = 1
+	}
+
+	p.textY = barsHeight + (height-barsHeight-glyphHeight*p.textScale)/2
+
+	return p
+}
+
+// Timecode returns the timecode of a frame, in the HH:MM:SS:FF format.
+func Timecode(n int, fps int) string {
+	secs := n / fps
+	return fmt.Sprintf("%02d:%02d:%02d:%02d",
+		(secs/3600)%24, (secs/60)%60, secs%60, n%fps)
+}
+
+// Draw draws the n-th frame. The returned frame is valid until the next call to Draw.
+func (p *Pattern) Draw(n int) *Frame {
+	text := Timecode(n, p.fps)
+
+	advance := (glyphWidth + 1) * p.textScale
+	x := (p.frame.Width - len(text)*advance) / 2
+
+	for _, r := range text {
+		glyph := glyphs[r]
+
+		p.frame.FillRect(x, p.textY, advance, glyphHeight*p.textScale, colorBlack)
+
+		for gy, row := range glyph {
+			for gx, c := range row {
+				if c == '#' {
+					p.frame.FillRect(x+gx*p.textScale, p.textY+gy*p.textScale,
+						p.textScale, p.textScale, colorText)
+				}
+			}
+		}
+
+		x += advance
+	}
+
+	return p.frame
+}
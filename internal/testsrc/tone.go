@@ -0,0 +1,63 @@
+package testsrc
+
+import (
+	"math"
+)
+
+const (
+	// ToneSampleRate is the sample rate of the tone.
+	ToneSampleRate = 8000
+
+	toneFrequency = 1000
+
+	// -18 dBFS, the usual alignment level.
+	toneAmplitude = 0.125 * 32767
+)
+
+// encodeMuLaw encodes a 16-bit linear PCM sample with the G.711 mu-law algorithm.
+func encodeMuLaw(sample int16) byte {
+	const (
+		bias = 0x84
+		clip = 32635
+	)
+
+	s := int(sample)
+	sign := 0
+	if s < 0 {
+		s = -s
+		sign = 0x80
+	}
+	if s > clip {
+		s = clip
+	}
+	s += bias
+
+	exponent := 7
+	for mask := 0x4000; (s&mask) == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+
+	mantissa := (s >> (uint(exponent) + 3)) & 0x0F
+
+	return ^byte(sign | (exponent << 4) | mantissa)
+}
+
+// Tone generates a 1 kHz sine tone, encoded with G.711 mu-law.
+type Tone struct {
+	n int
+}
+
+// Read returns the next samples of the tone.
+func (t *Tone) Read(count int) []byte {
+	ret := make([]byte, count)
+
+	for i := range ret {
+		v := toneAmplitude * math.Sin(2*math.Pi*toneFrequency*float64(t.n)/ToneSampleRate)
+		ret[i] = encodeMuLaw(int16(v))
+
+		// the period of the tone is an integer number of samples
+		t.n = (t.n + 1) % (ToneSampleRate / toneFrequency)
+	}
+
+	return ret
+}
@@ -0,0 +1,38 @@
+package testsrc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeMuLaw(t *testing.T) {
+	for _, ca := range []struct {
+		in  int16
+		out byte
+	}{
+		{0, 0xFF},
+		{32767, 0x80},
+		{-32768, 0x00},
+		{1000, 0xCE},
+		{-1000, 0x4E},
+	} {
+		require.Equal(t, ca.out, encodeMuLaw(ca.in))
+	}
+}
+
+func TestTone(t *testing.T) {
+	var tone Tone
+	buf1 := tone.Read(160)
+	buf2 := tone.Read(160)
+
+	// 160 samples are an integer number of periods
+	require.Equal(t, buf1, buf2)
+	require.Equal(t, byte(0xFF), buf1[0])
+}
+
+func TestTimecode(t *testing.T) {
+	require.Equal(t, "00:00:00:00", Timecode(0, 30))
+	require.Equal(t, "00:00:01:05", Timecode(35, 30))
+	require.Equal(t, "01:01:01:24", Timecode((3661*25)+24, 25))
+}
@@ -0,0 +1,319 @@
+//go:build linux
+// +build linux
+
+package v4l2
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	bufferCount = 4
+
+	bufTypeVideoCapture = 1
+	memoryMMAP          = 1
+	fieldAny            = 0
+
+	capVideoCapture = 0x00000001
+	capStreaming    = 0x04000000
+)
+
+// layouts of the kernel structures; Go applies the same
+// alignment rules of C, therefore they have the same size on all architectures.
+
+type v4l2Capability struct {
+	driver       [16]byte
+	card         [32]byte
+	busInfo      [32]byte
+	version      uint32
+	capabilities uint32
+	deviceCaps   uint32
+	reserved     [3]uint32
+}
+
+type v4l2PixFormat struct {
+	width        uint32
+	height       uint32
+	pixelformat  uint32
+	field        uint32
+	bytesperline uint32
+	sizeimage    uint32
+	colorspace   uint32
+	priv         uint32
+	flags        uint32
+	ycbcrEnc     uint32
+	quantization uint32
+	xferFunc     uint32
+}
+
+type v4l2Format struct {
+	typ uint32
+	// the union contains pointers, therefore it is aligned to the pointer size.
+	_   [unsafe.Sizeof(uintptr(0)) - 4]byte
+	fmt [200]byte
+}
+
+type v4l2CaptureParm struct {
+	capability   uint32
+	capturemode  uint32
+	numerator    uint32
+	denominator  uint32
+	extendedmode uint32
+	readbuffers  uint32
+	reserved     [4]uint32
+}
+
+type v4l2StreamParm struct {
+	typ  uint32
+	parm [200]byte
+}
+
+type v4l2RequestBuffers struct {
+	count        uint32
+	typ          uint32
+	memory       uint32
+	capabilities uint32
+	flags        uint8
+	reserved     [3]uint8
+}
+
+type v4l2Buffer struct {
+	index     uint32
+	typ       uint32
+	bytesused uint32
+	flags     uint32
+	field     uint32
+	timestamp syscall.Timeval
+	timecode  [16]byte
+	sequence  uint32
+	memory    uint32
+	m         uintptr
+	length    uint32
+	reserved2 uint32
+	requestFD uint32
+}
+
+type v4l2Control struct {
+	id    uint32
+	value int32
+}
+
+const (
+	iocWrite = 1
+	iocRead  = 2
+)
+
+func ioc(dir uintptr, nr uintptr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | 'V'<<8 | nr
+}
+
+var (
+	vidiocQueryCap  = ioc(iocRead, 0, unsafe.Sizeof(v4l2Capability{}))
+	vidiocSFmt      = ioc(iocRead|iocWrite, 5, unsafe.Sizeof(v4l2Format{}))
+	vidiocReqBufs   = ioc(iocRead|iocWrite, 8, unsafe.Sizeof(v4l2RequestBuffers{}))
+	vidiocQueryBuf  = ioc(iocRead|iocWrite, 9, unsafe.Sizeof(v4l2Buffer{}))
+	vidiocQBuf      = ioc(iocRead|iocWrite, 15, unsafe.Sizeof(v4l2Buffer{}))
+	vidiocDQBuf     = ioc(iocRead|iocWrite, 17, unsafe.Sizeof(v4l2Buffer{}))
+	vidiocStreamOn  = ioc(iocWrite, 18, unsafe.Sizeof(int32(0)))
+	vidiocStreamOff = ioc(iocWrite, 19, unsafe.Sizeof(int32(0)))
+	vidiocSParm     = ioc(iocRead|iocWrite, 22, unsafe.Sizeof(v4l2StreamParm{}))
+	vidiocSCtrl     = ioc(iocRead|iocWrite, 28, unsafe.Sizeof(v4l2Control{}))
+)
+
+func ioctl(fd int, req uintptr, arg unsafe.Pointer) error {
+	for {
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(arg))
+		switch errno {
+		case 0:
+			return nil
+		case syscall.EINTR:
+			continue
+		default:
+			return errno
+		}
+	}
+}
+
+// Device is an open capture device.
+type Device struct {
+	fd      int
+	buffers [][]byte
+}
+
+// Open opens a capture device and starts the capture.
+func Open(path string, p Params) (*Device, error) {
+	fd, err := syscall.Open(path, syscall.O_RDWR|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Device{fd: fd}
+
+	err = d.setup(p)
+	if err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *Device) setup(p Params) error {
+	var capab v4l2Capability
+	err := ioctl(d.fd, vidiocQueryCap, unsafe.Pointer(&capab))
+	if err != nil {
+		return fmt.Errorf("not a V4L2 device: %s", err)
+	}
+
+	if (capab.capabilities&capVideoCapture) == 0 || (capab.capabilities&capStreaming) == 0 {
+		return fmt.Errorf("device doesn't support video capture with streaming")
+	}
+
+	format := v4l2Format{typ: bufTypeVideoCapture}
+	pix := (*v4l2PixFormat)(unsafe.Pointer(&format.fmt[0]))
+	pix.width = uint32(p.Width)
+	pix.height = uint32(p.Height)
+	pix.pixelformat = uint32(p.PixelFormat)
+	pix.field = fieldAny
+	err = ioctl(d.fd, vidiocSFmt, unsafe.Pointer(&format))
+	if err != nil {
+		return fmt.Errorf("unable to set format: %s", err)
+	}
+
+	// the driver can choose a different format when the requested one is not supported
+	if pix.pixelformat != uint32(p.PixelFormat) {
+		return fmt.Errorf("device doesn't support the requested pixel format")
+	}
+
+	if p.FPS > 0 {
+		parm := v4l2StreamParm{typ: bufTypeVideoCapture}
+		cp := (*v4l2CaptureParm)(unsafe.Pointer(&parm.parm[0]))
+		cp.numerator = 1
+		cp.denominator = uint32(p.FPS)
+		err = ioctl(d.fd, vidiocSParm, unsafe.Pointer(&parm))
+		if err != nil {
+			return fmt.Errorf("unable to set frame rate: %s", err)
+		}
+	}
+
+	for id, value := range p.Controls {
+		ctrl := v4l2Control{id: uint32(id), value: value}
+		err = ioctl(d.fd, vidiocSCtrl, unsafe.Pointer(&ctrl))
+		if err != nil {
+			return fmt.Errorf("unable to set control 0x%x: %s", uint32(id), err)
+		}
+	}
+
+	req := v4l2RequestBuffers{
+		count:  bufferCount,
+		typ:    bufTypeVideoCapture,
+		memory: memoryMMAP,
+	}
+	err = ioctl(d.fd, vidiocReqBufs, unsafe.Pointer(&req))
+	if err != nil {
+		return fmt.Errorf("unable to allocate buffers: %s", err)
+	}
+
+	for i := uint32(0); i < req.count; i++ {
+		buf := v4l2Buffer{
+			index:  i,
+			typ:    bufTypeVideoCapture,
+			memory: memoryMMAP,
+		}
+		err = ioctl(d.fd, vidiocQueryBuf, unsafe.Pointer(&buf))
+		if err != nil {
+			return fmt.Errorf("unable to query buffer: %s", err)
+		}
+
+		// the offset is stored in the lower 32 bits of the union
+		offset := int64(uint32(buf.m))
+		mem, err := syscall.Mmap(d.fd, offset, int(buf.length),
+			syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+		if err != nil {
+			return fmt.Errorf("unable to map buffer: %s", err)
+		}
+		d.buffers = append(d.buffers, mem)
+
+		err = ioctl(d.fd, vidiocQBuf, unsafe.Pointer(&buf))
+		if err != nil {
+			return fmt.Errorf("unable to queue buffer: %s", err)
+		}
+	}
+
+	typ := int32(bufTypeVideoCapture)
+	err = ioctl(d.fd, vidiocStreamOn, unsafe.Pointer(&typ))
+	if err != nil {
+		return fmt.Errorf("unable to start streaming: %s", err)
+	}
+
+	return nil
+}
+
+// Close stops the capture and closes the device.
+func (d *Device) Close() {
+	typ := int32(bufTypeVideoCapture)
+	ioctl(d.fd, vidiocStreamOff, unsafe.Pointer(&typ))
+
+	for _, mem := range d.buffers {
+		syscall.Munmap(mem)
+	}
+
+	syscall.Close(d.fd)
+}
+
+// wait waits until a frame is available, or until the timeout expires.
+func (d *Device) wait(timeout time.Duration) (bool, error) {
+	var fds syscall.FdSet
+	fds.Bits[d.fd/(8*int(unsafe.Sizeof(fds.Bits[0])))] |= 1 << (uint(d.fd) % (8 * uint(unsafe.Sizeof(fds.Bits[0]))))
+
+	tv := syscall.NsecToTimeval(timeout.Nanoseconds())
+
+	for {
+		n, err := syscall.Select(d.fd+1, &fds, nil, nil, &tv)
+		switch err {
+		case nil:
+			return n > 0, nil
+		case syscall.EINTR:
+			continue
+		default:
+			return false, err
+		}
+	}
+}
+
+// Read reads a frame. It returns nil when no frame has been received before the timeout.
+// The returned frame is a copy, that can be retained by the caller.
+func (d *Device) Read(timeout time.Duration) ([]byte, error) {
+	ok, err := d.wait(timeout)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	buf := v4l2Buffer{
+		typ:    bufTypeVideoCapture,
+		memory: memoryMMAP,
+	}
+	err = ioctl(d.fd, vidiocDQBuf, unsafe.Pointer(&buf))
+	if err != nil {
+		if err == syscall.EAGAIN {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to dequeue buffer: %s", err)
+	}
+
+	frame := make([]byte, buf.bytesused)
+	copy(frame, d.buffers[buf.index][:buf.bytesused])
+
+	err = ioctl(d.fd, vidiocQBuf, unsafe.Pointer(&buf))
+	if err != nil {
+		return nil, fmt.Errorf("unable to queue buffer: %s", err)
+	}
+
+	return frame, nil
+}
@@ -0,0 +1,41 @@
+//go:build linux
+// +build linux
+
+package v4l2
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIoctlNumbers(t *testing.T) {
+	if unsafe.Sizeof(uintptr(0)) != 8 {
+		t.Skip("values are checked on 64-bit architectures only")
+	}
+
+	// values of the kernel headers
+	require.Equal(t, uintptr(0x80685600), vidiocQueryCap)
+	require.Equal(t, uintptr(0xc0d05605), vidiocSFmt)
+	require.Equal(t, uintptr(0xc0145608), vidiocReqBufs)
+	require.Equal(t, uintptr(0xc0585609), vidiocQueryBuf)
+	require.Equal(t, uintptr(0xc058560f), vidiocQBuf)
+	require.Equal(t, uintptr(0xc0585611), vidiocDQBuf)
+	require.Equal(t, uintptr(0x40045612), vidiocStreamOn)
+	require.Equal(t, uintptr(0x40045613), vidiocStreamOff)
+	require.Equal(t, uintptr(0xc0cc5616), vidiocSParm)
+	require.Equal(t, uintptr(0xc008561c), vidiocSCtrl)
+}
+
+func TestOpenError(t *testing.T) {
+	_, err := Open("/dev/null", Params{
+		Width:       640,
+		Height:      480,
+		PixelFormat: PixelFormatH264,
+	})
+	require.Error(t, err)
+
+	_, err = Open("/nonexisting/video0", Params{})
+	require.Error(t, err)
+}
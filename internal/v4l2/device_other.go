@@ -0,0 +1,25 @@
+//go:build !linux
+// +build !linux
+
+package v4l2
+
+import (
+	"time"
+)
+
+// Device is an open capture device.
+type Device struct{}
+
+// Open opens a capture device and starts the capture.
+func Open(path string, p Params) (*Device, error) {
+	return nil, ErrUnsupported
+}
+
+// Close stops the capture and closes the device.
+func (d *Device) Close() {
+}
+
+// Read reads a frame. It returns nil when no frame has been received before the timeout.
+func (d *Device) Read(timeout time.Duration) ([]byte, error) {
+	return nil, ErrUnsupported
+}
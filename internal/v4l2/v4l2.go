@@ -0,0 +1,46 @@
+// Package v4l2 contains a minimal Video4Linux2 capture client, that reads
+// compressed frames from local cameras.
+package v4l2
+
+import (
+	"errors"
+)
+
+// PixelFormat is a V4L2 pixel format, encoded as a FourCC.
+type PixelFormat uint32
+
+func fourCC(a, b, c, d byte) PixelFormat {
+	return PixelFormat(uint32(a) | uint32(b)<<8 | uint32(c)<<16 | uint32(d)<<24)
+}
+
+// supported pixel formats.
+var (
+	PixelFormatH264 = fourCC('H', '2', '6', '4')
+)
+
+// Control is a V4L2 control.
+type Control uint32
+
+// controls that are used to configure hardware encoders.
+const (
+	ControlRotate         Control = 0x00980922 // V4L2_CID_ROTATE
+	ControlHFlip          Control = 0x00980914 // V4L2_CID_HFLIP
+	ControlVFlip          Control = 0x00980915 // V4L2_CID_VFLIP
+	ControlBitrate        Control = 0x009909cf // V4L2_CID_MPEG_VIDEO_BITRATE
+	ControlH264IPeriod    Control = 0x00990a66 // V4L2_CID_MPEG_VIDEO_H264_I_PERIOD
+	ControlRepeatSequence Control = 0x009909e2 // V4L2_CID_MPEG_VIDEO_REPEAT_SEQ_HEADER
+)
+
+// Params are the parameters of a capture.
+type Params struct {
+	Width       int
+	Height      int
+	FPS         int
+	PixelFormat PixelFormat
+
+	// optional controls, applied before the capture starts.
+	Controls map[Control]int32
+}
+
+// ErrUnsupported is returned on systems that don't provide V4L2.
+var ErrUnsupported = errors.New("V4L2 is available on Linux only")
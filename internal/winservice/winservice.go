@@ -0,0 +1,54 @@
+// Package winservice contains functions to run the server as a Windows service.
+package winservice
+
+import (
+	"fmt"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+const (
+	serviceName        = "rtsp-simple-server"
+	serviceDisplayName = "rtsp-simple-server"
+	serviceDescription = "RTSP / RTMP / HLS server and proxy"
+)
+
+// Main handles the "service" subcommand and returns the exit code.
+func Main(args []string) int {
+	k := kingpin.New("rtsp-simple-server service", "Manage the Windows service.")
+
+	cmdInstall := k.Command("install", "install the service, that starts automatically on boot.")
+	argInstallConfPath := cmdInstall.Arg("confpath", "path to a config file.").
+		Default("rtsp-simple-server.yml").String()
+
+	cmdUninstall := k.Command("uninstall", "stop and uninstall the service.")
+
+	cmdRun := k.Command("run", "run the server as a service. This is called by the service manager.")
+	argRunConfPath := cmdRun.Arg("confpath", "path to a config file.").
+		Default("rtsp-simple-server.yml").String()
+
+	var err error
+
+	switch kingpin.MustParse(k.Parse(args)) {
+	case cmdInstall.FullCommand():
+		err = install(*argInstallConfPath)
+		if err == nil {
+			fmt.Printf("service '%s' installed\n", serviceName)
+		}
+
+	case cmdUninstall.FullCommand():
+		err = uninstall()
+		if err == nil {
+			fmt.Printf("service '%s' uninstalled\n", serviceName)
+		}
+
+	case cmdRun.FullCommand():
+		err = run(*argRunConfPath)
+	}
+
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+// +build !windows
+
+package winservice
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMainNotSupported(t *testing.T) {
+	for _, args := range [][]string{
+		{"install", "rtsp-simple-server.yml"},
+		{"uninstall"},
+		{"run"},
+	} {
+		t.Run(args[0], func(t *testing.T) {
+			require.Equal(t, 1, Main(args))
+		})
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+// +build !windows
+
+package winservice
+
+import (
+	"fmt"
+)
+
+var errNotSupported = fmt.Errorf("services are supported on Windows only; use systemd on Linux")
+
+func install(confPath string) error {
+	return errNotSupported
+}
+
+func uninstall() error {
+	return errNotSupported
+}
+
+func run(confPath string) error {
+	return errNotSupported
+}
@@ -0,0 +1,175 @@
+//go:build windows
+// +build windows
+
+package winservice
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"github.com/aler9/rtsp-simple-server/internal/core"
+)
+
+const (
+	stopTimeout = 10 * time.Second
+)
+
+func install(confPath string) error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	// services are started in the system directory,
+	// therefore the configuration path must be absolute.
+	confPath, err = filepath.Abs(confPath)
+	if err != nil {
+		return err
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err == nil {
+		s.Close()
+		return fmt.Errorf("service '%s' already exists", serviceName)
+	}
+
+	s, err = m.CreateService(serviceName, exePath, mgr.Config{
+		DisplayName: serviceDisplayName,
+		Description: serviceDescription,
+		StartType:   mgr.StartAutomatic,
+	}, "service", "run", confPath)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	// register the event log source, in order to allow
+	// the "syslog" log destination to write into it.
+	err = eventlog.InstallAsEventCreate(serviceName,
+		eventlog.Error|eventlog.Warning|eventlog.Info)
+	if err != nil {
+		s.Delete()
+		return fmt.Errorf("unable to register the event log source: %s", err)
+	}
+
+	return nil
+}
+
+func uninstall() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service '%s' is not installed", serviceName)
+	}
+	defer s.Close()
+
+	status, err := s.Control(svc.Stop)
+	if err == nil {
+		deadline := time.Now().Add(stopTimeout)
+		for status.State != svc.Stopped && time.Now().Before(deadline) {
+			time.Sleep(300 * time.Millisecond)
+			status, err = s.Query()
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	err = s.Delete()
+	if err != nil {
+		return err
+	}
+
+	eventlog.Remove(serviceName)
+	return nil
+}
+
+func run(confPath string) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return err
+	}
+	if !isService {
+		return fmt.Errorf("this command must be launched by the service manager")
+	}
+
+	return svc.Run(serviceName, &handler{confPath: confPath})
+}
+
+type handler struct {
+	confPath string
+}
+
+// Execute implements svc.Handler.
+func (h *handler) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+
+	elog, err := eventlog.Open(serviceName)
+	if err == nil {
+		defer elog.Close()
+	}
+
+	logError := func(msg string) {
+		if elog != nil {
+			elog.Error(1, msg)
+		}
+	}
+
+	// relative paths inside the configuration are resolved
+	// from the directory of the configuration.
+	err = os.Chdir(filepath.Dir(h.confPath))
+	if err != nil {
+		logError(err.Error())
+		return true, 1
+	}
+
+	s, ok := core.New([]string{h.confPath})
+	if !ok {
+		logError("unable to start the server; check the configuration with --check-config")
+		return true, 1
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(done)
+	}()
+
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				changes <- c.CurrentStatus
+
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				s.Close()
+				return false, 0
+			}
+
+		case <-done:
+			logError("the server exited unexpectedly")
+			return true, 1
+		}
+	}
+}
@@ -3,10 +3,26 @@ package main
 import (
 	"os"
 
+	"github.com/aler9/rtsp-simple-server/internal/bench"
 	"github.com/aler9/rtsp-simple-server/internal/core"
+	"github.com/aler9/rtsp-simple-server/internal/healthcheck"
+	"github.com/aler9/rtsp-simple-server/internal/winservice"
 )
 
 func main() {
+	if len(os.Args) >= 2 {
+		switch os.Args[1] {
+		case "bench":
+			os.Exit(bench.Main(os.Args[2:]))
+
+		case "healthcheck":
+			os.Exit(healthcheck.Main(os.Args[2:]))
+
+		case "service":
+			os.Exit(winservice.Main(os.Args[2:]))
+		}
+	}
+
 	s, ok := core.New(os.Args[1:])
 	if !ok {
 		os.Exit(1)